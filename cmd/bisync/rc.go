@@ -15,8 +15,31 @@ func init() {
 		Path:         "sync/bisync",
 		AuthRequired: true,
 		Fn:           rcBisync,
-		Title:        shortHelp,
-		Help:         rcHelp,
+		Input: []rc.Param{
+			{Name: "path1", Type: rc.ParamFs, Required: true, Help: "a remote directory string e.g. drive:path1"},
+			{Name: "path2", Type: rc.ParamFs, Required: true, Help: "a remote directory string e.g. drive:path2"},
+			{Name: "dryRun", Type: rc.ParamBoolean, Help: "dry-run mode"},
+			{Name: "resync", Type: rc.ParamBoolean, Help: "performs the resync run"},
+			{Name: "checkAccess", Type: rc.ParamBoolean, Help: "abort if check files are not found on both filesystems"},
+			{Name: "checkFilename", Type: rc.ParamString, Help: "file name for checkAccess"},
+			{Name: "maxDelete", Type: rc.ParamInteger, Help: "abort sync if percentage of deleted files is above this threshold"},
+			{Name: "force", Type: rc.ParamBoolean, Help: "bypass maxDelete safety check and run the sync"},
+			{Name: "checkSync", Type: rc.ParamString, Help: `"true", "false" or "only"`},
+			{Name: "createEmptySrcDirs", Type: rc.ParamBoolean, Help: "sync creation and deletion of empty directories"},
+			{Name: "removeEmptyDirs", Type: rc.ParamBoolean, Help: "remove empty directories at the final cleanup step"},
+			{Name: "filtersFile", Type: rc.ParamString, Help: "read filtering patterns from a file"},
+			{Name: "ignoreListingChecksum", Type: rc.ParamBoolean, Help: "do not use checksums for listings"},
+			{Name: "resilient", Type: rc.ParamBoolean, Help: "allow future runs to retry after certain less-serious errors"},
+			{Name: "workdir", Type: rc.ParamString, Help: "server directory for history files"},
+			{Name: "backupdir1", Type: rc.ParamString, Help: "--backup-dir for Path1"},
+			{Name: "backupdir2", Type: rc.ParamString, Help: "--backup-dir for Path2"},
+			{Name: "noCleanup", Type: rc.ParamBoolean, Help: "retain working files"},
+		},
+		Output: []rc.Param{
+			{Name: "output", Type: rc.ParamString, Help: "the output of the bisync run"},
+		},
+		Title: shortHelp,
+		Help:  rcHelp,
 	})
 }
 
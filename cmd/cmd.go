@@ -30,6 +30,7 @@ import (
 	"github.com/rclone/rclone/fs/fserrors"
 	"github.com/rclone/rclone/fs/fspath"
 	fslog "github.com/rclone/rclone/fs/log"
+	"github.com/rclone/rclone/fs/notify"
 	"github.com/rclone/rclone/fs/rc"
 	"github.com/rclone/rclone/fs/rc/rcserver"
 	fssync "github.com/rclone/rclone/fs/sync"
@@ -240,6 +241,7 @@ func ShowStats() bool {
 func Run(Retry bool, showStats bool, cmd *cobra.Command, f func() error) {
 	ctx := context.Background()
 	ci := fs.GetConfig(ctx)
+	startTime := time.Now()
 	var cmdErr error
 	stopStats := func() {}
 	if !showStats && ShowStats() {
@@ -336,6 +338,7 @@ func Run(Retry bool, showStats bool, cmd *cobra.Command, f func() error) {
 			fs.Logf(nil, "Failed to %s with %d errors: last error was: %v", cmd.Name(), nerrs, cmdErr)
 		}
 	}
+	notify.CommandFinished(ctx, cmd.Name(), startTime, cmdErr)
 	resolveExitCode(cmdErr)
 }
 
@@ -529,28 +529,78 @@ func (fsys *FS) Fsyncdir(path string, datasync bool, fh uint64) (errc int) {
 	return 0
 }
 
+// lookupXattrFile finds the file for the extended attribute calls
+//
+// Directories don't have extended attributes so file is nil for them.
+func (fsys *FS) lookupXattrFile(path string) (file *vfs.File, errc int) {
+	if !fsys.opt.Xattrs {
+		return nil, -fuse.ENOSYS
+	}
+	node, errc := fsys.lookupNode(path)
+	if errc != 0 {
+		return nil, errc
+	}
+	file, _ = node.(*vfs.File)
+	return file, 0
+}
+
 // Setxattr sets extended attributes.
 func (fsys *FS) Setxattr(path string, name string, value []byte, flags int) (errc int) {
 	defer log.Trace(path, "name=%q, value=%q, flags=%d", name, value, flags)("errc=%d", &errc)
-	return -fuse.ENOSYS
+	file, errc := fsys.lookupXattrFile(path)
+	if errc != 0 {
+		return errc
+	}
+	if file == nil {
+		return -fuse.ENOTSUP
+	}
+	return translateError(file.SetXattr(name, value, flags))
 }
 
 // Getxattr gets extended attributes.
 func (fsys *FS) Getxattr(path string, name string) (errc int, value []byte) {
 	defer log.Trace(path, "name=%q", name)("errc=%d, value=%q", &errc, &value)
-	return -fuse.ENOSYS, nil
+	file, errc := fsys.lookupXattrFile(path)
+	if errc != 0 {
+		return errc, nil
+	}
+	if file == nil {
+		return -fuse.ENOATTR, nil
+	}
+	value, err := file.GetXattr(name)
+	return translateError(err), value
 }
 
 // Removexattr removes extended attributes.
 func (fsys *FS) Removexattr(path string, name string) (errc int) {
 	defer log.Trace(path, "name=%q", name)("errc=%d", &errc)
-	return -fuse.ENOSYS
+	file, errc := fsys.lookupXattrFile(path)
+	if errc != 0 {
+		return errc
+	}
+	if file == nil {
+		return -fuse.ENOATTR
+	}
+	return translateError(file.RemoveXattr(name))
 }
 
 // Listxattr lists extended attributes.
 func (fsys *FS) Listxattr(path string, fill func(name string) bool) (errc int) {
 	defer log.Trace(path, "fill=%p", fill)("errc=%d", &errc)
-	return -fuse.ENOSYS
+	file, errc := fsys.lookupXattrFile(path)
+	if errc != 0 || file == nil {
+		return errc
+	}
+	names, err := file.ListXattr()
+	if err != nil {
+		return translateError(err)
+	}
+	for _, name := range names {
+		if !fill(name) {
+			return -fuse.ERANGE
+		}
+	}
+	return 0
 }
 
 // Getpath allows a case-insensitive file system to report the correct case of
@@ -599,6 +649,14 @@ func translateError(err error) (errc int) {
 		return -fuse.EINVAL
 	case vfs.ELOOP:
 		return -fuse.ELOOP
+	case vfs.ENOATTR:
+		return -fuse.ENOATTR
+	case vfs.ENOTSUP:
+		return -fuse.ENOTSUP
+	case vfs.ENOSPC:
+		return -fuse.ENOSPC
+	case vfs.EAGAIN:
+		return -fuse.EAGAIN
 	}
 	fs.Errorf(nil, "IO error: %v", err)
 	return -fuse.EIO
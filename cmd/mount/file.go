@@ -82,7 +82,7 @@ func (f *File) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenR
 		resp.Flags |= fuse.OpenDirectIO
 	}
 
-	return &FileHandle{handle}, nil
+	return &FileHandle{Handle: handle}, nil
 }
 
 // Check interface satisfied
@@ -100,23 +100,41 @@ func (f *File) Fsync(ctx context.Context, req *fuse.FsyncRequest) (err error) {
 // node.
 //
 // If there is no xattr by that name, returns fuse.ErrNoXattr.
-func (f *File) Getxattr(ctx context.Context, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) error {
-	return syscall.ENOSYS // we never implement this
+func (f *File) Getxattr(ctx context.Context, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) (err error) {
+	if !f.fsys.opt.Xattrs {
+		return syscall.ENOSYS
+	}
+	defer log.Trace(f, "name=%q", req.Name)("err=%v", &err)
+	resp.Xattr, err = f.File.GetXattr(req.Name)
+	return translateError(err)
 }
 
 var _ fusefs.NodeGetxattrer = (*File)(nil)
 
 // Listxattr lists the extended attributes recorded for the node.
-func (f *File) Listxattr(ctx context.Context, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) error {
-	return syscall.ENOSYS // we never implement this
+func (f *File) Listxattr(ctx context.Context, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) (err error) {
+	if !f.fsys.opt.Xattrs {
+		return syscall.ENOSYS
+	}
+	defer log.Trace(f, "")("err=%v", &err)
+	names, err := f.File.ListXattr()
+	if err != nil {
+		return translateError(err)
+	}
+	resp.Append(names...)
+	return nil
 }
 
 var _ fusefs.NodeListxattrer = (*File)(nil)
 
 // Setxattr sets an extended attribute with the given name and
 // value for the node.
-func (f *File) Setxattr(ctx context.Context, req *fuse.SetxattrRequest) error {
-	return syscall.ENOSYS // we never implement this
+func (f *File) Setxattr(ctx context.Context, req *fuse.SetxattrRequest) (err error) {
+	if !f.fsys.opt.Xattrs {
+		return syscall.ENOSYS
+	}
+	defer log.Trace(f, "name=%q, flags=%d", req.Name, req.Flags)("err=%v", &err)
+	return translateError(f.File.SetXattr(req.Name, req.Xattr, int(req.Flags)))
 }
 
 var _ fusefs.NodeSetxattrer = (*File)(nil)
@@ -124,8 +142,12 @@ var _ fusefs.NodeSetxattrer = (*File)(nil)
 // Removexattr removes an extended attribute for the name.
 //
 // If there is no xattr by that name, returns fuse.ErrNoXattr.
-func (f *File) Removexattr(ctx context.Context, req *fuse.RemovexattrRequest) error {
-	return syscall.ENOSYS // we never implement this
+func (f *File) Removexattr(ctx context.Context, req *fuse.RemovexattrRequest) (err error) {
+	if !f.fsys.opt.Xattrs {
+		return syscall.ENOSYS
+	}
+	defer log.Trace(f, "name=%q", req.Name)("err=%v", &err)
+	return translateError(f.File.RemoveXattr(req.Name))
 }
 
 var _ fusefs.NodeRemovexattrer = (*File)(nil)
@@ -4,7 +4,12 @@ package mount
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"math"
+	"sync"
+	"syscall"
+	"time"
 
 	"bazil.org/fuse"
 	fusefs "bazil.org/fuse/fs"
@@ -15,6 +20,8 @@ import (
 // FileHandle is an open for read file handle on a File
 type FileHandle struct {
 	vfs.Handle
+	mu        sync.Mutex // protects lockToken
+	lockToken string     // token of the flock lock held by this handle if any
 }
 
 // Check interface satisfied
@@ -78,5 +85,101 @@ var _ fusefs.HandleReleaser = (*FileHandle)(nil)
 // the kernel
 func (fh *FileHandle) Release(ctx context.Context, req *fuse.ReleaseRequest) (err error) {
 	defer log.Trace(fh, "")("err=%v", &err)
+	fh.mu.Lock()
+	_ = fh._unlock()
+	fh.mu.Unlock()
 	return translateError(fh.Handle.Release())
 }
+
+var _ fusefs.HandleFlockLocker = (*FileHandle)(nil)
+
+// _unlock releases the flock lock if held
+//
+// Call with fh.mu held
+func (fh *FileHandle) _unlock() error {
+	if fh.lockToken == "" {
+		return nil
+	}
+	err := fh.Node().VFS().Locks().Unlock(fh.lockToken)
+	fh.lockToken = ""
+	return err
+}
+
+// Lock tries to acquire a flock lock on the file returning EAGAIN if a
+// conflicting lock is held.
+//
+// The locks are only passed to rclone when --vfs-lock-file is set so
+// they are shared with other rclone instances.
+func (fh *FileHandle) Lock(ctx context.Context, req *fuse.LockRequest) (err error) {
+	defer log.Trace(fh, "type=%v, owner=%v", req.Lock.Type, req.LockOwner)("err=%v", &err)
+	if req.LockFlags&fuse.LockFlock == 0 {
+		return syscall.ENOTSUP
+	}
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+	// Changing the type of a flock isn't atomic so release the old lock first
+	if err = fh._unlock(); err != nil {
+		return translateError(err)
+	}
+	owner := fmt.Sprintf("flock pid %d", req.Lock.PID)
+	lock, err := fh.Node().VFS().Locks().Lock(fh.Node().Path(), owner, req.Lock.Type == fuse.LockWrite, false, 0)
+	if err != nil {
+		return translateError(err)
+	}
+	fh.lockToken = lock.Token
+	return nil
+}
+
+// LockWait acquires a flock lock on the file, waiting until the lock
+// can be obtained or the context is cancelled.
+func (fh *FileHandle) LockWait(ctx context.Context, req *fuse.LockWaitRequest) (err error) {
+	sleep := 10 * time.Millisecond
+	for {
+		err = fh.Lock(ctx, (*fuse.LockRequest)(req))
+		if err != fuse.Errno(syscall.EAGAIN) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return syscall.EINTR
+		case <-time.After(sleep):
+		}
+		sleep = min(2*sleep, time.Second)
+	}
+}
+
+// Unlock releases the flock lock on the file
+func (fh *FileHandle) Unlock(ctx context.Context, req *fuse.UnlockRequest) (err error) {
+	defer log.Trace(fh, "owner=%v", req.LockOwner)("err=%v", &err)
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+	return translateError(fh._unlock())
+}
+
+// QueryLock returns a conflicting lock if there is one
+func (fh *FileHandle) QueryLock(ctx context.Context, req *fuse.QueryLockRequest, resp *fuse.QueryLockResponse) (err error) {
+	defer log.Trace(fh, "type=%v", req.Lock.Type)("resp=%v, err=%v", resp, &err)
+	fh.mu.Lock()
+	lockToken := fh.lockToken
+	fh.mu.Unlock()
+	locks, err := fh.Node().VFS().Locks().Find(fh.Node().Path())
+	if err != nil {
+		return translateError(err)
+	}
+	for _, lock := range locks {
+		if lock.Token == lockToken || (!lock.Exclusive && req.Lock.Type != fuse.LockWrite) {
+			continue
+		}
+		resp.Lock = fuse.FileLock{
+			Start: 0,
+			End:   math.MaxUint64,
+			Type:  fuse.LockRead,
+			PID:   -1,
+		}
+		if lock.Exclusive {
+			resp.Lock.Type = fuse.LockWrite
+		}
+		break
+	}
+	return nil
+}
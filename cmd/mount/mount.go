@@ -49,6 +49,10 @@ func mountOptions(VFS *vfs.VFS, device string, opt *mountlib.Options) (options [
 	if opt.WritebackCache {
 		options = append(options, fuse.WritebackCache())
 	}
+	if VFS.Opt.LockFile != "" {
+		// Pass flock(2) locks to the lock file so they are shared
+		options = append(options, fuse.LockingFlock())
+	}
 	if opt.DaemonTimeout != 0 {
 		options = append(options, fuse.DaemonTimeout(fmt.Sprint(int(time.Duration(opt.DaemonTimeout).Seconds()))))
 	}
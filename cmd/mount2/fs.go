@@ -135,6 +135,14 @@ func translateError(err error) syscall.Errno {
 		return syscall.EINVAL
 	case vfs.ELOOP:
 		return syscall.ELOOP
+	case vfs.ENOATTR:
+		return syscall.ENODATA
+	case vfs.ENOTSUP:
+		return syscall.ENOTSUP
+	case vfs.ENOSPC:
+		return syscall.ENOSPC
+	case vfs.EAGAIN:
+		return syscall.EAGAIN
 	}
 	fs.Errorf(nil, "IO error: %v", err)
 	return syscall.EIO
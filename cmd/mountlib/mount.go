@@ -138,6 +138,11 @@ var OptionsInfo = fs.Options{{
 	Default: false,
 	Help:    "Ignore all \"com.apple.*\" extended attributes (supported on OSX only)",
 	Groups:  "Mount",
+}, {
+	Name:    "xattrs",
+	Default: false,
+	Help:    "Map user.* extended attributes onto the metadata of files (not supported on Windows)",
+	Groups:  "Mount",
 }, {
 	Name:    "network_mode",
 	Default: false,
@@ -184,6 +189,7 @@ type Options struct {
 	VolumeName         string        `config:"volname"`
 	NoAppleDouble      bool          `config:"noappledouble"`
 	NoAppleXattr       bool          `config:"noapplexattr"`
+	Xattrs             bool          `config:"xattrs"`
 	DaemonTimeout      fs.Duration   `config:"daemon_timeout"` // OSXFUSE only
 	AsyncRead          bool          `config:"async_read"`
 	NetworkMode        bool          `config:"network_mode"` // Windows only
@@ -357,6 +363,10 @@ func NewMountCommand(commandName string, hidden bool, mount MountFn) *cobra.Comm
 // Mount the remote at mountpoint
 func (m *MountPoint) Mount() (mountDaemon *os.Process, err error) {
 
+	if err := vfscommon.RefuseACL(&m.VFSOpt); err != nil {
+		return nil, err
+	}
+
 	// Ensure sensible defaults
 	m.SetVolumeName(m.MountOpt.VolumeName)
 	m.SetDeviceName(m.MountOpt.DeviceName)
@@ -9,6 +9,7 @@ import (
 	"github.com/rclone/rclone/fs/rc"
 	"github.com/rclone/rclone/fs/rc/rcflags"
 	"github.com/rclone/rclone/fs/rc/rcserver"
+	"github.com/rclone/rclone/fs/rc/schedule"
 	libhttp "github.com/rclone/rclone/lib/http"
 	"github.com/rclone/rclone/lib/systemd"
 	"github.com/spf13/cobra"
@@ -31,6 +32,11 @@ the browser when rclone is run.
 
 See the [rc documentation](/rc/) for more info on the rc flags.
 
+rclone rcd can also run rc calls on cron style schedules, for example
+a nightly ` + "`sync/sync`" + `. Add them with the ` + "`schedule/add`" + ` rc call - they
+are saved in ` + "`schedules.json`" + ` next to the config file so they survive
+restarts.
+
 ` + libhttp.Help(rcflags.FlagPrefix) + libhttp.TemplateHelp(rcflags.FlagPrefix) + libhttp.AuthHelp(rcflags.FlagPrefix),
 	Annotations: map[string]string{
 		"versionIntroduced": "v1.45",
@@ -56,6 +62,11 @@ See the [rc documentation](/rc/) for more info on the rc flags.
 			fs.Fatal(nil, "rc server not configured")
 		}
 
+		// Run the scheduled rc calls
+		if err := schedule.Start(context.Background()); err != nil {
+			fs.Fatalf(nil, "Failed to start scheduler: %v", err)
+		}
+
 		// Notify stopping on exit
 		defer systemd.Notify()()
 
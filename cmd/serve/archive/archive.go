@@ -0,0 +1,298 @@
+// Package archive streams directories from the VFS as zip or tar
+// archives for the servers which show directory listings.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/vfs"
+)
+
+// Help describes the directory downloads
+var Help = strings.ReplaceAll(`#### Directory downloads
+
+Adding |?download=zip| or |?download=tar| to the URL of a directory
+downloads the directory and everything in it as a zip or tar archive.
+To download only some of the entries of the directory add their names
+with |name=| parameters, for example
+|?download=zip&name=photos&name=notes.txt|. The default template shows
+a checkbox next to each entry to do this.
+
+The archive is streamed from the remote as it is made so no temporary
+files are used. The filters (e.g. |--include|, |--max-size|) control
+what goes in it. Use |--archive-max-size| to limit the total size of
+the files in a download.
+
+`, "|", "`")
+
+// OptionsInfo describes the Options in use
+var OptionsInfo = fs.Options{{
+	Name:    "archive_max_size",
+	Default: fs.SizeSuffix(-1),
+	Help:    "Max total size of the files in a directory download",
+}}
+
+// Options for directory downloads
+type Options struct {
+	MaxSize fs.SizeSuffix `config:"archive_max_size"`
+}
+
+// DefaultOpt is the default values used for Options
+var DefaultOpt = Options{
+	MaxSize: -1,
+}
+
+// Formats supported by ?download=
+var formats = map[string]struct {
+	ext         string
+	contentType string
+	newWriter   func(out io.Writer) writer
+}{
+	"zip": {".zip", "application/zip", newZipWriter},
+	"tar": {".tar", "application/x-tar", newTarWriter},
+}
+
+// writer writes the entries of an archive
+type writer interface {
+	// dir adds the directory called name
+	dir(name string, modTime time.Time) error
+	// file adds the file called name reading size bytes from in
+	file(name string, size int64, modTime time.Time, in io.Reader) error
+	// Close finishes the archive
+	Close() error
+}
+
+// zipWriter writes zip archives
+type zipWriter struct {
+	*zip.Writer
+}
+
+func newZipWriter(out io.Writer) writer {
+	return zipWriter{zip.NewWriter(out)}
+}
+
+func (w zipWriter) dir(name string, modTime time.Time) error {
+	_, err := w.CreateHeader(&zip.FileHeader{
+		Name:     name + "/",
+		Modified: modTime,
+	})
+	return err
+}
+
+func (w zipWriter) file(name string, size int64, modTime time.Time, in io.Reader) error {
+	out, err := w.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modTime,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	return err
+}
+
+// tarWriter writes tar archives
+type tarWriter struct {
+	*tar.Writer
+}
+
+func newTarWriter(out io.Writer) writer {
+	return tarWriter{tar.NewWriter(out)}
+}
+
+func (w tarWriter) dir(name string, modTime time.Time) error {
+	return w.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     name + "/",
+		Mode:     0755,
+		ModTime:  modTime,
+		Format:   tar.FormatPAX,
+	})
+}
+
+func (w tarWriter) file(name string, size int64, modTime time.Time, in io.Reader) error {
+	err := w.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0644,
+		ModTime:  modTime,
+		Format:   tar.FormatPAX,
+	})
+	if err != nil {
+		return err
+	}
+	// The size in the header must be exact
+	n, err := io.CopyN(w, in, size)
+	if err == io.EOF {
+		err = fmt.Errorf("file changed size: read %d bytes, expecting %d", n, size)
+	}
+	return err
+}
+
+// entry is a file or directory to put in the archive
+type entry struct {
+	name string // name in the archive
+	node vfs.Node
+}
+
+// list adds node and everything under it to entries, returning the
+// total size of the files
+func list(node vfs.Node, name string, entries *[]entry) (total int64, err error) {
+	*entries = append(*entries, entry{name: name, node: node})
+	dir, ok := node.(*vfs.Dir)
+	if !ok {
+		return max(node.Size(), 0), nil
+	}
+	nodes, err := dir.ReadDirAll()
+	if err != nil {
+		return 0, err
+	}
+	for _, child := range nodes {
+		size, err := list(child, path.Join(name, child.Name()), entries)
+		if err != nil {
+			return 0, err
+		}
+		total += size
+	}
+	return total, nil
+}
+
+// Requested returns whether r asks for a directory download
+func Requested(r *http.Request) bool {
+	return r.URL.Query().Get("download") != ""
+}
+
+// Serve streams dir as the archive asked for in the ?download=
+// parameter of r to w.
+//
+// If there are name= parameters only those entries of dir are put in
+// the archive.
+func Serve(w http.ResponseWriter, r *http.Request, opt *Options, dir *vfs.Dir) {
+	ctx := r.Context()
+	query := r.URL.Query()
+	format, ok := formats[query.Get("download")]
+	if !ok {
+		http.Error(w, fmt.Sprintf("Unknown download format %q - must be zip or tar", query.Get("download")), http.StatusBadRequest)
+		return
+	}
+
+	// The archive holds the contents of a directory named after dir
+	archiveName := dir.Name()
+	if archiveName == "/" {
+		archiveName = "rclone"
+	}
+
+	// Find what to put in the archive
+	var (
+		entries []entry
+		total   int64
+		err     error
+	)
+	names := query["name"]
+	if len(names) == 0 {
+		total, err = list(dir, archiveName, &entries)
+	} else {
+		entries = append(entries, entry{name: archiveName, node: dir})
+		for _, name := range names {
+			name = strings.TrimSuffix(name, "/")
+			if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+				http.Error(w, fmt.Sprintf("Bad name %q", name), http.StatusBadRequest)
+				return
+			}
+			var node vfs.Node
+			node, err = dir.Stat(name)
+			if err != nil {
+				break
+			}
+			var size int64
+			size, err = list(node, path.Join(archiveName, name), &entries)
+			if err != nil {
+				break
+			}
+			total += size
+		}
+	}
+	if err == vfs.ENOENT {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		fs.Errorf(dir.Path(), "Failed to list directory for download: %v", err)
+		http.Error(w, "Failed to list directory.", http.StatusInternalServerError)
+		return
+	}
+	if opt.MaxSize > 0 && total > int64(opt.MaxSize) {
+		http.Error(w, fmt.Sprintf("Download is %v which is more than the limit of %v", fs.SizeSuffix(total), opt.MaxSize), http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", format.contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": archiveName + format.ext,
+	}))
+	if r.Method == http.MethodHead {
+		return
+	}
+	fs.Infof(dir.Path(), "%s: Downloading %d entries (%v) as %s", r.RemoteAddr, len(entries), fs.SizeSuffix(total), archiveName+format.ext)
+
+	// Once we start writing the archive we can't return an error
+	// status so log errors and leave the archive unfinished
+	out := format.newWriter(w)
+	for _, e := range entries {
+		err = write(ctx, out, e)
+		if err != nil {
+			err = fs.CountError(ctx, err)
+			fs.Errorf(e.node.Path(), "Failed to add to download: %v", err)
+			return
+		}
+	}
+	err = out.Close()
+	if err != nil {
+		fs.Errorf(dir.Path(), "Failed to finish download: %v", err)
+	}
+}
+
+// write adds e to the archive
+func write(ctx context.Context, out writer, e entry) (err error) {
+	node := e.node
+	if node.IsDir() {
+		return out.dir(e.name, node.ModTime())
+	}
+	file, ok := node.(*vfs.File)
+	if !ok {
+		return nil
+	}
+	size := file.Size()
+	if size < 0 {
+		fs.Logf(file.Path(), "Not adding file of unknown size to download")
+		return nil
+	}
+	in, err := file.Open(os.O_RDONLY)
+	if err != nil {
+		return err
+	}
+	tr := accounting.Stats(ctx).NewTransferRemoteSize(file.Path(), size, nil, nil)
+	defer func() {
+		tr.Done(ctx, err)
+	}()
+	acc := tr.Account(ctx, in)
+	err = out.file(e.name, size, file.ModTime(), acc)
+	closeErr := acc.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
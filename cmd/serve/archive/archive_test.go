@@ -0,0 +1,153 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/vfs"
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newDir makes a VFS with some files in and returns the directory "dir"
+func newDir(t *testing.T) *vfs.Dir {
+	root := t.TempDir()
+	for name, contents := range map[string]string{
+		"dir/a.txt":          "aaa",
+		"dir/sub/b.txt":      "bbbbbb",
+		"dir/sub/deep/c.txt": "c",
+		"dir/other/d.txt":    "dddd",
+	} {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0777))
+		require.NoError(t, os.WriteFile(p, []byte(contents), 0666))
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(root, "dir", "empty"), 0777))
+	f, err := fs.NewFs(context.Background(), root)
+	require.NoError(t, err)
+	VFS := vfs.New(f, &vfscommon.Opt)
+	t.Cleanup(VFS.Shutdown)
+	node, err := VFS.Stat("dir")
+	require.NoError(t, err)
+	return node.(*vfs.Dir)
+}
+
+// get does a download of dir with query returning the response
+func get(t *testing.T, dir *vfs.Dir, opt *Options, query string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", "/dir/?"+query, nil)
+	require.True(t, Requested(r))
+	w := httptest.NewRecorder()
+	Serve(w, r, opt, dir)
+	return w
+}
+
+func readZip(t *testing.T, data []byte) map[string]string {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	files := map[string]string{}
+	for _, f := range zr.File {
+		in, err := f.Open()
+		require.NoError(t, err)
+		contents, err := io.ReadAll(in)
+		require.NoError(t, err)
+		require.NoError(t, in.Close())
+		files[f.Name] = string(contents)
+	}
+	return files
+}
+
+func readTar(t *testing.T, data []byte) map[string]string {
+	tr := tar.NewReader(bytes.NewReader(data))
+	files := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		contents, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		files[hdr.Name] = string(contents)
+	}
+	return files
+}
+
+func keys(files map[string]string) (names []string) {
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestServe(t *testing.T) {
+	dir := newDir(t)
+	opt := DefaultOpt
+
+	t.Run("Zip", func(t *testing.T) {
+		w := get(t, dir, &opt, "download=zip")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+		assert.Equal(t, "attachment; filename=dir.zip", w.Header().Get("Content-Disposition"))
+		files := readZip(t, w.Body.Bytes())
+		assert.Equal(t, []string{
+			"dir/",
+			"dir/a.txt",
+			"dir/empty/",
+			"dir/other/",
+			"dir/other/d.txt",
+			"dir/sub/",
+			"dir/sub/b.txt",
+			"dir/sub/deep/",
+			"dir/sub/deep/c.txt",
+		}, keys(files))
+		assert.Equal(t, "bbbbbb", files["dir/sub/b.txt"])
+	})
+
+	t.Run("Tar", func(t *testing.T) {
+		w := get(t, dir, &opt, "download=tar")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/x-tar", w.Header().Get("Content-Type"))
+		files := readTar(t, w.Body.Bytes())
+		assert.Len(t, files, 9)
+		assert.Equal(t, "c", files["dir/sub/deep/c.txt"])
+	})
+
+	t.Run("Names", func(t *testing.T) {
+		w := get(t, dir, &opt, "download=zip&name=a.txt&name=sub/")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{
+			"dir/",
+			"dir/a.txt",
+			"dir/sub/",
+			"dir/sub/b.txt",
+			"dir/sub/deep/",
+			"dir/sub/deep/c.txt",
+		}, keys(readZip(t, w.Body.Bytes())))
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, get(t, dir, &opt, "download=rar").Code)
+		assert.Equal(t, http.StatusBadRequest, get(t, dir, &opt, "download=zip&name=..").Code)
+		assert.Equal(t, http.StatusBadRequest, get(t, dir, &opt, "download=zip&name=sub/b.txt").Code)
+		assert.Equal(t, http.StatusNotFound, get(t, dir, &opt, "download=zip&name=potato").Code)
+	})
+
+	t.Run("MaxSize", func(t *testing.T) {
+		opt := Options{MaxSize: 10}
+		assert.Equal(t, http.StatusForbidden, get(t, dir, &opt, "download=zip").Code)
+		assert.Equal(t, http.StatusOK, get(t, dir, &opt, "download=zip&name=sub").Code)
+	})
+}
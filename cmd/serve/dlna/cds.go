@@ -32,9 +32,29 @@ func (cds *contentDirectoryService) updateIDString() string {
 
 var mediaMimeTypeRegexp = regexp.MustCompile("^(video|audio|image)/")
 
-// Turns the given entry and DMS host into a UPnP object. A nil object is
-// returned if the entry is not of interest.
-func (cds *contentDirectoryService) cdsObjectToUpnpavObject(cdsObject object, fileInfo vfs.Node, resources vfs.Nodes, host string) (ret any, err error) {
+// Returns the MIME type of the node, reading it from the fs.Object if
+// possible, otherwise working out what it is from the file name.
+func nodeMimeType(node vfs.Node) (mimeType string) {
+	if o, ok := node.DirEntry().(fs.Object); ok {
+		mimeType = fs.MimeType(context.TODO(), o)
+		// If backend doesn't know what the mime type is then
+		// try getting it from the file name
+		if mimeType == "application/octet-stream" {
+			mimeType = fs.MimeTypeFromName(node.Name())
+		}
+	} else {
+		mimeType = fs.MimeTypeFromName(node.Name())
+	}
+	return mimeType
+}
+
+// Turns the given entry and the request from the DMS client into a UPnP
+// object. A nil object is returned if the entry is not of interest.
+//
+// resources are the subtitles for the entry and thumbnail is its
+// sidecar image if any.
+func (cds *contentDirectoryService) cdsObjectToUpnpavObject(cdsObject object, fileInfo vfs.Node, resources vfs.Nodes, thumbnail vfs.Node, r *http.Request) (ret any, err error) {
+	host := r.Host
 	obj := upnpav.Object{
 		ID:         cdsObject.ID(),
 		Restricted: 1,
@@ -55,20 +75,7 @@ func (cds *contentDirectoryService) cdsObjectToUpnpavObject(cdsObject object, fi
 		return
 	}
 
-	// Read the mime type from the fs.Object if possible,
-	// otherwise fall back to working out what it is from the file path.
-	var mimeType string
-	if o, ok := fileInfo.DirEntry().(fs.Object); ok {
-		mimeType = fs.MimeType(context.TODO(), o)
-		// If backend doesn't know what the mime type is then
-		// try getting it from the file name
-		if mimeType == "application/octet-stream" {
-			mimeType = fs.MimeTypeFromName(fileInfo.Name())
-		}
-	} else {
-		mimeType = fs.MimeTypeFromName(fileInfo.Name())
-	}
-
+	mimeType := nodeMimeType(fileInfo)
 	mediaType := mediaMimeTypeRegexp.FindStringSubmatch(mimeType)
 	if mediaType == nil {
 		return
@@ -83,6 +90,29 @@ func (cds *contentDirectoryService) cdsObjectToUpnpavObject(cdsObject object, fi
 		Res:    make([]upnpav.Resource, 0, 1),
 	}
 
+	// Offer the versions the transcoding profiles make, the
+	// preferred ones before the original
+	var transcoded []upnpav.Resource
+	userAgent := r.Header.Get("User-Agent")
+	for _, p := range cds.transcodeProfiles {
+		if !p.matches(userAgent, mimeType) {
+			continue
+		}
+		res := upnpav.Resource{
+			URL: (&url.URL{
+				Scheme: "http",
+				Host:   host,
+				Path:   path.Join(transcodePath, p.Name, cdsObject.Path),
+			}).String(),
+			ProtocolInfo: fmt.Sprintf("http-get:*:%s:%s", p.Output, p.contentFeatures()),
+		}
+		if p.Prefer {
+			item.Res = append(item.Res, res)
+		} else {
+			transcoded = append(transcoded, res)
+		}
+	}
+
 	item.Res = append(item.Res, upnpav.Resource{
 		URL: (&url.URL{
 			Scheme: "http",
@@ -94,6 +124,7 @@ func (cds *contentDirectoryService) cdsObjectToUpnpavObject(cdsObject object, fi
 		}.String()),
 		Size: uint64(fileInfo.Size()),
 	})
+	item.Res = append(item.Res, transcoded...)
 
 	for _, resource := range resources {
 		subtitleURL := (&url.URL{
@@ -102,32 +133,46 @@ func (cds *contentDirectoryService) cdsObjectToUpnpavObject(cdsObject object, fi
 			Path:   path.Join(resPath, resource.Path()),
 		}).String()
 
-		// Read the mime type from the fs.Object if possible,
-		// otherwise fall back to working out what it is from the file path.
-		var mimeType string
-		if o, ok := resource.DirEntry().(fs.Object); ok {
-			mimeType = fs.MimeType(context.TODO(), o)
-			// If backend doesn't know what the mime type is then
-			// try getting it from the file name
-			if mimeType == "application/octet-stream" {
-				mimeType = fs.MimeTypeFromName(resource.Name())
-			}
-		} else {
-			mimeType = fs.MimeTypeFromName(resource.Name())
-		}
-
 		item.Res = append(item.Res, upnpav.Resource{
 			URL:          subtitleURL,
-			ProtocolInfo: fmt.Sprintf("http-get:*:%s:*", mimeType),
+			ProtocolInfo: fmt.Sprintf("http-get:*:%s:*", nodeMimeType(resource)),
 		})
 	}
 
+	// Add a thumbnail of images or of the sidecar image of videos
+	if cds.thumbnailer != nil {
+		thumbnailPathOf := ""
+		if mediaType[1] == "image" && isImage(fileInfo) {
+			thumbnailPathOf = cdsObject.Path
+		} else if thumbnail != nil {
+			thumbnailPathOf = thumbnail.Path()
+		}
+		if thumbnailPathOf != "" {
+			thumbnailURL := (&url.URL{
+				Scheme: "http",
+				Host:   host,
+				Path:   path.Join(thumbnailPath, thumbnailPathOf),
+			}).String()
+			profileName := cds.thumbnailer.profileName()
+			item.AlbumArtURI = &upnpav.AlbumArtURI{
+				ProfileID: profileName,
+				URI:       thumbnailURL,
+			}
+			item.Res = append(item.Res, upnpav.Resource{
+				URL: thumbnailURL,
+				ProtocolInfo: fmt.Sprintf("http-get:*:image/jpeg:%s", dlna.ContentFeatures{
+					ProfileName: profileName,
+				}.String()),
+			})
+		}
+	}
+
 	ret = item
 	return
 }
 
 // Returns all the upnpav objects in a directory.
-func (cds *contentDirectoryService) readContainer(o object, host string) (ret []any, err error) {
+func (cds *contentDirectoryService) readContainer(o object, r *http.Request) (ret []any, err error) {
 	node, err := cds.vfs.Stat(o.Path)
 	if err != nil {
 		return
@@ -172,11 +217,15 @@ func (cds *contentDirectoryService) readContainer(o object, host string) (ret []
 	})
 
 	dirEntries, mediaResources := mediaWithResources(dirEntries)
+	var thumbnails map[vfs.Node]vfs.Node
+	if cds.thumbnailer != nil {
+		dirEntries, thumbnails = mediaWithThumbnails(dirEntries)
+	}
 	for _, de := range dirEntries {
 		child := object{
 			path.Join(o.Path, de.Name()),
 		}
-		obj, err := cds.cdsObjectToUpnpavObject(child, de, mediaResources[de], host)
+		obj, err := cds.cdsObjectToUpnpavObject(child, de, mediaResources[de], thumbnails[de], r)
 		if err != nil {
 			fs.Errorf(cds, "error with %s: %s", child.FilePath(), err)
 			continue
@@ -267,8 +316,6 @@ func (cds *contentDirectoryService) objectFromID(id string) (o object, err error
 }
 
 func (cds *contentDirectoryService) Handle(action string, argsXML []byte, r *http.Request) (map[string]string, error) {
-	host := r.Host
-
 	switch action {
 	case "GetSystemUpdateID":
 		return map[string]string{
@@ -289,7 +336,7 @@ func (cds *contentDirectoryService) Handle(action string, argsXML []byte, r *htt
 		}
 		switch browse.BrowseFlag {
 		case "BrowseDirectChildren":
-			objs, err := cds.readContainer(obj, host)
+			objs, err := cds.readContainer(obj, r)
 			if err != nil {
 				return nil, upnp.Errorf(upnpav.NoSuchObjectErrorCode, "%s", err.Error())
 			}
@@ -317,7 +364,7 @@ func (cds *contentDirectoryService) Handle(action string, argsXML []byte, r *htt
 				return nil, err
 			}
 			// TODO: External subtitles won't appear in the metadata here, but probably should.
-			upnpObject, err := cds.cdsObjectToUpnpavObject(obj, node, vfs.Nodes{}, host)
+			upnpObject, err := cds.cdsObjectToUpnpavObject(obj, node, vfs.Nodes{}, nil, r)
 			if err != nil {
 				return nil, err
 			}
@@ -54,6 +54,14 @@ var OptionsInfo = fs.Options{{
 	Name:    "announce_interval",
 	Default: fs.Duration(12 * time.Minute),
 	Help:    "The interval between SSDP announcements",
+}, {
+	Name:    "thumbnail_size",
+	Default: 160,
+	Help:    "Max width and height of image thumbnails, 0 to disable",
+}, {
+	Name:    "transcode_config",
+	Default: "",
+	Help:    "JSON file of transcoding profiles",
 }}
 
 // Options is the type for DLNA serving options.
@@ -63,6 +71,8 @@ type Options struct {
 	LogTrace         bool        `config:"log_trace"`
 	InterfaceNames   []string    `config:"interface"`
 	AnnounceInterval fs.Duration `config:"announce_interval"`
+	ThumbnailSize    int         `config:"thumbnail_size"`
+	TranscodeConfig  string      `config:"transcode_config"`
 }
 
 // Opt contains the options for DLNA serving.
@@ -103,14 +113,56 @@ supported. Service discovery uses UDP multicast packets (SSDP) and
 will thus only work on LANs.
 
 Rclone will list all files present in the remote, without filtering
-based on media formats or file extensions. Additionally, there is no
-media transcoding support. This means that some players might show
-files that they are not able to play back correctly.
+based on media formats or file extensions. This means that some players
+might show files that they are not able to play back correctly unless a
+transcoding profile is set up for them (see below).
 
 Rclone will add external subtitle files (.srt) to videos if they have the same
 filename as the video file itself (except the extension), either in the same
 directory as the video, or in a "Subs" subdirectory.
 
+### Thumbnails
+
+Rclone makes JPEG thumbnails of images (JPEG, PNG and GIF) which fit
+in a square of ` + "`--thumbnail-size`" + ` pixels, 160 by default. At 160 or
+less these match the DLNA JPEG_TN profile which most devices show.
+Use ` + "`--thumbnail-size 0`" + ` to turn thumbnails off.
+
+Videos use an image next to them with the same name as their
+thumbnail, for example ` + "`film.jpg`, `film.png`, `film.tbn`" + `,
+` + "`film-thumb.jpg` or `film-poster.jpg` for `film.mkv`" + `. These images
+are then not listed separately.
+
+### Transcoding
+
+Rclone doesn't transcode media itself but it can run an external
+command, such as ffmpeg, to do it. Put the profiles in a JSON file and
+pass it with ` + "`--transcode-config`" + `. Each profile whose ` + "`user_agent`" + ` and
+` + "`input`" + ` regular expressions match the User-Agent of the device and the
+MIME type of the media is offered as an alternative version of it.
+
+` + "```json" + `
+[
+  {
+    "name": "mp4",
+    "user_agent": "Bravia|Samsung",
+    "input": "^video/(x-matroska|x-msvideo)$",
+    "output": "video/mp4",
+    "dlna_profile": "",
+    "prefer": true,
+    "command": ["ffmpeg", "-i", "{url}", "-c:v", "libx264", "-c:a", "aac",
+                "-movflags", "frag_keyframe+empty_moov", "-f", "mp4", "-"]
+  }
+]
+` + "```" + `
+
+The command must write the output to stdout. ` + "`{url}`" + ` in its arguments is
+replaced with the URL of the original, otherwise the original is fed
+to it on stdin. Set ` + "`prefer`" + ` to offer the transcoded version before the
+original, which most devices will then choose. Transcoded media can't
+be seeked in. At most 4 transcodes run at once and any more requests
+get "503 Service Unavailable".
+
 ### Server options
 
 Use ` + "`--addr`" + ` to specify which IP address and port the server should
@@ -172,9 +224,16 @@ type server struct {
 
 	f   fs.Fs
 	vfs *vfs.VFS
+
+	thumbnailer       *thumbnailer        // nil if thumbnails are disabled
+	transcodeProfiles []*transcodeProfile // from --transcode-config
+	transcodeSem      chan struct{}       // limits the transcoders run at once
 }
 
 func newServer(ctx context.Context, f fs.Fs, opt *Options, vfsOpt *vfscommon.Options) (*server, error) {
+	if err := vfscommon.RefuseACL(vfsOpt); err != nil {
+		return nil, err
+	}
 	friendlyName := opt.FriendlyName
 	if friendlyName == "" {
 		friendlyName = makeDefaultFriendlyName()
@@ -194,6 +253,10 @@ func newServer(ctx context.Context, f fs.Fs, opt *Options, vfsOpt *vfscommon.Opt
 	if len(interfaces) == 0 {
 		interfaces = listInterfaces()
 	}
+	transcodeProfiles, err := loadTranscodeProfiles(opt.TranscodeConfig)
+	if err != nil {
+		return nil, err
+	}
 
 	s := &server{
 		AnnounceInterval: time.Duration(opt.AnnounceInterval),
@@ -205,6 +268,9 @@ func newServer(ctx context.Context, f fs.Fs, opt *Options, vfsOpt *vfscommon.Opt
 		f:                f,
 		vfs:              vfs.New(f, vfsOpt),
 	}
+	s.thumbnailer = newThumbnailer(s.vfs, opt.ThumbnailSize)
+	s.transcodeProfiles = transcodeProfiles
+	s.transcodeSem = make(chan struct{}, maxTranscodes)
 
 	s.services = map[string]UPnPService{
 		"ContentDirectory": &contentDirectoryService{
@@ -222,6 +288,10 @@ func newServer(ctx context.Context, f fs.Fs, opt *Options, vfsOpt *vfscommon.Opt
 	r := http.NewServeMux()
 	r.Handle(resPath, http.StripPrefix(resPath,
 		http.HandlerFunc(s.resourceHandler)))
+	r.Handle(thumbnailPath, http.StripPrefix(thumbnailPath,
+		http.HandlerFunc(s.thumbnailHandler)))
+	r.Handle(transcodePath, http.StripPrefix(transcodePath,
+		http.HandlerFunc(s.transcodeHandler)))
 	if opt.LogTrace {
 		r.Handle(rootDescPath, traceLogging(http.HandlerFunc(s.rootDescHandler)))
 		r.Handle(serviceControlURL, traceLogging(http.HandlerFunc(s.serviceControlHandler)))
@@ -183,6 +183,9 @@ func TestContentDirectoryBrowseDirectChildren(t *testing.T) {
 	require.Contains(t, string(body), "/r/video.mp4")
 	require.Contains(t, string(body), "/r/video.srt")
 	require.Contains(t, string(body), "/r/video.en.srt")
+	// and a thumbnail of the image
+	require.Contains(t, string(body), "/t/small_jpeg.jpg")
+	require.Contains(t, string(body), "DLNA.ORG_PN=JPEG_TN")
 
 	// Then a subdirectory (subdir)
 	{
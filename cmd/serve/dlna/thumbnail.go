@@ -0,0 +1,227 @@
+package dlna
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // register the GIF decoder
+	"image/jpeg"
+	_ "image/png" // register the PNG decoder
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	libcache "github.com/rclone/rclone/lib/cache"
+	"github.com/rclone/rclone/vfs"
+)
+
+const (
+	thumbnailPath     = "/t/"
+	thumbnailQuality  = 80       // JPEG quality of the thumbnails
+	thumbnailMaxInput = 64 << 20 // max pixels in an image to make a thumbnail of
+	jpegTNSize        = 160      // max width and height of the DLNA JPEG_TN profile
+)
+
+// Names of images next to a video which are used as its thumbnail.
+// The video's base name is put in front of each of these.
+var sidecarSuffixes = []string{
+	".jpg", ".jpeg", ".png", ".tbn",
+	"-thumb.jpg", "-thumb.jpeg", "-thumb.png",
+	"-poster.jpg", "-poster.jpeg", "-poster.png",
+}
+
+// thumbnailer makes and caches JPEG thumbnails of images
+type thumbnailer struct {
+	vfs   *vfs.VFS
+	size  int // max width and height
+	cache *libcache.Cache
+	sem   chan struct{} // limits the thumbnails made at once
+}
+
+// newThumbnailer makes a thumbnailer for thumbnails of size or
+// returns nil if size is 0
+func newThumbnailer(VFS *vfs.VFS, size int) *thumbnailer {
+	if size <= 0 {
+		return nil
+	}
+	return &thumbnailer{
+		vfs:   VFS,
+		size:  size,
+		cache: libcache.New().SetExpireDuration(time.Hour),
+		sem:   make(chan struct{}, 4),
+	}
+}
+
+// profileName returns the DLNA profile of the thumbnails
+func (t *thumbnailer) profileName() string {
+	if t.size <= jpegTNSize {
+		return "JPEG_TN"
+	}
+	return ""
+}
+
+// isImage returns true if the node looks like an image we can decode
+func isImage(node vfs.Node) bool {
+	switch strings.ToLower(path.Ext(node.Name())) {
+	case ".jpg", ".jpeg", ".png", ".gif", ".tbn":
+		return true
+	}
+	return false
+}
+
+// mediaWithThumbnails finds the sidecar images of the videos in nodes
+// and removes them from nodes.
+//
+// The result is the nodes without the sidecars (in their original
+// order) and a map of video node to its sidecar image.
+func mediaWithThumbnails(nodes vfs.Nodes) (vfs.Nodes, map[vfs.Node]vfs.Node) {
+	byName := make(map[string]vfs.Node, len(nodes))
+	for _, node := range nodes {
+		if !node.IsDir() {
+			byName[strings.ToLower(node.Name())] = node
+		}
+	}
+	thumbnails := make(map[vfs.Node]vfs.Node)
+	sidecars := make(map[vfs.Node]struct{})
+	for _, node := range nodes {
+		if node.IsDir() || !strings.HasPrefix(fs.MimeTypeFromName(node.Name()), "video/") {
+			continue
+		}
+		baseName, _ := splitExt(strings.ToLower(node.Name()))
+		for _, suffix := range sidecarSuffixes {
+			if sidecar, found := byName[baseName+suffix]; found {
+				thumbnails[node] = sidecar
+				sidecars[sidecar] = struct{}{}
+				break
+			}
+		}
+	}
+	if len(sidecars) == 0 {
+		return nodes, thumbnails
+	}
+	media := make(vfs.Nodes, 0, len(nodes)-len(sidecars))
+	for _, node := range nodes {
+		if _, found := sidecars[node]; !found {
+			media = append(media, node)
+		}
+	}
+	return media, thumbnails
+}
+
+// thumbnail returns the JPEG thumbnail of the image at remote
+func (t *thumbnailer) thumbnail(remote string) ([]byte, error) {
+	node, err := t.vfs.Stat(remote)
+	if err != nil {
+		return nil, err
+	}
+	if !node.Mode().IsRegular() || !isImage(node) {
+		return nil, fmt.Errorf("%q is not an image", remote)
+	}
+	key := fmt.Sprintf("%s\x00%d\x00%d", node.Path(), node.Size(), node.ModTime().UnixNano())
+	value, err := t.cache.Get(key, func(key string) (any, bool, error) {
+		t.sem <- struct{}{}
+		defer func() { <-t.sem }()
+		data, err := t.make(node)
+		return data, err == nil, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.([]byte), nil
+}
+
+// make the thumbnail of node
+func (t *thumbnailer) make(node vfs.Node) (data []byte, err error) {
+	in, err := node.Open(os.O_RDONLY)
+	if err != nil {
+		return nil, err
+	}
+	defer fs.CheckClose(in, &err)
+
+	// Check the size first so we don't decode huge images
+	config, _, err := image.DecodeConfig(in)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+	if config.Width*config.Height > thumbnailMaxInput {
+		return nil, fmt.Errorf("image too large to make a thumbnail: %dx%d", config.Width, config.Height)
+	}
+	if _, err = in.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	src, _, err := image.Decode(in)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	var buf bytes.Buffer
+	err = jpeg.Encode(&buf, resize(src, t.size), &jpeg.Options{Quality: thumbnailQuality})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// resize src to fit in a size x size square keeping its aspect ratio
+//
+// Images smaller than this are returned as is. Each pixel of the
+// output is the average of up to 4x4 pixels of the input spread
+// evenly over the area it covers.
+func resize(src image.Image, size int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= size && h <= size {
+		return src
+	}
+	dw, dh := size, size
+	if w > h {
+		dh = max(1, h*size/w)
+	} else {
+		dw = max(1, w*size/h)
+	}
+	scaleX, scaleY := float64(w)/float64(dw), float64(h)/float64(dh)
+	samplesX, samplesY := min(4, int(scaleX+0.999)), min(4, int(scaleY+0.999))
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := range dh {
+		for x := range dw {
+			var r, g, bl, a, n uint32
+			for sy := range samplesY {
+				srcY := b.Min.Y + int((float64(y)+(float64(sy)+0.5)/float64(samplesY))*scaleY)
+				for sx := range samplesX {
+					srcX := b.Min.X + int((float64(x)+(float64(sx)+0.5)/float64(samplesX))*scaleX)
+					pr, pg, pb, pa := src.At(srcX, srcY).RGBA()
+					r, g, bl, a, n = r+pr, g+pg, bl+pb, a+pa, n+1
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8((r / n) >> 8),
+				G: uint8((g / n) >> 8),
+				B: uint8((bl / n) >> 8),
+				A: uint8((a / n) >> 8),
+			})
+		}
+	}
+	return dst
+}
+
+// Serves thumbnails of images
+func (s *server) thumbnailHandler(w http.ResponseWriter, r *http.Request) {
+	if s.thumbnailer == nil {
+		http.NotFound(w, r)
+		return
+	}
+	data, err := s.thumbnailer.thumbnail(r.URL.Path)
+	if err != nil {
+		fs.Debugf(r.URL.Path, "Failed to make thumbnail: %v", err)
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("transferMode.dlna.org", "Interactive")
+	http.ServeContent(w, r, r.URL.Path, time.Time{}, bytes.NewReader(data))
+}
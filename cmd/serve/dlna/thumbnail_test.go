@@ -0,0 +1,105 @@
+package dlna
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	localBackend "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/vfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResize(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 400, 100))
+	for y := range 100 {
+		for x := range 400 {
+			src.SetRGBA(x, y, color.RGBA{R: 200, G: 100, B: 50, A: 255})
+		}
+	}
+
+	dst := resize(src, 160)
+	assert.Equal(t, image.Rect(0, 0, 160, 40), dst.Bounds())
+	r, g, b, a := dst.At(80, 20).RGBA()
+	assert.Equal(t, []uint32{200, 100, 50, 255}, []uint32{r >> 8, g >> 8, b >> 8, a >> 8})
+
+	// portrait
+	dst = resize(image.NewRGBA(image.Rect(0, 0, 100, 400)), 160)
+	assert.Equal(t, image.Rect(0, 0, 40, 160), dst.Bounds())
+
+	// small images aren't enlarged
+	small := image.NewRGBA(image.Rect(0, 0, 10, 20))
+	assert.Equal(t, small, resize(small, 160))
+}
+
+func TestMediaWithThumbnails(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"film.mkv", "film.jpg", "show.mp4", "show-poster.png", "photo.jpg", "song.mp3", "song.jpg"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(name), 0666))
+	}
+	f, err := localBackend.NewFs(context.Background(), "thumbnails", dir, configmap.New())
+	require.NoError(t, err)
+	root, err := vfs.New(f, nil).Root()
+	require.NoError(t, err)
+	nodes, err := root.ReadDirAll()
+	require.NoError(t, err)
+
+	media, thumbnails := mediaWithThumbnails(nodes)
+
+	var names []string
+	for _, node := range media {
+		names = append(names, node.Name())
+	}
+	assert.Equal(t, []string{"film.mkv", "photo.jpg", "show.mp4", "song.jpg", "song.mp3"}, names)
+
+	thumbnailNames := map[string]string{}
+	for video, thumbnail := range thumbnails {
+		thumbnailNames[video.Name()] = thumbnail.Name()
+	}
+	assert.Equal(t, map[string]string{
+		"film.mkv": "film.jpg",
+		"show.mp4": "show-poster.png",
+	}, thumbnailNames)
+}
+
+func TestThumbnailer(t *testing.T) {
+	assert.Nil(t, newThumbnailer(nil, 0))
+
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 400, 200))))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "image.png"), buf.Bytes(), 0666))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.jpg"), []byte("not a jpeg"), 0666))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "video.mp4"), []byte("not a video"), 0666))
+	f, err := localBackend.NewFs(context.Background(), "thumbnails", dir, configmap.New())
+	require.NoError(t, err)
+	th := newThumbnailer(vfs.New(f, nil), 100)
+	assert.Equal(t, "JPEG_TN", th.profileName())
+
+	data, err := th.thumbnail("image.png")
+	require.NoError(t, err)
+	config, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, 100, config.Width)
+	assert.Equal(t, 50, config.Height)
+
+	// cached
+	again, err := th.thumbnail("image.png")
+	require.NoError(t, err)
+	assert.Equal(t, data, again)
+
+	for _, remote := range []string{"broken.jpg", "video.mp4", "notfound.jpg"} {
+		_, err = th.thumbnail(remote)
+		assert.Error(t, err, remote)
+	}
+
+	assert.Equal(t, "", newThumbnailer(nil, 320).profileName())
+}
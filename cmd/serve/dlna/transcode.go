@@ -0,0 +1,195 @@
+package dlna
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"strings"
+
+	dms_dlna "github.com/anacrolix/dms/dlna"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/vfs"
+)
+
+const (
+	transcodePath = "/x/"
+	maxTranscodes = 4 // most transcoders to run at once
+)
+
+// transcodeProfile describes an external command which converts
+// media into a format some devices can play
+type transcodeProfile struct {
+	Name        string   `json:"name"`         // name of the profile used in the URL
+	UserAgent   string   `json:"user_agent"`   // regexp matching the User-Agent of the devices to offer it to - all if empty
+	Input       string   `json:"input"`        // regexp matching the MIME types it can convert
+	Output      string   `json:"output"`       // MIME type it produces
+	DLNAProfile string   `json:"dlna_profile"` // DLNA.ORG_PN of the output if known
+	Prefer      bool     `json:"prefer"`       // if set offer it before the original
+	Command     []string `json:"command"`      // command and arguments to run
+
+	userAgent *regexp.Regexp
+	input     *regexp.Regexp
+}
+
+// placeholder in the command replaced with the URL of the original
+const urlPlaceholder = "{url}"
+
+// loadTranscodeProfiles reads the profiles from the JSON file at
+// configPath
+func loadTranscodeProfiles(configPath string) (profiles []*transcodeProfile, err error) {
+	if configPath == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transcode config: %w", err)
+	}
+	err = json.Unmarshal(data, &profiles)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse transcode config %q: %w", configPath, err)
+	}
+	seen := make(map[string]bool, len(profiles))
+	for i, p := range profiles {
+		if p == nil || p.Name == "" || strings.ContainsAny(p.Name, "/?#%") {
+			return nil, fmt.Errorf("transcode profile %d: needs a name without /?#%%", i+1)
+		}
+		if seen[p.Name] {
+			return nil, fmt.Errorf("transcode profile %q: duplicate name", p.Name)
+		}
+		seen[p.Name] = true
+		if p.Output == "" || len(p.Command) == 0 {
+			return nil, fmt.Errorf("transcode profile %q: needs output and command", p.Name)
+		}
+		if p.input, err = regexp.Compile(p.Input); err != nil {
+			return nil, fmt.Errorf("transcode profile %q: bad input: %w", p.Name, err)
+		}
+		if p.userAgent, err = regexp.Compile(p.UserAgent); err != nil {
+			return nil, fmt.Errorf("transcode profile %q: bad user_agent: %w", p.Name, err)
+		}
+	}
+	return profiles, nil
+}
+
+// matches returns true if the profile should be offered to userAgent
+// for media of mimeType
+func (p *transcodeProfile) matches(userAgent, mimeType string) bool {
+	return p.input.MatchString(mimeType) && p.userAgent.MatchString(userAgent)
+}
+
+// contentFeatures returns the DLNA content features of the output
+func (p *transcodeProfile) contentFeatures() string {
+	return dms_dlna.ContentFeatures{
+		ProfileName: p.DLNAProfile,
+		Transcoded:  true,
+	}.String()
+}
+
+// findTranscodeProfile returns the profile called name or nil
+func (s *server) findTranscodeProfile(name string) *transcodeProfile {
+	for _, p := range s.transcodeProfiles {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// localURL returns the URL the transcoder should read remotePath
+// from. It uses the address the server is listening on rather than
+// the Host header of the request as that is chosen by the client.
+func (s *server) localURL(remotePath string) string {
+	host, port, err := net.SplitHostPort(s.HTTPConn.Addr().String())
+	if err != nil {
+		host, port = "", ""
+	}
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		// listening on all addresses so use loopback
+		if ip != nil && ip.To4() == nil {
+			host = "::1"
+		} else {
+			host = "127.0.0.1"
+		}
+	}
+	return (&url.URL{
+		Scheme: "http",
+		Host:   net.JoinHostPort(host, port),
+		Path:   path.Join(resPath, remotePath),
+	}).String()
+}
+
+// Serves media transcoded by a profile at /x/<profile>/<path>
+func (s *server) transcodeHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	name, remotePath, _ := strings.Cut(r.URL.Path, "/")
+	p := s.findTranscodeProfile(name)
+	if p == nil {
+		http.NotFound(w, r)
+		return
+	}
+	node, err := s.vfs.Stat(remotePath)
+	if err != nil || !node.Mode().IsRegular() {
+		http.NotFound(w, r)
+		return
+	}
+	if !p.input.MatchString(nodeMimeType(node)) {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", p.Output)
+	w.Header().Set("contentFeatures.dlna.org", p.contentFeatures())
+	w.Header().Set("transferMode.dlna.org", "Streaming")
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	select {
+	case s.transcodeSem <- struct{}{}:
+		defer func() { <-s.transcodeSem }()
+	default:
+		fs.Errorf(node, "Transcoding with profile %q: too many transcodes running", p.Name)
+		http.Error(w, "Too many transcodes running", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Make the command, feeding it the original on stdin unless it
+	// reads it from the URL
+	args := make([]string, len(p.Command))
+	usesURL := false
+	originalURL := s.localURL(remotePath)
+	for i, arg := range p.Command {
+		if strings.Contains(arg, urlPlaceholder) {
+			usesURL = true
+			arg = strings.ReplaceAll(arg, urlPlaceholder, originalURL)
+		}
+		args[i] = arg
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	if !usesURL {
+		in, err := node.(*vfs.File).Open(os.O_RDONLY)
+		if err != nil {
+			serveError(ctx, node, w, "Could not open resource", err)
+			return
+		}
+		defer fs.CheckClose(in, &err)
+		cmd.Stdin = in
+	}
+	var stderr bytes.Buffer
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+
+	fs.Debugf(node, "Transcoding with profile %q: %q", p.Name, args)
+	err = cmd.Run()
+	if err != nil && ctx.Err() == nil && !errors.Is(err, io.ErrClosedPipe) {
+		fs.Errorf(node, "Transcoding with profile %q failed: %v: %s", p.Name, err, strings.TrimSpace(stderr.String()))
+	}
+}
@@ -0,0 +1,159 @@
+package dlna
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// write the transcode config to a temporary file returning its path
+func writeTranscodeConfig(t *testing.T, config string) string {
+	configPath := filepath.Join(t.TempDir(), "transcode.json")
+	require.NoError(t, os.WriteFile(configPath, []byte(config), 0666))
+	return configPath
+}
+
+func TestLoadTranscodeProfiles(t *testing.T) {
+	profiles, err := loadTranscodeProfiles("")
+	require.NoError(t, err)
+	assert.Nil(t, profiles)
+
+	profiles, err = loadTranscodeProfiles(writeTranscodeConfig(t, `[
+		{"name": "mp4", "user_agent": "Bravia", "input": "^video/", "output": "video/mp4", "prefer": true, "command": ["ffmpeg", "-i", "{url}", "-"]}
+	]`))
+	require.NoError(t, err)
+	require.Len(t, profiles, 1)
+	p := profiles[0]
+	assert.True(t, p.matches("SEC_HHP_Bravia/1.0", "video/x-matroska"))
+	assert.False(t, p.matches("SEC_HHP_Bravia/1.0", "audio/mpeg"))
+	assert.False(t, p.matches("VLC", "video/x-matroska"))
+	assert.Contains(t, p.contentFeatures(), "DLNA.ORG_CI=1")
+
+	for _, config := range []string{
+		`not json`,
+		`[{"input": "^video/", "output": "video/mp4", "command": ["cat"]}]`,
+		`[{"name": "a/b", "input": "^video/", "output": "video/mp4", "command": ["cat"]}]`,
+		`[{"name": "a", "input": "^video/", "command": ["cat"]}]`,
+		`[{"name": "a", "input": "^video/", "output": "video/mp4"}]`,
+		`[{"name": "a", "input": "(", "output": "video/mp4", "command": ["cat"]}]`,
+		`[{"name": "a", "user_agent": "(", "output": "video/mp4", "command": ["cat"]}]`,
+		`[{"name": "a", "output": "video/mp4", "command": ["cat"]}, {"name": "a", "output": "video/mp4", "command": ["cat"]}]`,
+	} {
+		_, err = loadTranscodeProfiles(writeTranscodeConfig(t, config))
+		assert.Error(t, err, config)
+	}
+	_, err = loadTranscodeProfiles(filepath.Join(t.TempDir(), "notfound.json"))
+	assert.Error(t, err)
+}
+
+func TestTranscode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs cat")
+	}
+	ctx := context.Background()
+	f, err := fs.NewFs(ctx, "testdata/files")
+	require.NoError(t, err)
+	opt := Opt
+	opt.ListenAddr = testBindAddress
+	opt.TranscodeConfig = writeTranscodeConfig(t, `[
+		{"name": "copy", "user_agent": "Bravia", "input": "^video/", "output": "video/mpeg", "prefer": true, "command": ["cat"]},
+		{"name": "url", "input": "^video/", "output": "text/plain", "command": ["echo", "{url}"]}
+	]`)
+	s, err := newServer(ctx, f, &opt, &vfscommon.Opt)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, s.HTTPConn.Close())
+	}()
+
+	serve := func(req *http.Request) *http.Response {
+		w := httptest.NewRecorder()
+		s.handler.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	// The transcoded version is offered first to matching devices only
+	browse := func(userAgent string) string {
+		req := httptest.NewRequest("POST", serviceControlURL, strings.NewReader(`
+<?xml version="1.0" encoding="utf-8"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"
+            s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">
+    <s:Body>
+        <u:Browse xmlns:u="urn:schemas-upnp-org:service:ContentDirectory:1">
+            <ObjectID>%2Fsubdir</ObjectID>
+            <BrowseFlag>BrowseDirectChildren</BrowseFlag>
+            <Filter>*</Filter>
+            <StartingIndex>0</StartingIndex>
+            <RequestedCount>0</RequestedCount>
+            <SortCriteria></SortCriteria>
+        </u:Browse>
+    </s:Body>
+</s:Envelope>`))
+		req.Header.Set("SOAPACTION", `"urn:schemas-upnp-org:service:ContentDirectory:1#Browse"`)
+		req.Header.Set("User-Agent", userAgent)
+		resp := serve(req)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+	body := browse("Bravia TV")
+	transcoded := strings.Index(body, "/x/copy/subdir/video.mp4")
+	original := strings.Index(body, "/r/subdir/video.mp4")
+	require.NotEqual(t, -1, transcoded)
+	require.NotEqual(t, -1, original)
+	assert.Less(t, transcoded, original)
+	assert.Contains(t, body, "video/mpeg")
+	assert.NotContains(t, browse("VLC"), "/x/copy/")
+
+	// The command output is served
+	resp := serve(httptest.NewRequest("GET", transcodePath+"copy/subdir/video.mp4", nil))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "video/mpeg", resp.Header.Get("Content-Type"))
+	assert.Contains(t, resp.Header.Get("contentFeatures.dlna.org"), "DLNA.ORG_CI=1")
+	got, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	want, err := os.ReadFile("testdata/files/subdir/video.mp4")
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	// The URL of the original is on the server, not the Host the
+	// client asked for
+	req := httptest.NewRequest("GET", transcodePath+"url/subdir/video.mp4", nil)
+	req.Host = "attacker.example.com"
+	resp = serve(req)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	got, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	_, port, err := net.SplitHostPort(s.HTTPConn.Addr().String())
+	require.NoError(t, err)
+	assert.Equal(t, "http://127.0.0.1:"+port+"/r/subdir/video.mp4\n", string(got))
+
+	// Only maxTranscodes run at once
+	for range maxTranscodes {
+		s.transcodeSem <- struct{}{}
+	}
+	resp = serve(httptest.NewRequest("GET", transcodePath+"copy/subdir/video.mp4", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	for range maxTranscodes {
+		<-s.transcodeSem
+	}
+
+	// Unknown profiles, files and media types the profile doesn't
+	// take aren't found
+	for _, urlPath := range []string{"notfound/subdir/video.mp4", "copy/subdir/notfound.mp4", "copy/subdir/video.srt"} {
+		resp = serve(httptest.NewRequest("GET", transcodePath+urlPath, nil))
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, urlPath)
+	}
+}
@@ -39,18 +39,24 @@ type Item struct {
 
 // Object description
 type Object struct {
-	ID          string    `xml:"id,attr"`
-	ParentID    string    `xml:"parentID,attr"`
-	Restricted  int       `xml:"restricted,attr"` // indicates whether the object is modifiable
-	Class       string    `xml:"upnp:class"`
-	Icon        string    `xml:"upnp:icon,omitempty"`
-	Title       string    `xml:"dc:title"`
-	Date        Timestamp `xml:"dc:date"`
-	Artist      string    `xml:"upnp:artist,omitempty"`
-	Album       string    `xml:"upnp:album,omitempty"`
-	Genre       string    `xml:"upnp:genre,omitempty"`
-	AlbumArtURI string    `xml:"upnp:albumArtURI,omitempty"`
-	Searchable  int       `xml:"searchable,attr"`
+	ID          string       `xml:"id,attr"`
+	ParentID    string       `xml:"parentID,attr"`
+	Restricted  int          `xml:"restricted,attr"` // indicates whether the object is modifiable
+	Class       string       `xml:"upnp:class"`
+	Icon        string       `xml:"upnp:icon,omitempty"`
+	Title       string       `xml:"dc:title"`
+	Date        Timestamp    `xml:"dc:date"`
+	Artist      string       `xml:"upnp:artist,omitempty"`
+	Album       string       `xml:"upnp:album,omitempty"`
+	Genre       string       `xml:"upnp:genre,omitempty"`
+	AlbumArtURI *AlbumArtURI `xml:"upnp:albumArtURI,omitempty"`
+	Searchable  int          `xml:"searchable,attr"`
+}
+
+// AlbumArtURI is the URI of a thumbnail of the object
+type AlbumArtURI struct {
+	ProfileID string `xml:"dlna:profileID,attr,omitempty"`
+	URI       string `xml:",chardata"`
 }
 
 // Timestamp wraps time.Time for formatting purposes
@@ -200,6 +200,7 @@ func newServer(ctx context.Context, f fs.Fs, opt *Options, vfsOpt *vfscommon.Opt
 	}
 	if proxy.Opt.AuthProxy != "" {
 		d.proxy = proxy.New(ctx, proxyOpt, vfsOpt)
+		d.proxy.EnforcesACL = true
 		d.userPass = make(map[string]string, 16)
 	} else {
 		d.globalVFS = vfs.New(f, vfsOpt)
@@ -373,6 +374,10 @@ func (d *driver) Stat(sctx *ftp.Context, path string) (fi iofs.FileInfo, err err
 	if err != nil {
 		return nil, err
 	}
+	err = VFS.CheckAccess(path, 0)
+	if err != nil {
+		return nil, err
+	}
 	n, err := VFS.Stat(path)
 	if err != nil {
 		return nil, err
@@ -387,6 +392,10 @@ func (d *driver) ChangeDir(sctx *ftp.Context, path string) (err error) {
 	if err != nil {
 		return err
 	}
+	err = VFS.CheckAccess(path, 0)
+	if err != nil {
+		return err
+	}
 	n, err := VFS.Stat(path)
 	if err != nil {
 		return err
@@ -404,6 +413,12 @@ func (d *driver) ListDir(sctx *ftp.Context, path string, callback func(iofs.File
 	if err != nil {
 		return err
 	}
+	err = VFS.CheckAccess(path, vfscommon.PermList)
+	if err == vfs.ENOENT {
+		return errors.New("directory not found")
+	} else if err != nil {
+		return err
+	}
 	node, err := VFS.Stat(path)
 	if err == vfs.ENOENT {
 		return errors.New("directory not found")
@@ -427,6 +442,10 @@ func (d *driver) ListDir(sctx *ftp.Context, path string, callback func(iofs.File
 	}()
 
 	for _, file := range dirEntries {
+		// Only show the items the ACL lets the user see
+		if !VFS.Visible(file.Path()) {
+			continue
+		}
 		err = callback(&FileInfo{file, file.Mode(), VFS.Opt.UID, VFS.Opt.GID})
 		if err != nil {
 			return err
@@ -442,6 +461,10 @@ func (d *driver) DeleteDir(sctx *ftp.Context, path string) (err error) {
 	if err != nil {
 		return err
 	}
+	err = VFS.CheckAccess(path, vfscommon.PermDelete)
+	if err != nil {
+		return err
+	}
 	node, err := VFS.Stat(path)
 	if err != nil {
 		return err
@@ -463,6 +486,10 @@ func (d *driver) DeleteFile(sctx *ftp.Context, path string) (err error) {
 	if err != nil {
 		return err
 	}
+	err = VFS.CheckAccess(path, vfscommon.PermDelete)
+	if err != nil {
+		return err
+	}
 	node, err := VFS.Stat(path)
 	if err != nil {
 		return err
@@ -484,6 +511,14 @@ func (d *driver) Rename(sctx *ftp.Context, oldName, newName string) (err error)
 	if err != nil {
 		return err
 	}
+	err = VFS.CheckAccess(oldName, vfscommon.PermDelete)
+	if err != nil {
+		return err
+	}
+	err = VFS.CheckAccess(newName, vfscommon.PermWrite)
+	if err != nil {
+		return err
+	}
 	return VFS.Rename(oldName, newName)
 }
 
@@ -494,6 +529,10 @@ func (d *driver) MakeDir(sctx *ftp.Context, path string) (err error) {
 	if err != nil {
 		return err
 	}
+	err = VFS.CheckAccess(path, vfscommon.PermWrite)
+	if err != nil {
+		return err
+	}
 	dir, leaf, err := VFS.StatParent(path)
 	if err != nil {
 		return err
@@ -509,6 +548,13 @@ func (d *driver) GetFile(sctx *ftp.Context, path string, offset int64) (size int
 	if err != nil {
 		return 0, nil, err
 	}
+	err = VFS.CheckAccess(path, vfscommon.PermRead)
+	if err == vfs.ENOENT {
+		fs.Infof(path, "File not found")
+		return 0, nil, errors.New("file not found")
+	} else if err != nil {
+		return 0, nil, err
+	}
 	node, err := VFS.Stat(path)
 	if err == vfs.ENOENT {
 		fs.Infof(path, "File not found")
@@ -545,6 +591,10 @@ func (d *driver) PutFile(sctx *ftp.Context, path string, data io.Reader, offset
 	if err != nil {
 		return 0, err
 	}
+	err = VFS.CheckAccess(path, vfscommon.PermWrite)
+	if err != nil {
+		return 0, err
+	}
 	fi, err := VFS.Stat(path)
 	if err == nil {
 		isExist = true
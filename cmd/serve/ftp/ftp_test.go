@@ -11,6 +11,7 @@ import (
 	"context"
 	"testing"
 
+	_ "github.com/rclone/rclone/backend/ftp"
 	_ "github.com/rclone/rclone/backend/local"
 	"github.com/rclone/rclone/cmd/serve/proxy"
 	"github.com/rclone/rclone/cmd/serve/servetest"
@@ -34,8 +35,17 @@ const (
 // TestFTP runs the ftp server then runs the unit tests for the
 // ftp remote against it.
 func TestFTP(t *testing.T) {
-	// Configure and start the server
-	start := func(f fs.Fs) (configmap.Simple, func()) {
+	servetest.Run(t, "ftp", start(t))
+}
+
+// TestACL checks the rules returned by the auth proxy are enforced
+func TestACL(t *testing.T) {
+	servetest.TestACL(t, "ftp", start(t))
+}
+
+// start returns a function to configure and start the server
+func start(t *testing.T) servetest.StartFn {
+	return func(f fs.Fs) (configmap.Simple, func()) {
 		opt := Opt
 		opt.ListenAddr = testHOST + ":" + testPORT
 		opt.PassivePorts = testPASSIVEPORTRANGE
@@ -66,8 +76,6 @@ func TestFTP(t *testing.T) {
 			<-quit
 		}
 	}
-
-	servetest.Run(t, "ftp", start)
 }
 
 func TestRc(t *testing.T) {
@@ -17,6 +17,7 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/rclone/rclone/cmd"
 	cmdserve "github.com/rclone/rclone/cmd/serve"
+	"github.com/rclone/rclone/cmd/serve/archive"
 	"github.com/rclone/rclone/cmd/serve/proxy"
 	"github.com/rclone/rclone/cmd/serve/proxy/proxyflags"
 	"github.com/rclone/rclone/fs"
@@ -34,16 +35,23 @@ import (
 )
 
 // OptionsInfo describes the Options in use
-var OptionsInfo = fs.Options{}.
+var OptionsInfo = fs.Options{{
+	Name:    "read_write",
+	Default: false,
+	Help:    "Allow uploading, deleting and renaming files",
+}}.
 	Add(libhttp.ConfigInfo).
 	Add(libhttp.AuthConfigInfo).
-	Add(libhttp.TemplateConfigInfo)
+	Add(libhttp.TemplateConfigInfo).
+	Add(archive.OptionsInfo)
 
 // Options required for http server
 type Options struct {
-	Auth     libhttp.AuthConfig
-	HTTP     libhttp.Config
-	Template libhttp.TemplateConfig
+	ReadWrite bool `config:"read_write"`
+	Auth      libhttp.AuthConfig
+	HTTP      libhttp.Config
+	Template  libhttp.TemplateConfig
+	Archive   archive.Options
 }
 
 // DefaultOpt is the default values used for Options
@@ -51,6 +59,7 @@ var DefaultOpt = Options{
 	Auth:     libhttp.DefaultAuthCfg(),
 	HTTP:     libhttp.DefaultCfg(),
 	Template: libhttp.DefaultTemplateCfg(),
+	Archive:  archive.DefaultOpt,
 }
 
 // Opt is options set by command line flags
@@ -110,7 +119,32 @@ The server will log errors.  Use ` + "`-v`" + ` to see access logs.
 ` + "`--bwlimit`" + ` will be respected for file transfers.  Use ` + "`--stats`" + ` to
 control the stats printing.
 
-` + libhttp.Help(flagPrefix) + libhttp.TemplateHelp(flagPrefix) + libhttp.AuthHelp(flagPrefix) + vfs.Help() + proxy.Help,
+### Uploading, deleting and renaming
+
+` + "`serve http`" + ` is read only unless ` + "`--read-write`" + ` is set. It then
+also accepts these requests.
+
+- ` + "`PUT`" + ` uploads the body of the request to the file in the URL,
+  making any directories needed. A URL ending in ` + "`/`" + ` makes a directory.
+- ` + "`POST`" + ` of a ` + "`multipart/form-data`" + ` upload to a directory
+  uploads each file in the form to that directory. Forms posted from
+  pages on other sites are refused unless the site is the one set with
+  ` + "`--allow-origin`" + `.
+- ` + "`DELETE`" + ` deletes the file, or the directory and everything in it,
+  in the URL.
+- ` + "`MOVE`" + ` renames the file or directory in the URL to the path in
+  the ` + "`Destination`" + ` header, like WebDAV.
+
+Uploads are streamed to the remote through the VFS so use
+` + "`--vfs-cache-mode writes`" + ` if the remote can't stream uploads. The
+default template shows an upload form and links to rename and delete
+files.
+
+These requests use the same authentication as downloads so set
+` + "`--user`" + ` and ` + "`--pass`" + `, ` + "`--htpasswd`" + ` or ` + "`--auth-proxy`" + ` to
+control who can change the files.
+
+` + libhttp.Help(flagPrefix) + libhttp.TemplateHelp(flagPrefix) + archive.Help + libhttp.AuthHelp(flagPrefix) + vfs.Help() + proxy.Help,
 	Annotations: map[string]string{
 		"versionIntroduced": "v1.39",
 		"groups":            "Filter",
@@ -171,6 +205,9 @@ func (s *HTTP) auth(user, pass string) (value any, err error) {
 }
 
 func newServer(ctx context.Context, f fs.Fs, opt *Options, vfsOpt *vfscommon.Options, proxyOpt *proxy.Options) (s *HTTP, err error) {
+	if err := vfscommon.RefuseACL(vfsOpt); err != nil {
+		return nil, err
+	}
 	s = &HTTP{
 		f:   f,
 		ctx: ctx,
@@ -201,6 +238,12 @@ func newServer(ctx context.Context, f fs.Fs, opt *Options, vfsOpt *vfscommon.Opt
 	)
 	router.Get("/*", s.handler)
 	router.Head("/*", s.handler)
+	if s.opt.ReadWrite {
+		router.Put("/*", s.handlePut)
+		router.Post("/*", s.handlePost)
+		router.Delete("/*", s.handleDelete)
+		router.MethodFunc("MOVE", "/*", s.handleMove)
+	}
 
 	return s, nil
 }
@@ -256,6 +299,10 @@ func (s *HTTP) serveDir(w http.ResponseWriter, r *http.Request, dirRemote string
 		return
 	}
 	dir := node.(*vfs.Dir)
+	if archive.Requested(r) {
+		archive.Serve(w, r, &s.opt.Archive, dir)
+		return
+	}
 	dirEntries, err := dir.ReadDirAll()
 	if err != nil {
 		serve.Error(ctx, dirRemote, w, "Failed to list directory", err)
@@ -264,6 +311,8 @@ func (s *HTTP) serveDir(w http.ResponseWriter, r *http.Request, dirRemote string
 
 	// Make the entries for display
 	directory := serve.NewDirectory(dirRemote, s.server.HTMLTemplate())
+	directory.ReadWrite = s.opt.ReadWrite && !VFS.Opt.ReadOnly
+	directory.Archive = true
 	for _, node := range dirEntries {
 		if vfscommon.Opt.NoModTime {
 			directory.AddHTMLEntry(node.Path(), node.IsDir(), node.Size(), time.Time{})
@@ -1,9 +1,11 @@
 package http
 
 import (
+	"bytes"
 	"context"
 	"flag"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -34,9 +36,10 @@ const (
 	testTemplate    = "testdata/golden/testindex.html"
 )
 
-func start(ctx context.Context, t *testing.T, f fs.Fs) (s *HTTP, testURL string) {
+func start(ctx context.Context, t *testing.T, f fs.Fs, readWrite bool) (s *HTTP, testURL string) {
 	opts := Options{
-		HTTP: libhttp.DefaultCfg(),
+		ReadWrite: readWrite,
+		HTTP:      libhttp.DefaultCfg(),
 		Template: libhttp.TemplateConfig{
 			Path: testTemplate,
 		},
@@ -134,7 +137,7 @@ func testGET(t *testing.T, useProxy bool) {
 		require.NoError(t, obj.SetModTime(context.Background(), expectedTime))
 	}
 
-	s, testURL := start(ctx, t, f)
+	s, testURL := start(ctx, t, f, false)
 	defer func() {
 		assert.NoError(t, s.server.Shutdown())
 	}()
@@ -274,6 +277,135 @@ func TestAuthProxy(t *testing.T) {
 	testGET(t, true)
 }
 
+func TestReadWrite(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	f, err := fs.NewFs(ctx, dir)
+	require.NoError(t, err)
+
+	s, testURL := start(ctx, t, f, true)
+	defer func() {
+		assert.NoError(t, s.server.Shutdown())
+	}()
+
+	do := func(method, URL string, body io.Reader, header map[string]string) (int, string) {
+		req, err := http.NewRequest(method, testURL+URL, body)
+		require.NoError(t, err)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		req.SetBasicAuth(testUser, testPass)
+		client := &http.Client{
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer func() { _ = resp.Body.Close() }()
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(data)
+	}
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(dir, name))
+		return err == nil
+	}
+
+	// PUT a file making the directory and read it back
+	status, _ := do("PUT", "dir/file.txt", strings.NewReader("hello"), nil)
+	assert.Equal(t, http.StatusCreated, status)
+	status, body := do("GET", "dir/file.txt", nil, nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "hello", body)
+
+	// PUT a directory
+	status, _ = do("PUT", "empty/", nil, nil)
+	assert.Equal(t, http.StatusCreated, status)
+	assert.True(t, exists("empty"))
+
+	// POST a form with two files
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		w, err := mw.CreateFormFile("file", name)
+		require.NoError(t, err)
+		_, err = io.WriteString(w, "contents of "+name)
+		require.NoError(t, err)
+	}
+	require.NoError(t, mw.Close())
+	status, _ = do("POST", "dir/", bytes.NewReader(form.Bytes()), map[string]string{"Content-Type": mw.FormDataContentType()})
+	assert.Equal(t, http.StatusSeeOther, status)
+	data, err := os.ReadFile(filepath.Join(dir, "dir", "b.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "contents of b.txt", string(data))
+	status, _ = do("POST", "dir/", strings.NewReader("potato"), nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	// POSTs from pages on other sites are refused
+	formHeader := func(extra ...string) map[string]string {
+		header := map[string]string{"Content-Type": mw.FormDataContentType()}
+		for i := 0; i < len(extra); i += 2 {
+			header[extra[i]] = extra[i+1]
+		}
+		return header
+	}
+	status, _ = do("POST", "dir/", bytes.NewReader(form.Bytes()), formHeader("Sec-Fetch-Site", "cross-site"))
+	assert.Equal(t, http.StatusForbidden, status)
+	status, _ = do("POST", "dir/", bytes.NewReader(form.Bytes()), formHeader("Origin", "http://evil.example.com"))
+	assert.Equal(t, http.StatusForbidden, status)
+	status, _ = do("POST", "dir/", bytes.NewReader(form.Bytes()), formHeader("Sec-Fetch-Site", "same-origin", "Origin", strings.TrimSuffix(testURL, "/")))
+	assert.Equal(t, http.StatusSeeOther, status)
+
+	// A failed upload removes a new file but not one which existed.
+	// The writer isn't closed so the form ends part way through the file.
+	for _, test := range []struct {
+		name   string
+		exists bool
+	}{
+		{name: "a.txt", exists: true},
+		{name: "c.txt", exists: false},
+	} {
+		var badForm bytes.Buffer
+		mw := multipart.NewWriter(&badForm)
+		w, err := mw.CreateFormFile("file", test.name)
+		require.NoError(t, err)
+		_, err = io.WriteString(w, "new contents")
+		require.NoError(t, err)
+		status, _ = do("POST", "dir/", bytes.NewReader(badForm.Bytes()), map[string]string{"Content-Type": mw.FormDataContentType()})
+		assert.Equal(t, http.StatusInternalServerError, status)
+		assert.Equal(t, test.exists, exists("dir/"+test.name), test.name)
+	}
+
+	// MOVE a file to a new directory
+	status, _ = do("MOVE", "dir/file.txt", nil, map[string]string{"Destination": testURL + "moved/file2.txt"})
+	assert.Equal(t, http.StatusCreated, status)
+	assert.False(t, exists("dir/file.txt"))
+	assert.True(t, exists("moved/file2.txt"))
+	status, _ = do("MOVE", "dir/notfound.txt", nil, map[string]string{"Destination": testURL + "x.txt"})
+	assert.Equal(t, http.StatusNotFound, status)
+
+	// DELETE a file and a directory with files in
+	status, _ = do("DELETE", "moved/file2.txt", nil, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	assert.False(t, exists("moved/file2.txt"))
+	status, _ = do("DELETE", "dir/", nil, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	assert.False(t, exists("dir"))
+	status, _ = do("DELETE", "", nil, nil)
+	assert.Equal(t, http.StatusForbidden, status)
+}
+
+func TestRefuseACL(t *testing.T) {
+	ctx := context.Background()
+	f, err := fs.NewFs(ctx, t.TempDir())
+	require.NoError(t, err)
+	vfsOpt := vfscommon.Opt
+	vfsOpt.ACL = "/=rl"
+	_, err = newServer(ctx, f, &Options{}, &vfsOpt, &proxy.Opt)
+	assert.Equal(t, vfscommon.ErrACLNotEnforced, err)
+}
+
 func TestRc(t *testing.T) {
 	servetest.TestRc(t, rc.Params{
 		"type":           "http",
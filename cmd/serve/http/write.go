@@ -0,0 +1,268 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/http/serve"
+	"github.com/rclone/rclone/vfs"
+)
+
+func init() {
+	// So MOVE requests can be routed
+	chi.RegisterMethod("MOVE")
+}
+
+// writeError writes an error response for err which was returned
+// by the VFS
+func writeError(ctx context.Context, w http.ResponseWriter, remote string, text string, err error) {
+	switch {
+	case errors.Is(err, vfs.ENOENT):
+		http.Error(w, "File not found", http.StatusNotFound)
+	case errors.Is(err, vfs.EEXIST), errors.Is(err, vfs.ENOTEMPTY):
+		http.Error(w, text+": "+err.Error(), http.StatusConflict)
+	case errors.Is(err, vfs.EROFS), errors.Is(err, vfs.EPERM):
+		http.Error(w, text+": "+err.Error(), http.StatusForbidden)
+	case errors.Is(err, vfs.ENOSPC):
+		http.Error(w, text+": "+err.Error(), http.StatusInsufficientStorage)
+	default:
+		serve.Error(ctx, remote, w, text, err)
+	}
+}
+
+// writeFile streams in to remote in the VFS making any directories
+// needed. If the upload fails it removes the file, unless it existed
+// before.
+func writeFile(VFS *vfs.VFS, remote string, in io.Reader) (err error) {
+	if dir := path.Dir(remote); dir != "." {
+		if err := VFS.MkdirAll(dir, 0777); err != nil {
+			return err
+		}
+	}
+	_, err = VFS.Stat(remote)
+	created := errors.Is(err, vfs.ENOENT)
+	fh, err := VFS.OpenFile(remote, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fh, in)
+	closeErr := fh.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil && created {
+		if removeErr := VFS.Remove(remote); removeErr != nil && !errors.Is(removeErr, vfs.ENOENT) {
+			fs.Errorf(remote, "Failed to remove failed upload: %v", removeErr)
+		}
+	}
+	return err
+}
+
+// sameOrigin returns true if r didn't come from a page on another
+// site, so a form there can't be used to upload files with the
+// user's credentials.
+//
+// Requests without the Sec-Fetch-Site or Origin headers, which
+// browsers always send with a POST, are from other clients so are
+// allowed.
+func sameOrigin(r *http.Request, allowOrigin string) bool {
+	origin := r.Header.Get("Origin")
+	if allowOrigin != "" && allowOrigin != "*" && origin == allowOrigin {
+		return true
+	}
+	if site := r.Header.Get("Sec-Fetch-Site"); site != "" {
+		return site == "same-origin" || site == "none"
+	}
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+// handlePut uploads the body of the request to the file at the URL,
+// or makes the directory if the URL ends in /
+func (s *HTTP) handlePut(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	remote := strings.Trim(r.URL.Path, "/")
+	VFS, err := s.getVFS(ctx)
+	if err != nil {
+		http.Error(w, "Root directory not found", http.StatusNotFound)
+		fs.Errorf(nil, "Failed to upload: %v", err)
+		return
+	}
+	if remote == "" {
+		http.Error(w, "Can't upload to the root", http.StatusMethodNotAllowed)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/") {
+		err = VFS.MkdirAll(remote, 0777)
+		if err != nil {
+			writeError(ctx, w, remote, "Failed to make directory", err)
+			return
+		}
+		fs.Infof(remote, "%s: Made directory", r.RemoteAddr)
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	err = writeFile(VFS, remote, r.Body)
+	if err != nil {
+		writeError(ctx, w, remote, "Failed to upload file", err)
+		return
+	}
+	fs.Infof(remote, "%s: Uploaded file", r.RemoteAddr)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// handlePost uploads the files in a multipart/form-data POST to the
+// directory at the URL then redirects back to the directory listing
+func (s *HTTP) handlePost(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	dirRemote := strings.Trim(r.URL.Path, "/")
+	VFS, err := s.getVFS(ctx)
+	if err != nil {
+		http.Error(w, "Root directory not found", http.StatusNotFound)
+		fs.Errorf(nil, "Failed to upload: %v", err)
+		return
+	}
+	if !sameOrigin(r, s.opt.HTTP.AllowOrigin) {
+		http.Error(w, "Cross-origin upload refused", http.StatusForbidden)
+		return
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" || !strings.HasSuffix(r.URL.Path, "/") {
+		http.Error(w, "POST a multipart/form-data upload to a directory", http.StatusBadRequest)
+		return
+	}
+	node, err := VFS.Stat(dirRemote)
+	if err != nil {
+		writeError(ctx, w, dirRemote, "Failed to find directory", err)
+		return
+	}
+	if !node.IsDir() {
+		http.Error(w, "Not a directory", http.StatusNotFound)
+		return
+	}
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "Bad multipart upload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			http.Error(w, "Bad multipart upload: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		// Ignore form fields which aren't files
+		fileName := part.FileName()
+		if fileName == "" {
+			continue
+		}
+		leaf := path.Base(fileName)
+		if leaf == "." || leaf == ".." || leaf == "/" {
+			http.Error(w, fmt.Sprintf("Bad file name %q", fileName), http.StatusBadRequest)
+			return
+		}
+		remote := path.Join(dirRemote, leaf)
+		err = writeFile(VFS, remote, part)
+		if err != nil {
+			writeError(ctx, w, remote, "Failed to upload file", err)
+			return
+		}
+		fs.Infof(remote, "%s: Uploaded file", r.RemoteAddr)
+	}
+	// Relative so it works with --baseurl
+	w.Header().Set("Location", "./")
+	w.WriteHeader(http.StatusSeeOther)
+}
+
+// handleDelete deletes the file or the directory and everything in
+// it at the URL
+func (s *HTTP) handleDelete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	remote := strings.Trim(r.URL.Path, "/")
+	VFS, err := s.getVFS(ctx)
+	if err != nil {
+		http.Error(w, "Root directory not found", http.StatusNotFound)
+		fs.Errorf(nil, "Failed to delete: %v", err)
+		return
+	}
+	if remote == "" {
+		http.Error(w, "Can't delete the root", http.StatusForbidden)
+		return
+	}
+	node, err := VFS.Stat(remote)
+	if err != nil {
+		writeError(ctx, w, remote, "Failed to find file", err)
+		return
+	}
+	if dir, ok := node.(*vfs.Dir); ok {
+		err = dir.RemoveAll()
+	} else {
+		err = node.Remove()
+	}
+	if err != nil {
+		writeError(ctx, w, remote, "Failed to delete", err)
+		return
+	}
+	fs.Infof(remote, "%s: Deleted", r.RemoteAddr)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleMove renames the file or directory at the URL to the one
+// in the Destination header like WebDAV does
+func (s *HTTP) handleMove(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	remote := strings.Trim(r.URL.Path, "/")
+	VFS, err := s.getVFS(ctx)
+	if err != nil {
+		http.Error(w, "Root directory not found", http.StatusNotFound)
+		fs.Errorf(nil, "Failed to move: %v", err)
+		return
+	}
+	destination, err := url.Parse(r.Header.Get("Destination"))
+	if err != nil || destination.Path == "" {
+		http.Error(w, "Bad or missing Destination header", http.StatusBadRequest)
+		return
+	}
+	dest := destination.Path
+	if baseURL := "/" + strings.Trim(s.opt.HTTP.BaseURL, "/"); baseURL != "/" {
+		var found bool
+		dest, found = strings.CutPrefix(dest, baseURL)
+		if !found {
+			http.Error(w, "Destination is outside the server", http.StatusBadGateway)
+			return
+		}
+	}
+	dest = strings.Trim(dest, "/")
+	if remote == "" || dest == "" {
+		http.Error(w, "Can't move the root", http.StatusForbidden)
+		return
+	}
+	if dir := path.Dir(dest); dir != "." {
+		if err := VFS.MkdirAll(dir, 0777); err != nil {
+			writeError(ctx, w, dest, "Failed to make directory", err)
+			return
+		}
+	}
+	err = VFS.Rename(remote, dest)
+	if err != nil {
+		writeError(ctx, w, remote, "Failed to move", err)
+		return
+	}
+	fs.Infof(remote, "%s: Moved to %q", r.RemoteAddr, dest)
+	w.WriteHeader(http.StatusCreated)
+}
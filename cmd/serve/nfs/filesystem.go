@@ -63,6 +63,9 @@ func (f *FS) ReadDir(path string) (dir []os.FileInfo, err error) {
 // Create implements creating new files
 func (f *FS) Create(filename string) (node billy.File, err error) {
 	defer log.Trace(filename, "")("%v, err=%v", &node, &err)
+	if err = f.vfs.Locks().CheckWrite(filename); err != nil {
+		return nil, err
+	}
 	return f.vfs.Create(filename)
 }
 
@@ -75,6 +78,12 @@ func (f *FS) Open(filename string) (node billy.File, err error) {
 // OpenFile opens a file
 func (f *FS) OpenFile(filename string, flag int, perm os.FileMode) (node billy.File, err error) {
 	defer log.Trace(filename, "flag=0x%X, perm=%v", flag, perm)("%v, err=%v", &node, &err)
+	// NFSv3 locking isn't supported so don't write files locked by others
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC) != 0 {
+		if err = f.vfs.Locks().CheckWrite(filename); err != nil {
+			return nil, err
+		}
+	}
 	return f.vfs.OpenFile(filename, flag, perm)
 }
 
@@ -92,12 +101,21 @@ func (f *FS) Stat(filename string) (fi os.FileInfo, err error) {
 // Rename renames a file
 func (f *FS) Rename(oldpath, newpath string) (err error) {
 	defer log.Trace(oldpath, "newpath=%q", newpath)("err=%v", &err)
+	if err = f.vfs.Locks().CheckWrite(oldpath); err != nil {
+		return err
+	}
+	if err = f.vfs.Locks().CheckWrite(newpath); err != nil {
+		return err
+	}
 	return f.vfs.Rename(oldpath, newpath)
 }
 
 // Remove deletes a file
 func (f *FS) Remove(filename string) (err error) {
 	defer log.Trace(filename, "")("err=%v", &err)
+	if err = f.vfs.Locks().CheckWrite(filename); err != nil {
+		return err
+	}
 	return f.vfs.Remove(filename)
 }
 
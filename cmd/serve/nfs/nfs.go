@@ -1,6 +1,7 @@
 //go:build unix
 
-// Package nfs implements a server to serve a VFS remote over the NFSv3 protocol
+// Package nfs implements a server to serve a VFS remote over the NFSv3
+// and NFSv4 protocols
 //
 // There is no authentication available on this server and it is
 // served on the loopback interface by default.
@@ -43,6 +44,10 @@ var OptionsInfo = fs.Options{{
 	Name:    "nfs_cache_dir",
 	Default: "",
 	Help:    "The directory the NFS handle cache will use if set",
+}, {
+	Name:    "nfs_v4",
+	Default: false,
+	Help:    "Serve NFSv4.0 and NFSv4.1 as well as NFSv3",
 }}
 
 func init() {
@@ -73,6 +78,7 @@ type Options struct {
 	HandleLimit    int         `config:"nfs_cache_handle_limit"` // max file handles cached by go-nfs CachingHandler
 	HandleCache    handleCache `config:"nfs_cache_type"`         // what kind of handle cache to use
 	HandleCacheDir string      `config:"nfs_cache_dir"`          // where the handle cache should be stored
+	NFSv4          bool        `config:"nfs_v4"`                 // serve NFSv4 too
 }
 
 // Opt is the default set of serve nfs options
@@ -126,7 +132,8 @@ var Command = &cobra.Command{
 	Short: `Serve the remote as an NFS mount`,
 	Long: strings.ReplaceAll(`Create an NFS server that serves the given remote over the network.
 	
-This implements an NFSv3 server to serve any rclone remote via NFS.
+This implements an NFSv3 server (and an NFSv4 server with |--nfs-v4|)
+to serve any rclone remote via NFS.
 
 The primary purpose for this command is to enable the [mount
 command](/commands/rclone_mount/) on recent macOS versions where
@@ -190,6 +197,34 @@ Where |$PORT| is the same port number used in the |serve nfs| command
 and |$HOSTNAME| is the network address of the machine that |serve nfs|
 was run on.
 
+### NFSv4
+
+Use |--nfs-v4| to serve NFSv4.0 and NFSv4.1 as well as NFSv3 on the
+same port. NFSv4 doesn't need the separate mount protocol so Linux
+clients can mount the server with
+
+    mount -t nfs -o vers=4,port=$PORT $HOSTNAME:/ path/to/mountpoint
+
+Use |vers=4.1| or |vers=4.0| to choose the minor version. NFSv4.2 isn't
+supported so |vers=4| negotiates NFSv4.1.
+
+NFSv4 is a stateful protocol. Rclone keeps track of the files the
+clients have open and the byte range locks they hold (as taken with
+|fcntl| or |flock| on the client) in memory. If rclone is restarted
+this state is lost and the clients will get errors for the files they
+had open. Locks are advisory - they stop other NFSv4 clients taking
+conflicting locks but don't stop reads and writes.
+
+Delegations are never granted so clients don't need a callback
+channel to the server, and pNFS isn't supported. Only |sec=sys| (or
+no) authentication is accepted but, as with NFSv3, the user and group
+the client sends are ignored and the files are owned by |--uid| and
+|--gid|.
+
+The file handles are the same as the NFSv3 ones so use a
+|--nfs-cache-type| of |disk| or |symlink| if you want clients to
+survive rclone being restarted.
+
 If |--vfs-metadata-extension| is in use then for the |--nfs-cache-type disk|
 and |--nfs-cache-type cache| the metadata files will have the file
 handle of their parent file suffixed with |0x00, 0x00, 0x00, 0x01|.
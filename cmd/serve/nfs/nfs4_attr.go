@@ -0,0 +1,272 @@
+//go:build unix
+
+package nfs
+
+import (
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/rclone/rclone/vfs"
+)
+
+// The attributes which can be read
+var nfs4Attrs = []int{
+	attrSupportedAttrs, attrType, attrFHExpireType, attrChange, attrSize,
+	attrLinkSupport, attrSymlinkSupport, attrNamedAttr, attrFSID,
+	attrUniqueHandles, attrLeaseTime, attrRdattrError, attrACLSupport,
+	attrCanSetTime, attrCaseInsensitive, attrCasePreserving,
+	attrChownRestricted, attrFileHandle, attrFileID, attrFilesAvail,
+	attrFilesFree, attrFilesTotal, attrHomogeneous, attrMaxFileSize,
+	attrMaxLink, attrMaxName, attrMaxRead, attrMaxWrite, attrMode,
+	attrNoTrunc, attrNumLinks, attrOwner, attrOwnerGroup, attrRawDev,
+	attrSpaceAvail, attrSpaceFree, attrSpaceTotal, attrSpaceUsed,
+	attrTimeAccess, attrTimeAccessSet, attrTimeDelta, attrTimeMetadata,
+	attrTimeModify, attrTimeModifySet, attrMountedOnFileID,
+}
+
+// The attributes which can be set by SETATTR, OPEN and CREATE
+var nfs4SettableAttrs = []int{
+	attrSize, attrMode, attrOwner, attrOwnerGroup, attrTimeAccessSet, attrTimeModifySet,
+}
+
+// fsid major number for the VFS - "rclone" in ASCII
+const nfs4FSIDMajor = 0x72636c6f6e65
+
+// makeBitmap makes a bitmap4 from a list of bits
+func makeBitmap(bits ...int) (words []uint32) {
+	for _, bit := range bits {
+		words = setBit(words, bit)
+	}
+	return words
+}
+
+// setBit sets bit in words, extending it if necessary
+func setBit(words []uint32, bit int) []uint32 {
+	for len(words) <= bit/32 {
+		words = append(words, 0)
+	}
+	words[bit/32] |= 1 << (bit % 32)
+	return words
+}
+
+// hasBit returns true if bit is set in words
+func hasBit(words []uint32, bit int) bool {
+	return bit/32 < len(words) && words[bit/32]&(1<<(bit%32)) != 0
+}
+
+// supportedAttrs returns the attributes supported in the minor version
+func supportedAttrs(minor uint32) []uint32 {
+	words := makeBitmap(nfs4Attrs...)
+	if minor > 0 {
+		words = setBit(words, attrSuppAttrExclCreat)
+	}
+	return words
+}
+
+// writeTime writes an nfstime4
+func writeTime(res *xdrWriter, t time.Time) {
+	res.uint64(uint64(t.Unix()))
+	res.uint32(uint32(t.Nanosecond()))
+}
+
+// readTime reads an nfstime4
+func readTime(args *xdrReader) time.Time {
+	secs := int64(args.uint64())
+	nsecs := args.uint32()
+	return time.Unix(secs, int64(nsecs))
+}
+
+// size returns a Statfs value as a uint64 using a big value if unknown
+func statfsSize(x int64) uint64 {
+	if x < 0 {
+		return math.MaxInt64
+	}
+	return uint64(x)
+}
+
+// change returns the change attribute of node
+//
+// This is the modification time plus the number of changes this
+// server has made to it, as directory modification times aren't
+// always updated when their contents change.
+func (srv *nfs4Server) change(node vfs.Node) uint64 {
+	return uint64(node.ModTime().UnixNano()) + srv.state.change(node.Path())
+}
+
+// encodeAttrs returns the attributes in request for node which has
+// path. It returns the attributes it encoded and their values.
+func (c *compound) encodeAttrs(node vfs.Node, path []string, request []uint32) (mask []uint32, vals []byte) {
+	var (
+		res       xdrWriter
+		srv       = c.srv
+		opt       = &srv.h.vfs.Opt
+		supported = supportedAttrs(c.minor)
+		modTime   = node.ModTime()
+		size      = uint64(max(node.Size(), 0))
+	)
+	statfs := func() (total, used, free uint64) {
+		t, u, f := srv.h.vfs.Statfs()
+		return statfsSize(t), statfsSize(u), statfsSize(f)
+	}
+	for bit := 0; bit < len(request)*32; bit++ {
+		if !hasBit(request, bit) || !hasBit(supported, bit) {
+			continue
+		}
+		mask = setBit(mask, bit)
+		switch bit {
+		case attrSupportedAttrs:
+			res.bitmap(supported)
+		case attrType:
+			switch {
+			case node.IsDir():
+				res.uint32(nf4Dir)
+			case node.Mode()&os.ModeSymlink != 0:
+				res.uint32(nf4Lnk)
+			default:
+				res.uint32(nf4Reg)
+			}
+		case attrFHExpireType:
+			res.uint32(0) // FH4_PERSISTENT
+		case attrChange:
+			res.uint64(srv.change(node))
+		case attrSize:
+			res.uint64(size)
+		case attrLinkSupport, attrNamedAttr:
+			res.bool(false)
+		case attrSymlinkSupport:
+			res.bool(opt.Links)
+		case attrFSID:
+			res.uint64(nfs4FSIDMajor)
+			res.uint64(0)
+		case attrUniqueHandles, attrCanSetTime, attrCasePreserving, attrChownRestricted, attrHomogeneous, attrNoTrunc:
+			res.bool(true)
+		case attrLeaseTime:
+			res.uint32(nfs4LeaseSeconds)
+		case attrRdattrError, attrACLSupport:
+			res.uint32(0)
+		case attrCaseInsensitive:
+			res.bool(opt.CaseInsensitive)
+		case attrFileHandle:
+			res.opaque(srv.h.ToHandle(srv.h.billyFS, path))
+		case attrFileID, attrMountedOnFileID:
+			res.uint64(node.Inode())
+		case attrFilesAvail, attrFilesFree, attrFilesTotal:
+			res.uint64(math.MaxUint32)
+		case attrMaxFileSize:
+			res.uint64(math.MaxInt64)
+		case attrMaxLink:
+			res.uint32(1)
+		case attrMaxName:
+			res.uint32(nfs4MaxName)
+		case attrMaxRead, attrMaxWrite:
+			res.uint64(nfs4MaxIO)
+		case attrMode:
+			res.uint32(uint32(node.Mode().Perm()))
+		case attrNumLinks:
+			res.uint32(1)
+		case attrOwner:
+			res.string(strconv.FormatUint(uint64(opt.UID), 10))
+		case attrOwnerGroup:
+			res.string(strconv.FormatUint(uint64(opt.GID), 10))
+		case attrRawDev:
+			res.uint32(0)
+			res.uint32(0)
+		case attrSpaceAvail, attrSpaceFree:
+			_, _, free := statfs()
+			res.uint64(free)
+		case attrSpaceTotal:
+			total, _, _ := statfs()
+			res.uint64(total)
+		case attrSpaceUsed:
+			res.uint64(size)
+		case attrTimeAccess, attrTimeMetadata, attrTimeModify:
+			writeTime(&res, modTime)
+		case attrTimeDelta:
+			writeTime(&res, time.Unix(0, 1))
+		case attrSuppAttrExclCreat:
+			res.bitmap(makeBitmap(nfs4SettableAttrs...))
+		default:
+			// write only attributes (time_access_set, time_modify_set)
+			mask[bit/32] &^= 1 << (bit % 32)
+		}
+	}
+	return mask, res.Bytes()
+}
+
+// setAttrs are the attributes decoded from a fattr4 to be set
+type setAttrs struct {
+	mask    []uint32   // the attributes which were sent
+	size    *uint64    // size to truncate to if set
+	modTime *time.Time // modification time to set if set
+}
+
+// readSetAttrs reads a fattr4 of attributes to set
+func readSetAttrs(args *xdrReader) (attrs setAttrs, status nfs4Status) {
+	attrs.mask = args.bitmap()
+	vals := newXDRReader(args.opaque(nfs4MaxRecord))
+	if args.err != nil {
+		return attrs, nfs4OK
+	}
+	settable := makeBitmap(nfs4SettableAttrs...)
+	for bit := 0; bit < len(attrs.mask)*32; bit++ {
+		if !hasBit(attrs.mask, bit) {
+			continue
+		}
+		if !hasBit(settable, bit) {
+			if hasBit(supportedAttrs(nfs4MaxMinorVers), bit) {
+				return attrs, nfs4ErrInval
+			}
+			return attrs, nfs4ErrAttrNotSupp
+		}
+		switch bit {
+		case attrSize:
+			size := vals.uint64()
+			attrs.size = &size
+		case attrMode:
+			_ = vals.uint32() // not supported by the VFS so ignored
+		case attrOwner, attrOwnerGroup:
+			_ = vals.string(1024) // owners are set by --uid and --gid
+		case attrTimeAccessSet, attrTimeModifySet:
+			t := time.Now()
+			if vals.uint32() != setToServerTime {
+				t = readTime(vals)
+			}
+			if bit == attrTimeModifySet {
+				attrs.modTime = &t
+			}
+		}
+	}
+	if vals.err != nil {
+		return attrs, nfs4ErrBadXDR
+	}
+	return attrs, nfs4OK
+}
+
+// setAttrs sets the attributes on the file at name, using file to
+// truncate it if it is not nil
+func (c *compound) setAttrs(node vfs.Node, file vfs.Handle, attrs setAttrs) nfs4Status {
+	if attrs.size != nil {
+		if node.IsDir() {
+			return nfs4ErrIsDir
+		}
+		var err error
+		if file != nil {
+			err = file.Truncate(int64(*attrs.size))
+		} else {
+			err = node.Truncate(int64(*attrs.size))
+		}
+		if err != nil {
+			return errorStatus(err)
+		}
+	}
+	if attrs.modTime != nil {
+		err := node.SetModTime(*attrs.modTime)
+		if err != nil {
+			return errorStatus(err)
+		}
+	}
+	c.srv.state.changed(node.Path())
+	return nfs4OK
+}
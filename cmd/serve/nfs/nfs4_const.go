@@ -0,0 +1,257 @@
+//go:build unix
+
+package nfs
+
+// Constants from RFC 7530 (NFSv4.0) and RFC 8881 (NFSv4.1)
+
+// RPC values
+const (
+	rpcVersion       = 2
+	rpcCall          = 0
+	rpcReply         = 1
+	rpcMsgAccepted   = 0
+	rpcMsgDenied     = 1
+	rpcSuccess       = 0
+	rpcProgUnavail   = 1
+	rpcProgMismatch  = 2
+	rpcProcUnavail   = 3
+	rpcGarbageArgs   = 4
+	rpcMismatch      = 0
+	rpcAuthError     = 1
+	authBadCred      = 1
+	authNone         = 0
+	authSys          = 1
+	nfsProgram       = 100003
+	nfsV4            = 4
+	nfs4ProcNull     = 0
+	nfs4ProcCompound = 1
+)
+
+// Limits
+const (
+	nfs4FHSize       = 128     // max size of a file handle
+	nfs4MaxName      = 255     // max length of a name
+	nfs4MaxIO        = 1 << 20 // max size of a READ or WRITE
+	nfs4MaxRecord    = nfs4MaxIO + 64*1024
+	nfs4MaxOps       = 128 // max ops in a COMPOUND
+	nfs4MaxSlots     = 64  // max NFSv4.1 session slots
+	nfs4LeaseSeconds = 90  // lease time in seconds
+	nfs4MaxMinorVers = 1   // highest minor version supported
+)
+
+// nfs4Status is an nfsstat4
+type nfs4Status uint32
+
+// Status codes
+const (
+	nfs4OK                   nfs4Status = 0
+	nfs4ErrPerm              nfs4Status = 1
+	nfs4ErrNoEnt             nfs4Status = 2
+	nfs4ErrIO                nfs4Status = 5
+	nfs4ErrExist             nfs4Status = 17
+	nfs4ErrNotDir            nfs4Status = 20
+	nfs4ErrIsDir             nfs4Status = 21
+	nfs4ErrInval             nfs4Status = 22
+	nfs4ErrNoSpc             nfs4Status = 28
+	nfs4ErrROFS              nfs4Status = 30
+	nfs4ErrNameTooLong       nfs4Status = 63
+	nfs4ErrNotEmpty          nfs4Status = 66
+	nfs4ErrStale             nfs4Status = 70
+	nfs4ErrBadHandle         nfs4Status = 10001
+	nfs4ErrBadCookie         nfs4Status = 10003
+	nfs4ErrNotSupp           nfs4Status = 10004
+	nfs4ErrTooSmall          nfs4Status = 10005
+	nfs4ErrBadType           nfs4Status = 10007
+	nfs4ErrSame              nfs4Status = 10009
+	nfs4ErrDenied            nfs4Status = 10010
+	nfs4ErrLocked            nfs4Status = 10012
+	nfs4ErrShareDenied       nfs4Status = 10015
+	nfs4ErrResource          nfs4Status = 10018
+	nfs4ErrNoFileHandle      nfs4Status = 10020
+	nfs4ErrMinorVersMismatch nfs4Status = 10021
+	nfs4ErrStaleClientID     nfs4Status = 10022
+	nfs4ErrStaleStateID      nfs4Status = 10023
+	nfs4ErrOldStateID        nfs4Status = 10024
+	nfs4ErrBadStateID        nfs4Status = 10025
+	nfs4ErrBadSeqID          nfs4Status = 10026
+	nfs4ErrNotSame           nfs4Status = 10027
+	nfs4ErrSymlink           nfs4Status = 10029
+	nfs4ErrRestoreFH         nfs4Status = 10030
+	nfs4ErrAttrNotSupp       nfs4Status = 10032
+	nfs4ErrNoGrace           nfs4Status = 10033
+	nfs4ErrBadXDR            nfs4Status = 10036
+	nfs4ErrLocksHeld         nfs4Status = 10037
+	nfs4ErrOpenMode          nfs4Status = 10038
+	nfs4ErrBadName           nfs4Status = 10041
+	nfs4ErrOpIllegal         nfs4Status = 10044
+	nfs4ErrBadSession        nfs4Status = 10052
+	nfs4ErrBadSlot           nfs4Status = 10053
+	nfs4ErrSeqMisordered     nfs4Status = 10063
+	nfs4ErrSequencePos       nfs4Status = 10064
+	nfs4ErrRetryUncachedRep  nfs4Status = 10068
+	nfs4ErrTooManyOps        nfs4Status = 10070
+	nfs4ErrOpNotInSession    nfs4Status = 10071
+	nfs4ErrClientIDBusy      nfs4Status = 10074
+)
+
+// Operations
+const (
+	opAccess             = 3
+	opClose              = 4
+	opCommit             = 5
+	opCreate             = 6
+	opDelegPurge         = 7
+	opDelegReturn        = 8
+	opGetattr            = 9
+	opGetFH              = 10
+	opLink               = 11
+	opLock               = 12
+	opLockT              = 13
+	opLockU              = 14
+	opLookup             = 15
+	opLookupP            = 16
+	opNVerify            = 17
+	opOpen               = 18
+	opOpenAttr           = 19
+	opOpenConfirm        = 20
+	opOpenDowngrade      = 21
+	opPutFH              = 22
+	opPutPubFH           = 23
+	opPutRootFH          = 24
+	opRead               = 25
+	opReadDir            = 26
+	opReadLink           = 27
+	opRemove             = 28
+	opRename             = 29
+	opRenew              = 30
+	opRestoreFH          = 31
+	opSaveFH             = 32
+	opSecInfo            = 33
+	opSetattr            = 34
+	opSetClientID        = 35
+	opSetClientIDConfirm = 36
+	opVerify             = 37
+	opWrite              = 38
+	opReleaseLockOwner   = 39
+	opBindConnToSession  = 41
+	opExchangeID         = 42
+	opCreateSession      = 43
+	opDestroySession     = 44
+	opFreeStateID        = 45
+	opSecInfoNoName      = 52
+	opSequence           = 53
+	opTestStateID        = 55
+	opDestroyClientID    = 57
+	opReclaimComplete    = 58
+	opIllegal            = 10044
+)
+
+// File types
+const (
+	nf4Reg = 1
+	nf4Dir = 2
+	nf4Lnk = 5
+)
+
+// Attributes
+const (
+	attrSupportedAttrs    = 0
+	attrType              = 1
+	attrFHExpireType      = 2
+	attrChange            = 3
+	attrSize              = 4
+	attrLinkSupport       = 5
+	attrSymlinkSupport    = 6
+	attrNamedAttr         = 7
+	attrFSID              = 8
+	attrUniqueHandles     = 9
+	attrLeaseTime         = 10
+	attrRdattrError       = 11
+	attrACLSupport        = 13
+	attrCanSetTime        = 15
+	attrCaseInsensitive   = 16
+	attrCasePreserving    = 17
+	attrChownRestricted   = 18
+	attrFileHandle        = 19
+	attrFileID            = 20
+	attrFilesAvail        = 21
+	attrFilesFree         = 22
+	attrFilesTotal        = 23
+	attrHomogeneous       = 26
+	attrMaxFileSize       = 27
+	attrMaxLink           = 28
+	attrMaxName           = 29
+	attrMaxRead           = 30
+	attrMaxWrite          = 31
+	attrMode              = 33
+	attrNoTrunc           = 34
+	attrNumLinks          = 35
+	attrOwner             = 36
+	attrOwnerGroup        = 37
+	attrRawDev            = 41
+	attrSpaceAvail        = 42
+	attrSpaceFree         = 43
+	attrSpaceTotal        = 44
+	attrSpaceUsed         = 45
+	attrTimeAccess        = 47
+	attrTimeAccessSet     = 48
+	attrTimeDelta         = 51
+	attrTimeMetadata      = 52
+	attrTimeModify        = 53
+	attrTimeModifySet     = 54
+	attrMountedOnFileID   = 55
+	attrSuppAttrExclCreat = 75
+)
+
+// ACCESS bits
+const (
+	access4Read    = 0x01
+	access4Lookup  = 0x02
+	access4Modify  = 0x04
+	access4Extend  = 0x08
+	access4Delete  = 0x10
+	access4Execute = 0x20
+)
+
+// OPEN values
+const (
+	open4ShareAccessRead  = 1
+	open4ShareAccessWrite = 2
+	open4ShareAccessBoth  = 3
+	open4NoCreate         = 0
+	open4Create           = 1
+	createUnchecked       = 0
+	createGuarded         = 1
+	createExclusive       = 2
+	createExclusive41     = 3
+	claimNull             = 0
+	claimPrevious         = 1
+	claimFH               = 4
+	open4ResultPosixLocks = 0x4
+	openDelegateNone      = 0
+)
+
+// Lock types
+const (
+	readLT   = 1
+	writeLT  = 2
+	writeWLT = 4
+)
+
+// WRITE stable_how
+const (
+	fileSync = 2
+)
+
+// SETATTR time_how
+const (
+	setToServerTime = 0
+)
+
+// EXCHANGE_ID and CREATE_SESSION flags
+const (
+	exchgID4FlagUseNonPNFS = 0x00010000
+	exchgID4FlagConfirmedR = 0x80000000
+	sp4None                = 0
+	cdfs4Fore              = 0x1
+)
@@ -0,0 +1,1643 @@
+//go:build unix
+
+package nfs
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/vfs"
+	"github.com/rclone/rclone/vfs/vfscommon"
+)
+
+// nfs4Ops are the COMPOUND operations which are supported
+var nfs4Ops map[uint32]nfs4Op
+
+func init() {
+	nfs4Ops = map[uint32]nfs4Op{
+		opAccess:             {"ACCESS", 0, 1, (*compound).opAccess},
+		opClose:              {"CLOSE", 0, 1, (*compound).opClose},
+		opCommit:             {"COMMIT", 0, 1, (*compound).opCommit},
+		opCreate:             {"CREATE", 0, 1, (*compound).opCreate},
+		opDelegPurge:         {"DELEGPURGE", 0, 1, (*compound).opNotSupp},
+		opDelegReturn:        {"DELEGRETURN", 0, 1, (*compound).opDelegReturn},
+		opGetattr:            {"GETATTR", 0, 1, (*compound).opGetattr},
+		opGetFH:              {"GETFH", 0, 1, (*compound).opGetFH},
+		opLink:               {"LINK", 0, 1, (*compound).opNotSupp},
+		opLock:               {"LOCK", 0, 1, (*compound).opLock},
+		opLockT:              {"LOCKT", 0, 1, (*compound).opLockT},
+		opLockU:              {"LOCKU", 0, 1, (*compound).opLockU},
+		opLookup:             {"LOOKUP", 0, 1, (*compound).opLookup},
+		opLookupP:            {"LOOKUPP", 0, 1, (*compound).opLookupP},
+		opNVerify:            {"NVERIFY", 0, 1, (*compound).opNVerify},
+		opOpen:               {"OPEN", 0, 1, (*compound).opOpen},
+		opOpenAttr:           {"OPENATTR", 0, 1, (*compound).opNotSupp},
+		opOpenConfirm:        {"OPEN_CONFIRM", 0, 0, (*compound).opOpenConfirm},
+		opOpenDowngrade:      {"OPEN_DOWNGRADE", 0, 1, (*compound).opOpenDowngrade},
+		opPutFH:              {"PUTFH", 0, 1, (*compound).opPutFH},
+		opPutPubFH:           {"PUTPUBFH", 0, 1, (*compound).opPutRootFH},
+		opPutRootFH:          {"PUTROOTFH", 0, 1, (*compound).opPutRootFH},
+		opRead:               {"READ", 0, 1, (*compound).opRead},
+		opReadDir:            {"READDIR", 0, 1, (*compound).opReadDir},
+		opReadLink:           {"READLINK", 0, 1, (*compound).opReadLink},
+		opRemove:             {"REMOVE", 0, 1, (*compound).opRemove},
+		opRename:             {"RENAME", 0, 1, (*compound).opRename},
+		opRenew:              {"RENEW", 0, 0, (*compound).opRenew},
+		opRestoreFH:          {"RESTOREFH", 0, 1, (*compound).opRestoreFH},
+		opSaveFH:             {"SAVEFH", 0, 1, (*compound).opSaveFH},
+		opSecInfo:            {"SECINFO", 0, 1, (*compound).opSecInfo},
+		opSetattr:            {"SETATTR", 0, 1, (*compound).opSetattr},
+		opSetClientID:        {"SETCLIENTID", 0, 0, (*compound).opSetClientID},
+		opSetClientIDConfirm: {"SETCLIENTID_CONFIRM", 0, 0, (*compound).opSetClientIDConfirm},
+		opVerify:             {"VERIFY", 0, 1, (*compound).opVerify},
+		opWrite:              {"WRITE", 0, 1, (*compound).opWrite},
+		opReleaseLockOwner:   {"RELEASE_LOCKOWNER", 0, 0, (*compound).opReleaseLockOwner},
+		opBindConnToSession:  {"BIND_CONN_TO_SESSION", 1, 1, (*compound).opBindConnToSession},
+		opExchangeID:         {"EXCHANGE_ID", 1, 1, (*compound).opExchangeID},
+		opCreateSession:      {"CREATE_SESSION", 1, 1, (*compound).opCreateSession},
+		opDestroySession:     {"DESTROY_SESSION", 1, 1, (*compound).opDestroySession},
+		opFreeStateID:        {"FREE_STATEID", 1, 1, (*compound).opFreeStateID},
+		opSecInfoNoName:      {"SECINFO_NO_NAME", 1, 1, (*compound).opSecInfoNoName},
+		opSequence:           {"SEQUENCE", 1, 1, (*compound).opSequence},
+		opTestStateID:        {"TEST_STATEID", 1, 1, (*compound).opTestStateID},
+		opDestroyClientID:    {"DESTROY_CLIENTID", 1, 1, (*compound).opDestroyClientID},
+		opReclaimComplete:    {"RECLAIM_COMPLETE", 1, 1, (*compound).opReclaimComplete},
+	}
+}
+
+// opNotSupp is for operations which aren't supported. The arguments
+// don't need reading as processing stops at the error.
+func (c *compound) opNotSupp(args *xdrReader, res *xdrWriter) nfs4Status {
+	return nfs4ErrNotSupp
+}
+
+// File handle operations
+
+func (c *compound) opPutRootFH(args *xdrReader, res *xdrWriter) nfs4Status {
+	c.cur = fileHandle{handle: c.srv.root, path: []string{}}
+	return nfs4OK
+}
+
+func (c *compound) opPutFH(args *xdrReader, res *xdrWriter) nfs4Status {
+	handle := args.opaque(nfs4FHSize)
+	if args.err != nil {
+		return nfs4ErrBadXDR
+	}
+	if len(handle) == 0 {
+		return nfs4ErrBadHandle
+	}
+	_, path, err := c.srv.h.FromHandle(handle)
+	if err != nil {
+		return nfs4ErrStale
+	}
+	fh := fileHandle{handle: slices.Clone(handle), path: path}
+	if _, status := c.node(fh); status != nfs4OK {
+		return status
+	}
+	c.cur = fh
+	return nfs4OK
+}
+
+func (c *compound) opGetFH(args *xdrReader, res *xdrWriter) nfs4Status {
+	if status := c.needFH(); status != nfs4OK {
+		return status
+	}
+	res.opaque(c.cur.handle)
+	return nfs4OK
+}
+
+func (c *compound) opSaveFH(args *xdrReader, res *xdrWriter) nfs4Status {
+	if status := c.needFH(); status != nfs4OK {
+		return status
+	}
+	c.saved = c.cur
+	return nfs4OK
+}
+
+func (c *compound) opRestoreFH(args *xdrReader, res *xdrWriter) nfs4Status {
+	if c.saved.handle == nil {
+		return nfs4ErrRestoreFH
+	}
+	c.cur = c.saved
+	return nfs4OK
+}
+
+func (c *compound) opLookup(args *xdrReader, res *xdrWriter) nfs4Status {
+	name := args.string(nfs4MaxRecord)
+	if args.err != nil {
+		return nfs4ErrBadXDR
+	}
+	if _, status := c.dir(); status != nfs4OK {
+		return status
+	}
+	if status := checkName(name); status != nfs4OK {
+		return status
+	}
+	path := c.cur.child(name)
+	_, err := c.srv.h.billyFS.Stat(joinPath(path))
+	if err != nil {
+		return errorStatus(err)
+	}
+	c.setCur(path)
+	return nfs4OK
+}
+
+func (c *compound) opLookupP(args *xdrReader, res *xdrWriter) nfs4Status {
+	if _, status := c.dir(); status != nfs4OK {
+		return status
+	}
+	if len(c.cur.path) == 0 {
+		return nfs4ErrNoEnt
+	}
+	c.setCur(slices.Clone(c.cur.path[:len(c.cur.path)-1]))
+	return nfs4OK
+}
+
+// Attribute operations
+
+func (c *compound) opGetattr(args *xdrReader, res *xdrWriter) nfs4Status {
+	request := args.bitmap()
+	if args.err != nil {
+		return nfs4ErrBadXDR
+	}
+	if status := c.needFH(); status != nfs4OK {
+		return status
+	}
+	node, status := c.node(c.cur)
+	if status != nfs4OK {
+		return status
+	}
+	mask, vals := c.encodeAttrs(node, c.cur.path, request)
+	res.bitmap(mask)
+	res.opaque(vals)
+	return nfs4OK
+}
+
+// verify compares the attributes in args with those of the current
+// file handle returning nfs4ErrSame if they are the same
+func (c *compound) verify(args *xdrReader) nfs4Status {
+	request := args.bitmap()
+	vals := args.opaque(nfs4MaxRecord)
+	if args.err != nil {
+		return nfs4ErrBadXDR
+	}
+	if status := c.needFH(); status != nfs4OK {
+		return status
+	}
+	if hasBit(request, attrRdattrError) {
+		return nfs4ErrInval
+	}
+	node, status := c.node(c.cur)
+	if status != nfs4OK {
+		return status
+	}
+	mask, ours := c.encodeAttrs(node, c.cur.path, request)
+	for i, word := range request {
+		if i >= len(mask) || mask[i] != word {
+			return nfs4ErrAttrNotSupp
+		}
+	}
+	if bytes.Equal(vals, ours) {
+		return nfs4ErrSame
+	}
+	return nfs4ErrNotSame
+}
+
+func (c *compound) opVerify(args *xdrReader, res *xdrWriter) nfs4Status {
+	status := c.verify(args)
+	if status == nfs4ErrSame {
+		return nfs4OK
+	}
+	return status
+}
+
+func (c *compound) opNVerify(args *xdrReader, res *xdrWriter) nfs4Status {
+	status := c.verify(args)
+	if status == nfs4ErrNotSame {
+		return nfs4OK
+	}
+	return status
+}
+
+func (c *compound) opSetattr(args *xdrReader, res *xdrWriter) nfs4Status {
+	sid := c.stateIDArg(args)
+	attrs, status := readSetAttrs(args)
+	if args.err != nil {
+		return nfs4ErrBadXDR
+	}
+	// SETATTR always returns the attributes set
+	defer func() {
+		if status == nfs4OK {
+			res.bitmap(attrs.mask)
+		} else {
+			res.bitmap(nil)
+		}
+	}()
+	if status != nfs4OK {
+		return status
+	}
+	if status = c.needFH(); status != nfs4OK {
+		return status
+	}
+	node, status := c.node(c.cur)
+	if status != nfs4OK {
+		return status
+	}
+	var file vfs.Handle
+	if attrs.size != nil {
+		if status = c.checkWrite(c.cur.name()); status != nfs4OK {
+			return status
+		}
+		state := c.srv.state
+		state.mu.Lock()
+		var open *openState
+		open, status = state._fileFor(sid, true)
+		if open != nil {
+			file = open.file
+		}
+		state.mu.Unlock()
+		if status != nfs4OK {
+			return status
+		}
+	}
+	status = c.setAttrs(node, file, attrs)
+	return status
+}
+
+func (c *compound) opAccess(args *xdrReader, res *xdrWriter) nfs4Status {
+	request := args.uint32()
+	if args.err != nil {
+		return nfs4ErrBadXDR
+	}
+	if status := c.needFH(); status != nfs4OK {
+		return status
+	}
+	if _, status := c.node(c.cur); status != nfs4OK {
+		return status
+	}
+	const all = access4Read | access4Lookup | access4Modify | access4Extend | access4Delete | access4Execute
+	allowed := uint32(all)
+	if c.srv.h.vfs.Opt.ReadOnly {
+		allowed &^= access4Modify | access4Extend | access4Delete
+	}
+	res.uint32(request & all)
+	res.uint32(request & allowed)
+	return nfs4OK
+}
+
+// Directory operations
+
+// changeInfo writes a change_info4 for the directory at path
+func (c *compound) changeInfo(res *xdrWriter, before uint64, path []string) {
+	after := before
+	if node, status := c.node(fileHandle{path: path}); status == nfs4OK {
+		after = c.srv.change(node)
+	}
+	res.bool(false) // not atomic
+	res.uint64(before)
+	res.uint64(after)
+}
+
+// dirChanged bumps the change attribute of the directory at path
+func (c *compound) dirChanged(path []string) {
+	c.srv.state.changed(joinPath(path))
+}
+
+func (c *compound) opReadDir(args *xdrReader, res *xdrWriter) nfs4Status {
+	cookie := args.uint64()
+	_ = args.fixed(8) // cookie verifier
+	_ = args.uint32() // dircount
+	maxCount := args.uint32()
+	request := args.bitmap()
+	if args.err != nil {
+		return nfs4ErrBadXDR
+	}
+	if _, status := c.dir(); status != nfs4OK {
+		return status
+	}
+	if cookie == 1 || cookie == 2 {
+		return nfs4ErrBadCookie
+	}
+	entries, err := c.srv.h.billyFS.ReadDir(c.cur.name())
+	if err != nil {
+		return errorStatus(err)
+	}
+	// Cookies 0, 1 and 2 are reserved so entry i has cookie i+3
+	start := 0
+	if cookie > 2 {
+		start = int(cookie - 2)
+		if start > len(entries) {
+			return nfs4ErrBadCookie
+		}
+	}
+	res.fixed(c.srv.state.verifier[:])
+	size := res.Len() + 8 // the end of the list and eof
+	eof := true
+	for i := start; i < len(entries); i++ {
+		node, ok := entries[i].(vfs.Node)
+		if !ok {
+			continue
+		}
+		var entry xdrWriter
+		mask, vals := c.encodeAttrs(node, c.cur.child(node.Name()), request)
+		entry.bool(true)
+		entry.uint64(uint64(i + 3))
+		entry.string(node.Name())
+		entry.bitmap(mask)
+		entry.opaque(vals)
+		if size+entry.Len() > int(maxCount) {
+			if i == start {
+				res.Reset()
+				return nfs4ErrTooSmall
+			}
+			eof = false
+			break
+		}
+		size += entry.Len()
+		res.Write(entry.Bytes())
+	}
+	res.bool(false)
+	res.bool(eof)
+	return nfs4OK
+}
+
+func (c *compound) opReadLink(args *xdrReader, res *xdrWriter) nfs4Status {
+	if status := c.needFH(); status != nfs4OK {
+		return status
+	}
+	node, status := c.node(c.cur)
+	if status != nfs4OK {
+		return status
+	}
+	if node.Mode()&os.ModeSymlink == 0 {
+		return nfs4ErrInval
+	}
+	target, err := c.srv.h.billyFS.Readlink(c.cur.name())
+	if err != nil {
+		return errorStatus(err)
+	}
+	res.string(target)
+	return nfs4OK
+}
+
+func (c *compound) opCreate(args *xdrReader, res *xdrWriter) nfs4Status {
+	objType := args.uint32()
+	var target string
+	switch objType {
+	case nf4Lnk:
+		target = args.string(nfs4MaxRecord)
+	case nf4Dir:
+	default:
+		return nfs4ErrBadType
+	}
+	name := args.string(nfs4MaxRecord)
+	attrs, status := readSetAttrs(args)
+	if args.err != nil {
+		return nfs4ErrBadXDR
+	}
+	if status != nfs4OK {
+		return status
+	}
+	dir, status := c.dir()
+	if status != nfs4OK {
+		return status
+	}
+	if status := checkName(name); status != nfs4OK {
+		return status
+	}
+	before := c.srv.change(dir)
+	dirPath := c.cur.path
+	path := c.cur.child(name)
+	if objType == nf4Dir {
+		err := c.srv.h.vfs.Mkdir(joinPath(path), 0777)
+		if err != nil {
+			return errorStatus(err)
+		}
+	} else {
+		err := c.srv.h.billyFS.Symlink(target, joinPath(path))
+		if err != nil {
+			return errorStatus(err)
+		}
+	}
+	c.dirChanged(dirPath)
+	attrs.size = nil
+	if node, status := c.node(fileHandle{path: path}); status == nfs4OK {
+		_ = c.setAttrs(node, nil, attrs)
+	}
+	c.changeInfo(res, before, dirPath)
+	res.bitmap(attrs.mask)
+	c.setCur(path)
+	return nfs4OK
+}
+
+func (c *compound) opRemove(args *xdrReader, res *xdrWriter) nfs4Status {
+	name := args.string(nfs4MaxRecord)
+	if args.err != nil {
+		return nfs4ErrBadXDR
+	}
+	dir, status := c.dir()
+	if status != nfs4OK {
+		return status
+	}
+	if status := checkName(name); status != nfs4OK {
+		return status
+	}
+	before := c.srv.change(dir)
+	path := c.cur.child(name)
+	// billyFS checks the file isn't locked in the VFS
+	err := c.srv.h.billyFS.Remove(joinPath(path))
+	if err != nil {
+		return errorStatus(err)
+	}
+	c.invalidate(path)
+	c.dirChanged(c.cur.path)
+	c.changeInfo(res, before, c.cur.path)
+	return nfs4OK
+}
+
+// invalidate removes the handle for path from the handle cache
+func (c *compound) invalidate(path []string) {
+	h := c.srv.h
+	err := h.InvalidateHandle(h.billyFS, h.ToHandle(h.billyFS, path))
+	if err != nil {
+		fs.Debugf(joinPath(path), "NFSv4: failed to invalidate handle: %v", err)
+	}
+}
+
+func (c *compound) opRename(args *xdrReader, res *xdrWriter) nfs4Status {
+	oldName := args.string(nfs4MaxRecord)
+	newName := args.string(nfs4MaxRecord)
+	if args.err != nil {
+		return nfs4ErrBadXDR
+	}
+	if c.saved.handle == nil {
+		return nfs4ErrNoFileHandle
+	}
+	newDir, status := c.dir()
+	if status != nfs4OK {
+		return status
+	}
+	oldDir, status := c.node(c.saved)
+	if status != nfs4OK {
+		return status
+	}
+	if !oldDir.IsDir() {
+		return nfs4ErrNotDir
+	}
+	if status := checkName(oldName); status != nfs4OK {
+		return status
+	}
+	if status := checkName(newName); status != nfs4OK {
+		return status
+	}
+	oldBefore, newBefore := c.srv.change(oldDir), c.srv.change(newDir)
+	oldPath, newPath := c.saved.child(oldName), c.cur.child(newName)
+	if joinPath(oldPath) != joinPath(newPath) {
+		err := c.srv.h.billyFS.Rename(joinPath(oldPath), joinPath(newPath))
+		if err != nil {
+			return errorStatus(err)
+		}
+		c.invalidate(oldPath)
+		c.dirChanged(c.saved.path)
+		c.dirChanged(c.cur.path)
+	}
+	c.changeInfo(res, oldBefore, c.saved.path)
+	c.changeInfo(res, newBefore, c.cur.path)
+	return nfs4OK
+}
+
+// Security operations
+
+// writeSecInfo writes the security flavors supported
+func (c *compound) writeSecInfo(res *xdrWriter) {
+	res.uint32(2)
+	res.uint32(authSys)
+	res.uint32(authNone)
+	// SECINFO consumes the current file handle
+	c.cur = fileHandle{}
+}
+
+func (c *compound) opSecInfo(args *xdrReader, res *xdrWriter) nfs4Status {
+	name := args.string(nfs4MaxRecord)
+	if args.err != nil {
+		return nfs4ErrBadXDR
+	}
+	if _, status := c.dir(); status != nfs4OK {
+		return status
+	}
+	if status := checkName(name); status != nfs4OK {
+		return status
+	}
+	if _, err := c.srv.h.billyFS.Stat(joinPath(c.cur.child(name))); err != nil {
+		return errorStatus(err)
+	}
+	c.writeSecInfo(res)
+	return nfs4OK
+}
+
+func (c *compound) opSecInfoNoName(args *xdrReader, res *xdrWriter) nfs4Status {
+	_ = args.uint32() // style - current or parent
+	if args.err != nil {
+		return nfs4ErrBadXDR
+	}
+	if status := c.needFH(); status != nfs4OK {
+		return status
+	}
+	c.writeSecInfo(res)
+	return nfs4OK
+}
+
+// Client operations for NFSv4.0
+
+func (c *compound) opSetClientID(args *xdrReader, res *xdrWriter) nfs4Status {
+	var verifier [8]byte
+	copy(verifier[:], args.fixed(8))
+	name := string(args.opaque(1024))
+	_ = args.uint32()     // callback program
+	_ = args.string(1024) // callback netid
+	_ = args.string(1024) // callback address
+	_ = args.uint32()     // callback ident
+	if args.err != nil {
+		return nfs4ErrBadXDR
+	}
+	state := c.srv.state
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	// Callbacks are never made as delegations aren't granted so
+	// the callback details can be ignored.
+	var client *nfs4Client
+	for _, old := range state.clients {
+		if old.name != name || old.minor != 0 {
+			continue
+		}
+		if old.confirmed && old.verifier == verifier {
+			client = old
+		} else if !old.confirmed {
+			delete(state.clients, old.id)
+		}
+	}
+	if client == nil {
+		client = &nfs4Client{
+			id:         state._newClientID(),
+			name:       name,
+			verifier:   verifier,
+			openOwners: make(map[string]*openOwner),
+			lockOwners: make(map[string]*lockOwner),
+		}
+		state.clients[client.id] = client
+	}
+	client.renewed = time.Now()
+	_, _ = rand.Read(client.confirmVerf[:])
+	res.uint64(client.id)
+	res.fixed(client.confirmVerf[:])
+	return nfs4OK
+}
+
+func (c *compound) opSetClientIDConfirm(args *xdrReader, res *xdrWriter) nfs4Status {
+	id := args.uint64()
+	var verifier [8]byte
+	copy(verifier[:], args.fixed(8))
+	if args.err != nil {
+		return nfs4ErrBadXDR
+	}
+	state := c.srv.state
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	client, ok := state.clients[id]
+	if !ok || client.confirmVerf != verifier {
+		return nfs4ErrStaleClientID
+	}
+	if !client.confirmed {
+		// The client has rebooted so drop its old state
+		for _, old := range state.clients {
+			if old != client && old.name == client.name && old.minor == 0 {
+				state._removeClient(old)
+			}
+		}
+		client.confirmed = true
+		fs.Infof(nil, "NFSv4: client %q connected", client.name)
+	}
+	client.renewed = time.Now()
+	return nfs4OK
+}
+
+func (c *compound) opRenew(args *xdrReader, res *xdrWriter) nfs4Status {
+	id := args.uint64()
+	if args.err != nil {
+		return nfs4ErrBadXDR
+	}
+	state := c.srv.state
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	_, status := state._client(id)
+	return status
+}
+
+// Session operations for NFSv4.1
+
+func (c *compound) opExchangeID(args *xdrReader, res *xdrWriter) nfs4Status {
+	var verifier [8]byte
+	copy(verifier[:], args.fixed(8))
+	name := string(args.opaque(1024))
+	_ = args.uint32() // flags
+	protect := args.uint32()
+	if n := args.uint32(); n > 0 { // client implementation id
+		_ = args.string(1024) // domain
+		_ = args.string(1024) // name
+		_ = readTime(args)    // date
+	}
+	if args.err != nil {
+		return nfs4ErrBadXDR
+	}
+	if protect != sp4None {
+		return nfs4ErrNotSupp
+	}
+	state := c.srv.state
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	var client *nfs4Client
+	for _, old := range state.clients {
+		if old.name != name || old.minor == 0 {
+			continue
+		}
+		if old.verifier == verifier {
+			client = old
+		} else {
+			// The client has rebooted so drop its old state
+			state._removeClient(old)
+		}
+	}
+	if client == nil {
+		client = &nfs4Client{
+			id:         state._newClientID(),
+			name:       name,
+			verifier:   verifier,
+			minor:      c.minor,
+			sequence:   1,
+			openOwners: make(map[string]*openOwner),
+			lockOwners: make(map[string]*lockOwner),
+		}
+		state.clients[client.id] = client
+	}
+	client.renewed = time.Now()
+	flags := uint32(exchgID4FlagUseNonPNFS)
+	if client.confirmed {
+		flags |= exchgID4FlagConfirmedR
+	}
+	res.uint64(client.id)
+	res.uint32(client.sequence)
+	res.uint32(flags)
+	res.uint32(sp4None)
+	res.uint64(0)        // server owner minor id
+	res.string("rclone") // server owner major id
+	res.string("rclone") // server scope
+	res.uint32(0)        // no server implementation id
+	return nfs4OK
+}
+
+// channelAttrs is a channel_attrs4
+type channelAttrs struct {
+	headerPadSize         uint32
+	maxRequestSize        uint32
+	maxResponseSize       uint32
+	maxResponseSizeCached uint32
+	maxOperations         uint32
+	maxRequests           uint32
+}
+
+func readChannelAttrs(args *xdrReader) (attrs channelAttrs) {
+	attrs.headerPadSize = args.uint32()
+	attrs.maxRequestSize = args.uint32()
+	attrs.maxResponseSize = args.uint32()
+	attrs.maxResponseSizeCached = args.uint32()
+	attrs.maxOperations = args.uint32()
+	attrs.maxRequests = args.uint32()
+	if n := args.uint32(); n > 0 { // RDMA ird
+		_ = args.uint32()
+	}
+	return attrs
+}
+
+func writeChannelAttrs(res *xdrWriter, attrs channelAttrs) {
+	res.uint32(attrs.headerPadSize)
+	res.uint32(attrs.maxRequestSize)
+	res.uint32(attrs.maxResponseSize)
+	res.uint32(attrs.maxResponseSizeCached)
+	res.uint32(attrs.maxOperations)
+	res.uint32(attrs.maxRequests)
+	res.uint32(0) // no RDMA
+}
+
+func (c *compound) opCreateSession(args *xdrReader, res *xdrWriter) nfs4Status {
+	id := args.uint64()
+	sequence := args.uint32()
+	_ = args.uint32() // flags
+	fore := readChannelAttrs(args)
+	back := readChannelAttrs(args)
+	_ = args.uint32() // callback program
+	n := args.uint32()
+	for i := uint32(0); i < n && args.err == nil; i++ {
+		switch args.uint32() {
+		case authNone:
+		case authSys:
+			_ = args.uint32()    // stamp
+			_ = args.string(255) // machine name
+			_ = args.uint32()    // uid
+			_ = args.uint32()    // gid
+			_ = args.bitmap()    // gids
+		default:
+			args.err = errXDR
+		}
+	}
+	if args.err != nil {
+		return nfs4ErrBadXDR
+	}
+	state := c.srv.state
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	client, ok := state.clients[id]
+	if !ok || client.minor == 0 {
+		return nfs4ErrStaleClientID
+	}
+	if sequence != client.sequence {
+		return nfs4ErrSeqMisordered
+	}
+	client.sequence++
+	client.confirmed = true
+	client.renewed = time.Now()
+	fore.headerPadSize = 0
+	fore.maxRequestSize = min(fore.maxRequestSize, nfs4MaxRecord)
+	fore.maxResponseSize = min(fore.maxResponseSize, nfs4MaxRecord)
+	fore.maxResponseSizeCached = min(fore.maxResponseSizeCached, nfs4MaxRecord)
+	fore.maxOperations = min(fore.maxOperations, nfs4MaxOps)
+	fore.maxRequests = max(min(fore.maxRequests, nfs4MaxSlots), 1)
+	session := &nfs4Session{
+		client: client,
+		slots:  make([]nfs4Slot, fore.maxRequests),
+		attrs:  fore,
+	}
+	_, _ = rand.Read(session.id[:])
+	state.sessions[session.id] = session
+	fs.Infof(nil, "NFSv4: client %q connected", client.name)
+	res.fixed(session.id[:])
+	res.uint32(sequence)
+	res.uint32(0) // not persistent and no back channel
+	writeChannelAttrs(res, fore)
+	writeChannelAttrs(res, back)
+	return nfs4OK
+}
+
+// readSessionID reads a sessionid4
+func readSessionID(args *xdrReader) (id [16]byte) {
+	copy(id[:], args.fixed(16))
+	return id
+}
+
+func (c *compound) opSequence(args *xdrReader, res *xdrWriter) nfs4Status {
+	id := readSessionID(args)
+	seqid := args.uint32()
+	slotID := args.uint32()
+	_ = args.uint32() // highest slot id
+	cache := args.bool()
+	if args.err != nil {
+		return nfs4ErrBadXDR
+	}
+	state := c.srv.state
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	session, ok := state.sessions[id]
+	if !ok {
+		return nfs4ErrBadSession
+	}
+	if slotID >= uint32(len(session.slots)) {
+		return nfs4ErrBadSlot
+	}
+	slot := &session.slots[slotID]
+	switch seqid {
+	case slot.seqid + 1:
+	case slot.seqid:
+		if slot.reply == nil {
+			return nfs4ErrRetryUncachedRep
+		}
+		c.replay = slot.reply
+		return nfs4OK
+	default:
+		return nfs4ErrSeqMisordered
+	}
+	slot.seqid = seqid
+	session.client.renewed = time.Now()
+	c.session, c.slot, c.cache = session, slot, cache
+	highest := uint32(len(session.slots) - 1)
+	res.fixed(id[:])
+	res.uint32(seqid)
+	res.uint32(slotID)
+	res.uint32(highest)
+	res.uint32(highest)
+	res.uint32(0) // status flags
+	return nfs4OK
+}
+
+func (c *compound) opDestroySession(args *xdrReader, res *xdrWriter) nfs4Status {
+	id := readSessionID(args)
+	if args.err != nil {
+		return nfs4ErrBadXDR
+	}
+	state := c.srv.state
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if _, ok := state.sessions[id]; !ok {
+		return nfs4ErrBadSession
+	}
+	delete(state.sessions, id)
+	return nfs4OK
+}
+
+func (c *compound) opBindConnToSession(args *xdrReader, res *xdrWriter) nfs4Status {
+	id := readSessionID(args)
+	_ = args.uint32() // direction
+	_ = args.bool()   // RDMA mode
+	if args.err != nil {
+		return nfs4ErrBadXDR
+	}
+	state := c.srv.state
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if _, ok := state.sessions[id]; !ok {
+		return nfs4ErrBadSession
+	}
+	res.fixed(id[:])
+	res.uint32(cdfs4Fore)
+	res.bool(false)
+	return nfs4OK
+}
+
+func (c *compound) opDestroyClientID(args *xdrReader, res *xdrWriter) nfs4Status {
+	id := args.uint64()
+	if args.err != nil {
+		return nfs4ErrBadXDR
+	}
+	state := c.srv.state
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	client, ok := state.clients[id]
+	if !ok {
+		return nfs4ErrStaleClientID
+	}
+	for _, session := range state.sessions {
+		if session.client == client {
+			return nfs4ErrClientIDBusy
+		}
+	}
+	state._removeClient(client)
+	return nfs4OK
+}
+
+func (c *compound) opReclaimComplete(args *xdrReader, res *xdrWriter) nfs4Status {
+	_ = args.bool() // one filesystem
+	if args.err != nil {
+		return nfs4ErrBadXDR
+	}
+	// There is nothing to reclaim as state isn't kept over restarts
+	return nfs4OK
+}
+
+func (c *compound) opTestStateID(args *xdrReader, res *xdrWriter) nfs4Status {
+	n := args.uint32()
+	if args.err == nil && n > nfs4MaxOps {
+		return nfs4ErrResource
+	}
+	sids := make([]stateID, n)
+	for i := range sids {
+		sids[i] = readStateID(args)
+	}
+	if args.err != nil {
+		return nfs4ErrBadXDR
+	}
+	state := c.srv.state
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	res.uint32(n)
+	for _, sid := range sids {
+		_, status := state._state(sid)
+		res.uint32(uint32(status))
+	}
+	return nfs4OK
+}
+
+func (c *compound) opFreeStateID(args *xdrReader, res *xdrWriter) nfs4Status {
+	sid := c.stateIDArg(args)
+	if args.err != nil {
+		return nfs4ErrBadXDR
+	}
+	state := c.srv.state
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	st, status := state._state(sid)
+	if status != nfs4OK {
+		return status
+	}
+	lock, ok := st.(*lockState)
+	if !ok || state._holdsLocks(lock.owner) {
+		return nfs4ErrLocksHeld
+	}
+	state._removeLockState(lock)
+	return nfs4OK
+}
+
+// Open operations
+
+// checkSeqid checks an NFSv4.0 open owner sequence id, allowing
+// retransmissions of the last request.
+//
+// Call with the state lock held.
+func (c *compound) _checkSeqid(owner *openOwner, seqid uint32) nfs4Status {
+	if c.minor > 0 {
+		return nfs4OK
+	}
+	if owner.confirmed && seqid != owner.seqid && seqid != owner.seqid+1 {
+		return nfs4ErrBadSeqID
+	}
+	owner.seqid = seqid
+	owner.confirmed = true
+	return nfs4OK
+}
+
+// openFlags returns the flags to open a file with for access
+func (c *compound) openFlags(access uint32) int {
+	if access&open4ShareAccessWrite == 0 {
+		return os.O_RDONLY
+	}
+	// Without the cache files can only be opened for writing
+	// sequentially
+	if c.srv.h.vfs.Opt.CacheMode < vfscommon.CacheModeWrites {
+		return os.O_WRONLY
+	}
+	return os.O_RDWR
+}
+
+// openFile opens the file at path for access
+func (c *compound) openFile(path string, access uint32, flags int) (vfs.Handle, nfs4Status) {
+	file, err := c.srv.h.billyFS.OpenFile(path, c.openFlags(access)|flags, 0666)
+	if err != nil {
+		return nil, errorStatus(err)
+	}
+	return file.(vfs.Handle), nfs4OK
+}
+
+// checkWrite returns nfs4ErrLocked if path is exclusively locked in
+// the VFS, by WebDAV for example.
+//
+// The NFSv4 locks aren't seen by the other protocols so, like NFSv3,
+// writes are refused while the VFS lock manager has the file locked.
+func (c *compound) checkWrite(path string) nfs4Status {
+	return errorStatus(c.srv.h.vfs.Locks().CheckWrite(path))
+}
+
+// closeFile closes a file opened by openFile
+func closeFile(path string, file vfs.Handle) {
+	if file == nil {
+		return
+	}
+	if err := file.Close(); err != nil {
+		fs.Errorf(path, "NFSv4: failed to close file: %v", err)
+	}
+}
+
+func (c *compound) opOpen(args *xdrReader, res *xdrWriter) nfs4Status {
+	seqid := args.uint32()
+	access := args.uint32() & open4ShareAccessBoth // ignore NFSv4.1 delegation wants
+	deny := args.uint32()
+	clientid := args.uint64()
+	ownerName := string(args.opaque(1024))
+	create := args.uint32() == open4Create
+	var (
+		how     uint32
+		attrs   setAttrs
+		aStatus = nfs4OK
+	)
+	if create {
+		how = args.uint32()
+		switch how {
+		case createUnchecked, createGuarded:
+			attrs, aStatus = readSetAttrs(args)
+		case createExclusive:
+			_ = args.fixed(8) // verifier
+		case createExclusive41:
+			_ = args.fixed(8) // verifier
+			attrs, aStatus = readSetAttrs(args)
+		default:
+			return nfs4ErrInval
+		}
+	}
+	claim := args.uint32()
+	var name string
+	switch claim {
+	case claimNull:
+		name = args.string(nfs4MaxRecord)
+	case claimPrevious:
+		return nfs4ErrNoGrace
+	case claimFH:
+	default:
+		// delegations are never granted so can't be claimed
+		return nfs4ErrNotSupp
+	}
+	if args.err != nil {
+		return nfs4ErrBadXDR
+	}
+	if aStatus != nfs4OK {
+		return aStatus
+	}
+	if access == 0 || deny > open4ShareAccessBoth {
+		return nfs4ErrInval
+	}
+
+	// Find the file to open
+	var (
+		path    []string
+		dirPath []string
+		before  uint64
+	)
+	if claim == claimNull {
+		dir, status := c.dir()
+		if status != nfs4OK {
+			return status
+		}
+		if status := checkName(name); status != nfs4OK {
+			return status
+		}
+		dirPath = c.cur.path
+		path = c.cur.child(name)
+		before = c.srv.change(dir)
+	} else {
+		if _, status := c.file(); status != nfs4OK {
+			return status
+		}
+		if create {
+			return nfs4ErrInval
+		}
+		path = c.cur.path
+	}
+	fileName := joinPath(path)
+	node, err := c.srv.h.billyFS.Stat(fileName)
+	switch {
+	case err == nil:
+		if node.IsDir() {
+			return nfs4ErrIsDir
+		}
+		if node.Mode()&os.ModeSymlink != 0 {
+			return nfs4ErrSymlink
+		}
+		if create && how != createUnchecked {
+			return nfs4ErrExist
+		}
+	case errors.Is(err, vfs.ENOENT) && create:
+	default:
+		return errorStatus(err)
+	}
+
+	if access&open4ShareAccessWrite != 0 {
+		if status := c.checkWrite(fileName); status != nfs4OK {
+			return status
+		}
+	}
+
+	// Check the owner and share reservations
+	state := c.srv.state
+	state.mu.Lock()
+	client, status := c._client(clientid)
+	var owner *openOwner
+	if status == nfs4OK {
+		owner = client.openOwners[ownerName]
+		if owner == nil {
+			owner = &openOwner{client: client}
+			client.openOwners[ownerName] = owner
+		}
+		status = c._checkSeqid(owner, seqid)
+	}
+	if status == nfs4OK && state._shareConflict(fileName, owner, access, deny) {
+		status = nfs4ErrShareDenied
+	}
+	var open *openState
+	if status == nfs4OK {
+		for _, st := range state.states {
+			if o, ok := st.(*openState); ok && o.owner == owner && o.path == fileName {
+				open = o
+				break
+			}
+		}
+	}
+	state.mu.Unlock()
+	if status != nfs4OK {
+		return status
+	}
+
+	// Open the file if it isn't open already with enough access
+	var file vfs.Handle
+	flags := 0
+	if create {
+		flags |= os.O_CREATE
+	}
+	if open == nil || (access|open.access)&^open.access != 0 {
+		var allAccess = access
+		if open != nil {
+			allAccess |= open.access
+		}
+		file, status = c.openFile(fileName, allAccess, flags)
+		if status != nfs4OK {
+			return status
+		}
+	}
+	if create {
+		c.dirChanged(dirPath)
+	}
+	var attrSet []uint32
+	if create && attrs.mask != nil {
+		newNode, err := c.srv.h.billyFS.Stat(fileName)
+		if err == nil {
+			if status := c.setAttrs(newNode.(vfs.Node), file, attrs); status == nfs4OK {
+				attrSet = attrs.mask
+			}
+		}
+	}
+
+	// Record the open
+	var oldFile vfs.Handle
+	state.mu.Lock()
+	if open == nil {
+		open = &openState{
+			id:    state._newStateID(),
+			owner: owner,
+			path:  fileName,
+		}
+		state.states[open.id.other] = open
+	} else {
+		open.id.seqid++
+	}
+	if file != nil {
+		oldFile, open.file = open.file, file
+	}
+	open.access |= access
+	open.deny |= deny
+	sid := open.id
+	state.mu.Unlock()
+	closeFile(fileName, oldFile)
+
+	writeStateID(res, sid)
+	if claim == claimNull {
+		c.changeInfo(res, before, dirPath)
+	} else {
+		res.bool(false)
+		res.uint64(0)
+		res.uint64(0)
+	}
+	res.uint32(open4ResultPosixLocks)
+	res.bitmap(attrSet)
+	res.uint32(openDelegateNone) // delegations are disabled
+	c.setCur(path)
+	c.stateID = sid
+	return nfs4OK
+}
+
+func (c *compound) opOpenConfirm(args *xdrReader, res *xdrWriter) nfs4Status {
+	sid := c.stateIDArg(args)
+	seqid := args.uint32()
+	if args.err != nil {
+		return nfs4ErrBadXDR
+	}
+	state := c.srv.state
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	open, status := state._openState(sid)
+	if status != nfs4OK {
+		return status
+	}
+	if status := c._checkSeqid(open.owner, seqid); status != nfs4OK {
+		return status
+	}
+	open.id.seqid++
+	writeStateID(res, open.id)
+	return nfs4OK
+}
+
+func (c *compound) opOpenDowngrade(args *xdrReader, res *xdrWriter) nfs4Status {
+	sid := c.stateIDArg(args)
+	seqid := args.uint32()
+	access := args.uint32() & open4ShareAccessBoth
+	deny := args.uint32()
+	if args.err != nil {
+		return nfs4ErrBadXDR
+	}
+	state := c.srv.state
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	open, status := state._openState(sid)
+	if status != nfs4OK {
+		return status
+	}
+	if status := c._checkSeqid(open.owner, seqid); status != nfs4OK {
+		return status
+	}
+	if access == 0 || access&^open.access != 0 || deny&^open.deny != 0 {
+		return nfs4ErrInval
+	}
+	open.access, open.deny = access, deny
+	open.id.seqid++
+	writeStateID(res, open.id)
+	c.stateID = open.id
+	return nfs4OK
+}
+
+func (c *compound) opClose(args *xdrReader, res *xdrWriter) nfs4Status {
+	seqid := args.uint32()
+	sid := c.stateIDArg(args)
+	if args.err != nil {
+		return nfs4ErrBadXDR
+	}
+	state := c.srv.state
+	state.mu.Lock()
+	open, status := state._openState(sid)
+	if status == nfs4OK {
+		status = c._checkSeqid(open.owner, seqid)
+	}
+	var file vfs.Handle
+	if status == nfs4OK {
+		file = state._closeOpen(open)
+	}
+	state.mu.Unlock()
+	if status != nfs4OK {
+		return status
+	}
+	closeFile(open.path, file)
+	if c.minor > 0 {
+		writeStateID(res, invalidStateID)
+	} else {
+		sid = open.id
+		sid.seqid++
+		writeStateID(res, sid)
+	}
+	return nfs4OK
+}
+
+func (c *compound) opDelegReturn(args *xdrReader, res *xdrWriter) nfs4Status {
+	_ = c.stateIDArg(args)
+	if args.err != nil {
+		return nfs4ErrBadXDR
+	}
+	// delegations are never granted
+	return nfs4ErrBadStateID
+}
+
+// Read and write operations
+
+func (c *compound) opRead(args *xdrReader, res *xdrWriter) nfs4Status {
+	sid := c.stateIDArg(args)
+	offset := args.uint64()
+	count := args.uint32()
+	if args.err != nil {
+		return nfs4ErrBadXDR
+	}
+	node, status := c.file()
+	if status != nfs4OK {
+		return status
+	}
+	state := c.srv.state
+	state.mu.Lock()
+	open, status := state._fileFor(sid, false)
+	var file vfs.Handle
+	if open != nil && c.openFlags(open.access) != os.O_WRONLY {
+		file = open.file
+	}
+	state.mu.Unlock()
+	if status != nfs4OK {
+		return status
+	}
+	if file == nil {
+		file, status = c.openFile(c.cur.name(), open4ShareAccessRead, 0)
+		if status != nfs4OK {
+			return status
+		}
+		defer closeFile(c.cur.name(), file)
+	}
+	buf := make([]byte, min(count, nfs4MaxIO))
+	n, err := 0, error(nil)
+	if offset < math.MaxInt64 && len(buf) > 0 {
+		n, err = file.ReadAt(buf, int64(offset))
+	}
+	if err != nil && err != io.EOF {
+		return errorStatus(err)
+	}
+	eof := err == io.EOF || offset+uint64(n) >= uint64(max(node.Size(), 0))
+	res.bool(eof)
+	res.opaque(buf[:n])
+	return nfs4OK
+}
+
+func (c *compound) opWrite(args *xdrReader, res *xdrWriter) nfs4Status {
+	sid := c.stateIDArg(args)
+	offset := args.uint64()
+	_ = args.uint32() // stable - all writes are FILE_SYNC to the VFS
+	data := args.opaque(nfs4MaxIO)
+	if args.err != nil {
+		return nfs4ErrBadXDR
+	}
+	if _, status := c.file(); status != nfs4OK {
+		return status
+	}
+	if offset > math.MaxInt64-uint64(len(data)) {
+		return nfs4ErrInval
+	}
+	state := c.srv.state
+	state.mu.Lock()
+	open, status := state._fileFor(sid, true)
+	var file vfs.Handle
+	if open != nil {
+		file = open.file
+	}
+	state.mu.Unlock()
+	if status != nfs4OK {
+		return status
+	}
+	if file == nil {
+		file, status = c.openFile(c.cur.name(), open4ShareAccessWrite, 0)
+		if status != nfs4OK {
+			return status
+		}
+		defer closeFile(c.cur.name(), file)
+	}
+	if status := c.checkWrite(c.cur.name()); status != nfs4OK {
+		return status
+	}
+	n, err := file.WriteAt(data, int64(offset))
+	if err != nil {
+		return errorStatus(err)
+	}
+	c.srv.state.changed(c.cur.name())
+	res.uint32(uint32(n))
+	res.uint32(fileSync)
+	res.fixed(c.srv.state.verifier[:])
+	return nfs4OK
+}
+
+func (c *compound) opCommit(args *xdrReader, res *xdrWriter) nfs4Status {
+	_ = args.uint64() // offset
+	_ = args.uint32() // count
+	if args.err != nil {
+		return nfs4ErrBadXDR
+	}
+	if _, status := c.file(); status != nfs4OK {
+		return status
+	}
+	res.fixed(c.srv.state.verifier[:])
+	return nfs4OK
+}
+
+// Lock operations
+
+// lockRange checks offset and length and returns the range they cover
+func lockRange(offset, length uint64) (start, end uint64, status nfs4Status) {
+	switch {
+	case length == 0:
+		return 0, 0, nfs4ErrInval
+	case length == math.MaxUint64:
+		return offset, math.MaxUint64, nfs4OK
+	case offset > math.MaxUint64-length:
+		return 0, 0, nfs4ErrInval
+	}
+	return offset, offset + length, nfs4OK
+}
+
+// writeDenied writes a LOCK4denied for the conflicting lock r
+func writeDenied(res *xdrWriter, r *byteRange) {
+	res.uint64(r.start)
+	if r.end == math.MaxUint64 {
+		res.uint64(math.MaxUint64)
+	} else {
+		res.uint64(r.end - r.start)
+	}
+	if r.write {
+		res.uint32(writeLT)
+	} else {
+		res.uint32(readLT)
+	}
+	res.uint64(r.owner.client.id)
+	res.opaque(r.owner.owner)
+}
+
+// isWriteLock returns whether the lock type is for a write lock
+func isWriteLock(lockType uint32) bool {
+	return lockType == writeLT || lockType == writeWLT
+}
+
+func (c *compound) opLock(args *xdrReader, res *xdrWriter) nfs4Status {
+	lockType := args.uint32()
+	reclaim := args.bool()
+	offset := args.uint64()
+	length := args.uint64()
+	newOwner := args.bool()
+	var (
+		openSeqid uint32
+		sid       stateID
+		clientid  uint64
+		ownerName []byte
+	)
+	if newOwner {
+		openSeqid = args.uint32()
+		sid = c.stateIDArg(args)
+		_ = args.uint32() // lock seqid
+		clientid = args.uint64()
+		ownerName = args.opaque(1024)
+	} else {
+		sid = c.stateIDArg(args)
+		_ = args.uint32() // lock seqid
+	}
+	if args.err != nil {
+		return nfs4ErrBadXDR
+	}
+	if lockType < readLT || lockType > writeWLT {
+		return nfs4ErrInval
+	}
+	if reclaim {
+		return nfs4ErrNoGrace
+	}
+	start, end, status := lockRange(offset, length)
+	if status != nfs4OK {
+		return status
+	}
+	if _, status := c.file(); status != nfs4OK {
+		return status
+	}
+	if isWriteLock(lockType) {
+		if status := c.checkWrite(c.cur.name()); status != nfs4OK {
+			return status
+		}
+	}
+	state := c.srv.state
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	// Find or make the lock state
+	var lock *lockState
+	if newOwner {
+		open, status := state._openState(sid)
+		if status != nfs4OK {
+			return status
+		}
+		if status := c._checkSeqid(open.owner, openSeqid); status != nfs4OK {
+			return status
+		}
+		if c.minor == 0 && clientid != open.owner.client.id {
+			return nfs4ErrStaleClientID
+		}
+		client := open.owner.client
+		owner := client.lockOwners[string(ownerName)]
+		if owner == nil {
+			owner = &lockOwner{client: client, owner: slices.Clone(ownerName)}
+			client.lockOwners[string(ownerName)] = owner
+		}
+		for _, l := range open.locks {
+			if l.owner == owner {
+				lock = l
+				break
+			}
+		}
+		if lock == nil {
+			lock = &lockState{
+				id:    state._newStateID(),
+				owner: owner,
+				open:  open,
+			}
+			lock.id.seqid = 0 // incremented below
+			open.locks = append(open.locks, lock)
+			state.states[lock.id.other] = lock
+		}
+	} else {
+		st, status := state._state(sid)
+		if status != nfs4OK {
+			return status
+		}
+		var ok bool
+		lock, ok = st.(*lockState)
+		if !ok {
+			return nfs4ErrBadStateID
+		}
+	}
+	write := isWriteLock(lockType)
+	if write && lock.open.access&open4ShareAccessWrite == 0 {
+		return nfs4ErrOpenMode
+	}
+	if r := state._conflict(lock.open.path, lock.owner, start, end, write); r != nil {
+		writeDenied(res, r)
+		return nfs4ErrDenied
+	}
+	state._lock(lock.open.path, lock.owner, start, end, write)
+	lock.id.seqid++
+	writeStateID(res, lock.id)
+	c.stateID = lock.id
+	return nfs4OK
+}
+
+func (c *compound) opLockT(args *xdrReader, res *xdrWriter) nfs4Status {
+	lockType := args.uint32()
+	offset := args.uint64()
+	length := args.uint64()
+	clientid := args.uint64()
+	ownerName := args.opaque(1024)
+	if args.err != nil {
+		return nfs4ErrBadXDR
+	}
+	if lockType < readLT || lockType > writeWLT {
+		return nfs4ErrInval
+	}
+	start, end, status := lockRange(offset, length)
+	if status != nfs4OK {
+		return status
+	}
+	if _, status := c.file(); status != nfs4OK {
+		return status
+	}
+	state := c.srv.state
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	client, status := c._client(clientid)
+	if status != nfs4OK {
+		return status
+	}
+	owner := client.lockOwners[string(ownerName)] // nil if not known
+	if r := state._conflict(c.cur.name(), owner, start, end, isWriteLock(lockType)); r != nil {
+		writeDenied(res, r)
+		return nfs4ErrDenied
+	}
+	return nfs4OK
+}
+
+func (c *compound) opLockU(args *xdrReader, res *xdrWriter) nfs4Status {
+	_ = args.uint32() // lock type
+	_ = args.uint32() // seqid
+	sid := c.stateIDArg(args)
+	offset := args.uint64()
+	length := args.uint64()
+	if args.err != nil {
+		return nfs4ErrBadXDR
+	}
+	start, end, status := lockRange(offset, length)
+	if status != nfs4OK {
+		return status
+	}
+	state := c.srv.state
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	st, status := state._state(sid)
+	if status != nfs4OK {
+		return status
+	}
+	lock, ok := st.(*lockState)
+	if !ok {
+		return nfs4ErrBadStateID
+	}
+	state._unlock(lock.open.path, lock.owner, start, end)
+	lock.id.seqid++
+	writeStateID(res, lock.id)
+	c.stateID = lock.id
+	return nfs4OK
+}
+
+func (c *compound) opReleaseLockOwner(args *xdrReader, res *xdrWriter) nfs4Status {
+	clientid := args.uint64()
+	ownerName := args.opaque(1024)
+	if args.err != nil {
+		return nfs4ErrBadXDR
+	}
+	state := c.srv.state
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	client, status := state._client(clientid)
+	if status != nfs4OK {
+		return status
+	}
+	owner := client.lockOwners[string(ownerName)]
+	if owner == nil {
+		return nfs4OK
+	}
+	if state._holdsLocks(owner) {
+		return nfs4ErrLocksHeld
+	}
+	for _, st := range state.states {
+		if lock, ok := st.(*lockState); ok && lock.owner == owner {
+			state._removeLockState(lock)
+		}
+	}
+	delete(client.lockOwners, string(ownerName))
+	return nfs4OK
+}
+
+// joinPath returns the VFS path of the path components
+func joinPath(path []string) string {
+	return fileHandle{path: path}.name()
+}
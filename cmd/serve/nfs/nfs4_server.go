@@ -0,0 +1,556 @@
+//go:build unix
+
+package nfs
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/vfs"
+	nfs "github.com/willscott/go-nfs"
+)
+
+// nfs4Server serves NFSv4.0 and NFSv4.1 using the same handle cache
+// and VFS as the NFSv3 server.
+type nfs4Server struct {
+	h     *Handler
+	state *nfs4State
+	root  []byte // handle of the root
+}
+
+func newNFS4Server(h *Handler) *nfs4Server {
+	return &nfs4Server{
+		h:     h,
+		state: newNFS4State(),
+		root:  h.ToHandle(h.billyFS, []string{}),
+	}
+}
+
+// serveConn serves NFSv4 RPC requests on conn reading them from in
+func (srv *nfs4Server) serveConn(ctx context.Context, conn net.Conn, in *bufio.Reader) {
+	defer func() {
+		_ = conn.Close()
+	}()
+	remote := conn.RemoteAddr().String()
+	fs.Debugf(nil, "NFSv4: connection from %s", remote)
+	for {
+		request, err := readRecord(in)
+		if err != nil {
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+				fs.Errorf(nil, "NFSv4: failed to read request from %s: %v", remote, err)
+			}
+			return
+		}
+		reply := srv.handleCall(ctx, request)
+		if reply == nil {
+			continue
+		}
+		err = writeRecord(conn, reply)
+		if err != nil {
+			fs.Errorf(nil, "NFSv4: failed to write reply to %s: %v", remote, err)
+			return
+		}
+	}
+}
+
+// readRecord reads an RPC record made of one or more fragments
+func readRecord(in io.Reader) (record []byte, err error) {
+	var header [4]byte
+	for {
+		_, err = io.ReadFull(in, header[:])
+		if err != nil {
+			return nil, err
+		}
+		mark := binary.BigEndian.Uint32(header[:])
+		size := int(mark &^ (1 << 31))
+		if len(record)+size > nfs4MaxRecord {
+			return nil, fmt.Errorf("RPC record too large: %d bytes", len(record)+size)
+		}
+		start := len(record)
+		record = slices.Grow(record, size)[:start+size]
+		_, err = io.ReadFull(in, record[start:])
+		if err != nil {
+			return nil, err
+		}
+		if mark&(1<<31) != 0 {
+			return record, nil
+		}
+	}
+}
+
+// writeRecord writes an RPC record as a single fragment
+func writeRecord(out io.Writer, record []byte) error {
+	buf := make([]byte, 4, 4+len(record))
+	binary.BigEndian.PutUint32(buf, uint32(len(record))|1<<31)
+	_, err := out.Write(append(buf, record...))
+	return err
+}
+
+// handleCall decodes the RPC call in request and returns the reply
+//
+// It returns nil if the request isn't a call.
+func (srv *nfs4Server) handleCall(ctx context.Context, request []byte) []byte {
+	args := newXDRReader(request)
+	xid := args.uint32()
+	if args.uint32() != rpcCall || args.err != nil {
+		return nil
+	}
+	rpcvers := args.uint32()
+	prog := args.uint32()
+	vers := args.uint32()
+	proc := args.uint32()
+	credFlavor := args.uint32()
+	_ = args.opaque(400)
+	_ = args.uint32() // verifier flavor
+	_ = args.opaque(400)
+	reply := &xdrWriter{}
+	reply.uint32(xid)
+	reply.uint32(rpcReply)
+	if args.err != nil {
+		return nil
+	}
+	if rpcvers != rpcVersion {
+		reply.uint32(rpcMsgDenied)
+		reply.uint32(rpcMismatch)
+		reply.uint32(rpcVersion)
+		reply.uint32(rpcVersion)
+		return reply.Bytes()
+	}
+	if credFlavor != authNone && credFlavor != authSys {
+		reply.uint32(rpcMsgDenied)
+		reply.uint32(rpcAuthError)
+		reply.uint32(authBadCred)
+		return reply.Bytes()
+	}
+	reply.uint32(rpcMsgAccepted)
+	reply.uint32(authNone) // verifier
+	reply.uint32(0)
+	switch {
+	case prog != nfsProgram:
+		reply.uint32(rpcProgUnavail)
+	case vers != nfsV4:
+		reply.uint32(rpcProgMismatch)
+		reply.uint32(nfsV4)
+		reply.uint32(nfsV4)
+	case proc == nfs4ProcNull:
+		reply.uint32(rpcSuccess)
+	case proc == nfs4ProcCompound:
+		res, err := srv.compound(ctx, args)
+		if err != nil {
+			fs.Debugf(nil, "NFSv4: bad COMPOUND: %v", err)
+			reply.uint32(rpcGarbageArgs)
+			break
+		}
+		reply.uint32(rpcSuccess)
+		reply.Write(res)
+	default:
+		reply.uint32(rpcProcUnavail)
+	}
+	return reply.Bytes()
+}
+
+// fileHandle is a file handle with the path it refers to
+type fileHandle struct {
+	handle []byte   // nil if not set
+	path   []string // path components
+}
+
+// name returns the path in the VFS
+func (fh fileHandle) name() string {
+	return strings.Join(fh.path, "/")
+}
+
+// child returns the path of leaf in the directory fh
+func (fh fileHandle) child(leaf string) []string {
+	return append(slices.Clip(fh.path), leaf)
+}
+
+// compound is the context for the operations in a COMPOUND request
+type compound struct {
+	ctx     context.Context
+	srv     *nfs4Server
+	minor   uint32
+	index   int // index of the current operation
+	cur     fileHandle
+	saved   fileHandle
+	stateID stateID // NFSv4.1 current stateid
+	session *nfs4Session
+	slot    *nfs4Slot
+	cache   bool   // set if the reply should be cached in slot
+	replay  []byte // set to a cached reply to return instead
+}
+
+// nfs4Op describes a COMPOUND operation
+type nfs4Op struct {
+	name     string
+	minMinor uint32 // the minor versions the operation is in
+	maxMinor uint32
+	fn       func(c *compound, args *xdrReader, res *xdrWriter) nfs4Status
+}
+
+// compound runs the COMPOUND request in args and returns the reply
+func (srv *nfs4Server) compound(ctx context.Context, args *xdrReader) (reply []byte, err error) {
+	tag := args.opaque(1024)
+	minor := args.uint32()
+	n := args.uint32()
+	if args.err != nil {
+		return nil, args.err
+	}
+	c := &compound{
+		ctx:   ctx,
+		srv:   srv,
+		minor: minor,
+	}
+	var (
+		status  = nfs4OK
+		results xdrWriter
+		count   uint32
+	)
+	switch {
+	case minor > nfs4MaxMinorVers:
+		status = nfs4ErrMinorVersMismatch
+	case n > nfs4MaxOps && minor == 0:
+		status = nfs4ErrResource
+	case n > nfs4MaxOps:
+		status = nfs4ErrTooManyOps
+	}
+	for c.index = 0; status == nfs4OK && c.index < int(n); c.index++ {
+		opcode := args.uint32()
+		if args.err != nil {
+			return nil, args.err
+		}
+		op, ok := nfs4Ops[opcode]
+		if !ok || minor < op.minMinor || minor > op.maxMinor {
+			opcode, status = opIllegal, nfs4ErrOpIllegal
+		} else {
+			status = c.checkSession(opcode)
+		}
+		var res xdrWriter
+		if status == nfs4OK {
+			status = op.fn(c, args, &res)
+			if args.err != nil {
+				status = nfs4ErrBadXDR
+				res.Reset()
+			}
+			fs.Debugf(c.cur.name(), "NFSv4: %s: status %d", op.name, status)
+		}
+		if c.replay != nil {
+			return c.replay, nil
+		}
+		results.uint32(opcode)
+		results.uint32(uint32(status))
+		results.Write(res.Bytes())
+		count++
+	}
+	var out xdrWriter
+	out.uint32(uint32(status))
+	out.opaque(tag)
+	out.uint32(count)
+	out.Write(results.Bytes())
+	reply = out.Bytes()
+	if c.slot != nil {
+		srv.state.mu.Lock()
+		if c.cache {
+			c.slot.reply = reply
+		} else {
+			c.slot.reply = nil
+		}
+		srv.state.mu.Unlock()
+	}
+	return reply, nil
+}
+
+// checkSession checks NFSv4.1 requests start with SEQUENCE
+func (c *compound) checkSession(opcode uint32) nfs4Status {
+	if c.minor == 0 {
+		return nfs4OK
+	}
+	if c.index == 0 {
+		switch opcode {
+		case opSequence, opExchangeID, opCreateSession, opDestroySession, opDestroyClientID, opBindConnToSession:
+			return nfs4OK
+		}
+		return nfs4ErrOpNotInSession
+	}
+	if opcode == opSequence {
+		return nfs4ErrSequencePos
+	}
+	return nfs4OK
+}
+
+// client returns the client for clientid
+//
+// In NFSv4.1 this is the client of the session.
+//
+// Call with the state lock held.
+func (c *compound) _client(clientid uint64) (*nfs4Client, nfs4Status) {
+	if c.session != nil {
+		return c.session.client, nfs4OK
+	}
+	return c.srv.state._client(clientid)
+}
+
+// stateIDArg reads a stateid, replacing the NFSv4.1 current stateid
+func (c *compound) stateIDArg(args *xdrReader) (sid stateID) {
+	sid = readStateID(args)
+	if c.minor > 0 && sid == currentStateID {
+		sid = c.stateID
+	}
+	return sid
+}
+
+// readStateID reads a stateid4
+func readStateID(args *xdrReader) (sid stateID) {
+	sid.seqid = args.uint32()
+	copy(sid.other[:], args.fixed(12))
+	return sid
+}
+
+// writeStateID writes a stateid4
+func writeStateID(res *xdrWriter, sid stateID) {
+	res.uint32(sid.seqid)
+	res.fixed(sid.other[:])
+}
+
+// needFH returns an error status if there is no current file handle
+func (c *compound) needFH() nfs4Status {
+	if c.cur.handle == nil {
+		return nfs4ErrNoFileHandle
+	}
+	return nfs4OK
+}
+
+// node returns the VFS node for fh
+func (c *compound) node(fh fileHandle) (vfs.Node, nfs4Status) {
+	fi, err := c.srv.h.billyFS.Stat(fh.name())
+	if err != nil {
+		if errors.Is(err, vfs.ENOENT) {
+			return nil, nfs4ErrStale
+		}
+		return nil, errorStatus(err)
+	}
+	return fi.(vfs.Node), nfs4OK
+}
+
+// dir returns the current file handle's node checking it is a directory
+func (c *compound) dir() (vfs.Node, nfs4Status) {
+	if status := c.needFH(); status != nfs4OK {
+		return nil, status
+	}
+	node, status := c.node(c.cur)
+	if status != nfs4OK {
+		return nil, status
+	}
+	if !node.IsDir() {
+		if node.Mode()&os.ModeSymlink != 0 {
+			return nil, nfs4ErrSymlink
+		}
+		return nil, nfs4ErrNotDir
+	}
+	return node, nfs4OK
+}
+
+// file returns the current file handle's node checking it is a file
+func (c *compound) file() (vfs.Node, nfs4Status) {
+	if status := c.needFH(); status != nfs4OK {
+		return nil, status
+	}
+	node, status := c.node(c.cur)
+	if status != nfs4OK {
+		return nil, status
+	}
+	if node.IsDir() {
+		return nil, nfs4ErrIsDir
+	}
+	if node.Mode()&os.ModeSymlink != 0 {
+		return nil, nfs4ErrSymlink
+	}
+	return node, nfs4OK
+}
+
+// setCur sets the current file handle to path
+func (c *compound) setCur(path []string) {
+	c.cur = fileHandle{
+		handle: c.srv.h.ToHandle(c.srv.h.billyFS, path),
+		path:   path,
+	}
+}
+
+// checkName checks a component4 is valid
+func checkName(name string) nfs4Status {
+	switch {
+	case name == "":
+		return nfs4ErrInval
+	case len(name) > nfs4MaxName:
+		return nfs4ErrNameTooLong
+	case name == "." || name == ".." || strings.ContainsAny(name, "/\x00"):
+		return nfs4ErrBadName
+	}
+	return nfs4OK
+}
+
+// errorStatus converts an error from the VFS into a status
+func errorStatus(err error) nfs4Status {
+	var vfsErr vfs.Error
+	switch {
+	case err == nil:
+		return nfs4OK
+	case errors.Is(err, vfs.ENOENT):
+		return nfs4ErrNoEnt
+	case errors.Is(err, vfs.EEXIST):
+		return nfs4ErrExist
+	case errors.Is(err, vfs.EPERM):
+		return nfs4ErrPerm
+	case errors.Is(err, vfs.EINVAL):
+		return nfs4ErrInval
+	case errors.As(err, &vfsErr):
+		switch vfsErr {
+		case vfs.ENOTEMPTY:
+			return nfs4ErrNotEmpty
+		case vfs.EROFS:
+			return nfs4ErrROFS
+		case vfs.ENOSPC:
+			return nfs4ErrNoSpc
+		case vfs.ENOSYS, vfs.ENOTSUP:
+			return nfs4ErrNotSupp
+		case vfs.EAGAIN:
+			return nfs4ErrLocked
+		case vfs.EBADF:
+			return nfs4ErrOpenMode
+		}
+	}
+	fs.Debugf(nil, "NFSv4: mapping error %v to NFS4ERR_IO", err)
+	return nfs4ErrIO
+}
+
+// connListener is a net.Listener which is fed connections from a
+// channel so the NFSv3 server can serve the connections which aren't
+// NFSv4.
+type connListener struct {
+	addr   net.Addr
+	conns  chan net.Conn
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newConnListener(addr net.Addr) *connListener {
+	return &connListener{
+		addr:   addr,
+		conns:  make(chan net.Conn),
+		closed: make(chan struct{}),
+	}
+}
+
+// Accept waits for and returns the next connection to the listener.
+func (l *connListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+// push passes conn to the listener's Accept
+func (l *connListener) push(conn net.Conn) {
+	select {
+	case l.conns <- conn:
+	case <-l.closed:
+		_ = conn.Close()
+	}
+}
+
+// Close closes the listener.
+func (l *connListener) Close() error {
+	l.once.Do(func() {
+		close(l.closed)
+	})
+	return nil
+}
+
+// Addr returns the listener's network address.
+func (l *connListener) Addr() net.Addr {
+	return l.addr
+}
+
+// bufferedConn is a net.Conn which reads through a bufio.Reader
+// which may have data buffered already
+type bufferedConn struct {
+	net.Conn
+	in *bufio.Reader
+}
+
+// Read reads from the buffer then the connection
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.in.Read(p)
+}
+
+// sniffTimeout is how long to wait for the first request on a new
+// connection
+const sniffTimeout = time.Minute
+
+// dispatch looks at the first RPC call on conn and passes it to the
+// NFSv4 server if it is for NFSv4 or to the NFSv3 server otherwise.
+func (s *Server) dispatch(conn net.Conn) {
+	in := bufio.NewReaderSize(conn, 64*1024)
+	_ = conn.SetReadDeadline(time.Now().Add(sniffTimeout))
+	// record mark, xid, message type, rpc version, program, version
+	header, err := in.Peek(24)
+	_ = conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		fs.Debugf(nil, "NFS: closing connection from %s: %v", conn.RemoteAddr(), err)
+		_ = conn.Close()
+		return
+	}
+	prog := binary.BigEndian.Uint32(header[16:])
+	vers := binary.BigEndian.Uint32(header[20:])
+	if prog == nfsProgram && vers == nfsV4 {
+		s.v4.serveConn(s.ctx, conn, in)
+		return
+	}
+	s.v3.push(&bufferedConn{Conn: conn, in: in})
+}
+
+// serveV4 serves NFSv4 and NFSv3 on the same listener
+func (s *Server) serveV4() error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- nfs.Serve(s.v3, s.handler)
+	}()
+	go s.expireLeases()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			_ = s.v3.Close()
+			<-errs
+			return err
+		}
+		go s.dispatch(conn)
+	}
+}
+
+// expireLeases removes NFSv4 clients which have gone away until the
+// server is shut down
+func (s *Server) expireLeases() {
+	ticker := time.NewTicker(nfs4LeaseSeconds * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			s.v4.state.expire(now)
+		case <-s.v3.closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,403 @@
+//go:build unix
+
+package nfs
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/vfs"
+)
+
+// NFSv4 is a stateful protocol. The server keeps track of the
+// clients, the files they have open and the byte range locks they
+// hold. This is all kept in memory so it is lost if the server is
+// restarted, in which case the clients get stale state errors and
+// open their files again.
+
+// stateID is a stateid4 identifying an open file or a set of locks
+type stateID struct {
+	seqid uint32
+	other [12]byte
+}
+
+// Special stateids
+var (
+	anonStateID    = stateID{}                      // all zeros - no state
+	bypassStateID  = stateID{seqid: math.MaxUint32} // all ones - READ bypass
+	currentStateID = stateID{seqid: 1}              // NFSv4.1 current stateid
+	invalidStateID = stateID{seqid: math.MaxUint32} // NFSv4.1 invalid stateid
+)
+
+func init() {
+	for i := range bypassStateID.other {
+		bypassStateID.other[i] = 0xFF
+	}
+}
+
+// special returns true if the stateid is one of the anonymous ones
+func (sid stateID) special() bool {
+	return sid == anonStateID || sid == bypassStateID
+}
+
+// nfs4Client is a client which has done SETCLIENTID or EXCHANGE_ID
+type nfs4Client struct {
+	id          uint64
+	name        string  // the client supplied identifier
+	verifier    [8]byte // changes when the client reboots
+	confirmVerf [8]byte // SETCLIENTID_CONFIRM verifier
+	confirmed   bool
+	minor       uint32 // minor version in use
+	sequence    uint32 // NFSv4.1 CREATE_SESSION sequence
+	renewed     time.Time
+	openOwners  map[string]*openOwner
+	lockOwners  map[string]*lockOwner
+}
+
+// openOwner is an open_owner4 - usually a process on the client
+type openOwner struct {
+	client    *nfs4Client
+	seqid     uint32
+	confirmed bool
+}
+
+// lockOwner is a lock_owner4
+type lockOwner struct {
+	client *nfs4Client
+	owner  []byte
+}
+
+// openState is a file opened by an open owner
+type openState struct {
+	id     stateID
+	owner  *openOwner
+	path   string // path in the VFS
+	access uint32 // OPEN4_SHARE_ACCESS_*
+	deny   uint32 // OPEN4_SHARE_DENY_*
+	file   vfs.Handle
+	locks  []*lockState
+}
+
+// lockState is the locks a lock owner holds on an open file
+type lockState struct {
+	id    stateID
+	owner *lockOwner
+	open  *openState
+}
+
+// byteRange is a byte range lock on a file
+type byteRange struct {
+	owner *lockOwner
+	start uint64 // first byte locked
+	end   uint64 // byte after the last byte locked or MaxUint64 for EOF
+	write bool
+}
+
+// overlaps returns true if the ranges overlap
+func (r *byteRange) overlaps(start, end uint64) bool {
+	return r.start < end && start < r.end
+}
+
+// nfs4Slot is an NFSv4.1 session slot with its cached reply
+type nfs4Slot struct {
+	seqid uint32
+	reply []byte
+}
+
+// nfs4Session is an NFSv4.1 session
+type nfs4Session struct {
+	id     [16]byte
+	client *nfs4Client
+	slots  []nfs4Slot
+	attrs  channelAttrs
+}
+
+// nfs4State is the state of all the NFSv4 clients
+type nfs4State struct {
+	mu       sync.Mutex
+	boot     uint32  // identifies this server instance in ids
+	verifier [8]byte // write and cookie verifier
+	nextID   uint64
+	clients  map[uint64]*nfs4Client
+	sessions map[[16]byte]*nfs4Session
+	states   map[[12]byte]any // *openState or *lockState
+	locks    map[string][]*byteRange
+	changes  map[string]uint64 // change counters for modified paths
+}
+
+func newNFS4State() *nfs4State {
+	s := &nfs4State{
+		boot:     uint32(time.Now().Unix()),
+		clients:  make(map[uint64]*nfs4Client),
+		sessions: make(map[[16]byte]*nfs4Session),
+		states:   make(map[[12]byte]any),
+		locks:    make(map[string][]*byteRange),
+		changes:  make(map[string]uint64),
+	}
+	_, _ = rand.Read(s.verifier[:])
+	return s
+}
+
+// _newClientID returns a new client ID
+//
+// Call with the lock held.
+func (s *nfs4State) _newClientID() uint64 {
+	s.nextID++
+	return uint64(s.boot)<<32 | s.nextID&math.MaxUint32
+}
+
+// _newStateID returns a new stateid
+//
+// Call with the lock held.
+func (s *nfs4State) _newStateID() (sid stateID) {
+	s.nextID++
+	sid.seqid = 1
+	binary.BigEndian.PutUint32(sid.other[:4], s.boot)
+	binary.BigEndian.PutUint64(sid.other[4:], s.nextID)
+	return sid
+}
+
+// _client finds the client with id
+//
+// Call with the lock held.
+func (s *nfs4State) _client(id uint64) (*nfs4Client, nfs4Status) {
+	c, ok := s.clients[id]
+	if !ok || (!c.confirmed && c.minor == 0) {
+		return nil, nfs4ErrStaleClientID
+	}
+	c.renewed = time.Now()
+	return c, nfs4OK
+}
+
+// _state finds the state for sid which must be a *openState or a
+// *lockState
+//
+// Call with the lock held.
+func (s *nfs4State) _state(sid stateID) (any, nfs4Status) {
+	if binary.BigEndian.Uint32(sid.other[:4]) != s.boot {
+		return nil, nfs4ErrStaleStateID
+	}
+	state, ok := s.states[sid.other]
+	if !ok {
+		return nil, nfs4ErrBadStateID
+	}
+	var current stateID
+	switch st := state.(type) {
+	case *openState:
+		current = st.id
+		st.owner.client.renewed = time.Now()
+	case *lockState:
+		current = st.id
+		st.owner.client.renewed = time.Now()
+	}
+	// A seqid of 0 means the current seqid in NFSv4.1
+	switch {
+	case sid.seqid == 0 || sid.seqid == current.seqid:
+		return state, nfs4OK
+	case sid.seqid < current.seqid:
+		return nil, nfs4ErrOldStateID
+	default:
+		return nil, nfs4ErrBadStateID
+	}
+}
+
+// _openState finds the open state for sid
+//
+// Call with the lock held.
+func (s *nfs4State) _openState(sid stateID) (*openState, nfs4Status) {
+	state, status := s._state(sid)
+	if status != nfs4OK {
+		return nil, status
+	}
+	open, ok := state.(*openState)
+	if !ok {
+		return nil, nfs4ErrBadStateID
+	}
+	return open, nfs4OK
+}
+
+// _fileFor returns the open state for a READ, WRITE or SETATTR with
+// sid which may be an open or a lock stateid
+//
+// It returns a nil open state if sid is special in which case the
+// caller should open the file itself.
+//
+// Call with the lock held.
+func (s *nfs4State) _fileFor(sid stateID, write bool) (*openState, nfs4Status) {
+	if sid.special() {
+		return nil, nfs4OK
+	}
+	state, status := s._state(sid)
+	if status != nfs4OK {
+		return nil, status
+	}
+	var open *openState
+	switch st := state.(type) {
+	case *openState:
+		open = st
+	case *lockState:
+		open = st.open
+	}
+	if write && open.access&open4ShareAccessWrite == 0 {
+		return nil, nfs4ErrOpenMode
+	}
+	return open, nfs4OK
+}
+
+// _shareConflict returns true if an open of path with access and deny
+// conflicts with opens by other owners
+//
+// Call with the lock held.
+func (s *nfs4State) _shareConflict(path string, owner *openOwner, access, deny uint32) bool {
+	for _, state := range s.states {
+		open, ok := state.(*openState)
+		if !ok || open.path != path || open.owner == owner {
+			continue
+		}
+		if access&open.deny != 0 || deny&open.access != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// _closeOpen removes the open state and its locks returning the
+// file for the caller to close
+//
+// Call with the lock held.
+func (s *nfs4State) _closeOpen(open *openState) vfs.Handle {
+	for _, lock := range open.locks {
+		s._unlock(open.path, lock.owner, 0, math.MaxUint64)
+		delete(s.states, lock.id.other)
+	}
+	delete(s.states, open.id.other)
+	return open.file
+}
+
+// _conflict returns the first lock by another owner on path which
+// conflicts with a lock from start to end
+//
+// Call with the lock held.
+func (s *nfs4State) _conflict(path string, owner *lockOwner, start, end uint64, write bool) *byteRange {
+	for _, r := range s.locks[path] {
+		if r.owner != owner && (write || r.write) && r.overlaps(start, end) {
+			return r
+		}
+	}
+	return nil
+}
+
+// _unlock removes the part of owner's locks on path from start to
+// end, splitting locks if necessary
+//
+// Call with the lock held.
+func (s *nfs4State) _unlock(path string, owner *lockOwner, start, end uint64) {
+	var ranges []*byteRange
+	for _, r := range s.locks[path] {
+		if r.owner != owner || !r.overlaps(start, end) {
+			ranges = append(ranges, r)
+			continue
+		}
+		if r.start < start {
+			ranges = append(ranges, &byteRange{owner: owner, start: r.start, end: start, write: r.write})
+		}
+		if end < r.end {
+			ranges = append(ranges, &byteRange{owner: owner, start: end, end: r.end, write: r.write})
+		}
+	}
+	if len(ranges) == 0 {
+		delete(s.locks, path)
+	} else {
+		s.locks[path] = ranges
+	}
+}
+
+// _lock adds a lock for owner on path from start to end replacing
+// any locks owner already has in that range
+//
+// Call with the lock held.
+func (s *nfs4State) _lock(path string, owner *lockOwner, start, end uint64, write bool) {
+	s._unlock(path, owner, start, end)
+	s.locks[path] = append(s.locks[path], &byteRange{owner: owner, start: start, end: end, write: write})
+}
+
+// _holdsLocks returns true if owner holds any locks
+//
+// Call with the lock held.
+func (s *nfs4State) _holdsLocks(owner *lockOwner) bool {
+	for _, ranges := range s.locks {
+		for _, r := range ranges {
+			if r.owner == owner {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// _removeClient removes the client and all its state
+//
+// Call with the lock held.
+func (s *nfs4State) _removeClient(c *nfs4Client) {
+	for _, state := range s.states {
+		if open, ok := state.(*openState); ok && open.owner.client == c {
+			closeFile(open.path, s._closeOpen(open))
+		}
+	}
+	for id, session := range s.sessions {
+		if session.client == c {
+			delete(s.sessions, id)
+		}
+	}
+	delete(s.clients, c.id)
+}
+
+// expire removes the clients which haven't renewed their leases
+func (s *nfs4State) expire(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.clients {
+		// Allow a lease period of grace before removing the client
+		if now.Sub(c.renewed) > 2*nfs4LeaseSeconds*time.Second {
+			fs.Infof(nil, "NFSv4: lease expired for client %q", c.name)
+			s._removeClient(c)
+		}
+	}
+}
+
+// shutdown closes all the open files
+func (s *nfs4State) shutdown() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.clients {
+		s._removeClient(c)
+	}
+}
+
+// changed bumps the change attribute of path
+func (s *nfs4State) changed(path string) {
+	s.mu.Lock()
+	s.changes[path]++
+	s.mu.Unlock()
+}
+
+// change returns the number of changes made to path
+func (s *nfs4State) change(path string) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.changes[path]
+}
+
+// _removeLockState removes the lock state from its open
+//
+// Call with the lock held.
+func (s *nfs4State) _removeLockState(lock *lockState) {
+	s._unlock(lock.open.path, lock.owner, 0, math.MaxUint64)
+	lock.open.locks = slices.DeleteFunc(lock.open.locks, func(l *lockState) bool { return l == lock })
+	delete(s.states, lock.id.other)
+}
@@ -0,0 +1,636 @@
+//go:build unix
+
+package nfs
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config"
+	"github.com/rclone/rclone/vfs"
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testClient is a minimal NFSv4 client
+type testClient struct {
+	t     *testing.T
+	conn  net.Conn
+	xid   uint32
+	minor uint32
+}
+
+func newTestClient(t *testing.T, addr string, minor uint32) *testClient {
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return &testClient{t: t, conn: conn, minor: minor}
+}
+
+// rpc calls proc in prog and version vers returning the reply after
+// the accept status
+func (tc *testClient) rpc(prog, vers, proc uint32, args []byte) (acceptStat uint32, reply *xdrReader) {
+	t := tc.t
+	tc.xid++
+	var w xdrWriter
+	w.uint32(tc.xid)
+	w.uint32(rpcCall)
+	w.uint32(rpcVersion)
+	w.uint32(prog)
+	w.uint32(vers)
+	w.uint32(proc)
+	w.uint32(authSys)
+	var cred xdrWriter
+	cred.uint32(0)      // stamp
+	cred.string("test") // machine name
+	cred.uint32(0)      // uid
+	cred.uint32(0)      // gid
+	cred.uint32(0)      // gids
+	w.opaque(cred.Bytes())
+	w.uint32(authNone)
+	w.uint32(0)
+	w.Write(args)
+	require.NoError(t, writeRecord(tc.conn, w.Bytes()))
+	require.NoError(t, tc.conn.SetReadDeadline(time.Now().Add(10*time.Second)))
+	record, err := readRecord(tc.conn)
+	require.NoError(t, err)
+	r := newXDRReader(record)
+	require.Equal(t, tc.xid, r.uint32())
+	require.Equal(t, uint32(rpcReply), r.uint32())
+	require.Equal(t, uint32(rpcMsgAccepted), r.uint32())
+	_ = r.uint32() // verifier
+	_ = r.opaque(400)
+	acceptStat = r.uint32()
+	require.NoError(t, r.err)
+	return acceptStat, r
+}
+
+// testOp is an operation in a COMPOUND
+type testOp struct {
+	code uint32
+	args func(w *xdrWriter)
+}
+
+// compoundRaw sends the ops returning the raw reply
+func (tc *testClient) compoundRaw(ops ...testOp) []byte {
+	var w xdrWriter
+	w.string("test")
+	w.uint32(tc.minor)
+	w.uint32(uint32(len(ops)))
+	for _, op := range ops {
+		w.uint32(op.code)
+		if op.args != nil {
+			op.args(&w)
+		}
+	}
+	acceptStat, r := tc.rpc(nfsProgram, nfsV4, nfs4ProcCompound, w.Bytes())
+	require.Equal(tc.t, uint32(rpcSuccess), acceptStat)
+	return r.buf
+}
+
+// testReply is a COMPOUND reply
+type testReply struct {
+	*xdrReader
+	t      *testing.T
+	status nfs4Status
+}
+
+// compound sends the ops returning the reply positioned at the
+// first result
+func (tc *testClient) compound(ops ...testOp) *testReply {
+	r := &testReply{xdrReader: newXDRReader(tc.compoundRaw(ops...)), t: tc.t}
+	r.status = nfs4Status(r.uint32())
+	assert.Equal(tc.t, "test", r.string(1024))
+	_ = r.uint32() // number of results
+	return r
+}
+
+// next reads the opcode and status of the next result
+func (r *testReply) next(opcode uint32) nfs4Status {
+	require.Equal(r.t, opcode, r.uint32())
+	status := nfs4Status(r.uint32())
+	require.NoError(r.t, r.err)
+	return status
+}
+
+// ok reads the next result checking it succeeded
+func (r *testReply) ok(opcode uint32) {
+	require.Equal(r.t, nfs4OK, r.next(opcode), "opcode %d", opcode)
+}
+
+// skipChangeInfo skips a change_info4
+func (r *testReply) skipChangeInfo() {
+	_ = r.bool()
+	_ = r.uint64()
+	_ = r.uint64()
+}
+
+// Helpers to make operations
+func putRootFH() testOp { return testOp{code: opPutRootFH} }
+func getFH() testOp     { return testOp{code: opGetFH} }
+func saveFH() testOp    { return testOp{code: opSaveFH} }
+
+func putFH(fh []byte) testOp {
+	return testOp{opPutFH, func(w *xdrWriter) { w.opaque(fh) }}
+}
+
+func lookup(name string) testOp {
+	return testOp{opLookup, func(w *xdrWriter) { w.string(name) }}
+}
+
+func getattr(bits ...int) testOp {
+	return testOp{opGetattr, func(w *xdrWriter) { w.bitmap(makeBitmap(bits...)) }}
+}
+
+func remove(name string) testOp {
+	return testOp{opRemove, func(w *xdrWriter) { w.string(name) }}
+}
+
+func rename(oldName, newName string) testOp {
+	return testOp{opRename, func(w *xdrWriter) { w.string(oldName); w.string(newName) }}
+}
+
+func mkdir(name string) testOp {
+	return testOp{opCreate, func(w *xdrWriter) {
+		w.uint32(nf4Dir)
+		w.string(name)
+		w.bitmap(nil)
+		w.opaque(nil)
+	}}
+}
+
+func open(clientid uint64, owner string, seqid uint32, access uint32, name string, create bool) testOp {
+	return testOp{opOpen, func(w *xdrWriter) {
+		w.uint32(seqid)
+		w.uint32(access)
+		w.uint32(0) // deny
+		w.uint64(clientid)
+		w.string(owner)
+		if create {
+			w.uint32(open4Create)
+			w.uint32(createUnchecked)
+			w.bitmap(makeBitmap(attrSize))
+			var size xdrWriter
+			size.uint64(0)
+			w.opaque(size.Bytes())
+		} else {
+			w.uint32(open4NoCreate)
+		}
+		w.uint32(claimNull)
+		w.string(name)
+	}}
+}
+
+func closeFH(seqid uint32, sid stateID) testOp {
+	return testOp{opClose, func(w *xdrWriter) { w.uint32(seqid); writeStateID(w, sid) }}
+}
+
+func write(sid stateID, offset uint64, data string) testOp {
+	return testOp{opWrite, func(w *xdrWriter) {
+		writeStateID(w, sid)
+		w.uint64(offset)
+		w.uint32(fileSync)
+		w.string(data)
+	}}
+}
+
+func read(sid stateID, offset uint64, count uint32) testOp {
+	return testOp{opRead, func(w *xdrWriter) {
+		writeStateID(w, sid)
+		w.uint64(offset)
+		w.uint32(count)
+	}}
+}
+
+func lockNew(lockType uint32, offset, length uint64, openSeqid uint32, openSid stateID, clientid uint64, owner string) testOp {
+	return testOp{opLock, func(w *xdrWriter) {
+		w.uint32(lockType)
+		w.bool(false) // reclaim
+		w.uint64(offset)
+		w.uint64(length)
+		w.bool(true) // new lock owner
+		w.uint32(openSeqid)
+		writeStateID(w, openSid)
+		w.uint32(0) // lock seqid
+		w.uint64(clientid)
+		w.string(owner)
+	}}
+}
+
+func lockT(lockType uint32, offset, length uint64, clientid uint64, owner string) testOp {
+	return testOp{opLockT, func(w *xdrWriter) {
+		w.uint32(lockType)
+		w.uint64(offset)
+		w.uint64(length)
+		w.uint64(clientid)
+		w.string(owner)
+	}}
+}
+
+func lockU(sid stateID, offset, length uint64) testOp {
+	return testOp{opLockU, func(w *xdrWriter) {
+		w.uint32(writeLT)
+		w.uint32(0) // seqid
+		writeStateID(w, sid)
+		w.uint64(offset)
+		w.uint64(length)
+	}}
+}
+
+// setClientID does SETCLIENTID and SETCLIENTID_CONFIRM
+func (tc *testClient) setClientID(name string) uint64 {
+	r := tc.compound(testOp{opSetClientID, func(w *xdrWriter) {
+		w.fixed([]byte("verifier"))
+		w.string(name)
+		w.uint32(0x40000000)
+		w.string("tcp")
+		w.string("127.0.0.1.0.0")
+		w.uint32(1)
+	}})
+	r.ok(opSetClientID)
+	clientid := r.uint64()
+	verifier := r.fixed(8)
+	r = tc.compound(testOp{opSetClientIDConfirm, func(w *xdrWriter) {
+		w.uint64(clientid)
+		w.fixed(verifier)
+	}})
+	r.ok(opSetClientIDConfirm)
+	return clientid
+}
+
+// openFile opens name returning the file handle and stateid
+func (tc *testClient) openFile(clientid uint64, owner string, seqid uint32, access uint32, name string, create bool) ([]byte, stateID) {
+	r := tc.compound(putRootFH(), open(clientid, owner, seqid, access, name, create), getFH())
+	r.ok(opPutRootFH)
+	r.ok(opOpen)
+	sid := readStateID(r.xdrReader)
+	r.skipChangeInfo()
+	assert.Equal(tc.t, uint32(open4ResultPosixLocks), r.uint32())
+	_ = r.bitmap()
+	assert.Equal(tc.t, uint32(openDelegateNone), r.uint32(), "delegations must be disabled")
+	r.ok(opGetFH)
+	return r.opaque(nfs4FHSize), sid
+}
+
+// newTestServer starts an NFS server with NFSv4 enabled on a local
+// directory
+func newTestServer(t *testing.T) (VFS *vfs.VFS, addr string) {
+	oldCacheDir := config.GetCacheDir()
+	require.NoError(t, config.SetCacheDir(t.TempDir()))
+	ctx := context.Background()
+	f, err := fs.NewFs(ctx, t.TempDir())
+	require.NoError(t, err)
+	vfsOpt := vfscommon.Opt
+	vfsOpt.CacheMode = vfscommon.CacheModeFull
+	VFS = vfs.New(f, &vfsOpt)
+	opt := Opt
+	opt.NFSv4 = true
+	s, err := NewServer(ctx, VFS, &opt)
+	require.NoError(t, err)
+	go func() {
+		_ = s.Serve()
+	}()
+	t.Cleanup(func() {
+		assert.NoError(t, s.Shutdown())
+		VFS.Shutdown()
+		VFS.CleanUp()
+		_ = config.SetCacheDir(oldCacheDir)
+	})
+	return VFS, s.Addr().String()
+}
+
+func TestNFSv4(t *testing.T) {
+	VFS, addr := newTestServer(t)
+
+	t.Run("Null", func(t *testing.T) {
+		tc := newTestClient(t, addr, 0)
+		acceptStat, _ := tc.rpc(nfsProgram, nfsV4, nfs4ProcNull, nil)
+		assert.Equal(t, uint32(rpcSuccess), acceptStat)
+	})
+
+	t.Run("NFSv3", func(t *testing.T) {
+		// NFSv3 connections are passed to the NFSv3 server
+		tc := newTestClient(t, addr, 0)
+		acceptStat, _ := tc.rpc(nfsProgram, 3, 0, nil)
+		assert.Equal(t, uint32(rpcSuccess), acceptStat)
+	})
+
+	t.Run("MinorVersion", func(t *testing.T) {
+		tc := newTestClient(t, addr, 2)
+		r := tc.compound(putRootFH())
+		assert.Equal(t, nfs4ErrMinorVersMismatch, r.status)
+	})
+
+	t.Run("V4.0", func(t *testing.T) {
+		tc := newTestClient(t, addr, 0)
+		clientid := tc.setClientID("client-4.0")
+
+		// Root attributes
+		r := tc.compound(putRootFH(), getattr(attrType, attrFileHandle, attrLeaseTime, attrTimeModifySet))
+		r.ok(opPutRootFH)
+		r.ok(opGetattr)
+		assert.Equal(t, makeBitmap(attrType, attrFileHandle, attrLeaseTime), r.bitmap())
+		attrs := newXDRReader(r.opaque(1024))
+		assert.Equal(t, uint32(nf4Dir), attrs.uint32())
+		assert.Equal(t, uint32(nfs4LeaseSeconds), attrs.uint32())
+		assert.NotEmpty(t, attrs.opaque(nfs4FHSize))
+
+		// Create and write a file
+		fh, sid := tc.openFile(clientid, "owner1", 1, open4ShareAccessBoth, "file.txt", true)
+		r = tc.compound(putFH(fh), write(sid, 0, "hello world"))
+		r.ok(opPutFH)
+		r.ok(opWrite)
+		assert.Equal(t, uint32(11), r.uint32())
+		r = tc.compound(putFH(fh), read(sid, 6, 100))
+		r.ok(opPutFH)
+		r.ok(opRead)
+		assert.True(t, r.bool())
+		assert.Equal(t, "world", r.string(100))
+
+		// Byte range locks
+		_, sid2 := tc.openFile(clientid, "owner2", 1, open4ShareAccessBoth, "file.txt", false)
+		r = tc.compound(putFH(fh), lockNew(writeLT, 0, 5, 2, sid, clientid, "locker1"))
+		r.ok(opPutFH)
+		r.ok(opLock)
+		lockSid := readStateID(r.xdrReader)
+		r = tc.compound(putFH(fh), lockNew(readLT, 4, 10, 2, sid2, clientid, "locker2"))
+		r.ok(opPutFH)
+		require.Equal(t, nfs4ErrDenied, r.next(opLock))
+		assert.Equal(t, uint64(0), r.uint64())
+		assert.Equal(t, uint64(5), r.uint64())
+		assert.Equal(t, uint32(writeLT), r.uint32())
+		assert.Equal(t, clientid, r.uint64())
+		assert.Equal(t, "locker1", r.string(1024))
+		r = tc.compound(putFH(fh), lockT(readLT, 5, 10, clientid, "locker2"))
+		r.ok(opPutFH)
+		r.ok(opLockT)
+		r = tc.compound(putFH(fh), lockT(readLT, 0, 1, clientid, "locker2"))
+		r.ok(opPutFH)
+		assert.Equal(t, nfs4ErrDenied, r.next(opLockT))
+		r = tc.compound(putFH(fh), lockU(lockSid, 0, math64))
+		r.ok(opPutFH)
+		r.ok(opLockU)
+		r = tc.compound(putFH(fh), lockNew(readLT, 4, 10, 3, sid2, clientid, "locker2"))
+		r.ok(opPutFH)
+		r.ok(opLock)
+
+		// Close the files
+		r = tc.compound(putFH(fh), closeFH(4, sid2))
+		r.ok(opPutFH)
+		r.ok(opClose)
+		r = tc.compound(putFH(fh), closeFH(3, sid))
+		r.ok(opPutFH)
+		r.ok(opClose)
+		data, err := VFS.ReadFile("file.txt")
+		require.NoError(t, err)
+		assert.Equal(t, "hello world", string(data))
+
+		// Stale stateids are rejected
+		r = tc.compound(putFH(fh), read(sid, 0, 100))
+		r.ok(opPutFH)
+		assert.Equal(t, nfs4ErrBadStateID, r.next(opRead))
+
+		// Reads with the anonymous stateid
+		r = tc.compound(putRootFH(), lookup("file.txt"), read(anonStateID, 0, 5), getattr(attrSize))
+		r.ok(opPutRootFH)
+		r.ok(opLookup)
+		r.ok(opRead)
+		_ = r.bool()
+		assert.Equal(t, "hello", r.string(100))
+		r.ok(opGetattr)
+		_ = r.bitmap()
+		assert.Equal(t, uint64(11), newXDRReader(r.opaque(100)).uint64())
+
+		// Directories, renames and removes
+		r = tc.compound(putRootFH(), mkdir("dir"), getFH())
+		r.ok(opPutRootFH)
+		r.ok(opCreate)
+		r.skipChangeInfo()
+		_ = r.bitmap()
+		r.ok(opGetFH)
+		dirFH := r.opaque(nfs4FHSize)
+		r = tc.compound(putRootFH(), saveFH(), putFH(dirFH), rename("file.txt", "moved.txt"))
+		r.ok(opPutRootFH)
+		r.ok(opSaveFH)
+		r.ok(opPutFH)
+		r.ok(opRename)
+		_, err = VFS.Stat("dir/moved.txt")
+		require.NoError(t, err)
+		r = tc.compound(putRootFH(), lookup("file.txt"))
+		r.ok(opPutRootFH)
+		assert.Equal(t, nfs4ErrNoEnt, r.next(opLookup))
+		r = tc.compound(putRootFH(), remove("dir"))
+		r.ok(opPutRootFH)
+		assert.Equal(t, nfs4ErrNotEmpty, r.next(opRemove))
+		r = tc.compound(putFH(dirFH), remove("moved.txt"), testOp{code: opLookupP}, remove("dir"))
+		r.ok(opPutFH)
+		r.ok(opRemove)
+		r.skipChangeInfo()
+		r.ok(opLookupP)
+		r.ok(opRemove)
+		_, err = VFS.Stat("dir")
+		assert.Equal(t, vfs.ENOENT, err)
+
+		// Processing stops at the first error
+		r = tc.compound(putRootFH(), lookup("potato"), getFH())
+		assert.Equal(t, nfs4ErrNoEnt, r.status)
+		r.ok(opPutRootFH)
+		assert.Equal(t, nfs4ErrNoEnt, r.next(opLookup))
+		assert.Empty(t, r.buf)
+
+		// NFSv4.1 operations aren't allowed
+		r = tc.compound(testOp{code: opSequence})
+		assert.Equal(t, nfs4ErrOpIllegal, r.next(opIllegal))
+	})
+
+	t.Run("ReadDir", func(t *testing.T) {
+		require.NoError(t, VFS.WriteFile("a.txt", []byte("a"), 0666))
+		require.NoError(t, VFS.WriteFile("b.txt", []byte("bb"), 0666))
+		tc := newTestClient(t, addr, 0)
+		readDir := func(cookie uint64, maxCount uint32) *testReply {
+			return tc.compound(putRootFH(), testOp{opReadDir, func(w *xdrWriter) {
+				w.uint64(cookie)
+				w.fixed(make([]byte, 8))
+				w.uint32(maxCount)
+				w.uint32(maxCount)
+				w.bitmap(makeBitmap(attrSize))
+			}})
+		}
+		var (
+			names  []string
+			cookie uint64
+		)
+		for {
+			r := readDir(cookie, 100)
+			r.ok(opPutRootFH)
+			r.ok(opReadDir)
+			_ = r.fixed(8)
+			for r.bool() {
+				cookie = r.uint64()
+				names = append(names, r.string(1024))
+				_ = r.bitmap()
+				_ = r.opaque(1024)
+			}
+			if r.bool() {
+				break
+			}
+		}
+		assert.Equal(t, []string{"a.txt", "b.txt"}, names)
+		r := readDir(0, 10)
+		r.ok(opPutRootFH)
+		assert.Equal(t, nfs4ErrTooSmall, r.next(opReadDir))
+	})
+
+	t.Run("VFSLocks", func(t *testing.T) {
+		tc := newTestClient(t, addr, 0)
+		clientid := tc.setClientID("client-vfs-locks")
+		fh, sid := tc.openFile(clientid, "owner1", 1, open4ShareAccessBoth, "locked.txt", true)
+
+		// Lock the file like WebDAV does
+		lock, err := VFS.Locks().Lock("locked.txt", "webdav", true, false, -1)
+		require.NoError(t, err)
+
+		r := tc.compound(putFH(fh), write(sid, 0, "hello"))
+		r.ok(opPutFH)
+		assert.Equal(t, nfs4ErrLocked, r.next(opWrite))
+		r = tc.compound(putFH(fh), lockNew(writeLT, 0, 5, 2, sid, clientid, "locker1"))
+		r.ok(opPutFH)
+		assert.Equal(t, nfs4ErrLocked, r.next(opLock))
+		r = tc.compound(putRootFH(), open(clientid, "owner2", 1, open4ShareAccessWrite, "locked.txt", false))
+		r.ok(opPutRootFH)
+		assert.Equal(t, nfs4ErrLocked, r.next(opOpen))
+		r = tc.compound(putRootFH(), remove("locked.txt"))
+		r.ok(opPutRootFH)
+		assert.Equal(t, nfs4ErrLocked, r.next(opRemove))
+
+		// Reading is still allowed
+		_, _ = tc.openFile(clientid, "owner3", 1, open4ShareAccessRead, "locked.txt", false)
+
+		require.NoError(t, VFS.Locks().Unlock(lock.Token))
+		r = tc.compound(putFH(fh), write(sid, 0, "hello"))
+		r.ok(opPutFH)
+		r.ok(opWrite)
+	})
+
+	t.Run("V4.1", func(t *testing.T) {
+		tc := newTestClient(t, addr, 1)
+
+		// Requests need a session
+		r := tc.compound(putRootFH())
+		assert.Equal(t, nfs4ErrOpNotInSession, r.next(opPutRootFH))
+
+		r = tc.compound(testOp{opExchangeID, func(w *xdrWriter) {
+			w.fixed([]byte("verifier"))
+			w.string("client-4.1")
+			w.uint32(0)
+			w.uint32(sp4None)
+			w.uint32(0)
+		}})
+		r.ok(opExchangeID)
+		clientid := r.uint64()
+		sequence := r.uint32()
+		r = tc.compound(testOp{opCreateSession, func(w *xdrWriter) {
+			w.uint64(clientid)
+			w.uint32(sequence)
+			w.uint32(0)
+			for range 2 {
+				writeChannelAttrs(w, channelAttrs{
+					maxRequestSize:        1 << 20,
+					maxResponseSize:       1 << 20,
+					maxResponseSizeCached: 4096,
+					maxOperations:         16,
+					maxRequests:           4,
+				})
+			}
+			w.uint32(0x40000000)
+			w.uint32(1)
+			w.uint32(authNone)
+		}})
+		r.ok(opCreateSession)
+		sessionID := r.fixed(16)
+		_ = r.uint32()
+		assert.Equal(t, uint32(0), r.uint32(), "no back channel")
+		fore := readChannelAttrs(r.xdrReader)
+		assert.Equal(t, uint32(4), fore.maxRequests)
+
+		sequenceOp := func(seqid, slot uint32) testOp {
+			return testOp{opSequence, func(w *xdrWriter) {
+				w.fixed(sessionID)
+				w.uint32(seqid)
+				w.uint32(slot)
+				w.uint32(slot)
+				w.bool(true)
+			}}
+		}
+		reclaim := testOp{opReclaimComplete, func(w *xdrWriter) { w.bool(false) }}
+		r = tc.compound(sequenceOp(1, 0), reclaim)
+		r.ok(opSequence)
+		_ = r.fixed(16)
+		r = tc.compound(sequenceOp(2, 0), putRootFH(), getattr(attrSuppAttrExclCreat))
+		assert.Equal(t, nfs4OK, r.status)
+
+		// Replays return the cached reply
+		first := tc.compoundRaw(sequenceOp(1, 1), putRootFH(), getFH())
+		assert.Equal(t, first, tc.compoundRaw(sequenceOp(1, 1), putRootFH(), getFH()))
+		r = tc.compound(sequenceOp(3, 1))
+		assert.Equal(t, nfs4ErrSeqMisordered, r.next(opSequence))
+		r = tc.compound(sequenceOp(1, 4))
+		assert.Equal(t, nfs4ErrBadSlot, r.next(opSequence))
+
+		// Open with the session's client and close it
+		r = tc.compound(sequenceOp(2, 1), putRootFH(), open(0, "owner", 0, open4ShareAccessWrite, "new.txt", true),
+			write(currentStateID, 0, "v4.1"), closeFH(0, currentStateID))
+		assert.Equal(t, nfs4OK, r.status)
+		data, err := VFS.ReadFile("new.txt")
+		require.NoError(t, err)
+		assert.Equal(t, "v4.1", string(data))
+
+		// SETCLIENTID is NFSv4.0 only
+		r = tc.compound(sequenceOp(3, 1), testOp{code: opSetClientID})
+		r.ok(opSequence)
+		_ = r.fixed(16)
+		_ = r.fixed(20)
+		assert.Equal(t, nfs4ErrOpIllegal, r.next(opIllegal))
+
+		r = tc.compound(testOp{opDestroySession, func(w *xdrWriter) { w.fixed(sessionID) }})
+		r.ok(opDestroySession)
+		r = tc.compound(sequenceOp(4, 1))
+		assert.Equal(t, nfs4ErrBadSession, r.next(opSequence))
+	})
+}
+
+// math64 is a lock length meaning to the end of the file
+const math64 = ^uint64(0)
+
+func TestByteRangeLocks(t *testing.T) {
+	s := newNFS4State()
+	a := &lockOwner{}
+	b := &lockOwner{}
+	s._lock("file", a, 0, 100, true)
+	assert.NotNil(t, s._conflict("file", b, 50, 60, false))
+	assert.Nil(t, s._conflict("file", a, 50, 60, true))
+	assert.Nil(t, s._conflict("file", b, 100, 200, true))
+	assert.Nil(t, s._conflict("other", b, 0, 200, true))
+
+	// Unlocking the middle splits the lock
+	s._unlock("file", a, 40, 60)
+	assert.Nil(t, s._conflict("file", b, 40, 60, true))
+	assert.NotNil(t, s._conflict("file", b, 30, 41, false))
+	assert.NotNil(t, s._conflict("file", b, 59, 61, false))
+	assert.Len(t, s.locks["file"], 2)
+
+	// Read locks are shared and replace write locks
+	s._lock("file", a, 0, math64, false)
+	assert.Len(t, s.locks["file"], 1)
+	assert.Nil(t, s._conflict("file", b, 1000, 2000, false))
+	assert.NotNil(t, s._conflict("file", b, 1000, 2000, true))
+	assert.True(t, s._holdsLocks(a))
+	assert.False(t, s._holdsLocks(b))
+	s._unlock("file", a, 0, math64)
+	assert.Empty(t, s.locks)
+}
@@ -0,0 +1,153 @@
+//go:build unix
+
+package nfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// errXDR is returned when a request can't be decoded
+var errXDR = errors.New("bad XDR in request")
+
+// xdrReader decodes XDR from a buffer
+//
+// The first error is remembered and after that all reads return zero
+// values so the caller only needs to check err once it is done.
+type xdrReader struct {
+	buf []byte
+	err error
+}
+
+// newXDRReader makes a reader for buf
+func newXDRReader(buf []byte) *xdrReader {
+	return &xdrReader{buf: buf}
+}
+
+// take returns the next n bytes
+func (r *xdrReader) take(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.buf) {
+		r.err = errXDR
+		r.buf = nil
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+// pad rounds n up to a multiple of 4
+func pad(n int) int {
+	return (n + 3) &^ 3
+}
+
+func (r *xdrReader) uint32() uint32 {
+	b := r.take(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (r *xdrReader) uint64() uint64 {
+	b := r.take(8)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+func (r *xdrReader) bool() bool {
+	return r.uint32() != 0
+}
+
+// fixed reads fixed length opaque data
+func (r *xdrReader) fixed(n int) []byte {
+	b := r.take(pad(n))
+	if b == nil {
+		return nil
+	}
+	return b[:n]
+}
+
+// opaque reads variable length opaque data of at most max bytes
+func (r *xdrReader) opaque(max int) []byte {
+	n := r.uint32()
+	if r.err == nil && n > uint32(max) {
+		r.err = errXDR
+	}
+	return r.fixed(int(n))
+}
+
+func (r *xdrReader) string(max int) string {
+	return string(r.opaque(max))
+}
+
+// bitmap reads a bitmap4
+func (r *xdrReader) bitmap() []uint32 {
+	n := r.uint32()
+	if r.err == nil && int(n)*4 > len(r.buf) {
+		r.err = errXDR
+	}
+	if r.err != nil {
+		return nil
+	}
+	words := make([]uint32, n)
+	for i := range words {
+		words[i] = r.uint32()
+	}
+	return words
+}
+
+// xdrWriter encodes XDR into a buffer
+type xdrWriter struct {
+	bytes.Buffer
+}
+
+func (w *xdrWriter) uint32(x uint32) {
+	_ = binary.Write(&w.Buffer, binary.BigEndian, x)
+}
+
+func (w *xdrWriter) uint64(x uint64) {
+	_ = binary.Write(&w.Buffer, binary.BigEndian, x)
+}
+
+func (w *xdrWriter) bool(x bool) {
+	if x {
+		w.uint32(1)
+	} else {
+		w.uint32(0)
+	}
+}
+
+// fixed writes fixed length opaque data
+func (w *xdrWriter) fixed(b []byte) {
+	w.Write(b)
+	var zeros [3]byte
+	w.Write(zeros[:pad(len(b))-len(b)])
+}
+
+// opaque writes variable length opaque data
+func (w *xdrWriter) opaque(b []byte) {
+	w.uint32(uint32(len(b)))
+	w.fixed(b)
+}
+
+func (w *xdrWriter) string(s string) {
+	w.opaque([]byte(s))
+}
+
+// bitmap writes a bitmap4 dropping trailing zero words
+func (w *xdrWriter) bitmap(words []uint32) {
+	for len(words) > 0 && words[len(words)-1] == 0 {
+		words = words[:len(words)-1]
+	}
+	w.uint32(uint32(len(words)))
+	for _, word := range words {
+		w.uint32(word)
+	}
+}
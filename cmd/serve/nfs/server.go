@@ -20,11 +20,16 @@ type Server struct {
 	handler             nfs.Handler
 	ctx                 context.Context // for global config
 	listener            net.Listener
+	v4                  *nfs4Server   // NFSv4 server if enabled
+	v3                  *connListener // passes NFSv3 connections from listener if v4 is enabled
 	UnmountedExternally bool
 }
 
 // NewServer creates a new server
 func NewServer(ctx context.Context, vfs *vfs.VFS, opt *Options) (s *Server, err error) {
+	if err := vfscommon.RefuseACL(&vfs.Opt); err != nil {
+		return nil, err
+	}
 	if vfs.Opt.CacheMode == vfscommon.CacheModeOff {
 		fs.LogPrintf(fs.LogLevelWarning, ctx, "NFS writes don't work without a cache, the filesystem will be served read-only")
 	}
@@ -45,6 +50,10 @@ func NewServer(ctx context.Context, vfs *vfs.VFS, opt *Options) (s *Server, err
 	if err != nil {
 		return nil, fmt.Errorf("failed to open listening socket: %w", err)
 	}
+	if s.opt.NFSv4 {
+		s.v4 = newNFS4Server(s.handler.(*Handler))
+		s.v3 = newConnListener(s.listener.Addr())
+	}
 	return s, nil
 }
 
@@ -55,11 +64,19 @@ func (s *Server) Addr() net.Addr {
 
 // Shutdown stops the server
 func (s *Server) Shutdown() error {
-	return s.listener.Close()
+	err := s.listener.Close()
+	if s.v4 != nil {
+		_ = s.v3.Close()
+		s.v4.state.shutdown()
+	}
+	return err
 }
 
 // Serve starts the server
 func (s *Server) Serve() (err error) {
 	fs.Logf(nil, "NFS Server running at %s\n", s.listener.Addr())
+	if s.v4 != nil {
+		return s.serveV4()
+	}
 	return nfs.Serve(s.listener, s.handler)
 }
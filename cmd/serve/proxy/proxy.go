@@ -10,6 +10,7 @@ import (
 	"errors"
 	"fmt"
 	"os/exec"
+	"strconv"
 	"strings"
 	"time"
 
@@ -48,8 +49,14 @@ config.
 This config generated must have this extra parameter
 - |_root| - root to use for the backend
 
-And it may have this parameter
+And it may have these parameters
 - |_obscure| - comma separated strings for parameters to obscure
+- |_quota_bytes| - max total size of the user's files, e.g. |10G|
+- |_quota_files| - max number of files the user can store
+- |_acl| - rules limiting which paths the user can access, e.g. |/=l,/incoming=w|
+
+Some servers read other parameters starting with |_| which are
+described in their documentation.
 
 If password authentication was used by the client, input to the proxy
 process (on STDIN) would look similar to this:
@@ -101,6 +108,38 @@ configuration, don't use |pass| or |public_key|.  This also means that if a user
 password or public-key is changed the cache will need to expire (which takes 5 mins)
 before it takes effect.
 
+If |_quota_bytes| or |_quota_files| are set then writes which would
+take the user over their quota fail with "No space left on device"
+and the free space reported to clients is that left in the quota.
+These override |--vfs-quota-bytes| and |--vfs-quota-files| for the
+user. The usage is read from the remote and so includes files not
+written through rclone.
+
+If |_acl| is set then it overrides |--vfs-acl| for the user. This
+lets many users share one remote with each only allowed into some
+parts of it. It is a comma separated list of |path=perms| rules where
+|perms| is made of the letters |r| (read files), |w| (write files and
+make directories), |l| (list directories) and |d| (delete and rename),
+or |-| for no access. The rule with the longest path matching an item
+applies to it and anything not matched by a rule can't be seen. The
+directories leading to the paths in the rules can always be listed
+but they only show the items the user can see.
+
+For example returning this would let the user list and read
+everything in |/public|, upload to but not read |/incoming| and do
+anything in their home directory.
+
+|||
+{
+	"type": "s3",
+	"_root": "bucket",
+	"_acl": "/public=rl,/incoming=w,/home/me=rwld"
+}
+|||
+
+The rules are enforced by |serve sftp| and |serve ftp|. The other
+servers refuse logins which return |_acl|.
+
 This can be used to build general purpose proxies to any kind of
 backend that rclone supports.  
 
@@ -132,12 +171,17 @@ type Proxy struct {
 	ctx      context.Context // for global config
 	Opt      Options
 	vfsOpt   vfscommon.Options
+
+	// EnforcesACL should be set by the servers which enforce the
+	// _acl rules, otherwise logins which return them are refused.
+	EnforcesACL bool
 }
 
 // cacheEntry is what is stored in the vfsCache
 type cacheEntry struct {
 	vfs    *vfs.VFS          // stored VFS
 	pwHash [sha256.Size]byte // sha256 hash of the password/publicKey
+	params configmap.Simple  // parameters starting with "_" from the proxy
 }
 
 // New creates a new proxy with the Options passed in
@@ -194,6 +238,36 @@ func (p *Proxy) run(in map[string]string) (config configmap.Simple, err error) {
 	return config, nil
 }
 
+// vfsOptions returns the VFS options for the config returned by
+// the proxy with any quotas in _quota_bytes and _quota_files and any
+// rules in _acl set.
+func (p *Proxy) vfsOptions(config configmap.Simple) (*vfscommon.Options, error) {
+	vfsOpt := p.vfsOpt
+	if quotaBytes, ok := config.Get("_quota_bytes"); ok {
+		err := vfsOpt.QuotaBytes.Set(quotaBytes)
+		if err != nil {
+			return nil, fmt.Errorf("proxy: bad _quota_bytes: %w", err)
+		}
+	}
+	if quotaFiles, ok := config.Get("_quota_files"); ok {
+		files, err := strconv.ParseInt(quotaFiles, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("proxy: bad _quota_files: %w", err)
+		}
+		vfsOpt.QuotaFiles = files
+	}
+	if acl, ok := config.Get("_acl"); ok {
+		if !p.EnforcesACL {
+			return nil, errors.New("proxy: _acl isn't enforced by this server")
+		}
+		err := vfsOpt.ACL.Set(acl)
+		if err != nil {
+			return nil, fmt.Errorf("proxy: bad _acl: %w", err)
+		}
+	}
+	return &vfsOpt, nil
+}
+
 // call runs the auth proxy and returns a cacheEntry and an error
 func (p *Proxy) call(user, auth string, isPublicKey bool) (value any, err error) {
 	var config configmap.Simple
@@ -224,6 +298,12 @@ func (p *Proxy) call(user, auth string, isPublicKey bool) (value any, err error)
 		return nil, errors.New("proxy: _root not set in result")
 	}
 
+	// Read any quotas and rules for the VFS
+	vfsOpt, err := p.vfsOptions(config)
+	if err != nil {
+		return nil, err
+	}
+
 	// Find the backend
 	fsInfo, err := fs.Find(fsName)
 	if err != nil {
@@ -255,8 +335,14 @@ func (p *Proxy) call(user, auth string, isPublicKey bool) (value any, err error)
 		// need to in memory. An attacker would find it easier to go
 		// after the unencrypted password in memory most likely.
 		entry := cacheEntry{
-			vfs:    vfs.New(f, &p.vfsOpt),
+			vfs:    vfs.New(f, vfsOpt),
 			pwHash: sha256.Sum256([]byte(auth)),
+			params: configmap.Simple{},
+		}
+		for key, value := range config {
+			if strings.HasPrefix(key, "_") {
+				entry.params[key] = value
+			}
 		}
 		return entry, true, nil
 	})
@@ -269,6 +355,15 @@ func (p *Proxy) call(user, auth string, isPublicKey bool) (value any, err error)
 // Call runs the auth proxy with the username and password/public key provided
 // returning a *vfs.VFS and the key used in the VFS cache.
 func (p *Proxy) Call(user, auth string, isPublicKey bool) (VFS *vfs.VFS, vfsKey string, err error) {
+	VFS, vfsKey, _, err = p.CallParams(user, auth, isPublicKey)
+	return VFS, vfsKey, err
+}
+
+// CallParams is like Call but also returns the parameters starting
+// with "_" in the config the proxy returned, for example "_root".
+//
+// The params returned must not be modified.
+func (p *Proxy) CallParams(user, auth string, isPublicKey bool) (VFS *vfs.VFS, vfsKey string, params configmap.Simple, err error) {
 	// Look in the cache first
 	value, ok := p.vfsCache.GetMaybe(user)
 
@@ -276,14 +371,14 @@ func (p *Proxy) Call(user, auth string, isPublicKey bool) (VFS *vfs.VFS, vfsKey
 	if !ok {
 		value, err = p.call(user, auth, isPublicKey)
 		if err != nil {
-			return nil, "", err
+			return nil, "", nil, err
 		}
 	}
 
 	// check we got what we were expecting
 	entry, ok := value.(cacheEntry)
 	if !ok {
-		return nil, "", fmt.Errorf("proxy: value is not cache entry: %#v", value)
+		return nil, "", nil, fmt.Errorf("proxy: value is not cache entry: %#v", value)
 	}
 
 	// Check the password / public key is correct in the cached entry.  This
@@ -294,12 +389,12 @@ func (p *Proxy) Call(user, auth string, isPublicKey bool) (VFS *vfs.VFS, vfsKey
 	authHash := sha256.Sum256([]byte(auth))
 	if subtle.ConstantTimeCompare(authHash[:], entry.pwHash[:]) != 1 {
 		if isPublicKey {
-			return nil, "", errors.New("proxy: incorrect public key")
+			return nil, "", nil, errors.New("proxy: incorrect public key")
 		}
-		return nil, "", errors.New("proxy: incorrect password")
+		return nil, "", nil, errors.New("proxy: incorrect password")
 	}
 
-	return entry.vfs, user, nil
+	return entry.vfs, user, entry.params, nil
 }
 
 // Get VFS from the cache using key - returns nil if not found
@@ -126,6 +126,13 @@ func TestRun(t *testing.T) {
 			assert.Nil(t, p.Get("unknown"))
 		})
 
+		// Test CallParams returns the "_" parameters
+		t.Run("CallParams", func(t *testing.T) {
+			_, _, params, err := p.CallParams(testUser, testPass, false)
+			require.NoError(t, err)
+			assert.Equal(t, configmap.Simple{"_root": ""}, params)
+		})
+
 		// now try again from the cache
 		vfs, vfsKey, err = p.Call(testUser, testPass, false)
 		require.NoError(t, err)
@@ -234,3 +241,35 @@ func TestRun(t *testing.T) {
 		assert.Equal(t, 1, p.vfsCache.Entries())
 	})
 }
+
+func TestVFSOptions(t *testing.T) {
+	p := New(context.Background(), &Opt, &vfscommon.Opt)
+
+	vfsOpt, err := p.vfsOptions(configmap.Simple{})
+	require.NoError(t, err)
+	assert.Equal(t, vfscommon.Opt, *vfsOpt)
+
+	vfsOpt, err = p.vfsOptions(configmap.Simple{
+		"_quota_bytes": "10M",
+		"_quota_files": "100",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 10*fs.Mebi, vfsOpt.QuotaBytes)
+	assert.Equal(t, int64(100), vfsOpt.QuotaFiles)
+	assert.Equal(t, fs.SizeSuffix(-1), p.vfsOpt.QuotaBytes)
+
+	_, err = p.vfsOptions(configmap.Simple{"_quota_bytes": "potato"})
+	assert.ErrorContains(t, err, "_quota_bytes")
+	_, err = p.vfsOptions(configmap.Simple{"_quota_files": "potato"})
+	assert.ErrorContains(t, err, "_quota_files")
+
+	// _acl is refused unless the server enforces it
+	_, err = p.vfsOptions(configmap.Simple{"_acl": "/=l,/incoming=w"})
+	assert.ErrorContains(t, err, "isn't enforced")
+	p.EnforcesACL = true
+	vfsOpt, err = p.vfsOptions(configmap.Simple{"_acl": "/=l,/incoming=w"})
+	require.NoError(t, err)
+	assert.Equal(t, vfscommon.ACL("/=l,/incoming=w"), vfsOpt.ACL)
+	_, err = p.vfsOptions(configmap.Simple{"_acl": "/incoming=potato"})
+	assert.ErrorContains(t, err, "_acl")
+}
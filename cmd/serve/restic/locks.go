@@ -0,0 +1,134 @@
+package restic
+
+import (
+	"context"
+	"errors"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/fs/walk"
+)
+
+func init() {
+	rc.Add(rc.Call{
+		Path:         "restic/locks",
+		AuthRequired: true,
+		Fn:           rcLocks,
+		Title:        "List the locks of restic repositories",
+		Help: `This lists the lock files of the restic repositories in a remote
+and reports which of them are stale.
+
+Restic refreshes the locks it holds every few minutes so a lock which
+hasn't been modified for a while was most likely left behind by a
+restic process which was killed. These stop other restic processes
+such as "restic prune" from running until removed with "restic unlock".
+
+This takes the following parameters:
+
+- fs - the remote containing the repositories
+- repo - path of a repository in the remote to look in (optional)
+- staleAge - how old a lock must be to be stale (optional, default 30m)
+
+It returns
+
+- locks - list of locks with
+    - repo - path of the repository in the remote
+    - name - name of the lock file
+    - modTime - when the lock was last refreshed
+    - age - how long ago that was
+    - stale - true if the lock is stale
+- stale - the number of stale locks
+
+Example:
+
+    rclone rc restic/locks fs=remote:backup
+`,
+	})
+}
+
+// lockInfo describes a lock file found in a repository
+type lockInfo struct {
+	Repo    string    `json:"repo"`
+	Name    string    `json:"name"`
+	ModTime time.Time `json:"modTime"`
+	Age     string    `json:"age"`
+	Stale   bool      `json:"stale"`
+}
+
+// findLocks returns the locks of the repositories in dir of f
+//
+// Locks not modified for staleAge are marked stale.
+func findLocks(ctx context.Context, f fs.Fs, dir string, staleAge time.Duration) (locks []lockInfo, err error) {
+	now := time.Now()
+	err = walk.ListR(ctx, f, dir, true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			o, ok := entry.(fs.Object)
+			if !ok {
+				continue
+			}
+			repo, fileType := splitRemote(o.Remote())
+			if fileType != "locks" {
+				continue
+			}
+			modTime := o.ModTime(ctx)
+			age := now.Sub(modTime)
+			locks = append(locks, lockInfo{
+				Repo:    repo,
+				Name:    path.Base(o.Remote()),
+				ModTime: modTime,
+				Age:     age.Truncate(time.Second).String(),
+				Stale:   age > staleAge,
+			})
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrorDirNotFound) {
+		return nil, err
+	}
+	sort.Slice(locks, func(i, j int) bool {
+		if locks[i].Repo != locks[j].Repo {
+			return locks[i].Repo < locks[j].Repo
+		}
+		return locks[i].Name < locks[j].Name
+	})
+	return locks, nil
+}
+
+// rcLocks lists the locks of the restic repositories
+func rcLocks(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	f, err := rc.GetFs(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	repo, err := in.GetString("repo")
+	if rc.NotErrParamNotFound(err) {
+		return nil, err
+	}
+	staleAge := staleLockAge
+	if _, found := in["staleAge"]; found {
+		staleAge, err = in.GetDuration("staleAge")
+		if err != nil {
+			return nil, err
+		}
+	}
+	locks, err := findLocks(ctx, f, repo, staleAge)
+	if err != nil {
+		return nil, err
+	}
+	stale := 0
+	for _, lock := range locks {
+		if lock.Stale {
+			stale++
+		}
+	}
+	if locks == nil {
+		locks = []lockInfo{}
+	}
+	return rc.Params{
+		"locks": locks,
+		"stale": stale,
+	}, nil
+}
@@ -0,0 +1,96 @@
+package restic
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/rc"
+)
+
+// The servers tracking usage which the metrics are collected from
+var (
+	metricsMu      sync.Mutex
+	metricsServers = map[*server]struct{}{}
+)
+
+func init() {
+	prometheus.MustRegister(newCollector())
+}
+
+// metricsEnabled returns true if the prometheus metrics are being served
+func metricsEnabled() bool {
+	return rc.Opt.EnableMetrics || len(rc.Opt.MetricsHTTP.ListenAddr) > 0
+}
+
+// addMetrics starts collecting the metrics of s
+func addMetrics(s *server) {
+	metricsMu.Lock()
+	metricsServers[s] = struct{}{}
+	metricsMu.Unlock()
+}
+
+// removeMetrics stops collecting the metrics of s
+func removeMetrics(s *server) {
+	metricsMu.Lock()
+	delete(metricsServers, s)
+	metricsMu.Unlock()
+}
+
+// collector is a prometheus collector for the usage of the restic
+// repositories served
+type collector struct {
+	objects    *prometheus.Desc
+	bytes      *prometheus.Desc
+	staleLocks *prometheus.Desc
+}
+
+// newCollector makes a new collector
+func newCollector() *collector {
+	labels := []string{"remote", "repo"}
+	typeLabels := []string{"remote", "repo", "type"}
+	return &collector{
+		objects: prometheus.NewDesc("rclone_restic_repo_objects",
+			"Number of files in the restic repository by type",
+			typeLabels, nil,
+		),
+		bytes: prometheus.NewDesc("rclone_restic_repo_bytes",
+			"Size of the files in the restic repository by type",
+			typeLabels, nil,
+		),
+		staleLocks: prometheus.NewDesc("rclone_restic_repo_stale_locks",
+			"Number of locks in the restic repository not refreshed for 30 minutes",
+			labels, nil,
+		),
+	}
+}
+
+// Describe is part of the Collector interface: https://godoc.org/github.com/prometheus/client_golang/prometheus#Collector
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.objects
+	ch <- c.bytes
+	ch <- c.staleLocks
+}
+
+// Collect is part of the Collector interface: https://godoc.org/github.com/prometheus/client_golang/prometheus#Collector
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	// servers may share repositories but each may only be reported once
+	seen := map[[2]string]struct{}{}
+	for s := range metricsServers {
+		remote := fs.ConfigString(s.f)
+		for _, r := range s.usage.snapshot() {
+			repo := "/" + r.repo
+			if _, found := seen[[2]string{remote, repo}]; found {
+				continue
+			}
+			seen[[2]string{remote, repo}] = struct{}{}
+			for _, fileType := range fileTypes {
+				ch <- prometheus.MustNewConstMetric(c.objects, prometheus.GaugeValue, float64(r.objects[fileType]), remote, repo, fileType)
+				ch <- prometheus.MustNewConstMetric(c.bytes, prometheus.GaugeValue, float64(r.bytes[fileType]), remote, repo, fileType)
+			}
+			ch <- prometheus.MustNewConstMetric(c.staleLocks, prometheus.GaugeValue, float64(r.staleLocks), remote, repo)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package restic
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+)
+
+var errQuotaExceeded = errors.New("quota exceeded")
+
+// quotaLimit is the most which may be stored in dir
+type quotaLimit struct {
+	dir     string
+	maxSize int64
+}
+
+// quotaLimits returns the limits on the space which can be used by
+// remote
+func (s *server) quotaLimits(remote string) (limits []quotaLimit) {
+	if s.opt.MaxSize >= 0 {
+		repo, _ := splitRemote(remote)
+		limits = append(limits, quotaLimit{dir: repo, maxSize: int64(s.opt.MaxSize)})
+	}
+	if s.opt.PrivateRepos && s.opt.MaxUserSize >= 0 {
+		user, _, _ := strings.Cut(remote, "/")
+		limits = append(limits, quotaLimit{dir: user, maxSize: int64(s.opt.MaxUserSize)})
+	}
+	return limits
+}
+
+// reservation holds space in the quotas for an upload while it runs
+// so concurrent uploads can't go over them between them.
+type reservation struct {
+	u      *usage
+	limits []quotaLimit
+	credit int64 // size of the object being overwritten
+	bytes  int64 // bytes reserved
+}
+
+// reserve n more bytes, returning errQuotaExceeded if there isn't
+// room for them.
+func (r *reservation) reserve(ctx context.Context, n int64) error {
+	return r.u.reserve(ctx, r, n)
+}
+
+// release the bytes reserved
+func (r *reservation) release(ctx context.Context) {
+	_ = r.u.reserve(ctx, r, -r.bytes)
+}
+
+// quotaReader reads from in reserving the bytes read, returning
+// errQuotaExceeded if there isn't room for them.
+type quotaReader struct {
+	ctx      context.Context
+	in       io.ReadCloser
+	res      *reservation
+	read     int64
+	exceeded bool
+}
+
+// Read bytes checking the quota
+func (q *quotaReader) Read(p []byte) (n int, err error) {
+	n, err = q.in.Read(p)
+	q.read += int64(n)
+	if q.read > q.res.bytes {
+		if rerr := q.res.reserve(q.ctx, q.read-q.res.bytes); rerr != nil {
+			q.exceeded = errors.Is(rerr, errQuotaExceeded)
+			return n, rerr
+		}
+	}
+	return n, err
+}
+
+// Close the underlying reader
+func (q *quotaReader) Close() error {
+	return q.in.Close()
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"os"
@@ -50,6 +51,14 @@ var OptionsInfo = fs.Options{{
 	Name:    "cache_objects",
 	Default: true,
 	Help:    "Cache listed objects",
+}, {
+	Name:    "max_size",
+	Default: fs.SizeSuffix(-1),
+	Help:    "Max size of each repository (default off)",
+}, {
+	Name:    "max_user_size",
+	Default: fs.SizeSuffix(-1),
+	Help:    "Max size of the repositories of each user with --private-repos (default off)",
 }}.
 	Add(libhttp.ConfigInfo).
 	Add(libhttp.AuthConfigInfo)
@@ -58,10 +67,12 @@ var OptionsInfo = fs.Options{{
 type Options struct {
 	Auth         libhttp.AuthConfig
 	HTTP         libhttp.Config
-	Stdio        bool `config:"stdio"`
-	AppendOnly   bool `config:"append_only"`
-	PrivateRepos bool `config:"private_repos"`
-	CacheObjects bool `config:"cache_objects"`
+	Stdio        bool          `config:"stdio"`
+	AppendOnly   bool          `config:"append_only"`
+	PrivateRepos bool          `config:"private_repos"`
+	CacheObjects bool          `config:"cache_objects"`
+	MaxSize      fs.SizeSuffix `config:"max_size"`
+	MaxUserSize  fs.SizeSuffix `config:"max_user_size"`
 }
 
 // Opt is options set by command line flags
@@ -178,6 +189,38 @@ these **must** end with /.  Eg
 The` + "`--private-repos`" + ` flag can be used to limit users to repositories starting
 with a path of ` + "`/<username>/`" + `.
 
+#### Quotas ####
+
+Use ` + "`--max-size`" + ` to limit the size of each repository, for example
+` + "`--max-size 100G`" + `. Uploads which would take a repository over this
+are rejected with "413 Request Entity Too Large" which restic reports
+as an error. Uploads in progress count towards the quota so several
+at once can't go over it between them, and overwriting a file frees
+the space the old one used. Deleting snapshots and running "restic
+prune" frees space again.
+
+With ` + "`--private-repos`" + ` the total size of the repositories of each
+user can be limited with ` + "`--max-user-size`" + `.
+
+The size of a repository is found by listing it the first time it is
+used, then kept up to date as files are uploaded and deleted through
+rclone. Changes made to the remote by other means aren't noticed until
+the server is restarted.
+
+#### Metrics and locks ####
+
+When the prometheus metrics are enabled with ` + "`--metrics-addr`" + ` or
+` + "`--rc-enable-metrics`" + ` the number and size of the files of each type in
+the repositories used, and the number of stale locks in them, are
+reported as ` + "`rclone_restic_repo_objects`" + `, ` + "`rclone_restic_repo_bytes`" + ` and
+` + "`rclone_restic_repo_stale_locks`" + `.
+
+A lock which hasn't been refreshed by restic for 30 minutes is stale -
+the restic process holding it most likely died. Stale locks stop
+"restic prune" and "restic check" from running until removed with
+"restic unlock". Use the ` + "`restic/locks`" + ` rc command to list the locks of
+the repositories in a remote.
+
 ` + libhttp.Help(flagPrefix) + libhttp.AuthHelp(flagPrefix),
 	Annotations: map[string]string{
 		"versionIntroduced": "v1.40",
@@ -270,15 +313,22 @@ type server struct {
 	server *libhttp.Server
 	f      fs.Fs
 	cache  *cache
+	usage  *usage // nil if not tracking usage
 	opt    Options
 }
 
 func newServer(ctx context.Context, f fs.Fs, opt *Options) (s *server, err error) {
+	if opt.MaxUserSize >= 0 && !opt.PrivateRepos {
+		return nil, errors.New("--max-user-size needs --private-repos")
+	}
 	s = &server{
 		f:     f,
 		cache: newCache(opt.CacheObjects),
 		opt:   *opt,
 	}
+	if opt.MaxSize >= 0 || opt.MaxUserSize >= 0 || metricsEnabled() {
+		s.usage = newUsage(f)
+	}
 	// Don't bind any HTTP listeners if running with --stdio
 	if opt.Stdio {
 		opt.HTTP.ListenAddr = nil
@@ -292,6 +342,9 @@ func newServer(ctx context.Context, f fs.Fs, opt *Options) (s *server, err error
 	}
 	router := s.server.Router()
 	s.Bind(router)
+	if s.usage != nil && metricsEnabled() {
+		addMetrics(s)
+	}
 	return s, nil
 }
 
@@ -309,6 +362,7 @@ func (s *server) Addr() net.Addr {
 
 // Shutdown the server
 func (s *server) Shutdown() error {
+	removeMetrics(s)
 	return s.server.Shutdown()
 }
 
@@ -414,8 +468,49 @@ func (s *server) postObject(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	o, err := operations.RcatSize(r.Context(), s.f, remote, r.Body, r.ContentLength, time.Now(), nil)
+	var (
+		in  io.ReadCloser = r.Body
+		old fs.Object
+		qr  *quotaReader
+	)
+	if s.usage != nil {
+		if err := s.usage.repo(r.Context(), remote); err != nil {
+			fs.Errorf(remote, "Post request failed to read repository usage: %v", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		// the object may be overwritten
+		old, _ = s.newObject(r.Context(), remote)
+		if limits := s.quotaLimits(remote); len(limits) > 0 {
+			res := &reservation{u: s.usage, limits: limits}
+			if old != nil {
+				res.credit = old.Size()
+			}
+			defer res.release(r.Context())
+			if r.ContentLength > 0 {
+				err := res.reserve(r.Context(), r.ContentLength)
+				if errors.Is(err, errQuotaExceeded) {
+					fs.Errorf(remote, "Post request: %v", errQuotaExceeded)
+					http.Error(w, errQuotaExceeded.Error(), http.StatusRequestEntityTooLarge)
+					return
+				} else if err != nil {
+					fs.Errorf(remote, "Post request failed to read quota: %v", err)
+					http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+					return
+				}
+			}
+			qr = &quotaReader{ctx: r.Context(), in: in, res: res}
+			in = qr
+		}
+	}
+
+	o, err := operations.RcatSize(r.Context(), s.f, remote, in, r.ContentLength, time.Now(), nil)
 	if err != nil {
+		if qr != nil && qr.exceeded {
+			fs.Errorf(remote, "Post request: %v", errQuotaExceeded)
+			http.Error(w, errQuotaExceeded.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
 		err = accounting.Stats(r.Context()).Error(err)
 		fs.Errorf(remote, "Post request rcat error: %v", err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -423,6 +518,13 @@ func (s *server) postObject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if s.usage != nil {
+		if old != nil {
+			s.usage.update(remote, -1, old.Size(), time.Time{})
+		}
+		s.usage.update(remote, 1, o.Size(), o.ModTime(r.Context()))
+	}
+
 	// if successfully uploaded add to cache
 	s.cache.add(remote, o)
 }
@@ -461,6 +563,10 @@ func (s *server) deleteObject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if s.usage != nil {
+		s.usage.update(remote, -1, o.Size(), time.Time{})
+	}
+
 	// remove object from cache
 	s.cache.remove(remote)
 }
@@ -496,6 +602,12 @@ func (s *server) listObjects(w http.ResponseWriter, r *http.Request) {
 	}
 	fs.Debugf(remote, "list request")
 
+	if s.usage != nil {
+		if err := s.usage.repo(r.Context(), remote); err != nil {
+			fs.Errorf(remote, "List request failed to read repository usage: %v", err)
+		}
+	}
+
 	// make sure an empty list is returned, and not a 'nil' value
 	ls := listItems{}
 
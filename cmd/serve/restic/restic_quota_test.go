@@ -0,0 +1,263 @@
+package restic
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitRemote(t *testing.T) {
+	for _, test := range []struct {
+		remote   string
+		repo     string
+		fileType string
+	}{
+		{"config", "", "config"},
+		{"data/21/2159dd48", "", "data"},
+		{"keys/abcd", "", "keys"},
+		{"repo/config", "repo", "config"},
+		{"user/repo/data/21/2159dd48", "user/repo", "data"},
+		{"user/repo/locks/abcd", "user/repo", "locks"},
+		{"user/repo/snapshots/abcd", "user/repo", "snapshots"},
+		{"user/repo/index/abcd", "user/repo", "index"},
+		{"file.txt", "", ""},
+		{"user/repo/other/abcd", "", ""},
+	} {
+		repo, fileType := splitRemote(test.remote)
+		assert.Equal(t, test.repo, repo, test.remote)
+		assert.Equal(t, test.fileType, fileType, test.remote)
+	}
+}
+
+// TestResticQuota checks uploads beyond --max-size are rejected
+func TestResticQuota(t *testing.T) {
+	ctx := context.Background()
+	tempdir := t.TempDir()
+	opt := newOpt()
+	opt.MaxSize = 20
+	f := cmd.NewFsSrc([]string{tempdir})
+	s, err := newServer(ctx, f, &opt)
+	require.NoError(t, err)
+	router := s.server.Router()
+
+	// unknown length uploads are stopped when they reach the quota
+	unknownLength := func(req *http.Request) *http.Request {
+		req.ContentLength = -1
+		return req
+	}
+
+	for i, test := range []struct {
+		req  *http.Request
+		code int
+	}{
+		{newRequest(t, "POST", "/repo/?create=true", nil), http.StatusOK},
+		{newRequest(t, "POST", "/repo/data/aaaa", strings.NewReader("0123456789")), http.StatusOK},
+		{newRequest(t, "POST", "/repo/keys/bbbb", strings.NewReader("01234")), http.StatusOK},
+		{newRequest(t, "POST", "/repo/data/cccc", strings.NewReader("0123456789")), http.StatusRequestEntityTooLarge},
+		{unknownLength(newRequest(t, "POST", "/repo/data/cccc", strings.NewReader("0123456789"))), http.StatusRequestEntityTooLarge},
+		{newRequest(t, "GET", "/repo/data/cccc", nil), http.StatusNotFound},
+		// other repositories have their own quota
+		{newRequest(t, "POST", "/other/data/cccc", strings.NewReader("0123456789")), http.StatusOK},
+		// deleting frees space
+		{newRequest(t, "DELETE", "/repo/data/aaaa", nil), http.StatusOK},
+		{unknownLength(newRequest(t, "POST", "/repo/data/cccc", strings.NewReader("0123456789"))), http.StatusOK},
+		{newRequest(t, "POST", "/repo/data/dddd", strings.NewReader("01234")), http.StatusOK},
+		{newRequest(t, "POST", "/repo/data/eeee", strings.NewReader("0")), http.StatusRequestEntityTooLarge},
+		// overwriting an object frees its space
+		{newRequest(t, "POST", "/repo/data/dddd", strings.NewReader("56789")), http.StatusOK},
+		{newRequest(t, "POST", "/repo/data/dddd", strings.NewReader("567890")), http.StatusRequestEntityTooLarge},
+	} {
+		t.Logf("request %v: %v %v", i, test.req.Method, test.req.URL.Path)
+		checkRequest(t, router.ServeHTTP, test.req, []wantFunc{wantCode(test.code)})
+	}
+
+	size, err := s.usage.size(ctx, "repo")
+	require.NoError(t, err)
+	assert.Equal(t, int64(20), size)
+}
+
+// TestResticQuotaConcurrent checks uploads running at the same time
+// can't go over the quota between them
+func TestResticQuotaConcurrent(t *testing.T) {
+	ctx := context.Background()
+	tempdir := t.TempDir()
+	opt := newOpt()
+	opt.MaxSize = 10
+	f := cmd.NewFsSrc([]string{tempdir})
+	s, err := newServer(ctx, f, &opt)
+	require.NoError(t, err)
+	router := s.server.Router()
+	checkRequest(t, router.ServeHTTP, newRequest(t, "POST", "/repo/?create=true", nil), []wantFunc{wantCode(http.StatusOK)})
+
+	// start an upload which holds 8 bytes of the quota
+	pr, pw := io.Pipe()
+	req := newRequest(t, "POST", "/repo/data/aaaa", pr)
+	req.ContentLength = -1
+	rr := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		router.ServeHTTP(rr, req)
+		close(done)
+	}()
+	_, err = pw.Write([]byte("01234567"))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		s.usage.mu.Lock()
+		defer s.usage.mu.Unlock()
+		d := s.usage.dirs["repo"]
+		return d != nil && d.reserved == 8
+	}, 10*time.Second, time.Millisecond)
+
+	// there isn't room for another upload while it runs
+	checkRequest(t, router.ServeHTTP, newRequest(t, "POST", "/repo/data/bbbb", strings.NewReader("01234567")), []wantFunc{wantCode(http.StatusRequestEntityTooLarge)})
+
+	require.NoError(t, pw.Close())
+	<-done
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// the space reserved is given back when the upload finishes
+	size, err := s.usage.size(ctx, "repo")
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), size)
+	checkRequest(t, router.ServeHTTP, newRequest(t, "POST", "/repo/data/bbbb", strings.NewReader("01")), []wantFunc{wantCode(http.StatusOK)})
+}
+
+// TestResticUserQuota checks --max-user-size limits all the
+// repositories of a user
+func TestResticUserQuota(t *testing.T) {
+	ctx := context.Background()
+	tempdir := t.TempDir()
+	opt := newOpt()
+	opt.MaxUserSize = 15
+	f := cmd.NewFsSrc([]string{tempdir})
+	_, err := newServer(ctx, f, &opt)
+	require.Error(t, err)
+
+	opt.PrivateRepos = true
+	opt.Auth.BasicUser = "test"
+	opt.Auth.BasicPass = "password"
+	s, err := newServer(ctx, f, &opt)
+	require.NoError(t, err)
+	router := s.server.Router()
+
+	for i, test := range []struct {
+		req  *http.Request
+		code int
+	}{
+		{newAuthenticatedRequest(t, "POST", "/test/repo1/data/aaaa", strings.NewReader("0123456789"), "test", "password"), http.StatusOK},
+		{newAuthenticatedRequest(t, "POST", "/test/repo2/data/aaaa", strings.NewReader("01234"), "test", "password"), http.StatusOK},
+		{newAuthenticatedRequest(t, "POST", "/test/repo2/data/bbbb", strings.NewReader("0"), "test", "password"), http.StatusRequestEntityTooLarge},
+	} {
+		t.Logf("request %v: %v %v", i, test.req.Method, test.req.URL.Path)
+		checkRequest(t, router.ServeHTTP, test.req, []wantFunc{wantCode(test.code)})
+	}
+}
+
+// write a lock file into dir with the modification time given
+func writeLock(t *testing.T, dir, name string, modTime time.Time) {
+	require.NoError(t, os.MkdirAll(dir, 0777))
+	lockPath := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(lockPath, []byte("lock"), 0666))
+	require.NoError(t, os.Chtimes(lockPath, modTime, modTime))
+}
+
+func TestResticLocks(t *testing.T) {
+	ctx := context.Background()
+	tempdir := t.TempDir()
+	now := time.Now()
+	writeLock(t, filepath.Join(tempdir, "repo1", "locks"), "fresh", now.Add(-time.Minute))
+	writeLock(t, filepath.Join(tempdir, "repo1", "locks"), "stale", now.Add(-time.Hour))
+	writeLock(t, filepath.Join(tempdir, "user", "repo2", "locks"), "stale", now.Add(-2*time.Hour))
+	require.NoError(t, os.WriteFile(filepath.Join(tempdir, "repo1", "config"), []byte("config"), 0666))
+
+	call := rc.Calls.Get("restic/locks")
+	require.NotNil(t, call)
+	out, err := call.Fn(ctx, rc.Params{"fs": tempdir})
+	require.NoError(t, err)
+	assert.Equal(t, 2, out["stale"])
+	locks := out["locks"].([]lockInfo)
+	require.Len(t, locks, 3)
+	assert.Equal(t, "repo1", locks[0].Repo)
+	assert.Equal(t, "fresh", locks[0].Name)
+	assert.False(t, locks[0].Stale)
+	assert.Equal(t, "repo1", locks[1].Repo)
+	assert.Equal(t, "stale", locks[1].Name)
+	assert.True(t, locks[1].Stale)
+	assert.Equal(t, "user/repo2", locks[2].Repo)
+	assert.True(t, locks[2].Stale)
+
+	// only one repository with a shorter stale age
+	out, err = call.Fn(ctx, rc.Params{"fs": tempdir, "repo": "repo1", "staleAge": "30s"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, out["stale"])
+	assert.Len(t, out["locks"], 2)
+
+	// an empty remote has no locks
+	out, err = call.Fn(ctx, rc.Params{"fs": t.TempDir()})
+	require.NoError(t, err)
+	assert.Equal(t, 0, out["stale"])
+	assert.Equal(t, []lockInfo{}, out["locks"])
+}
+
+func TestResticMetrics(t *testing.T) {
+	ctx := context.Background()
+	oldEnableMetrics := rc.Opt.EnableMetrics
+	rc.Opt.EnableMetrics = true
+	defer func() {
+		rc.Opt.EnableMetrics = oldEnableMetrics
+	}()
+
+	tempdir := t.TempDir()
+	writeLock(t, filepath.Join(tempdir, "repo", "locks"), "stale", time.Now().Add(-time.Hour))
+	f := cmd.NewFsSrc([]string{tempdir})
+	opt := newOpt()
+	s, err := newServer(ctx, f, &opt)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, s.Shutdown())
+	}()
+	router := s.server.Router()
+	for _, req := range []*http.Request{
+		newRequest(t, "POST", "/repo/data/aaaa", strings.NewReader("0123456789")),
+		newRequest(t, "POST", "/repo/data/bbbb", strings.NewReader("01234")),
+		newRequest(t, "POST", "/repo/keys/cccc", strings.NewReader("012")),
+	} {
+		checkRequest(t, router.ServeHTTP, req, []wantFunc{wantCode(http.StatusOK)})
+	}
+
+	registry := prometheus.NewRegistry()
+	require.NoError(t, registry.Register(newCollector()))
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	values := map[string]float64{}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["repo"] != "/repo" {
+				continue
+			}
+			values[family.GetName()+"/"+labels["type"]] = metric.GetGauge().GetValue()
+		}
+	}
+	assert.Equal(t, 2.0, values["rclone_restic_repo_objects/data"])
+	assert.Equal(t, 15.0, values["rclone_restic_repo_bytes/data"])
+	assert.Equal(t, 1.0, values["rclone_restic_repo_objects/keys"])
+	assert.Equal(t, 3.0, values["rclone_restic_repo_bytes/keys"])
+	assert.Equal(t, 1.0, values["rclone_restic_repo_objects/locks"])
+	assert.Equal(t, 1.0, values["rclone_restic_repo_stale_locks/"])
+}
@@ -0,0 +1,242 @@
+package restic
+
+// Tracks the objects and bytes stored in each repository for the
+// quotas and the prometheus metrics
+
+import (
+	"context"
+	"errors"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/walk"
+)
+
+// The types of files in a restic repository
+var fileTypes = []string{"config", "data", "index", "keys", "locks", "snapshots"}
+
+// Restic considers locks which haven't been refreshed for this long
+// stale
+const staleLockAge = 30 * time.Minute
+
+// splitRemote splits the remote of a file into the repository it is
+// in and its type, which is one of fileTypes.
+//
+// It returns an empty fileType if the remote isn't part of a
+// repository.
+func splitRemote(remote string) (repo, fileType string) {
+	dir, leaf := path.Split(remote)
+	dir = strings.TrimSuffix(dir, "/")
+	if leaf == "config" {
+		return dir, "config"
+	}
+	// data files are one level deeper, e.g. data/21/2159dd48
+	for range 2 {
+		dir, leaf = path.Split(dir)
+		dir = strings.TrimSuffix(dir, "/")
+		switch leaf {
+		case "data", "index", "keys", "locks", "snapshots":
+			return dir, leaf
+		}
+	}
+	return "", ""
+}
+
+// dirUsage is the usage of a directory - a repository or the
+// directory of a user
+type dirUsage struct {
+	objects  map[string]int64     // number of files by type
+	bytes    map[string]int64     // size of files by type
+	locks    map[string]time.Time // modification time of the lock files by remote
+	reserved int64                // bytes reserved by uploads in progress
+}
+
+// total returns the total size of the files in bytes
+func (d *dirUsage) total() (total int64) {
+	for _, n := range d.bytes {
+		total += n
+	}
+	return total
+}
+
+// staleLocks returns the number of locks older than staleLockAge
+func (d *dirUsage) staleLocks(now time.Time) (n int) {
+	for _, modTime := range d.locks {
+		if now.Sub(modTime) > staleLockAge {
+			n++
+		}
+	}
+	return n
+}
+
+// usage tracks the usage of the directories the server is asked about
+type usage struct {
+	f     fs.Fs
+	mu    sync.Mutex           // protects the below and serialises loading
+	dirs  map[string]*dirUsage // loaded directories
+	repos map[string]struct{}  // which dirs are repositories
+}
+
+// newUsage makes a usage tracker for f
+func newUsage(f fs.Fs) *usage {
+	return &usage{
+		f:     f,
+		dirs:  map[string]*dirUsage{},
+		repos: map[string]struct{}{},
+	}
+}
+
+// isBelow returns true if remote is in dir
+func isBelow(remote, dir string) bool {
+	return dir == "" || strings.HasPrefix(remote, dir+"/")
+}
+
+// load the usage of dir counting the files in it if not already
+// loaded.
+//
+// Call with the lock held.
+func (u *usage) load(ctx context.Context, dir string) (*dirUsage, error) {
+	if d := u.dirs[dir]; d != nil {
+		return d, nil
+	}
+	d := &dirUsage{
+		objects: map[string]int64{},
+		bytes:   map[string]int64{},
+		locks:   map[string]time.Time{},
+	}
+	err := walk.ListR(ctx, u.f, dir, true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			if o, ok := entry.(fs.Object); ok {
+				d.add(o.Remote(), 1, o.Size(), o.ModTime(ctx))
+			}
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrorDirNotFound) {
+		return nil, err
+	}
+	fs.Debugf(dir, "Repository usage: %d bytes", d.total())
+	u.dirs[dir] = d
+	return d, nil
+}
+
+// add the file at remote of size bytes to the usage if n is 1 or
+// remove it if n is -1
+func (d *dirUsage) add(remote string, n, size int64, modTime time.Time) {
+	_, fileType := splitRemote(remote)
+	if fileType == "" {
+		return
+	}
+	d.objects[fileType] += n
+	d.bytes[fileType] += n * size
+	if fileType == "locks" {
+		if n > 0 {
+			d.locks[remote] = modTime
+		} else {
+			delete(d.locks, remote)
+		}
+	}
+}
+
+// repo loads the usage of the repository containing remote
+func (u *usage) repo(ctx context.Context, remote string) error {
+	repo, fileType := splitRemote(remote)
+	if fileType == "" {
+		// listing a directory of the repository, e.g. "repo/data"
+		repo, fileType = splitRemote(path.Join(remote, "x"))
+	}
+	if fileType == "" {
+		return nil
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	_, err := u.load(ctx, repo)
+	if err == nil {
+		u.repos[repo] = struct{}{}
+	}
+	return err
+}
+
+// size returns the total size of the files in dir
+func (u *usage) size(ctx context.Context, dir string) (int64, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	d, err := u.load(ctx, dir)
+	if err != nil {
+		return 0, err
+	}
+	return d.total(), nil
+}
+
+// reserve adds n bytes to the space reserved by r, returning
+// errQuotaExceeded if that would take any of its directories over
+// their limit. The size of the object being overwritten is credited
+// back as it will be removed. n may be negative to give back space.
+func (u *usage) reserve(ctx context.Context, r *reservation, n int64) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	var dirs []*dirUsage
+	for _, limit := range r.limits {
+		d, err := u.load(ctx, limit.dir)
+		if err != nil {
+			return err
+		}
+		if n > 0 && d.total()+d.reserved+n-r.credit > limit.maxSize {
+			return errQuotaExceeded
+		}
+		if !slices.Contains(dirs, d) {
+			dirs = append(dirs, d)
+		}
+	}
+	for _, d := range dirs {
+		d.reserved += n
+	}
+	r.bytes += n
+	return nil
+}
+
+// update the usage of all the loaded directories containing remote
+// adding the file if n is 1 or removing it if n is -1
+func (u *usage) update(remote string, n, size int64, modTime time.Time) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for dir, d := range u.dirs {
+		if isBelow(remote, dir) {
+			d.add(remote, n, size, modTime)
+		}
+	}
+}
+
+// repoUsage is a snapshot of the usage of a repository
+type repoUsage struct {
+	repo       string
+	objects    map[string]int64
+	bytes      map[string]int64
+	staleLocks int
+}
+
+// snapshot returns the usage of the repositories
+func (u *usage) snapshot() (repos []repoUsage) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	now := time.Now()
+	for repo := range u.repos {
+		d := u.dirs[repo]
+		r := repoUsage{
+			repo:       repo,
+			objects:    map[string]int64{},
+			bytes:      map[string]int64{},
+			staleLocks: d.staleLocks(now),
+		}
+		for _, fileType := range fileTypes {
+			r.objects[fileType] = d.objects[fileType]
+			r.bytes[fileType] = d.bytes[fileType]
+		}
+		repos = append(repos, r)
+	}
+	return repos
+}
@@ -25,15 +25,25 @@ var (
 // s3Backend implements the gofacess3.Backend interface to make an S3
 // backend for gofakes3
 type s3Backend struct {
-	s    *Server
-	meta *sync.Map
+	s          *Server
+	meta       *sync.Map
+	versionsMu sync.RWMutex // held for reading by lockKey and for writing while a version tree is removed
+	keysMu     sync.Mutex   // protects keys
+	keys       map[string]*keyLock
+	configMu   sync.Mutex // protects configs
+	configs    map[string]bucketConfig
+	uploadsMu  sync.Mutex // protects uploads
+	uploads    map[gofakes3.UploadID]*multipartUpload
 }
 
 // newBackend creates a new SimpleBucketBackend.
-func newBackend(s *Server) gofakes3.Backend {
+func newBackend(s *Server) *s3Backend {
 	return &s3Backend{
-		s:    s,
-		meta: new(sync.Map),
+		s:       s,
+		meta:    new(sync.Map),
+		configs: make(map[string]bucketConfig),
+		keys:    make(map[string]*keyLock),
+		uploads: make(map[gofakes3.UploadID]*multipartUpload),
 	}
 }
 
@@ -49,7 +59,7 @@ func (b *s3Backend) ListBuckets(ctx context.Context) ([]gofakes3.BucketInfo, err
 	}
 	var response []gofakes3.BucketInfo
 	for _, entry := range dirEntries {
-		if entry.IsDir() {
+		if entry.IsDir() && entry.Name() != metaDir {
 			response = append(response, gofakes3.BucketInfo{
 				Name:         entry.Name(),
 				CreationDate: gofakes3.NewContentTime(entry.ModTime()),
@@ -67,9 +77,8 @@ func (b *s3Backend) ListBucket(ctx context.Context, bucket string, prefix *gofak
 	if err != nil {
 		return nil, err
 	}
-	_, err = _vfs.Stat(bucket)
-	if err != nil {
-		return nil, gofakes3.BucketNotFound(bucket)
+	if err := checkBucket(_vfs, bucket); err != nil {
+		return nil, err
 	}
 	if prefix == nil {
 		prefix = emptyPrefix
@@ -112,12 +121,15 @@ func (b *s3Backend) HeadObject(ctx context.Context, bucketName, objectName strin
 	if err != nil {
 		return nil, err
 	}
-	_, err = _vfs.Stat(bucketName)
-	if err != nil {
-		return nil, gofakes3.BucketNotFound(bucketName)
+	if err := checkBucket(_vfs, bucketName); err != nil {
+		return nil, err
 	}
 
-	fp := path.Join(bucketName, objectName)
+	return b.headObject(_vfs, path.Join(bucketName, objectName), objectName)
+}
+
+// headObject returns the fileinfo for the object objectName stored at fp.
+func (b *s3Backend) headObject(_vfs *vfs.VFS, fp, objectName string) (*gofakes3.Object, error) {
 	node, err := _vfs.Stat(fp)
 	if err != nil {
 		return nil, gofakes3.KeyNotFound(objectName)
@@ -161,12 +173,15 @@ func (b *s3Backend) GetObject(ctx context.Context, bucketName, objectName string
 	if err != nil {
 		return nil, err
 	}
-	_, err = _vfs.Stat(bucketName)
-	if err != nil {
-		return nil, gofakes3.BucketNotFound(bucketName)
+	if err := checkBucket(_vfs, bucketName); err != nil {
+		return nil, err
 	}
 
-	fp := path.Join(bucketName, objectName)
+	return b.getObject(_vfs, path.Join(bucketName, objectName), objectName, rangeRequest)
+}
+
+// getObject fetches the object objectName stored at fp.
+func (b *s3Backend) getObject(_vfs *vfs.VFS, fp, objectName string, rangeRequest *gofakes3.ObjectRangeRequest) (obj *gofakes3.Object, err error) {
 	node, err := _vfs.Stat(fp)
 	if err != nil {
 		return nil, gofakes3.KeyNotFound(objectName)
@@ -296,54 +311,139 @@ func (b *s3Backend) PutObject(
 	if err != nil {
 		return result, err
 	}
-	_, err = _vfs.Stat(bucketName)
-	if err != nil {
-		return result, gofakes3.BucketNotFound(bucketName)
+	if err := checkBucket(_vfs, bucketName); err != nil {
+		return result, err
 	}
 
-	fp := path.Join(bucketName, objectName)
-	objectDir := path.Dir(fp)
-	// _, err = db.fs.Stat(objectDir)
-	// if err == vfs.ENOENT {
-	// 	fs.Errorf(objectDir, "PutObject failed: path not found")
-	// 	return result, gofakes3.KeyNotFound(objectName)
-	// }
-
-	if objectDir != "." {
-		if err := mkdirRecursive(objectDir, _vfs); err != nil {
-			return result, err
-		}
-	}
+	return b.putObject(_vfs, bucketName, objectName, meta, true, func(fp string) error {
+		return writeFile(_vfs, fp, input)
+	})
+}
 
+// writeFile creates the file at fp in the VFS from input
+func writeFile(_vfs *vfs.VFS, fp string, input io.Reader) error {
 	f, err := _vfs.Create(fp)
 	if err != nil {
-		return result, err
+		return err
 	}
 
 	if _, err := io.Copy(f, input); err != nil {
 		// remove file when i/o error occurred (FsPutErr)
 		_ = f.Close()
 		_ = _vfs.Remove(fp)
-		return result, err
+		return err
 	}
 
 	if err := f.Close(); err != nil {
 		// remove file when close error occurred (FsPutErr)
 		_ = _vfs.Remove(fp)
+		return err
+	}
+	return nil
+}
+
+// putObject stores an object with write and then sets its version,
+// tags and metadata.
+//
+// write is called with the path the object should be created at once
+// its directory exists. If the bucket is versioned and stage is set
+// this is a temporary path and the object is moved into place after
+// write returns so the key is only locked while the versions are
+// changed. Otherwise write is called with the key locked so should be
+// quick.
+func (b *s3Backend) putObject(
+	_vfs *vfs.VFS,
+	bucketName, objectName string,
+	meta map[string]string,
+	stage bool,
+	write func(fp string) error,
+) (result gofakes3.PutObjectResult, err error) {
+	status, err := b.versioning(_vfs, bucketName)
+	if err != nil {
 		return result, err
 	}
 
-	_, err = _vfs.Stat(fp)
+	fp := path.Join(bucketName, objectName)
+	objectDir := path.Dir(fp)
+	// _, err = db.fs.Stat(objectDir)
+	// if err == vfs.ENOENT {
+	// 	fs.Errorf(objectDir, "PutObject failed: path not found")
+	// 	return result, gofakes3.KeyNotFound(objectName)
+	// }
+
+	if status == gofakes3.VersioningNone {
+		if objectDir != "." {
+			if err := mkdirRecursive(objectDir, _vfs); err != nil {
+				return result, err
+			}
+		}
+		if err := write(fp); err != nil {
+			return result, err
+		}
+	} else {
+		if stage {
+			tmp, err := stagingPath(_vfs, bucketName)
+			if err != nil {
+				return result, err
+			}
+			if err := write(tmp); err != nil {
+				return result, err
+			}
+			defer func() {
+				if err != nil {
+					_ = _vfs.Remove(tmp)
+				}
+			}()
+			write = func(fp string) error {
+				return _vfs.Rename(tmp, fp)
+			}
+		}
+		unlock := b.lockKey(bucketName, objectName)
+		defer unlock()
+		if err := b.archiveCurrent(_vfs, bucketName, objectName, status); err != nil {
+			return result, err
+		}
+		// restore the previous version if the upload fails
+		defer func() {
+			if err != nil {
+				b.promoteLatest(_vfs, bucketName, objectName)
+			}
+		}()
+		if objectDir != "." {
+			if err := mkdirRecursive(objectDir, _vfs); err != nil {
+				return result, err
+			}
+		}
+		if err := write(fp); err != nil {
+			return result, err
+		}
+		result.VersionID, err = b.newCurrentVersion(_vfs, bucketName, objectName, status)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	node, err := _vfs.Stat(fp)
 	if err != nil {
 		return result, err
 	}
 
+	if tags, ok := meta["X-Amz-Tagging"]; ok {
+		if err := setTags(_vfs, fp, tags); err != nil {
+			return result, err
+		}
+	}
+
 	b.meta.Store(fp, meta)
 
 	if val, ok := meta["X-Amz-Meta-Mtime"]; ok {
 		ti, err := swift.FloatStringToTime(val)
 		if err == nil {
 			b.storeModtime(fp, meta, val)
+			if node.ModTime().Equal(ti) {
+				// already set, for example by a chunk writer
+				return result, nil
+			}
 			return result, _vfs.Chtimes(fp, ti, ti)
 		}
 		// ignore error since the file is successfully created
@@ -361,7 +461,7 @@ func (b *s3Backend) PutObject(
 // DeleteMulti deletes multiple objects in a single request.
 func (b *s3Backend) DeleteMulti(ctx context.Context, bucketName string, objects ...string) (result gofakes3.MultiDeleteResult, rerr error) {
 	for _, object := range objects {
-		if err := b.deleteObject(ctx, bucketName, object); err != nil {
+		if _, err := b.DeleteObject(ctx, bucketName, object); err != nil {
 			fs.Errorf("serve s3", "delete object failed: %v", err)
 			result.Error = append(result.Error, gofakes3.ErrorResult{
 				Code:    gofakes3.ErrInternal,
@@ -379,7 +479,23 @@ func (b *s3Backend) DeleteMulti(ctx context.Context, bucketName string, objects
 }
 
 // DeleteObject deletes the object with the given name.
+//
+// If versioning is enabled on the bucket a delete marker is made.
 func (b *s3Backend) DeleteObject(ctx context.Context, bucketName, objectName string) (result gofakes3.ObjectDeleteResult, rerr error) {
+	_vfs, err := b.s.getVFS(ctx)
+	if err != nil {
+		return result, err
+	}
+	if err := checkBucket(_vfs, bucketName); err != nil {
+		return result, err
+	}
+	status, err := b.versioning(_vfs, bucketName)
+	if err != nil {
+		return result, err
+	}
+	if status != gofakes3.VersioningNone {
+		return b.deleteObjectVersioned(_vfs, bucketName, objectName, status)
+	}
 	return result, b.deleteObject(ctx, bucketName, objectName)
 }
 
@@ -389,9 +505,8 @@ func (b *s3Backend) deleteObject(ctx context.Context, bucketName, objectName str
 	if err != nil {
 		return err
 	}
-	_, err = _vfs.Stat(bucketName)
-	if err != nil {
-		return gofakes3.BucketNotFound(bucketName)
+	if err := checkBucket(_vfs, bucketName); err != nil {
+		return err
 	}
 
 	fp := path.Join(bucketName, objectName)
@@ -412,6 +527,9 @@ func (b *s3Backend) CreateBucket(ctx context.Context, name string) error {
 	if err != nil {
 		return err
 	}
+	if name == metaDir {
+		return gofakes3.ErrInvalidBucketName
+	}
 	_, err = _vfs.Stat(name)
 	if err != nil && err != vfs.ENOENT {
 		return gofakes3.ErrInternal
@@ -433,15 +551,16 @@ func (b *s3Backend) DeleteBucket(ctx context.Context, name string) error {
 	if err != nil {
 		return err
 	}
-	_, err = _vfs.Stat(name)
-	if err != nil {
-		return gofakes3.BucketNotFound(name)
+	if err := checkBucket(_vfs, name); err != nil {
+		return err
 	}
 
 	if err := _vfs.Remove(name); err != nil {
 		return gofakes3.ErrBucketNotEmpty
 	}
 
+	b.removeVersionTree(_vfs, name)
+	b.removeConfig(_vfs, name)
 	return nil
 }
 
@@ -451,12 +570,7 @@ func (b *s3Backend) BucketExists(ctx context.Context, name string) (exists bool,
 	if err != nil {
 		return false, err
 	}
-	_, err = _vfs.Stat(name)
-	if err != nil {
-		return false, nil
-	}
-
-	return true, nil
+	return checkBucket(_vfs, name) == nil, nil
 }
 
 // CopyObject copy specified object from srcKey to dstKey.
@@ -465,6 +579,11 @@ func (b *s3Backend) CopyObject(ctx context.Context, srcBucket, srcKey, dstBucket
 	if err != nil {
 		return result, err
 	}
+	for _, bucket := range []string{srcBucket, dstBucket} {
+		if err := checkBucket(_vfs, bucket); err != nil {
+			return result, err
+		}
+	}
 	fp := path.Join(srcBucket, srcKey)
 	if srcBucket == dstBucket && srcKey == dstKey {
 		b.meta.Store(fp, meta)
@@ -0,0 +1,134 @@
+package s3
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+
+	"github.com/rclone/gofakes3"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/vfs"
+)
+
+// metaDir is the hidden directory in the root which holds the bucket
+// configuration and the version trees. It must never be used as a
+// bucket so check buckets with checkBucket.
+const metaDir = ".rclone-s3"
+
+// bucketConfigName is the name of the file in the bucket's metaDir
+// which holds its bucketConfig.
+const bucketConfigName = "config.json"
+
+// bucketConfig is the configuration of a bucket set with the S3 API
+type bucketConfig struct {
+	Versioning gofakes3.VersioningStatus `json:",omitempty"`
+	Lifecycle  *lifecycleConfiguration   `json:",omitempty"`
+}
+
+// bucketMetaDir returns the directory holding the configuration and
+// version tree for bucket
+func bucketMetaDir(bucket string) string {
+	return path.Join(metaDir, bucket)
+}
+
+// checkBucket returns BucketNotFound unless bucket exists and isn't
+// the hidden metaDir
+func checkBucket(_vfs *vfs.VFS, bucket string) error {
+	if bucket == metaDir {
+		return gofakes3.BucketNotFound(bucket)
+	}
+	if _, err := _vfs.Stat(bucket); err != nil {
+		return gofakes3.BucketNotFound(bucket)
+	}
+	return nil
+}
+
+// bucketConfigs returns whether the buckets can be configured.
+//
+// This needs a single VFS so isn't possible with the auth proxy.
+func (b *s3Backend) bucketConfigs() bool {
+	return b.s.proxy == nil
+}
+
+// _getConfig returns the configuration for bucket reading it from the
+// remote the first time it is used.
+//
+// Call with configMu held
+func (b *s3Backend) _getConfig(_vfs *vfs.VFS, bucket string) (config bucketConfig, err error) {
+	if config, ok := b.configs[bucket]; ok {
+		return config, nil
+	}
+	data, err := _vfs.ReadFile(path.Join(bucketMetaDir(bucket), bucketConfigName))
+	if err == nil {
+		err = json.Unmarshal(data, &config)
+		if err != nil {
+			return config, fmt.Errorf("failed to read config for bucket %q: %w", bucket, err)
+		}
+	} else if !errors.Is(err, vfs.ENOENT) {
+		return config, err
+	}
+	b.configs[bucket] = config
+	return config, nil
+}
+
+// getConfig returns the configuration for bucket
+func (b *s3Backend) getConfig(_vfs *vfs.VFS, bucket string) (config bucketConfig, err error) {
+	if !b.bucketConfigs() {
+		return config, nil
+	}
+	b.configMu.Lock()
+	defer b.configMu.Unlock()
+	return b._getConfig(_vfs, bucket)
+}
+
+// setConfig changes the configuration for bucket with fn and saves it
+func (b *s3Backend) setConfig(_vfs *vfs.VFS, bucket string, fn func(config *bucketConfig)) error {
+	if !b.bucketConfigs() {
+		return gofakes3.ErrNotImplemented
+	}
+	b.configMu.Lock()
+	defer b.configMu.Unlock()
+	config, err := b._getConfig(_vfs, bucket)
+	if err != nil {
+		return err
+	}
+	fn(&config)
+	data, err := json.MarshalIndent(config, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := mkdirRecursive(bucketMetaDir(bucket), _vfs); err != nil {
+		return err
+	}
+	err = _vfs.WriteFile(path.Join(bucketMetaDir(bucket), bucketConfigName), data, 0666)
+	if err != nil {
+		return fmt.Errorf("failed to write config for bucket %q: %w", bucket, err)
+	}
+	b.configs[bucket] = config
+	return nil
+}
+
+// removeConfig removes the configuration and the empty version tree
+// of a deleted bucket
+func (b *s3Backend) removeConfig(_vfs *vfs.VFS, bucket string) {
+	if !b.bucketConfigs() {
+		return
+	}
+	b.configMu.Lock()
+	defer b.configMu.Unlock()
+	delete(b.configs, bucket)
+	dir := bucketMetaDir(bucket)
+	if err := _vfs.Remove(path.Join(dir, bucketConfigName)); err != nil && !errors.Is(err, vfs.ENOENT) {
+		fs.Errorf(dir, "Failed to remove bucket config: %v", err)
+	}
+	for _, name := range []string{path.Join(dir, versionsDirName), path.Join(dir, stagingDirName), dir, metaDir} {
+		removeEmptyDir(_vfs, name)
+	}
+}
+
+// versioning returns the versioning status of bucket
+func (b *s3Backend) versioning(_vfs *vfs.VFS, bucket string) (gofakes3.VersioningStatus, error) {
+	config, err := b.getConfig(_vfs, bucket)
+	return config.Versioning, err
+}
@@ -0,0 +1,267 @@
+package s3
+
+// Decoding of the aws-chunked bodies of STREAMING-* uploads
+//
+// See https://docs.aws.amazon.com/AmazonS3/latest/API/sigv4-streaming.html
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/rclone/gofakes3"
+)
+
+const (
+	streamingSigned        = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	streamingSignedTrailer = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD-TRAILER"
+	emptySHA256            = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	maxSignedChunkSize     = 16 * 1024 * 1024 // signed chunks are read into memory to check them
+)
+
+// errSignatureDoesNotMatch is returned when a chunk signature is wrong
+const errSignatureDoesNotMatch = gofakes3.ErrorCode("SignatureDoesNotMatch")
+
+// chunkSigner checks the signatures of the chunks of a signed
+// streaming payload. Each chunk is signed with the signature of the
+// one before it starting from the seed signature of the request.
+type chunkSigner struct {
+	key     []byte // the signing key
+	date    string // X-Amz-Date of the request
+	scope   string // credential scope of the request
+	prevSig string // signature of the previous chunk
+}
+
+// newChunkSigner returns a chunkSigner for r whose V4 signature has
+// been checked with secret
+func newChunkSigner(r *http.Request, secret string) (*chunkSigner, error) {
+	auth := r.Header.Get("Authorization")
+	_, scope, _ := strings.Cut(authField(auth, "Credential"), "/")
+	seed := authField(auth, "Signature")
+	date := r.Header.Get("X-Amz-Date")
+	parts := strings.Split(scope, "/")
+	if len(parts) != 4 || seed == "" || date == "" {
+		return nil, errSignatureDoesNotMatch
+	}
+	// The scope is date/region/service/aws4_request which is what the
+	// signing key is derived from
+	key := []byte("AWS4" + secret)
+	for _, part := range parts {
+		key = hmacSHA256(key, part)
+	}
+	return &chunkSigner{
+		key:     key,
+		date:    date,
+		scope:   scope,
+		prevSig: seed,
+	}, nil
+}
+
+// authField returns the value of the named field of a V4
+// Authorization header or "" if not found
+func authField(auth, name string) string {
+	auth = strings.TrimPrefix(auth, "AWS4-HMAC-SHA256")
+	for field := range strings.SplitSeq(auth, ",") {
+		if value, ok := strings.CutPrefix(strings.TrimSpace(field), name+"="); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data with key
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// check checks sig signs the hashes of a chunk with the header for
+// its type
+func (s *chunkSigner) check(sig, header string, hashes ...string) error {
+	stringToSign := strings.Join(append([]string{header, s.date, s.scope, s.prevSig}, hashes...), "\n")
+	want := hex.EncodeToString(hmacSHA256(s.key, stringToSign))
+	if !hmac.Equal([]byte(sig), []byte(want)) {
+		return errSignatureDoesNotMatch
+	}
+	s.prevSig = sig
+	return nil
+}
+
+// sha256Hex returns the hex SHA256 of data
+func sha256Hex(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+// checkChunk checks sig is the signature of the chunk data
+func (s *chunkSigner) checkChunk(sig string, data []byte) error {
+	return s.check(sig, "AWS4-HMAC-SHA256-PAYLOAD", emptySHA256, sha256Hex(data))
+}
+
+// checkTrailer checks sig is the signature of the trailing headers
+func (s *chunkSigner) checkTrailer(sig string, trailer string) error {
+	return s.check(sig, "AWS4-HMAC-SHA256-TRAILER", sha256Hex([]byte(trailer)))
+}
+
+// chunkedReader decodes the aws-chunked encoding of the STREAMING-*
+// payloads.
+//
+// If signer is set the chunks are read whole and their signatures
+// checked before any of their data is returned. The trailers are only
+// checked if they are signed.
+type chunkedReader struct {
+	in        *bufio.Reader
+	signer    *chunkSigner // set to check the chunk signatures
+	trailer   bool         // set if signed trailers follow the final chunk
+	chunk     []byte       // buffer for the signed chunks
+	buf       []byte       // checked data left in chunk
+	unread    int64        // decoded bytes of the signed payload not read yet
+	remaining int64        // bytes left in the current unsigned chunk
+	done      bool         // set when the final chunk has been read
+}
+
+// newChunkedReader returns a reader to decode the aws-chunked in
+func newChunkedReader(in io.Reader) *chunkedReader {
+	return &chunkedReader{in: bufio.NewReader(in)}
+}
+
+// Read the decoded data
+func (r *chunkedReader) Read(p []byte) (n int, err error) {
+	for r.remaining == 0 && len(r.buf) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		err = r.nextChunk()
+		if err != nil {
+			return 0, err
+		}
+	}
+	if len(r.buf) > 0 {
+		n = copy(p, r.buf)
+		r.buf = r.buf[n:]
+		return n, nil
+	}
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err = r.in.Read(p)
+	r.remaining -= int64(n)
+	if err == io.EOF && r.remaining > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// readLine reads a line without its line ending
+func (r *chunkedReader) readLine() (string, error) {
+	line, err := r.in.ReadString('\n')
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// chunkHeader reads the header of the next chunk skipping the end of
+// the previous one
+func (r *chunkedReader) chunkHeader() (size int64, ext string, err error) {
+	line := ""
+	for line == "" {
+		line, err = r.readLine()
+		if err != nil {
+			return 0, "", err
+		}
+	}
+	sizeHex, ext, _ := strings.Cut(line, ";")
+	size, err = strconv.ParseInt(sizeHex, 16, 64)
+	if err != nil || size < 0 {
+		return 0, "", gofakes3.ErrIncompleteBody
+	}
+	return size, ext, nil
+}
+
+// signedChunk reads the data of a signed chunk and checks its
+// signature
+func (r *chunkedReader) signedChunk(size int64, ext string) ([]byte, error) {
+	sig, ok := strings.CutPrefix(ext, "chunk-signature=")
+	if !ok || size > maxSignedChunkSize {
+		return nil, errSignatureDoesNotMatch
+	}
+	if int64(cap(r.chunk)) < size {
+		r.chunk = make([]byte, size)
+	}
+	data := r.chunk[:size]
+	if _, err := io.ReadFull(r.in, data); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return data, r.signer.checkChunk(sig, data)
+}
+
+// nextChunk reads the header of the next chunk and the data too if
+// it is signed
+func (r *chunkedReader) nextChunk() error {
+	size, ext, err := r.chunkHeader()
+	if err != nil {
+		return err
+	}
+	r.done = size == 0
+	if r.signer == nil {
+		r.remaining = size
+		return nil
+	}
+	r.buf, err = r.signedChunk(size, ext)
+	if err != nil {
+		return err
+	}
+	r.unread -= size
+	// Check the end of the payload as soon as all the data is read
+	// as the reader might not be read to EOF
+	if !r.done && r.unread == 0 {
+		size, ext, err = r.chunkHeader()
+		if err != nil {
+			return err
+		}
+		if size != 0 {
+			return gofakes3.ErrIncompleteBody
+		}
+		if _, err = r.signedChunk(0, ext); err != nil {
+			return err
+		}
+		r.done = true
+	}
+	if r.unread < 0 || (r.done && r.unread != 0) {
+		return gofakes3.ErrIncompleteBody
+	}
+	if r.done && r.trailer {
+		return r.readTrailer()
+	}
+	return nil
+}
+
+// readTrailer reads the trailing headers after the final chunk and
+// checks their signature
+func (r *chunkedReader) readTrailer() error {
+	var trailer strings.Builder
+	for trailer.Len() <= maxSignedChunkSize {
+		line, err := r.readLine()
+		if err != nil {
+			return err
+		}
+		if line == "" {
+			continue
+		}
+		if sig, ok := strings.CutPrefix(line, "x-amz-trailer-signature:"); ok {
+			return r.signer.checkTrailer(sig, trailer.String())
+		}
+		trailer.WriteString(line + "\n")
+	}
+	return errSignatureDoesNotMatch
+}
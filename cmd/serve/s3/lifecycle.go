@@ -0,0 +1,269 @@
+package s3
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rclone/gofakes3"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/vfs"
+)
+
+// errNoSuchLifecycleConfiguration is returned when a bucket has no
+// lifecycle rules
+const errNoSuchLifecycleConfiguration = gofakes3.ErrorCode("NoSuchLifecycleConfiguration")
+
+// lifecycleConfiguration is the body of the PutBucketLifecycleConfiguration
+// and GetBucketLifecycleConfiguration calls
+type lifecycleConfiguration struct {
+	XMLName xml.Name        `xml:"LifecycleConfiguration" json:"-"`
+	Xmlns   string          `xml:"xmlns,attr,omitempty" json:"-"`
+	Rules   []lifecycleRule `xml:"Rule"`
+}
+
+// lifecycleRule is a single lifecycle rule
+//
+// Only the expiration actions are supported.
+type lifecycleRule struct {
+	ID                          string                       `xml:"ID,omitempty" json:",omitempty"`
+	Prefix                      string                       `xml:"Prefix,omitempty" json:",omitempty"` // deprecated in favour of Filter
+	Filter                      *lifecycleFilter             `xml:"Filter,omitempty" json:",omitempty"`
+	Status                      string                       `xml:"Status"`
+	Expiration                  *lifecycleExpiration         `xml:"Expiration,omitempty" json:",omitempty"`
+	NoncurrentVersionExpiration *noncurrentVersionExpiration `xml:"NoncurrentVersionExpiration,omitempty" json:",omitempty"`
+}
+
+// lifecycleFilter selects the objects a rule applies to
+type lifecycleFilter struct {
+	Prefix string `xml:"Prefix,omitempty" json:",omitempty"`
+}
+
+// lifecycleExpiration expires the current versions of objects
+type lifecycleExpiration struct {
+	Days                      int        `xml:"Days,omitempty" json:",omitempty"`
+	Date                      *time.Time `xml:"Date,omitempty" json:",omitempty"`
+	ExpiredObjectDeleteMarker bool       `xml:"ExpiredObjectDeleteMarker,omitempty" json:",omitempty"`
+}
+
+// noncurrentVersionExpiration removes versions which have been
+// noncurrent for NoncurrentDays
+type noncurrentVersionExpiration struct {
+	NoncurrentDays int `xml:"NoncurrentDays"`
+}
+
+// prefix returns the key prefix the rule applies to
+func (rule *lifecycleRule) prefix() string {
+	if rule.Filter != nil {
+		return rule.Filter.Prefix
+	}
+	return rule.Prefix
+}
+
+// enabled returns whether the rule is enabled
+func (rule *lifecycleRule) enabled() bool {
+	return rule.Status == "Enabled"
+}
+
+// check the lifecycle configuration is valid
+func (config *lifecycleConfiguration) check() error {
+	if len(config.Rules) == 0 {
+		return gofakes3.ErrMalformedXML
+	}
+	for _, rule := range config.Rules {
+		if rule.Status != "Enabled" && rule.Status != "Disabled" {
+			return gofakes3.ErrMalformedXML
+		}
+		exp, nce := rule.Expiration, rule.NoncurrentVersionExpiration
+		if exp == nil && nce == nil {
+			return gofakes3.ErrorMessage(gofakes3.ErrInvalidArgument, "At least one action needs to be specified in a rule")
+		}
+		if (exp != nil && exp.Days < 0) || (nce != nil && nce.NoncurrentDays <= 0) {
+			return gofakes3.ErrorMessage(gofakes3.ErrInvalidArgument, "'Days' in the lifecycle action must be a positive integer")
+		}
+	}
+	return nil
+}
+
+// serveLifecycle implements the Put, Get and DeleteBucketLifecycle calls
+func (b *s3Backend) serveLifecycle(w http.ResponseWriter, r *http.Request, bucket string) error {
+	if !b.bucketConfigs() {
+		return gofakes3.ErrNotImplemented
+	}
+	_vfs, err := b.s.getVFS(r.Context())
+	if err != nil {
+		return err
+	}
+	if err := checkBucket(_vfs, bucket); err != nil {
+		return err
+	}
+	switch r.Method {
+	case http.MethodGet:
+		config, err := b.getConfig(_vfs, bucket)
+		if err != nil {
+			return err
+		}
+		if config.Lifecycle == nil {
+			return errNoSuchLifecycleConfiguration
+		}
+		out := *config.Lifecycle
+		out.Xmlns = s3Xmlns
+		return writeXML(w, out)
+	case http.MethodPut:
+		var in lifecycleConfiguration
+		if err := xml.NewDecoder(r.Body).Decode(&in); err != nil {
+			return gofakes3.ErrMalformedXML
+		}
+		if err := in.check(); err != nil {
+			return err
+		}
+		return b.setConfig(_vfs, bucket, func(config *bucketConfig) {
+			config.Lifecycle = &in
+		})
+	case http.MethodDelete:
+		err := b.setConfig(_vfs, bucket, func(config *bucketConfig) {
+			config.Lifecycle = nil
+		})
+		if err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	return gofakes3.ErrMethodNotAllowed
+}
+
+// runLifecycle applies the lifecycle rules every interval until ctx
+// is cancelled
+func (b *s3Backend) runLifecycle(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := b.applyLifecycle(ctx, time.Now()); err != nil {
+				fs.Errorf("serve s3", "Failed to apply lifecycle rules: %v", err)
+			}
+		}
+	}
+}
+
+// applyLifecycle applies the lifecycle rules of all the buckets as if
+// the time was now
+func (b *s3Backend) applyLifecycle(ctx context.Context, now time.Time) error {
+	_vfs, err := b.s.getVFS(ctx)
+	if err != nil {
+		return err
+	}
+	buckets, err := getDirEntries(metaDir, _vfs)
+	if err == gofakes3.ErrNoSuchKey {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, entry := range buckets {
+		bucket := entry.Name()
+		if !entry.IsDir() {
+			continue
+		}
+		if checkBucket(_vfs, bucket) != nil {
+			continue
+		}
+		config, err := b.getConfig(_vfs, bucket)
+		if err != nil {
+			fs.Errorf(bucket, "Failed to read bucket config: %v", err)
+			continue
+		}
+		if config.Lifecycle == nil {
+			continue
+		}
+		for _, rule := range config.Lifecycle.Rules {
+			if rule.enabled() {
+				b.applyRule(ctx, _vfs, bucket, &rule, now)
+			}
+		}
+	}
+	return nil
+}
+
+// applyRule applies the lifecycle rule to bucket
+func (b *s3Backend) applyRule(ctx context.Context, _vfs *vfs.VFS, bucket string, rule *lifecycleRule, now time.Time) {
+	prefix := rule.prefix()
+	if exp := rule.Expiration; exp != nil && (exp.Days > 0 || exp.Date != nil) {
+		cutoff := now.AddDate(0, 0, -exp.Days)
+		if exp.Date != nil {
+			cutoff = now
+			if now.Before(*exp.Date) {
+				cutoff = time.Time{}
+			}
+		}
+		var expired []string
+		err := walkFiles(_vfs, bucket, func(key string, node vfs.Node) {
+			if strings.HasPrefix(key, prefix) && node.ModTime().Before(cutoff) {
+				expired = append(expired, key)
+			}
+		})
+		if err != nil {
+			fs.Errorf(bucket, "Lifecycle rule %q: failed to list objects: %v", rule.ID, err)
+		}
+		for _, key := range expired {
+			if _, err := b.DeleteObject(ctx, bucket, key); err != nil {
+				fs.Errorf(path.Join(bucket, key), "Lifecycle rule %q: failed to expire: %v", rule.ID, err)
+			} else {
+				fs.Infof(path.Join(bucket, key), "Lifecycle rule %q: expired", rule.ID)
+			}
+		}
+	}
+
+	nce := rule.NoncurrentVersionExpiration
+	removeMarkers := rule.Expiration != nil && rule.Expiration.ExpiredObjectDeleteMarker
+	if nce == nil && !removeMarkers {
+		return
+	}
+	keys, err := b.versionKeys(_vfs, bucket)
+	if err != nil {
+		fs.Errorf(bucket, "Lifecycle rule %q: failed to list versions: %v", rule.ID, err)
+		return
+	}
+	for _, key := range keys {
+		if strings.HasPrefix(key, prefix) {
+			b.expireVersions(_vfs, bucket, key, rule, now)
+		}
+	}
+}
+
+// expireVersions removes the noncurrent versions and the expired
+// delete markers of key according to rule
+func (b *s3Backend) expireVersions(_vfs *vfs.VFS, bucket, key string, rule *lifecycleRule, now time.Time) {
+	defer b.lockKey(bucket, key)()
+	versions, err := b.listVersions(_vfs, bucket, key)
+	if err != nil {
+		fs.Errorf(path.Join(bucket, key), "Lifecycle rule %q: failed to list versions: %v", rule.ID, err)
+		return
+	}
+	var remove []objectVersion
+	if nce := rule.NoncurrentVersionExpiration; nce != nil {
+		cutoff := now.AddDate(0, 0, -nce.NoncurrentDays)
+		// A version becomes noncurrent when the next one is made
+		for i := 1; i < len(versions); i++ {
+			if versions[i-1].created.Before(cutoff) {
+				remove = append(remove, versions[i])
+			}
+		}
+	}
+	if len(remove) == len(versions)-1 && versions[0].deleteMarker && rule.Expiration != nil && rule.Expiration.ExpiredObjectDeleteMarker {
+		remove = append(remove, versions[0])
+	}
+	for _, v := range remove {
+		if err := b.deleteVersion(_vfs, bucket, key, v, false); err != nil {
+			fs.Errorf(path.Join(bucket, key), "Lifecycle rule %q: failed to remove version %q: %v", rule.ID, v.id, err)
+		} else {
+			fs.Infof(path.Join(bucket, key), "Lifecycle rule %q: removed version %q", rule.ID, v.id)
+		}
+	}
+}
@@ -0,0 +1,918 @@
+package s3
+
+// Multipart uploads
+//
+// gofakes3 assembles multipart uploads in memory before passing them
+// to PutObject so serve s3 implements the multipart calls itself.
+//
+// If the remote supports OpenChunkWriter each part is streamed
+// straight to the remote as a chunk. Otherwise the parts are stored
+// in files in the rclone cache directory and copied into the VFS
+// when the upload is completed.
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ncw/swift/v2"
+	"github.com/rclone/gofakes3"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/lib/multipart"
+	"github.com/rclone/rclone/lib/random"
+	"github.com/rclone/rclone/vfs"
+)
+
+// uploadsDirName is the directory in the rclone cache directory which
+// holds the parts of the multipart uploads which aren't streamed to
+// the remote.
+const uploadsDirName = "serve-s3-uploads"
+
+// defaultMaxParts is the default and maximum number of parts returned
+// by ListParts and of uploads returned by ListMultipartUploads
+const defaultMaxParts = 1000
+
+// uploadExpiryInterval is the longest time between checks for
+// expired multipart uploads
+const uploadExpiryInterval = 10 * time.Minute
+
+// multipartUpload is an in progress multipart upload
+type multipartUpload struct {
+	id        gofakes3.UploadID
+	vfs       *vfs.VFS
+	bucket    string
+	key       string
+	meta      map[string]string
+	initiated time.Time
+	writer    fs.ChunkWriter // set if the parts are streamed to the remote
+	dir       string         // directory holding the parts if not
+
+	mu      sync.Mutex // protects the below
+	parts   map[int]*uploadPart
+	writing map[int]int    // number of uploads of each part in progress
+	used    time.Time      // when a part was last uploaded
+	closed  bool           // set once completed or aborted
+	active  sync.WaitGroup // parts being uploaded
+}
+
+// uploadPart is an uploaded part of a multipartUpload
+type uploadPart struct {
+	number   int
+	md5      []byte
+	size     int64
+	modified time.Time
+	file     string // file holding the part if it isn't streamed
+}
+
+// etag returns the quoted ETag of the part
+func (p *uploadPart) etag() string {
+	return `"` + hex.EncodeToString(p.md5) + `"`
+}
+
+// initiateMultipartUploadResult is the response to CreateMultipartUpload
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name          `xml:"InitiateMultipartUploadResult"`
+	Xmlns    string            `xml:"xmlns,attr"`
+	Bucket   string            `xml:"Bucket"`
+	Key      string            `xml:"Key"`
+	UploadID gofakes3.UploadID `xml:"UploadId"`
+}
+
+// completeMultipartUploadResult is the response to CompleteMultipartUpload
+type completeMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
+}
+
+// copyPartResult is the response to UploadPartCopy
+type copyPartResult struct {
+	XMLName      xml.Name `xml:"CopyPartResult"`
+	Xmlns        string   `xml:"xmlns,attr"`
+	ETag         string   `xml:"ETag"`
+	LastModified string   `xml:"LastModified"`
+}
+
+// listPartsResult is the response to ListParts
+type listPartsResult struct {
+	XMLName              xml.Name          `xml:"ListPartsResult"`
+	Xmlns                string            `xml:"xmlns,attr"`
+	Bucket               string            `xml:"Bucket"`
+	Key                  string            `xml:"Key"`
+	UploadID             gofakes3.UploadID `xml:"UploadId"`
+	PartNumberMarker     int               `xml:"PartNumberMarker"`
+	NextPartNumberMarker int               `xml:"NextPartNumberMarker"`
+	MaxParts             int               `xml:"MaxParts"`
+	IsTruncated          bool              `xml:"IsTruncated"`
+	Parts                []listPartsItem   `xml:"Part"`
+}
+
+// listPartsItem is a part in the ListParts response
+type listPartsItem struct {
+	PartNumber   int    `xml:"PartNumber"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+}
+
+// listMultipartUploadsResult is the response to ListMultipartUploads
+type listMultipartUploadsResult struct {
+	XMLName            xml.Name              `xml:"ListMultipartUploadsResult"`
+	Xmlns              string                `xml:"xmlns,attr"`
+	Bucket             string                `xml:"Bucket"`
+	KeyMarker          string                `xml:"KeyMarker"`
+	UploadIDMarker     gofakes3.UploadID     `xml:"UploadIdMarker"`
+	NextKeyMarker      string                `xml:"NextKeyMarker,omitempty"`
+	NextUploadIDMarker gofakes3.UploadID     `xml:"NextUploadIdMarker,omitempty"`
+	Prefix             string                `xml:"Prefix"`
+	MaxUploads         int                   `xml:"MaxUploads"`
+	IsTruncated        bool                  `xml:"IsTruncated"`
+	Uploads            []listMultipartUpload `xml:"Upload"`
+}
+
+// listMultipartUpload is an upload in the ListMultipartUploads response
+type listMultipartUpload struct {
+	Key       string            `xml:"Key"`
+	UploadID  gofakes3.UploadID `xml:"UploadId"`
+	Initiated string            `xml:"Initiated"`
+}
+
+// formatXMLTime formats t like the timestamps in the S3 XML responses
+func formatXMLTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+// metadataHeaders returns the object metadata from the headers of a
+// CreateMultipartUpload request like gofakes3 does for PutObject
+func metadataHeaders(header http.Header, now time.Time) map[string]string {
+	meta := make(map[string]string)
+	for k, v := range header {
+		if k == "Content-Length" || k == "Content-Md5" {
+			continue
+		}
+		if strings.HasPrefix(k, "X-Amz-") || strings.HasPrefix(k, "Content-") || k == "Cache-Control" {
+			meta[k] = v[0]
+		}
+	}
+	meta["Last-Modified"] = formatHeaderTime(now)
+	return meta
+}
+
+// serveMultipart implements CreateMultipartUpload, UploadPart,
+// UploadPartCopy, CompleteMultipartUpload, AbortMultipartUpload,
+// ListParts and ListMultipartUploads
+func (b *s3Backend) serveMultipart(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	_vfs, err := b.s.getVFS(r.Context())
+	if err != nil {
+		return err
+	}
+	if err := checkBucket(_vfs, bucket); err != nil {
+		return err
+	}
+	query := r.URL.Query()
+	if _, ok := query["uploadId"]; !ok {
+		switch {
+		case r.Method == http.MethodPost && key != "":
+			return b.createMultipartUpload(w, r, _vfs, bucket, key)
+		case r.Method == http.MethodGet && key == "":
+			return b.listMultipartUploads(w, r, _vfs, bucket)
+		}
+		return gofakes3.ErrMethodNotAllowed
+	}
+	u, err := b.getUpload(_vfs, bucket, key, gofakes3.UploadID(query.Get("uploadId")))
+	if err != nil {
+		return err
+	}
+	switch r.Method {
+	case http.MethodPut:
+		return b.uploadPart(w, r, u)
+	case http.MethodGet:
+		return b.listParts(w, r, u)
+	case http.MethodDelete:
+		return b.abortMultipartUpload(w, u)
+	case http.MethodPost:
+		return b.completeMultipartUpload(w, r, u)
+	}
+	return gofakes3.ErrMethodNotAllowed
+}
+
+// getUpload returns the upload with id checking it is for key in
+// bucket of _vfs
+func (b *s3Backend) getUpload(_vfs *vfs.VFS, bucket, key string, id gofakes3.UploadID) (*multipartUpload, error) {
+	b.uploadsMu.Lock()
+	defer b.uploadsMu.Unlock()
+	u, ok := b.uploads[id]
+	if !ok || u.vfs != _vfs || u.bucket != bucket || u.key != key {
+		return nil, gofakes3.ErrNoSuchUpload
+	}
+	return u, nil
+}
+
+// removeUpload removes u from the in progress uploads
+func (b *s3Backend) removeUpload(u *multipartUpload) {
+	b.uploadsMu.Lock()
+	defer b.uploadsMu.Unlock()
+	delete(b.uploads, u.id)
+}
+
+// uploadsDir returns the directory for the parts of the uploads,
+// creating it if necessary
+func uploadsDir() (string, error) {
+	dir := filepath.Join(config.GetCacheDir(), uploadsDirName)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create multipart upload directory: %w", err)
+	}
+	return dir, nil
+}
+
+// createMultipartUpload starts a new multipart upload
+func (b *s3Backend) createMultipartUpload(w http.ResponseWriter, r *http.Request, _vfs *vfs.VFS, bucket, key string) (err error) {
+	if _vfs.Opt.ReadOnly {
+		return vfs.EROFS
+	}
+	now := time.Now()
+	u := &multipartUpload{
+		id:        gofakes3.UploadID(random.String(32)),
+		vfs:       _vfs,
+		bucket:    bucket,
+		key:       key,
+		meta:      metadataHeaders(r.Header, now),
+		initiated: now,
+		parts:     make(map[int]*uploadPart),
+		writing:   make(map[int]int),
+		used:      now,
+	}
+
+	// Stream the parts to the remote if it can take chunks, unless
+	// the upload needs to go through the VFS to be counted against
+	// the quota.
+	f := _vfs.Fs()
+	openChunkWriter := f.Features().OpenChunkWriter
+	if openChunkWriter != nil && _vfs.Opt.QuotaBytes < 0 && _vfs.Opt.QuotaFiles < 0 {
+		modTime := now
+		if val, ok := u.meta["X-Amz-Meta-Mtime"]; ok {
+			if t, err := swift.FloatStringToTime(val); err == nil {
+				modTime = t
+			}
+		}
+		src := object.NewStaticObjectInfo(path.Join(bucket, key), modTime, -1, true, nil, f)
+		// The chunk writer outlives this request
+		_, u.writer, err = openChunkWriter(b.s.ctx, src.Remote(), src)
+		if err != nil {
+			return fmt.Errorf("failed to start multipart upload: %w", err)
+		}
+	} else {
+		dir, err := uploadsDir()
+		if err != nil {
+			return err
+		}
+		u.dir, err = os.MkdirTemp(dir, "upload-")
+		if err != nil {
+			return fmt.Errorf("failed to start multipart upload: %w", err)
+		}
+	}
+
+	b.uploadsMu.Lock()
+	b.uploads[u.id] = u
+	b.uploadsMu.Unlock()
+	fs.Debugf(path.Join(bucket, key), "Started multipart upload %q", u.id)
+
+	return writeXML(w, initiateMultipartUploadResult{
+		Xmlns:    s3Xmlns,
+		Bucket:   bucket,
+		Key:      key,
+		UploadID: u.id,
+	})
+}
+
+// partBody returns the body of an UploadPart request and its size
+func (b *s3Backend) partBody(r *http.Request) (in io.Reader, size int64, err error) {
+	in, size = r.Body, r.ContentLength
+	if contentSha256 := r.Header.Get("X-Amz-Content-Sha256"); strings.HasPrefix(contentSha256, "STREAMING-") {
+		size, err = strconv.ParseInt(r.Header.Get("X-Amz-Decoded-Content-Length"), 10, 64)
+		if err != nil {
+			return nil, 0, gofakes3.ErrMissingContentLength
+		}
+		chunked := newChunkedReader(r.Body)
+		// The body isn't covered by the request signature so the
+		// chunk signatures must be checked
+		secret, checked := b.s.secretKey(r)
+		if checked && (contentSha256 == streamingSigned || contentSha256 == streamingSignedTrailer) {
+			chunked.signer, err = newChunkSigner(r, secret)
+			if err != nil {
+				return nil, 0, err
+			}
+			chunked.trailer = contentSha256 == streamingSignedTrailer
+			chunked.unread = size
+		}
+		in = chunked
+	}
+	if size < 0 {
+		return nil, 0, gofakes3.ErrMissingContentLength
+	}
+	return in, size, nil
+}
+
+// openCopySource opens the source of an UploadPartCopy request
+func (b *s3Backend) openCopySource(_vfs *vfs.VFS, source, sourceRange string) (in io.ReadCloser, size int64, err error) {
+	source, query, _ := strings.Cut(source, "?")
+	source, err = url.PathUnescape(strings.TrimPrefix(source, "/"))
+	if err != nil {
+		return nil, 0, gofakes3.ErrInvalidArgument
+	}
+	bucket, key, ok := strings.Cut(source, "/")
+	if !ok || key == "" {
+		return nil, 0, gofakes3.ErrInvalidArgument
+	}
+	if err := checkBucket(_vfs, bucket); err != nil {
+		return nil, 0, err
+	}
+	fp := path.Join(bucket, key)
+	values, _ := url.ParseQuery(query)
+	if id := versionFromQuery(values); id != "" {
+		v, err := b.findVersion(_vfs, bucket, key, id)
+		if err != nil {
+			return nil, 0, err
+		}
+		if v.deleteMarker {
+			return nil, 0, gofakes3.KeyNotFound(key)
+		}
+		fp = versionPath(bucket, key, v)
+	}
+	node, err := _vfs.Stat(fp)
+	if err != nil || !node.IsFile() {
+		return nil, 0, gofakes3.KeyNotFound(key)
+	}
+	start, size := int64(0), node.Size()
+	if sourceRange != "" {
+		var end int64
+		_, err := fmt.Sscanf(sourceRange, "bytes=%d-%d", &start, &end)
+		if err != nil || start < 0 || end < start || end >= size {
+			return nil, 0, gofakes3.ErrInvalidRange
+		}
+		size = end - start + 1
+	}
+	fh, err := node.(*vfs.File).Open(os.O_RDONLY)
+	if err != nil {
+		return nil, 0, err
+	}
+	if start > 0 {
+		if _, err := fh.Seek(start, io.SeekStart); err != nil {
+			_ = fh.Close()
+			return nil, 0, err
+		}
+	}
+	return fh, size, nil
+}
+
+// begin starts the upload of part number
+//
+// The chunks written to the remote can't be replaced as the chunk
+// writer would be given the part twice, so a part which has been or
+// is being streamed can't be uploaded again.
+func (u *multipartUpload) begin(number int) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.closed {
+		return gofakes3.ErrNoSuchUpload
+	}
+	if u.writer != nil && (u.writing[number] > 0 || u.parts[number] != nil) {
+		return gofakes3.ErrorMessagef(gofakes3.ErrInvalidPart, "Part %d has already been uploaded and can't be replaced", number)
+	}
+	u.writing[number]++
+	u.active.Add(1)
+	return nil
+}
+
+// end finishes the upload of part number, recording it if it was
+// uploaded successfully
+func (u *multipartUpload) end(number int, part *uploadPart) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.writing[number]--; u.writing[number] == 0 {
+		delete(u.writing, number)
+	}
+	switch {
+	case part == nil:
+	case u.closed:
+		// too late - the parts to complete with have been chosen
+		if part.file != "" {
+			_ = os.Remove(part.file)
+		}
+	default:
+		if old := u.parts[number]; old != nil && old.file != "" {
+			_ = os.Remove(old.file)
+		}
+		u.parts[number] = part
+	}
+	u.used = time.Now()
+	u.active.Done()
+}
+
+// writePart stores size bytes from in as part number, checking them
+// against md5Base64 if set
+func (u *multipartUpload) writePart(ctx context.Context, number int, in io.Reader, size int64, md5Base64 string) (part *uploadPart, err error) {
+	var file string
+	hasher := md5.New()
+	in = io.TeeReader(io.LimitReader(in, size), hasher)
+	checkBody := func(n int64) error {
+		if n != size {
+			return gofakes3.ErrIncompleteBody
+		}
+		if md5Base64 != "" && base64.StdEncoding.EncodeToString(hasher.Sum(nil)) != md5Base64 {
+			return gofakes3.ErrBadDigest
+		}
+		return nil
+	}
+	if u.writer != nil {
+		rw := multipart.NewRW()
+		defer fs.CheckClose(rw, &err)
+		n, err := io.Copy(rw, in)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkBody(n); err != nil {
+			return nil, err
+		}
+		if _, err := u.writer.WriteChunk(ctx, number-1, rw); err != nil {
+			return nil, fmt.Errorf("failed to upload part %d: %w", number, err)
+		}
+	} else {
+		// Each upload of a part gets its own file so a part
+		// uploaded again doesn't overwrite one being used
+		f, err := os.CreateTemp(u.dir, fmt.Sprintf("%05d-*", number))
+		if err != nil {
+			return nil, err
+		}
+		file = f.Name()
+		n, err := io.Copy(f, in)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = checkBody(n)
+		}
+		if err != nil {
+			_ = os.Remove(file)
+			return nil, err
+		}
+	}
+	return &uploadPart{
+		number:   number,
+		md5:      hasher.Sum(nil),
+		size:     size,
+		modified: time.Now(),
+		file:     file,
+	}, nil
+}
+
+// uploadPart implements UploadPart and UploadPartCopy
+func (b *s3Backend) uploadPart(w http.ResponseWriter, r *http.Request, u *multipartUpload) (err error) {
+	number, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	if err != nil || number < 1 || number > gofakes3.MaxUploadPartNumber {
+		return gofakes3.ErrInvalidPart
+	}
+	if err := u.begin(number); err != nil {
+		return err
+	}
+	ended := false
+	defer func() {
+		if !ended {
+			u.end(number, nil)
+		}
+	}()
+
+	var (
+		in     io.Reader
+		size   int64
+		source = r.Header.Get("X-Amz-Copy-Source")
+	)
+	if source != "" {
+		rc, n, err := b.openCopySource(u.vfs, source, r.Header.Get("X-Amz-Copy-Source-Range"))
+		if err != nil {
+			return err
+		}
+		defer fs.CheckClose(rc, &err)
+		in, size = rc, n
+	} else {
+		in, size, err = b.partBody(r)
+		if err != nil {
+			return err
+		}
+	}
+
+	part, err := u.writePart(r.Context(), number, in, size, r.Header.Get("Content-MD5"))
+	if err != nil {
+		return err
+	}
+	// Record the part before the client is told it has been uploaded
+	u.end(number, part)
+	ended = true
+
+	if source != "" {
+		return writeXML(w, copyPartResult{
+			Xmlns:        s3Xmlns,
+			ETag:         part.etag(),
+			LastModified: formatXMLTime(part.modified),
+		})
+	}
+	w.Header().Set("ETag", part.etag())
+	return nil
+}
+
+// listParts implements ListParts
+func (b *s3Backend) listParts(w http.ResponseWriter, r *http.Request, u *multipartUpload) error {
+	query := r.URL.Query()
+	marker, maxParts := 0, defaultMaxParts
+	if s := query.Get("part-number-marker"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return gofakes3.ErrInvalidArgument
+		}
+		marker = n
+	}
+	if s := query.Get("max-parts"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return gofakes3.ErrInvalidArgument
+		}
+		maxParts = min(n, defaultMaxParts)
+	}
+
+	u.mu.Lock()
+	parts := make([]*uploadPart, 0, len(u.parts))
+	for _, part := range u.parts {
+		if part.number > marker {
+			parts = append(parts, part)
+		}
+	}
+	u.mu.Unlock()
+	slices.SortFunc(parts, func(a, b *uploadPart) int {
+		return a.number - b.number
+	})
+
+	result := listPartsResult{
+		Xmlns:            s3Xmlns,
+		Bucket:           u.bucket,
+		Key:              u.key,
+		UploadID:         u.id,
+		PartNumberMarker: marker,
+		MaxParts:         maxParts,
+	}
+	for _, part := range parts {
+		if len(result.Parts) >= maxParts {
+			result.IsTruncated = true
+			break
+		}
+		result.Parts = append(result.Parts, listPartsItem{
+			PartNumber:   part.number,
+			LastModified: formatXMLTime(part.modified),
+			ETag:         part.etag(),
+			Size:         part.size,
+		})
+		result.NextPartNumberMarker = part.number
+	}
+	return writeXML(w, result)
+}
+
+// listMultipartUploads implements ListMultipartUploads
+func (b *s3Backend) listMultipartUploads(w http.ResponseWriter, r *http.Request, _vfs *vfs.VFS, bucket string) error {
+	query := r.URL.Query()
+	result := listMultipartUploadsResult{
+		Xmlns:          s3Xmlns,
+		Bucket:         bucket,
+		KeyMarker:      query.Get("key-marker"),
+		UploadIDMarker: gofakes3.UploadID(query.Get("upload-id-marker")),
+		Prefix:         query.Get("prefix"),
+		MaxUploads:     defaultMaxParts,
+	}
+	if s := query.Get("max-uploads"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return gofakes3.ErrInvalidArgument
+		}
+		result.MaxUploads = min(n, defaultMaxParts)
+	}
+
+	b.uploadsMu.Lock()
+	var uploads []*multipartUpload
+	for _, u := range b.uploads {
+		if u.vfs == _vfs && u.bucket == bucket && strings.HasPrefix(u.key, result.Prefix) {
+			uploads = append(uploads, u)
+		}
+	}
+	b.uploadsMu.Unlock()
+	slices.SortFunc(uploads, func(a, b *multipartUpload) int {
+		if c := strings.Compare(a.key, b.key); c != 0 {
+			return c
+		}
+		if c := a.initiated.Compare(b.initiated); c != 0 {
+			return c
+		}
+		return strings.Compare(string(a.id), string(b.id))
+	})
+
+	// Skip the uploads up to and including the markers
+	pastMarker := false
+	for _, u := range uploads {
+		if u.key < result.KeyMarker {
+			continue
+		}
+		if u.key == result.KeyMarker && !pastMarker {
+			pastMarker = result.UploadIDMarker != "" && u.id == result.UploadIDMarker
+			continue
+		}
+		if len(result.Uploads) >= result.MaxUploads {
+			result.IsTruncated = true
+			break
+		}
+		result.Uploads = append(result.Uploads, listMultipartUpload{
+			Key:       u.key,
+			UploadID:  u.id,
+			Initiated: formatXMLTime(u.initiated),
+		})
+		result.NextKeyMarker, result.NextUploadIDMarker = u.key, u.id
+	}
+	return writeXML(w, result)
+}
+
+// close checks the parts the upload is to be completed with, stops
+// any more parts being uploaded and returns the parts in order.
+func (u *multipartUpload) close(completed []gofakes3.CompletedPart) ([]*uploadPart, error) {
+	u.mu.Lock()
+	if u.closed {
+		u.mu.Unlock()
+		return nil, gofakes3.ErrNoSuchUpload
+	}
+	if len(completed) == 0 {
+		u.mu.Unlock()
+		return nil, gofakes3.ErrMalformedXML
+	}
+	parts := make([]*uploadPart, 0, len(completed))
+	for i, c := range completed {
+		if i > 0 && c.PartNumber <= completed[i-1].PartNumber {
+			u.mu.Unlock()
+			return nil, gofakes3.ErrInvalidPartOrder
+		}
+		part, ok := u.parts[c.PartNumber]
+		if !ok || strings.Trim(c.ETag, `"`) != strings.Trim(part.etag(), `"`) {
+			u.mu.Unlock()
+			return nil, gofakes3.ErrInvalidPart
+		}
+		parts = append(parts, part)
+	}
+	// The chunks written to the remote can't be left out or reordered
+	if u.writer != nil && (len(parts) != len(u.parts) || parts[len(parts)-1].number != len(parts)) {
+		u.mu.Unlock()
+		return nil, gofakes3.ErrorMessage(gofakes3.ErrInvalidPart, "All the uploaded parts must be used and numbered from 1 with no gaps")
+	}
+	u.closed = true
+	u.mu.Unlock()
+	u.active.Wait()
+	return parts, nil
+}
+
+// cleanup removes the parts of a finished upload, aborting it on the
+// remote if it wasn't completed
+func (u *multipartUpload) cleanup(ctx context.Context) {
+	if u.writer != nil {
+		if err := u.writer.Abort(ctx); err != nil {
+			fs.Errorf(path.Join(u.bucket, u.key), "Failed to abort multipart upload %q: %v", u.id, err)
+		}
+		u.writer = nil
+	}
+	if u.dir != "" {
+		if err := os.RemoveAll(u.dir); err != nil {
+			fs.Errorf(path.Join(u.bucket, u.key), "Failed to remove parts of multipart upload %q: %v", u.id, err)
+		}
+	}
+}
+
+// partsReader reads the part files in turn
+type partsReader struct {
+	paths []string
+	file  *os.File
+}
+
+// Read from the current part file, opening the next when it is done
+func (pr *partsReader) Read(p []byte) (n int, err error) {
+	for {
+		if pr.file == nil {
+			if len(pr.paths) == 0 {
+				return 0, io.EOF
+			}
+			pr.file, err = os.Open(pr.paths[0])
+			if err != nil {
+				return 0, err
+			}
+			pr.paths = pr.paths[1:]
+		}
+		n, err = pr.file.Read(p)
+		if err == io.EOF {
+			_ = pr.file.Close()
+			pr.file = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+// Close the current part file
+func (pr *partsReader) Close() error {
+	if pr.file == nil {
+		return nil
+	}
+	return pr.file.Close()
+}
+
+// completeMultipartUpload implements CompleteMultipartUpload
+func (b *s3Backend) completeMultipartUpload(w http.ResponseWriter, r *http.Request, u *multipartUpload) (err error) {
+	var in gofakes3.CompleteMultipartUploadRequest
+	if err := xml.NewDecoder(r.Body).Decode(&in); err != nil {
+		return gofakes3.ErrMalformedXML
+	}
+	parts, err := u.close(in.Parts)
+	if err != nil {
+		return err
+	}
+	b.removeUpload(u)
+	defer u.cleanup(r.Context())
+
+	// The ETag of a multipart object is the MD5 of the MD5s of the parts
+	hasher := md5.New()
+	for _, part := range parts {
+		hasher.Write(part.md5)
+	}
+	etag := fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(hasher.Sum(nil)), len(parts))
+
+	// The chunk writer can only make the object in place but the
+	// parts have already been uploaded so closing it is quick.
+	result, err := b.putObject(u.vfs, u.bucket, u.key, u.meta, u.writer == nil, func(fp string) error {
+		if u.writer != nil {
+			err := u.writer.Close(r.Context())
+			u.writer = nil
+			if err != nil {
+				return fmt.Errorf("failed to complete multipart upload: %w", err)
+			}
+			// Let the VFS find the object written behind its back
+			root, err := u.vfs.Root()
+			if err != nil {
+				return err
+			}
+			root.ForgetPath(fp, fs.EntryObject)
+			return nil
+		}
+		paths := make([]string, len(parts))
+		for i, part := range parts {
+			paths[i] = part.file
+		}
+		pr := &partsReader{paths: paths}
+		defer fs.CheckClose(pr, &err)
+		return writeFile(u.vfs, fp, pr)
+	})
+	if err != nil {
+		return err
+	}
+	fs.Debugf(path.Join(u.bucket, u.key), "Completed multipart upload %q with %d parts", u.id, len(parts))
+
+	if result.VersionID != "" {
+		w.Header().Set("x-amz-version-id", string(result.VersionID))
+	}
+	return writeXML(w, completeMultipartUploadResult{
+		Xmlns:    s3Xmlns,
+		Location: "/" + path.Join(u.bucket, u.key),
+		Bucket:   u.bucket,
+		Key:      u.key,
+		ETag:     etag,
+	})
+}
+
+// abort stops the upload and removes its parts
+func (u *multipartUpload) abort(ctx context.Context) error {
+	u.mu.Lock()
+	if u.closed {
+		u.mu.Unlock()
+		return gofakes3.ErrNoSuchUpload
+	}
+	u.closed = true
+	u.mu.Unlock()
+	u.active.Wait()
+	u.cleanup(ctx)
+	return nil
+}
+
+// abortMultipartUpload implements AbortMultipartUpload
+func (b *s3Backend) abortMultipartUpload(w http.ResponseWriter, u *multipartUpload) error {
+	if err := u.abort(b.s.ctx); err != nil {
+		return err
+	}
+	b.removeUpload(u)
+	fs.Debugf(path.Join(u.bucket, u.key), "Aborted multipart upload %q", u.id)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// abortUploads aborts all the multipart uploads in progress
+func (b *s3Backend) abortUploads(ctx context.Context) {
+	b.uploadsMu.Lock()
+	uploads := b.uploads
+	b.uploads = make(map[gofakes3.UploadID]*multipartUpload)
+	b.uploadsMu.Unlock()
+	for _, u := range uploads {
+		if err := u.abort(ctx); err != nil && !errors.Is(err, gofakes3.ErrNoSuchUpload) {
+			fs.Errorf(path.Join(u.bucket, u.key), "Failed to abort multipart upload %q: %v", u.id, err)
+		}
+	}
+}
+
+// expired returns true if the upload hasn't been used since cutoff
+// and no parts are being uploaded
+func (u *multipartUpload) expired(cutoff time.Time) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return !u.closed && len(u.writing) == 0 && u.used.Before(cutoff)
+}
+
+// expireUploads aborts the uploads which haven't been used for expiry
+// and removes the directories of parts left behind by earlier runs
+// which are older than that.
+func (b *s3Backend) expireUploads(ctx context.Context, expiry time.Duration, now time.Time) {
+	cutoff := now.Add(-expiry)
+	dirs := map[string]bool{}
+	var expired []*multipartUpload
+	b.uploadsMu.Lock()
+	for id, u := range b.uploads {
+		if u.expired(cutoff) {
+			expired = append(expired, u)
+			delete(b.uploads, id)
+		} else if u.dir != "" {
+			dirs[u.dir] = true
+		}
+	}
+	b.uploadsMu.Unlock()
+	for _, u := range expired {
+		if err := u.abort(ctx); err != nil && !errors.Is(err, gofakes3.ErrNoSuchUpload) {
+			fs.Errorf(path.Join(u.bucket, u.key), "Failed to abort expired multipart upload %q: %v", u.id, err)
+		} else {
+			fs.Debugf(path.Join(u.bucket, u.key), "Aborted expired multipart upload %q", u.id)
+		}
+	}
+
+	root := filepath.Join(config.GetCacheDir(), uploadsDirName)
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		dir := filepath.Join(root, entry.Name())
+		if !entry.IsDir() || dirs[dir] {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		fs.Debugf("serve s3", "Removing abandoned multipart upload parts %q", dir)
+		if err := os.RemoveAll(dir); err != nil {
+			fs.Errorf("serve s3", "Failed to remove abandoned multipart upload parts: %v", err)
+		}
+	}
+}
+
+// runUploadExpiry expires the multipart uploads which haven't been used
+// for expiry until ctx is cancelled
+func (b *s3Backend) runUploadExpiry(ctx context.Context, expiry time.Duration) {
+	ticker := time.NewTicker(min(expiry, uploadExpiryInterval))
+	defer ticker.Stop()
+	for {
+		b.expireUploads(ctx, expiry, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package s3
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/rclone/gofakes3"
+)
+
+// errAccessDenied is returned when a request isn't allowed
+const errAccessDenied = gofakes3.ErrorCode("AccessDenied")
+
+// bucketPolicy is what a user may do with a bucket
+type bucketPolicy int
+
+// The bucket policies
+const (
+	policyReadWrite bucketPolicy = iota
+	policyReadOnly
+	policyWriteOnly
+)
+
+// policyNames maps the names used in _bucket_policy to policies
+var policyNames = map[string]bucketPolicy{
+	"read-write": policyReadWrite,
+	"read-only":  policyReadOnly,
+	"write-only": policyWriteOnly,
+}
+
+// canRead returns whether the policy allows reading objects
+func (p bucketPolicy) canRead() bool {
+	return p != policyWriteOnly
+}
+
+// canWrite returns whether the policy allows writing objects
+func (p bucketPolicy) canWrite() bool {
+	return p != policyReadOnly
+}
+
+// bucketPolicies are the bucket policies of a user
+type bucketPolicies struct {
+	all     bucketPolicy            // policy for buckets not in buckets
+	buckets map[string]bucketPolicy // policy for named buckets
+}
+
+// parseBucketPolicies parses a comma separated list of policies. Each
+// one is either "bucket=policy" for a single bucket or "policy" for
+// all the buckets not listed, for example
+//
+//	read-only,incoming=write-only,scratch=read-write
+func parseBucketPolicies(s string) (policies bucketPolicies, err error) {
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		bucket, name, found := strings.Cut(item, "=")
+		if !found {
+			bucket, name = "", bucket
+		}
+		policy, ok := policyNames[name]
+		if !ok {
+			return policies, fmt.Errorf("unknown policy %q - must be read-write, read-only or write-only", name)
+		}
+		if !found || bucket == "*" {
+			policies.all = policy
+			continue
+		}
+		if policies.buckets == nil {
+			policies.buckets = make(map[string]bucketPolicy)
+		}
+		policies.buckets[bucket] = policy
+	}
+	return policies, nil
+}
+
+// get returns the policy for bucket
+func (policies bucketPolicies) get(bucket string) bucketPolicy {
+	if policy, ok := policies.buckets[bucket]; ok {
+		return policy
+	}
+	return policies.all
+}
+
+// check returns errAccessDenied if the policies don't allow the
+// request r on bucket.
+//
+// Reads are GET and HEAD requests and everything else is a write.
+// Copies also need to be able to read the source bucket. Listing the
+// buckets is always allowed.
+func (policies bucketPolicies) check(r *http.Request, bucket string) error {
+	if bucket == "" {
+		return nil
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		if !policies.get(bucket).canRead() {
+			return errAccessDenied
+		}
+	default:
+		if !policies.get(bucket).canWrite() {
+			return errAccessDenied
+		}
+	}
+	if source := r.Header.Get("X-Amz-Copy-Source"); source != "" {
+		sourceBucket, _, _ := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+		if !policies.get(sourceBucket).canRead() {
+			return errAccessDenied
+		}
+	}
+	return nil
+}
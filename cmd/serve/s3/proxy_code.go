@@ -0,0 +1,46 @@
+//go:build ignore
+
+// An auth proxy with two users for testing purposes
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		log.Fatalf("Syntax: %s <root>", os.Args[0])
+	}
+	root := os.Args[1]
+
+	// Read the input - the access key is in pass
+	var in map[string]string
+	err := json.NewDecoder(os.Stdin).Decode(&in)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var out = map[string]string{
+		"type": "local",
+	}
+	switch in["pass"] {
+	case "alice":
+		out["_root"] = filepath.Join(root, "alice")
+		out["_secret_access_key"] = "alice-secret"
+	case "bob":
+		out["_root"] = filepath.Join(root, "alice")
+		out["_secret_access_key"] = "bob-secret"
+		out["_bucket_policy"] = "read-only,incoming=write-only"
+	default:
+		log.Fatalf("unknown access key %q", in["pass"])
+	}
+
+	// Write the output
+	err = json.NewEncoder(os.Stdout).Encode(&out)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	_ "embed"
 	"strings"
+	"time"
 
 	"github.com/rclone/rclone/cmd"
 	"github.com/rclone/rclone/cmd/serve"
@@ -37,6 +38,14 @@ var OptionsInfo = fs.Options{{
 	Name:    "no_cleanup",
 	Default: false,
 	Help:    "Not to cleanup empty folder after object is deleted",
+}, {
+	Name:    "lifecycle_interval",
+	Default: fs.Duration(time.Hour),
+	Help:    "Interval between applying the bucket lifecycle rules, 0 to disable",
+}, {
+	Name:    "upload_expiry",
+	Default: fs.Duration(24 * time.Hour),
+	Help:    "Abort multipart uploads which haven't had a part uploaded for this long, 0 to disable",
 }}.
 	Add(httplib.ConfigInfo).
 	Add(httplib.AuthConfigInfo)
@@ -44,12 +53,14 @@ var OptionsInfo = fs.Options{{
 // Options contains options for the s3 Server
 type Options struct {
 	//TODO add more options
-	ForcePathStyle bool     `config:"force_path_style"`
-	EtagHash       string   `config:"etag_hash"`
-	AuthKey        []string `config:"auth_key"`
-	NoCleanup      bool     `config:"no_cleanup"`
-	Auth           httplib.AuthConfig
-	HTTP           httplib.Config
+	ForcePathStyle    bool        `config:"force_path_style"`
+	EtagHash          string      `config:"etag_hash"`
+	AuthKey           []string    `config:"auth_key"`
+	NoCleanup         bool        `config:"no_cleanup"`
+	LifecycleInterval fs.Duration `config:"lifecycle_interval"`
+	UploadExpiry      fs.Duration `config:"upload_expiry"`
+	Auth              httplib.AuthConfig
+	HTTP              httplib.Config
 }
 
 // Opt is options set by command line flags
@@ -105,7 +116,7 @@ var Command = &cobra.Command{
 	},
 	Use:   "s3 remote:path",
 	Short: `Serve remote:path over s3.`,
-	Long:  help() + httplib.AuthHelp(flagPrefix) + httplib.Help(flagPrefix) + vfs.Help(),
+	Long:  help() + httplib.AuthHelp(flagPrefix) + httplib.Help(flagPrefix) + vfs.Help() + proxy.Help,
 	RunE: func(command *cobra.Command, args []string) error {
 		var f fs.Fs
 		if proxy.Opt.AuthProxy == "" {
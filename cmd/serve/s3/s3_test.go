@@ -6,21 +6,33 @@ package s3
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/xml"
 	"fmt"
+	gohash "hash"
 	"io"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"os"
 	"path"
 	"path/filepath"
 	"slices"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
+	"github.com/minio/minio-go/v7/pkg/signer"
+	"github.com/minio/minio-go/v7/pkg/tags"
 	_ "github.com/rclone/rclone/backend/local"
+	_ "github.com/rclone/rclone/backend/s3"
 	"github.com/rclone/rclone/cmd/serve/proxy"
 	"github.com/rclone/rclone/cmd/serve/servetest"
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config"
 	"github.com/rclone/rclone/fs/config/configmap"
 	"github.com/rclone/rclone/fs/hash"
 	"github.com/rclone/rclone/fs/object"
@@ -297,3 +309,580 @@ func TestRc(t *testing.T) {
 		"vfs_cache_mode": "off",
 	})
 }
+
+func TestVersioningTaggingLifecycle(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "bucket"), 0777))
+	f, err := fs.NewFs(ctx, dir)
+	require.NoError(t, err)
+
+	endpoint, keyid, keysec, s := serveS3(t, f)
+	defer func() {
+		assert.NoError(t, s.Shutdown())
+	}()
+	testURL, _ := url.Parse(endpoint)
+	client, err := minio.New(testURL.Host, &minio.Options{
+		Creds:  credentials.NewStaticV4(keyid, keysec, ""),
+		Secure: false,
+	})
+	require.NoError(t, err)
+
+	put := func(contents string) string {
+		info, err := client.PutObject(ctx, "bucket", "file.txt", strings.NewReader(contents), int64(len(contents)), minio.PutObjectOptions{})
+		require.NoError(t, err)
+		return info.VersionID
+	}
+	get := func(versionID string) string {
+		obj, err := client.GetObject(ctx, "bucket", "file.txt", minio.GetObjectOptions{VersionID: versionID})
+		require.NoError(t, err)
+		defer func() { _ = obj.Close() }()
+		data, err := io.ReadAll(obj)
+		require.NoError(t, err)
+		return string(data)
+	}
+	listVersions := func() (versions []minio.ObjectInfo) {
+		for object := range client.ListObjects(ctx, "bucket", minio.ListObjectsOptions{WithVersions: true, Recursive: true}) {
+			require.NoError(t, object.Err)
+			versions = append(versions, object)
+		}
+		return versions
+	}
+
+	// Versioning
+	require.NoError(t, client.EnableVersioning(ctx, "bucket"))
+	v1 := put("one")
+	v2 := put("two")
+	assert.NotEqual(t, "", v1)
+	assert.NotEqual(t, v1, v2)
+	assert.Equal(t, "two", get(""))
+	assert.Equal(t, "one", get(v1))
+	versions := listVersions()
+	require.Len(t, versions, 2)
+	assert.Equal(t, v2, versions[0].VersionID)
+	assert.True(t, versions[0].IsLatest)
+	assert.Equal(t, v1, versions[1].VersionID)
+
+	// Deleting makes a delete marker
+	require.NoError(t, client.RemoveObject(ctx, "bucket", "file.txt", minio.RemoveObjectOptions{}))
+	_, err = client.StatObject(ctx, "bucket", "file.txt", minio.StatObjectOptions{})
+	assert.Error(t, err)
+	versions = listVersions()
+	require.Len(t, versions, 3)
+	assert.True(t, versions[0].IsDeleteMarker)
+
+	// Removing the delete marker restores the object
+	require.NoError(t, client.RemoveObject(ctx, "bucket", "file.txt", minio.RemoveObjectOptions{VersionID: versions[0].VersionID}))
+	assert.Equal(t, "two", get(""))
+	assert.Len(t, listVersions(), 2)
+
+	// The version tree isn't a bucket
+	buckets, err := client.ListBuckets(ctx)
+	require.NoError(t, err)
+	require.Len(t, buckets, 1)
+	assert.Equal(t, "bucket", buckets[0].Name)
+
+	// Tagging
+	objectTags, err := tags.NewTags(map[string]string{"colour": "blue"}, true)
+	require.NoError(t, err)
+	err = client.PutObjectTagging(ctx, "bucket", "file.txt", objectTags, minio.PutObjectTaggingOptions{})
+	if err != nil && strings.Contains(err.Error(), "metadata") {
+		t.Logf("Skipping tagging: %v", err)
+	} else {
+		require.NoError(t, err)
+		gotTags, err := client.GetObjectTagging(ctx, "bucket", "file.txt", minio.GetObjectTaggingOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"colour": "blue"}, gotTags.ToMap())
+	}
+
+	// Lifecycle
+	_, err = client.GetBucketLifecycle(ctx, "bucket")
+	assert.Error(t, err)
+	config := lifecycle.NewConfiguration()
+	config.Rules = []lifecycle.Rule{{
+		ID:     "noncurrent",
+		Status: "Enabled",
+		NoncurrentVersionExpiration: lifecycle.NoncurrentVersionExpiration{
+			NoncurrentDays: 1,
+		},
+	}}
+	require.NoError(t, client.SetBucketLifecycle(ctx, "bucket", config))
+	gotConfig, err := client.GetBucketLifecycle(ctx, "bucket")
+	require.NoError(t, err)
+	require.Len(t, gotConfig.Rules, 1)
+	assert.Equal(t, "noncurrent", gotConfig.Rules[0].ID)
+
+	require.NoError(t, s.backend.applyLifecycle(ctx, time.Now()))
+	assert.Len(t, listVersions(), 2)
+	require.NoError(t, s.backend.applyLifecycle(ctx, time.Now().Add(48*time.Hour)))
+	versions = listVersions()
+	require.Len(t, versions, 1)
+	assert.Equal(t, v2, versions[0].VersionID)
+	assert.Equal(t, "two", get(""))
+
+	// A slow upload doesn't stop others to the same key
+	pr, pw := io.Pipe()
+	defer func() { _ = pw.Close() }()
+	slowDone := make(chan error)
+	go func() {
+		_, err := s.backend.PutObject(ctx, "bucket", "file.txt", map[string]string{}, pr, -1)
+		slowDone <- err
+	}()
+	_, err = pw.Write([]byte("slow"))
+	require.NoError(t, err)
+	putDone := make(chan string)
+	go func() {
+		putDone <- put("three")
+	}()
+	select {
+	case v3 := <-putDone:
+		assert.NotEqual(t, "", v3)
+	case <-time.After(10 * time.Second):
+		t.Fatal("put blocked by slow upload")
+	}
+	assert.Equal(t, "three", get(""))
+	require.NoError(t, pw.Close())
+	require.NoError(t, <-slowDone)
+	assert.Equal(t, "slow", get(""))
+	assert.Len(t, listVersions(), 3)
+	entries, err := os.ReadDir(filepath.Join(dir, metaDir, "bucket", stagingDirName))
+	require.NoError(t, err)
+	assert.Len(t, entries, 0)
+}
+
+// newRawServer makes a path style server with no auth so requests
+// can be made to it directly with serveRaw
+func newRawServer(t *testing.T, f fs.Fs) *Server {
+	opt := Opt // copy default options
+	opt.ForcePathStyle = true
+	opt.HTTP.ListenAddr = []string{endpoint}
+	w, err := newServer(context.Background(), f, &opt, &vfscommon.Opt, &proxy.Opt)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, w.Shutdown())
+	})
+	return w
+}
+
+// serveRaw makes the request to w returning the response
+func serveRaw(w *Server, method, target string, header http.Header, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	for k, v := range header {
+		r.Header[k] = v
+	}
+	rw := httptest.NewRecorder()
+	w.handler.ServeHTTP(rw, r)
+	return rw
+}
+
+func TestMetaDirNotBucket(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "bucket"), 0777))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, metaDir, "bucket"), 0777))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, metaDir, "bucket", "config.json"), []byte("{}"), 0666))
+	f, err := fs.NewFs(ctx, dir)
+	require.NoError(t, err)
+	w := newRawServer(t, f)
+
+	for _, test := range []struct {
+		method string
+		target string
+		body   string
+	}{
+		{"GET", "/" + metaDir + "/bucket/config.json", ""},
+		{"GET", "/" + metaDir + "/bucket/config.json?tagging", ""},
+		{"PUT", "/" + metaDir + "/bucket/config.json?tagging", "<Tagging><TagSet></TagSet></Tagging>"},
+		{"GET", "/" + metaDir + "?lifecycle", ""},
+		{"DELETE", "/" + metaDir + "?lifecycle", ""},
+		{"GET", "/" + metaDir + "?versions&encoding-type=url", ""},
+	} {
+		rw := serveRaw(w, test.method, test.target, nil, test.body)
+		assert.Equal(t, http.StatusNotFound, rw.Code, "%s %s", test.method, test.target)
+	}
+	rw := serveRaw(w, "PUT", "/"+metaDir, nil, "")
+	assert.NotEqual(t, http.StatusOK, rw.Code, "create bucket")
+
+	// The bucket config must be untouched
+	data, err := os.ReadFile(filepath.Join(dir, metaDir, "bucket", "config.json"))
+	require.NoError(t, err)
+	assert.Equal(t, "{}", string(data))
+}
+
+func TestMetaDirMultipart(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "bucket"), 0777))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, metaDir, "bucket"), 0777))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, metaDir, "bucket", "config.json"), []byte("{}"), 0666))
+	f, err := fs.NewFs(ctx, dir)
+	require.NoError(t, err)
+	w := newRawServer(t, f)
+
+	rw := serveRaw(w, "POST", "/"+metaDir+"/bucket/config.json?uploads", nil, "")
+	assert.Equal(t, http.StatusNotFound, rw.Code, "create upload")
+
+	rw = serveRaw(w, "POST", "/bucket/file.bin?uploads", nil, "")
+	require.Equal(t, http.StatusOK, rw.Code)
+	var result initiateMultipartUploadResult
+	require.NoError(t, xml.Unmarshal(rw.Body.Bytes(), &result))
+	header := http.Header{"X-Amz-Copy-Source": {"/" + metaDir + "/bucket/config.json"}}
+	rw = serveRaw(w, "PUT", "/bucket/file.bin?partNumber=1&uploadId="+url.QueryEscape(string(result.UploadID)), header, "")
+	assert.Equal(t, http.StatusNotFound, rw.Code, "copy source")
+}
+
+// testMultipart does a multipart upload to the root of f served over
+// s3 and returns the contents uploaded to bucket/dir/file.bin
+func testMultipart(t *testing.T, f fs.Fs) string {
+	ctx := context.Background()
+	endpoint, keyid, keysec, s := serveS3(t, f)
+	defer func() {
+		assert.NoError(t, s.Shutdown())
+	}()
+	testURL, _ := url.Parse(endpoint)
+	client, err := minio.New(testURL.Host, &minio.Options{
+		Creds:  credentials.NewStaticV4(keyid, keysec, ""),
+		Secure: false,
+	})
+	require.NoError(t, err)
+	core := minio.Core{Client: client}
+
+	const key = "dir/file.bin"
+	part1 := random.String(5 * 1024 * 1024)
+	part2 := random.String(1000)
+	putPart := func(key, uploadID string, n int, contents string) minio.ObjectPart {
+		part, err := core.PutObjectPart(ctx, "bucket", key, uploadID, n, strings.NewReader(contents), int64(len(contents)), minio.PutObjectPartOptions{})
+		require.NoError(t, err)
+		return part
+	}
+
+	// Upload the parts out of order
+	uploadID, err := core.NewMultipartUpload(ctx, "bucket", key, minio.PutObjectOptions{})
+	require.NoError(t, err)
+	p2 := putPart(key, uploadID, 2, part2)
+	p1 := putPart(key, uploadID, 1, part1)
+
+	// Parts can be uploaded again unless they are streamed to the remote
+	_, err = core.PutObjectPart(ctx, "bucket", key, uploadID, 2, strings.NewReader(part2), int64(len(part2)), minio.PutObjectPartOptions{})
+	if f.Features().OpenChunkWriter != nil {
+		assert.ErrorContains(t, err, "can't be replaced")
+	} else {
+		assert.NoError(t, err)
+	}
+
+	parts, err := core.ListObjectParts(ctx, "bucket", key, uploadID, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, parts.ObjectParts, 2)
+	assert.Equal(t, 1, parts.ObjectParts[0].PartNumber)
+	assert.Equal(t, int64(len(part1)), parts.ObjectParts[0].Size)
+	assert.Equal(t, p1.ETag, strings.Trim(parts.ObjectParts[0].ETag, `"`))
+	assert.Equal(t, 2, parts.ObjectParts[1].PartNumber)
+
+	uploads, err := core.ListMultipartUploads(ctx, "bucket", "", "", "", "", 0)
+	require.NoError(t, err)
+	require.Len(t, uploads.Uploads, 1)
+	assert.Equal(t, uploadID, uploads.Uploads[0].UploadID)
+	assert.Equal(t, key, uploads.Uploads[0].Key)
+
+	_, err = core.CompleteMultipartUpload(ctx, "bucket", key, uploadID, []minio.CompletePart{
+		{PartNumber: 1, ETag: p1.ETag},
+		{PartNumber: 2, ETag: p2.ETag},
+	}, minio.PutObjectOptions{})
+	require.NoError(t, err)
+
+	obj, err := client.GetObject(ctx, "bucket", key, minio.GetObjectOptions{})
+	require.NoError(t, err)
+	data, err := io.ReadAll(obj)
+	require.NoError(t, err)
+	require.NoError(t, obj.Close())
+	assert.Equal(t, part1+part2, string(data))
+
+	// Aborting an upload removes it
+	uploadID, err = core.NewMultipartUpload(ctx, "bucket", "aborted.bin", minio.PutObjectOptions{})
+	require.NoError(t, err)
+	putPart("aborted.bin", uploadID, 1, part2)
+	require.NoError(t, core.AbortMultipartUpload(ctx, "bucket", "aborted.bin", uploadID))
+	_, err = core.ListObjectParts(ctx, "bucket", "aborted.bin", uploadID, 0, 0)
+	assert.Error(t, err)
+	uploads, err = core.ListMultipartUploads(ctx, "bucket", "", "", "", "", 0)
+	require.NoError(t, err)
+	assert.Len(t, uploads.Uploads, 0)
+	_, err = client.StatObject(ctx, "bucket", "aborted.bin", minio.StatObjectOptions{})
+	assert.Error(t, err)
+
+	return part1 + part2
+}
+
+func TestMultipart(t *testing.T) {
+	ctx := context.Background()
+	oldCacheDir := config.GetCacheDir()
+	cacheDir := t.TempDir()
+	require.NoError(t, config.SetCacheDir(cacheDir))
+	defer func() {
+		_ = config.SetCacheDir(oldCacheDir)
+	}()
+
+	newLocal := func() (string, fs.Fs) {
+		dir := t.TempDir()
+		require.NoError(t, os.Mkdir(filepath.Join(dir, "bucket"), 0777))
+		f, err := fs.NewFs(ctx, dir)
+		require.NoError(t, err)
+		return dir, f
+	}
+	checkFile := func(dir, contents string) {
+		data, err := os.ReadFile(filepath.Join(dir, "bucket", "dir", "file.bin"))
+		require.NoError(t, err)
+		assert.Equal(t, contents, string(data))
+	}
+	checkNoParts := func() {
+		entries, err := os.ReadDir(filepath.Join(cacheDir, uploadsDirName))
+		if err == nil {
+			assert.Len(t, entries, 0)
+		}
+	}
+
+	// Parts are stored in the cache directory for the local backend
+	t.Run("Local", func(t *testing.T) {
+		dir, f := newLocal()
+		checkFile(dir, testMultipart(t, f))
+		checkNoParts()
+	})
+
+	// Parts are streamed to the chunk writer of an s3 remote
+	t.Run("ChunkWriter", func(t *testing.T) {
+		dir, fLocal := newLocal()
+		endpoint, keyid, keysec, s := serveS3(t, fLocal)
+		defer func() {
+			assert.NoError(t, s.Shutdown())
+		}()
+		f, err := fs.NewFs(ctx, fmt.Sprintf(":s3,provider=Rclone,endpoint='%s',access_key_id=%s,secret_access_key=%s:", endpoint, keyid, keysec))
+		require.NoError(t, err)
+		require.NotNil(t, f.Features().OpenChunkWriter)
+		checkFile(dir, testMultipart(t, f))
+	})
+}
+
+// sha256Hasher adapts sha256 for the minio signer
+type sha256Hasher struct {
+	gohash.Hash
+}
+
+func (sha256Hasher) Close() {}
+
+func TestChunkSignatures(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "bucket"), 0777))
+	f, err := fs.NewFs(ctx, dir)
+	require.NoError(t, err)
+	endpoint, keyid, keysec, s := serveS3(t, f)
+	defer func() {
+		assert.NoError(t, s.Shutdown())
+	}()
+	testURL, _ := url.Parse(endpoint)
+	client, err := minio.New(testURL.Host, &minio.Options{
+		Creds:  credentials.NewStaticV4(keyid, keysec, ""),
+		Secure: false,
+	})
+	require.NoError(t, err)
+	core := minio.Core{Client: client}
+	uploadID, err := core.NewMultipartUpload(ctx, "bucket", "file.bin", minio.PutObjectOptions{})
+	require.NoError(t, err)
+
+	// Upload a part of more than one chunk signed with the streaming
+	// signature then change the signed body with tamper
+	data := random.String(100 * 1024)
+	uploadPart := func(trailer http.Header, tamper func(body []byte)) int {
+		req, err := http.NewRequest("PUT", endpoint+"/bucket/file.bin?partNumber=1&uploadId="+url.QueryEscape(uploadID), strings.NewReader(data))
+		require.NoError(t, err)
+		req.Trailer = trailer
+		req = signer.StreamingSignV4(req, keyid, keysec, "", "us-east-1", int64(len(data)), time.Now().UTC(), sha256Hasher{sha256.New()})
+		body, err := io.ReadAll(req.Body)
+		require.NoError(t, err)
+		tamper(body)
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.ContentLength = int64(len(body))
+		req.TransferEncoding = nil
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+	// replace the first old in the body with new
+	replace := func(old, new string) func(body []byte) {
+		return func(body []byte) {
+			i := bytes.Index(body, []byte(old))
+			require.True(t, i >= 0, old)
+			copy(body[i:], new)
+		}
+	}
+	noChange := func(body []byte) {}
+	trailer := http.Header{"X-Amz-Checksum-Crc32": {"AAAAAA=="}}
+
+	assert.Equal(t, http.StatusOK, uploadPart(nil, noChange))
+	assert.Equal(t, http.StatusForbidden, uploadPart(nil, replace(data[70*1024:70*1024+6], "potato")), "changed data")
+	assert.Equal(t, http.StatusForbidden, uploadPart(nil, replace(";chunk-signature=", ";chunk-signature=0")), "changed signature")
+	assert.Equal(t, http.StatusOK, uploadPart(trailer, noChange))
+	assert.Equal(t, http.StatusForbidden, uploadPart(trailer, replace("AAAAAA==", "BBBBBB==")), "changed trailer")
+
+	parts, err := core.ListObjectParts(ctx, "bucket", "file.bin", uploadID, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, parts.ObjectParts, 1)
+	assert.Equal(t, int64(len(data)), parts.ObjectParts[0].Size)
+}
+func TestUploadExpiry(t *testing.T) {
+	ctx := context.Background()
+	oldCacheDir := config.GetCacheDir()
+	cacheDir := t.TempDir()
+	require.NoError(t, config.SetCacheDir(cacheDir))
+	defer func() {
+		_ = config.SetCacheDir(oldCacheDir)
+	}()
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "bucket"), 0777))
+	f, err := fs.NewFs(ctx, dir)
+	require.NoError(t, err)
+	endpoint, keyid, keysec, s := serveS3(t, f)
+	defer func() {
+		assert.NoError(t, s.Shutdown())
+	}()
+	testURL, _ := url.Parse(endpoint)
+	client, err := minio.New(testURL.Host, &minio.Options{
+		Creds:  credentials.NewStaticV4(keyid, keysec, ""),
+		Secure: false,
+	})
+	require.NoError(t, err)
+	core := minio.Core{Client: client}
+
+	uploadID, err := core.NewMultipartUpload(ctx, "bucket", "file.bin", minio.PutObjectOptions{})
+	require.NoError(t, err)
+	_, err = core.PutObjectPart(ctx, "bucket", "file.bin", uploadID, 1, strings.NewReader("potato"), 6, minio.PutObjectPartOptions{})
+	require.NoError(t, err)
+
+	// Parts left behind by an earlier run
+	uploadsDir := filepath.Join(cacheDir, uploadsDirName)
+	oldDir := filepath.Join(uploadsDir, "upload-old")
+	require.NoError(t, os.Mkdir(oldDir, 0700))
+	old := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, os.Chtimes(oldDir, old, old))
+
+	listUploads := func() int {
+		uploads, err := core.ListMultipartUploads(ctx, "bucket", "", "", "", "", 0)
+		require.NoError(t, err)
+		return len(uploads.Uploads)
+	}
+	s.backend.expireUploads(ctx, time.Hour, time.Now())
+	assert.Equal(t, 1, listUploads())
+	entries, err := os.ReadDir(uploadsDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "old parts should be removed")
+
+	s.backend.expireUploads(ctx, time.Hour, time.Now().Add(2*time.Hour))
+	assert.Equal(t, 0, listUploads())
+	_, err = core.ListObjectParts(ctx, "bucket", "file.bin", uploadID, 0, 0)
+	assert.Error(t, err)
+	entries, err = os.ReadDir(uploadsDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 0)
+}
+
+func TestParseBucketPolicies(t *testing.T) {
+	policies, err := parseBucketPolicies("")
+	require.NoError(t, err)
+	assert.Equal(t, policyReadWrite, policies.get("bucket"))
+
+	policies, err = parseBucketPolicies("read-only, incoming=write-only,scratch=read-write")
+	require.NoError(t, err)
+	assert.Equal(t, policyReadOnly, policies.get("bucket"))
+	assert.Equal(t, policyWriteOnly, policies.get("incoming"))
+	assert.Equal(t, policyReadWrite, policies.get("scratch"))
+
+	policies, err = parseBucketPolicies("private=read-only,*=write-only")
+	require.NoError(t, err)
+	assert.Equal(t, policyReadOnly, policies.get("private"))
+	assert.Equal(t, policyWriteOnly, policies.get("bucket"))
+
+	_, err = parseBucketPolicies("bucket=potato")
+	assert.ErrorContains(t, err, "potato")
+}
+
+func TestAuthProxyUsers(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "alice", "bucket"), 0777))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "alice", "incoming"), 0777))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "alice", "bucket", "file.txt"), []byte("hello"), 0666))
+
+	prog, err := filepath.Abs("proxy_code.go")
+	require.NoError(t, err)
+	// FIXME: this is untidy setting a global variable!
+	proxy.Opt.AuthProxy = "go run " + prog + " " + dir
+	defer func() {
+		proxy.Opt.AuthProxy = ""
+	}()
+
+	endpoint, _, _, s := serveS3(t, nil)
+	defer func() {
+		assert.NoError(t, s.server.Shutdown())
+	}()
+	testURL, _ := url.Parse(endpoint)
+	newClient := func(keyid, keysec string) *minio.Client {
+		client, err := minio.New(testURL.Host, &minio.Options{
+			Creds:  credentials.NewStaticV4(keyid, keysec, ""),
+			Secure: false,
+		})
+		require.NoError(t, err)
+		return client
+	}
+	get := func(client *minio.Client, bucket, key string) (string, error) {
+		obj, err := client.GetObject(ctx, bucket, key, minio.GetObjectOptions{})
+		if err != nil {
+			return "", err
+		}
+		defer func() { _ = obj.Close() }()
+		data, err := io.ReadAll(obj)
+		return string(data), err
+	}
+	put := func(client *minio.Client, bucket, key string) error {
+		_, err := client.PutObject(ctx, bucket, key, strings.NewReader("new"), 3, minio.PutObjectOptions{})
+		return err
+	}
+
+	// Each user is checked with their own secret
+	alice := newClient("alice", "alice-secret")
+	buckets, err := alice.ListBuckets(ctx)
+	require.NoError(t, err)
+	assert.Len(t, buckets, 2)
+	_, err = newClient("alice", "bob-secret").ListBuckets(ctx)
+	assert.Error(t, err)
+	_, err = newClient("carol", "alice-secret").ListBuckets(ctx)
+	assert.Error(t, err)
+	_, err = newClient("", "").ListBuckets(ctx)
+	assert.Error(t, err)
+
+	// alice can do anything
+	contents, err := get(alice, "bucket", "file.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", contents)
+	require.NoError(t, put(alice, "bucket", "alice.txt"))
+
+	// bob can only read bucket and only write incoming
+	bob := newClient("bob", "bob-secret")
+	contents, err = get(bob, "bucket", "file.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", contents)
+	err = put(bob, "bucket", "bob.txt")
+	assert.Equal(t, "AccessDenied", minio.ToErrorResponse(err).Code)
+	require.NoError(t, put(bob, "incoming", "bob.txt"))
+	_, err = get(bob, "incoming", "bob.txt")
+	assert.Equal(t, "AccessDenied", minio.ToErrorResponse(err).Code)
+	_, err = bob.CopyObject(ctx, minio.CopyDestOptions{Bucket: "bucket", Object: "copy.txt"}, minio.CopySrcOptions{Bucket: "incoming", Object: "bob.txt"})
+	assert.Error(t, err)
+	_, err = bob.CopyObject(ctx, minio.CopyDestOptions{Bucket: "incoming", Object: "copy.txt"}, minio.CopySrcOptions{Bucket: "bucket", Object: "file.txt"})
+	assert.NoError(t, err)
+
+	_, err = os.Stat(filepath.Join(dir, "alice", "incoming", "bob.txt"))
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dir, "alice", "bucket", "bob.txt"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -5,12 +5,16 @@ import (
 	"context"
 	"crypto/md5"
 	"encoding/hex"
+	"encoding/xml"
 	"errors"
 	"fmt"
+	"io"
 	"math/rand"
 	"net"
 	"net/http"
+	"net/url"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/rclone/gofakes3"
@@ -27,6 +31,7 @@ type ctxKey int
 
 const (
 	ctxKeyID ctxKey = iota
+	ctxKeySecret
 )
 
 // Server is a s3.FileSystem interface
@@ -36,15 +41,21 @@ type Server struct {
 	f            fs.Fs
 	_vfs         *vfs.VFS // don't use directly, use getVFS
 	faker        *gofakes3.GoFakeS3
+	backend      *s3Backend
 	handler      http.Handler
 	proxy        *proxy.Proxy
 	ctx          context.Context // for global config
 	s3Secret     string
+	authKeys     map[string]string // access key to secret for --auth-key
 	etagHashType hash.Type
+	stop         context.CancelFunc // stops the lifecycle rules and upload expiry
 }
 
 // Make a new S3 Server to serve the remote
 func newServer(ctx context.Context, f fs.Fs, opt *Options, vfsOpt *vfscommon.Options, proxyOpt *proxy.Options) (s *Server, err error) {
+	if err := vfscommon.RefuseACL(vfsOpt); err != nil {
+		return nil, err
+	}
 	w := &Server{
 		f:            f,
 		ctx:          ctx,
@@ -68,32 +79,45 @@ func newServer(ctx context.Context, f fs.Fs, opt *Options, vfsOpt *vfscommon.Opt
 		fs.Logf("serve s3", "No auth provided so allowing anonymous access")
 	} else {
 		w.s3Secret = getAuthSecret(opt.AuthKey)
+		w.authKeys = authlistResolver(opt.AuthKey)
 	}
 
 	var newLogger logger
-	w.faker = gofakes3.New(
-		newBackend(w),
+	options := []gofakes3.Option{
 		gofakes3.WithHostBucket(!opt.ForcePathStyle),
 		gofakes3.WithLogger(newLogger),
 		gofakes3.WithRequestID(rand.Uint64()),
-		gofakes3.WithoutVersioning(),
 		gofakes3.WithV4Auth(authlistResolver(opt.AuthKey)),
 		gofakes3.WithIntegrityCheck(true), // Check Content-MD5 if supplied
-	)
+	}
+	if proxy.Opt.AuthProxy != "" {
+		// Versioning needs a single VFS
+		options = append(options, gofakes3.WithoutVersioning())
+	}
+	w.backend = newBackend(w)
+	var bgCtx context.Context
+	bgCtx, w.stop = context.WithCancel(ctx)
+	if opt.UploadExpiry > 0 {
+		go w.backend.runUploadExpiry(bgCtx, time.Duration(opt.UploadExpiry))
+	}
+	w.faker = gofakes3.New(w.backend, options...)
 
-	w.handler = w.faker.Server()
+	w.handler = w.extensionsMiddleware(w.faker.Server())
 
 	if proxy.Opt.AuthProxy != "" {
 		w.proxy = proxy.New(ctx, proxyOpt, vfsOpt)
 		// proxy auth middleware
 		w.handler = proxyAuthMiddleware(w.handler, w)
-		w.handler = authPairMiddleware(w.handler, w)
 	} else {
 		w._vfs = vfs.New(f, vfsOpt)
 
 		if len(opt.AuthKey) > 0 {
 			w.faker.AddAuthKeys(authlistResolver(opt.AuthKey))
 		}
+
+		if opt.LifecycleInterval > 0 {
+			go w.backend.runLifecycle(bgCtx, time.Duration(opt.LifecycleInterval))
+		}
 	}
 
 	w.server, err = httplib.NewServer(ctx,
@@ -101,6 +125,7 @@ func newServer(ctx context.Context, f fs.Fs, opt *Options, vfsOpt *vfscommon.Opt
 		httplib.WithAuth(opt.Auth),
 	)
 	if err != nil {
+		w.stop()
 		return nil, fmt.Errorf("failed to init server: %w", err)
 	}
 
@@ -127,13 +152,31 @@ func (w *Server) getVFS(ctx context.Context) (VFS *vfs.VFS, err error) {
 	return VFS, nil
 }
 
+// proxyUser is a user returned by the auth proxy
+type proxyUser struct {
+	vfs      *vfs.VFS
+	secret   string         // secret access key to check signatures with
+	policies bucketPolicies // what the user can do with each bucket
+}
+
 // auth does proxy authorization
-func (w *Server) auth(accessKeyID string) (value any, err error) {
-	VFS, _, err := w.proxy.Call(stringToMd5Hash(accessKeyID), accessKeyID, false)
+func (w *Server) auth(accessKeyID string) (user proxyUser, err error) {
+	VFS, _, params, err := w.proxy.CallParams(stringToMd5Hash(accessKeyID), accessKeyID, false)
 	if err != nil {
-		return nil, err
+		return user, err
+	}
+	user.vfs = VFS
+	user.secret = w.s3Secret
+	if secret, ok := params.Get("_secret_access_key"); ok {
+		user.secret = secret
+	}
+	if policy, ok := params.Get("_bucket_policy"); ok {
+		user.policies, err = parseBucketPolicies(policy)
+		if err != nil {
+			return user, fmt.Errorf("proxy: bad _bucket_policy: %w", err)
+		}
 	}
-	return VFS, err
+	return user, nil
 }
 
 // Bind register the handler to http.Router
@@ -156,38 +199,201 @@ func (w *Server) Addr() net.Addr {
 
 // Shutdown the server
 func (w *Server) Shutdown() error {
+	w.stop()
+	w.backend.abortUploads(w.ctx)
 	return w.server.Shutdown()
 }
 
-func authPairMiddleware(next http.Handler, ws *Server) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		accessKey, _ := parseAccessKeyID(r)
-		// set the auth pair
-		authPair := map[string]string{
-			accessKey: ws.s3Secret,
+// s3Xmlns is the XML namespace of the S3 responses
+const s3Xmlns = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+// extensionsMiddleware serves the S3 calls which gofakes3 doesn't
+// support - object tagging, bucket lifecycle rules, URL encoded
+// version listings, HEAD requests for object versions and multipart
+// uploads.
+func (w *Server) extensionsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		_, isTagging := query["tagging"]
+		_, isLifecycle := query["lifecycle"]
+		_, isVersions := query["versions"]
+		isVersions = isVersions && r.Method == http.MethodGet && query.Get("encoding-type") == "url" && w.backend.bucketConfigs()
+		isHeadVersion := r.Method == http.MethodHead && versionFromQuery(query) != "" && w.backend.bucketConfigs()
+		_, isUploads := query["uploads"]
+		_, isUpload := query["uploadId"]
+		isMultipart := isUploads || isUpload
+		if !isTagging && !isLifecycle && !isVersions && !isHeadVersion && !isMultipart {
+			next.ServeHTTP(rw, r)
+			return
+		}
+
+		// These requests don't pass through the gofakes3 auth
+		if (len(w.opt.AuthKey) > 0 || w.proxy != nil) && !checkSignature(rw, r) {
+			return
+		}
+
+		bucket, object := w.bucketObject(r)
+
+		var err error
+		if isMultipart {
+			err = w.backend.serveMultipart(rw, r, bucket, object)
+		} else if isTagging {
+			err = w.backend.serveTagging(rw, r, bucket, object)
+		} else if isHeadVersion && object != "" {
+			err = w.backend.serveHeadVersion(rw, r, bucket, object)
+		} else if isVersions && object == "" {
+			err = w.backend.serveVersions(rw, r, bucket)
+		} else if isLifecycle && object == "" {
+			err = w.backend.serveLifecycle(rw, r, bucket)
+		} else {
+			err = gofakes3.ErrNotImplemented
+		}
+		if err != nil {
+			writeError(rw, r, err)
 		}
-		ws.faker.AddAuthKeys(authPair)
-		next.ServeHTTP(w, r)
 	})
 }
 
+// secretKey returns the secret access key the signature of r was
+// checked with. checked is false if signatures aren't checked.
+func (w *Server) secretKey(r *http.Request) (secret string, checked bool) {
+	if w.proxy != nil {
+		secret, _ = r.Context().Value(ctxKeySecret).(string)
+		return secret, true
+	}
+	if len(w.opt.AuthKey) == 0 {
+		return "", false
+	}
+	accessKey, _ := parseAccessKeyID(r)
+	return w.authKeys[accessKey], true
+}
+
+// bucketObject returns the bucket and object the request r is for
+// in the same way as gofakes3 does
+func (w *Server) bucketObject(r *http.Request) (bucket, object string) {
+	urlPath := strings.Trim(r.URL.Path, "/")
+	if !w.opt.ForcePathStyle {
+		host, _, _ := strings.Cut(r.Host, ".")
+		urlPath = host + "/" + urlPath
+	}
+	bucket, object, _ = strings.Cut(urlPath, "/")
+	return bucket, object
+}
+
+// checkSignature checks the V4 signature of r writing an error
+// response and returning false if it is not valid
+func checkSignature(rw http.ResponseWriter, r *http.Request) bool {
+	result := signature.V4SignVerify(r)
+	if result == signature.ErrNone {
+		return true
+	}
+	fs.Infof(r.URL.Path, "%s: Access denied", r.RemoteAddr)
+	resp := signature.GetAPIError(result)
+	rw.Header().Set("Content-Type", "application/xml")
+	rw.WriteHeader(resp.HTTPStatusCode)
+	_, _ = rw.Write(signature.EncodeAPIErrorToResponse(resp))
+	return false
+}
+
+// errorResponse is the body of an S3 error response
+type errorResponse struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message,omitempty"`
+}
+
+// writeError writes err as an S3 error response
+func writeError(rw http.ResponseWriter, r *http.Request, err error) {
+	code := gofakes3.ErrInternal
+	var s3Err gofakes3.Error
+	if errors.As(err, &s3Err) {
+		code = s3Err.ErrorCode()
+	} else {
+		fs.Errorf(r.URL.Path, "%s %s failed: %v", r.Method, r.URL.RawQuery, err)
+	}
+	status := code.Status()
+	switch code {
+	case errNoSuchLifecycleConfiguration:
+		status = http.StatusNotFound
+	case errAccessDenied, errSignatureDoesNotMatch:
+		status = http.StatusForbidden
+	}
+	rw.Header().Set("Content-Type", "application/xml")
+	rw.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		_ = xml.NewEncoder(rw).Encode(errorResponse{Code: string(code), Message: err.Error()})
+	}
+}
+
+// writeXML writes v as an XML response
+func writeXML(rw http.ResponseWriter, v any) error {
+	rw.Header().Set("Content-Type", "application/xml")
+	if _, err := io.WriteString(rw, xml.Header); err != nil {
+		return err
+	}
+	return xml.NewEncoder(rw).Encode(v)
+}
+
+// versionFromQuery returns the versionId in the query treating the
+// "null" version as the current one like gofakes3 does
+func versionFromQuery(query url.Values) gofakes3.VersionID {
+	id := query.Get("versionId")
+	if id == string(nullVersionID) {
+		return ""
+	}
+	return gofakes3.VersionID(id)
+}
+
+// proxyAuthMiddleware looks up the access key of the request with
+// the auth proxy. It checks the signature with the user's secret and
+// the request against the user's bucket policies then passes the
+// user's VFS on in the context.
 func proxyAuthMiddleware(next http.Handler, ws *Server) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		accessKey, _ := parseAccessKeyID(r)
-		value, err := ws.auth(accessKey)
+		if accessKey == "" {
+			fs.Infof(r.URL.Path, "%s: Access denied: no access key", r.RemoteAddr)
+			writeError(w, r, errAccessDenied)
+			return
+		}
+		user, err := ws.auth(accessKey)
 		if err != nil {
 			fs.Infof(r.URL.Path, "%s: Auth failed: %v", r.RemoteAddr, err)
+			writeError(w, r, errAccessDenied)
+			return
 		}
-		if value != nil {
-			r = r.WithContext(context.WithValue(r.Context(), ctxKeyID, value))
+
+		// Check the signature with the secret for this user
+		ws.faker.AddAuthKeys(map[string]string{
+			accessKey: user.secret,
+		})
+		if !checkSignature(w, r) {
+			return
 		}
 
+		bucket, _ := ws.bucketObject(r)
+		if err := user.policies.check(r, bucket); err != nil {
+			fs.Infof(r.URL.Path, "%s: %s %s denied by bucket policy", r.RemoteAddr, r.Method, bucket)
+			writeError(w, r, err)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), ctxKeyID, user.vfs)
+		ctx = context.WithValue(ctx, ctxKeySecret, user.secret)
+		r = r.WithContext(ctx)
 		next.ServeHTTP(w, r)
 	})
 }
 
 func parseAccessKeyID(r *http.Request) (accessKey string, error signature.ErrorCode) {
 	v4Auth := r.Header.Get("Authorization")
+	if v4Auth == "" {
+		// Presigned URLs have the credential in the query
+		if credential := r.URL.Query().Get("X-Amz-Credential"); credential != "" {
+			accessKey, _, _ = strings.Cut(credential, "/")
+			return accessKey, signature.ErrNone
+		}
+	}
 	req, err := signature.ParseSignV4(v4Auth)
 	if err != signature.ErrNone {
 		return "", err
@@ -0,0 +1,166 @@
+package s3
+
+import (
+	"encoding/xml"
+	"maps"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+
+	"github.com/rclone/gofakes3"
+	"github.com/rclone/rclone/vfs"
+)
+
+// tagsMetadataKey is the metadata key the object tags are stored in
+// as a URL encoded query string like the x-amz-tagging header.
+const tagsMetadataKey = "s3-tagging"
+
+// maxTags is the maximum number of tags S3 allows on an object
+const maxTags = 10
+
+// tagging is the body of the PutObjectTagging and GetObjectTagging
+// calls
+type tagging struct {
+	XMLName xml.Name `xml:"Tagging"`
+	Xmlns   string   `xml:"xmlns,attr,omitempty"`
+	TagSet  []tag    `xml:"TagSet>Tag"`
+}
+
+// tag is a single object tag
+type tag struct {
+	Key   string `xml:"Key"`
+	Value string `xml:"Value"`
+}
+
+// encodeTags checks the tags and encodes them for storage
+func encodeTags(tags []tag) (string, error) {
+	if len(tags) > maxTags {
+		return "", gofakes3.ErrorMessage(gofakes3.ErrInvalidArgument, "Object tags cannot be greater than 10")
+	}
+	values := url.Values{}
+	for _, t := range tags {
+		if t.Key == "" || len(t.Key) > 128 || len(t.Value) > 256 {
+			return "", gofakes3.ErrorMessage(gofakes3.ErrInvalidArgument, "The TagKey or TagValue you have provided is invalid")
+		}
+		if values.Has(t.Key) {
+			return "", gofakes3.ErrorMessage(gofakes3.ErrInvalidArgument, "Cannot provide multiple Tags with the same key")
+		}
+		values.Set(t.Key, t.Value)
+	}
+	return values.Encode(), nil
+}
+
+// decodeTags decodes the stored tags
+func decodeTags(value string) ([]tag, error) {
+	values, err := url.ParseQuery(value)
+	if err != nil {
+		return nil, gofakes3.ErrorMessage(gofakes3.ErrInvalidArgument, "The tag provided was not a valid tag")
+	}
+	tags := []tag{}
+	for _, key := range slices.Sorted(maps.Keys(values)) {
+		tags = append(tags, tag{Key: key, Value: values.Get(key)})
+	}
+	return tags, nil
+}
+
+// tagFile returns the vfs.File for the object at fp
+func tagFile(_vfs *vfs.VFS, fp, objectName string) (*vfs.File, error) {
+	node, err := _vfs.Stat(fp)
+	if err != nil {
+		return nil, gofakes3.KeyNotFound(objectName)
+	}
+	file, ok := node.(*vfs.File)
+	if !ok {
+		return nil, gofakes3.KeyNotFound(objectName)
+	}
+	return file, nil
+}
+
+// getTags reads the tags of the object at fp
+func getTags(_vfs *vfs.VFS, fp, objectName string) ([]tag, error) {
+	file, err := tagFile(_vfs, fp, objectName)
+	if err != nil {
+		return nil, err
+	}
+	value, err := file.GetXattr(vfs.XattrUserPrefix + tagsMetadataKey)
+	if err == vfs.ENOATTR {
+		return []tag{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return decodeTags(string(value))
+}
+
+// setTags sets the tags of the object at fp to the URL encoded value
+func setTags(_vfs *vfs.VFS, fp, value string) error {
+	tags, err := decodeTags(value)
+	if err != nil {
+		return err
+	}
+	value, err = encodeTags(tags)
+	if err != nil {
+		return err
+	}
+	file, err := tagFile(_vfs, fp, path.Base(fp))
+	if err != nil {
+		return err
+	}
+	err = file.SetXattr(vfs.XattrUserPrefix+tagsMetadataKey, []byte(value), 0)
+	if err == vfs.ENOTSUP {
+		return gofakes3.ErrorMessage(gofakes3.ErrNotImplemented, "The remote can't store metadata so object tagging isn't supported")
+	}
+	return err
+}
+
+// serveTagging implements GetObjectTagging, PutObjectTagging and
+// DeleteObjectTagging
+func (b *s3Backend) serveTagging(w http.ResponseWriter, r *http.Request, bucket, object string) error {
+	_vfs, err := b.s.getVFS(r.Context())
+	if err != nil {
+		return err
+	}
+	if err := checkBucket(_vfs, bucket); err != nil {
+		return err
+	}
+	if object == "" {
+		return gofakes3.ErrNotImplemented
+	}
+	fp := path.Join(bucket, object)
+	if id := versionFromQuery(r.URL.Query()); id != "" {
+		v, err := b.findVersion(_vfs, bucket, object, id)
+		if err != nil {
+			return err
+		}
+		if v.deleteMarker {
+			return gofakes3.ErrMethodNotAllowed
+		}
+		fp = versionPath(bucket, object, v)
+		w.Header().Set("x-amz-version-id", string(id))
+	}
+	switch r.Method {
+	case http.MethodGet:
+		tags, err := getTags(_vfs, fp, object)
+		if err != nil {
+			return err
+		}
+		return writeXML(w, tagging{Xmlns: s3Xmlns, TagSet: tags})
+	case http.MethodPut:
+		var in tagging
+		if err := xml.NewDecoder(r.Body).Decode(&in); err != nil {
+			return gofakes3.ErrMalformedXML
+		}
+		value, err := encodeTags(in.TagSet)
+		if err != nil {
+			return err
+		}
+		return setTags(_vfs, fp, value)
+	case http.MethodDelete:
+		if err := setTags(_vfs, fp, ""); err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	return gofakes3.ErrMethodNotAllowed
+}
@@ -36,6 +36,32 @@ func getDirEntries(prefix string, VFS *vfs.VFS) (vfs.Nodes, error) {
 	return dirEntries, nil
 }
 
+// walkFiles calls fn for every file under dir with its path relative
+// to dir. It isn't an error if dir doesn't exist.
+func walkFiles(VFS *vfs.VFS, dir string, fn func(remote string, node vfs.Node)) error {
+	var walk func(remote string) error
+	walk = func(remote string) error {
+		dirEntries, err := getDirEntries(path.Join(dir, remote), VFS)
+		if err == gofakes3.ErrNoSuchKey {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		for _, entry := range dirEntries {
+			entryRemote := path.Join(remote, entry.Name())
+			if entry.IsDir() {
+				if err := walk(entryRemote); err != nil {
+					return err
+				}
+			} else {
+				fn(entryRemote, entry)
+			}
+		}
+		return nil
+	}
+	return walk("")
+}
+
 func getFileHashByte(node any, hashType hash.Type) []byte {
 	b, err := hex.DecodeString(getFileHash(node, hashType))
 	if err != nil {
@@ -125,6 +151,14 @@ func rmdirRecursive(p string, VFS *vfs.VFS) {
 	}
 }
 
+// removeEmptyDir removes dir if it exists and is empty
+func removeEmptyDir(VFS *vfs.VFS, dir string) {
+	dirEntries, err := getDirEntries(dir, VFS)
+	if err == nil && len(dirEntries) == 0 {
+		_ = VFS.Remove(dir)
+	}
+}
+
 func authlistResolver(list []string) map[string]string {
 	authList := make(map[string]string)
 	for _, v := range list {
@@ -0,0 +1,694 @@
+package s3
+
+// Object versioning
+//
+// When versioning is configured on a bucket the current version of
+// each object is stored in the bucket as normal and the earlier
+// versions and the delete markers are kept in a hidden version tree
+//
+//	.rclone-s3/<bucket>/versions/<key>/<created>-<versionID>
+//
+// where <created> is the time the version was made in hex
+// nanoseconds. Delete markers have a ".deleted" suffix and an empty
+// file with a ".current" suffix records the version ID of the object
+// currently in the bucket. Objects stored while versioning wasn't
+// enabled have the "null" version ID.
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/gofakes3"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/random"
+	"github.com/rclone/rclone/vfs"
+)
+
+const (
+	versionsDirName = "versions"
+	stagingDirName  = "staging"
+	nullVersionID   = gofakes3.VersionID("null")
+	currentSuffix   = ".current"
+	deletedSuffix   = ".deleted"
+)
+
+// check interface
+var _ gofakes3.VersionedBackend = (*s3Backend)(nil)
+
+// objectVersion describes one version of an object
+type objectVersion struct {
+	id           gofakes3.VersionID
+	created      time.Time
+	current      bool   // stored in the bucket rather than the version tree
+	deleteMarker bool   // this is a delete marker
+	leaf         string // name in the version tree - may be empty for current versions
+}
+
+// newVersionID makes a new random version ID
+func newVersionID() gofakes3.VersionID {
+	return gofakes3.VersionID(random.String(32))
+}
+
+// keyLock serialises the changes to the versions of a key
+type keyLock struct {
+	mu    sync.Mutex
+	users int // number of callers holding or waiting for mu - protected by keysMu
+}
+
+// lockKey locks the versions of key in bucket returning a function to
+// unlock them.
+func (b *s3Backend) lockKey(bucket, key string) (unlock func()) {
+	b.versionsMu.RLock()
+	name := path.Join(bucket, key)
+	b.keysMu.Lock()
+	l := b.keys[name]
+	if l == nil {
+		l = &keyLock{}
+		b.keys[name] = l
+	}
+	l.users++
+	b.keysMu.Unlock()
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		b.keysMu.Lock()
+		l.users--
+		if l.users == 0 {
+			delete(b.keys, name)
+		}
+		b.keysMu.Unlock()
+		b.versionsMu.RUnlock()
+	}
+}
+
+// stagingPath returns a new temporary path to write an object to
+// before it is moved into a versioned bucket
+func stagingPath(_vfs *vfs.VFS, bucket string) (string, error) {
+	dir := path.Join(bucketMetaDir(bucket), stagingDirName)
+	if err := mkdirRecursive(dir, _vfs); err != nil {
+		return "", err
+	}
+	return path.Join(dir, random.String(32)), nil
+}
+
+// versionDir returns the directory in the version tree for key
+func versionDir(bucket, key string) string {
+	return path.Join(bucketMetaDir(bucket), versionsDirName, key)
+}
+
+// versionLeaf returns the name of v in the version tree
+func versionLeaf(v objectVersion) string {
+	leaf := fmt.Sprintf("%016x-%s", v.created.UnixNano(), v.id)
+	if v.current {
+		leaf += currentSuffix
+	} else if v.deleteMarker {
+		leaf += deletedSuffix
+	}
+	return leaf
+}
+
+// parseVersionLeaf parses a name in the version tree
+func parseVersionLeaf(leaf string) (v objectVersion, ok bool) {
+	name, current := strings.CutSuffix(leaf, currentSuffix)
+	if !current {
+		name, v.deleteMarker = strings.CutSuffix(name, deletedSuffix)
+	}
+	created, id, found := strings.Cut(name, "-")
+	if !found || id == "" {
+		return v, false
+	}
+	nanos, err := strconv.ParseInt(created, 16, 64)
+	if err != nil {
+		return v, false
+	}
+	v.id = gofakes3.VersionID(id)
+	v.created = time.Unix(0, nanos)
+	v.current = current
+	v.leaf = leaf
+	return v, true
+}
+
+// versionPath returns the path to the contents of v
+func versionPath(bucket, key string, v objectVersion) string {
+	if v.current {
+		return path.Join(bucket, key)
+	}
+	return path.Join(versionDir(bucket, key), v.leaf)
+}
+
+// listVersions returns the versions of key, newest first.
+//
+// If the object is in the bucket it is always the first.
+func (b *s3Backend) listVersions(_vfs *vfs.VFS, bucket, key string) (versions []objectVersion, err error) {
+	entries, err := getDirEntries(versionDir(bucket, key), _vfs)
+	if err != nil && err != gofakes3.ErrNoSuchKey {
+		return nil, err
+	}
+	var marker *objectVersion
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		v, ok := parseVersionLeaf(entry.Name())
+		if !ok {
+			continue
+		}
+		if v.current {
+			marker = &v
+			continue
+		}
+		versions = append(versions, v)
+	}
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].created.After(versions[j].created)
+	})
+	node, err := _vfs.Stat(path.Join(bucket, key))
+	if err == nil && node.IsFile() {
+		current := objectVersion{
+			id:      nullVersionID,
+			created: node.ModTime(),
+			current: true,
+		}
+		if marker != nil {
+			current = *marker
+		}
+		versions = append([]objectVersion{current}, versions...)
+	}
+	return versions, nil
+}
+
+// findVersion returns the version id of key
+func (b *s3Backend) findVersion(_vfs *vfs.VFS, bucket, key string, id gofakes3.VersionID) (v objectVersion, err error) {
+	versions, err := b.listVersions(_vfs, bucket, key)
+	if err != nil {
+		return v, err
+	}
+	for _, v := range versions {
+		if v.id == id {
+			return v, nil
+		}
+	}
+	return v, gofakes3.ErrNoSuchVersion
+}
+
+// moveVersion renames the object at src to dst along with its metadata
+func (b *s3Backend) moveVersion(_vfs *vfs.VFS, src, dst string) error {
+	if err := mkdirRecursive(path.Dir(dst), _vfs); err != nil {
+		return err
+	}
+	if err := _vfs.Rename(src, dst); err != nil {
+		return err
+	}
+	if meta, ok := b.meta.LoadAndDelete(src); ok {
+		b.meta.Store(dst, meta)
+	}
+	return nil
+}
+
+// removeVersion removes the version v of key
+//
+// Call with the key locked
+func (b *s3Backend) removeVersion(_vfs *vfs.VFS, bucket, key string, v objectVersion) error {
+	fp := versionPath(bucket, key, v)
+	if err := _vfs.Remove(fp); err != nil && !errors.Is(err, vfs.ENOENT) {
+		return err
+	}
+	b.meta.Delete(fp)
+	if v.current && v.leaf != "" {
+		if err := _vfs.Remove(path.Join(versionDir(bucket, key), v.leaf)); err != nil && !errors.Is(err, vfs.ENOENT) {
+			return err
+		}
+	}
+	return nil
+}
+
+// archiveCurrent moves the object in the bucket into the version tree
+// before it is overwritten or deleted.
+//
+// There can only be one version with the null version ID so any
+// earlier one is removed if a new one is about to be made.
+//
+// Call with the key locked
+func (b *s3Backend) archiveCurrent(_vfs *vfs.VFS, bucket, key string, status gofakes3.VersioningStatus) error {
+	versions, err := b.listVersions(_vfs, bucket, key)
+	if err != nil {
+		return err
+	}
+	var current *objectVersion
+	if len(versions) > 0 && versions[0].current {
+		current, versions = &versions[0], versions[1:]
+	}
+	if status == gofakes3.VersioningSuspended || (current != nil && current.id == nullVersionID) {
+		for _, v := range versions {
+			if v.id == nullVersionID {
+				if err := b.removeVersion(_vfs, bucket, key, v); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if current == nil || (current.id == nullVersionID && status == gofakes3.VersioningSuspended) {
+		return nil
+	}
+	archived := *current
+	archived.current = false
+	archived.leaf = versionLeaf(archived)
+	err = b.moveVersion(_vfs, path.Join(bucket, key), path.Join(versionDir(bucket, key), archived.leaf))
+	if err != nil {
+		return fmt.Errorf("failed to archive version: %w", err)
+	}
+	if current.leaf != "" {
+		if err := _vfs.Remove(path.Join(versionDir(bucket, key), current.leaf)); err != nil && !errors.Is(err, vfs.ENOENT) {
+			return err
+		}
+	}
+	return nil
+}
+
+// newCurrentVersion records the version ID of the object just
+// written to the bucket and returns it.
+//
+// Call with the key locked
+func (b *s3Backend) newCurrentVersion(_vfs *vfs.VFS, bucket, key string, status gofakes3.VersioningStatus) (gofakes3.VersionID, error) {
+	switch status {
+	case gofakes3.VersioningNone:
+		return "", nil
+	case gofakes3.VersioningSuspended:
+		return nullVersionID, nil
+	}
+	v := objectVersion{
+		id:      newVersionID(),
+		created: time.Now(),
+		current: true,
+	}
+	if err := b.writeMarker(_vfs, bucket, key, v); err != nil {
+		return "", err
+	}
+	return v.id, nil
+}
+
+// writeMarker writes the empty file for a current or delete marker
+func (b *s3Backend) writeMarker(_vfs *vfs.VFS, bucket, key string, v objectVersion) error {
+	dir := versionDir(bucket, key)
+	if err := mkdirRecursive(dir, _vfs); err != nil {
+		return err
+	}
+	return _vfs.WriteFile(path.Join(dir, versionLeaf(v)), nil, 0666)
+}
+
+// promoteLatest moves the latest version of key back into the bucket
+// if there is no current object and it isn't a delete marker.
+//
+// Call with the key locked
+func (b *s3Backend) promoteLatest(_vfs *vfs.VFS, bucket, key string) {
+	versions, err := b.listVersions(_vfs, bucket, key)
+	if err != nil || len(versions) == 0 || versions[0].current || versions[0].deleteMarker {
+		return
+	}
+	latest := versions[0]
+	if err := b.moveVersion(_vfs, versionPath(bucket, key, latest), path.Join(bucket, key)); err != nil {
+		fs.Errorf(path.Join(bucket, key), "Failed to restore version %q: %v", latest.id, err)
+		return
+	}
+	if latest.id != nullVersionID {
+		latest.current = true
+		if err := b.writeMarker(_vfs, bucket, key, latest); err != nil {
+			fs.Errorf(path.Join(bucket, key), "Failed to mark version %q as current: %v", latest.id, err)
+		}
+	}
+}
+
+// deleteObjectVersioned makes a delete marker for key
+func (b *s3Backend) deleteObjectVersioned(_vfs *vfs.VFS, bucket, key string, status gofakes3.VersioningStatus) (result gofakes3.ObjectDeleteResult, err error) {
+	defer b.lockKey(bucket, key)()
+	if err := b.archiveCurrent(_vfs, bucket, key, status); err != nil {
+		return result, err
+	}
+	fp := path.Join(bucket, key)
+	// A suspended bucket replaces the null version with the delete marker
+	if err := _vfs.Remove(fp); err != nil && !os.IsNotExist(err) {
+		return result, err
+	}
+	b.meta.Delete(fp)
+	marker := objectVersion{
+		id:           nullVersionID,
+		created:      time.Now(),
+		deleteMarker: true,
+	}
+	if status == gofakes3.VersioningEnabled {
+		marker.id = newVersionID()
+	}
+	if err := b.writeMarker(_vfs, bucket, key, marker); err != nil {
+		return result, err
+	}
+	rmdirRecursive(fp, _vfs)
+	result.IsDeleteMarker = true
+	result.VersionID = marker.id
+	return result, nil
+}
+
+// deleteVersion permanently deletes the version v of key
+//
+// Call with the key locked
+func (b *s3Backend) deleteVersion(_vfs *vfs.VFS, bucket, key string, v objectVersion, latest bool) error {
+	if err := b.removeVersion(_vfs, bucket, key, v); err != nil {
+		return err
+	}
+	if latest {
+		b.promoteLatest(_vfs, bucket, key)
+	}
+	if v.current {
+		rmdirRecursive(path.Join(bucket, key), _vfs)
+	}
+	removeEmptyDir(_vfs, versionDir(bucket, key))
+	return nil
+}
+
+// removeVersionTree removes the earlier versions and delete markers
+// of a deleted bucket
+func (b *s3Backend) removeVersionTree(_vfs *vfs.VFS, bucket string) {
+	b.versionsMu.Lock()
+	defer b.versionsMu.Unlock()
+	dir := path.Join(bucketMetaDir(bucket), versionsDirName)
+	node, err := _vfs.Stat(dir)
+	if err != nil {
+		return
+	}
+	d, ok := node.(*vfs.Dir)
+	if !ok {
+		return
+	}
+	if err := d.RemoveAll(); err != nil {
+		fs.Errorf(dir, "Failed to remove versions: %v", err)
+	}
+	b.meta.Range(func(key, _ any) bool {
+		if strings.HasPrefix(key.(string), dir+"/") {
+			b.meta.Delete(key)
+		}
+		return true
+	})
+}
+
+// versionedVFS returns the VFS for the versioning calls which don't
+// have a context so can't be used with the auth proxy.
+func (b *s3Backend) versionedVFS(bucket string) (*vfs.VFS, error) {
+	_vfs, err := b.s.getVFS(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if err := checkBucket(_vfs, bucket); err != nil {
+		return nil, err
+	}
+	return _vfs, nil
+}
+
+// VersioningConfiguration returns the versioning configuration of the bucket
+func (b *s3Backend) VersioningConfiguration(bucket string) (config gofakes3.VersioningConfiguration, err error) {
+	_vfs, err := b.versionedVFS(bucket)
+	if err != nil {
+		return config, err
+	}
+	config.Status, err = b.versioning(_vfs, bucket)
+	return config, err
+}
+
+// SetVersioningConfiguration sets the versioning configuration of the bucket
+func (b *s3Backend) SetVersioningConfiguration(bucket string, v gofakes3.VersioningConfiguration) error {
+	_vfs, err := b.versionedVFS(bucket)
+	if err != nil {
+		return err
+	}
+	if v.MFADelete.Enabled() {
+		return gofakes3.ErrNotImplemented
+	}
+	return b.setConfig(_vfs, bucket, func(config *bucketConfig) {
+		// Once versioning has been enabled it can only be suspended
+		if v.Status != gofakes3.VersioningNone || config.Versioning == gofakes3.VersioningNone {
+			config.Versioning = v.Status
+		}
+	})
+}
+
+// GetObjectVersion fetches the given version of the object
+func (b *s3Backend) GetObjectVersion(bucket, key string, id gofakes3.VersionID, rangeRequest *gofakes3.ObjectRangeRequest) (*gofakes3.Object, error) {
+	return b.objectVersion(bucket, key, id, rangeRequest, false)
+}
+
+// HeadObjectVersion fetches the info for the given version of the object
+func (b *s3Backend) HeadObjectVersion(bucket, key string, id gofakes3.VersionID) (*gofakes3.Object, error) {
+	return b.objectVersion(bucket, key, id, nil, true)
+}
+
+// objectVersion implements GetObjectVersion and HeadObjectVersion
+func (b *s3Backend) objectVersion(bucket, key string, id gofakes3.VersionID, rangeRequest *gofakes3.ObjectRangeRequest, head bool) (obj *gofakes3.Object, err error) {
+	_vfs, err := b.versionedVFS(bucket)
+	if err != nil {
+		return nil, err
+	}
+	v, err := b.findVersion(_vfs, bucket, key, id)
+	if err != nil {
+		return nil, err
+	}
+	if v.deleteMarker {
+		return &gofakes3.Object{
+			Name:           key,
+			VersionID:      id,
+			IsDeleteMarker: true,
+			Contents:       noOpReadCloser{},
+		}, nil
+	}
+	if head {
+		obj, err = b.headObject(_vfs, versionPath(bucket, key, v), key)
+	} else {
+		obj, err = b.getObject(_vfs, versionPath(bucket, key, v), key, rangeRequest)
+	}
+	if err != nil {
+		return nil, err
+	}
+	obj.VersionID = id
+	return obj, nil
+}
+
+// DeleteObjectVersion permanently deletes the given version of the object
+func (b *s3Backend) DeleteObjectVersion(bucket, key string, id gofakes3.VersionID) (result gofakes3.ObjectDeleteResult, err error) {
+	_vfs, err := b.versionedVFS(bucket)
+	if err != nil {
+		return result, err
+	}
+	defer b.lockKey(bucket, key)()
+	versions, err := b.listVersions(_vfs, bucket, key)
+	if err != nil {
+		return result, err
+	}
+	for i, v := range versions {
+		if v.id != id {
+			continue
+		}
+		if err := b.deleteVersion(_vfs, bucket, key, v, i == 0); err != nil {
+			return result, err
+		}
+		result.VersionID = id
+		result.IsDeleteMarker = v.deleteMarker
+		break
+	}
+	return result, nil
+}
+
+// versionKeys returns the sorted keys of the objects in the bucket
+// and in its version tree.
+func (b *s3Backend) versionKeys(_vfs *vfs.VFS, bucket string) ([]string, error) {
+	keys := map[string]struct{}{}
+	err := walkFiles(_vfs, bucket, func(key string, node vfs.Node) {
+		keys[key] = struct{}{}
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = walkFiles(_vfs, path.Join(bucketMetaDir(bucket), versionsDirName), func(leaf string, node vfs.Node) {
+		if key := path.Dir(leaf); key != "." {
+			keys[key] = struct{}{}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return slices.Sorted(maps.Keys(keys)), nil
+}
+
+// versionItem makes the listing entry for version v of key
+func (b *s3Backend) versionItem(_vfs *vfs.VFS, bucket, key string, v objectVersion, latest bool) gofakes3.VersionItem {
+	if v.deleteMarker {
+		return &gofakes3.DeleteMarker{
+			Key:          key,
+			VersionID:    v.id,
+			IsLatest:     latest,
+			LastModified: gofakes3.NewContentTime(v.created),
+		}
+	}
+	item := &gofakes3.Version{
+		Key:          key,
+		VersionID:    v.id,
+		IsLatest:     latest,
+		LastModified: gofakes3.NewContentTime(v.created),
+		StorageClass: gofakes3.StorageStandard,
+	}
+	node, err := _vfs.Stat(versionPath(bucket, key, v))
+	if err == nil {
+		item.Size = node.Size()
+		item.ETag = `"` + getFileHash(node, b.s.etagHashType) + `"`
+	}
+	return item
+}
+
+// ListBucketVersions lists the versions of the objects in the bucket
+func (b *s3Backend) ListBucketVersions(bucket string, prefix *gofakes3.Prefix, page *gofakes3.ListBucketVersionsPage) (*gofakes3.ListBucketVersionsResult, error) {
+	_vfs, err := b.versionedVFS(bucket)
+	if err != nil {
+		return nil, err
+	}
+	var p gofakes3.Prefix
+	if prefix != nil {
+		p = *prefix
+	}
+	// workaround as in ListBucket
+	if strings.TrimSpace(p.Prefix) == "" {
+		p.HasPrefix = false
+	}
+	if strings.TrimSpace(p.Delimiter) == "" {
+		p.HasDelimiter = false
+	}
+	prefix = &p
+	if page == nil {
+		page = &gofakes3.ListBucketVersionsPage{}
+	}
+	maxKeys := page.MaxKeys
+	if maxKeys <= 0 {
+		maxKeys = gofakes3.DefaultBucketVersionKeys
+	}
+	keys, err := b.versionKeys(_vfs, bucket)
+	if err != nil {
+		return nil, err
+	}
+	result := gofakes3.NewListBucketVersionsResult(bucket, prefix, page)
+	var n int64
+	for _, key := range keys {
+		var match gofakes3.PrefixMatch
+		if !prefix.Match(key, &match) {
+			continue
+		}
+		if match.CommonPrefix {
+			result.AddPrefix(match.MatchedPart)
+			continue
+		}
+		if page.HasKeyMarker && (key < page.KeyMarker || (key == page.KeyMarker && !page.HasVersionIDMarker)) {
+			continue
+		}
+		versions, err := b.listVersions(_vfs, bucket, key)
+		if err != nil {
+			return nil, err
+		}
+		skipping := page.HasVersionIDMarker && key == page.KeyMarker
+		for i, v := range versions {
+			if skipping {
+				skipping = v.id != page.VersionIDMarker
+				continue
+			}
+			if n >= maxKeys {
+				result.IsTruncated = true
+				return result, nil
+			}
+			result.Versions = append(result.Versions, b.versionItem(_vfs, bucket, key, v, i == 0))
+			result.NextKeyMarker, result.NextVersionIDMarker = key, v.id
+			n++
+		}
+	}
+	result.NextKeyMarker, result.NextVersionIDMarker = "", ""
+	return result, nil
+}
+
+// serveVersions implements ListObjectVersions with the url
+// encoding-type which gofakes3 doesn't support
+func (b *s3Backend) serveVersions(w http.ResponseWriter, r *http.Request, bucket string) error {
+	query := r.URL.Query()
+	prefix := gofakes3.Prefix{
+		Prefix:    query.Get("prefix"),
+		Delimiter: query.Get("delimiter"),
+	}
+	_, prefix.HasPrefix = query["prefix"]
+	_, prefix.HasDelimiter = query["delimiter"]
+	page := gofakes3.ListBucketVersionsPage{
+		MaxKeys:         gofakes3.DefaultMaxBucketVersionKeys,
+		KeyMarker:       query.Get("key-marker"),
+		VersionIDMarker: gofakes3.VersionID(query.Get("version-id-marker")),
+	}
+	_, page.HasKeyMarker = query["key-marker"]
+	_, page.HasVersionIDMarker = query["version-id-marker"]
+	if page.HasKeyMarker && page.KeyMarker == "" {
+		page = gofakes3.ListBucketVersionsPage{MaxKeys: page.MaxKeys}
+	}
+	if maxKeys := query.Get("max-keys"); maxKeys != "" {
+		n, err := strconv.ParseInt(maxKeys, 10, 64)
+		if err != nil || n < 0 {
+			return gofakes3.ErrInvalidArgument
+		}
+		page.MaxKeys = min(n, gofakes3.MaxBucketVersionKeys)
+	}
+	result, err := b.ListBucketVersions(bucket, &prefix, &page)
+	if err != nil {
+		return err
+	}
+	result.Prefix = gofakes3.URLEncode(result.Prefix)
+	result.KeyMarker = gofakes3.URLEncode(result.KeyMarker)
+	result.NextKeyMarker = gofakes3.URLEncode(result.NextKeyMarker)
+	for i := range result.CommonPrefixes {
+		result.CommonPrefixes[i].Prefix = gofakes3.URLEncode(result.CommonPrefixes[i].Prefix)
+	}
+	for _, item := range result.Versions {
+		switch v := item.(type) {
+		case *gofakes3.Version:
+			v.Key = gofakes3.URLEncode(v.Key)
+		case *gofakes3.DeleteMarker:
+			v.Key = gofakes3.URLEncode(v.Key)
+		}
+	}
+	return writeXML(w, result)
+}
+
+// serveHeadVersion implements HeadObject with a versionId as gofakes3
+// ignores the versionId on HEAD requests
+func (b *s3Backend) serveHeadVersion(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	obj, err := b.HeadObjectVersion(bucket, key, versionFromQuery(r.URL.Query()))
+	if err != nil {
+		return err
+	}
+	w.Header().Set("x-amz-version-id", string(obj.VersionID))
+	if obj.IsDeleteMarker {
+		w.Header().Set("x-amz-delete-marker", "true")
+		return gofakes3.ErrMethodNotAllowed
+	}
+	for k, v := range obj.Metadata {
+		w.Header().Set(k, v)
+	}
+	etag := `"` + hex.EncodeToString(obj.Hash) + `"`
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("Content-Length", strconv.FormatInt(obj.Size, 10))
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
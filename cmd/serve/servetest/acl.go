@@ -0,0 +1,206 @@
+package servetest
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/cmd/serve/proxy"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The ACL the test proxy returns - this mustn't contain spaces
+const testACL = "/public=rl,/public/secret=-,/incoming=w,/home/me=rwld"
+
+// TestACL runs the server with an auth proxy which returns _acl then
+// checks the rules are enforced using the backend called name as the
+// client.
+func TestACL(t *testing.T, name string, start StartFn) {
+	fstest.Initialise()
+	ctx := context.Background()
+
+	// Make the files the proxy will serve
+	dir := t.TempDir()
+	fremote, err := fs.NewFs(ctx, dir)
+	require.NoError(t, err)
+	for _, remote := range []string{
+		"public/file.txt",
+		"public/secret/file.txt",
+		"private/file.txt",
+		"home/me/file.txt",
+		"home/other/file.txt",
+	} {
+		put(t, fremote, remote, "hello")
+	}
+	require.NoError(t, fremote.Mkdir(ctx, "incoming"))
+
+	prog, err := filepath.Abs("../servetest/proxy_code.go")
+	require.NoError(t, err)
+	// FIXME this is untidy setting a global variable!
+	proxy.Opt.AuthProxy = "go run " + prog + " " + dir + " " + testACL
+	defer func() {
+		proxy.Opt.AuthProxy = ""
+	}()
+	config, cleanup := start(nil)
+	defer cleanup()
+
+	// Make the client with the defaults filled in
+	fsInfo, err := fs.Find(name)
+	require.NoError(t, err)
+	for i := range fsInfo.Options {
+		o := &fsInfo.Options[i]
+		if _, found := config.Get(o.Name); !found && o.Default != nil && o.String() != "" {
+			config.Set(o.Name, o.String())
+		}
+	}
+	f, err := fsInfo.NewFs(ctx, "servetestacl", "", config)
+	require.NoError(t, err)
+
+	// exists returns true if remote exists on the server. Some
+	// clients ignore errors from the server so use this to check
+	// the rules were enforced.
+	exists := func(remote string) bool {
+		_, err := fremote.NewObject(ctx, remote)
+		if err == fs.ErrorIsDir {
+			return true
+		}
+		return err == nil
+	}
+
+	// list returns the names in dir or an error
+	list := func(dir string) (names []string, err error) {
+		entries, err := f.List(ctx, dir)
+		for _, entry := range entries {
+			names = append(names, filepath.Base(entry.Remote()))
+		}
+		return names, err
+	}
+
+	t.Run("Root", func(t *testing.T) {
+		names, err := list("")
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"home", "incoming", "public"}, names)
+
+		names, err = list("home")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"me"}, names)
+
+		_, err = list("private")
+		assert.Error(t, err)
+		_, err = f.NewObject(ctx, "private/file.txt")
+		assert.Error(t, err)
+
+		_ = f.Mkdir(ctx, "newdir")
+		assert.False(t, exists("newdir"))
+		_, _ = putErr(f, "file.txt")
+		assert.False(t, exists("file.txt"))
+	})
+
+	t.Run("ReadOnly", func(t *testing.T) {
+		names, err := list("public")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"file.txt"}, names)
+
+		_, err = list("public/secret")
+		assert.Error(t, err)
+
+		o, err := f.NewObject(ctx, "public/file.txt")
+		require.NoError(t, err)
+		assert.Equal(t, "hello", read(t, o))
+
+		_, _ = putErr(f, "public/new.txt")
+		assert.False(t, exists("public/new.txt"))
+		_ = o.Remove(ctx)
+		assert.True(t, exists("public/file.txt"))
+		_ = f.Mkdir(ctx, "public/newdir")
+		assert.False(t, exists("public/newdir"))
+	})
+
+	t.Run("UploadOnly", func(t *testing.T) {
+		// Some clients fail to read the object back after the upload
+		_, _ = putErr(f, "incoming/upload.txt")
+		o, err := fremote.NewObject(ctx, "incoming/upload.txt")
+		require.NoError(t, err)
+		assert.Equal(t, "upload", read(t, o))
+
+		_, err = list("incoming")
+		assert.Error(t, err)
+
+		// The client may be able to find the object but not read it
+		o, err = f.NewObject(ctx, "incoming/upload.txt")
+		if err == nil {
+			in, err := o.Open(ctx)
+			if err == nil {
+				_, err = io.ReadAll(in)
+				_ = in.Close()
+			}
+			assert.Error(t, err)
+			// nor find its checksum
+			sum, _ := o.Hash(ctx, hash.MD5)
+			assert.NotEqual(t, fmt.Sprintf("%x", md5.Sum([]byte("upload"))), sum)
+			_ = o.Remove(ctx)
+		}
+		assert.True(t, exists("incoming/upload.txt"))
+	})
+
+	t.Run("FullAccess", func(t *testing.T) {
+		o, err := putErr(f, "home/me/upload.txt")
+		require.NoError(t, err)
+		assert.Equal(t, "upload", read(t, o))
+		require.NoError(t, f.Mkdir(ctx, "home/me/dir"))
+
+		names, err := list("home/me")
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"dir", "file.txt", "upload.txt"}, names)
+
+		_, err = operations.Move(ctx, f, nil, "home/me/moved.txt", o)
+		require.NoError(t, err)
+		o, err = f.NewObject(ctx, "home/me/moved.txt")
+		require.NoError(t, err)
+
+		// can't move out of the home directory
+		_, _ = operations.Move(ctx, f, nil, "public/moved.txt", o)
+		assert.False(t, exists("public/moved.txt"))
+		assert.True(t, exists("home/me/moved.txt"))
+
+		require.NoError(t, o.Remove(ctx))
+		require.NoError(t, f.Rmdir(ctx, "home/me/dir"))
+	})
+}
+
+// put a file with contents onto f
+func put(t *testing.T, f fs.Fs, remote, contents string) {
+	obji := object.NewStaticObjectInfo(remote, time.Now(), int64(len(contents)), true, nil, nil)
+	_, err := f.Put(context.Background(), bytes.NewBufferString(contents), obji)
+	require.NoError(t, err)
+}
+
+// putErr puts a file containing "upload" onto f returning any error
+func putErr(f fs.Fs, remote string) (fs.Object, error) {
+	const contents = "upload"
+	obji := object.NewStaticObjectInfo(remote, time.Now(), int64(len(contents)), true, nil, nil)
+	return f.Put(context.Background(), bytes.NewBufferString(contents), obji)
+}
+
+// read the contents of o
+func read(t *testing.T, o fs.Object) string {
+	in, err := o.Open(context.Background())
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, in.Close())
+	}()
+	data, err := io.ReadAll(in)
+	require.NoError(t, err)
+	return string(data)
+}
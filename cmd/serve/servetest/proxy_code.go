@@ -11,7 +11,7 @@ import (
 
 func main() {
 	if len(os.Args) < 2 {
-		log.Fatalf("Syntax: %s <root>", os.Args[0])
+		log.Fatalf("Syntax: %s <root> [<acl>]", os.Args[0])
 	}
 	root := os.Args[1]
 
@@ -28,6 +28,9 @@ func main() {
 		"_root":    root,
 		"_obscure": "pass",
 	}
+	if len(os.Args) > 2 {
+		out["_acl"] = os.Args[2]
+	}
 	json.NewEncoder(os.Stdout).Encode(&out)
 	if err != nil {
 		log.Fatal(err)
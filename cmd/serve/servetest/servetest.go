@@ -31,7 +31,7 @@ type StartFn func(f fs.Fs) (configmap.Simple, func())
 
 // run runs the server then runs the unit tests for the remote against
 // it.
-func run(t *testing.T, name string, start StartFn, useProxy bool) {
+func run(t *testing.T, name, path string, start StartFn, useProxy bool) {
 	fremote, _, clean, err := fstest.RandomRemote()
 	assert.NoError(t, err)
 	defer clean()
@@ -80,7 +80,7 @@ func run(t *testing.T, name string, start StartFn, useProxy bool) {
 	if *subRun != "" {
 		args = append(args, "-run", *subRun)
 	}
-	args = append(args, "-remote", remoteName)
+	args = append(args, "-remote", remoteName+path)
 	args = append(args, "-list-retries", fmt.Sprint(*fstest.ListRetries))
 	cmd := exec.Command("go", args...)
 
@@ -102,11 +102,18 @@ func run(t *testing.T, name string, start StartFn, useProxy bool) {
 // Run runs the server then runs the unit tests for the remote against
 // it.
 func Run(t *testing.T, name string, start StartFn) {
+	RunPath(t, name, "", start)
+}
+
+// RunPath runs the server then runs the unit tests for the remote
+// against it using path as the root of the remote. This is for
+// backends like smb which need the share name in the path.
+func RunPath(t *testing.T, name, path string, start StartFn) {
 	fstest.Initialise()
 	t.Run("Normal", func(t *testing.T) {
-		run(t, name, start, false)
+		run(t, name, path, start, false)
 	})
 	t.Run("AuthProxy", func(t *testing.T) {
-		run(t, name, start, true)
+		run(t, name, path, start, true)
 	})
 }
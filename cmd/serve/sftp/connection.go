@@ -200,6 +200,10 @@ func (c *conn) handleHashsumCommand(ctx context.Context, out io.Writer, ht hash.
 		}
 		args = "-"
 	} else {
+		err := c.vfs.CheckAccess(args, vfscommon.PermRead)
+		if err != nil {
+			return fmt.Errorf("hash failed finding file %q: %w", args, err)
+		}
 		node, err := c.vfs.Stat(args)
 		if err != nil {
 			return fmt.Errorf("hash failed finding file %q: %w", args, err)
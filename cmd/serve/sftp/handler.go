@@ -5,12 +5,14 @@ package sftp
 import (
 	"io"
 	"os"
+	"path"
 	"syscall"
 	"time"
 
 	"github.com/pkg/sftp"
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/vfs"
+	"github.com/rclone/rclone/vfs/vfscommon"
 )
 
 // vfsHandler converts the VFS to be served by SFTP
@@ -30,6 +32,9 @@ func newVFSHandler(vfs *vfs.VFS) sftp.Handlers {
 }
 
 func (v vfsHandler) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	if err := v.CheckAccess(r.Filepath, vfscommon.PermRead); err != nil {
+		return nil, err
+	}
 	file, err := v.OpenFile(r.Filepath, os.O_RDONLY, 0777)
 	if err != nil {
 		return nil, err
@@ -38,6 +43,13 @@ func (v vfsHandler) Fileread(r *sftp.Request) (io.ReaderAt, error) {
 }
 
 func (v vfsHandler) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	if err := v.CheckAccess(r.Filepath, vfscommon.PermWrite); err != nil {
+		return nil, err
+	}
+	// SFTP has no locking so don't overwrite files locked by others
+	if err := v.Locks().CheckWrite(r.Filepath); err != nil {
+		return nil, err
+	}
 	file, err := v.OpenFile(r.Filepath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0777)
 	if err != nil {
 		return nil, err
@@ -48,6 +60,10 @@ func (v vfsHandler) Filewrite(r *sftp.Request) (io.WriterAt, error) {
 func (v vfsHandler) Filecmd(r *sftp.Request) error {
 	switch r.Method {
 	case "Setstat":
+		err := v.CheckAccess(r.Filepath, vfscommon.PermWrite)
+		if err != nil {
+			return err
+		}
 		attr := r.Attributes()
 		if attr.Mtime != 0 {
 			modTime := time.Unix(int64(attr.Mtime), 0)
@@ -58,17 +74,45 @@ func (v vfsHandler) Filecmd(r *sftp.Request) error {
 		}
 		return nil
 	case "Rename":
-		err := v.Rename(r.Filepath, r.Target)
+		err := v.CheckAccess(r.Filepath, vfscommon.PermDelete)
+		if err != nil {
+			return err
+		}
+		err = v.CheckAccess(r.Target, vfscommon.PermWrite)
+		if err != nil {
+			return err
+		}
+		err = v.Locks().CheckWrite(r.Filepath)
+		if err != nil {
+			return err
+		}
+		err = v.Locks().CheckWrite(r.Target)
+		if err != nil {
+			return err
+		}
+		err = v.Rename(r.Filepath, r.Target)
 		if err != nil {
 			return err
 		}
 	case "Rmdir", "Remove":
-		err := v.Remove(r.Filepath)
+		err := v.CheckAccess(r.Filepath, vfscommon.PermDelete)
+		if err != nil {
+			return err
+		}
+		err = v.Locks().CheckWrite(r.Filepath)
+		if err != nil {
+			return err
+		}
+		err = v.Remove(r.Filepath)
 		if err != nil {
 			return err
 		}
 	case "Mkdir":
-		err := v.Mkdir(r.Filepath, 0777)
+		err := v.CheckAccess(r.Filepath, vfscommon.PermWrite)
+		if err != nil {
+			return err
+		}
+		err = v.Mkdir(r.Filepath, 0777)
 		if err != nil {
 			return err
 		}
@@ -110,6 +154,10 @@ func (v vfsHandler) Filelist(r *sftp.Request) (l sftp.ListerAt, err error) {
 	var handle vfs.Handle
 	switch r.Method {
 	case "List":
+		err = v.CheckAccess(r.Filepath, vfscommon.PermList)
+		if err != nil {
+			return nil, err
+		}
 		node, err = v.Stat(r.Filepath)
 		if err != nil {
 			return nil, err
@@ -126,8 +174,19 @@ func (v vfsHandler) Filelist(r *sftp.Request) (l sftp.ListerAt, err error) {
 		if err != nil {
 			return nil, err
 		}
-		return listerat(fis), nil
+		// Only show the items the ACL lets the user see
+		visible := fis[:0]
+		for _, fi := range fis {
+			if v.Visible(path.Join(r.Filepath, fi.Name())) {
+				visible = append(visible, fi)
+			}
+		}
+		return listerat(visible), nil
 	case "Stat":
+		err = v.CheckAccess(r.Filepath, 0)
+		if err != nil {
+			return nil, err
+		}
 		node, err = v.Stat(r.Filepath)
 		if err != nil {
 			return nil, err
@@ -54,6 +54,7 @@ func newServer(ctx context.Context, f fs.Fs, opt *Options, vfsOpt *vfscommon.Opt
 	}
 	if proxy.Opt.AuthProxy != "" {
 		s.proxy = proxy.New(ctx, proxyOpt, vfsOpt)
+		s.proxy.EnforcesACL = true
 	} else {
 		s.vfs = vfs.New(f, vfsOpt)
 	}
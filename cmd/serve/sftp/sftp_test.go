@@ -14,6 +14,7 @@ import (
 
 	"github.com/pkg/sftp"
 	_ "github.com/rclone/rclone/backend/local"
+	_ "github.com/rclone/rclone/backend/sftp"
 	"github.com/rclone/rclone/cmd/serve/proxy"
 	"github.com/rclone/rclone/cmd/serve/servetest"
 	"github.com/rclone/rclone/fs"
@@ -42,8 +43,17 @@ var (
 // TestSftp runs the sftp server then runs the unit tests for the
 // sftp remote against it.
 func TestSftp(t *testing.T) {
-	// Configure and start the server
-	start := func(f fs.Fs) (configmap.Simple, func()) {
+	servetest.Run(t, "sftp", start(t))
+}
+
+// TestACL checks the rules returned by the auth proxy are enforced
+func TestACL(t *testing.T) {
+	servetest.TestACL(t, "sftp", start(t))
+}
+
+// start returns a function to configure and start the server
+func start(t *testing.T) servetest.StartFn {
+	return func(f fs.Fs) (configmap.Simple, func()) {
 		opt := Opt
 		opt.ListenAddr = testBindAddress
 		opt.User = testUser
@@ -73,8 +83,6 @@ func TestSftp(t *testing.T) {
 			assert.NoError(t, w.Shutdown())
 		}
 	}
-
-	servetest.Run(t, "sftp", start)
 }
 
 func TestRc(t *testing.T) {
@@ -0,0 +1,473 @@
+package smb
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rc4"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/md4" //nolint:staticcheck // md4 is needed for NTLM
+)
+
+// This file implements the server side of NTLMv2 authentication
+// (MS-NLMP) wrapped in SPNEGO (RFC 4178) as used by SMB2.
+
+// ASN.1 object identifiers
+var (
+	spnegoOID = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 2}
+	ntlmOID   = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 2, 10}
+)
+
+// SPNEGO negotiation states
+const (
+	negStateAcceptCompleted  = 0
+	negStateAcceptIncomplete = 1
+)
+
+// negTokenInit is the first SPNEGO token sent by the client
+type negTokenInit struct {
+	MechTypes   []asn1.ObjectIdentifier `asn1:"explicit,optional,tag:0"`
+	ReqFlags    asn1.BitString          `asn1:"explicit,optional,tag:1"`
+	MechToken   []byte                  `asn1:"explicit,optional,tag:2"`
+	MechListMIC []byte                  `asn1:"explicit,optional,tag:3"`
+}
+
+// negTokenInit2 is the SPNEGO token sent in the negotiate response
+type negTokenInit2 struct {
+	MechTypes []asn1.ObjectIdentifier `asn1:"explicit,tag:0"`
+	NegHints  asn1.RawValue           `asn1:"optional"`
+}
+
+// negTokenResp is the SPNEGO token for the rest of the exchange
+type negTokenResp struct {
+	NegState      asn1.Enumerated       `asn1:"explicit,optional,tag:0"`
+	SupportedMech asn1.ObjectIdentifier `asn1:"explicit,optional,tag:1"`
+	ResponseToken []byte                `asn1:"explicit,optional,tag:2"`
+	MechListMIC   []byte                `asn1:"explicit,optional,tag:3"`
+}
+
+// negTokenRespOut is a negTokenResp for encoding - the negState is
+// raw as asn1 omits optional zero values
+type negTokenRespOut struct {
+	NegState      asn1.RawValue         `asn1:"optional"`
+	SupportedMech asn1.ObjectIdentifier `asn1:"explicit,optional,tag:1"`
+	ResponseToken []byte                `asn1:"explicit,optional,tag:2"`
+	MechListMIC   []byte                `asn1:"explicit,optional,tag:3"`
+}
+
+// The negHints sent by Windows "not_defined_in_RFC4178@please_ignore"
+var negHints = []byte{
+	0xa3, 0x2a, 0x30, 0x28, 0xa0, 0x26, 0x1b, 0x24,
+	'n', 'o', 't', '_', 'd', 'e', 'f', 'i', 'n', 'e', 'd', '_', 'i', 'n', '_',
+	'R', 'F', 'C', '4', '1', '7', '8', '@', 'p', 'l', 'e', 'a', 's', 'e', '_',
+	'i', 'g', 'n', 'o', 'r', 'e',
+}
+
+// negotiateToken returns the security buffer for the negotiate
+// response offering NTLM
+func negotiateToken() []byte {
+	inner, err := asn1.MarshalWithParams(negTokenInit2{
+		MechTypes: []asn1.ObjectIdentifier{ntlmOID},
+		NegHints:  asn1.RawValue{FullBytes: negHints},
+	}, "explicit,tag:0")
+	if err != nil {
+		panic(err)
+	}
+	oid, err := asn1.Marshal(spnegoOID)
+	if err != nil {
+		panic(err)
+	}
+	out, err := asn1.Marshal(asn1.RawValue{
+		Class:      asn1.ClassApplication,
+		Tag:        0,
+		IsCompound: true,
+		Bytes:      append(oid, inner...),
+	})
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// spnegoToken is a decoded SPNEGO token from the client
+type spnegoToken struct {
+	raw       bool   // set if this was a bare NTLMSSP token
+	init      bool   // set if this was a negTokenInit
+	mechTypes []byte // DER of the mechTypes for the mechListMIC
+	ntlm      bool   // set if the mechToken is for NTLM
+	mechToken []byte
+}
+
+var ntlmSignature = []byte("NTLMSSP\x00")
+
+// decodeSpnego decodes the security buffer from a session setup
+func decodeSpnego(buf []byte) (tok spnegoToken, err error) {
+	if bytes.HasPrefix(buf, ntlmSignature) {
+		return spnegoToken{raw: true, ntlm: true, mechToken: buf}, nil
+	}
+	if len(buf) == 0 {
+		return tok, errors.New("empty security buffer")
+	}
+	switch buf[0] {
+	case 0x60: // [APPLICATION 0] InitialContextToken
+		var outer asn1.RawValue
+		if _, err = asn1.Unmarshal(buf, &outer); err != nil {
+			return tok, err
+		}
+		var oid asn1.ObjectIdentifier
+		rest, err := asn1.Unmarshal(outer.Bytes, &oid)
+		if err != nil {
+			return tok, err
+		}
+		if !oid.Equal(spnegoOID) {
+			return tok, errors.New("not a SPNEGO token")
+		}
+		var init negTokenInit
+		if _, err = asn1.UnmarshalWithParams(rest, &init, "explicit,tag:0"); err != nil {
+			return tok, err
+		}
+		tok.init = true
+		tok.mechTypes, err = asn1.Marshal(init.MechTypes)
+		if err != nil {
+			return tok, err
+		}
+		// The mechToken is for the client's preferred mech
+		tok.ntlm = len(init.MechTypes) > 0 && init.MechTypes[0].Equal(ntlmOID)
+		tok.mechToken = init.MechToken
+	case 0xa1: // [1] NegTokenResp
+		var resp negTokenResp
+		if _, err = asn1.UnmarshalWithParams(buf, &resp, "explicit,tag:1"); err != nil {
+			return tok, err
+		}
+		tok.ntlm = true
+		tok.mechToken = resp.ResponseToken
+	default:
+		return tok, errors.New("unknown security token")
+	}
+	return tok, nil
+}
+
+// encodeSpnego wraps token in a negTokenResp unless the client sent
+// a bare NTLMSSP token
+func encodeSpnego(raw bool, state int, token, mic []byte, mech bool) []byte {
+	if raw {
+		return token
+	}
+	resp := negTokenRespOut{
+		NegState:      asn1.RawValue{FullBytes: []byte{0xa0, 0x03, 0x0a, 0x01, byte(state)}},
+		ResponseToken: token,
+		MechListMIC:   mic,
+	}
+	if mech {
+		resp.SupportedMech = ntlmOID
+	}
+	out, err := asn1.MarshalWithParams(resp, "explicit,tag:1")
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// NTLM negotiate flags
+const (
+	ntlmNegotiateUnicode       = 0x00000001
+	ntlmRequestTarget          = 0x00000004
+	ntlmNegotiateSign          = 0x00000010
+	ntlmNegotiateNTLM          = 0x00000200
+	ntlmNegotiateAlwaysSign    = 0x00008000
+	ntlmTargetTypeServer       = 0x00020000
+	ntlmNegotiateExtendedSec   = 0x00080000
+	ntlmNegotiateTargetInfo    = 0x00800000
+	ntlmNegotiateVersion       = 0x02000000
+	ntlmNegotiate128           = 0x20000000
+	ntlmNegotiateKeyExch       = 0x40000000
+	ntlmNegotiate56            = 0x80000000
+	ntlmDefaultFlags           = ntlmNegotiate56 | ntlmNegotiateKeyExch | ntlmNegotiate128 | ntlmNegotiateTargetInfo | ntlmNegotiateExtendedSec | ntlmNegotiateAlwaysSign | ntlmNegotiateNTLM | ntlmNegotiateSign | ntlmRequestTarget | ntlmNegotiateUnicode | ntlmNegotiateVersion
+	ntlmMessageNegotiate       = 1
+	ntlmMessageChallenge       = 2
+	ntlmMessageAuthenticate    = 3
+	ntlmAvEOL                  = 0
+	ntlmAvNbComputerName       = 1
+	ntlmAvNbDomainName         = 2
+	ntlmAvDNSComputerName      = 3
+	ntlmAvDNSDomainName        = 4
+	ntlmAvFlags                = 6
+	ntlmAvTimestamp            = 7
+	ntlmAvFlagMICPresent       = 0x00000002
+	ntlmV2ResponseHeaderLength = 28
+)
+
+// The version sent in NTLM messages - Windows 10
+var ntlmVersion = []byte{10, 0, 0, 0, 0, 0, 0, 15}
+
+// utf16le encodes s as UTF-16 little endian
+func utf16le(s string) []byte {
+	u := utf16.Encode([]rune(s))
+	buf := make([]byte, 2*len(u))
+	for i, c := range u {
+		binary.LittleEndian.PutUint16(buf[2*i:], c)
+	}
+	return buf
+}
+
+// fromUTF16le decodes UTF-16 little endian
+func fromUTF16le(buf []byte) string {
+	u := make([]uint16, len(buf)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(buf[2*i:])
+	}
+	return string(utf16.Decode(u))
+}
+
+// ntHash returns the NT hash (MD4 of the UTF-16 password) of password
+func ntHash(password string) []byte {
+	h := md4.New()
+	h.Write(utf16le(password))
+	return h.Sum(nil)
+}
+
+// toFileTime converts t to a Windows FILETIME - 100ns intervals since 1601
+func toFileTime(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.UnixNano()/100 + 116444736000000000)
+}
+
+// fromFileTime converts a Windows FILETIME to a time
+func fromFileTime(ft uint64) time.Time {
+	return time.Unix(0, (int64(ft)-116444736000000000)*100)
+}
+
+// ntlmServer holds the state of one NTLM authentication
+type ntlmServer struct {
+	computer  string // NetBIOS name of the server
+	domain    string // NetBIOS domain of the server
+	negotiate []byte // the NEGOTIATE message from the client
+	challenge []byte // the CHALLENGE message we sent
+}
+
+// challengeMessage returns the CHALLENGE message in response to the
+// client's NEGOTIATE message
+func (a *ntlmServer) challengeMessage(nmsg []byte) ([]byte, error) {
+	if len(nmsg) < 16 || !bytes.Equal(nmsg[:8], ntlmSignature) || binary.LittleEndian.Uint32(nmsg[8:]) != ntlmMessageNegotiate {
+		return nil, errors.New("invalid NTLM negotiate message")
+	}
+	a.negotiate = bytes.Clone(nmsg)
+	flags := binary.LittleEndian.Uint32(nmsg[12:])&ntlmDefaultFlags | ntlmTargetTypeServer | ntlmNegotiateTargetInfo | ntlmRequestTarget
+
+	targetName := utf16le(a.computer)
+	var info []byte
+	addAv := func(id uint16, value []byte) {
+		info = binary.LittleEndian.AppendUint16(info, id)
+		info = binary.LittleEndian.AppendUint16(info, uint16(len(value)))
+		info = append(info, value...)
+	}
+	addAv(ntlmAvNbDomainName, utf16le(a.domain))
+	addAv(ntlmAvNbComputerName, targetName)
+	addAv(ntlmAvDNSDomainName, utf16le(strings.ToLower(a.domain)))
+	addAv(ntlmAvDNSComputerName, utf16le(strings.ToLower(a.computer)))
+	addAv(ntlmAvTimestamp, binary.LittleEndian.AppendUint64(nil, toFileTime(time.Now())))
+	addAv(ntlmAvEOL, nil)
+
+	//        ChallengeMessage
+	//   0-8: Signature
+	//  8-12: MessageType
+	// 12-20: TargetNameFields
+	// 20-24: NegotiateFlags
+	// 24-32: ServerChallenge
+	// 32-40: Reserved
+	// 40-48: TargetInfoFields
+	// 48-56: Version
+	//   56-: Payload
+	const off = 56
+	msg := make([]byte, off, off+len(targetName)+len(info))
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], ntlmMessageChallenge)
+	binary.LittleEndian.PutUint16(msg[12:], uint16(len(targetName)))
+	binary.LittleEndian.PutUint16(msg[14:], uint16(len(targetName)))
+	binary.LittleEndian.PutUint32(msg[16:], off)
+	binary.LittleEndian.PutUint32(msg[20:], flags)
+	if _, err := rand.Read(msg[24:32]); err != nil {
+		return nil, err
+	}
+	binary.LittleEndian.PutUint16(msg[40:], uint16(len(info)))
+	binary.LittleEndian.PutUint16(msg[42:], uint16(len(info)))
+	binary.LittleEndian.PutUint32(msg[44:], uint32(off+len(targetName)))
+	copy(msg[48:], ntlmVersion)
+	msg = append(msg, targetName...)
+	msg = append(msg, info...)
+	a.challenge = msg
+	return msg, nil
+}
+
+// ntlmAuthenticate is a decoded AUTHENTICATE message
+type ntlmAuthenticate struct {
+	msg          []byte
+	flags        uint32
+	user         string
+	domain       string
+	ntResponse   []byte
+	lmResponse   []byte
+	encryptedKey []byte
+}
+
+// anonymous returns true if this is an anonymous authentication
+func (am *ntlmAuthenticate) anonymous() bool {
+	return am.user == "" && len(am.ntResponse) == 0 && (len(am.lmResponse) == 0 || bytes.Equal(am.lmResponse, []byte{0}))
+}
+
+// parseAuthenticate decodes the client's AUTHENTICATE message
+func (a *ntlmServer) parseAuthenticate(amsg []byte) (*ntlmAuthenticate, error) {
+	//        AuthenticateMessage
+	//   0-8: Signature
+	//  8-12: MessageType
+	// 12-20: LmChallengeResponseFields
+	// 20-28: NtChallengeResponseFields
+	// 28-36: DomainNameFields
+	// 36-44: UserNameFields
+	// 44-52: WorkstationFields
+	// 52-60: EncryptedRandomSessionKeyFields
+	// 60-64: NegotiateFlags
+	// 64-72: Version
+	// 72-88: MIC
+	//   88-: Payload
+	if a.challenge == nil || len(amsg) < 64 || !bytes.Equal(amsg[:8], ntlmSignature) || binary.LittleEndian.Uint32(amsg[8:]) != ntlmMessageAuthenticate {
+		return nil, errors.New("invalid NTLM authenticate message")
+	}
+	field := func(off int) ([]byte, error) {
+		n := int(binary.LittleEndian.Uint16(amsg[off:]))
+		start := int(binary.LittleEndian.Uint32(amsg[off+4:]))
+		if n == 0 {
+			return nil, nil
+		}
+		if start > len(amsg) || n > len(amsg)-start {
+			return nil, errors.New("invalid NTLM authenticate message field")
+		}
+		return amsg[start : start+n], nil
+	}
+	am := &ntlmAuthenticate{
+		msg:   bytes.Clone(amsg),
+		flags: binary.LittleEndian.Uint32(amsg[60:]),
+	}
+	var err error
+	if am.lmResponse, err = field(12); err != nil {
+		return nil, err
+	}
+	if am.ntResponse, err = field(20); err != nil {
+		return nil, err
+	}
+	domain, err := field(28)
+	if err != nil {
+		return nil, err
+	}
+	user, err := field(36)
+	if err != nil {
+		return nil, err
+	}
+	if am.encryptedKey, err = field(52); err != nil {
+		return nil, err
+	}
+	am.domain = fromUTF16le(domain)
+	am.user = fromUTF16le(user)
+	return am, nil
+}
+
+// verify checks the client's response against the NT hash of the
+// user's password returning the session key if it is correct
+func (a *ntlmServer) verify(am *ntlmAuthenticate, hash []byte) (sessionKey []byte, ok bool) {
+	// Only NTLMv2 responses are supported
+	if len(am.ntResponse) < 16+ntlmV2ResponseHeaderLength {
+		return nil, false
+	}
+	h := hmac.New(md5.New, hash)
+	h.Write(utf16le(strings.ToUpper(am.user)))
+	h.Write(utf16le(am.domain))
+	ntowfv2 := h.Sum(nil)
+
+	h = hmac.New(md5.New, ntowfv2)
+	h.Write(a.challenge[24:32])
+	h.Write(am.ntResponse[16:])
+	proof := h.Sum(nil)
+	if !hmac.Equal(proof, am.ntResponse[:16]) {
+		return nil, false
+	}
+	h = hmac.New(md5.New, ntowfv2)
+	h.Write(proof)
+	sessionKey = h.Sum(nil)
+
+	if am.flags&ntlmNegotiateKeyExch != 0 {
+		if len(am.encryptedKey) != 16 {
+			return nil, false
+		}
+		c, err := rc4.NewCipher(sessionKey)
+		if err != nil {
+			return nil, false
+		}
+		exported := make([]byte, 16)
+		c.XORKeyStream(exported, am.encryptedKey)
+		sessionKey = exported
+	}
+
+	// Check the MIC if the client says it sent one
+	if a.micPresent(am.ntResponse[16+ntlmV2ResponseHeaderLength:]) && len(am.msg) >= 88 {
+		msg := bytes.Clone(am.msg)
+		mic := bytes.Clone(msg[72:88])
+		clear(msg[72:88])
+		h = hmac.New(md5.New, sessionKey)
+		h.Write(a.negotiate)
+		h.Write(a.challenge)
+		h.Write(msg)
+		if !hmac.Equal(mic, h.Sum(nil)) {
+			return nil, false
+		}
+	}
+	return sessionKey, true
+}
+
+// micPresent returns true if the AV pairs from the client's NTLMv2
+// response say the AUTHENTICATE message has a MIC
+func (a *ntlmServer) micPresent(pairs []byte) bool {
+	for len(pairs) >= 4 {
+		id := binary.LittleEndian.Uint16(pairs)
+		n := int(binary.LittleEndian.Uint16(pairs[2:]))
+		pairs = pairs[4:]
+		if id == ntlmAvEOL || n > len(pairs) {
+			break
+		}
+		if id == ntlmAvFlags && n >= 4 {
+			return binary.LittleEndian.Uint32(pairs)&ntlmAvFlagMICPresent != 0
+		}
+		pairs = pairs[n:]
+	}
+	return false
+}
+
+// mechListMIC returns the SPNEGO mechListMIC for mechTypes signed
+// with the server's NTLM signing and sealing keys
+func mechListMIC(flags uint32, sessionKey, mechTypes []byte) []byte {
+	signKey := md5.Sum(append(bytes.Clone(sessionKey), "session key to server-to-client signing key magic constant\x00"...))
+	sealKey := md5.Sum(append(bytes.Clone(sessionKey), "session key to server-to-client sealing key magic constant\x00"...))
+	h := hmac.New(md5.New, signKey[:])
+	h.Write([]byte{0, 0, 0, 0}) // sequence number
+	h.Write(mechTypes)
+	checksum := h.Sum(nil)[:8]
+	if flags&ntlmNegotiateKeyExch != 0 {
+		c, err := rc4.NewCipher(sealKey[:])
+		if err != nil {
+			return nil
+		}
+		c.XORKeyStream(checksum, checksum)
+	}
+	mic := make([]byte, 16)
+	binary.LittleEndian.PutUint32(mic, 1)
+	copy(mic[4:12], checksum)
+	return mic
+}
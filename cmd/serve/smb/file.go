@@ -0,0 +1,823 @@
+package smb
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/vfs"
+	"github.com/rclone/rclone/vfs/vfscommon"
+)
+
+// open is a file or directory opened by CREATE
+type open struct {
+	id            uint64
+	tree          *tree
+	vfs           *vfs.VFS
+	files         *fileTable
+	access        uint32 // granted access mask
+	share         uint32 // share access
+	isDir         bool
+	deleteOnClose bool    // set by FILE_DELETE_ON_CLOSE
+	key           fileKey // protected by files.mu
+
+	mu         sync.Mutex
+	handle     vfs.Handle // opened on first use
+	readHandle vfs.Handle // for reading when handle is write only
+	entries    []dirEntry // directory enumeration
+	entriesPos int        // next entry to return
+	enumerated bool       // set if entries is valid
+}
+
+// path returns the path of the open file in the VFS
+func (o *open) path() string {
+	o.files.mu.Lock()
+	defer o.files.mu.Unlock()
+	return o.key.path
+}
+
+// node returns the VFS node of the open file
+func (o *open) node() (vfs.Node, ntStatus) {
+	node, err := o.vfs.Stat(o.path())
+	if err != nil {
+		if errors.Is(err, vfs.ENOENT) {
+			return nil, statusFileClosed
+		}
+		return nil, errorStatus(err)
+	}
+	return node, statusSuccess
+}
+
+// openFlags returns the flags to open the VFS handle with
+func (o *open) openFlags() int {
+	read := o.access&(fileReadData|fileExecute) != 0
+	write := o.access&(fileWriteData|fileAppendData) != 0
+	switch {
+	case write && (read || o.vfs.Opt.CacheMode >= vfscommon.CacheModeWrites):
+		return os.O_RDWR
+	case write:
+		return os.O_WRONLY
+	}
+	return os.O_RDONLY
+}
+
+// getHandle returns the VFS handle opening it if necessary
+//
+// Call with o.mu held.
+func (o *open) getHandle() (vfs.Handle, error) {
+	if o.handle == nil {
+		h, err := o.vfs.OpenFile(o.path(), o.openFlags(), 0666)
+		if err != nil {
+			return nil, err
+		}
+		o.handle = h
+	}
+	return o.handle, nil
+}
+
+// readAt reads from the file at off
+func (o *open) readAt(p []byte, off int64) (int, error) {
+	o.mu.Lock()
+	h, err := o.getHandle()
+	if err == nil && o.openFlags() == os.O_WRONLY {
+		// Write only handles can't be read so use another
+		if o.readHandle == nil {
+			o.readHandle, err = o.vfs.OpenFile(o.path(), os.O_RDONLY, 0)
+		}
+		h = o.readHandle
+	}
+	o.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	return h.ReadAt(p, off)
+}
+
+// writeAt writes to the file at off
+//
+// The lock isn't held while writing as the VFS may wait for earlier
+// writes which arrive out of order.
+func (o *open) writeAt(p []byte, off int64) (int, error) {
+	o.mu.Lock()
+	h, err := o.getHandle()
+	o.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	return h.WriteAt(p, off)
+}
+
+// truncate sets the size of the file
+func (o *open) truncate(size int64) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.handle != nil && o.openFlags() != os.O_RDONLY {
+		return o.handle.Truncate(size)
+	}
+	node, err := o.vfs.Stat(o.path())
+	if err != nil {
+		return err
+	}
+	return node.Truncate(size)
+}
+
+// close closes the VFS handles and removes the open from the file
+// table deleting the file if it is the last open of a file pending
+// delete
+func (o *open) close() (err error) {
+	o.mu.Lock()
+	if o.readHandle != nil {
+		_ = o.readHandle.Close()
+		o.readHandle = nil
+	}
+	if o.handle != nil {
+		err = o.handle.Close()
+		o.handle = nil
+	}
+	o.mu.Unlock()
+	if p, remove := o.files.remove(o); remove {
+		node, statErr := o.vfs.Stat(p)
+		if statErr == nil {
+			statErr = node.Remove()
+		}
+		if statErr != nil && !errors.Is(statErr, vfs.ENOENT) {
+			fs.Errorf(p, "SMB: failed to delete on close: %v", statErr)
+		}
+	}
+	return err
+}
+
+// closeOpens closes the opens on the connection which match
+func (c *conn) closeOpens(match func(o *open) bool) {
+	var opens []*open
+	c.mu.Lock()
+	for id, o := range c.opens {
+		if match(o) {
+			opens = append(opens, o)
+			delete(c.opens, id)
+		}
+	}
+	c.mu.Unlock()
+	for _, o := range opens {
+		_ = o.close()
+	}
+}
+
+// fileKey identifies a file in the file table
+type fileKey struct {
+	vfs  *vfs.VFS
+	path string
+}
+
+// fileState is the state shared by all the opens of a file
+type fileState struct {
+	opens         []*open
+	locks         []byteLock
+	deletePending bool
+}
+
+// byteLock is a byte range lock
+type byteLock struct {
+	owner     *open
+	offset    uint64
+	length    uint64
+	exclusive bool
+}
+
+// overlaps returns true if the lock overlaps the range. Zero length
+// ranges don't overlap anything.
+func (l *byteLock) overlaps(offset, length uint64) bool {
+	if l.length == 0 || length == 0 {
+		return false
+	}
+	end, lEnd := offset+length, l.offset+l.length
+	if end < offset {
+		end = ^uint64(0)
+	}
+	if lEnd < l.offset {
+		lEnd = ^uint64(0)
+	}
+	return l.offset < end && offset < lEnd
+}
+
+// fileTable tracks the files open on all the connections so share
+// modes, byte range locks and delete on close can be applied between
+// them
+type fileTable struct {
+	mu    sync.Mutex
+	files map[fileKey]*fileState
+}
+
+func newFileTable() *fileTable {
+	return &fileTable{files: make(map[fileKey]*fileState)}
+}
+
+// The accesses which take part in share mode checks
+const (
+	shareReadAccess   = fileReadData | fileExecute
+	shareWriteAccess  = fileWriteData | fileAppendData
+	shareDeleteAccess = accessDelete
+)
+
+// shareConflict returns true if an open with access and share
+// conflicts with the existing open o
+func shareConflict(o *open, access, share uint32) bool {
+	check := func(access, share uint32) bool {
+		return (access&shareReadAccess != 0 && share&fileShareRead == 0) ||
+			(access&shareWriteAccess != 0 && share&fileShareWrite == 0) ||
+			(access&shareDeleteAccess != 0 && share&fileShareDelete == 0)
+	}
+	return check(o.access, share) || check(access, o.share)
+}
+
+// add adds o to the table checking the share modes
+func (t *fileTable) add(o *open) ntStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f := t.files[o.key]
+	if f == nil {
+		f = &fileState{}
+		t.files[o.key] = f
+	}
+	if f.deletePending {
+		return statusDeletePending
+	}
+	for _, other := range f.opens {
+		if shareConflict(other, o.access, o.share) {
+			return statusSharingViolation
+		}
+	}
+	f.opens = append(f.opens, o)
+	return statusSuccess
+}
+
+// remove removes o and its locks from the table, returning its path
+// and whether it should be deleted
+func (t *fileTable) remove(o *open) (p string, remove bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f := t.files[o.key]
+	if f == nil {
+		return o.key.path, false
+	}
+	if o.deleteOnClose {
+		f.deletePending = true
+	}
+	for i, other := range f.opens {
+		if other == o {
+			f.opens = append(f.opens[:i], f.opens[i+1:]...)
+			break
+		}
+	}
+	locks := f.locks[:0]
+	for _, l := range f.locks {
+		if l.owner != o {
+			locks = append(locks, l)
+		}
+	}
+	f.locks = locks
+	if len(f.opens) == 0 {
+		delete(t.files, o.key)
+		return o.key.path, f.deletePending
+	}
+	return o.key.path, false
+}
+
+// setDeletePending sets whether the file of o is deleted when the
+// last open is closed
+func (t *fileTable) setDeletePending(o *open, pending bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if f := t.files[o.key]; f != nil {
+		f.deletePending = pending
+	}
+}
+
+// deletePending returns whether the file of o will be deleted
+func (t *fileTable) deletePending(o *open) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f := t.files[o.key]
+	return f != nil && f.deletePending
+}
+
+// rename checks the file of o can be renamed to newPath then calls
+// doRename and moves the opens of the file and any files inside it
+// to their new paths if it succeeds
+func (t *fileTable) rename(o *open, newPath string, doRename func(oldPath string) error) ntStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	oldKey, newKey := o.key, fileKey{vfs: o.vfs, path: newPath}
+	if oldKey == newKey {
+		return statusSuccess
+	}
+	if f := t.files[newKey]; f != nil && len(f.opens) > 0 && !strings.EqualFold(newPath, oldKey.path) {
+		// Can't replace a file which is open
+		return statusAccessDenied
+	}
+	if err := doRename(oldKey.path); err != nil {
+		return errorStatus(err)
+	}
+	for key, f := range t.files {
+		if key.vfs != o.vfs {
+			continue
+		}
+		var p string
+		switch {
+		case key.path == oldKey.path:
+			p = newPath
+		case strings.HasPrefix(key.path, oldKey.path+"/"):
+			p = path.Join(newPath, key.path[len(oldKey.path)+1:])
+		default:
+			continue
+		}
+		delete(t.files, key)
+		key.path = p
+		t.files[key] = f
+		for _, other := range f.opens {
+			other.key = key
+		}
+	}
+	return statusSuccess
+}
+
+// lock adds the locks for o if none of them conflict
+func (t *fileTable) lock(o *open, locks []byteLock) ntStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f := t.files[o.key]
+	if f == nil {
+		return statusFileClosed
+	}
+	for _, l := range locks {
+		for _, held := range f.locks {
+			if held.owner != o && (l.exclusive || held.exclusive) && held.overlaps(l.offset, l.length) {
+				return statusLockNotGranted
+			}
+		}
+	}
+	f.locks = append(f.locks, locks...)
+	return statusSuccess
+}
+
+// unlock removes the locks of o which exactly match the ranges
+func (t *fileTable) unlock(o *open, locks []byteLock) ntStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f := t.files[o.key]
+	if f == nil {
+		return statusFileClosed
+	}
+	for _, l := range locks {
+		found := false
+		for i, held := range f.locks {
+			if held.owner == o && held.offset == l.offset && held.length == l.length {
+				f.locks = append(f.locks[:i], f.locks[i+1:]...)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return statusRangeNotLocked
+		}
+	}
+	return statusSuccess
+}
+
+// mapAccess maps the generic rights in access to the file rights
+// limited to max
+func mapAccess(access, max uint32) uint32 {
+	if access&maximumAllowed != 0 {
+		access |= max
+	}
+	if access&genericAll != 0 {
+		access |= fileAllAccess
+	}
+	if access&genericRead != 0 {
+		access |= fileGenericRead
+	}
+	if access&genericWrite != 0 {
+		access |= fileGenericWrite
+	}
+	if access&genericExecute != 0 {
+		access |= fileGenericExec
+	}
+	return access & fileAllAccess
+}
+
+// vfsPath converts an SMB path relative to the share into a VFS path
+func vfsPath(name string) (string, ntStatus) {
+	// The default data stream is the file itself but other
+	// streams aren't supported
+	name = strings.TrimSuffix(name, "::$DATA")
+	if strings.Contains(name, ":") {
+		return "", statusObjectNameNotFound
+	}
+	if strings.ContainsAny(name, `*?"<>|/`) {
+		return "", statusObjectNameInvalid
+	}
+	name = strings.Trim(name, `\`)
+	if name == "" {
+		return "", statusSuccess
+	}
+	parts := strings.Split(name, `\`)
+	for _, part := range parts {
+		if part == "" || part == "." || part == ".." {
+			return "", statusObjectNameInvalid
+		}
+	}
+	return strings.Join(parts, "/"), statusSuccess
+}
+
+// Create context names
+var (
+	contextMaximalAccess = "MxAc"
+	contextQueryOnDiskID = "QFid"
+)
+
+// createContexts returns the names of the create contexts in buf
+func createContexts(buf []byte) (names []string) {
+	for len(buf) >= 16 {
+		next := int(le.Uint32(buf))
+		nameOff, nameLen := int(le.Uint16(buf[4:])), int(le.Uint16(buf[6:]))
+		if nameOff+nameLen <= len(buf) {
+			names = append(names, string(buf[nameOff:nameOff+nameLen]))
+		}
+		if next == 0 || next > len(buf) {
+			break
+		}
+		buf = buf[next:]
+	}
+	return names
+}
+
+// createContext encodes a create context response
+func createContext(name string, data []byte) []byte {
+	ctx := make([]byte, 24, 24+len(data))
+	le.PutUint16(ctx[4:], 16)
+	le.PutUint16(ctx[6:], uint16(len(name)))
+	le.PutUint16(ctx[10:], 24)
+	le.PutUint32(ctx[12:], uint32(len(data)))
+	copy(ctx[16:], name)
+	return append(ctx, data...)
+}
+
+// create processes a CREATE which opens or creates a file or directory
+func (c *conn) create(r *request) (ntStatus, []byte) {
+	if len(r.body) < 56 {
+		return statusInvalidParameter, nil
+	}
+	if r.tree.ipc {
+		// Named pipes aren't supported
+		return statusObjectNameNotFound, nil
+	}
+	var (
+		VFS         = r.sess.vfs
+		maxAccess   = r.sess.maxAccess()
+		access      = mapAccess(r.u32(24), maxAccess)
+		share       = r.u32(32)
+		disposition = r.u32(36)
+		options     = r.u32(40)
+	)
+	nameBuf, ok := r.buffer(int(r.u16(44)), int(r.u16(46)))
+	if !ok {
+		return statusInvalidParameter, nil
+	}
+	contextBuf, ok := r.buffer(int(r.u32(48)), int(r.u32(52)))
+	if !ok {
+		return statusInvalidParameter, nil
+	}
+	name, status := vfsPath(fromUTF16le(nameBuf))
+	if status != statusSuccess {
+		return status, nil
+	}
+	if access&^maxAccess != 0 && access&fileWriteAccesses != 0 {
+		return statusAccessDenied, nil
+	}
+
+	// Look for the file and its parent
+	node, err := VFS.Stat(name)
+	exists := err == nil
+	if err != nil && !errors.Is(err, vfs.ENOENT) {
+		return errorStatus(err), nil
+	}
+	var (
+		dir  *vfs.Dir
+		leaf string
+	)
+	if !exists {
+		dir, leaf, err = VFS.StatParent(name)
+		if err != nil {
+			return statusObjectPathNotFound, nil
+		}
+	}
+
+	// Work out what to do
+	var (
+		action   uint32
+		truncate bool
+	)
+	isDir := options&fileDirectoryFile != 0
+	if exists {
+		switch {
+		case node.IsDir() && options&fileNonDirectoryFile != 0:
+			return statusFileIsADirectory, nil
+		case !node.IsDir() && isDir:
+			return statusNotADirectory, nil
+		}
+		isDir = node.IsDir()
+		switch disposition {
+		case fileCreate:
+			return statusObjectNameCollision, nil
+		case fileOpen, fileOpenIf:
+			action = fileOpened
+		case fileSupersede, fileOverwrite, fileOverwriteIf:
+			if isDir {
+				return statusInvalidParameter, nil
+			}
+			action, truncate = fileOverwritten, true
+			if disposition == fileSupersede {
+				action = fileSuperseded
+			}
+		default:
+			return statusInvalidParameter, nil
+		}
+	} else {
+		switch disposition {
+		case fileOpen, fileOverwrite:
+			return statusObjectNameNotFound, nil
+		case fileCreate, fileOpenIf, fileOverwriteIf, fileSupersede:
+			action = fileCreated
+		default:
+			return statusInvalidParameter, nil
+		}
+		if VFS.Opt.ReadOnly {
+			return statusAccessDenied, nil
+		}
+	}
+	if options&fileDeleteOnClose != 0 && access&accessDelete == 0 {
+		return statusAccessDenied, nil
+	}
+
+	o := &open{
+		id:            c.srv.newID(),
+		tree:          r.tree,
+		vfs:           VFS,
+		files:         c.srv.files,
+		access:        access,
+		share:         share,
+		isDir:         isDir,
+		deleteOnClose: options&fileDeleteOnClose != 0,
+		key:           fileKey{vfs: VFS, path: name},
+	}
+	if exists {
+		o.key.path = node.Path()
+	}
+	if status := c.srv.files.add(o); status != statusSuccess {
+		return status, nil
+	}
+	fail := func(err error) (ntStatus, []byte) {
+		o.deleteOnClose = false
+		_ = o.close()
+		return errorStatus(err), nil
+	}
+
+	// Create or truncate the file
+	switch {
+	case action == fileCreated && isDir:
+		node, err = dir.Mkdir(leaf)
+		if err != nil {
+			return fail(err)
+		}
+	case action == fileCreated || truncate:
+		flags := o.openFlags()
+		if flags == os.O_RDONLY {
+			flags = os.O_WRONLY
+		}
+		o.handle, err = VFS.OpenFile(name, flags|os.O_CREATE|os.O_TRUNC, 0666)
+		if err != nil {
+			return fail(err)
+		}
+		node = o.handle.Node()
+	}
+	if o.deleteOnClose && isDir && !dirEmpty(node) {
+		return fail(vfs.ENOTEMPTY)
+	}
+
+	c.mu.Lock()
+	c.opens[o.id] = o
+	c.mu.Unlock()
+	r.fileID = o.id
+
+	// Reply to the create contexts we know about
+	var contexts [][]byte
+	for _, ctxName := range createContexts(contextBuf) {
+		switch ctxName {
+		case contextMaximalAccess:
+			data := make([]byte, 8)
+			le.PutUint32(data[4:], maxAccess)
+			contexts = append(contexts, createContext(ctxName, data))
+		case contextQueryOnDiskID:
+			data := make([]byte, 32)
+			le.PutUint64(data, node.Inode())
+			contexts = append(contexts, createContext(ctxName, data))
+		}
+	}
+
+	body := make([]byte, 88, 256)
+	le.PutUint16(body[0:], 89)
+	le.PutUint32(body[4:], action)
+	putTimes(body[8:], node)
+	le.PutUint64(body[40:], allocationSize(node))
+	le.PutUint64(body[48:], fileSize(node))
+	le.PutUint32(body[56:], attributes(node))
+	le.PutUint64(body[64:], o.id)
+	le.PutUint64(body[72:], o.id)
+	if len(contexts) > 0 {
+		le.PutUint32(body[80:], headerSize+88)
+		start, last := len(body), -1
+		for _, ctx := range contexts {
+			if last >= 0 {
+				for len(body)%8 != 0 {
+					body = append(body, 0)
+				}
+				le.PutUint32(body[last:], uint32(len(body)-last))
+			}
+			last = len(body)
+			body = append(body, ctx...)
+		}
+		le.PutUint32(body[84:], uint32(len(body)-start))
+	}
+	return statusSuccess, body
+}
+
+// dirEmpty returns true if node is an empty directory
+func dirEmpty(node vfs.Node) bool {
+	dir, ok := node.(*vfs.Dir)
+	if !ok {
+		return true
+	}
+	items, err := dir.ReadDirAll()
+	return err == nil && len(items) == 0
+}
+
+// closeFile processes a CLOSE
+func (c *conn) closeFile(r *request) (ntStatus, []byte) {
+	o, status := r.file(8)
+	if status != statusSuccess {
+		return status, nil
+	}
+	c.mu.Lock()
+	delete(c.opens, o.id)
+	c.mu.Unlock()
+	p := o.path()
+	if err := o.close(); err != nil {
+		fs.Errorf(p, "SMB: close failed: %v", err)
+		return errorStatus(err), nil
+	}
+	body := make([]byte, 60)
+	le.PutUint16(body[0:], 60)
+	if r.u16(2)&closeFlagPostQueryAttrib != 0 {
+		if node, err := o.vfs.Stat(p); err == nil {
+			le.PutUint16(body[2:], closeFlagPostQueryAttrib)
+			putTimes(body[8:], node)
+			le.PutUint64(body[40:], allocationSize(node))
+			le.PutUint64(body[48:], fileSize(node))
+			le.PutUint32(body[56:], attributes(node))
+		}
+	}
+	return statusSuccess, body
+}
+
+// flush processes a FLUSH
+func (c *conn) flush(r *request) (ntStatus, []byte) {
+	o, status := r.file(8)
+	if status != statusSuccess {
+		return status, nil
+	}
+	o.mu.Lock()
+	var err error
+	if o.handle != nil {
+		err = o.handle.Sync()
+	}
+	o.mu.Unlock()
+	if err != nil {
+		return errorStatus(err), nil
+	}
+	return statusSuccess, []byte{4, 0, 0, 0}
+}
+
+// read processes a READ
+func (c *conn) read(r *request) (ntStatus, []byte) {
+	o, status := r.file(16)
+	if status != statusSuccess {
+		return status, nil
+	}
+	if o.isDir {
+		return statusInvalidDeviceRequest, nil
+	}
+	if o.access&(fileReadData|fileExecute) == 0 {
+		return statusAccessDenied, nil
+	}
+	length := min(r.u32(4), c.maxIO)
+	body := make([]byte, 16+length)
+	n, err := o.readAt(body[16:], int64(r.u64(8)))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return errorStatus(err), nil
+	}
+	if (n == 0 && length > 0) || uint32(n) < r.u32(32) {
+		return statusEndOfFile, nil
+	}
+	le.PutUint16(body[0:], 17)
+	body[2] = headerSize + 16
+	le.PutUint32(body[4:], uint32(n))
+	return statusSuccess, body[:16+n]
+}
+
+// write processes a WRITE
+func (c *conn) write(r *request) (ntStatus, []byte) {
+	o, status := r.file(16)
+	if status != statusSuccess {
+		return status, nil
+	}
+	if o.isDir {
+		return statusInvalidDeviceRequest, nil
+	}
+	if o.access&(fileWriteData|fileAppendData) == 0 {
+		return statusAccessDenied, nil
+	}
+	data, ok := r.buffer(int(r.u16(2)), int(r.u32(4)))
+	if !ok {
+		return statusInvalidParameter, nil
+	}
+	off := int64(r.u64(8))
+	if off == -1 {
+		// Write to the end of the file
+		node, status := o.node()
+		if status != statusSuccess {
+			return status, nil
+		}
+		off = node.Size()
+	}
+	n, err := o.writeAt(data, off)
+	if err != nil {
+		return errorStatus(err), nil
+	}
+	if r.u32(44)&writeFlagWriteThrough != 0 {
+		o.mu.Lock()
+		err = o.handle.Sync()
+		o.mu.Unlock()
+		if err != nil {
+			return errorStatus(err), nil
+		}
+	}
+	body := make([]byte, 16)
+	le.PutUint16(body[0:], 17)
+	le.PutUint32(body[4:], uint32(n))
+	return statusSuccess, body
+}
+
+// lock processes a LOCK which locks or unlocks byte ranges
+func (c *conn) lock(r *request) (ntStatus, []byte) {
+	o, status := r.file(8)
+	if status != statusSuccess {
+		return status, nil
+	}
+	count := int(r.u16(2))
+	if count == 0 || len(r.body) < 24+24*count {
+		return statusInvalidParameter, nil
+	}
+	var (
+		locks  []byteLock
+		unlock = r.u32(24+16)&lockFlagUnlock != 0
+	)
+	for i := range count {
+		off := 24 + 24*i
+		flags := r.u32(off + 16)
+		if (flags&lockFlagUnlock != 0) != unlock {
+			return statusInvalidParameter, nil
+		}
+		if !unlock && flags&(lockFlagSharedLock|lockFlagExclusiveLock) == 0 {
+			return statusInvalidParameter, nil
+		}
+		locks = append(locks, byteLock{
+			owner:     o,
+			offset:    r.u64(off),
+			length:    r.u64(off + 8),
+			exclusive: flags&lockFlagExclusiveLock != 0,
+		})
+	}
+	if unlock {
+		status = c.srv.files.unlock(o, locks)
+	} else {
+		status = c.srv.files.lock(o, locks)
+	}
+	if status != statusSuccess {
+		return status, nil
+	}
+	return statusSuccess, []byte{4, 0, 0, 0}
+}
@@ -0,0 +1,654 @@
+package smb
+
+import (
+	"errors"
+	"path"
+	"strings"
+	"unicode"
+
+	"github.com/rclone/rclone/vfs"
+)
+
+// Sizes reported to the client
+const (
+	bytesPerSector     = 512
+	sectorsPerUnit     = 8
+	allocationUnit     = bytesPerSector * sectorsPerUnit
+	maxComponentLength = 255
+	unknownSize        = 1 << 50 // used if the VFS doesn't know
+)
+
+// fileSize returns the size of node
+func fileSize(node vfs.Node) uint64 {
+	if node.IsDir() {
+		return 0
+	}
+	return uint64(max(node.Size(), 0))
+}
+
+// allocationSize returns the size of node rounded up to a whole
+// number of allocation units
+func allocationSize(node vfs.Node) uint64 {
+	return (fileSize(node) + allocationUnit - 1) / allocationUnit * allocationUnit
+}
+
+// attributes returns the file attributes of node
+func attributes(node vfs.Node) uint32 {
+	if node.IsDir() {
+		return fileAttributeDirectory
+	}
+	if node.VFS().Opt.ReadOnly {
+		return fileAttributeArchive | fileAttributeReadonly
+	}
+	return fileAttributeArchive
+}
+
+// putTimes puts the creation, last access, last write and change
+// times of node into b. The VFS only has the modification time so
+// this is used for all of them.
+func putTimes(b []byte, node vfs.Node) {
+	t := toFileTime(node.ModTime())
+	for i := range 4 {
+		le.PutUint64(b[8*i:], t)
+	}
+}
+
+// smbName returns the SMB path of the VFS path p
+func smbName(p string) []byte {
+	return utf16le(`\` + strings.ReplaceAll(p, "/", `\`))
+}
+
+// fileInfo returns the file information of class for o. It returns
+// true if the class has variable length so may be truncated.
+func (o *open) fileInfo(class uint8) (data []byte, variable bool, status ntStatus) {
+	node, status := o.node()
+	if status != statusSuccess {
+		return nil, false, status
+	}
+	deletePending := o.files.deletePending(o)
+	basic := func() []byte {
+		b := make([]byte, 40)
+		putTimes(b, node)
+		le.PutUint32(b[32:], attributes(node))
+		return b
+	}
+	standard := func() []byte {
+		b := make([]byte, 24)
+		le.PutUint64(b[0:], allocationSize(node))
+		le.PutUint64(b[8:], fileSize(node))
+		le.PutUint32(b[16:], 1)
+		if deletePending {
+			b[20] = 1
+		}
+		if node.IsDir() {
+			b[21] = 1
+		}
+		return b
+	}
+	name := func() []byte {
+		n := smbName(node.Path())
+		return append(le.AppendUint32(nil, uint32(len(n))), n...)
+	}
+	switch class {
+	case fileBasicInformation:
+		return basic(), false, statusSuccess
+	case fileStandardInformation:
+		return standard(), false, statusSuccess
+	case fileInternalInformation:
+		return le.AppendUint64(nil, node.Inode()), false, statusSuccess
+	case fileEaInformation, fileModeInformation, fileAlignmentInformation:
+		return make([]byte, 4), false, statusSuccess
+	case fileAccessInformation:
+		return le.AppendUint32(nil, o.access), false, statusSuccess
+	case filePositionInformation:
+		return make([]byte, 8), false, statusSuccess
+	case fileNameInformation, fileNormalizedNameInformation:
+		return name(), true, statusSuccess
+	case fileAllInformation:
+		b := append(basic(), standard()...)
+		b = le.AppendUint64(b, node.Inode())
+		b = le.AppendUint32(b, 0) // EaSize
+		b = le.AppendUint32(b, o.access)
+		b = le.AppendUint64(b, 0) // CurrentByteOffset
+		b = le.AppendUint32(b, 0) // Mode
+		b = le.AppendUint32(b, 0) // AlignmentRequirement
+		return append(b, name()...), true, statusSuccess
+	case fileStreamInformation:
+		if node.IsDir() {
+			return nil, true, statusSuccess
+		}
+		streamName := utf16le("::$DATA")
+		b := make([]byte, 24, 24+len(streamName))
+		le.PutUint32(b[4:], uint32(len(streamName)))
+		le.PutUint64(b[8:], fileSize(node))
+		le.PutUint64(b[16:], allocationSize(node))
+		return append(b, streamName...), true, statusSuccess
+	case fileNetworkOpenInformation:
+		b := make([]byte, 56)
+		putTimes(b, node)
+		le.PutUint64(b[32:], allocationSize(node))
+		le.PutUint64(b[40:], fileSize(node))
+		le.PutUint32(b[48:], attributes(node))
+		return b, false, statusSuccess
+	case fileAttributeTagInformation:
+		b := make([]byte, 8)
+		le.PutUint32(b, attributes(node))
+		return b, false, statusSuccess
+	}
+	return nil, false, statusInvalidInfoClass
+}
+
+// statfsUnits returns x as allocation units
+func statfsUnits(x int64) uint64 {
+	if x < 0 {
+		x = unknownSize
+	}
+	return uint64(x) / allocationUnit
+}
+
+// fsInfo returns the filesystem information of class. It returns
+// true if the class has variable length so may be truncated.
+func (c *conn) fsInfo(VFS *vfs.VFS, class uint8) (data []byte, variable bool, status ntStatus) {
+	switch class {
+	case fileFsVolumeInformation:
+		label := utf16le(c.srv.opt.Share)
+		b := make([]byte, 18, 18+len(label))
+		le.PutUint64(b[0:], toFileTime(c.srv.start))
+		le.PutUint32(b[8:], le.Uint32(c.srv.guid[:]))
+		le.PutUint32(b[12:], uint32(len(label)))
+		return append(b, label...), true, statusSuccess
+	case fileFsSizeInformation:
+		total, _, free := VFS.Statfs()
+		b := make([]byte, 24)
+		le.PutUint64(b[0:], statfsUnits(total))
+		le.PutUint64(b[8:], statfsUnits(free))
+		le.PutUint32(b[16:], sectorsPerUnit)
+		le.PutUint32(b[20:], bytesPerSector)
+		return b, false, statusSuccess
+	case fileFsFullSizeInformation:
+		total, _, free := VFS.Statfs()
+		b := make([]byte, 32)
+		le.PutUint64(b[0:], statfsUnits(total))
+		le.PutUint64(b[8:], statfsUnits(free))
+		le.PutUint64(b[16:], statfsUnits(free))
+		le.PutUint32(b[24:], sectorsPerUnit)
+		le.PutUint32(b[28:], bytesPerSector)
+		return b, false, statusSuccess
+	case fileFsDeviceInformation:
+		b := make([]byte, 8)
+		le.PutUint32(b[0:], 7) // FILE_DEVICE_DISK
+		return b, false, statusSuccess
+	case fileFsAttributeInformation:
+		attrs := uint32(fileCasePreservedNames | fileUnicodeOnDisk)
+		if !VFS.Opt.CaseInsensitive {
+			attrs |= fileCaseSensitiveSearch
+		}
+		if VFS.Opt.ReadOnly {
+			attrs |= fileReadOnlyVolume
+		}
+		// Clients enable features by the file system name so
+		// say NTFS like other SMB servers do
+		name := utf16le("NTFS")
+		b := make([]byte, 12, 12+len(name))
+		le.PutUint32(b[0:], attrs)
+		le.PutUint32(b[4:], maxComponentLength)
+		le.PutUint32(b[8:], uint32(len(name)))
+		return append(b, name...), true, statusSuccess
+	case fileFsSectorSizeInformation:
+		b := make([]byte, 28)
+		for i := range 4 {
+			le.PutUint32(b[4*i:], bytesPerSector)
+		}
+		return b, false, statusSuccess
+	}
+	return nil, false, statusInvalidInfoClass
+}
+
+// The SID of Everyone - S-1-1-0
+var everyoneSID = []byte{1, 1, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0}
+
+// Security information requested in QUERY_INFO
+const (
+	ownerSecurityInformation = 0x00000001
+	groupSecurityInformation = 0x00000002
+	daclSecurityInformation  = 0x00000004
+)
+
+// securityDescriptor returns a self relative security descriptor
+// owned by Everyone giving Everyone access
+func securityDescriptor(additional, access uint32, isDir bool) []byte {
+	const (
+		selfRelative = 0x8000
+		daclPresent  = 0x0004
+	)
+	sd := make([]byte, 20)
+	sd[0] = 1 // Revision
+	control := uint16(selfRelative)
+	if additional&ownerSecurityInformation != 0 {
+		le.PutUint32(sd[4:], uint32(len(sd)))
+		sd = append(sd, everyoneSID...)
+	}
+	if additional&groupSecurityInformation != 0 {
+		le.PutUint32(sd[8:], uint32(len(sd)))
+		sd = append(sd, everyoneSID...)
+	}
+	if additional&daclSecurityInformation != 0 {
+		control |= daclPresent
+		le.PutUint32(sd[16:], uint32(len(sd)))
+		aceSize := 8 + len(everyoneSID)
+		acl := make([]byte, 8+aceSize)
+		acl[0] = 2 // AclRevision
+		le.PutUint16(acl[2:], uint16(len(acl)))
+		le.PutUint16(acl[4:], 1) // AceCount
+		ace := acl[8:]
+		if isDir {
+			ace[1] = 0x03 // OBJECT_INHERIT_ACE | CONTAINER_INHERIT_ACE
+		}
+		le.PutUint16(ace[2:], uint16(aceSize))
+		le.PutUint32(ace[4:], access)
+		copy(ace[8:], everyoneSID)
+		sd = append(sd, acl...)
+	}
+	le.PutUint16(sd[2:], control)
+	return sd
+}
+
+// queryInfo processes a QUERY_INFO
+func (c *conn) queryInfo(r *request) (ntStatus, []byte) {
+	if len(r.body) < 40 {
+		return statusInvalidParameter, nil
+	}
+	o, status := r.file(24)
+	if status != statusSuccess {
+		return status, nil
+	}
+	var (
+		infoType = r.body[2]
+		class    = r.body[3]
+		outLen   = int(r.u32(4))
+		data     []byte
+		variable bool
+	)
+	switch infoType {
+	case infoFile:
+		data, variable, status = o.fileInfo(class)
+	case infoFilesystem:
+		data, variable, status = c.fsInfo(o.vfs, class)
+	case infoSecurity:
+		data, variable = securityDescriptor(r.u32(16), r.sess.maxAccess(), o.isDir), false
+		if len(data) > outLen {
+			// Tell the client how big a buffer it needs
+			return statusBufferTooSmall, []byte{9, 0, 0, 0, 4, 0, 0, 0, byte(len(data)), byte(len(data) >> 8), 0, 0}
+		}
+	default:
+		return statusNotSupported, nil
+	}
+	if status != statusSuccess {
+		return status, nil
+	}
+	if len(data) > outLen {
+		if !variable {
+			return statusInfoLengthMismatch, nil
+		}
+		data, status = data[:outLen], statusBufferOverflow
+	}
+	body := make([]byte, 8, 8+len(data))
+	le.PutUint16(body[0:], 9)
+	le.PutUint16(body[2:], headerSize+8)
+	le.PutUint32(body[4:], uint32(len(data)))
+	return status, append(body, data...)
+}
+
+// setInfo processes a SET_INFO
+func (c *conn) setInfo(r *request) (ntStatus, []byte) {
+	if len(r.body) < 32 {
+		return statusInvalidParameter, nil
+	}
+	o, status := r.file(16)
+	if status != statusSuccess {
+		return status, nil
+	}
+	buf, ok := r.buffer(int(r.u16(8)), int(r.u32(4)))
+	if !ok {
+		return statusInvalidParameter, nil
+	}
+	switch r.body[2] {
+	case infoFile:
+		status = c.setFileInfo(r, o, r.body[3], buf)
+	case infoSecurity:
+		// Security descriptors can't be stored so ignore them
+	default:
+		status = statusNotSupported
+	}
+	if status != statusSuccess {
+		return status, nil
+	}
+	return statusSuccess, []byte{2, 0}
+}
+
+// setFileInfo sets the file information of class from buf
+func (c *conn) setFileInfo(r *request, o *open, class uint8, buf []byte) ntStatus {
+	need := func(n int, access uint32) ntStatus {
+		if len(buf) < n {
+			return statusInfoLengthMismatch
+		}
+		if o.access&access == 0 {
+			return statusAccessDenied
+		}
+		return statusSuccess
+	}
+	switch class {
+	case fileBasicInformation:
+		if status := need(36, fileWriteAttributes); status != statusSuccess {
+			return status
+		}
+		// 0 means don't change and -1 means stop updating it
+		lastWrite := le.Uint64(buf[16:])
+		if lastWrite == 0 || lastWrite == ^uint64(0) {
+			return statusSuccess
+		}
+		node, status := o.node()
+		if status != statusSuccess {
+			return status
+		}
+		return errorStatus(node.SetModTime(fromFileTime(lastWrite)))
+	case fileEndOfFileInformation:
+		if status := need(8, fileWriteData); status != statusSuccess {
+			return status
+		}
+		if o.isDir {
+			return statusInvalidParameter
+		}
+		return errorStatus(o.truncate(int64(le.Uint64(buf))))
+	case fileAllocationInformation:
+		// The VFS doesn't preallocate so there is nothing to do
+		return need(8, fileWriteData)
+	case fileDispositionInformation, fileDispositionInformationEx:
+		if status := need(1, accessDelete); status != statusSuccess {
+			return status
+		}
+		pending := buf[0] != 0
+		if class == fileDispositionInformationEx {
+			if len(buf) < 4 {
+				return statusInfoLengthMismatch
+			}
+			pending = le.Uint32(buf)&fileDispositionExFlagDelete != 0
+		}
+		if pending {
+			node, status := o.node()
+			if status != statusSuccess {
+				return status
+			}
+			if node.Path() == "" {
+				return statusCannotDelete
+			}
+			if !dirEmpty(node) {
+				return statusDirectoryNotEmpty
+			}
+		}
+		o.files.setDeletePending(o, pending)
+		return statusSuccess
+	case fileRenameInformation:
+		if status := need(20, accessDelete); status != statusSuccess {
+			return status
+		}
+		n := int(le.Uint32(buf[16:]))
+		if n > len(buf)-20 {
+			return statusInvalidParameter
+		}
+		return o.rename(fromUTF16le(buf[20:20+n]), buf[0] != 0)
+	case filePositionInformation, fileModeInformation:
+		return statusSuccess
+	}
+	return statusInvalidInfoClass
+}
+
+// rename renames the open file to the SMB path name
+func (o *open) rename(name string, replace bool) ntStatus {
+	newPath, status := vfsPath(name)
+	if status != statusSuccess {
+		return status
+	}
+	if newPath == "" || o.path() == "" {
+		return statusAccessDenied
+	}
+	dir, leaf, err := o.vfs.StatParent(newPath)
+	if err != nil {
+		return statusObjectPathNotFound
+	}
+	newPath = path.Join(dir.Path(), leaf)
+	if existing, err := dir.Stat(leaf); err == nil {
+		// Renaming to a different case of the same name is OK
+		if existing.Path() != o.path() {
+			if !replace {
+				return statusObjectNameCollision
+			}
+			if existing.IsDir() {
+				return statusAccessDenied
+			}
+		}
+	} else if !errors.Is(err, vfs.ENOENT) {
+		return errorStatus(err)
+	}
+	return o.files.rename(o, newPath, func(oldPath string) error {
+		return o.vfs.Rename(oldPath, newPath)
+	})
+}
+
+// dirEntry is an entry in a directory listing
+type dirEntry struct {
+	name string
+	node vfs.Node
+}
+
+// hasWildcards returns true if pattern contains wildcards
+func hasWildcards(pattern string) bool {
+	return strings.ContainsAny(pattern, `*?<>"`)
+}
+
+// matchPattern matches name against a Windows file name pattern
+// case insensitively. As well as * and ? the DOS wildcards < > and "
+// are supported.
+func matchPattern(pattern, name string) bool {
+	return match([]rune(pattern), []rune(name))
+}
+
+func match(p, n []rune) bool {
+	for len(p) > 0 {
+		switch p[0] {
+		case '*':
+			for i := 0; i <= len(n); i++ {
+				if match(p[1:], n[i:]) {
+					return true
+				}
+			}
+			return false
+		case '<': // DOS_STAR - any characters up to the last dot
+			for i := 0; i <= len(n); i++ {
+				if match(p[1:], n[i:]) {
+					return true
+				}
+				if i < len(n) && n[i] == '.' && !containsRune(n[i+1:], '.') {
+					return false
+				}
+			}
+			return false
+		case '?':
+			if len(n) == 0 {
+				return false
+			}
+		case '>': // DOS_QM - any character or none at a dot or the end
+			if len(n) == 0 || n[0] == '.' {
+				return match(p[1:], n)
+			}
+		case '"': // DOS_DOT - a dot or the end
+			if len(n) == 0 {
+				return match(p[1:], n)
+			}
+			if n[0] != '.' {
+				return false
+			}
+		default:
+			if len(n) == 0 || unicode.ToLower(p[0]) != unicode.ToLower(n[0]) {
+				return false
+			}
+		}
+		p, n = p[1:], n[1:]
+	}
+	return len(n) == 0
+}
+
+func containsRune(rs []rune, r rune) bool {
+	for _, x := range rs {
+		if x == r {
+			return true
+		}
+	}
+	return false
+}
+
+// listDir lists the directory of o into its entries keeping the ones
+// which match pattern
+func (o *open) listDir(pattern string) ntStatus {
+	node, status := o.node()
+	if status != statusSuccess {
+		return status
+	}
+	dir, ok := node.(*vfs.Dir)
+	if !ok {
+		return statusInvalidParameter
+	}
+	items, err := dir.ReadDirAll()
+	if err != nil {
+		return errorStatus(err)
+	}
+	parent := vfs.Node(dir)
+	if dir.Path() != "" {
+		if p, err := o.vfs.Stat(path.Dir(dir.Path())); err == nil {
+			parent = p
+		}
+	}
+	o.entries = o.entries[:0]
+	all := make([]dirEntry, 0, len(items)+2)
+	all = append(all, dirEntry{".", dir}, dirEntry{"..", parent})
+	for _, item := range items {
+		all = append(all, dirEntry{item.Name(), item})
+	}
+	wild := hasWildcards(pattern)
+	for _, e := range all {
+		if (wild && matchPattern(pattern, e.name)) || (!wild && strings.EqualFold(pattern, e.name)) {
+			o.entries = append(o.entries, e)
+		}
+	}
+	o.entriesPos = 0
+	o.enumerated = true
+	return statusSuccess
+}
+
+// encodeDirEntry encodes e in the directory information class
+func encodeDirEntry(class uint8, e dirEntry) ([]byte, bool) {
+	name := utf16le(e.name)
+	node := e.node
+	var b []byte
+	common := func(n int) {
+		b = make([]byte, n, n+len(name))
+		putTimes(b[8:], node)
+		le.PutUint64(b[40:], fileSize(node))
+		le.PutUint64(b[48:], allocationSize(node))
+		le.PutUint32(b[56:], attributes(node))
+		le.PutUint32(b[60:], uint32(len(name)))
+	}
+	switch class {
+	case fileDirectoryInformation:
+		common(64)
+	case fileFullDirectoryInformation:
+		common(68)
+	case fileBothDirectoryInformation:
+		common(94)
+	case fileIDBothDirectoryInformation:
+		common(104)
+		le.PutUint64(b[96:], node.Inode())
+	case fileIDFullDirectoryInformation:
+		common(80)
+		le.PutUint64(b[72:], node.Inode())
+	case fileNamesInformation:
+		b = make([]byte, 12, 12+len(name))
+		le.PutUint32(b[8:], uint32(len(name)))
+	default:
+		return nil, false
+	}
+	return append(b, name...), true
+}
+
+// queryDirectory processes a QUERY_DIRECTORY which lists a directory
+func (c *conn) queryDirectory(r *request) (ntStatus, []byte) {
+	if len(r.body) < 32 {
+		return statusInvalidParameter, nil
+	}
+	o, status := r.file(8)
+	if status != statusSuccess {
+		return status, nil
+	}
+	if !o.isDir {
+		return statusInvalidParameter, nil
+	}
+	class, flags := r.body[2], r.body[3]
+	patternBuf, ok := r.buffer(int(r.u16(24)), int(r.u16(26)))
+	if !ok {
+		return statusInvalidParameter, nil
+	}
+	pattern := fromUTF16le(patternBuf)
+	if pattern == "" {
+		pattern = "*"
+	}
+	outLen := int(min(r.u32(28), c.maxIO))
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.enumerated || flags&(restartScans|reopen) != 0 {
+		if status := o.listDir(pattern); status != statusSuccess {
+			return status, nil
+		}
+		if len(o.entries) == 0 {
+			return statusNoSuchFile, nil
+		}
+	}
+	if o.entriesPos >= len(o.entries) {
+		return statusNoMoreFiles, nil
+	}
+
+	var (
+		out  []byte
+		last = -1
+	)
+	for o.entriesPos < len(o.entries) {
+		entry, ok := encodeDirEntry(class, o.entries[o.entriesPos])
+		if !ok {
+			return statusInvalidInfoClass, nil
+		}
+		start := (len(out) + 7) &^ 7
+		if start+len(entry) > outLen {
+			break
+		}
+		for len(out) < start {
+			out = append(out, 0)
+		}
+		if last >= 0 {
+			le.PutUint32(out[last:], uint32(start-last))
+		}
+		last = start
+		out = append(out, entry...)
+		o.entriesPos++
+		if flags&returnSingleEntry != 0 {
+			break
+		}
+	}
+	if last < 0 {
+		return statusInfoLengthMismatch, nil
+	}
+	body := make([]byte, 8, 8+len(out))
+	le.PutUint16(body[0:], 9)
+	le.PutUint16(body[2:], headerSize+8)
+	le.PutUint32(body[4:], uint32(len(out)))
+	return statusSuccess, append(body, out...)
+}
@@ -0,0 +1,636 @@
+package smb
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/cmd/serve/proxy"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/vfs"
+	"github.com/rclone/rclone/vfs/vfscommon"
+)
+
+const (
+	maxIOSize      = 1 << 20 // largest read and write and transact
+	maxIOSize202   = 1 << 16 // largest read and write for SMB 2.0.2
+	maxCredits     = 8192    // most credits granted in one response
+	maxOutstanding = 64      // requests processed at once per connection
+)
+
+var (
+	smb1Magic = []byte{0xFF, 'S', 'M', 'B'}
+	smb2Magic = []byte{0xFE, 'S', 'M', 'B'}
+	le        = binary.LittleEndian
+)
+
+// server is an SMB server serving a VFS or the VFSes from an auth
+// proxy
+type server struct {
+	f        fs.Fs
+	ctx      context.Context
+	opt      Options
+	vfs      *vfs.VFS     // the VFS if not using auth proxy
+	proxy    *proxy.Proxy // may be nil if not in use
+	listener net.Listener
+	guid     [16]byte  // server GUID
+	start    time.Time // server start time
+	computer string    // NetBIOS name of the server
+	files    *fileTable
+	stopped  chan struct{}
+
+	mu     sync.Mutex
+	conns  map[*conn]struct{}
+	nextID uint64 // for session and file IDs
+}
+
+// Make a new SMB server to serve the remote
+func newServer(ctx context.Context, f fs.Fs, opt *Options, vfsOpt *vfscommon.Options, proxyOpt *proxy.Options) (*server, error) {
+	if err := vfscommon.RefuseACL(vfsOpt); err != nil {
+		return nil, err
+	}
+	if opt.Share == "" || strings.ContainsAny(opt.Share, `\/`) {
+		return nil, fmt.Errorf("invalid share name %q", opt.Share)
+	}
+	s := &server{
+		f:        f,
+		ctx:      ctx,
+		opt:      *opt,
+		start:    time.Now(),
+		computer: netbiosName(),
+		files:    newFileTable(),
+		stopped:  make(chan struct{}),
+		conns:    make(map[*conn]struct{}),
+	}
+	if proxyOpt.AuthProxy != "" {
+		s.proxy = proxy.New(ctx, proxyOpt, vfsOpt)
+	} else {
+		s.vfs = vfs.New(f, vfsOpt)
+	}
+	_, _ = rand.Read(s.guid[:])
+	var err error
+	s.listener, err = net.Listen("tcp", opt.ListenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %q: %w", opt.ListenAddr, err)
+	}
+	return s, nil
+}
+
+// netbiosName returns the NetBIOS name of this computer
+func netbiosName() string {
+	name, err := os.Hostname()
+	if err != nil || name == "" {
+		name = "rclone"
+	}
+	name, _, _ = strings.Cut(name, ".")
+	if len(name) > 15 {
+		name = name[:15]
+	}
+	return strings.ToUpper(name)
+}
+
+// Serve runs the SMB server until it is shutdown
+func (s *server) Serve() error {
+	fs.Logf(s.f, "SMB server listening on %v", s.listener.Addr())
+	defer close(s.stopped)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		nc, err := s.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		c := newConn(s, nc)
+		s.mu.Lock()
+		s.conns[c] = struct{}{}
+		s.mu.Unlock()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.serve()
+			s.mu.Lock()
+			delete(s.conns, c)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// Addr returns the address the server is listening on
+func (s *server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Shutdown stops the server, disconnecting the clients
+func (s *server) Shutdown() error {
+	err := s.listener.Close()
+	s.mu.Lock()
+	for c := range s.conns {
+		_ = c.nc.Close()
+	}
+	s.mu.Unlock()
+	<-s.stopped
+	return err
+}
+
+// newID returns a new non zero ID for a session or an open file
+func (s *server) newID() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	return s.nextID
+}
+
+// conn is a connection from an SMB client
+type conn struct {
+	srv     *server
+	nc      net.Conn
+	writeMu sync.Mutex // held while writing to nc
+	sem     chan struct{}
+	wg      sync.WaitGroup
+
+	// Set by NEGOTIATE which is only processed on its own
+	dialect    uint16
+	maxIO      uint32
+	preauth    preauthHash // SMB 3.1.1 connection preauth hash
+	clientGUID [16]byte
+	clientMode uint16
+	clientCaps uint32
+	dialects   []uint16
+
+	mu       sync.Mutex
+	sessions map[uint64]*session
+	opens    map[uint64]*open
+}
+
+// session is an authenticated user on a connection
+type session struct {
+	id        uint64
+	auth      ntlmServer
+	mechTypes []byte      // for the SPNEGO mechListMIC
+	preauth   preauthHash // SMB 3.1.1 session preauth hash
+	valid     bool        // set when authentication has finished
+	guest     bool        // guest or anonymous session
+	anonymous bool        // anonymous session
+	user      string
+	vfs       *vfs.VFS
+	signer    *signer // nil if the session can't sign
+	mustSign  bool    // client requires signing
+	trees     map[uint32]*tree
+	nextTree  uint32
+}
+
+// tree is a connected share
+type tree struct {
+	id   uint32
+	sess *session
+	ipc  bool // the IPC$ share
+}
+
+func newConn(s *server, nc net.Conn) *conn {
+	return &conn{
+		srv:      s,
+		nc:       nc,
+		sem:      make(chan struct{}, maxOutstanding),
+		sessions: make(map[uint64]*session),
+		opens:    make(map[uint64]*open),
+	}
+}
+
+// readMessage reads a direct TCP transport message
+func readMessage(r io.Reader) ([]byte, error) {
+	var hdr [4]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	if hdr[0] != 0 {
+		return nil, fmt.Errorf("bad transport header %x", hdr)
+	}
+	n := int(hdr[1])<<16 | int(hdr[2])<<8 | int(hdr[3])
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// serve processes requests on the connection until it is closed
+func (c *conn) serve() {
+	remote := c.nc.RemoteAddr().String()
+	fs.Debugf(remote, "SMB connection opened")
+	defer func() {
+		c.wg.Wait()
+		c.close()
+		fs.Debugf(remote, "SMB connection closed")
+	}()
+	for {
+		msg, err := readMessage(c.nc)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				fs.Debugf(remote, "SMB read failed: %v", err)
+			}
+			return
+		}
+		switch {
+		case bytes.HasPrefix(msg, smb1Magic):
+			if err := c.smb1Negotiate(msg); err != nil {
+				fs.Debugf(remote, "SMB1 negotiate failed: %v", err)
+				return
+			}
+		case len(msg) >= headerSize && bytes.HasPrefix(msg, smb2Magic):
+			// Negotiation and authentication change the
+			// connection state so are processed in order
+			command := le.Uint16(msg[12:])
+			if c.dialect == 0 || c.dialect == dialectWildcard || command == smb2Negotiate || command == smb2SessionSetup {
+				c.process(msg)
+				continue
+			}
+			c.sem <- struct{}{}
+			c.wg.Add(1)
+			go func() {
+				defer func() {
+					<-c.sem
+					c.wg.Done()
+				}()
+				c.process(msg)
+			}()
+		default:
+			fs.Debugf(remote, "SMB: unknown protocol %x", msg[:min(len(msg), 4)])
+			return
+		}
+	}
+}
+
+// close releases everything the connection has open
+func (c *conn) close() {
+	_ = c.nc.Close()
+	c.mu.Lock()
+	opens := c.opens
+	c.opens = make(map[uint64]*open)
+	c.sessions = make(map[uint64]*session)
+	c.mu.Unlock()
+	for _, o := range opens {
+		o.close()
+	}
+}
+
+// header is a decoded SMB2 header
+type header struct {
+	creditCharge uint16
+	command      uint16
+	credits      uint16
+	flags        uint32
+	next         uint32
+	messageID    uint64
+	processID    uint32
+	treeID       uint32
+	sessionID    uint64
+}
+
+// request is an SMB2 request being processed
+type request struct {
+	c      *conn
+	msg    []byte // the whole message starting with the header
+	hdr    header
+	body   []byte // the message after the header
+	sess   *session
+	tree   *tree
+	fileID uint64 // the file of this or the previous related request
+
+	signer  *signer      // set to sign a SESSION_SETUP response
+	preauth *preauthHash // set to add the response to a preauth hash
+}
+
+// response is an SMB2 response ready to send
+type response struct {
+	msg     []byte
+	signer  *signer
+	preauth *preauthHash
+}
+
+// related state passed down a compound request
+type related struct {
+	sessionID uint64
+	treeID    uint32
+	fileID    uint64
+	status    ntStatus
+}
+
+// process processes a (possibly compound) request and sends the
+// responses
+func (c *conn) process(msg []byte) {
+	var (
+		responses []response
+		prev      related
+	)
+	for off := 0; off+headerSize <= len(msg); {
+		end := len(msg)
+		next := le.Uint32(msg[off+20:])
+		if next != 0 {
+			if next < headerSize || int(next) > len(msg)-off {
+				break
+			}
+			end = off + int(next)
+		}
+		r := &request{c: c, msg: msg[off:end], body: msg[off+headerSize : end]}
+		r.decodeHeader()
+		if resp, ok := c.handle(r, &prev); ok {
+			responses = append(responses, resp)
+		}
+		if next == 0 {
+			break
+		}
+		off = end
+	}
+	c.send(responses)
+}
+
+// decodeHeader decodes the SMB2 header of r
+func (r *request) decodeHeader() {
+	m := r.msg
+	r.hdr = header{
+		creditCharge: le.Uint16(m[6:]),
+		command:      le.Uint16(m[12:]),
+		credits:      le.Uint16(m[14:]),
+		flags:        le.Uint32(m[16:]),
+		next:         le.Uint32(m[20:]),
+		messageID:    le.Uint64(m[24:]),
+		processID:    le.Uint32(m[32:]),
+		treeID:       le.Uint32(m[36:]),
+		sessionID:    le.Uint64(m[40:]),
+	}
+}
+
+// handle processes one request from a compound returning the
+// response and whether there is one to send
+func (c *conn) handle(r *request, prev *related) (resp response, ok bool) {
+	h := &r.hdr
+	if h.flags&flagsServerToRedir != 0 || h.command == smb2Cancel {
+		// Nothing is ever pending so there is nothing to cancel
+		return resp, false
+	}
+	isRelated := h.flags&flagsRelatedOperation != 0
+	if isRelated {
+		h.sessionID = prev.sessionID
+		h.treeID = prev.treeID
+		r.fileID = prev.fileID
+	}
+
+	var (
+		status ntStatus
+		body   []byte
+	)
+	if isRelated && prev.status != statusSuccess && prev.status != statusBufferOverflow {
+		status = prev.status
+	} else {
+		status, body = c.dispatch(r)
+	}
+	if status != statusSuccess && body == nil {
+		body = []byte{9, 0, 0, 0, 0, 0, 0, 0, 0} // SMB2 ERROR Response
+	}
+	*prev = related{sessionID: h.sessionID, treeID: h.treeID, fileID: r.fileID, status: status}
+
+	resp = response{msg: makeResponse(h, status, body), signer: r.signer, preauth: r.preauth}
+	if resp.signer == nil && r.sess != nil && r.sess.signer != nil && (h.flags&flagsSigned != 0 || r.sess.mustSign) {
+		resp.signer = r.sess.signer
+	}
+	return resp, true
+}
+
+// makeResponse makes a response message to the request with header h
+func makeResponse(h *header, status ntStatus, body []byte) []byte {
+	msg := make([]byte, headerSize, headerSize+len(body))
+	copy(msg, smb2Magic)
+	le.PutUint16(msg[4:], headerSize)
+	le.PutUint16(msg[6:], h.creditCharge)
+	le.PutUint32(msg[8:], uint32(status))
+	le.PutUint16(msg[12:], h.command)
+	le.PutUint16(msg[14:], min(max(h.credits, 1), maxCredits))
+	le.PutUint32(msg[16:], flagsServerToRedir|h.flags&flagsRelatedOperation)
+	le.PutUint64(msg[24:], h.messageID)
+	le.PutUint32(msg[32:], h.processID)
+	le.PutUint32(msg[36:], h.treeID)
+	le.PutUint64(msg[40:], h.sessionID)
+	return append(msg, body...)
+}
+
+// dispatch checks the session and tree of r then runs the handler for
+// its command
+func (c *conn) dispatch(r *request) (ntStatus, []byte) {
+	h := &r.hdr
+	switch h.command {
+	case smb2Negotiate:
+		return c.negotiate(r)
+	case smb2SessionSetup:
+		return c.sessionSetup(r)
+	case smb2Echo:
+		return statusSuccess, []byte{4, 0, 0, 0}
+	}
+	if c.dialect == 0 || c.dialect == dialectWildcard {
+		return statusInvalidParameter, nil
+	}
+
+	// Find the session and check the signature
+	c.mu.Lock()
+	sess := c.sessions[h.sessionID]
+	c.mu.Unlock()
+	if sess == nil || !sess.valid {
+		return statusUserSessionDeleted, nil
+	}
+	r.sess = sess
+	if sess.signer != nil {
+		if h.flags&flagsSigned != 0 {
+			if !sess.signer.verify(r.msg) {
+				fs.Debugf(c.nc.RemoteAddr(), "SMB: bad signature on %d", h.command)
+				return statusAccessDenied, nil
+			}
+		} else if sess.mustSign {
+			return statusAccessDenied, nil
+		}
+	}
+	switch h.command {
+	case smb2Logoff:
+		return c.logoff(r)
+	case smb2TreeConnect:
+		return c.treeConnect(r)
+	}
+
+	// Find the tree
+	c.mu.Lock()
+	r.tree = sess.trees[h.treeID]
+	c.mu.Unlock()
+	if r.tree == nil {
+		return statusNetworkNameDeleted, nil
+	}
+	switch h.command {
+	case smb2TreeDisconnect:
+		return c.treeDisconnect(r)
+	case smb2Create:
+		return c.create(r)
+	case smb2Close:
+		return c.closeFile(r)
+	case smb2Flush:
+		return c.flush(r)
+	case smb2Read:
+		return c.read(r)
+	case smb2Write:
+		return c.write(r)
+	case smb2Lock:
+		return c.lock(r)
+	case smb2Ioctl:
+		return c.ioctl(r)
+	case smb2QueryDirectory:
+		return c.queryDirectory(r)
+	case smb2QueryInfo:
+		return c.queryInfo(r)
+	case smb2SetInfo:
+		return c.setInfo(r)
+	case smb2ChangeNotify:
+		return statusNotSupported, nil
+	}
+	return statusNotSupported, nil
+}
+
+// send sends the responses to a compound request
+func (c *conn) send(responses []response) {
+	if len(responses) == 0 {
+		return
+	}
+	var out []byte
+	for i := range responses {
+		resp := &responses[i]
+		if i < len(responses)-1 {
+			// Each response in a compound starts 8 byte aligned
+			for len(resp.msg)%8 != 0 {
+				resp.msg = append(resp.msg, 0)
+			}
+			le.PutUint32(resp.msg[20:], uint32(len(resp.msg)))
+		}
+		if resp.preauth != nil {
+			*resp.preauth = resp.preauth.update(resp.msg)
+		}
+		if resp.signer != nil {
+			resp.signer.sign(resp.msg)
+		}
+		out = append(out, resp.msg...)
+	}
+	c.writeMessage(out)
+}
+
+// writeMessage writes msg with a direct TCP transport header
+func (c *conn) writeMessage(msg []byte) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	hdr := []byte{0, byte(len(msg) >> 16), byte(len(msg) >> 8), byte(len(msg))}
+	if _, err := c.nc.Write(append(hdr, msg...)); err != nil {
+		fs.Debugf(c.nc.RemoteAddr(), "SMB write failed: %v", err)
+		_ = c.nc.Close()
+	}
+}
+
+// u16 returns the little endian uint16 at off in the body or 0 if the
+// body is too short
+func (r *request) u16(off int) uint16 {
+	if off+2 > len(r.body) {
+		return 0
+	}
+	return le.Uint16(r.body[off:])
+}
+
+// u32 returns the little endian uint32 at off in the body or 0 if the
+// body is too short
+func (r *request) u32(off int) uint32 {
+	if off+4 > len(r.body) {
+		return 0
+	}
+	return le.Uint32(r.body[off:])
+}
+
+// u64 returns the little endian uint64 at off in the body or 0 if the
+// body is too short
+func (r *request) u64(off int) uint64 {
+	if off+8 > len(r.body) {
+		return 0
+	}
+	return le.Uint64(r.body[off:])
+}
+
+// buffer returns the n bytes at offset off from the start of the
+// header, checking they are in the message
+func (r *request) buffer(off, n int) ([]byte, bool) {
+	if n == 0 {
+		return nil, true
+	}
+	if off < headerSize || off > len(r.msg) || n > len(r.msg)-off {
+		return nil, false
+	}
+	return r.msg[off : off+n], true
+}
+
+// file returns the open file whose FileId is at off in the body
+//
+// A FileId of all ones is the file of the previous related request.
+func (r *request) file(off int) (*open, ntStatus) {
+	if off+16 > len(r.body) {
+		return nil, statusInvalidParameter
+	}
+	id := le.Uint64(r.body[off+8:])
+	if le.Uint64(r.body[off:]) == ^uint64(0) && id == ^uint64(0) {
+		id = r.fileID
+	}
+	r.c.mu.Lock()
+	o := r.c.opens[id]
+	r.c.mu.Unlock()
+	if o == nil || o.tree != r.tree {
+		return nil, statusFileClosed
+	}
+	r.fileID = id
+	return o, statusSuccess
+}
+
+// errorStatus converts a VFS error into an NT status
+func errorStatus(err error) ntStatus {
+	var vfsErr vfs.Error
+	switch {
+	case err == nil:
+		return statusSuccess
+	case errors.Is(err, vfs.ENOENT):
+		return statusObjectNameNotFound
+	case errors.Is(err, vfs.EEXIST):
+		return statusObjectNameCollision
+	case errors.Is(err, vfs.EPERM):
+		return statusAccessDenied
+	case errors.Is(err, vfs.EINVAL):
+		return statusInvalidParameter
+	case errors.Is(err, vfs.ECLOSED):
+		return statusFileClosed
+	case errors.As(err, &vfsErr):
+		switch vfsErr {
+		case vfs.ENOTEMPTY:
+			return statusDirectoryNotEmpty
+		case vfs.EROFS:
+			return statusAccessDenied
+		case vfs.ENOSPC:
+			return statusDiskFull
+		case vfs.ENOSYS, vfs.ENOTSUP:
+			return statusNotSupported
+		case vfs.EAGAIN:
+			return statusSharingViolation
+		case vfs.EBADF:
+			return statusInvalidHandle
+		}
+	}
+	fs.Debugf(nil, "SMB: mapping error %v to STATUS_UNEXPECTED_IO_ERROR", err)
+	return statusUnexpectedIOError
+}
@@ -0,0 +1,480 @@
+package smb
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/vfs"
+)
+
+// The NetBIOS domain the server says it is in
+const workgroup = "WORKGROUP"
+
+// capabilities returns the server capabilities for the dialect
+func capabilities(dialect uint16) uint32 {
+	if dialect >= dialect210 && dialect != dialectWildcard {
+		return globalCapLargeMTU
+	}
+	return 0
+}
+
+// negotiateBody makes the body of a NEGOTIATE response
+func (c *conn) negotiateBody(dialect uint16, contexts [][]byte) []byte {
+	secBuf := negotiateToken()
+	body := make([]byte, 64, 64+len(secBuf))
+	maxIO := uint32(maxIOSize)
+	if dialect == dialect202 || dialect == dialectWildcard {
+		maxIO = maxIOSize202
+	}
+	le.PutUint16(body[0:], 65)
+	le.PutUint16(body[2:], negotiateSigningEnabled)
+	le.PutUint16(body[4:], dialect)
+	le.PutUint16(body[6:], uint16(len(contexts)))
+	copy(body[8:24], c.srv.guid[:])
+	le.PutUint32(body[24:], capabilities(dialect))
+	le.PutUint32(body[28:], maxIO)
+	le.PutUint32(body[32:], maxIO)
+	le.PutUint32(body[36:], maxIO)
+	le.PutUint64(body[40:], toFileTime(time.Now()))
+	le.PutUint16(body[56:], headerSize+64)
+	le.PutUint16(body[58:], uint16(len(secBuf)))
+	body = append(body, secBuf...)
+	if len(contexts) > 0 {
+		for (headerSize+len(body))%8 != 0 {
+			body = append(body, 0)
+		}
+		le.PutUint32(body[60:], uint32(headerSize+len(body)))
+		for i, ctx := range contexts {
+			body = append(body, ctx...)
+			if i < len(contexts)-1 {
+				for len(body)%8 != 0 {
+					body = append(body, 0)
+				}
+			}
+		}
+	}
+	return body
+}
+
+// smb1Negotiate replies to an SMB1 NEGOTIATE offering SMB2 by
+// upgrading the connection to SMB2
+func (c *conn) smb1Negotiate(msg []byte) error {
+	if c.dialect != 0 {
+		return errors.New("SMB1 negotiate after negotiation")
+	}
+	// SMB1 header is 32 bytes then WordCount and ByteCount
+	if len(msg) < 35 || msg[4] != 0x72 {
+		return errors.New("not an SMB1 negotiate")
+	}
+	var dialect uint16
+	for _, name := range bytes.Split(msg[35:], []byte{0}) {
+		switch string(bytes.TrimPrefix(name, []byte{2})) {
+		case "SMB 2.???":
+			dialect = dialectWildcard
+		case "SMB 2.002":
+			if dialect == 0 {
+				dialect = dialect202
+			}
+		}
+	}
+	if dialect == 0 {
+		return errors.New("client doesn't support SMB2")
+	}
+	c.dialect = dialect
+	c.maxIO = maxIOSize202
+	h := header{command: smb2Negotiate, credits: 1}
+	c.writeMessage(makeResponse(&h, statusSuccess, c.negotiateBody(dialect, nil)))
+	return nil
+}
+
+// negotiate processes an SMB2 NEGOTIATE
+func (c *conn) negotiate(r *request) (ntStatus, []byte) {
+	if c.dialect != 0 && c.dialect != dialectWildcard {
+		// A second NEGOTIATE is a protocol error
+		_ = c.nc.Close()
+		return statusInvalidParameter, nil
+	}
+	count := int(r.u16(2))
+	if len(r.body) < 36+2*count || count == 0 {
+		return statusInvalidParameter, nil
+	}
+	var dialects []uint16
+	for i := range count {
+		dialects = append(dialects, r.u16(36+2*i))
+	}
+	var dialect uint16
+	for _, d := range supportedDialects {
+		if slices.Contains(dialects, d) {
+			dialect = d
+			break
+		}
+	}
+	if dialect == 0 {
+		return statusNotSupported, nil
+	}
+
+	var contexts [][]byte
+	if dialect == dialect311 {
+		if !negotiateContextsOK(r) {
+			return statusInvalidParameter, nil
+		}
+		// Preauth integrity capabilities with SHA-512 and a salt
+		ctx := make([]byte, 8+6+32)
+		le.PutUint16(ctx[0:], preauthIntegrityCapabilities)
+		le.PutUint16(ctx[2:], uint16(len(ctx)-8))
+		le.PutUint16(ctx[8:], 1)
+		le.PutUint16(ctx[10:], 32)
+		le.PutUint16(ctx[12:], hashAlgorithmSHA512)
+		_, _ = rand.Read(ctx[14:])
+		contexts = append(contexts, ctx)
+		c.preauth = c.preauth.update(r.msg)
+		r.preauth = &c.preauth
+	}
+
+	c.dialect = dialect
+	c.maxIO = maxIOSize
+	if dialect == dialect202 {
+		c.maxIO = maxIOSize202
+	}
+	c.clientMode = r.u16(4)
+	c.clientCaps = r.u32(8)
+	copy(c.clientGUID[:], r.body[12:28])
+	c.dialects = dialects
+	fs.Debugf(c.nc.RemoteAddr(), "SMB: negotiated dialect %x", dialect)
+	return statusSuccess, c.negotiateBody(dialect, contexts)
+}
+
+// negotiateContextsOK checks the SMB 3.1.1 negotiate contexts in r
+// offer SHA-512 preauth integrity
+func negotiateContextsOK(r *request) bool {
+	off := int(r.u32(28))
+	count := int(r.u16(32))
+	for range count {
+		ctx, ok := r.buffer(off, 8)
+		if !ok {
+			return false
+		}
+		n := int(le.Uint16(ctx[2:]))
+		data, ok := r.buffer(off+8, n)
+		if !ok {
+			return false
+		}
+		if le.Uint16(ctx) == preauthIntegrityCapabilities {
+			if len(data) < 4 || len(data) < 4+2*int(le.Uint16(data)) {
+				return false
+			}
+			for i := range int(le.Uint16(data)) {
+				if le.Uint16(data[4+2*i:]) == hashAlgorithmSHA512 {
+					return true
+				}
+			}
+			return false
+		}
+		off += (8 + n + 7) &^ 7
+	}
+	return false
+}
+
+// sessionSetupBody makes the body of a SESSION_SETUP response
+func sessionSetupBody(flags uint16, secBuf []byte) []byte {
+	body := make([]byte, 8, 8+len(secBuf))
+	le.PutUint16(body[0:], 9)
+	le.PutUint16(body[2:], flags)
+	le.PutUint16(body[4:], headerSize+8)
+	le.PutUint16(body[6:], uint16(len(secBuf)))
+	return append(body, secBuf...)
+}
+
+// sessionSetup processes a SESSION_SETUP which authenticates the user
+// with NTLM over SPNEGO
+func (c *conn) sessionSetup(r *request) (ntStatus, []byte) {
+	if c.dialect == 0 || c.dialect == dialectWildcard {
+		return statusInvalidParameter, nil
+	}
+	if len(r.body) < 24 {
+		return statusInvalidParameter, nil
+	}
+	if r.body[2]&sessionFlagBinding != 0 {
+		// Multichannel isn't supported
+		return statusRequestNotAccepted, nil
+	}
+	secMode := uint16(r.body[3])
+	secBuf, ok := r.buffer(int(r.u16(12)), int(r.u16(14)))
+	if !ok {
+		return statusInvalidParameter, nil
+	}
+
+	// Find or make the session
+	h := &r.hdr
+	c.mu.Lock()
+	sess := c.sessions[h.sessionID]
+	if h.sessionID == 0 {
+		sess = &session{
+			id:      c.srv.newID(),
+			auth:    ntlmServer{computer: c.srv.computer, domain: workgroup},
+			preauth: c.preauth,
+			trees:   make(map[uint32]*tree),
+		}
+		c.sessions[sess.id] = sess
+	}
+	c.mu.Unlock()
+	if sess == nil {
+		return statusUserSessionDeleted, nil
+	}
+	if sess.valid {
+		// Re-authentication isn't supported
+		return statusRequestNotAccepted, nil
+	}
+	h.sessionID = sess.id
+	if c.dialect == dialect311 {
+		sess.preauth = sess.preauth.update(r.msg)
+	}
+	fail := func(format string, a ...any) (ntStatus, []byte) {
+		fs.Infof(c.nc.RemoteAddr(), "SMB: login failed: "+format, a...)
+		c.mu.Lock()
+		delete(c.sessions, sess.id)
+		c.mu.Unlock()
+		return statusLogonFailure, nil
+	}
+
+	tok, err := decodeSpnego(secBuf)
+	if err != nil {
+		return fail("%v", err)
+	}
+	if tok.init {
+		sess.mechTypes = tok.mechTypes
+	}
+	if !tok.ntlm || len(tok.mechToken) < 12 {
+		// Ask for NTLM instead of the client's preferred mech
+		r.preauth = &sess.preauth
+		return statusMoreProcessingRequired, sessionSetupBody(0, encodeSpnego(false, negStateAcceptIncomplete, nil, nil, true))
+	}
+	switch le.Uint32(tok.mechToken[8:]) {
+	case ntlmMessageNegotiate:
+		challenge, err := sess.auth.challengeMessage(tok.mechToken)
+		if err != nil {
+			return fail("%v", err)
+		}
+		r.preauth = &sess.preauth
+		return statusMoreProcessingRequired, sessionSetupBody(0, encodeSpnego(tok.raw, negStateAcceptIncomplete, challenge, nil, true))
+	case ntlmMessageAuthenticate:
+	default:
+		return fail("unexpected NTLM message")
+	}
+
+	am, err := sess.auth.parseAuthenticate(tok.mechToken)
+	if err != nil {
+		return fail("%v", err)
+	}
+	VFS, sessionKey, err := c.srv.authenticate(&sess.auth, am)
+	if err != nil {
+		return fail("user %q: %v", am.user, err)
+	}
+	var (
+		flags uint16
+		mic   []byte
+	)
+	switch {
+	case am.anonymous():
+		flags = sessionFlagIsNull
+	case sessionKey == nil:
+		flags = sessionFlagIsGuest
+	}
+	c.mu.Lock()
+	sess.user = am.user
+	sess.vfs = VFS
+	sess.guest = sessionKey == nil
+	sess.anonymous = am.anonymous()
+	if sessionKey != nil {
+		sess.signer = newSigner(c.dialect, sessionKey, sess.preauth)
+		sess.mustSign = secMode&negotiateSigningRequired != 0
+		r.signer = sess.signer
+		if sess.mechTypes != nil && !tok.raw {
+			mic = mechListMIC(am.flags, sessionKey, sess.mechTypes)
+		}
+	}
+	sess.valid = true
+	c.mu.Unlock()
+	r.sess = sess
+	fs.Infof(c.nc.RemoteAddr(), "SMB: user %q logged in", am.user)
+	return statusSuccess, sessionSetupBody(flags, encodeSpnego(tok.raw, negStateAcceptCompleted, nil, mic, false))
+}
+
+// authenticate checks the user in the AUTHENTICATE message am
+// returning the VFS for them and the session key.
+//
+// If there is no user set then anyone can log in as a guest and the
+// session key is nil.
+func (s *server) authenticate(a *ntlmServer, am *ntlmAuthenticate) (VFS *vfs.VFS, sessionKey []byte, err error) {
+	hash := ntHash(s.opt.Pass)
+	if s.proxy != nil {
+		if am.anonymous() {
+			return nil, nil, errors.New("anonymous login not allowed")
+		}
+		var params map[string]string
+		VFS, _, params, err = s.proxy.CallParams(am.user, "", false)
+		if err != nil {
+			return nil, nil, err
+		}
+		if h, ok := params["_nt_hash"]; ok {
+			hash, err = hex.DecodeString(h)
+			if err != nil || len(hash) != 16 {
+				return nil, nil, fmt.Errorf("bad _nt_hash from auth proxy")
+			}
+		} else if pass, ok := params["_password"]; ok {
+			hash = ntHash(pass)
+		} else if s.opt.Pass == "" {
+			return nil, nil, errors.New("auth proxy didn't return a password")
+		}
+	} else {
+		VFS = s.vfs
+		if s.opt.User == "" {
+			return VFS, nil, nil
+		}
+		if !strings.EqualFold(am.user, s.opt.User) {
+			return nil, nil, errors.New("unknown user")
+		}
+	}
+	sessionKey, ok := a.verify(am, hash)
+	if !ok {
+		return nil, nil, errors.New("incorrect password")
+	}
+	return VFS, sessionKey, nil
+}
+
+// logoff processes a LOGOFF
+func (c *conn) logoff(r *request) (ntStatus, []byte) {
+	c.mu.Lock()
+	delete(c.sessions, r.sess.id)
+	c.mu.Unlock()
+	c.closeOpens(func(o *open) bool { return o.tree.sess == r.sess })
+	return statusSuccess, []byte{4, 0, 0, 0}
+}
+
+// maxAccess returns the access the session has to the share
+func (sess *session) maxAccess() uint32 {
+	if sess.vfs.Opt.ReadOnly {
+		return fileReadOnlyMask | readControl | synchronize
+	}
+	return fileAllAccess
+}
+
+// treeConnect processes a TREE_CONNECT
+func (c *conn) treeConnect(r *request) (ntStatus, []byte) {
+	pathBuf, ok := r.buffer(int(r.u16(4)), int(r.u16(6)))
+	if !ok {
+		return statusInvalidParameter, nil
+	}
+	path := fromUTF16le(pathBuf)
+	share := path[strings.LastIndex(path, `\`)+1:]
+	t := &tree{sess: r.sess}
+	shareType := uint8(shareTypeDisk)
+	access := r.sess.maxAccess()
+	switch {
+	case strings.EqualFold(share, "IPC$"):
+		t.ipc = true
+		shareType = shareTypePipe
+		access = fileAllAccess
+	case !strings.EqualFold(share, c.srv.opt.Share):
+		fs.Debugf(c.nc.RemoteAddr(), "SMB: unknown share %q", path)
+		return statusBadNetworkName, nil
+	}
+	c.mu.Lock()
+	r.sess.nextTree++
+	t.id = r.sess.nextTree
+	r.sess.trees[t.id] = t
+	c.mu.Unlock()
+	r.hdr.treeID = t.id
+
+	body := make([]byte, 16)
+	le.PutUint16(body[0:], 16)
+	body[2] = shareType
+	le.PutUint32(body[12:], access)
+	return statusSuccess, body
+}
+
+// treeDisconnect processes a TREE_DISCONNECT
+func (c *conn) treeDisconnect(r *request) (ntStatus, []byte) {
+	c.mu.Lock()
+	delete(r.sess.trees, r.tree.id)
+	c.mu.Unlock()
+	c.closeOpens(func(o *open) bool { return o.tree == r.tree })
+	return statusSuccess, []byte{4, 0, 0, 0}
+}
+
+// ioctl processes an IOCTL
+func (c *conn) ioctl(r *request) (ntStatus, []byte) {
+	if len(r.body) < 56 {
+		return statusInvalidParameter, nil
+	}
+	ctl := r.u32(4)
+	input, ok := r.buffer(int(r.u32(24)), int(r.u32(28)))
+	if !ok {
+		return statusInvalidParameter, nil
+	}
+	var output []byte
+	switch ctl {
+	case fsctlValidateNegotiateInfo:
+		if !c.validNegotiate(input) {
+			// This means something has tampered with the
+			// negotiation so the connection must be dropped
+			fs.Errorf(c.nc.RemoteAddr(), "SMB: negotiate validation failed")
+			_ = c.nc.Close()
+			return statusAccessDenied, nil
+		}
+		output = make([]byte, 24)
+		le.PutUint32(output[0:], capabilities(c.dialect))
+		copy(output[4:20], c.srv.guid[:])
+		le.PutUint16(output[20:], negotiateSigningEnabled)
+		le.PutUint16(output[22:], c.dialect)
+	case fsctlDfsGetReferrals, fsctlDfsGetReferralsEx:
+		return statusFsDriverRequired, nil
+	case fsctlGetReparsePoint:
+		if _, status := r.file(8); status != statusSuccess {
+			return status, nil
+		}
+		return statusNotAReparsePoint, nil
+	case fsctlQueryNetworkInterfaceInfo, fsctlPipeTransceive:
+		return statusNotSupported, nil
+	default:
+		return statusInvalidDeviceRequest, nil
+	}
+	if uint32(len(output)) > r.u32(44) {
+		return statusBufferTooSmall, nil
+	}
+	body := make([]byte, 48, 48+len(output))
+	le.PutUint16(body[0:], 49)
+	le.PutUint32(body[4:], ctl)
+	copy(body[8:24], r.body[8:24])
+	le.PutUint32(body[24:], headerSize+48)
+	le.PutUint32(body[32:], headerSize+48)
+	le.PutUint32(body[36:], uint32(len(output)))
+	return statusSuccess, append(body, output...)
+}
+
+// validNegotiate checks the VALIDATE_NEGOTIATE_INFO input matches
+// what the client sent in its NEGOTIATE
+func (c *conn) validNegotiate(input []byte) bool {
+	if len(input) < 24 {
+		return false
+	}
+	count := int(le.Uint16(input[22:]))
+	if len(input) < 24+2*count || count != len(c.dialects) {
+		return false
+	}
+	for i, d := range c.dialects {
+		if le.Uint16(input[24+2*i:]) != d {
+			return false
+		}
+	}
+	return le.Uint32(input) == c.clientCaps &&
+		bytes.Equal(input[4:20], c.clientGUID[:]) &&
+		le.Uint16(input[20:]) == c.clientMode
+}
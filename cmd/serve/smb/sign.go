@@ -0,0 +1,148 @@
+package smb
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+)
+
+// kdf is the SP800-108 counter mode key derivation function used
+// by SMB 3.x to make the signing key from the session key
+func kdf(key, label, context []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], 1)
+	h.Write(buf[:])
+	h.Write(label)
+	h.Write([]byte{0})
+	h.Write(context)
+	binary.BigEndian.PutUint32(buf[:], 128)
+	h.Write(buf[:])
+	return h.Sum(nil)[:16]
+}
+
+// cmac computes the AES-CMAC of msg as described in RFC 4493
+func cmac(block cipher.Block, msg []byte) []byte {
+	const bs = aes.BlockSize
+	// Make the sub keys
+	shift := func(in []byte) []byte {
+		out := make([]byte, bs)
+		var carry byte
+		for i := bs - 1; i >= 0; i-- {
+			out[i] = in[i]<<1 | carry
+			carry = in[i] >> 7
+		}
+		if carry != 0 {
+			out[bs-1] ^= 0x87
+		}
+		return out
+	}
+	l := make([]byte, bs)
+	block.Encrypt(l, l)
+	k1 := shift(l)
+	k2 := shift(k1)
+
+	// Pad and xor the last block with the appropriate sub key
+	n := (len(msg) + bs - 1) / bs
+	if n == 0 {
+		n = 1
+	}
+	last := make([]byte, bs)
+	rest := msg[(n-1)*bs:]
+	copy(last, rest)
+	if len(rest) == bs {
+		for i := range last {
+			last[i] ^= k1[i]
+		}
+	} else {
+		last[len(rest)] = 0x80
+		for i := range last {
+			last[i] ^= k2[i]
+		}
+	}
+
+	// CBC-MAC the blocks
+	x := make([]byte, bs)
+	for i := 0; i < n-1; i++ {
+		for j := 0; j < bs; j++ {
+			x[j] ^= msg[i*bs+j]
+		}
+		block.Encrypt(x, x)
+	}
+	for j := 0; j < bs; j++ {
+		x[j] ^= last[j]
+	}
+	block.Encrypt(x, x)
+	return x
+}
+
+// signer signs and verifies SMB2 messages for a session
+type signer struct {
+	dialect uint16
+	key     []byte
+	block   cipher.Block // for AES-CMAC with SMB 3.x
+}
+
+// newSigner makes the signer for a session with sessionKey
+//
+// preauthHash is the SMB 3.1.1 preauth integrity hash of the session
+func newSigner(dialect uint16, sessionKey, preauthHash []byte) *signer {
+	s := &signer{dialect: dialect}
+	switch {
+	case dialect >= dialect311:
+		s.key = kdf(sessionKey, []byte("SMBSigningKey\x00"), preauthHash)
+	case dialect >= dialect300:
+		s.key = kdf(sessionKey, []byte("SMB2AESCMAC\x00"), []byte("SmbSign\x00"))
+	default:
+		s.key = sessionKey
+	}
+	if dialect >= dialect300 {
+		s.block, _ = aes.NewCipher(s.key)
+	}
+	return s
+}
+
+// signature computes the signature of msg ignoring its signature field
+func (s *signer) signature(msg []byte) []byte {
+	var zero [16]byte
+	if s.block != nil {
+		buf := make([]byte, len(msg))
+		copy(buf, msg)
+		copy(buf[48:64], zero[:])
+		return cmac(s.block, buf)
+	}
+	h := hmac.New(sha256.New, s.key)
+	h.Write(msg[:48])
+	h.Write(zero[:])
+	h.Write(msg[64:])
+	return h.Sum(nil)[:16]
+}
+
+// sign sets the signed flag and the signature of msg
+func (s *signer) sign(msg []byte) {
+	binary.LittleEndian.PutUint32(msg[16:], binary.LittleEndian.Uint32(msg[16:])|flagsSigned)
+	copy(msg[48:64], s.signature(msg))
+}
+
+// verify checks the signature of msg
+func (s *signer) verify(msg []byte) bool {
+	return hmac.Equal(msg[48:64], s.signature(msg))
+}
+
+// preauthHash is the SMB 3.1.1 preauth integrity hash
+type preauthHash []byte
+
+// update returns the hash updated with msg
+func (h preauthHash) update(msg []byte) preauthHash {
+	d := sha512.New()
+	if h == nil {
+		d.Write(make([]byte, sha512.Size))
+	} else {
+		d.Write(h)
+	}
+	d.Write(msg)
+	return d.Sum(nil)
+}
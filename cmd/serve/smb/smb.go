@@ -0,0 +1,179 @@
+// Package smb implements an SMB2/3 server for rclone
+package smb
+
+import (
+	"context"
+
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/cmd/serve"
+	"github.com/rclone/rclone/cmd/serve/proxy"
+	"github.com/rclone/rclone/cmd/serve/proxy/proxyflags"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/vfs"
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/rclone/rclone/vfs/vfsflags"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// OptionsInfo describes the Options in use
+var OptionsInfo = fs.Options{{
+	Name:    "addr",
+	Default: "localhost:445",
+	Help:    "IPaddress:Port or :Port to bind server to",
+}, {
+	Name:    "user",
+	Default: "",
+	Help:    "User name for authentication",
+}, {
+	Name:    "pass",
+	Default: "",
+	Help:    "Password for authentication",
+}, {
+	Name:    "share",
+	Default: "rclone",
+	Help:    "Name of the share to serve the remote as",
+}}
+
+// Options contains options for the SMB Server
+type Options struct {
+	ListenAddr string `config:"addr"`  // Port to listen on
+	User       string `config:"user"`  // single username
+	Pass       string `config:"pass"`  // password for User
+	Share      string `config:"share"` // name of the share
+}
+
+// Opt is options set by command line flags
+var Opt Options
+
+// AddFlags adds flags for the smb
+func AddFlags(flagSet *pflag.FlagSet) {
+	flags.AddFlagsFromOptions(flagSet, "", OptionsInfo)
+}
+
+func init() {
+	fs.RegisterGlobalOptions(fs.OptionsInfo{Name: "smb", Opt: &Opt, Options: OptionsInfo})
+	vfsflags.AddFlags(Command.Flags())
+	proxyflags.AddFlags(Command.Flags())
+	AddFlags(Command.Flags())
+	serve.Command.AddCommand(Command)
+	serve.AddRc("smb", func(ctx context.Context, f fs.Fs, in rc.Params) (serve.Handle, error) {
+		// Read VFS Opts
+		var vfsOpt = vfscommon.Opt // set default opts
+		err := configstruct.SetAny(in, &vfsOpt)
+		if err != nil {
+			return nil, err
+		}
+		// Read Proxy Opts
+		var proxyOpt = proxy.Opt // set default opts
+		err = configstruct.SetAny(in, &proxyOpt)
+		if err != nil {
+			return nil, err
+		}
+		// Read opts
+		var opt = Opt // set default opts
+		err = configstruct.SetAny(in, &opt)
+		if err != nil {
+			return nil, err
+		}
+		// Create server
+		return newServer(ctx, f, &opt, &vfsOpt, &proxyOpt)
+	})
+}
+
+// Command definition for cobra
+var Command = &cobra.Command{
+	Use:   "smb remote:path",
+	Short: `Serve remote:path over SMB.`,
+	Long: `Run an SMB server to serve a remote over the SMB2/3 protocol.
+This lets the remote be mapped as a network drive on Windows, mounted
+with |mount -t cifs| on Linux or connected to with the Finder on
+macOS. You can also make a remote of type smb to read and write it.
+
+The remote is served as a single share, called |rclone| by default,
+which can be changed with |--share|. For example on Windows
+
+    net use X: \\server\rclone
+
+or on Linux
+
+    mount -t cifs //server/rclone /mnt/rclone -o user=USER,pass=PASS
+
+The server speaks the SMB 2.0.2, 2.1, 3.0, 3.0.2 and 3.1.1
+dialects. Messages are signed when the client asks for it, but
+encryption, oplocks and leases, change notifications, alternate data
+streams and DFS are not supported. Share modes and byte range locks
+are enforced between the clients of this server, but byte range
+locks are advisory so they don't stop reads and writes.
+
+The VFS doesn't support Windows file attributes or security
+descriptors so setting these is ignored. Every file is reported as
+owned by Everyone with full access.
+
+### Server options
+
+Use |--addr| to specify which IP address and port the server should
+listen on, e.g. |--addr 1.2.3.4:445| or |--addr :445| to listen to all
+IPs. By default it only listens on localhost.
+
+Windows can only connect to SMB servers on port 445, which usually
+needs root or |CAP_NET_BIND_SERVICE| to listen on, and which
+conflicts with the SMB server built into Windows. Other clients can
+use a different port, e.g. |mount -t cifs -o port=4450|. You can use
+port :0 to let the OS choose an available port.
+
+If you set |--addr| to listen on a public or LAN accessible IP address
+then using Authentication is advised - see the next section for info.
+
+#### Authentication
+
+By default this will serve files as a guest without needing a
+login. Recent versions of Windows refuse to connect to guest shares
+unless the |AllowInsecureGuestAuth| policy is set and they need
+signing which guest sessions can't do, so it is best to set a user.
+
+You can set a single username and password with the |--user| and
+|--pass| flags. Clients authenticate with NTLMv2, the user name is
+case insensitive and the client's domain is ignored.
+
+When using |--auth-proxy| the proxy is called with the user name and
+an empty password as SMB clients never send the password to the
+server. The proxy must return the user's password in the |_password|
+parameter, or their NT hash (the hex MD4 of the UTF-16LE password) in
+the |_nt_hash| parameter, which the server uses to check the client's
+response. If neither is returned the |--pass| is used.
+
+#### VFS cache
+
+Windows writes files out of order and sets their size before writing
+them, so using |--vfs-cache-mode writes| or |--vfs-cache-mode full| is
+recommended. Without it some writes will fail.
+
+SMB clients expect file names to be case insensitive, so consider using
+|--vfs-case-insensitive| when serving a case sensitive remote.
+
+` + vfs.Help() + proxy.Help,
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.72",
+		"groups":            "Filter",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		var f fs.Fs
+		if proxy.Opt.AuthProxy == "" {
+			cmd.CheckArgs(1, 1, command, args)
+			f = cmd.NewFsSrc(args)
+		} else {
+			cmd.CheckArgs(0, 0, command, args)
+		}
+		cmd.Run(false, true, command, func() error {
+			s, err := newServer(context.Background(), f, &Opt, &vfscommon.Opt, &proxy.Opt)
+			if err != nil {
+				return err
+			}
+			return s.Serve()
+		})
+	},
+}
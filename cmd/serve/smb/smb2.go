@@ -0,0 +1,270 @@
+package smb
+
+// Constants from MS-SMB2, MS-FSCC and MS-ERREF
+
+// SMB2 dialects
+const (
+	dialect202      = 0x0202
+	dialect210      = 0x0210
+	dialect300      = 0x0300
+	dialect302      = 0x0302
+	dialect311      = 0x0311
+	dialectWildcard = 0x02FF
+)
+
+// supportedDialects are the dialects the server speaks, best first
+var supportedDialects = []uint16{dialect311, dialect302, dialect300, dialect210, dialect202}
+
+// SMB2 commands
+const (
+	smb2Negotiate      = 0x0000
+	smb2SessionSetup   = 0x0001
+	smb2Logoff         = 0x0002
+	smb2TreeConnect    = 0x0003
+	smb2TreeDisconnect = 0x0004
+	smb2Create         = 0x0005
+	smb2Close          = 0x0006
+	smb2Flush          = 0x0007
+	smb2Read           = 0x0008
+	smb2Write          = 0x0009
+	smb2Lock           = 0x000A
+	smb2Ioctl          = 0x000B
+	smb2Cancel         = 0x000C
+	smb2Echo           = 0x000D
+	smb2QueryDirectory = 0x000E
+	smb2ChangeNotify   = 0x000F
+	smb2QueryInfo      = 0x0010
+	smb2SetInfo        = 0x0011
+)
+
+// SMB2 header
+const (
+	headerSize = 64
+
+	flagsServerToRedir    = 0x00000001
+	flagsRelatedOperation = 0x00000004
+	flagsSigned           = 0x00000008
+)
+
+// Negotiate security modes and capabilities
+const (
+	negotiateSigningEnabled  = 0x0001
+	negotiateSigningRequired = 0x0002
+
+	globalCapLargeMTU = 0x00000004
+
+	preauthIntegrityCapabilities = 0x0001
+	hashAlgorithmSHA512          = 0x0001
+)
+
+// Session setup
+const (
+	sessionFlagBinding = 0x01
+
+	sessionFlagIsGuest = 0x0001
+	sessionFlagIsNull  = 0x0002
+)
+
+// Tree connect
+const (
+	shareTypeDisk = 0x01
+	shareTypePipe = 0x02
+)
+
+// Access masks
+const (
+	fileReadData        = 0x00000001
+	fileWriteData       = 0x00000002
+	fileAppendData      = 0x00000004
+	fileWriteEA         = 0x00000010
+	fileExecute         = 0x00000020
+	fileDeleteChild     = 0x00000040
+	fileWriteAttributes = 0x00000100
+	accessDelete        = 0x00010000
+	readControl         = 0x00020000
+	writeDAC            = 0x00040000
+	writeOwner          = 0x00080000
+	synchronize         = 0x00100000
+	maximumAllowed      = 0x02000000
+	genericAll          = 0x10000000
+	genericExecute      = 0x20000000
+	genericWrite        = 0x40000000
+	genericRead         = 0x80000000
+
+	fileAllAccess     = 0x001F01FF
+	fileGenericRead   = 0x00120089
+	fileGenericWrite  = 0x00120116
+	fileGenericExec   = 0x001200A0
+	fileReadOnlyMask  = fileGenericRead | fileGenericExec
+	fileWriteAccesses = fileWriteData | fileAppendData | fileWriteEA | fileDeleteChild | fileWriteAttributes | accessDelete | writeDAC | writeOwner
+)
+
+// Share access
+const (
+	fileShareRead   = 0x00000001
+	fileShareWrite  = 0x00000002
+	fileShareDelete = 0x00000004
+)
+
+// Create dispositions
+const (
+	fileSupersede   = 0x00000000
+	fileOpen        = 0x00000001
+	fileCreate      = 0x00000002
+	fileOpenIf      = 0x00000003
+	fileOverwrite   = 0x00000004
+	fileOverwriteIf = 0x00000005
+)
+
+// Create actions
+const (
+	fileSuperseded  = 0x00000000
+	fileOpened      = 0x00000001
+	fileCreated     = 0x00000002
+	fileOverwritten = 0x00000003
+)
+
+// Create options
+const (
+	fileDirectoryFile    = 0x00000001
+	fileNonDirectoryFile = 0x00000040
+	fileDeleteOnClose    = 0x00001000
+)
+
+// File attributes
+const (
+	fileAttributeReadonly  = 0x00000001
+	fileAttributeDirectory = 0x00000010
+	fileAttributeArchive   = 0x00000020
+)
+
+// Close flags
+const (
+	closeFlagPostQueryAttrib = 0x0001
+)
+
+// Write flags
+const (
+	writeFlagWriteThrough = 0x00000001
+)
+
+// Lock flags
+const (
+	lockFlagSharedLock    = 0x00000001
+	lockFlagExclusiveLock = 0x00000002
+	lockFlagUnlock        = 0x00000004
+)
+
+// Query directory flags
+const (
+	restartScans      = 0x01
+	returnSingleEntry = 0x02
+	reopen            = 0x10
+)
+
+// Info types for QUERY_INFO and SET_INFO
+const (
+	infoFile       = 0x01
+	infoFilesystem = 0x02
+	infoSecurity   = 0x03
+)
+
+// File information classes
+const (
+	fileDirectoryInformation       = 1
+	fileFullDirectoryInformation   = 2
+	fileBothDirectoryInformation   = 3
+	fileBasicInformation           = 4
+	fileStandardInformation        = 5
+	fileInternalInformation        = 6
+	fileEaInformation              = 7
+	fileAccessInformation          = 8
+	fileNameInformation            = 9
+	fileRenameInformation          = 10
+	fileNamesInformation           = 12
+	fileDispositionInformation     = 13
+	filePositionInformation        = 14
+	fileModeInformation            = 16
+	fileAlignmentInformation       = 17
+	fileAllInformation             = 18
+	fileAllocationInformation      = 19
+	fileEndOfFileInformation       = 20
+	fileStreamInformation          = 22
+	fileNetworkOpenInformation     = 34
+	fileAttributeTagInformation    = 35
+	fileIDBothDirectoryInformation = 37
+	fileIDFullDirectoryInformation = 38
+	fileDispositionInformationEx   = 64
+	fileNormalizedNameInformation  = 48
+	fileDispositionExFlagDelete    = 0x00000001
+)
+
+// Filesystem information classes
+const (
+	fileFsVolumeInformation     = 1
+	fileFsSizeInformation       = 3
+	fileFsDeviceInformation     = 4
+	fileFsAttributeInformation  = 5
+	fileFsFullSizeInformation   = 7
+	fileFsSectorSizeInformation = 11
+)
+
+// Filesystem attributes
+const (
+	fileCaseSensitiveSearch = 0x00000001
+	fileCasePreservedNames  = 0x00000002
+	fileUnicodeOnDisk       = 0x00000004
+	fileReadOnlyVolume      = 0x00080000
+)
+
+// IOCTL codes
+const (
+	fsctlDfsGetReferrals           = 0x00060194
+	fsctlDfsGetReferralsEx         = 0x000601B0
+	fsctlGetReparsePoint           = 0x000900A8
+	fsctlValidateNegotiateInfo     = 0x00140204
+	fsctlQueryNetworkInterfaceInfo = 0x001401FC
+	fsctlPipeTransceive            = 0x0011C017
+)
+
+// NT status codes
+type ntStatus uint32
+
+const (
+	statusSuccess                ntStatus = 0x00000000
+	statusBufferOverflow         ntStatus = 0x80000005
+	statusNoMoreFiles            ntStatus = 0x80000006
+	statusInvalidInfoClass       ntStatus = 0xC0000003
+	statusInfoLengthMismatch     ntStatus = 0xC0000004
+	statusInvalidHandle          ntStatus = 0xC0000008
+	statusInvalidParameter       ntStatus = 0xC000000D
+	statusNoSuchFile             ntStatus = 0xC000000F
+	statusInvalidDeviceRequest   ntStatus = 0xC0000010
+	statusEndOfFile              ntStatus = 0xC0000011
+	statusMoreProcessingRequired ntStatus = 0xC0000016
+	statusAccessDenied           ntStatus = 0xC0000022
+	statusObjectNameInvalid      ntStatus = 0xC0000033
+	statusObjectNameNotFound     ntStatus = 0xC0000034
+	statusObjectNameCollision    ntStatus = 0xC0000035
+	statusObjectPathNotFound     ntStatus = 0xC000003A
+	statusSharingViolation       ntStatus = 0xC0000043
+	statusLockNotGranted         ntStatus = 0xC0000055
+	statusDeletePending          ntStatus = 0xC0000056
+	statusLogonFailure           ntStatus = 0xC000006D
+	statusRangeNotLocked         ntStatus = 0xC000007E
+	statusDiskFull               ntStatus = 0xC000007F
+	statusFileIsADirectory       ntStatus = 0xC00000BA
+	statusNotSupported           ntStatus = 0xC00000BB
+	statusBadNetworkName         ntStatus = 0xC00000CC
+	statusRequestNotAccepted     ntStatus = 0xC00000D0
+	statusUnexpectedIOError      ntStatus = 0xC00000E9
+	statusDirectoryNotEmpty      ntStatus = 0xC0000101
+	statusNotADirectory          ntStatus = 0xC0000103
+	statusFileClosed             ntStatus = 0xC0000128
+	statusFsDriverRequired       ntStatus = 0xC000019C
+	statusUserSessionDeleted     ntStatus = 0xC0000203
+	statusNotAReparsePoint       ntStatus = 0xC0000275
+	statusNetworkNameDeleted     ntStatus = 0xC00000C9
+	statusCannotDelete           ntStatus = 0xC0000121
+	statusBufferTooSmall         ntStatus = 0xC0000023
+)
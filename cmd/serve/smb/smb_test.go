@@ -0,0 +1,314 @@
+// Serve smb tests set up a server and run a pure Go SMB client
+// against it.
+
+package smb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/cloudsoda/go-smb2"
+	_ "github.com/rclone/rclone/backend/local"
+	_ "github.com/rclone/rclone/backend/memory"
+	"github.com/rclone/rclone/cmd/serve/proxy"
+	"github.com/rclone/rclone/cmd/serve/servetest"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/obscure"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testUSER = "rclone"
+	testPASS = "password"
+)
+
+// start a server serving f with opt and return its address
+func startServer(t *testing.T, f fs.Fs, opt Options, proxyOpt *proxy.Options) string {
+	opt.ListenAddr = "localhost:0"
+	if opt.Share == "" {
+		opt.Share = "rclone"
+	}
+	vfsOpt := vfscommon.Opt
+	vfsOpt.CacheMode = vfscommon.CacheModeWrites
+	s, err := newServer(context.Background(), f, &opt, &vfsOpt, proxyOpt)
+	require.NoError(t, err)
+	quit := make(chan struct{})
+	go func() {
+		assert.NoError(t, s.Serve())
+		close(quit)
+	}()
+	t.Cleanup(func() {
+		assert.NoError(t, s.Shutdown())
+		<-quit
+	})
+	return s.Addr().String()
+}
+
+// make a new memory remote
+func newMemory(t *testing.T) fs.Fs {
+	f, err := fs.NewFs(context.Background(), ":memory:"+t.Name())
+	require.NoError(t, err)
+	return f
+}
+
+// dial the server and log in with user and pass
+func dial(t *testing.T, addr string, dialect uint16, sign bool, user, pass string) (*smb2.Session, error) {
+	d := &smb2.Dialer{
+		Negotiator: smb2.Negotiator{
+			RequireMessageSigning: sign,
+			SpecifiedDialect:      dialect,
+		},
+		Initiator: &smb2.NTLMInitiator{
+			User:     user,
+			Password: pass,
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	session, err := d.Dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	t.Cleanup(func() {
+		_ = session.Logoff()
+	})
+	return session, nil
+}
+
+// mount the rclone share
+func mount(t *testing.T, session *smb2.Session) *smb2.Share {
+	share, err := session.Mount("rclone")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = share.Umount()
+	})
+	return share
+}
+
+// names reads the names in dir
+func names(t *testing.T, share *smb2.Share, dir string) []string {
+	fis, err := share.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, fi := range fis {
+		names = append(names, fi.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// exercise the share with file operations
+func testShare(t *testing.T, share *smb2.Share) {
+	// Directories
+	require.NoError(t, share.Mkdir("dir", 0777))
+	fi, err := share.Stat("dir")
+	require.NoError(t, err)
+	assert.True(t, fi.IsDir())
+	assert.Error(t, share.Mkdir("dir", 0777))
+
+	// Write and read back a file
+	data := bytes.Repeat([]byte("hello world "), 10000)
+	require.NoError(t, share.WriteFile(`dir\file.txt`, data, 0666))
+	got, err := share.ReadFile(`dir\file.txt`)
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+	fi, err = share.Stat(`dir\file.txt`)
+	require.NoError(t, err)
+	assert.False(t, fi.IsDir())
+	assert.Equal(t, "file.txt", fi.Name())
+	assert.Equal(t, int64(len(data)), fi.Size())
+
+	// Random access reads and writes
+	f, err := share.OpenFile(`dir\file.txt`, os.O_RDWR, 0666)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte("HELLO"), 12)
+	require.NoError(t, err)
+	buf := make([]byte, 11)
+	_, err = f.ReadAt(buf, 12)
+	require.NoError(t, err)
+	assert.Equal(t, "HELLO world", string(buf))
+	_, err = f.ReadAt(buf, int64(len(data)))
+	assert.Equal(t, io.EOF, err)
+	require.NoError(t, f.Truncate(5))
+	require.NoError(t, f.Sync())
+	require.NoError(t, f.Close())
+	got, err = share.ReadFile(`dir\file.txt`)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(got))
+
+	// Modification times
+	mtime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	require.NoError(t, share.Chtimes(`dir\file.txt`, mtime, mtime))
+	fi, err = share.Stat(`dir\file.txt`)
+	require.NoError(t, err)
+	assert.True(t, mtime.Equal(fi.ModTime()), "want %v got %v", mtime, fi.ModTime())
+
+	// Listings and renames
+	require.NoError(t, share.WriteFile(`dir\file2.txt`, []byte("two"), 0666))
+	assert.Equal(t, []string{"file.txt", "file2.txt"}, names(t, share, "dir"))
+	require.NoError(t, share.Rename(`dir\file2.txt`, `renamed.txt`))
+	assert.Equal(t, []string{"file.txt"}, names(t, share, "dir"))
+	assert.Equal(t, []string{"dir", "renamed.txt"}, names(t, share, ""))
+	_, err = share.Stat(`dir\file2.txt`)
+	assert.True(t, os.IsNotExist(err), "got %v", err)
+
+	// Removal
+	assert.Error(t, share.Remove("dir"), "directory not empty")
+	require.NoError(t, share.Remove(`dir\file.txt`))
+	require.NoError(t, share.Remove("dir"))
+	require.NoError(t, share.Remove("renamed.txt"))
+	assert.Equal(t, []string(nil), names(t, share, ""))
+
+	// File system info
+	_, err = share.Statfs("")
+	require.NoError(t, err)
+}
+
+func TestDialects(t *testing.T) {
+	addr := startServer(t, newMemory(t), Options{User: testUSER, Pass: testPASS}, &proxy.Opt)
+	for _, test := range []struct {
+		name    string
+		dialect uint16
+	}{
+		{"2.0.2", dialect202},
+		{"2.1", dialect210},
+		{"3.0", dialect300},
+		{"3.0.2", dialect302},
+		{"3.1.1", dialect311},
+	} {
+		for _, sign := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s,sign=%v", test.name, sign), func(t *testing.T) {
+				session, err := dial(t, addr, test.dialect, sign, testUSER, testPASS)
+				require.NoError(t, err)
+				testShare(t, mount(t, session))
+			})
+		}
+	}
+}
+
+func TestAuth(t *testing.T) {
+	addr := startServer(t, newMemory(t), Options{User: testUSER, Pass: testPASS}, &proxy.Opt)
+
+	// user names are case insensitive
+	_, err := dial(t, addr, 0, true, "RClone", testPASS)
+	assert.NoError(t, err)
+
+	_, err = dial(t, addr, 0, false, testUSER, "wrong")
+	assert.Error(t, err)
+
+	_, err = dial(t, addr, 0, false, "wrong", testPASS)
+	assert.Error(t, err)
+}
+
+func TestShares(t *testing.T) {
+	addr := startServer(t, newMemory(t), Options{User: testUSER, Pass: testPASS}, &proxy.Opt)
+	session, err := dial(t, addr, 0, false, testUSER, testPASS)
+	require.NoError(t, err)
+
+	_, err = session.Mount("notfound")
+	assert.Error(t, err)
+
+	// IPC$ is always available
+	share, err := session.Mount("IPC$")
+	require.NoError(t, err)
+	assert.NoError(t, share.Umount())
+}
+
+func TestGuest(t *testing.T) {
+	f := newMemory(t)
+	addr := startServer(t, f, Options{}, &proxy.Opt)
+	session, err := dial(t, addr, 0, false, "anyone", "anything")
+	require.NoError(t, err)
+	share := mount(t, session)
+	require.NoError(t, share.WriteFile("guest.txt", []byte("guest"), 0666))
+	got, err := share.ReadFile("guest.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "guest", string(got))
+}
+
+func TestAuthProxy(t *testing.T) {
+	fstest.Initialise()
+	dir := t.TempDir()
+	prog, err := filepath.Abs("../servetest/proxy_code.go")
+	require.NoError(t, err)
+	proxyOpt := proxy.Opt
+	proxyOpt.AuthProxy = "go run " + prog + " " + dir
+
+	// the test proxy doesn't return a password so --pass is used
+	addr := startServer(t, nil, Options{Pass: testPASS}, &proxyOpt)
+
+	_, err = dial(t, addr, 0, false, testUSER, "wrong")
+	assert.Error(t, err)
+
+	session, err := dial(t, addr, 0, true, testUSER, testPASS)
+	require.NoError(t, err)
+	share := mount(t, session)
+	require.NoError(t, share.WriteFile("proxy.txt", []byte("proxy"), 0666))
+	got, err := share.ReadFile("proxy.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "proxy", string(got))
+}
+
+// TestSMB runs the smb server then runs the unit tests for the smb
+// remote against it.
+func TestSMB(t *testing.T) {
+	// Configure and start the server
+	start := func(f fs.Fs) (configmap.Simple, func()) {
+		opt := Opt
+		opt.ListenAddr = "localhost:0"
+		opt.User = testUSER
+		opt.Pass = testPASS
+
+		// The smb backend is case insensitive and writes out of order
+		vfsOpt := vfscommon.Opt
+		vfsOpt.CacheMode = vfscommon.CacheModeWrites
+		vfsOpt.CaseInsensitive = true
+
+		s, err := newServer(context.Background(), f, &opt, &vfsOpt, &proxy.Opt)
+		require.NoError(t, err)
+
+		quit := make(chan struct{})
+		go func() {
+			assert.NoError(t, s.Serve())
+			close(quit)
+		}()
+
+		// Config for the backend we'll use to connect to the server
+		host, port, err := net.SplitHostPort(s.Addr().String())
+		require.NoError(t, err)
+		config := configmap.Simple{
+			"type": "smb",
+			"host": host,
+			"port": port,
+			"user": testUSER,
+			"pass": obscure.MustObscure(testPASS),
+		}
+
+		return config, func() {
+			assert.NoError(t, s.Shutdown())
+			<-quit
+		}
+	}
+
+	servetest.RunPath(t, "smb", Opt.Share, start)
+}
+
+func TestRc(t *testing.T) {
+	servetest.TestRc(t, rc.Params{
+		"type":           "smb",
+		"vfs_cache_mode": "off",
+	})
+}
@@ -0,0 +1,143 @@
+package webdav
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/vfs"
+	"golang.org/x/net/webdav"
+)
+
+// tokenPrefix is put on the VFS lock tokens to make them URIs
+const tokenPrefix = "opaquelocktoken:rclone-"
+
+// tempTokenPrefix marks the locks the webdav handler makes for the
+// duration of a request which doesn't supply any lock tokens.
+const tempTokenPrefix = "rclone-temp:"
+
+// lockSystem is a webdav.LockSystem which uses the VFS lock manager
+// so the locks are shared with the other users of the VFS.
+type lockSystem struct {
+	locks *vfs.LockManager
+}
+
+// check interface
+var _ webdav.LockSystem = (*lockSystem)(nil)
+
+// newLockSystem makes a webdav.LockSystem for the VFS
+func newLockSystem(VFS *vfs.VFS) *lockSystem {
+	return &lockSystem{locks: VFS.Locks()}
+}
+
+// translateLockError turns VFS errors into webdav lock errors
+func translateLockError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, vfs.EAGAIN):
+		return webdav.ErrLocked
+	case errors.Is(err, vfs.ENOENT):
+		return webdav.ErrNoSuchLock
+	}
+	return err
+}
+
+// details makes the webdav lock details for the lock
+func details(lock vfs.Lock, duration time.Duration) webdav.LockDetails {
+	return webdav.LockDetails{
+		Root:      "/" + lock.Path,
+		Duration:  duration,
+		OwnerXML:  lock.Owner,
+		ZeroDepth: !lock.Recursive,
+	}
+}
+
+// Confirm confirms that the caller holds the locks for name0 and
+// name1 given by the conditions.
+func (ls *lockSystem) Confirm(now time.Time, name0, name1 string, conditions ...webdav.Condition) (release func(), err error) {
+	held := map[string]struct{}{}
+	for _, condition := range conditions {
+		token, ok := strings.CutPrefix(condition.Token, tokenPrefix)
+		if condition.Not || !ok {
+			continue
+		}
+		if _, err := ls.locks.Get(token); err != nil {
+			return nil, webdav.ErrConfirmationFailed
+		}
+		held[token] = struct{}{}
+	}
+	for _, name := range []string{name0, name1} {
+		if name == "" {
+			continue
+		}
+		locks, err := ls.locks.Find(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, lock := range locks {
+			if _, ok := held[lock.Token]; !ok {
+				return nil, webdav.ErrConfirmationFailed
+			}
+		}
+	}
+	return func() {}, nil
+}
+
+// Create creates a lock returning its token
+func (ls *lockSystem) Create(now time.Time, details webdav.LockDetails) (token string, err error) {
+	// The handler takes a temporary infinite lock for the duration
+	// of requests without an If header. Rather than write these to
+	// the lock file just check nothing else has the resource locked.
+	if details.Duration < 0 && details.ZeroDepth && details.OwnerXML == "" {
+		locks, err := ls.locks.Find(details.Root)
+		if err != nil {
+			return "", err
+		}
+		if len(locks) != 0 {
+			return "", webdav.ErrLocked
+		}
+		return tempTokenPrefix + details.Root, nil
+	}
+	lock, err := ls.locks.Lock(details.Root, details.OwnerXML, true, !details.ZeroDepth, lockTTL(details.Duration))
+	if err != nil {
+		return "", translateLockError(err)
+	}
+	return tokenPrefix + lock.Token, nil
+}
+
+// lockTTL converts a webdav lock duration into a VFS lock ttl
+//
+// The VFS lock manager uses a ttl of 0 for locks it refreshes itself
+// so use the smallest duration instead.
+func lockTTL(duration time.Duration) time.Duration {
+	if duration == 0 {
+		return time.Second
+	}
+	return duration
+}
+
+// Refresh refreshes the lock with token
+func (ls *lockSystem) Refresh(now time.Time, token string, duration time.Duration) (webdav.LockDetails, error) {
+	token, ok := strings.CutPrefix(token, tokenPrefix)
+	if !ok {
+		return webdav.LockDetails{}, webdav.ErrNoSuchLock
+	}
+	lock, err := ls.locks.Refresh(token, lockTTL(duration))
+	if err != nil {
+		return webdav.LockDetails{}, translateLockError(err)
+	}
+	return details(lock, duration), nil
+}
+
+// Unlock unlocks the lock with token
+func (ls *lockSystem) Unlock(now time.Time, token string) error {
+	if strings.HasPrefix(token, tempTokenPrefix) {
+		return nil
+	}
+	token, ok := strings.CutPrefix(token, tokenPrefix)
+	if !ok {
+		return webdav.ErrNoSuchLock
+	}
+	return translateLockError(ls.locks.Unlock(token))
+}
@@ -0,0 +1,75 @@
+package webdav
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/vfs"
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/webdav"
+)
+
+func TestLockSystem(t *testing.T) {
+	f, err := fs.NewFs(context.Background(), t.TempDir())
+	require.NoError(t, err)
+	VFS := vfs.New(f, &vfscommon.Opt)
+	defer VFS.Shutdown()
+	ls := newLockSystem(VFS)
+	now := time.Now()
+
+	// Lock a directory
+	token, err := ls.Create(now, webdav.LockDetails{
+		Root:     "/dir",
+		Duration: time.Minute,
+		OwnerXML: "<owner>me</owner>",
+	})
+	require.NoError(t, err)
+	assert.Contains(t, token, tokenPrefix)
+
+	// The VFS lock manager sees it
+	assert.Equal(t, vfs.EAGAIN, VFS.Locks().CheckWrite("dir/file"))
+
+	// A second lock on a file inside fails
+	_, err = ls.Create(now, webdav.LockDetails{Root: "/dir/file", Duration: time.Minute, OwnerXML: "you", ZeroDepth: true})
+	assert.Equal(t, webdav.ErrLocked, err)
+
+	// Writing without the token fails
+	_, err = ls.Create(now, webdav.LockDetails{Root: "/dir/file", Duration: -1, ZeroDepth: true})
+	assert.Equal(t, webdav.ErrLocked, err)
+	_, err = ls.Confirm(now, "/dir/file", "")
+	assert.Equal(t, webdav.ErrConfirmationFailed, err)
+	_, err = ls.Confirm(now, "/dir/file", "", webdav.Condition{Token: tokenPrefix + "potato"})
+	assert.Equal(t, webdav.ErrConfirmationFailed, err)
+
+	// But works with it
+	release, err := ls.Confirm(now, "/dir/file", "/other", webdav.Condition{Token: token})
+	require.NoError(t, err)
+	release()
+
+	// Temporary locks elsewhere work and aren't stored
+	tempToken, err := ls.Create(now, webdav.LockDetails{Root: "/other", Duration: -1, ZeroDepth: true})
+	require.NoError(t, err)
+	assert.NoError(t, VFS.Locks().CheckWrite("other"))
+	assert.NoError(t, ls.Unlock(now, tempToken))
+
+	// Refresh
+	details, err := ls.Refresh(now, token, 2*time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, webdav.LockDetails{
+		Root:     "/dir",
+		Duration: 2 * time.Minute,
+		OwnerXML: "<owner>me</owner>",
+	}, details)
+	_, err = ls.Refresh(now, "potato", time.Minute)
+	assert.Equal(t, webdav.ErrNoSuchLock, err)
+
+	// Unlock
+	require.NoError(t, ls.Unlock(now, token))
+	assert.Equal(t, webdav.ErrNoSuchLock, ls.Unlock(now, token))
+	assert.NoError(t, VFS.Locks().CheckWrite("dir/file"))
+}
@@ -19,6 +19,7 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/rclone/rclone/cmd"
 	cmdserve "github.com/rclone/rclone/cmd/serve"
+	"github.com/rclone/rclone/cmd/serve/archive"
 	"github.com/rclone/rclone/cmd/serve/proxy"
 	"github.com/rclone/rclone/cmd/serve/proxy/proxyflags"
 	"github.com/rclone/rclone/fs"
@@ -48,13 +49,15 @@ var OptionsInfo = fs.Options{{
 }}.
 	Add(libhttp.ConfigInfo).
 	Add(libhttp.AuthConfigInfo).
-	Add(libhttp.TemplateConfigInfo)
+	Add(libhttp.TemplateConfigInfo).
+	Add(archive.OptionsInfo)
 
 // Options required for http server
 type Options struct {
 	Auth           libhttp.AuthConfig
 	HTTP           libhttp.Config
 	Template       libhttp.TemplateConfig
+	Archive        archive.Options
 	EtagHash       string `config:"etag_hash"`
 	DisableDirList bool   `config:"disable_dir_list"`
 }
@@ -156,7 +159,7 @@ and connect to it like this using rclone and the webdav backend:
 Note that there is no authentication on http protocol - this is expected to be
 done by the permissions on the socket.
 
-` + libhttp.Help(flagPrefix) + libhttp.TemplateHelp(flagPrefix) + libhttp.AuthHelp(flagPrefix) + vfs.Help() + proxy.Help,
+` + libhttp.Help(flagPrefix) + libhttp.TemplateHelp(flagPrefix) + archive.Help + libhttp.AuthHelp(flagPrefix) + vfs.Help() + proxy.Help,
 	Annotations: map[string]string{
 		"versionIntroduced": "v1.39",
 		"groups":            "Filter",
@@ -209,6 +212,9 @@ var _ webdav.FileSystem = (*WebDAV)(nil)
 
 // Make a new WebDAV to serve the remote
 func newWebDAV(ctx context.Context, f fs.Fs, opt *Options, vfsOpt *vfscommon.Options, proxyOpt *proxy.Options) (w *WebDAV, err error) {
+	if err := vfscommon.RefuseACL(vfsOpt); err != nil {
+		return nil, err
+	}
 	w = &WebDAV{
 		f:            f,
 		ctx:          ctx,
@@ -249,9 +255,11 @@ func newWebDAV(ctx context.Context, f fs.Fs, opt *Options, vfsOpt *vfscommon.Opt
 	webdavHandler := &webdav.Handler{
 		Prefix:     w.opt.HTTP.BaseURL,
 		FileSystem: w,
-		LockSystem: webdav.NewMemLS(),
 		Logger:     w.logRequest, // FIXME
 	}
+	if w._vfs != nil {
+		webdavHandler.LockSystem = newLockSystem(w._vfs)
+	}
 	w.webdavhandler = webdavHandler
 
 	router := w.server.Router()
@@ -362,8 +370,21 @@ func (w *WebDAV) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 	// Add URL Prefix back to path since webdavhandler needs to
 	// return absolute references.
 	r.URL.Path = w.opt.HTTP.BaseURL + r.URL.Path
+	webdavHandler := w.webdavhandler
+	if webdavHandler.LockSystem == nil {
+		// Use the locks of the VFS for this user
+		VFS, err := w.getVFS(r.Context())
+		if err != nil {
+			http.Error(rw, "Root directory not found", http.StatusNotFound)
+			fs.Errorf(nil, "Failed to find VFS: %v", err)
+			return
+		}
+		userHandler := *webdavHandler
+		userHandler.LockSystem = newLockSystem(VFS)
+		webdavHandler = &userHandler
+	}
 	wrw := &webdavRW{ResponseWriter: rw}
-	w.webdavhandler.ServeHTTP(wrw, r)
+	webdavHandler.ServeHTTP(wrw, r)
 
 	if wrw.isSuccessfull() {
 		w.postprocess(r, remote)
@@ -394,6 +415,10 @@ func (w *WebDAV) serveDir(rw http.ResponseWriter, r *http.Request, dirRemote str
 		return
 	}
 	dir := node.(*vfs.Dir)
+	if archive.Requested(r) {
+		archive.Serve(rw, r, &w.opt.Archive, dir)
+		return
+	}
 	dirEntries, err := dir.ReadDirAll()
 
 	if err != nil {
@@ -403,6 +428,7 @@ func (w *WebDAV) serveDir(rw http.ResponseWriter, r *http.Request, dirRemote str
 
 	// Make the entries for display
 	directory := serve.NewDirectory(dirRemote, w.server.HTMLTemplate())
+	directory.Archive = true
 	for _, node := range dirEntries {
 		if vfscommon.Opt.NoModTime {
 			directory.AddHTMLEntry(node.Path(), node.IsDir(), node.Size(), time.Time{})
@@ -291,6 +291,12 @@ func StatsGroup(ctx context.Context, group string) *StatsInfo {
 	return stats
 }
 
+// LookupStatsGroup gets stats by group name without making the group
+// if it doesn't exist, returning nil in that case.
+func LookupStatsGroup(group string) *StatsInfo {
+	return groups.get(group)
+}
+
 // GlobalStats returns special stats used for global accounting.
 func GlobalStats() *StatsInfo {
 	return StatsGroup(context.Background(), globalStats)
@@ -24,6 +24,14 @@ type ChunkedReader interface {
 	Open() (ChunkedReader, error)
 }
 
+// ChunkSizer is an optional interface for a ChunkedReader which
+// allows the chunk sizes to be adjusted while it is in use.
+//
+// The new sizes take effect from the next chunk opened.
+type ChunkSizer interface {
+	SetChunkSize(initialChunkSize int64, maxChunkSize int64)
+}
+
 // New returns a ChunkedReader for the Object.
 //
 // An initialChunkSize of <= 0 will disable chunked reading.
@@ -146,26 +146,29 @@ func (s *stream) close() (err error) {
 //
 // Mustn't be called for an unknown size object
 func newParallel(ctx context.Context, o fs.Object, chunkSize int64, streams int) ChunkedReader {
-	// Make sure chunkSize is a multiple of multipart.BufferSize
-	if chunkSize < 0 {
-		chunkSize = multipart.BufferSize
-	}
-	newChunkSize := multipart.BufferSize * (chunkSize / multipart.BufferSize)
-	if newChunkSize < chunkSize {
-		newChunkSize += multipart.BufferSize
-	}
-
 	fs.Debugf(o, "newParallel chunkSize=%d, streams=%d", chunkSize, streams)
 
 	return &parallel{
 		ctx:       ctx,
 		o:         o,
 		offset:    0,
-		chunkSize: newChunkSize,
+		chunkSize: roundChunkSize(chunkSize),
 		nstreams:  streams,
 	}
 }
 
+// Make sure chunkSize is a multiple of multipart.BufferSize
+func roundChunkSize(chunkSize int64) int64 {
+	if chunkSize <= 0 {
+		chunkSize = multipart.BufferSize
+	}
+	newChunkSize := multipart.BufferSize * (chunkSize / multipart.BufferSize)
+	if newChunkSize < chunkSize {
+		newChunkSize += multipart.BufferSize
+	}
+	return newChunkSize
+}
+
 // _open starts the file transferring at offset
 //
 // Call with the lock held
@@ -370,6 +373,19 @@ func (cr *parallel) RangeSeek(ctx context.Context, offset int64, whence int, len
 	return cr.Seek(offset, whence)
 }
 
+// SetChunkSize changes the size of the chunks read by streams started
+// from now on - for details see ChunkSizer
+//
+// In the parallel chunked reader the chunk size doesn't grow so
+// maxChunkSize is ignored.
+func (cr *parallel) SetChunkSize(initialChunkSize int64, maxChunkSize int64) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	cr.chunkSize = roundChunkSize(initialChunkSize)
+	fs.Debugf(cr.o, "parallel chunked reader: chunk size now %d", cr.chunkSize)
+}
+
 // Open forces the connection to be opened
 func (cr *parallel) Open() (ChunkedReader, error) {
 	cr.mu.Lock()
@@ -380,4 +396,5 @@ func (cr *parallel) Open() (ChunkedReader, error) {
 
 var (
 	_ ChunkedReader = (*parallel)(nil)
+	_ ChunkSizer    = (*parallel)(nil)
 )
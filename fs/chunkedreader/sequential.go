@@ -159,6 +159,32 @@ func (cr *sequential) RangeSeek(ctx context.Context, offset int64, whence int, l
 	return cr.chunkOffset, nil
 }
 
+// SetChunkSize changes the chunk sizes used for the next chunk opened
+// - for details see ChunkSizer
+//
+// An initialChunkSize of <= 0 will disable chunked reading.
+func (cr *sequential) SetChunkSize(initialChunkSize int64, maxChunkSize int64) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	if initialChunkSize <= 0 {
+		initialChunkSize = -1
+	}
+	if maxChunkSize != -1 && maxChunkSize < initialChunkSize {
+		maxChunkSize = initialChunkSize
+	}
+	fs.Debugf(cr.o, "ChunkedReader.SetChunkSize initial %d max %d", initialChunkSize, maxChunkSize)
+	cr.initialChunkSize = initialChunkSize
+	cr.maxChunkSize = maxChunkSize
+	// The chunk size of an open chunk can't be changed as it
+	// describes the range requested from the source. Otherwise
+	// the maximum will be applied when the chunk size is next
+	// doubled.
+	if cr.offset == -1 && !cr.customChunkSize {
+		cr.chunkSize = initialChunkSize
+	}
+}
+
 // Open forces the connection to be opened
 func (cr *sequential) Open() (ChunkedReader, error) {
 	cr.mu.Lock()
@@ -229,4 +255,5 @@ func (cr *sequential) resetReader(rc io.ReadCloser, offset int64) error {
 
 var (
 	_ ChunkedReader = (*sequential)(nil)
+	_ ChunkSizer    = (*sequential)(nil)
 )
@@ -1,10 +1,14 @@
 package chunkedreader
 
 import (
+	"context"
+	"io"
 	"testing"
 
 	_ "github.com/rclone/rclone/backend/local"
 	"github.com/rclone/rclone/fstest/mockobject"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSequential(t *testing.T) {
@@ -18,3 +22,37 @@ func TestSequential(t *testing.T) {
 func TestSequentialErrorAfterClose(t *testing.T) {
 	testErrorAfterClose(t, 0)
 }
+
+func TestSequentialSetChunkSize(t *testing.T) {
+	ctx := context.Background()
+	content := makeContent(t, 1024)
+	o := mockobject.New("test.bin").WithContent(content, mockobject.SeekModeNone)
+
+	cr := New(ctx, o, 16, -1, 0).(*sequential)
+	buf := make([]byte, 48)
+
+	// Read the first chunk and part of the second which has doubled in size
+	n, err := cr.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, content[:48], buf[:n])
+	assert.Equal(t, int64(32), cr.chunkSize)
+
+	// Limit the growth - the open chunk must stay the same
+	cr.SetChunkSize(8, 8)
+	assert.Equal(t, int64(32), cr.chunkSize)
+	n, err = cr.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, content[48:96], buf[:n])
+	assert.Equal(t, int64(8), cr.chunkSize)
+
+	// After a seek the new initial chunk size is used
+	_, err = cr.Seek(512, io.SeekStart)
+	require.NoError(t, err)
+	cr.SetChunkSize(4, 4)
+	assert.Equal(t, int64(4), cr.chunkSize)
+	n, err = cr.Read(buf[:10])
+	require.NoError(t, err)
+	assert.Equal(t, content[512:522], buf[:n])
+
+	require.NoError(t, cr.Close())
+}
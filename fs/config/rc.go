@@ -15,6 +15,9 @@ func init() {
 		Fn:           rcConfigPassword,
 		Title:        "Unlock the config file.",
 		AuthRequired: true,
+		Input: []rc.Param{
+			{Name: "config_password", Type: rc.ParamString, Required: true, Help: "password to unlock the config file"},
+		},
 		Help: `
 Unlocks the config file if it is locked.
 
@@ -68,6 +71,9 @@ func init() {
 		Fn:           rcGet,
 		Title:        "Get a remote in the config file.",
 		AuthRequired: true,
+		Input: []rc.Param{
+			{Name: "name", Type: rc.ParamString, Required: true, Help: "name of remote to get"},
+		},
 		Help: `
 Parameters:
 
@@ -93,6 +99,9 @@ func init() {
 		Fn:           rcListRemotes,
 		Title:        "Lists the remotes in the config file and defined in environment variables.",
 		AuthRequired: true,
+		Output: []rc.Param{
+			{Name: "remotes", Type: rc.ParamArray, Help: "the remote names"},
+		},
 		Help: `
 Returns
 - remotes - array of remote names
@@ -121,6 +130,9 @@ func init() {
 		Fn:           rcProviders,
 		Title:        "Shows how providers are configured in the config file.",
 		AuthRequired: true,
+		Output: []rc.Param{
+			{Name: "providers", Type: rc.ParamArray, Help: "the providers and their options"},
+		},
 		Help: `
 Returns a JSON object:
 - providers - array of objects
@@ -147,10 +159,16 @@ func init() {
 	for _, name := range []string{"create", "update", "password"} {
 		name := name
 		extraHelp := ""
+		input := []rc.Param{
+			{Name: "name", Type: rc.ParamString, Required: true, Help: "name of remote"},
+			{Name: "parameters", Type: rc.ParamObject, Required: true, Help: "a map of key value pairs"},
+		}
 		if name == "create" {
 			extraHelp = "- type - type of the new remote\n"
+			input = append(input, rc.Param{Name: "type", Type: rc.ParamString, Required: true, Help: "type of the new remote"})
 		}
 		if name == "create" || name == "update" {
+			input = append(input, rc.Param{Name: "opt", Type: rc.ParamObject, Help: "a dictionary of options to control the configuration"})
 			extraHelp += `- opt - a dictionary of options to control the configuration
     - obscure - declare passwords are plain and need obscuring
     - noObscure - declare passwords are already obscured and don't need obscuring
@@ -165,6 +183,7 @@ func init() {
 		rc.Add(rc.Call{
 			Path:         "config/" + name,
 			AuthRequired: true,
+			Input:        input,
 			Fn: func(ctx context.Context, in rc.Params) (rc.Params, error) {
 				return rcConfig(ctx, in, name)
 			},
@@ -240,6 +259,9 @@ func init() {
 		Fn:           rcDelete,
 		Title:        "Delete a remote in the config file.",
 		AuthRequired: true,
+		Input: []rc.Param{
+			{Name: "name", Type: rc.ParamString, Required: true, Help: "name of remote to delete"},
+		},
 		Help: `
 Parameters:
 
@@ -266,6 +288,9 @@ func init() {
 		Fn:           rcSetPath,
 		Title:        "Set the path of the config file",
 		AuthRequired: true,
+		Input: []rc.Param{
+			{Name: "path", Type: rc.ParamString, Required: true, Help: "path to the config file to use"},
+		},
 		Help: `
 Parameters:
 
@@ -286,8 +311,13 @@ func rcSetPath(ctx context.Context, in rc.Params) (out rc.Params, err error) {
 
 func init() {
 	rc.Add(rc.Call{
-		Path:         "config/paths",
-		Fn:           rcPaths,
+		Path: "config/paths",
+		Fn:   rcPaths,
+		Output: []rc.Param{
+			{Name: "config", Type: rc.ParamString, Help: "path to config file"},
+			{Name: "cache", Type: rc.ParamString, Help: "path to root of cache directory"},
+			{Name: "temp", Type: rc.ParamString, Help: "path to root of temporary directory"},
+		},
 		Title:        "Reads the config file path and other important paths.",
 		AuthRequired: true,
 		Help: `
@@ -187,6 +187,8 @@ func (h *OutputHandler) ResetOutput() {
 
 // AddOutput adds an additional logging destination of the type specified.
 func (h *OutputHandler) AddOutput(json bool, fn outputFn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
 	h.outputExtra = append(h.outputExtra, outputExtra{
 		json:   json,
 		output: fn,
@@ -319,10 +321,15 @@ func (h *OutputHandler) Handle(ctx context.Context, r slog.Record) (err error) {
 		buf     *bytes.Buffer
 	)
 
+	// Outputs may be added while logging
+	h.mu.Lock()
+	extra := h.outputExtra
+	h.mu.Unlock()
+
 	// Check whether we need to build Text or JSON logs or both
 	needJSON := h.format&logFormatJSON != 0
 	needText := !needJSON
-	for _, out := range h.outputExtra {
+	for _, out := range extra {
 		if out.json {
 			needJSON = true
 		} else {
@@ -365,7 +372,7 @@ func (h *OutputHandler) Handle(ctx context.Context, r slog.Record) (err error) {
 	}
 
 	// Log to any additional destinations required
-	for _, out := range h.outputExtra {
+	for _, out := range extra {
 		if out.json {
 			out.output(r.Level, bufJSON.String())
 		} else {
@@ -0,0 +1,398 @@
+// Package notify sends notifications to webhooks when commands and
+// rc jobs finish
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/rclone/rclone/fs/fshttp"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/fs/rc/jobs"
+	"github.com/rclone/rclone/lib/atexit"
+	"github.com/rclone/rclone/lib/pacer"
+	"github.com/rclone/rclone/lib/rest"
+)
+
+const (
+	minSleep      = 100 * time.Millisecond
+	maxSleep      = 10 * time.Second
+	decayConstant = 2
+	waitTimeout   = 30 * time.Second // longest to wait for notifications when rclone exits
+)
+
+// OptionsInfo describes the Options in use
+var OptionsInfo = fs.Options{{
+	Name:    "notify_url",
+	Default: []string{},
+	Help:    "URL to POST a notification to when a command or async rc job finishes",
+	Groups:  "Notify",
+}, {
+	Name:    "notify_on",
+	Default: notifyOnSuccess | notifyOnFailure,
+	Help:    "Comma separated list of when to notify: success,failure",
+	Groups:  "Notify",
+}, {
+	Name:    "notify_template",
+	Default: "",
+	Help:    "Go template for the notification body or @file to read it from, default the JSON payload",
+	Groups:  "Notify",
+}, {
+	Name:    "notify_content_type",
+	Default: "application/json",
+	Help:    "Content-Type of the notification body",
+	Groups:  "Notify",
+}, {
+	Name:    "notify_header",
+	Default: []string{},
+	Help:    "Set HTTP header for notifications, e.g. \"Authorization: Bearer XXX\"",
+	Groups:  "Notify",
+}, {
+	Name:    "notify_retries",
+	Default: 3,
+	Help:    "Number of times to try sending a notification",
+	Groups:  "Notify",
+}}
+
+// Options contains options for the notifications
+type Options struct {
+	URL         []string `config:"notify_url"`          // URLs to POST the notifications to
+	On          notifyOn `config:"notify_on"`           // when to send notifications
+	Template    string   `config:"notify_template"`     // template for the body
+	ContentType string   `config:"notify_content_type"` // Content-Type of the body
+	Header      []string `config:"notify_header"`       // extra HTTP headers
+	Retries     int      `config:"notify_retries"`      // number of tries
+}
+
+func init() {
+	fs.RegisterGlobalOptions(fs.OptionsInfo{Name: "notify", Opt: &Opt, Options: OptionsInfo})
+}
+
+// Opt is the options for the notifications
+var Opt Options
+
+// enum for when to notify
+type notifyOn = fs.Bits[notifyOnChoices]
+
+const (
+	notifyOnSuccess notifyOn = 1 << iota
+	notifyOnFailure
+)
+
+type notifyOnChoices struct{}
+
+func (notifyOnChoices) Choices() []fs.BitsChoicesInfo {
+	return []fs.BitsChoicesInfo{
+		{Bit: uint64(notifyOnSuccess), Name: "success"},
+		{Bit: uint64(notifyOnFailure), Name: "failure"},
+	}
+}
+
+// Payload is the notification sent when a command or rc job finishes.
+//
+// It is sent as JSON unless --notify-template is set in which case it
+// is the data for the template.
+type Payload struct {
+	Source    string    `json:"source"`          // "command" or "rc"
+	JobID     int64     `json:"jobid,omitempty"` // the rc job ID
+	Command   string    `json:"command"`         // the command name or rc call
+	Group     string    `json:"group,omitempty"` // the stats group of the rc job
+	Success   bool      `json:"success"`
+	Error     string    `json:"error,omitempty"`
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+	Duration  float64   `json:"duration"` // in seconds
+	Bytes     int64     `json:"bytes"`
+	Transfers int64     `json:"transfers"`
+	Checks    int64     `json:"checks"`
+	Deletes   int64     `json:"deletes"`
+	Errors    int64     `json:"errors"`
+	Summary   string    `json:"summary"` // the stats as printed by --stats
+	Hostname  string    `json:"hostname"`
+	Version   string    `json:"version"`
+}
+
+// newPayload makes a Payload filling in the stats from s
+func newPayload(s *accounting.StatsInfo, startTime, endTime time.Time, err error) *Payload {
+	p := &Payload{
+		Success:   err == nil,
+		StartTime: startTime,
+		EndTime:   endTime,
+		Duration:  endTime.Sub(startTime).Seconds(),
+		Bytes:     s.GetBytes(),
+		Transfers: s.GetTransfers(),
+		Checks:    s.GetChecks(),
+		Deletes:   s.GetDeletes(),
+		Errors:    s.GetErrors(),
+		Summary:   strings.TrimSpace(s.String()),
+		Version:   fs.Version,
+	}
+	if err != nil {
+		p.Error = err.Error()
+	}
+	p.Hostname, _ = os.Hostname()
+	return p
+}
+
+// wanted returns true if p should be sent
+func (opt *Options) wanted(p *Payload) bool {
+	if len(opt.URL) == 0 {
+		return false
+	}
+	if p.Success {
+		return opt.On&notifyOnSuccess != 0
+	}
+	return opt.On&notifyOnFailure != 0
+}
+
+// templateFuncs are the extra functions for --notify-template
+var templateFuncs = template.FuncMap{
+	// json encodes the value as JSON so it can be put in a JSON body
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// body makes the body of the notification for p
+func (opt *Options) body(p *Payload) ([]byte, error) {
+	if opt.Template == "" {
+		return json.Marshal(p)
+	}
+	text := opt.Template
+	if file, ok := strings.CutPrefix(text, "@"); ok {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read notify template: %w", err)
+		}
+		text = string(data)
+	}
+	tpl, err := template.New("notify").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse notify template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, p); err != nil {
+		return nil, fmt.Errorf("failed to run notify template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// headers parses the --notify-header values
+func (opt *Options) headers() (map[string]string, error) {
+	headers := make(map[string]string, len(opt.Header))
+	for _, header := range opt.Header {
+		key, value, ok := strings.Cut(header, ":")
+		if !ok {
+			return nil, fmt.Errorf("notify header %q should be in the form \"Name: Value\"", header)
+		}
+		headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
+
+// retryErrorCodes is a slice of error codes that we will retry
+var retryErrorCodes = []int{
+	429, // Too Many Requests.
+	500, // Internal Server Error
+	502, // Bad Gateway
+	503, // Service Unavailable
+	504, // Gateway Timeout
+}
+
+// shouldRetry returns a boolean as to whether this resp and err
+// deserve to be retried. It returns the err as a convenience
+func shouldRetry(ctx context.Context, resp *http.Response, err error) (bool, error) {
+	if fserrors.ContextError(ctx, &err) {
+		return false, err
+	}
+	return fserrors.ShouldRetry(err) || fserrors.ShouldRetryHTTP(resp, retryErrorCodes), err
+}
+
+// send p to all the URLs in opt
+func (opt *Options) send(ctx context.Context, p *Payload) error {
+	body, err := opt.body(p)
+	if err != nil {
+		return err
+	}
+	headers, err := opt.headers()
+	if err != nil {
+		return err
+	}
+	srv := rest.NewClient(fshttp.NewClient(ctx))
+	pace := pacer.New(
+		pacer.RetriesOption(max(opt.Retries, 1)),
+		pacer.CalculatorOption(pacer.NewDefault(pacer.MinSleep(minSleep), pacer.MaxSleep(maxSleep), pacer.DecayConstant(decayConstant))),
+	)
+	var errs []error
+	for _, url := range opt.URL {
+		err := pace.Call(func() (bool, error) {
+			resp, err := srv.Call(ctx, &rest.Opts{
+				Method:       "POST",
+				RootURL:      url,
+				Body:         bytes.NewReader(body),
+				ContentType:  opt.ContentType,
+				ExtraHeaders: headers,
+				GetBody: func() (io.ReadCloser, error) {
+					return io.NopCloser(bytes.NewReader(body)), nil
+				},
+				NoResponse: true,
+			})
+			return shouldRetry(ctx, resp, err)
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to notify %q: %w", url, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// notify sends p if the options say so, logging any errors
+func notify(ctx context.Context, p *Payload) {
+	opt := Opt
+	if !opt.wanted(p) {
+		return
+	}
+	fs.Debugf(nil, "Sending notification that %s %q finished", p.Source, p.Command)
+	if err := opt.send(ctx, p); err != nil {
+		fs.Errorf(nil, "Notify: %v", err)
+	}
+}
+
+// CommandFinished sends the notifications that the command name
+// which started at startTime has finished with err.
+//
+// It waits for the notifications to be sent.
+func CommandFinished(ctx context.Context, name string, startTime time.Time, err error) {
+	p := newPayload(accounting.GlobalStats(), startTime, time.Now(), err)
+	p.Source = "command"
+	p.Command = name
+	notify(ctx, p)
+}
+
+var (
+	wg         sync.WaitGroup // waits for notifications of rc jobs being sent
+	atexitOnce sync.Once
+)
+
+// wait for the notifications of rc jobs to be sent so they aren't
+// lost when rclone exits, giving up after waitTimeout
+func wait() {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(waitTimeout):
+		fs.Errorf(nil, "Notify: gave up waiting for notifications to be sent")
+	}
+}
+
+// jobEvent is called for every job event, sending notifications for
+// async jobs which finished.
+//
+// Synchronous rc calls, including those made with librclone's RPC,
+// aren't notified. Their caller gets the result in the response and
+// they include calls like core/stats which are polled, so notifying
+// them would flood the URLs. Use _async=true to get a notification.
+func jobEvent(event string, job *jobs.Job) {
+	if event != jobs.EventFinished || !job.Async() || len(Opt.URL) == 0 {
+		return
+	}
+	status := job.Status()
+	group, _ := status["group"].(string)
+	startTime, _ := status["startTime"].(time.Time)
+	endTime, _ := status["endTime"].(time.Time)
+	var err error
+	if errString, _ := status["error"].(string); errString != "" {
+		err = errors.New(errString)
+	}
+	ctx := context.Background()
+	p := newPayload(accounting.StatsGroup(ctx, group), startTime, endTime, err)
+	p.Source = "rc"
+	p.JobID = job.ID
+	p.Command = job.Path()
+	p.Group = group
+	// The listener mustn't block so send in the background
+	atexitOnce.Do(func() {
+		atexit.Register(wait)
+	})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		notify(ctx, p)
+	}()
+}
+
+func init() {
+	jobs.OnEvent(jobEvent)
+}
+
+func init() {
+	rc.Add(rc.Call{
+		Path:         "notify/test",
+		AuthRequired: true,
+		Fn:           rcTest,
+		Title:        "Send a test notification",
+		Input: []rc.Param{
+			{Name: "url", Type: rc.ParamString, Help: "URL to send the notification to, default --notify-url"},
+			{Name: "success", Type: rc.ParamBoolean, Help: "set to false to send a failure notification"},
+		},
+		Help: `This sends a test notification to check the notify options are
+working, whether or not --notify-on would send it.
+
+Parameters:
+
+- url - URL to send the notification to (optional, default --notify-url)
+- success - set to false to send a failure notification (optional, default true)
+
+The other options, like the template, are those set by the --notify-*
+flags or with options/set. An error is returned if the notification
+couldn't be sent.
+`,
+	})
+}
+
+// Send a test notification
+func rcTest(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	opt := Opt
+	url, err := in.GetString("url")
+	if err == nil {
+		opt.URL = []string{url}
+	} else if rc.NotErrParamNotFound(err) {
+		return nil, err
+	}
+	if len(opt.URL) == 0 {
+		return nil, rc.NewErrParamInvalid(errors.New("no url passed in and --notify-url isn't set"))
+	}
+	success, err := in.GetBool("success")
+	if rc.IsErrParamNotFound(err) {
+		success = true
+	} else if err != nil {
+		return nil, err
+	}
+	var testErr error
+	if !success {
+		testErr = errors.New("test failure")
+	}
+	now := time.Now()
+	p := newPayload(accounting.Stats(ctx), now, now, testErr)
+	p.Source = "rc"
+	p.Command = "notify/test"
+	return nil, opt.send(ctx, p)
+}
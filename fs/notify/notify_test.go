@@ -0,0 +1,261 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/fs/rc/jobs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testServer records the requests made to it, returning the
+// statuses in turn then 200
+type testServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	bodies   []string
+	headers  []http.Header
+}
+
+func newTestServer(t *testing.T, statuses ...int) *testServer {
+	ts := &testServer{statuses: statuses}
+	ts.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, "POST", r.Method)
+		ts.mu.Lock()
+		ts.bodies = append(ts.bodies, string(body))
+		ts.headers = append(ts.headers, r.Header)
+		status := http.StatusOK
+		if len(ts.statuses) > 0 {
+			status, ts.statuses = ts.statuses[0], ts.statuses[1:]
+		}
+		ts.mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// requests returns the bodies of the requests so far
+func (ts *testServer) requests() []string {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return append([]string(nil), ts.bodies...)
+}
+
+// setOpt sets the global options for the test
+func setOpt(t *testing.T, opt Options) {
+	oldOpt := Opt
+	Opt = opt
+	t.Cleanup(func() {
+		wg.Wait()
+		Opt = oldOpt
+	})
+}
+
+func testPayload(err error) *Payload {
+	startTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	p := newPayload(accounting.NewStatsGroup(context.Background(), "notify-test"), startTime, startTime.Add(2*time.Second), err)
+	p.Source = "command"
+	p.Command = "sync"
+	return p
+}
+
+func TestBody(t *testing.T) {
+	p := testPayload(errors.New("potato failed"))
+
+	opt := Options{}
+	body, err := opt.body(p)
+	require.NoError(t, err)
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(body, &got))
+	assert.Equal(t, "sync", got["command"])
+	assert.Equal(t, false, got["success"])
+	assert.Equal(t, "potato failed", got["error"])
+	assert.Equal(t, 2.0, got["duration"])
+	assert.Equal(t, 0.0, got["bytes"])
+	assert.NotContains(t, got, "jobid")
+
+	opt.Template = `{"text": {{json (printf "%s: %s" .Command .Error)}}}`
+	body, err = opt.body(p)
+	require.NoError(t, err)
+	assert.Equal(t, `{"text": "sync: potato failed"}`, string(body))
+
+	file := filepath.Join(t.TempDir(), "template")
+	require.NoError(t, os.WriteFile(file, []byte(`{{.Command}} {{.Success}}`), 0666))
+	opt.Template = "@" + file
+	body, err = opt.body(p)
+	require.NoError(t, err)
+	assert.Equal(t, `sync false`, string(body))
+
+	opt.Template = "{{.Potato"
+	_, err = opt.body(p)
+	assert.ErrorContains(t, err, "failed to parse notify template")
+
+	opt.Template = "{{.Potato}}"
+	_, err = opt.body(p)
+	assert.ErrorContains(t, err, "failed to run notify template")
+
+	opt.Template = "@" + file + "-notfound"
+	_, err = opt.body(p)
+	assert.ErrorContains(t, err, "failed to read notify template")
+}
+
+func TestHeaders(t *testing.T) {
+	opt := Options{Header: []string{"Authorization: Bearer XXX", "X-Empty:"}}
+	headers, err := opt.headers()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"Authorization": "Bearer XXX", "X-Empty": ""}, headers)
+
+	opt.Header = []string{"potato"}
+	_, err = opt.headers()
+	assert.ErrorContains(t, err, `notify header "potato"`)
+}
+
+func TestWanted(t *testing.T) {
+	ok := testPayload(nil)
+	failed := testPayload(errors.New("failed"))
+	opt := Options{On: notifyOnSuccess | notifyOnFailure}
+	assert.False(t, opt.wanted(ok))
+	opt.URL = []string{"http://example.com/"}
+	assert.True(t, opt.wanted(ok))
+	assert.True(t, opt.wanted(failed))
+	opt.On = notifyOnFailure
+	assert.False(t, opt.wanted(ok))
+	assert.True(t, opt.wanted(failed))
+	opt.On = notifyOnSuccess
+	assert.True(t, opt.wanted(ok))
+	assert.False(t, opt.wanted(failed))
+}
+
+func TestSend(t *testing.T) {
+	ctx := context.Background()
+	p := testPayload(nil)
+
+	ts := newTestServer(t, http.StatusInternalServerError)
+	opt := Options{
+		URL:         []string{ts.URL},
+		ContentType: "text/plain",
+		Header:      []string{"X-Potato: Jersey"},
+		Template:    "{{.Command}}",
+		Retries:     3,
+	}
+	require.NoError(t, opt.send(ctx, p))
+	assert.Equal(t, []string{"sync", "sync"}, ts.requests())
+	assert.Equal(t, "text/plain", ts.headers[1].Get("Content-Type"))
+	assert.Equal(t, "Jersey", ts.headers[1].Get("X-Potato"))
+
+	// errors which can't be retried are returned straight away
+	ts = newTestServer(t, http.StatusBadRequest)
+	opt.URL = []string{ts.URL}
+	err := opt.send(ctx, p)
+	assert.ErrorContains(t, err, "failed to notify")
+	assert.Len(t, ts.requests(), 1)
+
+	// give up after the retries
+	ts = newTestServer(t, http.StatusBadGateway, http.StatusBadGateway)
+	opt.URL = []string{ts.URL}
+	opt.Retries = 2
+	err = opt.send(ctx, p)
+	assert.ErrorContains(t, err, "502")
+	assert.Len(t, ts.requests(), 2)
+}
+
+func TestCommandFinished(t *testing.T) {
+	ts := newTestServer(t)
+	setOpt(t, Options{URL: []string{ts.URL}, On: notifyOnFailure, Retries: 1})
+
+	CommandFinished(context.Background(), "copy", time.Now(), nil)
+	assert.Len(t, ts.requests(), 0)
+
+	CommandFinished(context.Background(), "copy", time.Now(), errors.New("copy failed"))
+	requests := ts.requests()
+	require.Len(t, requests, 1)
+	var p Payload
+	require.NoError(t, json.Unmarshal([]byte(requests[0]), &p))
+	assert.Equal(t, "command", p.Source)
+	assert.Equal(t, "copy", p.Command)
+	assert.Equal(t, "copy failed", p.Error)
+	assert.False(t, p.Success)
+}
+
+func TestJobFinished(t *testing.T) {
+	ts := newTestServer(t)
+	setOpt(t, Options{URL: []string{ts.URL}, On: notifyOnSuccess | notifyOnFailure, Retries: 1})
+	ctx := jobs.WithPath(context.Background(), "test/notify")
+	fn := func(ctx context.Context, in rc.Params) (rc.Params, error) {
+		accounting.Stats(ctx).Bytes(42)
+		return nil, errors.New("job failed")
+	}
+
+	// jobs which aren't async don't notify
+	_, _, err := jobs.NewJob(ctx, fn, rc.Params{})
+	require.Error(t, err)
+	wg.Wait()
+	assert.Len(t, ts.requests(), 0)
+
+	job, _, err := jobs.NewJob(ctx, fn, rc.Params{"_async": true})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		wg.Wait()
+		return len(ts.requests()) == 1
+	}, 10*time.Second, 10*time.Millisecond)
+	var p Payload
+	require.NoError(t, json.Unmarshal([]byte(ts.requests()[0]), &p))
+	assert.Equal(t, "rc", p.Source)
+	assert.Equal(t, job.ID, p.JobID)
+	assert.Equal(t, "test/notify", p.Command)
+	assert.Equal(t, job.Group, p.Group)
+	assert.Equal(t, "job failed", p.Error)
+	assert.Equal(t, int64(42), p.Bytes)
+}
+
+func TestWait(t *testing.T) {
+	var sent atomic.Bool
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		time.Sleep(100 * time.Millisecond)
+		sent.Store(true)
+	}()
+	wait()
+	assert.True(t, sent.Load())
+}
+
+func TestRcTest(t *testing.T) {
+	ts := newTestServer(t)
+	setOpt(t, Options{ContentType: "application/json", Retries: 1})
+	call := rc.Calls.Get("notify/test")
+	require.NotNil(t, call)
+
+	_, err := call.Fn(context.Background(), rc.Params{})
+	assert.True(t, rc.IsErrParamInvalid(err))
+
+	_, err = call.Fn(context.Background(), rc.Params{"url": ts.URL, "success": false})
+	require.NoError(t, err)
+	requests := ts.requests()
+	require.Len(t, requests, 1)
+	var p Payload
+	require.NoError(t, json.Unmarshal([]byte(requests[0]), &p))
+	assert.Equal(t, "notify/test", p.Command)
+	assert.Equal(t, "test failure", p.Error)
+
+	ts = newTestServer(t, http.StatusForbidden)
+	_, err = call.Fn(context.Background(), rc.Params{"url": ts.URL})
+	assert.ErrorContains(t, err, "403")
+}
@@ -19,12 +19,23 @@ import (
 	"github.com/rclone/rclone/lib/diskusage"
 )
 
+// Parameters used by many of the calls
+var (
+	fsParam      = rc.Param{Name: "fs", Type: rc.ParamFs, Required: true, Help: `a remote name string e.g. "drive:"`}
+	remoteParam  = rc.Param{Name: "remote", Type: rc.ParamString, Required: true, Help: `a path within that remote e.g. "dir"`}
+	listOptParam = rc.Param{Name: "opt", Type: rc.ParamObject, Help: "a dictionary of options to control the listing"}
+)
+
 func init() {
 	rc.Add(rc.Call{
 		Path:         "operations/list",
 		AuthRequired: true,
 		Fn:           rcList,
-		Title:        "List the given remote and path in JSON format",
+		Input:        []rc.Param{fsParam, remoteParam, listOptParam},
+		Output: []rc.Param{
+			{Name: "list", Type: rc.ParamArray, Help: "the objects as described in the lsjson command"},
+		},
+		Title: "List the given remote and path in JSON format",
 		Help: `This takes the following parameters:
 
 - fs - a remote name string e.g. "drive:"
@@ -80,7 +91,11 @@ func init() {
 		Path:         "operations/stat",
 		AuthRequired: true,
 		Fn:           rcStat,
-		Title:        "Give information about the supplied file or directory",
+		Input:        []rc.Param{fsParam, remoteParam, listOptParam},
+		Output: []rc.Param{
+			{Name: "item", Type: rc.ParamObject, Help: "an object as described in the lsjson command, null if not found"},
+		},
+		Title: "Give information about the supplied file or directory",
 		Help: `This takes the following parameters
 
 - fs - a remote name string eg "drive:"
@@ -125,6 +140,7 @@ func init() {
 		Path:         "operations/about",
 		AuthRequired: true,
 		Fn:           rcAbout,
+		Input:        []rc.Param{fsParam},
 		Title:        "Return the space used on the remote",
 		Help: `This takes the following parameters:
 
@@ -168,6 +184,12 @@ func init() {
 		rc.Add(rc.Call{
 			Path:         "operations/" + strings.ToLower(name) + "file",
 			AuthRequired: true,
+			Input: []rc.Param{
+				{Name: "srcFs", Type: rc.ParamFs, Required: true, Help: "the source remote"},
+				{Name: "srcRemote", Type: rc.ParamString, Required: true, Help: "the path of the file within the source remote"},
+				{Name: "dstFs", Type: rc.ParamFs, Required: true, Help: "the destination remote"},
+				{Name: "dstRemote", Type: rc.ParamString, Required: true, Help: "the path of the file within the destination remote"},
+			},
 			Fn: func(ctx context.Context, in rc.Params) (rc.Params, error) {
 				return rcMoveOrCopyFile(ctx, in, copy)
 			},
@@ -203,28 +225,44 @@ func init() {
 		help         string
 		noRemote     bool
 		needsRequest bool
+		input        []rc.Param // parameters other than fs and remote
 	}{
 		{name: "mkdir", title: "Make a destination directory or container"},
 		{name: "rmdir", title: "Remove an empty directory or container"},
 		{name: "purge", title: "Remove a directory or container and all of its contents"},
-		{name: "rmdirs", title: "Remove all the empty directories in the path", help: "- leaveRoot - boolean, set to true not to delete the root\n"},
+		{name: "rmdirs", title: "Remove all the empty directories in the path", help: "- leaveRoot - boolean, set to true not to delete the root\n", input: []rc.Param{
+			{Name: "leaveRoot", Type: rc.ParamBoolean, Help: "set to true not to delete the root"},
+		}},
 		{name: "delete", title: "Remove files in the path", noRemote: true},
 		{name: "deletefile", title: "Remove the single file pointed to"},
-		{name: "copyurl", title: "Copy the URL to the object", help: "- url - string, URL to read from\n - autoFilename - boolean, set to true to retrieve destination file name from url\n"},
+		{name: "copyurl", title: "Copy the URL to the object", help: "- url - string, URL to read from\n - autoFilename - boolean, set to true to retrieve destination file name from url\n", input: []rc.Param{
+			{Name: "url", Type: rc.ParamString, Required: true, Help: "URL to read from"},
+			{Name: "autoFilename", Type: rc.ParamBoolean, Help: "set to true to retrieve destination file name from url"},
+			{Name: "noClobber", Type: rc.ParamBoolean, Help: "set to true not to overwrite an existing file"},
+			{Name: "headerFilename", Type: rc.ParamBoolean, Help: "set to true to get the file name from the Content-Disposition header"},
+		}},
 		{name: "uploadfile", title: "Upload file using multiform/form-data", help: "- each part in body represents a file to be uploaded\n", needsRequest: true},
 		{name: "cleanup", title: "Remove trashed files in the remote or path", noRemote: true},
-		{name: "settier", title: "Changes storage tier or class on all files in the path", noRemote: true},
-		{name: "settierfile", title: "Changes storage tier or class on the single file pointed to"},
+		{name: "settier", title: "Changes storage tier or class on all files in the path", noRemote: true, input: []rc.Param{
+			{Name: "tier", Type: rc.ParamString, Required: true, Help: "the storage tier or class to set"},
+		}},
+		{name: "settierfile", title: "Changes storage tier or class on the single file pointed to", input: []rc.Param{
+			{Name: "tier", Type: rc.ParamString, Required: true, Help: "the storage tier or class to set"},
+		}},
 	} {
 		op := op
 		remote := "- remote - a path within that remote e.g. \"dir\"\n"
+		input := []rc.Param{fsParam, remoteParam}
 		if op.noRemote {
 			remote = ""
+			input = input[:1]
 		}
+		input = append(input, op.input...)
 		rc.Add(rc.Call{
 			Path:         "operations/" + op.name,
 			AuthRequired: true,
 			NeedsRequest: op.needsRequest,
+			Input:        input,
 			Fn: func(ctx context.Context, in rc.Params) (rc.Params, error) {
 				return rcSingleCommand(ctx, in, op.name, op.noRemote)
 			},
@@ -352,7 +390,13 @@ func init() {
 		Path:         "operations/size",
 		AuthRequired: true,
 		Fn:           rcSize,
-		Title:        "Count the number of bytes and files in remote",
+		Input:        []rc.Param{fsParam},
+		Output: []rc.Param{
+			{Name: "count", Type: rc.ParamInteger, Help: "number of files"},
+			{Name: "bytes", Type: rc.ParamInteger, Help: "number of bytes in those files"},
+			{Name: "sizeless", Type: rc.ParamInteger, Help: "number of files with unknown size"},
+		},
+		Title: "Count the number of bytes and files in remote",
 		Help: `This takes the following parameters:
 
 - fs - a remote name string e.g. "drive:path/to/dir"
@@ -389,7 +433,16 @@ func init() {
 		Path:         "operations/publiclink",
 		AuthRequired: true,
 		Fn:           rcPublicLink,
-		Title:        "Create or retrieve a public link to the given file or folder.",
+		Input: []rc.Param{
+			fsParam,
+			remoteParam,
+			{Name: "unlink", Type: rc.ParamBoolean, Help: "if set removes the link rather than adding it"},
+			{Name: "expire", Type: rc.ParamString, Help: `the expiry time of the link e.g. "1d"`},
+		},
+		Output: []rc.Param{
+			{Name: "url", Type: rc.ParamString, Help: "URL of the resource"},
+		},
+		Title: "Create or retrieve a public link to the given file or folder.",
 		Help: `This takes the following parameters:
 
 - fs - a remote name string e.g. "drive:"
@@ -432,6 +485,7 @@ func init() {
 	rc.Add(rc.Call{
 		Path:  "operations/fsinfo",
 		Fn:    rcFsInfo,
+		Input: []rc.Param{fsParam},
 		Title: "Return information about the remote",
 		Help: `This takes the following parameters:
 
@@ -702,7 +756,33 @@ func init() {
 		Path:         "operations/check",
 		AuthRequired: true,
 		Fn:           rcCheck,
-		Title:        "check the source and destination are the same",
+		Input: []rc.Param{
+			{Name: "srcFs", Type: rc.ParamFs, Help: "the source remote, not used with checkFileHash"},
+			{Name: "dstFs", Type: rc.ParamFs, Required: true, Help: "the destination remote"},
+			{Name: "download", Type: rc.ParamBoolean, Help: "check by downloading rather than with hash"},
+			{Name: "checkFileHash", Type: rc.ParamString, Help: "treat checkFileFs:checkFileRemote as a SUM file with hashes of this type"},
+			{Name: "checkFileFs", Type: rc.ParamFs, Help: "the remote of the SUM file"},
+			{Name: "checkFileRemote", Type: rc.ParamString, Help: "the path of the SUM file"},
+			{Name: "oneWay", Type: rc.ParamBoolean, Help: "check one way only, source files must exist on remote"},
+			{Name: "combined", Type: rc.ParamBoolean, Help: "make a combined report of changes"},
+			{Name: "missingOnSrc", Type: rc.ParamBoolean, Help: "report all files missing from the source"},
+			{Name: "missingOnDst", Type: rc.ParamBoolean, Help: "report all files missing from the destination"},
+			{Name: "match", Type: rc.ParamBoolean, Help: "report all matching files"},
+			{Name: "differ", Type: rc.ParamBoolean, Help: "report all non-matching files"},
+			{Name: "error", Type: rc.ParamBoolean, Help: "report all files with errors"},
+		},
+		Output: []rc.Param{
+			{Name: "success", Type: rc.ParamBoolean, Help: "true if no error, false otherwise"},
+			{Name: "status", Type: rc.ParamString, Help: "textual summary of check, OK or text string"},
+			{Name: "hashType", Type: rc.ParamString, Help: "hash used in check, may be missing"},
+			{Name: "combined", Type: rc.ParamArray, Help: "combined report of changes"},
+			{Name: "missingOnSrc", Type: rc.ParamArray, Help: "files missing from the source"},
+			{Name: "missingOnDst", Type: rc.ParamArray, Help: "files missing from the destination"},
+			{Name: "match", Type: rc.ParamArray, Help: "matching files"},
+			{Name: "differ", Type: rc.ParamArray, Help: "non-matching files"},
+			{Name: "error", Type: rc.ParamArray, Help: "files with errors"},
+		},
+		Title: "check the source and destination are the same",
 		Help: `Checks the files in the source and destination match.  It compares
 sizes and hashes and logs a report of files that don't
 match.  It doesn't alter the source or destination.
@@ -877,7 +957,17 @@ func init() {
 		Path:         "operations/hashsum",
 		AuthRequired: true,
 		Fn:           rcHashsum,
-		Title:        "Produces a hashsum file for all the objects in the path.",
+		Input: []rc.Param{
+			{Name: "fs", Type: rc.ParamFs, Required: true, Help: "the remote to hash, this can point to a file"},
+			{Name: "hashType", Type: rc.ParamString, Required: true, Help: "type of hash to be used"},
+			{Name: "download", Type: rc.ParamBoolean, Help: "check by downloading rather than with hash"},
+			{Name: "base64", Type: rc.ParamBoolean, Help: "output the hashes in base64 rather than hex"},
+		},
+		Output: []rc.Param{
+			{Name: "hashsum", Type: rc.ParamArray, Help: "the hashes"},
+			{Name: "hashType", Type: rc.ParamString, Help: "type of hash used"},
+		},
+		Title: "Produces a hashsum file for all the objects in the path.",
 		Help: `Produces a hash file for all the objects in the path using the hash
 named.  The output is in the same format as the standard
 md5sum/sha1sum tool.
@@ -0,0 +1,296 @@
+// Package events sends stats, job and log events to subscribers.
+//
+// It is used by the rc server to stream events from /events and by
+// librclone to call back into its caller.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/log"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/fs/rc/jobs"
+)
+
+// The types of event
+const (
+	Stats   = "stats"   // core/stats at each interval
+	Job     = "job"     // a job was queued, started or finished
+	Log     = "log"     // a log record
+	Dropped = "dropped" // events were dropped as the subscriber was too slow
+)
+
+const (
+	bufferSize      = 1024        // events buffered for each subscriber
+	defaultInterval = time.Second // default interval for stats
+
+	// MinInterval is the shortest interval stats can be sent at
+	MinInterval = 100 * time.Millisecond
+	// PingInterval is how often Stream calls ping
+	PingInterval = 30 * time.Second
+)
+
+// Event is sent to the subscribers
+type Event struct {
+	Type  string    `json:"type"`
+	Time  time.Time `json:"time"`
+	Group string    `json:"group,omitempty"`
+	Data  any       `json:"data"`
+
+	object string // the object a log is about, if any
+}
+
+// Options are the filters a subscriber asked for
+type Options struct {
+	Types    map[string]bool // types of events to send
+	Group    string          // only send events for this group if set
+	Level    slog.Level      // minimum level of log to send
+	Interval time.Duration   // how often to send stats
+}
+
+// ParseOptions reads the Options from in which may have
+//
+//   - types - comma separated event types to send: "stats", "job" and "log" (default all)
+//   - group - only send events for this stats group
+//   - level - minimum level of log records to send (default INFO)
+//   - interval - how often to send stats (default 1s)
+func ParseOptions(in rc.Params) (opt Options, err error) {
+	opt.Types = map[string]bool{}
+	types, err := in.GetString("types")
+	if rc.NotErrParamNotFound(err) {
+		return opt, err
+	}
+	if types == "" {
+		types = strings.Join([]string{Stats, Job, Log}, ",")
+	}
+	for _, eventType := range strings.Split(types, ",") {
+		switch eventType = strings.TrimSpace(eventType); eventType {
+		case Stats, Job, Log:
+			opt.Types[eventType] = true
+		case "":
+		default:
+			return opt, rc.NewErrParamInvalid(fmt.Errorf("unknown event type %q", eventType))
+		}
+	}
+	opt.Group, err = in.GetString("group")
+	if rc.NotErrParamNotFound(err) {
+		return opt, err
+	}
+	level := fs.LogLevelInfo
+	if s, err := in.GetString("level"); err == nil && s != "" {
+		if err := level.Set(s); err != nil {
+			return opt, rc.NewErrParamInvalid(fmt.Errorf("bad level: %w", err))
+		}
+	} else if rc.NotErrParamNotFound(err) {
+		return opt, err
+	}
+	opt.Level = fs.LogLevelToSlog(level)
+	opt.Interval = defaultInterval
+	interval, err := in.GetDuration("interval")
+	if err == nil {
+		opt.Interval = max(interval, MinInterval)
+	} else if rc.NotErrParamNotFound(err) {
+		return opt, err
+	}
+	return opt, nil
+}
+
+// Subscriber receives the events it asked for
+type Subscriber struct {
+	opt     Options
+	events  chan Event
+	dropped atomic.Int64
+}
+
+// send the event to the subscriber without blocking, dropping it if
+// the subscriber isn't keeping up
+func (s *Subscriber) send(ev Event) {
+	select {
+	case s.events <- ev:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// hub sends the job and log events to the subscribers
+type hub struct {
+	mu          sync.Mutex
+	subscribers map[*Subscriber]struct{}
+	startOnce   sync.Once
+}
+
+// The hub all the subscribers are on
+var defaultHub = &hub{
+	subscribers: map[*Subscriber]struct{}{},
+}
+
+// Subscribe to the events selected by opt returning the subscriber
+// and a function to unsubscribe it.
+//
+// Call Stream to receive the events.
+func Subscribe(opt Options) (*Subscriber, func()) {
+	return defaultHub.subscribe(opt)
+}
+
+// subscribe a new subscriber with opt returning it and a function to
+// unsubscribe it
+func (h *hub) subscribe(opt Options) (*Subscriber, func()) {
+	h.startOnce.Do(func() {
+		jobs.OnEvent(h.jobEvent)
+		log.Handler.AddOutput(true, h.logEvent)
+	})
+	s := &Subscriber{
+		opt:    opt,
+		events: make(chan Event, bufferSize),
+	}
+	h.mu.Lock()
+	h.subscribers[s] = struct{}{}
+	h.mu.Unlock()
+	return s, func() {
+		h.mu.Lock()
+		delete(h.subscribers, s)
+		h.mu.Unlock()
+	}
+}
+
+// broadcast ev to the subscribers which want it
+func (h *hub) broadcast(ev Event, want func(s *Subscriber) bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subscribers {
+		if !s.opt.Types[ev.Type] || !want(s) {
+			continue
+		}
+		s.send(ev)
+	}
+}
+
+// jobEvent is called by the jobs package for each job event
+func (h *hub) jobEvent(what string, job *jobs.Job) {
+	data := job.Status()
+	data["event"] = what
+	group, _ := data["group"].(string)
+	h.broadcast(Event{
+		Type:  Job,
+		Time:  time.Now(),
+		Group: group,
+		Data:  data,
+	}, func(s *Subscriber) bool {
+		return s.opt.Group == "" || s.opt.Group == group
+	})
+}
+
+// logEvent is called by the log handler with each log record in JSON.
+//
+// This is called with the log handler locked so mustn't log.
+func (h *hub) logEvent(level slog.Level, text string) {
+	var data map[string]any
+	if err := json.Unmarshal([]byte(text), &data); err != nil {
+		data = map[string]any{"msg": strings.TrimSpace(text)}
+	}
+	object, _ := data["object"].(string)
+	h.broadcast(Event{
+		Type:   Log,
+		Time:   time.Now(),
+		Data:   data,
+		object: object,
+	}, func(s *Subscriber) bool {
+		return level >= s.opt.Level
+	})
+}
+
+// inGroup returns a function to check whether an object belongs to
+// the group. Logs aren't tagged with their group so this checks the
+// object is one the group has transferred or checked recently.
+func inGroup(ctx context.Context, group string) func(object string) bool {
+	var (
+		names   map[string]struct{}
+		updated time.Time
+	)
+	return func(object string) bool {
+		if object == "" {
+			return false
+		}
+		if time.Since(updated) > MinInterval {
+			names = map[string]struct{}{}
+			for _, tr := range accounting.StatsGroup(ctx, group).Transferred() {
+				names[tr.Name] = struct{}{}
+			}
+			updated = time.Now()
+		}
+		_, found := names[object]
+		return found
+	}
+}
+
+// Stream the events for the subscriber to send until ctx is cancelled
+// or send returns an error.
+//
+// If events were dropped because send didn't keep up then a Dropped
+// event with their count is sent before the next event.
+//
+// ping is called every PingInterval if set to keep the connection
+// alive.
+func (s *Subscriber) Stream(ctx context.Context, send func(ev Event) error, ping func() error) error {
+	var statsTick <-chan time.Time
+	if s.opt.Types[Stats] {
+		ticker := time.NewTicker(s.opt.Interval)
+		defer ticker.Stop()
+		statsTick = ticker.C
+	}
+	var pingTick <-chan time.Time
+	if ping != nil {
+		ticker := time.NewTicker(PingInterval)
+		defer ticker.Stop()
+		pingTick = ticker.C
+	}
+	var matchGroup func(object string) bool
+	if s.opt.Group != "" {
+		matchGroup = inGroup(ctx, s.opt.Group)
+	}
+	statsCall := rc.Calls.Get("core/stats")
+	for {
+		var ev Event
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-pingTick:
+			if err := ping(); err != nil {
+				return err
+			}
+			continue
+		case <-statsTick:
+			in := rc.Params{}
+			if s.opt.Group != "" {
+				in["group"] = s.opt.Group
+			}
+			stats, err := statsCall.Fn(ctx, in)
+			if err != nil {
+				return err
+			}
+			ev = Event{Type: Stats, Time: time.Now(), Group: s.opt.Group, Data: stats}
+		case ev = <-s.events:
+			if ev.Type == Log && matchGroup != nil && !matchGroup(ev.object) {
+				continue
+			}
+		}
+		if n := s.dropped.Swap(0); n > 0 {
+			err := send(Event{Type: Dropped, Time: time.Now(), Data: rc.Params{"count": n}})
+			if err != nil {
+				return err
+			}
+		}
+		if err := send(ev); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/fs/rc/jobs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOptions(t *testing.T) {
+	opt, err := ParseOptions(rc.Params{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"stats": true, "job": true, "log": true}, opt.Types)
+	assert.Equal(t, fs.LogLevelToSlog(fs.LogLevelInfo), opt.Level)
+	assert.Equal(t, time.Second, opt.Interval)
+
+	opt, err = ParseOptions(rc.Params{
+		"types":    "job, log",
+		"group":    "mygroup",
+		"level":    "error",
+		"interval": "1ms",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"job": true, "log": true}, opt.Types)
+	assert.Equal(t, "mygroup", opt.Group)
+	assert.Equal(t, fs.LogLevelToSlog(fs.LogLevelError), opt.Level)
+	assert.Equal(t, MinInterval, opt.Interval)
+
+	for _, in := range []rc.Params{
+		{"types": "potato"},
+		{"level": "potato"},
+		{"interval": "potato"},
+		{"group": 1.5},
+	} {
+		_, err = ParseOptions(in)
+		assert.True(t, rc.IsErrParamInvalid(err), in)
+	}
+}
+
+// collect streams the events of s until n have been received
+func collect(t *testing.T, s *Subscriber, n int, match func(ev Event) bool) (got []Event) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := s.Stream(ctx, func(ev Event) error {
+		if match(ev) {
+			got = append(got, ev)
+		}
+		if len(got) >= n {
+			cancel()
+		}
+		return nil
+	}, nil)
+	require.NoError(t, err)
+	require.Len(t, got, n)
+	return got
+}
+
+func TestSubscribeJobs(t *testing.T) {
+	opt, err := ParseOptions(rc.Params{"types": "job", "group": "events-test"})
+	require.NoError(t, err)
+	s, unsubscribe := Subscribe(opt)
+	defer unsubscribe()
+
+	// jobs in other groups aren't sent
+	for _, group := range []string{"other", "events-test"} {
+		_, _, err = jobs.NewJob(context.Background(), func(ctx context.Context, in rc.Params) (rc.Params, error) {
+			return nil, nil
+		}, rc.Params{"_group": group})
+		require.NoError(t, err)
+	}
+	got := collect(t, s, 3, func(ev Event) bool { return true })
+	for i, what := range []string{jobs.EventQueued, jobs.EventStarted, jobs.EventFinished} {
+		assert.Equal(t, Job, got[i].Type)
+		assert.Equal(t, "events-test", got[i].Group)
+		assert.Equal(t, what, got[i].Data.(rc.Params)["event"])
+	}
+}
+
+func TestDropped(t *testing.T) {
+	opt, err := ParseOptions(rc.Params{"types": "job"})
+	require.NoError(t, err)
+	s := &Subscriber{opt: opt, events: make(chan Event, 1)}
+	s.send(Event{Type: Job})
+	s.send(Event{Type: Job})
+	s.send(Event{Type: Job})
+	got := collect(t, s, 2, func(ev Event) bool { return true })
+	assert.Equal(t, Dropped, got[0].Type)
+	assert.Equal(t, rc.Params{"count": int64(2)}, got[0].Data)
+	assert.Equal(t, Job, got[1].Type)
+}
+
+func TestStats(t *testing.T) {
+	opt, err := ParseOptions(rc.Params{"types": "stats", "interval": "100ms"})
+	require.NoError(t, err)
+	s, unsubscribe := Subscribe(opt)
+	defer unsubscribe()
+	got := collect(t, s, 1, func(ev Event) bool { return ev.Type == Stats })
+	assert.Contains(t, got[0].Data, "bytes")
+}
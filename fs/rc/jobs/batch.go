@@ -0,0 +1,214 @@
+package jobs
+
+// Runs several rc calls in one request with job/batch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/rc"
+	"golang.org/x/sync/errgroup"
+)
+
+// The rc call which runs batches
+const batchPath = "job/batch"
+
+// The special parameters which apply to the whole batch so can't be
+// used in its inputs
+var batchOnlyParams = []string{"_async", "_group", "_priority", "_after"}
+
+// BatchPaths returns the rc calls in the inputs of a job/batch call
+// with parameters in, so the caller can check it is allowed to make
+// them. Inputs without a valid _path are ignored as job/batch returns
+// an error for them.
+//
+// job/batch can't be used in a batch, but the inputs of any which are
+// are returned too so they can't be used to get round the check.
+func BatchPaths(in rc.Params) (paths []string) {
+	inputs, _ := batchInputs(in)
+	for _, item := range inputs {
+		input, ok := batchInput(item)
+		if !ok {
+			continue
+		}
+		if path, err := input.GetString("_path"); err == nil {
+			paths = append(paths, path)
+			if path == batchPath {
+				paths = append(paths, BatchPaths(input)...)
+			}
+		}
+	}
+	return paths
+}
+
+// batchInputs reads the inputs of the batch which may be an array or
+// a string with a JSON array in
+func batchInputs(in rc.Params) (inputs []any, err error) {
+	err = in.GetStruct("inputs", &inputs)
+	return inputs, err
+}
+
+// batchInput converts an item of the inputs into Params
+func batchInput(item any) (rc.Params, bool) {
+	switch x := item.(type) {
+	case rc.Params:
+		return x, true
+	case map[string]any:
+		return rc.Params(x), true
+	}
+	return nil, false
+}
+
+// batchCall is a call in a batch ready to run
+type batchCall struct {
+	path string
+	call *rc.Call
+	ctx  context.Context
+	in   rc.Params
+}
+
+// prepareBatchCall finds the call for the input item and sets up the ctx and
+// parameters to run it with.
+//
+// If there is an error then b.path and b.in are set as far as
+// possible for the error result.
+func prepareBatchCall(ctx context.Context, item any) (b batchCall, err error) {
+	input, ok := batchInput(item)
+	if !ok {
+		return b, rc.NewErrParamInvalid(fmt.Errorf("expecting object for input (was %T)", item))
+	}
+	b.in = input.Copy()
+	b.path, err = b.in.GetString("_path")
+	if err != nil {
+		return b, err
+	}
+	delete(b.in, "_path")
+	if b.path == batchPath {
+		return b, rc.NewErrParamInvalid(fmt.Errorf("can't use %q in a batch", b.path))
+	}
+	b.call = rc.Calls.Get(b.path)
+	if b.call == nil {
+		return b, rc.NewErrParamInvalid(fmt.Errorf("couldn't find method %q", b.path))
+	}
+	if b.call.NeedsRequest || b.call.NeedsResponse {
+		return b, rc.NewErrParamInvalid(fmt.Errorf("can't use %q in a batch as it needs the HTTP request", b.path))
+	}
+	for _, key := range batchOnlyParams {
+		if _, found := b.in[key]; found {
+			return b, rc.NewErrParamInvalid(fmt.Errorf("can't use %s in a batch input - set it on the batch", key))
+		}
+	}
+	if err = b.call.ValidateParams(b.in); err != nil {
+		return b, err
+	}
+	if ctx, err = getConfig(ctx, b.in); err != nil {
+		return b, err
+	}
+	if ctx, err = getFilter(ctx, b.in); err != nil {
+		return b, err
+	}
+	b.ctx = ctx
+	return b, nil
+}
+
+// run the call returning its result
+func (b *batchCall) run() rc.Params {
+	err := b.ctx.Err()
+	if err == nil {
+		var out rc.Params
+		out, err = b.call.Fn(b.ctx, b.in.Copy())
+		if err == nil {
+			if out == nil {
+				out = rc.Params{}
+			}
+			return out
+		}
+	}
+	result, _ := rc.Error(b.path, b.in, err, http.StatusInternalServerError)
+	return result
+}
+
+func init() {
+	rc.Add(rc.Call{
+		Path:         batchPath,
+		AuthRequired: true,
+		Fn:           rcBatch,
+		Title:        "Run several rc calls in one request",
+		Input: []rc.Param{
+			{Name: "inputs", Type: rc.ParamArray, Required: true, Help: "the parameters of each call with _path set to the call"},
+			{Name: "concurrency", Type: rc.ParamInteger, Help: "run this many calls at once, default --transfers"},
+		},
+		Output: []rc.Param{
+			{Name: "results", Type: rc.ParamArray, Help: "the output or error of each call in the order of inputs"},
+		},
+		Help: `This runs many rc calls in one request, saving a round trip for
+each one, e.g. to delete or copy thousands of files.
+
+Parameters:
+
+- inputs - array of objects, each the parameters of a call with an extra
+  _path parameter naming the call, e.g. "operations/deletefile"
+- concurrency - run this many calls at once (integer, default --transfers)
+
+The calls all run in the stats group of the batch so can be
+monitored and stopped together. Use _async, _group, _priority and
+_after on the batch rather than on its inputs. Each input may set
+_config and _filter. Calls which need the HTTP request, like
+operations/uploadfile, and job/batch itself can't be used.
+
+Results:
+
+- results - array with the output of each call, in the same order as
+  inputs. If a call failed its entry is an error object with error,
+  input, path and status, as returned by a failed call.
+
+The batch succeeds even if some of the calls fail, so check each of
+the results. For example
+
+    rclone rc job/batch --json '{
+      "inputs": [
+        {"_path": "operations/deletefile", "fs": "remote:", "remote": "a.txt"},
+        {"_path": "operations/deletefile", "fs": "remote:", "remote": "b.txt"}
+      ]
+    }'
+`,
+	})
+}
+
+// Runs the calls in a batch
+func rcBatch(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	inputs, err := batchInputs(in)
+	if err != nil {
+		return nil, err
+	}
+	concurrency, err := in.GetInt64("concurrency")
+	if rc.IsErrParamNotFound(err) {
+		concurrency = int64(fs.GetConfig(ctx).Transfers)
+	} else if err != nil {
+		return nil, err
+	}
+	if concurrency < 1 {
+		return nil, rc.NewErrParamInvalid(errors.New("concurrency must be at least 1"))
+	}
+	results := make([]rc.Params, len(inputs))
+	var g errgroup.Group
+	g.SetLimit(int(concurrency))
+	for i, item := range inputs {
+		b, err := prepareBatchCall(ctx, item)
+		if err != nil {
+			results[i], _ = rc.Error(b.path, b.in, err, http.StatusInternalServerError)
+			continue
+		}
+		g.Go(func() error {
+			results[i] = b.run()
+			return nil
+		})
+	}
+	_ = g.Wait()
+	return rc.Params{
+		"results": results,
+	}, nil
+}
@@ -0,0 +1,114 @@
+package jobs
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchPaths(t *testing.T) {
+	assert.Nil(t, BatchPaths(rc.Params{}))
+	assert.Equal(t, []string{"rc/noop", "core/stats"}, BatchPaths(rc.Params{
+		"inputs": []any{
+			map[string]any{"_path": "rc/noop"},
+			"potato",
+			map[string]any{"nopath": true},
+			rc.Params{"_path": "core/stats"},
+		},
+	}))
+	// inputs of nested batches
+	assert.Equal(t, []string{"job/batch", "rc/noop", "config/delete"}, BatchPaths(rc.Params{
+		"inputs": []any{
+			map[string]any{"_path": "job/batch", "inputs": []any{
+				map[string]any{"_path": "rc/noop"},
+				map[string]any{"_path": "config/delete"},
+			}},
+		},
+	}))
+	// inputs as a JSON string
+	assert.Equal(t, []string{"rc/noop"}, BatchPaths(rc.Params{
+		"inputs": `[{"_path": "rc/noop"}]`,
+	}))
+}
+
+func TestRcBatch(t *testing.T) {
+	call := rc.Calls.Get("job/batch")
+	require.NotNil(t, call)
+	out, err := call.Fn(context.Background(), rc.Params{
+		"inputs": []any{
+			map[string]any{"_path": "rc/noop", "a": "1"},
+			map[string]any{"_path": "rc/error"},
+			map[string]any{"a": "1"},
+			map[string]any{"_path": "potato/potato"},
+			map[string]any{"_path": "rc/noop", "_async": true},
+			map[string]any{"_path": "job/status"},
+			"potato",
+			map[string]any{"_path": "job/batch", "inputs": []any{}},
+		},
+	})
+	require.NoError(t, err)
+	results := out["results"].([]rc.Params)
+	require.Len(t, results, 8)
+	assert.Equal(t, rc.Params{"a": "1"}, results[0])
+	assert.Equal(t, "rc/error", results[1]["path"])
+	assert.Equal(t, 500, results[1]["status"])
+	assert.Contains(t, results[1]["error"], "arbitrary error")
+	assert.Contains(t, results[2]["error"], `Didn't find key "_path"`)
+	assert.Equal(t, 400, results[2]["status"])
+	assert.Contains(t, results[3]["error"], `couldn't find method "potato/potato"`)
+	assert.Contains(t, results[4]["error"], "can't use _async in a batch input")
+	assert.Contains(t, results[5]["error"], `Didn't find key "jobid"`)
+	assert.Contains(t, results[6]["error"], "expecting object for input")
+	assert.Contains(t, results[7]["error"], `can't use "job/batch" in a batch`)
+
+	_, err = call.Fn(context.Background(), rc.Params{})
+	assert.True(t, rc.IsErrParamNotFound(err))
+	_, err = call.Fn(context.Background(), rc.Params{"inputs": []any{}, "concurrency": 0})
+	assert.True(t, rc.IsErrParamInvalid(err))
+}
+
+func TestRcBatchConcurrency(t *testing.T) {
+	var running, maxRunning atomic.Int32
+	var group atomic.Value
+	rc.Add(rc.Call{
+		Path: "test/batch",
+		Fn: func(ctx context.Context, in rc.Params) (rc.Params, error) {
+			n := running.Add(1)
+			for {
+				old := maxRunning.Load()
+				if n <= old || maxRunning.CompareAndSwap(old, n) {
+					break
+				}
+			}
+			name, _ := accounting.StatsGroupFromContext(ctx)
+			group.Store(name)
+			time.Sleep(10 * time.Millisecond)
+			running.Add(-1)
+			return nil, nil
+		},
+	})
+	var inputs []any
+	for range 10 {
+		inputs = append(inputs, map[string]any{"_path": "test/batch"})
+	}
+	ctx := accounting.WithStatsGroup(context.Background(), "batch-group")
+	out, err := rc.Calls.Get("job/batch").Fn(ctx, rc.Params{
+		"inputs":      inputs,
+		"concurrency": 3,
+	})
+	require.NoError(t, err)
+	results := out["results"].([]rc.Params)
+	require.Len(t, results, 10)
+	for _, result := range results {
+		assert.Equal(t, rc.Params{}, result)
+	}
+	assert.LessOrEqual(t, maxRunning.Load(), int32(3))
+	assert.Greater(t, maxRunning.Load(), int32(1))
+	assert.Equal(t, "batch-group", group.Load())
+}
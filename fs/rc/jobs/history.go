@@ -0,0 +1,404 @@
+package jobs
+
+// Keeps a record of the finished jobs in a JSONL file set with
+// --rc-job-history
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/rc"
+)
+
+// HistoryEntry is the record of a finished job
+type HistoryEntry struct {
+	ID        int64     `json:"id"`
+	ExecuteID string    `json:"executeId"` // the rclone process which ran it
+	Path      string    `json:"path"`      // the rc call if known
+	Group     string    `json:"group"`
+	Params    rc.Params `json:"params"`
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+	Duration  float64   `json:"duration"`
+	Success   bool      `json:"success"`
+	Error     string    `json:"error"`
+	Stats     rc.Params `json:"stats"` // core/stats of the group when the job finished
+}
+
+// jobHistory stores the HistoryEntry of each job as a line of JSON
+type jobHistory struct {
+	mu   sync.Mutex
+	path string
+}
+
+var (
+	historyMu sync.Mutex
+	history   *jobHistory
+)
+
+// getHistory returns the job history or nil if it isn't enabled
+func (jobs *Jobs) getHistory() *jobHistory {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	path := jobs.opt.JobHistory
+	if path == "" {
+		return nil
+	}
+	if history == nil || history.path != path {
+		history = &jobHistory{path: path}
+	}
+	return history
+}
+
+type pathKeyType struct{}
+
+// Key for adding the rc path to ctx
+var pathKey = pathKeyType{}
+
+// WithPath returns a copy of ctx noting path as the rc call the next
+// job made with it runs. This is recorded in the job history.
+func WithPath(ctx context.Context, path string) context.Context {
+	return context.WithValue(ctx, pathKey, path)
+}
+
+// historyParams returns the params of the job for the history
+func historyParams(in rc.Params) rc.Params {
+	params := in.Copy()
+	delete(params, "_request")
+	delete(params, "_response")
+	return params
+}
+
+// record the finished job in the history if enabled
+//
+// Only async jobs are recorded. Sync calls include the polls of
+// job/status and core/stats which would soon fill the history.
+func (jobs *Jobs) record(job *Job) {
+	h := jobs.getHistory()
+	if h == nil || !job.async {
+		return
+	}
+	job.mu.Lock()
+	entry := &HistoryEntry{
+		ID:        job.ID,
+		ExecuteID: executeID,
+		Path:      job.path,
+		Group:     job.Group,
+		Params:    job.params,
+		StartTime: job.StartTime,
+		EndTime:   job.EndTime,
+		Duration:  job.Duration,
+		Success:   job.Success,
+		Error:     job.Error,
+	}
+	job.mu.Unlock()
+	// Don't make a stats group for jobs which didn't use one
+	if stats := accounting.LookupStatsGroup(entry.Group); stats != nil {
+		var err error
+		entry.Stats, err = stats.RemoteStats(false)
+		if err != nil {
+			fs.Errorf(nil, "Job history: failed to read stats of job %d: %v", entry.ID, err)
+		}
+	}
+	if err := h.add(entry); err != nil {
+		fs.Errorf(nil, "Job history: failed to record job %d: %v", entry.ID, err)
+	}
+}
+
+// add the entry to the end of the history
+func (h *jobHistory) add(entry *HistoryEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		// the params may not be JSON, e.g. from librclone
+		entry.Params = rc.Params{"error": fmt.Sprintf("couldn't encode params: %v", err)}
+		data, err = json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+	}
+	data = append(data, '\n')
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	f, err := os.OpenFile(h.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	closeErr := f.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// read the entries for which keep returns true, or all of them if
+// keep is nil
+//
+// Call with the lock held.
+func (h *jobHistory) read(keep func(*HistoryEntry) bool) (entries []*HistoryEntry, err error) {
+	data, err := os.ReadFile(h.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		entry := new(HistoryEntry)
+		if err := json.Unmarshal(line, entry); err != nil {
+			fs.Errorf(nil, "Job history: ignoring bad line %d of %q: %v", lineNumber, h.path, err)
+			continue
+		}
+		if keep == nil || keep(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// list the entries matching keep
+func (h *jobHistory) list(keep func(*HistoryEntry) bool) ([]*HistoryEntry, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.read(keep)
+}
+
+// purge the entries for which remove returns true returning how
+// many were removed
+func (h *jobHistory) purge(remove func(*HistoryEntry) bool) (n int, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	kept, err := h.read(func(entry *HistoryEntry) bool {
+		if remove(entry) {
+			n++
+			return false
+		}
+		return true
+	})
+	if err != nil || n == 0 {
+		return 0, err
+	}
+	var buf bytes.Buffer
+	for _, entry := range kept {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return 0, err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	// write to a temporary file then rename so the history is never
+	// left half written
+	tmpPath := h.path + ".tmp"
+	if err = os.WriteFile(tmpPath, buf.Bytes(), 0600); err != nil {
+		return 0, err
+	}
+	if err = os.Rename(tmpPath, h.path); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// historyFilter makes a function matching the entries selected by
+// the parameters status, path, group, since and until
+func historyFilter(in rc.Params) (match func(*HistoryEntry) bool, err error) {
+	status, err := in.GetString("status")
+	if rc.NotErrParamNotFound(err) {
+		return nil, err
+	}
+	switch status {
+	case "", "all", "success", "error":
+	default:
+		return nil, fmt.Errorf("unknown status %q - use success, error or all", status)
+	}
+	path, err := in.GetString("path")
+	if rc.NotErrParamNotFound(err) {
+		return nil, err
+	}
+	group, err := in.GetString("group")
+	if rc.NotErrParamNotFound(err) {
+		return nil, err
+	}
+	getTime := func(key string) (t time.Time, err error) {
+		s, err := in.GetString(key)
+		if rc.IsErrParamNotFound(err) {
+			return t, nil
+		} else if err != nil {
+			return t, err
+		}
+		t, err = fs.ParseTime(s)
+		if err != nil {
+			return t, fmt.Errorf("bad %s %q: %w", key, s, err)
+		}
+		return t, nil
+	}
+	since, err := getTime("since")
+	if err != nil {
+		return nil, err
+	}
+	until, err := getTime("until")
+	if err != nil {
+		return nil, err
+	}
+	return func(entry *HistoryEntry) bool {
+		switch {
+		case status == "success" && !entry.Success,
+			status == "error" && entry.Success,
+			path != "" && entry.Path != path,
+			group != "" && entry.Group != group,
+			!since.IsZero() && entry.EndTime.Before(since),
+			!until.IsZero() && entry.EndTime.After(until):
+			return false
+		}
+		return true
+	}, nil
+}
+
+// The parameters used by historyFilter
+var historyFilterParams = []rc.Param{
+	{Name: "status", Type: rc.ParamString, Help: `"success", "error" or "all"`},
+	{Name: "path", Type: rc.ParamString, Help: "only jobs of this rc call"},
+	{Name: "group", Type: rc.ParamString, Help: "only jobs in this stats group"},
+	{Name: "since", Type: rc.ParamString, Help: "only jobs which finished after this time"},
+	{Name: "until", Type: rc.ParamString, Help: "only jobs which finished before this time"},
+}
+
+func init() {
+	rc.Add(rc.Call{
+		Path:         "job/history",
+		AuthRequired: true,
+		Fn:           rcJobHistory,
+		Input: slices.Concat(historyFilterParams, []rc.Param{
+			{Name: "limit", Type: rc.ParamInteger, Help: "return at most this many of the latest jobs"},
+		}),
+		Output: []rc.Param{
+			{Name: "jobs", Type: rc.ParamArray, Help: "the finished jobs, latest first"},
+		},
+		Title: "Lists finished jobs from the job history",
+		Help: `This needs the job history to be enabled with --rc-job-history.
+The history is a file with a line of JSON for each finished async
+job. Calls made without _async aren't recorded. As
+the parameters of the jobs are recorded it may contain secrets so it
+is written readable only by the user running rclone.
+
+Parameters - all optional:
+
+- status - "success", "error" or "all" (the default)
+- path - only jobs of this rc call, e.g. "sync/sync"
+- group - only jobs in this stats group
+- since - only jobs which finished after this time
+- until - only jobs which finished before this time
+- limit - return at most this many of the latest jobs (integer)
+
+Times may be given as an RFC3339 time like "2025-01-30T12:00:00Z" or
+as a duration ago like "24h" or "7d".
+
+Results:
+
+- jobs - array of finished jobs, latest first, each with
+    - id - the job ID
+    - executeId - the ID of the rclone process which ran it
+    - path - the rc call
+    - group - the stats group
+    - params - the parameters it was called with
+    - startTime, endTime - when it started and finished
+    - duration - time in seconds that it ran for
+    - success - boolean - true for success false otherwise
+    - error - error from the job or empty string for no error
+    - stats - the core/stats of its group when it finished, if it
+      has one
+`,
+	})
+}
+
+// Returns the finished jobs from the history
+func rcJobHistory(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	h := running.getHistory()
+	if h == nil {
+		return nil, errors.New("job history not enabled - use --rc-job-history")
+	}
+	match, err := historyFilter(in)
+	if err != nil {
+		return nil, err
+	}
+	limit, err := in.GetInt64("limit")
+	if rc.NotErrParamNotFound(err) {
+		return nil, err
+	}
+	entries, err := h.list(match)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read job history: %w", err)
+	}
+	// latest first
+	jobs := make([]*HistoryEntry, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		if limit > 0 && int64(len(jobs)) >= limit {
+			break
+		}
+		jobs = append(jobs, entries[i])
+	}
+	return rc.Params{
+		"jobs": jobs,
+	}, nil
+}
+
+func init() {
+	rc.Add(rc.Call{
+		Path:         "job/history-purge",
+		AuthRequired: true,
+		Fn:           rcJobHistoryPurge,
+		Input:        historyFilterParams,
+		Output: []rc.Param{
+			{Name: "purged", Type: rc.ParamInteger, Help: "the number of jobs removed"},
+		},
+		Title: "Removes finished jobs from the job history",
+		Help: `This needs the job history to be enabled with --rc-job-history.
+
+It takes the same status, path, group, since and until parameters as
+job/history and removes the jobs they match. With no parameters it
+removes all the jobs. For example to remove the jobs which finished
+more than 30 days ago
+
+    rclone rc job/history-purge until=30d
+
+Results:
+
+- purged - the number of jobs removed
+`,
+	})
+}
+
+// Removes finished jobs from the history
+func rcJobHistoryPurge(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	h := running.getHistory()
+	if h == nil {
+		return nil, errors.New("job history not enabled - use --rc-job-history")
+	}
+	match, err := historyFilter(in)
+	if err != nil {
+		return nil, err
+	}
+	n, err := h.purge(match)
+	if err != nil {
+		return nil, fmt.Errorf("failed to purge job history: %w", err)
+	}
+	return rc.Params{
+		"purged": n,
+	}, nil
+}
@@ -0,0 +1,146 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// enable the job history in a temporary file returning its path
+func enableHistory(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	old := rc.Opt.JobHistory
+	rc.Opt.JobHistory = path
+	t.Cleanup(func() {
+		rc.Opt.JobHistory = old
+	})
+	return path
+}
+
+// wait for the history to have n entries
+func waitHistory(t *testing.T, n int) {
+	require.Eventually(t, func() bool {
+		out := callHistory(t, "job/history", rc.Params{})
+		return len(out["jobs"].([]*HistoryEntry)) == n
+	}, 10*time.Second, 10*time.Millisecond)
+}
+
+// call the rc call at path with in
+func callHistory(t *testing.T, path string, in rc.Params) rc.Params {
+	call := rc.Calls.Get(path)
+	require.NotNil(t, call)
+	out, err := call.Fn(context.Background(), in)
+	require.NoError(t, err)
+	return out
+}
+
+func TestJobHistoryNotEnabled(t *testing.T) {
+	for _, path := range []string{"job/history", "job/history-purge"} {
+		call := rc.Calls.Get(path)
+		require.NotNil(t, call)
+		_, err := call.Fn(context.Background(), rc.Params{})
+		assert.ErrorContains(t, err, "--rc-job-history")
+	}
+}
+
+func TestJobHistory(t *testing.T) {
+	path := enableHistory(t)
+	jobs := newJobs()
+	ctx := WithPath(context.Background(), "test/history")
+
+	job, _, err := jobs.NewJob(ctx, func(ctx context.Context, in rc.Params) (rc.Params, error) {
+		accounting.Stats(ctx).Bytes(3)
+		return nil, nil
+	}, rc.Params{"a": "b", "_group": "history", "_async": true})
+	require.NoError(t, err)
+	waitHistory(t, 1)
+	_, _, err = jobs.NewJob(ctx, func(ctx context.Context, in rc.Params) (rc.Params, error) {
+		return nil, errors.New("boom")
+	}, rc.Params{"_async": true})
+	require.NoError(t, err)
+	waitHistory(t, 2)
+
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+	out := callHistory(t, "job/history", rc.Params{})
+	entries := out["jobs"].([]*HistoryEntry)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "boom", entries[0].Error) // latest first
+	e := entries[1]
+	assert.Equal(t, job.ID, e.ID)
+	assert.Equal(t, executeID, e.ExecuteID)
+	assert.Equal(t, "test/history", e.Path)
+	assert.Equal(t, "history", e.Group)
+	assert.Equal(t, rc.Params{"a": "b", "_group": "history", "_async": true}, e.Params)
+	assert.True(t, e.Success)
+	assert.Equal(t, "", e.Error)
+	assert.Equal(t, float64(3), e.Stats["bytes"])
+	assert.Nil(t, entries[0].Stats, "no stats group")
+
+	for _, test := range []struct {
+		in   rc.Params
+		want int
+	}{
+		{rc.Params{"status": "success"}, 1},
+		{rc.Params{"status": "error"}, 1},
+		{rc.Params{"status": "all"}, 2},
+		{rc.Params{"group": "history"}, 1},
+		{rc.Params{"path": "test/history"}, 2},
+		{rc.Params{"path": "other"}, 0},
+		{rc.Params{"since": "1h"}, 2},
+		{rc.Params{"until": "1h"}, 0},
+		{rc.Params{"limit": 1}, 1},
+	} {
+		out := callHistory(t, "job/history", test.in)
+		assert.Len(t, out["jobs"], test.want, test.in)
+	}
+	_, err = rc.Calls.Get("job/history").Fn(context.Background(), rc.Params{"status": "potato"})
+	assert.Error(t, err)
+	_, err = rc.Calls.Get("job/history").Fn(context.Background(), rc.Params{"since": "potato"})
+	assert.Error(t, err)
+
+	// bad lines are ignored
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	require.NoError(t, err)
+	_, err = f.WriteString("not json\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	out = callHistory(t, "job/history", rc.Params{})
+	assert.Len(t, out["jobs"], 2)
+
+	out = callHistory(t, "job/history-purge", rc.Params{"status": "error"})
+	assert.Equal(t, 1, out["purged"])
+	out = callHistory(t, "job/history", rc.Params{})
+	entries = out["jobs"].([]*HistoryEntry)
+	require.Len(t, entries, 1)
+	assert.Equal(t, job.ID, entries[0].ID)
+
+	out = callHistory(t, "job/history-purge", rc.Params{"until": time.Now().Add(-time.Hour).Format(time.RFC3339)})
+	assert.Equal(t, 0, out["purged"])
+	out = callHistory(t, "job/history-purge", rc.Params{})
+	assert.Equal(t, 1, out["purged"])
+	out = callHistory(t, "job/history", rc.Params{})
+	assert.Len(t, out["jobs"], 0)
+}
+
+func TestJobHistorySync(t *testing.T) {
+	path := enableHistory(t)
+	jobs := newJobs()
+
+	job, _, err := jobs.NewJob(context.Background(), noopFn, rc.Params{})
+	require.NoError(t, err)
+	assert.True(t, job.Finished)
+	assert.Nil(t, accounting.LookupStatsGroup(job.Group), "stats group made")
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "sync call recorded")
+}
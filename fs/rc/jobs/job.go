@@ -38,7 +38,13 @@ type Job struct {
 	Duration  float64   `json:"duration"`
 	Output    rc.Params `json:"output"`
 	Stop      func()    `json:"-"`
+	Queued    bool      `json:"queued"`   // set while the job waits in the queue
+	Priority  int       `json:"priority"` // higher priority queued jobs run first
+	After     []int64   `json:"after"`    // IDs of the jobs this runs after
 	listeners []*func()
+	path      string    // the rc call for the history
+	params    rc.Params // the parameters for the history
+	async     bool      // set if the job was started with _async
 
 	// realErr is the Error before printing it as a string, it's used to return
 	// the real error to the upper application layers while still printing the
@@ -72,6 +78,8 @@ func (job *Job) finish(out rc.Params, err error) {
 	}
 
 	job.mu.Unlock()
+	sendEvent(EventFinished, job)
+	running.record(job)
 	running.kickExpire() // make sure this job gets expired
 }
 
@@ -99,6 +107,82 @@ func (job *Job) OnFinish(fn func()) func() {
 	return func() { job.removeListener(&fn) }
 }
 
+// Job events passed to the functions added with OnEvent
+const (
+	EventQueued   = "queued"   // the job has been made
+	EventStarted  = "started"  // the job has started running
+	EventFinished = "finished" // the job has finished
+)
+
+var (
+	eventMu        sync.Mutex
+	eventListeners []*func(event string, job *Job)
+)
+
+// OnEvent adds fn to be called with the events of every job.
+//
+// fn is called synchronously so must not block or lock the job's
+// Jobs. It returns a function to remove fn.
+func OnEvent(fn func(event string, job *Job)) func() {
+	eventMu.Lock()
+	defer eventMu.Unlock()
+	eventListeners = append(eventListeners, &fn)
+	return func() {
+		eventMu.Lock()
+		defer eventMu.Unlock()
+		for i, ln := range eventListeners {
+			if ln == &fn {
+				eventListeners = slices.Delete(eventListeners, i, i+1)
+				return
+			}
+		}
+	}
+}
+
+// sendEvent calls the event listeners
+func sendEvent(event string, job *Job) {
+	eventMu.Lock()
+	listeners := slices.Clone(eventListeners)
+	eventMu.Unlock()
+	for _, fn := range listeners {
+		(*fn)(event, job)
+	}
+}
+
+// Status returns the status of the job as returned by job/status
+// but without its output
+func (job *Job) Status() rc.Params {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	return rc.Params{
+		"id":        job.ID,
+		"group":     job.Group,
+		"startTime": job.StartTime,
+		"endTime":   job.EndTime,
+		"error":     job.Error,
+		"finished":  job.Finished,
+		"success":   job.Success,
+		"duration":  job.Duration,
+		"queued":    job.Queued,
+		"priority":  job.Priority,
+		"after":     job.After,
+	}
+}
+
+// Path returns the rc call the job is running if known
+func (job *Job) Path() string {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	return job.path
+}
+
+// Async returns true if the job was started with _async
+func (job *Job) Async() bool {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	return job.async
+}
+
 // run the job until completion writing the return status
 func (job *Job) run(ctx context.Context, fn rc.Func, in rc.Params) {
 	defer func() {
@@ -115,6 +199,9 @@ type Jobs struct {
 	jobs          map[int64]*Job
 	opt           *rc.Options
 	expireRunning bool
+	queue         []*queuedJob   // async jobs waiting to run
+	nRunning      int            // number of async jobs running
+	nRemote       map[string]int // number of async jobs running per remote
 }
 
 var (
@@ -126,8 +213,9 @@ var (
 // newJobs makes a new Jobs structure
 func newJobs() *Jobs {
 	return &Jobs{
-		jobs: map[int64]*Job{},
-		opt:  &rc.Opt,
+		jobs:    map[int64]*Job{},
+		opt:     &rc.Opt,
+		nRemote: map[string]int{},
 	}
 }
 
@@ -262,6 +350,8 @@ var jobKey = jobKeyType{}
 // NewJob creates a Job and executes it, possibly in the background if _async is set
 func (jobs *Jobs) NewJob(ctx context.Context, fn rc.Func, in rc.Params) (job *Job, out rc.Params, err error) {
 	id := jobID.Add(1)
+	params := historyParams(in)
+	path, _ := ctx.Value(pathKey).(string)
 	in = in.Copy() // copy input so we can change it
 
 	ctx, isAsync, err := getAsync(ctx, in)
@@ -284,35 +374,79 @@ func (jobs *Jobs) NewJob(ctx context.Context, fn rc.Func, in rc.Params) (job *Jo
 		return nil, nil, err
 	}
 
+	priority, err := getPriority(in)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	afterIDs, err := getAfter(in)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !isAsync && (priority != 0 || len(afterIDs) > 0) {
+		return nil, nil, errors.New("_priority and _after need _async")
+	}
+	after := make([]*Job, 0, len(afterIDs))
+	for _, afterID := range afterIDs {
+		afterJob := jobs.Get(afterID)
+		if afterJob == nil {
+			return nil, nil, fmt.Errorf("job %d in _after not found", afterID)
+		}
+		after = append(after, afterJob)
+	}
+
 	ctx, cancel := context.WithCancel(ctx)
 	stop := func() {
 		cancel()
 		// Wait for cancel to propagate before returning.
 		<-ctx.Done()
+		// Remove the job if it is queued - this is called with
+		// locks held so do it in the background.
+		go jobs.dispatch()
 	}
 	job = &Job{
 		ID:        id,
 		Group:     group,
 		StartTime: time.Now(),
 		Stop:      stop,
+		Queued:    isAsync,
+		Priority:  priority,
+		After:     afterIDs,
+		path:      path,
+		params:    params,
+		async:     isAsync,
 	}
 
 	jobs.mu.Lock()
 	jobs.jobs[job.ID] = job
 	jobs.mu.Unlock()
 
+	sendEvent(EventQueued, job)
+
 	// Add the job to the context
 	ctx = context.WithValue(ctx, jobKey, job)
 
 	if isAsync {
-		go job.run(ctx, fn, in)
+		jobs.enqueue(&queuedJob{
+			job:     job,
+			ctx:     ctx,
+			fn:      fn,
+			in:      in,
+			after:   after,
+			remotes: jobRemotes(in),
+		})
 		out = make(rc.Params)
 		out["jobid"] = job.ID
 		err = nil
 	} else {
+		sendEvent(EventStarted, job)
 		job.run(ctx, fn, in)
 		out = job.Output
 		err = job.realErr
+		if jobs.queueLen() > 0 {
+			// start any jobs queued after this one
+			jobs.dispatch()
+		}
 	}
 	return job, out, err
 }
@@ -348,10 +482,28 @@ func GetJobID(ctx context.Context) (jobID int64, ok bool) {
 	return job.ID, true
 }
 
+// The jobid parameter of the job calls
+var jobIDParam = rc.Param{Name: "jobid", Type: rc.ParamInteger, Required: true, Help: "id of the job"}
+
 func init() {
 	rc.Add(rc.Call{
 		Path:  "job/status",
 		Fn:    rcJobStatus,
+		Input: []rc.Param{jobIDParam},
+		Output: []rc.Param{
+			{Name: "id", Type: rc.ParamInteger, Help: "the job ID"},
+			{Name: "group", Type: rc.ParamString, Help: "the stats group"},
+			{Name: "startTime", Type: rc.ParamString, Help: "time the job started"},
+			{Name: "endTime", Type: rc.ParamString, Help: "time the job finished"},
+			{Name: "error", Type: rc.ParamString, Help: "error from the job or empty string for no error"},
+			{Name: "finished", Type: rc.ParamBoolean, Help: "whether the job has finished or not"},
+			{Name: "success", Type: rc.ParamBoolean, Help: "true for success false otherwise"},
+			{Name: "duration", Type: rc.ParamNumber, Help: "time in seconds that the job ran for"},
+			{Name: "output", Type: rc.ParamObject, Help: "output of the job"},
+			{Name: "queued", Type: rc.ParamBoolean, Help: "true while an async job waits in the queue"},
+			{Name: "priority", Type: rc.ParamInteger, Help: "the priority of the job in the queue"},
+			{Name: "after", Type: rc.ParamArray, Help: "the IDs of the jobs it runs after"},
+		},
 		Title: "Reads the status of the job ID",
 		Help: `Parameters:
 
@@ -367,6 +519,9 @@ Results:
 - id - as passed in above
 - startTime - time the job started (e.g. "2018-10-26T18:50:20.528336039+01:00")
 - success - boolean - true for success false otherwise
+- queued - boolean - true while an async job waits in the queue
+- priority - the priority of the job in the queue
+- after - the IDs of the jobs it runs after
 - output - output of the job as would have been returned if called synchronously
 - progress - output of the progress related to the underlying job
 `,
@@ -395,8 +550,12 @@ func rcJobStatus(ctx context.Context, in rc.Params) (out rc.Params, err error) {
 
 func init() {
 	rc.Add(rc.Call{
-		Path:  "job/list",
-		Fn:    rcJobList,
+		Path: "job/list",
+		Fn:   rcJobList,
+		Output: []rc.Param{
+			{Name: "executeId", Type: rc.ParamString, Help: "id of the rclone executing"},
+			{Name: "jobids", Type: rc.ParamArray, Help: "the job ids"},
+		},
 		Title: "Lists the IDs of the running jobs",
 		Help: `Parameters: None.
 
@@ -420,6 +579,7 @@ func init() {
 	rc.Add(rc.Call{
 		Path:  "job/stop",
 		Fn:    rcJobStop,
+		Input: []rc.Param{jobIDParam},
 		Title: "Stop the running job",
 		Help: `Parameters:
 
@@ -447,8 +607,11 @@ func rcJobStop(ctx context.Context, in rc.Params) (out rc.Params, err error) {
 
 func init() {
 	rc.Add(rc.Call{
-		Path:  "job/stopgroup",
-		Fn:    rcGroupStop,
+		Path: "job/stopgroup",
+		Fn:   rcGroupStop,
+		Input: []rc.Param{
+			{Name: "group", Type: rc.ParamString, Required: true, Help: "name of the group"},
+		},
 		Title: "Stop all running jobs in a group",
 		Help: `Parameters:
 
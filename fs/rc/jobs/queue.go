@@ -0,0 +1,360 @@
+package jobs
+
+// Queues async jobs so they obey --rc-job-max-running and
+// --rc-job-max-running-per-remote and run after the jobs in _after
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/rc"
+)
+
+// queuedJob is an async job waiting to run
+type queuedJob struct {
+	job     *Job
+	ctx     context.Context
+	fn      rc.Func
+	in      rc.Params
+	after   []*Job   // jobs which must finish first
+	remotes []string // remotes the job uses
+}
+
+// The parameters which name the remotes a job uses
+var remoteParams = []string{"fs", "srcFs", "dstFs"}
+
+// jobRemotes returns the names of the remotes used by the job with
+// parameters in, "local" for local paths.
+func jobRemotes(in rc.Params) (remotes []string) {
+	for _, key := range remoteParams {
+		s, ok := in[key].(string)
+		if !ok || s == "" {
+			continue
+		}
+		parsed, err := fspath.Parse(s)
+		if err != nil {
+			continue
+		}
+		name := parsed.Name
+		if name == "" {
+			name = "local"
+		}
+		if !slices.Contains(remotes, name) {
+			remotes = append(remotes, name)
+		}
+	}
+	return remotes
+}
+
+// See if _priority is set returning it
+func getPriority(in rc.Params) (int, error) {
+	priority, err := in.GetInt64("_priority")
+	if rc.NotErrParamNotFound(err) {
+		return 0, err
+	}
+	delete(in, "_priority")
+	return int(priority), nil
+}
+
+// See if _after is set returning the job IDs in it.
+//
+// This may be a single job ID, a list of them or a comma separated
+// string of them.
+func getAfter(in rc.Params) (IDs []int64, err error) {
+	value, ok := in["_after"]
+	if !ok {
+		return nil, nil
+	}
+	delete(in, "_after")
+	var items []any
+	switch x := value.(type) {
+	case []any:
+		items = x
+	case []int64:
+		for _, ID := range x {
+			items = append(items, ID)
+		}
+	case string:
+		for _, s := range strings.Split(x, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				items = append(items, s)
+			}
+		}
+	default:
+		items = []any{x}
+	}
+	for _, item := range items {
+		// use Params to convert the item to an int64
+		ID, err := rc.Params{"_after": item}.GetInt64("_after")
+		if err != nil {
+			return nil, err
+		}
+		IDs = append(IDs, ID)
+	}
+	return IDs, nil
+}
+
+// sortQueue sorts the queue into the order the jobs are considered
+// to run, highest priority first then oldest first.
+//
+// Call with the lock held.
+func (jobs *Jobs) sortQueue() {
+	sort.SliceStable(jobs.queue, func(i, j int) bool {
+		a, b := jobs.queue[i].job, jobs.queue[j].job
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		return a.ID < b.ID
+	})
+}
+
+// waitingFor returns why the queued job can't start, or "" if it can
+//
+// If a job it is waiting for failed it returns an error.
+//
+// Call with the lock held.
+func (jobs *Jobs) waitingFor(q *queuedJob) (string, error) {
+	if q.ctx.Err() != nil {
+		return "", q.ctx.Err()
+	}
+	for _, dep := range q.after {
+		dep.mu.Lock()
+		finished, success, depErr := dep.Finished, dep.Success, dep.Error
+		dep.mu.Unlock()
+		if !finished {
+			return fmt.Sprintf("job %d", dep.ID), nil
+		}
+		if !success {
+			return "", fmt.Errorf("job %d it runs after failed: %s", dep.ID, depErr)
+		}
+	}
+	if maxRunning := jobs.opt.JobMaxRunning; maxRunning > 0 && jobs.nRunning >= maxRunning {
+		return "max running", nil
+	}
+	if maxRunning := jobs.opt.JobMaxRunningPerRemote; maxRunning > 0 {
+		for _, remote := range q.remotes {
+			if jobs.nRemote[remote] >= maxRunning {
+				return "max running on " + remote, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// dispatch starts the queued jobs which can run and fails the ones
+// which can't ever run
+func (jobs *Jobs) dispatch() {
+	type failure struct {
+		job *Job
+		err error
+	}
+	var (
+		start []*queuedJob
+		fail  []failure
+	)
+	jobs.mu.Lock()
+	jobs.sortQueue()
+	queue := jobs.queue[:0]
+	for _, q := range jobs.queue {
+		waiting, err := jobs.waitingFor(q)
+		switch {
+		case err != nil:
+			fail = append(fail, failure{job: q.job, err: err})
+		case waiting != "":
+			queue = append(queue, q)
+		default:
+			jobs.nRunning++
+			for _, remote := range q.remotes {
+				jobs.nRemote[remote]++
+			}
+			start = append(start, q)
+		}
+	}
+	clear(jobs.queue[len(queue):])
+	jobs.queue = queue
+	jobs.mu.Unlock()
+
+	// finish and start the jobs without the lock held
+	for _, f := range fail {
+		f.job.mu.Lock()
+		f.job.Queued = false
+		f.job.mu.Unlock()
+		f.job.finish(nil, f.err)
+	}
+	for _, q := range start {
+		q.job.mu.Lock()
+		q.job.Queued = false
+		q.job.StartTime = time.Now()
+		q.job.mu.Unlock()
+		sendEvent(EventStarted, q.job)
+		go func() {
+			q.job.run(q.ctx, q.fn, q.in)
+			jobs.release(q)
+		}()
+	}
+	if len(fail) > 0 {
+		// jobs waiting for the failed jobs can now fail too
+		jobs.dispatch()
+	}
+}
+
+// release the resources of the queued job once it has finished
+// running and start any jobs which can now run
+func (jobs *Jobs) release(q *queuedJob) {
+	jobs.mu.Lock()
+	jobs.nRunning--
+	for _, remote := range q.remotes {
+		jobs.nRemote[remote]--
+		if jobs.nRemote[remote] <= 0 {
+			delete(jobs.nRemote, remote)
+		}
+	}
+	jobs.mu.Unlock()
+	jobs.dispatch()
+}
+
+// enqueue the async job, starting it if it can run now
+func (jobs *Jobs) enqueue(q *queuedJob) {
+	jobs.mu.Lock()
+	jobs.queue = append(jobs.queue, q)
+	jobs.mu.Unlock()
+	jobs.dispatch()
+}
+
+// queueLen returns the number of jobs waiting in the queue
+func (jobs *Jobs) queueLen() int {
+	jobs.mu.RLock()
+	defer jobs.mu.RUnlock()
+	return len(jobs.queue)
+}
+
+// setPriority sets the priority of the queued job with ID
+func (jobs *Jobs) setPriority(ID int64, priority int) error {
+	jobs.mu.Lock()
+	defer jobs.mu.Unlock()
+	for _, q := range jobs.queue {
+		if q.job.ID == ID {
+			q.job.mu.Lock()
+			q.job.Priority = priority
+			q.job.mu.Unlock()
+			return nil
+		}
+	}
+	return fmt.Errorf("job %d not queued", ID)
+}
+
+// QueueItem describes a job waiting in the queue
+type QueueItem struct {
+	ID       int64    `json:"id"`
+	Group    string   `json:"group"`
+	Priority int      `json:"priority"`
+	After    []int64  `json:"after"`
+	Remotes  []string `json:"remotes"`
+	Waiting  string   `json:"waiting"` // what the job is waiting for
+}
+
+// listQueue returns the queued jobs in the order they are considered
+// to run along with the number of queued jobs running.
+func (jobs *Jobs) listQueue() (items []QueueItem, nRunning int) {
+	jobs.mu.Lock()
+	defer jobs.mu.Unlock()
+	jobs.sortQueue()
+	items = []QueueItem{}
+	for _, q := range jobs.queue {
+		waiting, err := jobs.waitingFor(q)
+		if err != nil {
+			waiting = err.Error()
+		}
+		q.job.mu.Lock()
+		items = append(items, QueueItem{
+			ID:       q.job.ID,
+			Group:    q.job.Group,
+			Priority: q.job.Priority,
+			After:    q.job.After,
+			Remotes:  q.remotes,
+			Waiting:  waiting,
+		})
+		q.job.mu.Unlock()
+	}
+	return items, jobs.nRunning
+}
+
+func init() {
+	rc.Add(rc.Call{
+		Path: "job/queue",
+		Fn:   rcJobQueue,
+		Input: []rc.Param{
+			{Name: "jobid", Type: rc.ParamInteger, Help: "id of a queued job"},
+			{Name: "priority", Type: rc.ParamInteger, Help: "the new priority for the job"},
+		},
+		Output: []rc.Param{
+			{Name: "running", Type: rc.ParamInteger, Help: "number of async jobs running"},
+			{Name: "maxRunning", Type: rc.ParamInteger, Help: "the limit from --rc-job-max-running, 0 for none"},
+			{Name: "maxRunningPerRemote", Type: rc.ParamInteger, Help: "the limit from --rc-job-max-running-per-remote, 0 for none"},
+			{Name: "queue", Type: rc.ParamArray, Help: "the queued jobs in the order they will be considered"},
+		},
+		Title: "Shows and reorders the queue of async jobs waiting to run",
+		Help: `Async jobs wait in a queue until they can run. They run when the
+jobs in their _after parameter have finished and fewer than
+--rc-job-max-running jobs are running, and fewer than
+--rc-job-max-running-per-remote on each remote they use (from their
+fs, srcFs and dstFs parameters). Jobs with a higher _priority are run
+first, then the oldest first.
+
+Parameters - optional:
+
+- jobid - id of a queued job (integer)
+- priority - the new priority for the job (integer)
+
+If jobid and priority are set then the priority of the job is changed
+before the queue is returned.
+
+Results:
+
+- running - number of async jobs running
+- maxRunning - the limit from --rc-job-max-running, 0 for none
+- maxRunningPerRemote - the limit from --rc-job-max-running-per-remote, 0 for none
+- queue - array of queued jobs in the order they will be considered, each with
+    - id - the job ID
+    - group - the stats group
+    - priority - the priority
+    - after - the IDs of the jobs it must run after
+    - remotes - the remotes it uses
+    - waiting - what it is waiting for
+`,
+	})
+}
+
+// Shows and reorders the job queue
+func rcJobQueue(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	jobID, err := in.GetInt64("jobid")
+	if rc.NotErrParamNotFound(err) {
+		return nil, err
+	}
+	priority, priorityErr := in.GetInt64("priority")
+	if rc.NotErrParamNotFound(priorityErr) {
+		return nil, priorityErr
+	}
+	if err == nil {
+		if priorityErr != nil {
+			return nil, errors.New("need priority with jobid")
+		}
+		if err = running.setPriority(jobID, int(priority)); err != nil {
+			return nil, err
+		}
+		running.dispatch()
+	}
+	items, nRunning := running.listQueue()
+	return rc.Params{
+		"running":             nRunning,
+		"maxRunning":          running.opt.JobMaxRunning,
+		"maxRunningPerRemote": running.opt.JobMaxRunningPerRemote,
+		"queue":               items,
+	}, nil
+}
@@ -0,0 +1,295 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetAfter(t *testing.T) {
+	for _, test := range []struct {
+		in   any
+		want []int64
+		err  bool
+	}{
+		{in: 1, want: []int64{1}},
+		{in: float64(2), want: []int64{2}},
+		{in: "3", want: []int64{3}},
+		{in: "1, 2,3", want: []int64{1, 2, 3}},
+		{in: []any{float64(4), "5"}, want: []int64{4, 5}},
+		{in: []int64{6, 7}, want: []int64{6, 7}},
+		{in: "potato", err: true},
+	} {
+		in := rc.Params{"_after": test.in}
+		got, err := getAfter(in)
+		if test.err {
+			assert.Error(t, err, test.in)
+			continue
+		}
+		require.NoError(t, err, test.in)
+		assert.Equal(t, test.want, got, test.in)
+		assert.NotContains(t, in, "_after")
+	}
+	got, err := getAfter(rc.Params{})
+	require.NoError(t, err)
+	assert.Nil(t, got)
+}
+
+func TestJobRemotes(t *testing.T) {
+	assert.Nil(t, jobRemotes(rc.Params{}))
+	assert.Equal(t, []string{"remote"}, jobRemotes(rc.Params{"fs": "remote:path"}))
+	assert.Equal(t, []string{"local", "remote"}, jobRemotes(rc.Params{"srcFs": "/tmp", "dstFs": "remote:"}))
+	assert.Equal(t, []string{"remote"}, jobRemotes(rc.Params{"srcFs": "remote:a", "dstFs": "remote:b"}))
+}
+
+// newQueueJobs makes a Jobs with its own options
+func newQueueJobs(maxRunning, maxRunningPerRemote int) *Jobs {
+	jobs := newJobs()
+	opt := rc.Opt
+	opt.JobMaxRunning = maxRunning
+	opt.JobMaxRunningPerRemote = maxRunningPerRemote
+	jobs.opt = &opt
+	return jobs
+}
+
+// blocker is an rc.Func which records the order the jobs start in and
+// blocks them until released
+type blocker struct {
+	started chan string
+	release chan struct{}
+}
+
+func newBlocker() *blocker {
+	return &blocker{
+		started: make(chan string, 100),
+		release: make(chan struct{}),
+	}
+}
+
+func (b *blocker) fn(ctx context.Context, in rc.Params) (rc.Params, error) {
+	name, _ := in.GetString("name")
+	b.started <- name
+	select {
+	case <-b.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if fail, _ := in.GetBool("fail"); fail {
+		return nil, errors.New("failed")
+	}
+	return nil, nil
+}
+
+// next returns the name of the next job started
+func (b *blocker) next(t *testing.T) string {
+	select {
+	case name := <-b.started:
+		return name
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for job to start")
+	}
+	return ""
+}
+
+// none checks no job starts
+func (b *blocker) none(t *testing.T) {
+	select {
+	case name := <-b.started:
+		t.Fatalf("job %q started unexpectedly", name)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// wait for job to finish
+func waitJob(t *testing.T, job *Job) {
+	finished := make(chan struct{})
+	job.OnFinish(func() { close(finished) })
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout waiting for job %d", job.ID)
+	}
+}
+
+func TestJobQueueMaxRunning(t *testing.T) {
+	ctx := context.Background()
+	jobs := newQueueJobs(1, 0)
+	b := newBlocker()
+
+	first, _, err := jobs.NewJob(ctx, b.fn, rc.Params{"_async": true, "name": "first"})
+	require.NoError(t, err)
+	assert.Equal(t, "first", b.next(t))
+
+	low, _, err := jobs.NewJob(ctx, b.fn, rc.Params{"_async": true, "name": "low"})
+	require.NoError(t, err)
+	high, _, err := jobs.NewJob(ctx, b.fn, rc.Params{"_async": true, "name": "high", "_priority": 10})
+	require.NoError(t, err)
+	b.none(t)
+
+	low.mu.Lock()
+	assert.True(t, low.Queued)
+	low.mu.Unlock()
+	items, nRunning := jobs.listQueue()
+	assert.Equal(t, 1, nRunning)
+	require.Len(t, items, 2)
+	assert.Equal(t, high.ID, items[0].ID)
+	assert.Equal(t, "max running", items[0].Waiting)
+	assert.Equal(t, low.ID, items[1].ID)
+
+	b.release <- struct{}{}
+	waitJob(t, first)
+	assert.Equal(t, "high", b.next(t))
+	b.none(t)
+	b.release <- struct{}{}
+	assert.Equal(t, "low", b.next(t))
+	b.release <- struct{}{}
+	waitJob(t, low)
+	assert.False(t, low.Queued)
+	assert.True(t, low.Success)
+	assert.Equal(t, 0, jobs.queueLen())
+}
+
+func TestJobQueueMaxRunningPerRemote(t *testing.T) {
+	ctx := context.Background()
+	jobs := newQueueJobs(0, 1)
+	b := newBlocker()
+
+	_, _, err := jobs.NewJob(ctx, b.fn, rc.Params{"_async": true, "name": "a1", "fs": "a:"})
+	require.NoError(t, err)
+	assert.Equal(t, "a1", b.next(t))
+	_, _, err = jobs.NewJob(ctx, b.fn, rc.Params{"_async": true, "name": "a2", "srcFs": "a:dir", "dstFs": "b:"})
+	require.NoError(t, err)
+	b.none(t)
+	_, _, err = jobs.NewJob(ctx, b.fn, rc.Params{"_async": true, "name": "b1", "fs": "b:"})
+	require.NoError(t, err)
+	assert.Equal(t, "b1", b.next(t))
+
+	items, nRunning := jobs.listQueue()
+	assert.Equal(t, 2, nRunning)
+	require.Len(t, items, 1)
+	assert.Equal(t, []string{"a", "b"}, items[0].Remotes)
+	assert.Equal(t, "max running on a", items[0].Waiting)
+
+	b.release <- struct{}{}
+	b.release <- struct{}{}
+	assert.Equal(t, "a2", b.next(t))
+	b.release <- struct{}{}
+}
+
+func TestJobQueueAfter(t *testing.T) {
+	ctx := context.Background()
+	jobs := newQueueJobs(0, 0)
+	b := newBlocker()
+
+	_, _, err := jobs.NewJob(ctx, b.fn, rc.Params{"_after": 123456789, "_async": true})
+	assert.ErrorContains(t, err, "not found")
+	_, _, err = jobs.NewJob(ctx, b.fn, rc.Params{"_priority": 1})
+	assert.ErrorContains(t, err, "need _async")
+
+	first, _, err := jobs.NewJob(ctx, b.fn, rc.Params{"_async": true, "name": "first", "fail": true})
+	require.NoError(t, err)
+	assert.Equal(t, "first", b.next(t))
+	second, _, err := jobs.NewJob(ctx, b.fn, rc.Params{"_async": true, "name": "second", "_after": first.ID})
+	require.NoError(t, err)
+	third, _, err := jobs.NewJob(ctx, b.fn, rc.Params{"_async": true, "name": "third", "_after": []any{second.ID}})
+	require.NoError(t, err)
+	b.none(t)
+	items, _ := jobs.listQueue()
+	require.Len(t, items, 2)
+	assert.Equal(t, []int64{first.ID}, items[0].After)
+
+	// the failure of the first job fails the ones after it
+	b.release <- struct{}{}
+	waitJob(t, third)
+	b.none(t)
+	assert.False(t, second.Success)
+	assert.Contains(t, second.Error, "failed")
+	assert.False(t, third.Success)
+	assert.Equal(t, 0, jobs.queueLen())
+
+	// runs after a successful job
+	first, _, err = jobs.NewJob(ctx, b.fn, rc.Params{"_async": true, "name": "first"})
+	require.NoError(t, err)
+	assert.Equal(t, "first", b.next(t))
+	second, _, err = jobs.NewJob(ctx, b.fn, rc.Params{"_async": true, "name": "second", "_after": first.ID})
+	require.NoError(t, err)
+	b.none(t)
+	b.release <- struct{}{}
+	assert.Equal(t, "second", b.next(t))
+	b.release <- struct{}{}
+	waitJob(t, second)
+	assert.True(t, second.Success)
+}
+
+func TestJobQueueStop(t *testing.T) {
+	ctx := context.Background()
+	jobs := newQueueJobs(1, 0)
+	b := newBlocker()
+
+	first, _, err := jobs.NewJob(ctx, b.fn, rc.Params{"_async": true, "name": "first"})
+	require.NoError(t, err)
+	assert.Equal(t, "first", b.next(t))
+	queued, _, err := jobs.NewJob(ctx, b.fn, rc.Params{"_async": true, "name": "queued"})
+	require.NoError(t, err)
+
+	queued.Stop()
+	waitJob(t, queued)
+	assert.Contains(t, queued.Error, "context canceled")
+	assert.Equal(t, 0, jobs.queueLen())
+
+	first.Stop()
+	waitJob(t, first)
+	b.none(t)
+}
+
+func TestRcJobQueue(t *testing.T) {
+	// allow one more job than the other tests left running
+	_, nRunning := running.listQueue()
+	oldMaxRunning := rc.Opt.JobMaxRunning
+	rc.Opt.JobMaxRunning = nRunning + 1
+	defer func() {
+		rc.Opt.JobMaxRunning = oldMaxRunning
+	}()
+	ctx := context.Background()
+	b := newBlocker()
+	first, _, err := NewJob(ctx, b.fn, rc.Params{"_async": true, "name": "first"})
+	require.NoError(t, err)
+	assert.Equal(t, "first", b.next(t))
+	a, _, err := NewJob(ctx, b.fn, rc.Params{"_async": true, "name": "a"})
+	require.NoError(t, err)
+	c, _, err := NewJob(ctx, b.fn, rc.Params{"_async": true, "name": "c"})
+	require.NoError(t, err)
+
+	call := rc.Calls.Get("job/queue")
+	require.NotNil(t, call)
+	out, err := call.Fn(ctx, rc.Params{})
+	require.NoError(t, err)
+	assert.Equal(t, nRunning+1, out["maxRunning"])
+	items := out["queue"].([]QueueItem)
+	require.Len(t, items, 2)
+	assert.Equal(t, a.ID, items[0].ID)
+
+	out, err = call.Fn(ctx, rc.Params{"jobid": c.ID, "priority": 5})
+	require.NoError(t, err)
+	items = out["queue"].([]QueueItem)
+	require.Len(t, items, 2)
+	assert.Equal(t, c.ID, items[0].ID)
+	assert.Equal(t, 5, items[0].Priority)
+
+	_, err = call.Fn(ctx, rc.Params{"jobid": c.ID})
+	assert.Error(t, err)
+	_, err = call.Fn(ctx, rc.Params{"jobid": first.ID, "priority": 1})
+	assert.ErrorContains(t, err, "not queued")
+
+	b.release <- struct{}{}
+	assert.Equal(t, "c", b.next(t))
+	b.release <- struct{}{}
+	assert.Equal(t, "a", b.next(t))
+	b.release <- struct{}{}
+	waitJob(t, a)
+}
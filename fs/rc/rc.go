@@ -73,6 +73,11 @@ var OptionsInfo = fs.Options{{
 	Default: false,
 	Help:    "Enable the Prometheus metrics path at the remote control server",
 	Groups:  "RC,Metrics",
+}, {
+	Name:    "rc_tokens",
+	Default: "",
+	Help:    "File of API tokens with scopes for the remote control server",
+	Groups:  "RC",
 }, {
 	Name:    "rc_job_expire_duration",
 	Default: fs.Duration(60 * time.Second),
@@ -83,6 +88,21 @@ var OptionsInfo = fs.Options{{
 	Default: fs.Duration(10 * time.Second),
 	Help:    "Interval to check for expired async jobs",
 	Groups:  "RC",
+}, {
+	Name:    "rc_job_max_running",
+	Default: 0,
+	Help:    "Max number of async jobs to run at once, 0 for no limit",
+	Groups:  "RC",
+}, {
+	Name:    "rc_job_max_running_per_remote",
+	Default: 0,
+	Help:    "Max number of async jobs to run at once on each remote, 0 for no limit",
+	Groups:  "RC",
+}, {
+	Name:    "rc_job_history",
+	Default: "",
+	Help:    "Path of a JSONL file to record finished jobs in",
+	Groups:  "RC",
 }, {
 	Name:    "metrics_addr",
 	Default: []string{},
@@ -103,25 +123,29 @@ func init() {
 
 // Options contains options for the remote control server
 type Options struct {
-	HTTP                libhttp.Config         `config:"rc"`
-	Auth                libhttp.AuthConfig     `config:"rc"`
-	Template            libhttp.TemplateConfig `config:"rc"`
-	Enabled             bool                   `config:"rc"`                         // set to enable the server
-	Files               string                 `config:"rc_files"`                   // set to enable serving files locally
-	Serve               bool                   `config:"rc_serve"`                   // set to serve files from remotes
-	ServeNoModTime      bool                   `config:"rc_serve_no_modtime"`        // don't read the modification time
-	NoAuth              bool                   `config:"rc_no_auth"`                 // set to disable auth checks on AuthRequired methods
-	WebUI               bool                   `config:"rc_web_gui"`                 // set to launch the web ui
-	WebGUIUpdate        bool                   `config:"rc_web_gui_update"`          // set to check new update
-	WebGUIForceUpdate   bool                   `config:"rc_web_gui_force_update"`    // set to force download new update
-	WebGUINoOpenBrowser bool                   `config:"rc_web_gui_no_open_browser"` // set to disable auto opening browser
-	WebGUIFetchURL      string                 `config:"rc_web_fetch_url"`           // set the default url for fetching webgui
-	EnableMetrics       bool                   `config:"rc_enable_metrics"`          // set to disable prometheus metrics on /metrics
-	MetricsHTTP         libhttp.Config         `config:"metrics"`
-	MetricsAuth         libhttp.AuthConfig     `config:"metrics"`
-	MetricsTemplate     libhttp.TemplateConfig `config:"metrics"`
-	JobExpireDuration   fs.Duration            `config:"rc_job_expire_duration"`
-	JobExpireInterval   fs.Duration            `config:"rc_job_expire_interval"`
+	HTTP                   libhttp.Config         `config:"rc"`
+	Auth                   libhttp.AuthConfig     `config:"rc"`
+	Template               libhttp.TemplateConfig `config:"rc"`
+	Enabled                bool                   `config:"rc"`                         // set to enable the server
+	Files                  string                 `config:"rc_files"`                   // set to enable serving files locally
+	Serve                  bool                   `config:"rc_serve"`                   // set to serve files from remotes
+	ServeNoModTime         bool                   `config:"rc_serve_no_modtime"`        // don't read the modification time
+	NoAuth                 bool                   `config:"rc_no_auth"`                 // set to disable auth checks on AuthRequired methods
+	WebUI                  bool                   `config:"rc_web_gui"`                 // set to launch the web ui
+	WebGUIUpdate           bool                   `config:"rc_web_gui_update"`          // set to check new update
+	WebGUIForceUpdate      bool                   `config:"rc_web_gui_force_update"`    // set to force download new update
+	WebGUINoOpenBrowser    bool                   `config:"rc_web_gui_no_open_browser"` // set to disable auto opening browser
+	WebGUIFetchURL         string                 `config:"rc_web_fetch_url"`           // set the default url for fetching webgui
+	EnableMetrics          bool                   `config:"rc_enable_metrics"`          // set to disable prometheus metrics on /metrics
+	Tokens                 string                 `config:"rc_tokens"`                  // file of API tokens with scopes
+	MetricsHTTP            libhttp.Config         `config:"metrics"`
+	MetricsAuth            libhttp.AuthConfig     `config:"metrics"`
+	MetricsTemplate        libhttp.TemplateConfig `config:"metrics"`
+	JobExpireDuration      fs.Duration            `config:"rc_job_expire_duration"`
+	JobExpireInterval      fs.Duration            `config:"rc_job_expire_interval"`
+	JobMaxRunning          int                    `config:"rc_job_max_running"`            // max async jobs running at once
+	JobMaxRunningPerRemote int                    `config:"rc_job_max_running_per_remote"` // max async jobs running at once per remote
+	JobHistory             string                 `config:"rc_job_history"`                // file to record finished jobs in
 }
 
 // Opt is the default values used for Options
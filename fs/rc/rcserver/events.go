@@ -0,0 +1,139 @@
+package rcserver
+
+// Stream stats, job and log events from /events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/fs/rc/events"
+	"golang.org/x/net/websocket"
+)
+
+// parseEventOptions reads the event options from the URL parameters
+func parseEventOptions(values url.Values) (events.Options, error) {
+	in := rc.Params{}
+	for key := range values {
+		in[key] = values.Get(key)
+	}
+	return events.ParseOptions(in)
+}
+
+// serveEvents streams events over server-sent events or a websocket
+// if the client asks to upgrade.
+func (s *Server) serveEvents(w http.ResponseWriter, r *http.Request, path string) {
+	// The events include logs so need the same auth as AuthRequired calls
+	if !s.opt.NoAuth && !s.server.UsingAuth() {
+		writeError(path, nil, w, errors.New("authentication must be set up on the rc server to use \"events\" or the --rc-no-auth flag must be in use"), http.StatusForbidden)
+		return
+	}
+	opt, err := parseEventOptions(r.URL.Query())
+	if err != nil {
+		writeError(path, nil, w, err, http.StatusBadRequest)
+		return
+	}
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		s.serveEventsWebsocket(w, r, opt)
+		return
+	}
+	s.serveEventsSSE(w, r, opt)
+}
+
+// serveEventsSSE streams events as server-sent events
+func (s *Server) serveEventsSSE(w http.ResponseWriter, r *http.Request, opt events.Options) {
+	ctx := r.Context()
+	rsc := http.NewResponseController(w)
+	// The stream lasts longer than the server write timeout
+	_ = rsc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	// subscribe before the client sees the response so it doesn't
+	// miss any events
+	sub, unsubscribe := events.Subscribe(opt)
+	defer unsubscribe()
+	w.WriteHeader(http.StatusOK)
+	if err := rsc.Flush(); err != nil {
+		fs.Errorf(nil, "rc: events: can't stream: %v", err)
+		return
+	}
+	send := func(ev events.Event) error {
+		data, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		if _, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data); err != nil {
+			return err
+		}
+		return rsc.Flush()
+	}
+	ping := func() error {
+		if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+			return err
+		}
+		return rsc.Flush()
+	}
+	err := sub.Stream(ctx, send, ping)
+	if err != nil {
+		fs.Debugf(nil, "rc: events: stream finished: %v", err)
+	}
+}
+
+// checkOrigin stops other web sites opening websockets with the
+// credentials of the browser
+func (s *Server) checkOrigin(config *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	allow := s.opt.HTTP.AllowOrigin
+	if allow == "*" || allow == origin {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return fmt.Errorf("bad origin %q: %w", origin, err)
+	}
+	if u.Host != r.Host {
+		return fmt.Errorf("origin %q not allowed", origin)
+	}
+	return nil
+}
+
+// serveEventsWebsocket streams events as JSON messages on a websocket
+func (s *Server) serveEventsWebsocket(w http.ResponseWriter, r *http.Request, opt events.Options) {
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	server := websocket.Server{
+		Handshake: s.checkOrigin,
+		Handler: func(ws *websocket.Conn) {
+			ctx, cancel := context.WithCancel(r.Context())
+			defer cancel()
+			// Read and discard messages from the client so we
+			// notice when it closes the connection
+			go func() {
+				defer cancel()
+				var msg []byte
+				for websocket.Message.Receive(ws, &msg) == nil {
+				}
+			}()
+			sub, unsubscribe := events.Subscribe(opt)
+			defer unsubscribe()
+			send := func(ev events.Event) error {
+				return websocket.JSON.Send(ws, ev)
+			}
+			err := sub.Stream(ctx, send, nil)
+			if err != nil {
+				fs.Debugf(nil, "rc: events: websocket finished: %v", err)
+			}
+		},
+	}
+	server.ServeHTTP(w, r)
+}
@@ -0,0 +1,160 @@
+package rcserver
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/fs/rc/events"
+	"github.com/rclone/rclone/fs/rc/jobs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+)
+
+func TestParseEventOptions(t *testing.T) {
+	opt, err := parseEventOptions(url.Values{
+		"types": {"job, log"},
+		"group": {"mygroup"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"job": true, "log": true}, opt.Types)
+	assert.Equal(t, "mygroup", opt.Group)
+
+	_, err = parseEventOptions(url.Values{"types": {"potato"}})
+	assert.Error(t, err)
+}
+
+func TestEventsAuthRequired(t *testing.T) {
+	tests := []testRun{{
+		Name:     "auth",
+		URL:      "events",
+		Status:   http.StatusForbidden,
+		Contains: regexp.MustCompile(`authentication must be set up`),
+	}}
+	opt := newTestOpt()
+	opt.Serve = false
+	opt.Files = ""
+	opt.NoAuth = false
+	testServer(t, tests, &opt)
+
+	tests = []testRun{{
+		Name:     "bad",
+		URL:      "events?types=potato",
+		Status:   http.StatusBadRequest,
+		Contains: regexp.MustCompile(`unknown event type`),
+	}}
+	opt.NoAuth = true
+	testServer(t, tests, &opt)
+}
+
+// start an rc server for the events tests returning its URL
+func startEventsServer(t *testing.T) string {
+	opt := newTestOpt()
+	opt.Serve = false
+	opt.Files = ""
+	opt.NoAuth = true
+	rcServer, err := newServer(context.Background(), &opt, http.NewServeMux())
+	require.NoError(t, err)
+	require.NoError(t, rcServer.Serve())
+	t.Cleanup(func() {
+		assert.NoError(t, rcServer.Shutdown())
+		rcServer.Wait()
+	})
+	return rcServer.server.URLs()[0]
+}
+
+// read server-sent events from scanner until one matches
+func readSSE(t *testing.T, scanner *bufio.Scanner, match func(ev map[string]any) bool) map[string]any {
+	for scanner.Scan() {
+		line := scanner.Text()
+		data, found := strings.CutPrefix(line, "data: ")
+		if !found {
+			continue
+		}
+		var ev map[string]any
+		require.NoError(t, json.Unmarshal([]byte(data), &ev))
+		if match(ev) {
+			return ev
+		}
+	}
+	t.Fatalf("stream ended: %v", scanner.Err())
+	return nil
+}
+
+func TestEventsSSE(t *testing.T) {
+	testURL := startEventsServer(t)
+
+	resp, err := http.Get(testURL + "events?types=job,log&group=events-test&level=notice")
+	require.NoError(t, err)
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	scanner := bufio.NewScanner(resp.Body)
+
+	job, _, err := jobs.NewJob(context.Background(), func(ctx context.Context, in rc.Params) (rc.Params, error) {
+		return nil, nil
+	}, rc.Params{"_group": "events-test"})
+	require.NoError(t, err)
+	for _, what := range []string{jobs.EventQueued, jobs.EventStarted, jobs.EventFinished} {
+		ev := readSSE(t, scanner, func(ev map[string]any) bool {
+			return ev["type"] == events.Job
+		})
+		assert.Equal(t, "events-test", ev["group"])
+		data := ev["data"].(map[string]any)
+		assert.Equal(t, what, data["event"])
+		assert.Equal(t, float64(job.ID), data["id"])
+	}
+}
+
+func TestEventsLog(t *testing.T) {
+	testURL := startEventsServer(t)
+
+	resp, err := http.Get(testURL + "events?types=log&level=notice")
+	require.NoError(t, err)
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	scanner := bufio.NewScanner(resp.Body)
+
+	fs.Debugf(nil, "events test debug")
+	fs.Logf(nil, "events test notice")
+	ev := readSSE(t, scanner, func(ev map[string]any) bool {
+		return ev["type"] == events.Log && strings.HasPrefix(ev["data"].(map[string]any)["msg"].(string), "events test")
+	})
+	data := ev["data"].(map[string]any)
+	assert.Equal(t, "events test notice", data["msg"])
+	assert.Equal(t, "notice", data["level"])
+}
+
+func TestEventsWebsocket(t *testing.T) {
+	testURL := startEventsServer(t)
+	wsURL := "ws" + strings.TrimPrefix(testURL, "http") + "events?types=stats&interval=100ms"
+
+	// another web site can't connect
+	_, err := websocket.Dial(wsURL, "", "http://example.com/")
+	assert.Error(t, err)
+
+	ws, err := websocket.Dial(wsURL, "", testURL)
+	require.NoError(t, err)
+	defer func() {
+		_ = ws.Close()
+	}()
+	require.NoError(t, ws.SetReadDeadline(time.Now().Add(10*time.Second)))
+	var ev map[string]any
+	require.NoError(t, websocket.JSON.Receive(ws, &ev))
+	assert.Equal(t, events.Stats, ev["type"])
+	data := ev["data"].(map[string]any)
+	assert.Contains(t, data, "bytes")
+}
@@ -106,10 +106,20 @@ func newServer(ctx context.Context, opt *rc.Options, mux *http.ServeMux) (*Serve
 		pluginsHandler: pluginsHandler,
 	}
 
+	auth := opt.Auth
+	if opt.Tokens != "" {
+		tokens, err := newTokenAuth(opt.Tokens, opt.Auth)
+		if err != nil {
+			return nil, err
+		}
+		auth.CustomAuthFn = tokens.check
+		auth.BearerTokens = true
+	}
+
 	var err error
 	s.server, err = libhttp.NewServer(ctx,
 		libhttp.WithConfig(opt.HTTP),
-		libhttp.WithAuth(opt.Auth),
+		libhttp.WithAuth(auth),
 		libhttp.WithTemplate(opt.Template),
 	)
 	if err != nil {
@@ -188,6 +198,16 @@ func writeError(path string, in rc.Params, w http.ResponseWriter, err error, sta
 	}
 }
 
+// serveOpenAPI writes the OpenAPI document describing the rc calls
+func (s *Server) serveOpenAPI(w http.ResponseWriter, path string) {
+	w.Header().Set("Content-Type", "application/json")
+	err := rc.WriteJSON(w, rc.Calls.OpenAPI(fs.Version))
+	if err != nil {
+		// can't return the error at this point
+		fs.Errorf(nil, "rc: %q: failed to write JSON output: %v", path, err)
+	}
+}
+
 // handler reads incoming requests and dispatches them
 func (s *Server) handler(w http.ResponseWriter, r *http.Request) {
 	path := strings.TrimLeft(r.URL.Path, "/")
@@ -262,12 +282,30 @@ func (s *Server) handlePost(w http.ResponseWriter, r *http.Request, path string)
 		return
 	}
 
+	// Check the rc token allows the call
+	if err := checkToken(r, path, call.AuthRequired); err != nil {
+		writeError(path, in, w, err, http.StatusForbidden)
+		return
+	}
+	if path == "job/batch" {
+		if err := checkBatchToken(r, in); err != nil {
+			writeError(path, in, w, err, http.StatusForbidden)
+			return
+		}
+	}
+
 	// Check to see if it requires authorisation
 	if !s.opt.NoAuth && call.AuthRequired && !s.server.UsingAuth() {
 		writeError(path, in, w, fmt.Errorf("authentication must be set up on the rc server to use %q or the --rc-no-auth flag must be in use", path), http.StatusForbidden)
 		return
 	}
 
+	// Check the parameters against the schema of the call if it has one
+	if err := call.ValidateParams(in); err != nil {
+		writeError(path, in, w, err, http.StatusBadRequest)
+		return
+	}
+
 	inOrig := in.Copy()
 
 	if call.NeedsRequest {
@@ -280,7 +318,7 @@ func (s *Server) handlePost(w http.ResponseWriter, r *http.Request, path string)
 	}
 
 	fs.Debugf(nil, "rc: %q: with parameters %+v", path, in)
-	job, out, err := jobs.NewJob(ctx, call.Fn, in)
+	job, out, err := jobs.NewJob(jobs.WithPath(ctx, path), call.Fn, in)
 	if job != nil {
 		w.Header().Add("x-rclone-jobid", fmt.Sprintf("%d", job.ID))
 	}
@@ -369,6 +407,22 @@ func (s *Server) handleGet(w http.ResponseWriter, r *http.Request, path string)
 	// Look to see if this has an fs in the path
 	fsMatchResult := fsMatch.FindStringSubmatch(path)
 
+	// Check the rc token allows the paths which aren't static files
+	tokenPath := ""
+	switch {
+	case s.opt.Serve && (fsMatchResult != nil || path == "*" || (path == "" && s.files == nil)):
+		tokenPath = "serve"
+	case path == "metrics" || path == "events" || path == "openapi.json":
+		tokenPath = path
+	}
+	if tokenPath != "" {
+		// The events include the logs so need the same auth as AuthRequired calls
+		if err := checkToken(r, tokenPath, tokenPath == "events"); err != nil {
+			writeError(path, nil, w, err, http.StatusForbidden)
+			return
+		}
+	}
+
 	switch {
 	case fsMatchResult != nil && s.opt.Serve:
 		// Serve /[fs]/remote files
@@ -377,6 +431,12 @@ func (s *Server) handleGet(w http.ResponseWriter, r *http.Request, path string)
 	case path == "metrics" && s.opt.EnableMetrics:
 		promHandlerFunc(w, r)
 		return
+	case path == "events":
+		s.serveEvents(w, r, path)
+		return
+	case path == "openapi.json":
+		s.serveOpenAPI(w, path)
+		return
 	case path == "*" && s.opt.Serve:
 		// Serve /* as the remote listing
 		s.serveRoot(w, r)
@@ -905,6 +905,53 @@ func TestContentTypeJSON(t *testing.T) {
 	testServer(t, tests, &opt)
 }
 
+func TestValidateParams(t *testing.T) {
+	tests := []testRun{{
+		Name:   "missing-param",
+		URL:    "job/stop",
+		Method: "POST",
+		Status: http.StatusBadRequest,
+		Expected: `{
+	"error": "Didn't find key \"jobid\" in input",
+	"input": {},
+	"path": "job/stop",
+	"status": 400
+}
+`,
+	}, {
+		Name:        "bad-object",
+		URL:         "config/create",
+		Method:      "POST",
+		Body:        `{"name":"potato","type":"local","parameters":"not an object"}`,
+		ContentType: "application/json",
+		Status:      http.StatusBadRequest,
+		Contains:    regexp.MustCompile(`"error": "key \\"parameters\\": `),
+	}, {
+		Name:     "url-params-parsed",
+		URL:      "job/queue?jobid=potato",
+		Method:   "POST",
+		Status:   http.StatusBadRequest,
+		Contains: regexp.MustCompile(`couldn't parse key \\"jobid\\" \(potato\) as int64`),
+	}}
+	opt := newTestOpt()
+	opt.NoAuth = true
+	testServer(t, tests, &opt)
+}
+
+func TestOpenAPI(t *testing.T) {
+	tests := []testRun{{
+		Name:     "openapi",
+		URL:      "openapi.json",
+		Status:   http.StatusOK,
+		Contains: regexp.MustCompile(`(?s)"openapi": "3.0.3".*"/job/status": \{`),
+		Headers: map[string]string{
+			"Content-Type": "application/json",
+		},
+	}}
+	opt := newTestOpt()
+	testServer(t, tests, &opt)
+}
+
 func normalizeJSON(t *testing.T, jsonStr string) string {
 	var jsonObj map[string]any
 	err := json.Unmarshal([]byte(jsonStr), &jsonObj)
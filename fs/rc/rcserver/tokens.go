@@ -0,0 +1,229 @@
+package rcserver
+
+// API tokens with scopes read from --rc-tokens
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	goauth "github.com/abbot/go-http-auth"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/fs/rc/jobs"
+	libhttp "github.com/rclone/rclone/lib/http"
+)
+
+// The scope which only gives read access. This never allows calls
+// with AuthRequired set, so none are listed in it.
+const scopeReadOnly = "read-only"
+
+// The paths allowed by each scope. Paths ending in / match all the
+// paths which start with them, others must match exactly.
+//
+// As well as the rc calls these contain "events" for /events (which
+// is treated as AuthRequired as it streams the logs), "metrics" for
+// /metrics, "openapi.json" for /openapi.json and "serve" for serving
+// remotes with --rc-serve.
+var scopes = map[string][]string{
+	scopeReadOnly: {
+		"cache/stats",
+		"core/group-list",
+		"core/stats",
+		"core/transferred",
+		"core/version",
+		"job/list",
+		"job/status",
+		"metrics",
+		"openapi.json",
+		"operations/fsinfo",
+		"options/info",
+		"rc/list",
+		"rc/noop",
+		"vfs/list",
+		"vfs/stats",
+	},
+	"operations": {
+		"backend/",
+		"job/",
+		"mount/",
+		"operations/",
+		"serve",
+		"sync/",
+		"vfs/",
+	},
+	"config": {
+		"config/",
+		"options/",
+	},
+	"admin": {
+		"",
+	},
+}
+
+// rcToken is an API token read from the --rc-tokens file
+type rcToken struct {
+	Name   string   `json:"name"`   // name of the token, used as the user with basic auth
+	Token  string   `json:"token"`  // the secret
+	Scopes []string `json:"scopes"` // the scopes the token has
+	Paths  []string `json:"paths"`  // extra paths the token may use
+}
+
+// matchPath returns true if path matches one of the patterns
+func matchPath(patterns []string, path string) bool {
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, "/") || pattern == "" {
+			if strings.HasPrefix(path, pattern) {
+				return true
+			}
+		} else if path == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// allows returns true if the token may use path. Calls with
+// authRequired set need a scope other than read-only.
+func (t *rcToken) allows(path string, authRequired bool) bool {
+	if matchPath(t.Paths, path) {
+		return true
+	}
+	for _, scope := range t.Scopes {
+		if scope == scopeReadOnly && authRequired {
+			continue
+		}
+		if matchPath(scopes[scope], path) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadTokens reads the tokens from the file at path
+func loadTokens(path string) ([]*rcToken, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rc tokens: %w", err)
+	}
+	var tokens []*rcToken
+	if err = json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("failed to parse rc tokens %q: %w", path, err)
+	}
+	names := map[string]bool{}
+	for i, t := range tokens {
+		switch {
+		case t.Name == "":
+			return nil, fmt.Errorf("rc token %d has no name", i+1)
+		case names[t.Name]:
+			return nil, fmt.Errorf("rc token %q is duplicated", t.Name)
+		case len(t.Token) < 16:
+			return nil, fmt.Errorf("rc token %q must be at least 16 characters", t.Name)
+		case len(t.Scopes) == 0 && len(t.Paths) == 0:
+			return nil, fmt.Errorf("rc token %q has no scopes or paths", t.Name)
+		}
+		for _, scope := range t.Scopes {
+			if _, found := scopes[scope]; !found {
+				return nil, fmt.Errorf("rc token %q has unknown scope %q", t.Name, scope)
+			}
+		}
+		names[t.Name] = true
+	}
+	fs.Infof(nil, "Loaded %d rc tokens from %q", len(tokens), path)
+	return tokens, nil
+}
+
+// tokenAuth authenticates the rc tokens and the users from --rc-user
+// and --rc-htpasswd who get the admin scope
+type tokenAuth struct {
+	tokens []*rcToken
+	auth   libhttp.AuthConfig
+	htpass *goauth.BasicAuth
+}
+
+// newTokenAuth reads the tokens from path
+func newTokenAuth(path string, auth libhttp.AuthConfig) (*tokenAuth, error) {
+	tokens, err := loadTokens(path)
+	if err != nil {
+		return nil, err
+	}
+	ta := &tokenAuth{
+		tokens: tokens,
+		auth:   auth,
+	}
+	if auth.HtPasswd != "" {
+		ta.htpass = goauth.NewBasicAuthenticator(auth.Realm, goauth.HtpasswdFileProvider(auth.HtPasswd))
+	}
+	return ta, nil
+}
+
+// equal compares secrets in constant time
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// check is a libhttp.CustomAuthFn returning the *rcToken for the user
+// and pass.
+//
+// With a bearer token user is empty and pass is the token.
+func (ta *tokenAuth) check(user, pass string) (value any, err error) {
+	for _, t := range ta.tokens {
+		if (user == "" || user == t.Name) && equal(pass, t.Token) {
+			return t, nil
+		}
+	}
+	if user == "" {
+		return nil, errors.New("unknown token")
+	}
+	admin := &rcToken{Name: user, Scopes: []string{"admin"}}
+	if ta.auth.BasicUser != "" && user == ta.auth.BasicUser && equal(pass, ta.auth.BasicPass) {
+		return admin, nil
+	}
+	if ta.htpass != nil {
+		// reuse the htpasswd checking which needs a request
+		r, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			return nil, err
+		}
+		r.SetBasicAuth(user, pass)
+		if ta.htpass.CheckAuth(r) != "" {
+			return admin, nil
+		}
+	}
+	return nil, errors.New("bad user or token")
+}
+
+// checkToken returns an error if the token the request was
+// authenticated with doesn't allow path.
+func checkToken(r *http.Request, path string, authRequired bool) error {
+	t, ok := libhttp.CtxGetAuth(r.Context()).(*rcToken)
+	if !ok {
+		// not using tokens
+		return nil
+	}
+	if !t.allows(path, authRequired) {
+		return fmt.Errorf("rc token %q is not allowed to use %q", t.Name, path)
+	}
+	return nil
+}
+
+// checkBatchToken returns an error if the token the request was
+// authenticated with doesn't allow one of the calls in the job/batch
+// call with parameters in.
+func checkBatchToken(r *http.Request, in rc.Params) error {
+	for _, path := range jobs.BatchPaths(in) {
+		call := rc.Calls.Get(path)
+		if call == nil {
+			// job/batch returns the error for this
+			continue
+		}
+		if err := checkToken(r, path, call.AuthRequired); err != nil {
+			return err
+		}
+	}
+	return nil
+}
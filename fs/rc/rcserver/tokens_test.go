@@ -0,0 +1,230 @@
+package rcserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/rclone/rclone/fs/config/configfile"
+	"github.com/rclone/rclone/fs/rc"
+	libhttp "github.com/rclone/rclone/lib/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testTokens = `[
+	{"name": "monitor", "token": "monitor-0123456789", "scopes": ["read-only"]},
+	{"name": "ops", "token": "ops-0123456789abcdef", "scopes": ["operations"], "paths": ["rc/noopauth"]}
+]`
+
+// write tokens to a temporary file returning its path
+func writeTokens(t *testing.T, tokens string) string {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	require.NoError(t, os.WriteFile(path, []byte(tokens), 0600))
+	return path
+}
+
+func TestLoadTokens(t *testing.T) {
+	tokens, err := loadTokens(writeTokens(t, testTokens))
+	require.NoError(t, err)
+	require.Len(t, tokens, 2)
+	assert.Equal(t, "monitor", tokens[0].Name)
+	assert.Equal(t, []string{"rc/noopauth"}, tokens[1].Paths)
+
+	_, err = loadTokens(filepath.Join(t.TempDir(), "notfound.json"))
+	assert.Error(t, err)
+	for _, bad := range []string{
+		`potato`,
+		`[{"token": "0123456789abcdef", "scopes": ["admin"]}]`,
+		`[{"name": "a", "token": "short", "scopes": ["admin"]}]`,
+		`[{"name": "a", "token": "0123456789abcdef"}]`,
+		`[{"name": "a", "token": "0123456789abcdef", "scopes": ["potato"]}]`,
+		`[{"name": "a", "token": "0123456789abcdef", "scopes": ["admin"]}, {"name": "a", "token": "0123456789abcdefg", "scopes": ["admin"]}]`,
+	} {
+		_, err = loadTokens(writeTokens(t, bad))
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestTokenAllows(t *testing.T) {
+	readOnly := &rcToken{Scopes: []string{"read-only"}}
+	ops := &rcToken{Scopes: []string{"operations"}, Paths: []string{"core/command", "cache/"}}
+	admin := &rcToken{Scopes: []string{"admin"}}
+	for _, test := range []struct {
+		token        *rcToken
+		path         string
+		authRequired bool
+		want         bool
+	}{
+		{readOnly, "core/stats", false, true},
+		{readOnly, "core/stats", true, false},
+		{readOnly, "core/statsx", false, false},
+		{readOnly, "config/delete", false, false},
+		{readOnly, "events", true, false},
+		{readOnly, "operations/list", true, false},
+		{ops, "events", true, false},
+		{readOnly, "openapi.json", false, true},
+		{readOnly, "serve", false, false},
+		{ops, "operations/purge", true, true},
+		{ops, "sync/sync", false, true},
+		{ops, "serve", false, true},
+		{ops, "config/delete", true, false},
+		{ops, "core/command", true, true},
+		{ops, "cache/expire", true, true},
+		{ops, "core/stats", false, false},
+		{admin, "core/command", true, true},
+		{admin, "config/delete", true, true},
+	} {
+		assert.Equal(t, test.want, test.token.allows(test.path, test.authRequired), "%v %q %v", test.token.Scopes, test.path, test.authRequired)
+	}
+}
+
+func TestTokenReadOnlyScope(t *testing.T) {
+	// read-only can never make AuthRequired calls so shouldn't list any
+	for _, path := range scopes[scopeReadOnly] {
+		if call := rc.Calls.Get(path); call != nil {
+			assert.False(t, call.AuthRequired, path)
+		}
+	}
+}
+
+func TestTokenAuthCheck(t *testing.T) {
+	auth := libhttp.AuthConfig{BasicUser: "user", BasicPass: "pass"}
+	ta, err := newTokenAuth(writeTokens(t, testTokens), auth)
+	require.NoError(t, err)
+
+	value, err := ta.check("monitor", "monitor-0123456789")
+	require.NoError(t, err)
+	assert.Equal(t, "monitor", value.(*rcToken).Name)
+
+	value, err = ta.check("", "ops-0123456789abcdef")
+	require.NoError(t, err)
+	assert.Equal(t, "ops", value.(*rcToken).Name)
+
+	value, err = ta.check("user", "pass")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"admin"}, value.(*rcToken).Scopes)
+
+	for _, bad := range [][2]string{
+		{"monitor", "ops-0123456789abcdef"},
+		{"", "potato"},
+		{"user", "potato"},
+		{"potato", "pass"},
+	} {
+		_, err = ta.check(bad[0], bad[1])
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestTokensServer(t *testing.T) {
+	opt := newTestOpt()
+	opt.Serve = true
+	opt.Files = ""
+	opt.NoAuth = false
+	opt.Tokens = writeTokens(t, testTokens)
+	tests := []testRun{{
+		Name:     "no-auth",
+		URL:      "core/stats",
+		Method:   "POST",
+		Status:   http.StatusUnauthorized,
+		Contains: regexp.MustCompile(`Unauthorized`),
+	}, {
+		Name:     "read-only-allowed",
+		URL:      "rc/noop?potato=1",
+		Method:   "POST",
+		User:     "monitor",
+		Pass:     "monitor-0123456789",
+		Status:   http.StatusOK,
+		Contains: regexp.MustCompile(`"potato": "1"`),
+	}, {
+		Name:     "read-only-denied",
+		URL:      "config/delete?name=potato",
+		Method:   "POST",
+		User:     "monitor",
+		Pass:     "monitor-0123456789",
+		Status:   http.StatusForbidden,
+		Contains: regexp.MustCompile(`rc token \\"monitor\\" is not allowed to use \\"config/delete\\"`),
+	}, {
+		Name:     "read-only-serve-denied",
+		URL:      remoteURL,
+		User:     "monitor",
+		Pass:     "monitor-0123456789",
+		Status:   http.StatusForbidden,
+		Contains: regexp.MustCompile(`not allowed`),
+	}, {
+		Name:     "paths-auth-required",
+		URL:      "rc/noopauth",
+		Method:   "POST",
+		User:     "ops",
+		Pass:     "ops-0123456789abcdef",
+		Status:   http.StatusOK,
+		Contains: regexp.MustCompile(`{}`),
+	}, {
+		Name:        "ops-batch-allowed",
+		URL:         "job/batch",
+		Method:      "POST",
+		Body:        `{"inputs":[{"_path":"rc/noopauth","a":"b"}]}`,
+		ContentType: "application/json",
+		User:        "ops",
+		Pass:        "ops-0123456789abcdef",
+		Status:      http.StatusOK,
+		Contains:    regexp.MustCompile(`"a": "b"`),
+	}, {
+		Name:        "ops-batch-denied",
+		URL:         "job/batch",
+		Method:      "POST",
+		Body:        `{"inputs":[{"_path":"rc/noopauth"},{"_path":"config/delete","name":"potato"}]}`,
+		ContentType: "application/json",
+		User:        "ops",
+		Pass:        "ops-0123456789abcdef",
+		Status:      http.StatusForbidden,
+		Contains:    regexp.MustCompile(`rc token \\"ops\\" is not allowed to use \\"config/delete\\"`),
+	}, {
+		Name:        "ops-nested-batch-denied",
+		URL:         "job/batch",
+		Method:      "POST",
+		Body:        `{"inputs":[{"_path":"job/batch","inputs":[{"_path":"config/delete","name":"potato"}]}]}`,
+		ContentType: "application/json",
+		User:        "ops",
+		Pass:        "ops-0123456789abcdef",
+		Status:      http.StatusForbidden,
+		Contains:    regexp.MustCompile(`rc token \\"ops\\" is not allowed to use \\"config/delete\\"`),
+	}, {
+		Name:     "ops-serve",
+		URL:      remoteURL + "file.txt",
+		User:     "ops",
+		Pass:     "ops-0123456789abcdef",
+		Status:   http.StatusOK,
+		Contains: regexp.MustCompile(`this is file1.txt`),
+	}}
+	testServer(t, tests, &opt)
+}
+
+func TestTokensBearer(t *testing.T) {
+	opt := newTestOpt()
+	opt.Serve = false
+	opt.Files = ""
+	opt.Tokens = writeTokens(t, testTokens)
+	configfile.Install()
+	opt.Template.Path = defaultTestTemplate
+	rcServer, err := newServer(context.Background(), &opt, http.DefaultServeMux)
+	require.NoError(t, err)
+	mux := rcServer.server.Router()
+
+	do := func(token, path string) int {
+		req, err := http.NewRequest("POST", "http://1.2.3.4/"+path, nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w.Result().StatusCode
+	}
+	assert.Equal(t, http.StatusOK, do("monitor-0123456789", "rc/noop"))
+	assert.Equal(t, http.StatusForbidden, do("monitor-0123456789", "rc/noopauth"))
+	assert.Equal(t, http.StatusOK, do("ops-0123456789abcdef", "rc/noopauth"))
+	assert.Equal(t, http.StatusUnauthorized, do("potato", "rc/noop"))
+}
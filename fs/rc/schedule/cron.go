@@ -0,0 +1,205 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronField describes one of the fields of a cron schedule
+type cronField struct {
+	name     string
+	min, max int
+	names    []string // names of the values starting at min if any
+}
+
+var (
+	minuteField = cronField{name: "minute", min: 0, max: 59}
+	hourField   = cronField{name: "hour", min: 0, max: 23}
+	domField    = cronField{name: "day of month", min: 1, max: 31}
+	monthField  = cronField{name: "month", min: 1, max: 12, names: []string{
+		"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec",
+	}}
+	dowField = cronField{name: "day of week", min: 0, max: 7, names: []string{
+		"sun", "mon", "tue", "wed", "thu", "fri", "sat",
+	}}
+)
+
+// Shorthands for common schedules
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronSpec is a parsed cron style schedule
+type cronSpec struct {
+	minute, hour, dom, month, dow uint64 // bit sets of the allowed values
+
+	// If both day of month and day of week are restricted then a day
+	// matching either matches, as in cron
+	domStar, dowStar bool
+
+	every time.Duration // interval for "@every" schedules
+}
+
+// parseCron parses a cron style schedule.
+//
+// This is five space separated fields: minute, hour, day of month,
+// month and day of week. Each field is a comma separated list of
+// values, ranges "a-b" or "*", each optionally followed by a step
+// "/n". Months and days of the week may be given by their first three
+// letters and Sunday is 0 or 7.
+//
+// The macros @yearly, @monthly, @weekly, @daily and @hourly are
+// accepted as is "@every duration", e.g. "@every 1h30m".
+func parseCron(s string) (*cronSpec, error) {
+	s = strings.TrimSpace(s)
+	if rest, ok := strings.CutPrefix(s, "@every "); ok {
+		every, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil {
+			return nil, fmt.Errorf("bad schedule %q: %w", s, err)
+		}
+		if every < time.Second {
+			return nil, fmt.Errorf("bad schedule %q: interval must be at least 1s", s)
+		}
+		return &cronSpec{every: every}, nil
+	}
+	expr := s
+	if macro, ok := cronMacros[strings.ToLower(s)]; ok {
+		expr = macro
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("bad schedule %q: need 5 fields: minute hour day-of-month month day-of-week", s)
+	}
+	c := &cronSpec{
+		domStar: fields[2] == "*",
+		dowStar: fields[4] == "*",
+	}
+	var err error
+	for i, p := range []struct {
+		bits  *uint64
+		field cronField
+	}{
+		{&c.minute, minuteField},
+		{&c.hour, hourField},
+		{&c.dom, domField},
+		{&c.month, monthField},
+		{&c.dow, dowField},
+	} {
+		*p.bits, err = p.field.parse(fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("bad schedule %q: %w", s, err)
+		}
+	}
+	// Sunday may be 0 or 7
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	return c, nil
+}
+
+// parse the field returning the bit set of values it allows
+func (f cronField) parse(s string) (bits uint64, err error) {
+	for part := range strings.SplitSeq(s, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			step, err = strconv.Atoi(stepPart)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("bad step %q in %s", stepPart, f.name)
+			}
+		}
+		var lo, hi int
+		if rangePart == "*" {
+			lo, hi = f.min, f.max
+		} else {
+			loPart, hiPart, isRange := strings.Cut(rangePart, "-")
+			lo, err = f.value(loPart)
+			if err != nil {
+				return 0, err
+			}
+			hi = lo
+			if isRange {
+				hi, err = f.value(hiPart)
+				if err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				// "5/15" means every 15 starting at 5
+				hi = f.max
+			}
+			if hi < lo {
+				return 0, fmt.Errorf("bad range %q in %s", rangePart, f.name)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// value parses a single value of the field
+func (f cronField) value(s string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return f.min + i, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("bad %s %q: must be %d-%d", f.name, s, f.min, f.max)
+	}
+	return v, nil
+}
+
+// errNoNext is returned if the schedule never matches, e.g. "0 0 31 2 *"
+var errNoNext = errors.New("schedule never runs")
+
+// next returns the first time the schedule matches after t
+func (c *cronSpec) next(t time.Time) (time.Time, error) {
+	if c.every > 0 {
+		return t.Truncate(time.Second).Add(c.every), nil
+	}
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// give up if nothing matches in 5 years which allows for leap years
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t, nil
+	}
+	return time.Time{}, errNoNext
+}
+
+// dayMatches returns true if the day of t matches the schedule
+func (c *cronSpec) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,105 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCron(t *testing.T) {
+	for _, test := range []struct {
+		in  string
+		err bool
+	}{
+		{in: "* * * * *"},
+		{in: "0 3 * * *"},
+		{in: "*/15 0-6,22,23 1-31/2 jan-jun mon-fri"},
+		{in: "5/10 * * * SUN,7"},
+		{in: "@daily"},
+		{in: "@HOURLY"},
+		{in: "@every 1h30m"},
+		{in: "", err: true},
+		{in: "* * * *", err: true},
+		{in: "* * * * * *", err: true},
+		{in: "60 * * * *", err: true},
+		{in: "* 24 * * *", err: true},
+		{in: "* * 0 * *", err: true},
+		{in: "* * * 13 *", err: true},
+		{in: "* * * * 8", err: true},
+		{in: "5-1 * * * *", err: true},
+		{in: "*/0 * * * *", err: true},
+		{in: "* * * foo *", err: true},
+		{in: "@every", err: true},
+		{in: "@every 10ms", err: true},
+		{in: "@every potato", err: true},
+		{in: "@fortnightly", err: true},
+	} {
+		_, err := parseCron(test.in)
+		if test.err {
+			assert.Error(t, err, test.in)
+		} else {
+			assert.NoError(t, err, test.in)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// Wednesday
+	start := time.Date(2025, 1, 15, 10, 20, 30, 0, time.UTC)
+	for _, test := range []struct {
+		in   string
+		want []time.Time
+	}{
+		{"* * * * *", []time.Time{
+			time.Date(2025, 1, 15, 10, 21, 0, 0, time.UTC),
+			time.Date(2025, 1, 15, 10, 22, 0, 0, time.UTC),
+		}},
+		{"0 3 * * *", []time.Time{
+			time.Date(2025, 1, 16, 3, 0, 0, 0, time.UTC),
+			time.Date(2025, 1, 17, 3, 0, 0, 0, time.UTC),
+		}},
+		{"*/20 10,12 * * *", []time.Time{
+			time.Date(2025, 1, 15, 10, 40, 0, 0, time.UTC),
+			time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC),
+			time.Date(2025, 1, 15, 12, 20, 0, 0, time.UTC),
+		}},
+		{"0 0 * * sat,sun", []time.Time{
+			time.Date(2025, 1, 18, 0, 0, 0, 0, time.UTC),
+			time.Date(2025, 1, 19, 0, 0, 0, 0, time.UTC),
+			time.Date(2025, 1, 25, 0, 0, 0, 0, time.UTC),
+		}},
+		// either day of month or day of week matches
+		{"0 0 20 * mon", []time.Time{
+			time.Date(2025, 1, 20, 0, 0, 0, 0, time.UTC),
+			time.Date(2025, 1, 27, 0, 0, 0, 0, time.UTC),
+			time.Date(2025, 2, 3, 0, 0, 0, 0, time.UTC),
+		}},
+		{"0 12 29 feb *", []time.Time{
+			time.Date(2028, 2, 29, 12, 0, 0, 0, time.UTC),
+		}},
+		{"@monthly", []time.Time{
+			time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC),
+		}},
+		{"@every 90m", []time.Time{
+			time.Date(2025, 1, 15, 11, 50, 30, 0, time.UTC),
+			time.Date(2025, 1, 15, 13, 20, 30, 0, time.UTC),
+		}},
+	} {
+		spec, err := parseCron(test.in)
+		require.NoError(t, err, test.in)
+		next := start
+		for _, want := range test.want {
+			next, err = spec.next(next)
+			require.NoError(t, err, test.in)
+			assert.Equal(t, want, next, test.in)
+		}
+	}
+
+	spec, err := parseCron("0 0 31 feb *")
+	require.NoError(t, err)
+	_, err = spec.next(start)
+	assert.Equal(t, errNoNext, err)
+}
@@ -0,0 +1,182 @@
+package schedule
+
+import (
+	"context"
+	"strings"
+
+	"github.com/rclone/rclone/fs/rc"
+)
+
+// q turns | into ` so the help can use back quotes
+func q(s string) string {
+	return strings.ReplaceAll(s, "|", "`")
+}
+
+func init() {
+	rc.Add(rc.Call{
+		Path:         "schedule/add",
+		AuthRequired: true,
+		Fn:           rcAdd,
+		Title:        "Add an rc call to run on a schedule",
+		Help: q(`This adds an rc call which |rclone rcd| runs on a cron style
+schedule, for example a nightly sync. The schedules are saved in
+|schedules.json| next to the config file so they survive restarts.
+Runs missed while rclone wasn't running aren't caught up.
+
+This takes the following parameters:
+
+- schedule - when to run the call, see below
+- command - the rc call to run, e.g. |sync/sync|
+- params - the parameters to pass to it (optional)
+- id - the ID for the schedule (optional, made up if not set)
+
+The schedule has five space separated fields: minute, hour, day of
+month, month and day of week. Each is a comma separated list of
+values, ranges |a-b| or |*|, each optionally followed by a step |/n|.
+Months and days of the week may be given by their first three letters
+and Sunday is 0 or 7. For example |30 2 * * *| runs at 02:30 every day
+and |0 */6 * * mon-fri| runs every 6 hours on weekdays. The schedules
+|@hourly|, |@daily|, |@weekly|, |@monthly| and |@yearly| and intervals
+such as |@every 1h30m| may also be used. Times are in the local time
+zone of rclone.
+
+The call is run as an asynchronous job in the group
+|schedule/<id>| (unless |_group| is set in the params) so it can be
+followed with |job/status| and stopped with |job/stopgroup|. If the
+previous run is still going when the call is due it isn't run again.
+
+Returns
+
+- id - the ID of the schedule
+- next - when it will next run
+
+Example:
+
+    rclone rc schedule/add schedule="0 3 * * *" command=sync/sync \
+        --json '{"params": {"srcFs": "/home/me", "dstFs": "remote:backup"}}'
+`),
+	})
+}
+
+// Add a schedule
+func rcAdd(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	schedule, err := in.GetString("schedule")
+	if err != nil {
+		return nil, err
+	}
+	command, err := in.GetString("command")
+	if err != nil {
+		return nil, err
+	}
+	id, err := in.GetString("id")
+	if rc.NotErrParamNotFound(err) {
+		return nil, err
+	}
+	var params rc.Params
+	err = in.GetStructMissingOK("params", &params)
+	if err != nil {
+		return nil, err
+	}
+	e, err := scheduler.add(id, schedule, command, params)
+	if err != nil {
+		return nil, err
+	}
+	return rc.Params{
+		"id":   e.ID,
+		"next": e.Next,
+	}, nil
+}
+
+func init() {
+	rc.Add(rc.Call{
+		Path:         "schedule/list",
+		AuthRequired: true,
+		Fn:           rcList,
+		Title:        "List the scheduled rc calls",
+		Help: q(`This takes no parameters and returns
+
+- schedules - list of schedules with
+    - id - the ID of the schedule
+    - schedule - when the call runs
+    - command - the rc call
+    - params - its parameters
+    - created - when the schedule was added
+    - lastRun - when it was last started
+    - lastJobId - the job ID of the last run
+    - lastError - the error of the last run, or |""| if it succeeded
+    - running - true if the last run hasn't finished
+    - skipped - number of runs skipped as the previous one was still running
+    - next - when it will next run
+`),
+	})
+}
+
+// List the schedules
+func rcList(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	entries, err := scheduler.copyEntries()
+	if err != nil {
+		return nil, err
+	}
+	return rc.Params{
+		"schedules": entries,
+	}, nil
+}
+
+func init() {
+	rc.Add(rc.Call{
+		Path:         "schedule/remove",
+		AuthRequired: true,
+		Fn:           rcRemove,
+		Title:        "Remove a scheduled rc call",
+		Help: q(`This takes the following parameters:
+
+- id - the ID of the schedule
+
+A run in progress isn't stopped - use |job/stop| for that.
+`),
+	})
+}
+
+// Remove a schedule
+func rcRemove(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	id, err := in.GetString("id")
+	if err != nil {
+		return nil, err
+	}
+	return rc.Params{}, scheduler.remove(id)
+}
+
+func init() {
+	rc.Add(rc.Call{
+		Path:         "schedule/run-now",
+		AuthRequired: true,
+		Fn:           rcRunNow,
+		Title:        "Run a scheduled rc call now",
+		Help: q(`This runs the rc call of a schedule now without changing when it
+next runs. It fails if the previous run is still going.
+
+This takes the following parameters:
+
+- id - the ID of the schedule
+
+Returns
+
+- jobid - the ID of the job started
+`),
+	})
+}
+
+// Run a schedule now
+func rcRunNow(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	id, err := in.GetString("id")
+	if err != nil {
+		return nil, err
+	}
+	jobID, err := scheduler.runNow(id)
+	if err != nil {
+		return nil, err
+	}
+	return rc.Params{
+		"jobid": jobID,
+	}, nil
+}
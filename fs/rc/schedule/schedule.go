@@ -0,0 +1,388 @@
+// Package schedule runs rc calls on cron style schedules in rclone rcd
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/fs/rc/jobs"
+)
+
+// The name of the file the schedules are saved in, which is in the
+// same directory as the config file
+const scheduleFileName = "schedules.json"
+
+// Entry is an rc call run on a schedule
+type Entry struct {
+	ID       string    `json:"id"`       // unique ID of the entry
+	Schedule string    `json:"schedule"` // cron style schedule
+	Command  string    `json:"command"`  // the rc call to run, e.g. "sync/sync"
+	Params   rc.Params `json:"params"`   // parameters of the rc call
+	Created  time.Time `json:"created"`  // when the entry was added
+
+	LastRun   time.Time `json:"lastRun"`   // when it was last started
+	LastJobID int64     `json:"lastJobId"` // the ID of the job last started
+	LastError string    `json:"lastError"` // error from the last run if any
+	Skipped   int       `json:"skipped"`   // runs skipped because the last was still running
+	Next      time.Time `json:"next"`      // when it will next run
+	Running   bool      `json:"running"`   // set if the last run hasn't finished
+
+	spec *cronSpec
+}
+
+// Scheduler runs the entries when they are due
+type Scheduler struct {
+	mu      sync.Mutex
+	ctx     context.Context    // context for the jobs run
+	path    string             // where to save the entries, "" not to
+	entries map[string]*Entry  // the entries by ID
+	wake    chan struct{}      // poke the scheduler to re-read the entries
+	cancel  context.CancelFunc // set when running
+}
+
+// newScheduler makes a scheduler which saves its entries to path if set
+func newScheduler(path string) *Scheduler {
+	return &Scheduler{
+		path:    path,
+		entries: map[string]*Entry{},
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// The scheduler of the rc
+var scheduler = newScheduler("")
+
+// Start the scheduler of the rc loading the saved entries.
+//
+// Only rclone rcd runs the scheduler - the schedule rc calls return
+// an error otherwise.
+func Start(ctx context.Context) error {
+	configPath := config.GetConfigPath()
+	if configPath != "" {
+		scheduler.path = filepath.Join(filepath.Dir(configPath), scheduleFileName)
+	}
+	return scheduler.start(ctx)
+}
+
+// start the scheduler loading the entries
+func (s *Scheduler) start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		return errors.New("scheduler already running")
+	}
+	if err := s.load(); err != nil {
+		return err
+	}
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.ctx = ctx
+	go s.loop(ctx)
+	return nil
+}
+
+// stop the scheduler
+func (s *Scheduler) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		s.cancel()
+		s.cancel = nil
+	}
+}
+
+// load the entries from the file if it exists
+//
+// Call with the lock held.
+func (s *Scheduler) load() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read schedules: %w", err)
+	}
+	var entries []*Entry
+	if err = json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("failed to parse schedules %q: %w", s.path, err)
+	}
+	now := time.Now()
+	for _, e := range entries {
+		e.spec, err = parseCron(e.Schedule)
+		if err != nil {
+			return fmt.Errorf("failed to load schedule %q: %w", e.ID, err)
+		}
+		e.Running = false
+		e.Next, _ = e.spec.next(now)
+		s.entries[e.ID] = e
+	}
+	fs.Debugf(nil, "Loaded %d schedules from %q", len(entries), s.path)
+	return nil
+}
+
+// save the entries to the file
+//
+// Call with the lock held.
+func (s *Scheduler) save() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.list(), "", "\t")
+	if err != nil {
+		return err
+	}
+	// write to a temporary file then rename so the file is never
+	// left half written
+	tmpPath := s.path + ".tmp"
+	if err = os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to save schedules: %w", err)
+	}
+	if err = os.Rename(tmpPath, s.path); err != nil {
+		return fmt.Errorf("failed to save schedules: %w", err)
+	}
+	return nil
+}
+
+// saveOrLog saves the entries logging any errors
+//
+// Call with the lock held.
+func (s *Scheduler) saveOrLog() {
+	if err := s.save(); err != nil {
+		fs.Errorf(nil, "Schedule: %v", err)
+	}
+}
+
+// list the entries sorted by ID
+//
+// Call with the lock held.
+func (s *Scheduler) list() []*Entry {
+	list := make([]*Entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// poke the scheduler to look at the entries again
+func (s *Scheduler) poke() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// loop running the entries when they are due until ctx is cancelled
+func (s *Scheduler) loop(ctx context.Context) {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		s.mu.Lock()
+		now := time.Now()
+		var next time.Time
+		for _, e := range s.list() {
+			if e.Next.IsZero() {
+				continue
+			}
+			if !e.Next.After(now) {
+				if _, err := s.run(e); err != nil {
+					fs.Errorf(nil, "Schedule %q: %v", e.ID, err)
+				}
+				var err error
+				e.Next, err = e.spec.next(now)
+				if err != nil {
+					fs.Errorf(nil, "Schedule %q: %v", e.ID, err)
+					continue
+				}
+			}
+			if next.IsZero() || e.Next.Before(next) {
+				next = e.Next
+			}
+		}
+		s.mu.Unlock()
+
+		wait := time.Hour
+		if !next.IsZero() {
+			wait = time.Until(next)
+		}
+		timer.Reset(wait)
+		select {
+		case <-timer.C:
+		case <-s.wake:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// run the entry as a job unless it is already running, returning the
+// ID of the job.
+//
+// Call with the lock held.
+func (s *Scheduler) run(e *Entry) (jobID int64, err error) {
+	if e.Running {
+		e.Skipped++
+		return 0, fmt.Errorf("not running %q as job %d is still running", e.Command, e.LastJobID)
+	}
+	defer s.saveOrLog()
+	e.LastRun = time.Now()
+	call := rc.Calls.Get(e.Command)
+	if call == nil {
+		e.LastError = fmt.Sprintf("couldn't find rc call %q", e.Command)
+		return 0, errors.New(e.LastError)
+	}
+	in := e.Params.Copy()
+	in["_async"] = true
+	if _, found := in["_group"]; !found {
+		in["_group"] = "schedule/" + e.ID
+	}
+	job, _, err := jobs.NewJob(jobs.WithPath(s.ctx, e.Command), call.Fn, in)
+	if err != nil {
+		e.LastError = err.Error()
+		return 0, err
+	}
+	fs.Infof(nil, "Schedule %q: started %q as job %d", e.ID, e.Command, job.ID)
+	e.Running = true
+	e.LastJobID = job.ID
+	e.LastError = ""
+	job.OnFinish(func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if e.LastJobID != job.ID {
+			return
+		}
+		e.Running = false
+		e.LastError = job.Error
+		if job.Error != "" {
+			fs.Errorf(nil, "Schedule %q: job %d failed: %s", e.ID, job.ID, job.Error)
+		} else {
+			fs.Infof(nil, "Schedule %q: job %d finished", e.ID, job.ID)
+		}
+		s.saveOrLog()
+	})
+	return job.ID, nil
+}
+
+// checkRunning returns an error if the scheduler isn't running
+//
+// Call with the lock held.
+func (s *Scheduler) checkRunning() error {
+	if s.cancel == nil {
+		return errors.New("the scheduler only runs in rclone rcd")
+	}
+	return nil
+}
+
+// add an entry returning it
+func (s *Scheduler) add(id, schedule, command string, params rc.Params) (*Entry, error) {
+	spec, err := parseCron(schedule)
+	if err != nil {
+		return nil, err
+	}
+	next, err := spec.next(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if rc.Calls.Get(command) == nil {
+		return nil, fmt.Errorf("couldn't find rc call %q", command)
+	}
+	if strings.HasPrefix(command, "schedule/") {
+		return nil, fmt.Errorf("can't schedule %q", command)
+	}
+	if params == nil {
+		params = rc.Params{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkRunning(); err != nil {
+		return nil, err
+	}
+	if id == "" {
+		for id == "" || s.entries[id] != nil {
+			id = fmt.Sprintf("%08x", rand.Uint32())
+		}
+	} else if s.entries[id] != nil {
+		return nil, fmt.Errorf("schedule %q already exists", id)
+	}
+	e := &Entry{
+		ID:       id,
+		Schedule: schedule,
+		Command:  command,
+		Params:   params,
+		Created:  time.Now(),
+		Next:     next,
+		spec:     spec,
+	}
+	s.entries[id] = e
+	if err := s.save(); err != nil {
+		delete(s.entries, id)
+		return nil, err
+	}
+	s.poke()
+	return e, nil
+}
+
+// remove the entry with id
+func (s *Scheduler) remove(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkRunning(); err != nil {
+		return err
+	}
+	e := s.entries[id]
+	if e == nil {
+		return fmt.Errorf("schedule %q not found", id)
+	}
+	delete(s.entries, id)
+	if err := s.save(); err != nil {
+		s.entries[id] = e
+		return err
+	}
+	s.poke()
+	return nil
+}
+
+// runNow runs the entry with id now returning the job ID
+func (s *Scheduler) runNow(id string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkRunning(); err != nil {
+		return 0, err
+	}
+	e := s.entries[id]
+	if e == nil {
+		return 0, fmt.Errorf("schedule %q not found", id)
+	}
+	return s.run(e)
+}
+
+// copy the entries so they can be returned without the lock held
+func (s *Scheduler) copyEntries() ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkRunning(); err != nil {
+		return nil, err
+	}
+	list := s.list()
+	out := make([]Entry, len(list))
+	for i, e := range list {
+		out[i] = *e
+	}
+	return out, nil
+}
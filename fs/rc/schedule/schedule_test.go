@@ -0,0 +1,202 @@
+package schedule
+
+import (
+	"context"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs/rc"
+	_ "github.com/rclone/rclone/fs/rc/jobs" // for job/status and job/stop
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// the number of times the test call has run
+var testCalls atomic.Int32
+
+func init() {
+	rc.Add(rc.Call{
+		Path:  "test/schedule",
+		Fn:    rcTestCall,
+		Title: "Test call for the scheduler",
+	})
+}
+
+// rcTestCall counts the calls blocking until the context is cancelled
+// if "block" is set
+func rcTestCall(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	testCalls.Add(1)
+	if block, _ := in.GetBool("block"); block {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return in, nil
+}
+
+// call the rc call at path with in
+func call(t *testing.T, path string, in rc.Params) rc.Params {
+	c := rc.Calls.Get(path)
+	require.NotNil(t, c, path)
+	out, err := c.Fn(context.Background(), in)
+	require.NoError(t, err, path)
+	return out
+}
+
+// start a scheduler saving to a temporary file
+func startScheduler(t *testing.T, path string) *Scheduler {
+	s := newScheduler(path)
+	require.NoError(t, s.start(context.Background()))
+	t.Cleanup(s.stop)
+	return s
+}
+
+// wait for the job of the entry with id to finish
+func waitForEntry(t *testing.T, s *Scheduler, id string) Entry {
+	for range 500 {
+		entries, err := s.copyEntries()
+		require.NoError(t, err)
+		for _, e := range entries {
+			if e.ID == id && e.LastJobID != 0 && !e.Running {
+				return e
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("schedule %q didn't finish", id)
+	return Entry{}
+}
+
+func TestSchedulerNotRunning(t *testing.T) {
+	s := newScheduler("")
+	_, err := s.add("", "@daily", "rc/noop", nil)
+	assert.ErrorContains(t, err, "rclone rcd")
+	_, err = s.copyEntries()
+	assert.Error(t, err)
+	_, err = s.runNow("id")
+	assert.Error(t, err)
+	assert.Error(t, s.remove("id"))
+}
+
+func TestSchedulerAdd(t *testing.T) {
+	s := startScheduler(t, "")
+
+	_, err := s.add("", "potato", "rc/noop", nil)
+	assert.Error(t, err)
+	_, err = s.add("", "@daily", "not/found", nil)
+	assert.Error(t, err)
+	_, err = s.add("", "@daily", "schedule/list", nil)
+	assert.Error(t, err)
+
+	e, err := s.add("", "@daily", "rc/noop", nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, "", e.ID)
+	assert.True(t, e.Next.After(time.Now()))
+
+	_, err = s.add("nightly", "@daily", "rc/noop", rc.Params{"a": 1})
+	require.NoError(t, err)
+	_, err = s.add("nightly", "@daily", "rc/noop", nil)
+	assert.Error(t, err)
+
+	entries, err := s.copyEntries()
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	require.NoError(t, s.remove("nightly"))
+	assert.Error(t, s.remove("nightly"))
+	entries, err = s.copyEntries()
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestSchedulerRun(t *testing.T) {
+	s := startScheduler(t, "")
+
+	// runs on the schedule
+	before := testCalls.Load()
+	_, err := s.add("every", "@every 1s", "test/schedule", rc.Params{"x": "y"})
+	require.NoError(t, err)
+	e := waitForEntry(t, s, "every")
+	assert.Equal(t, "", e.LastError)
+	assert.Greater(t, testCalls.Load(), before)
+	status := call(t, "job/status", rc.Params{"jobid": e.LastJobID})
+	assert.Equal(t, "schedule/every", status["group"])
+	assert.Equal(t, "y", status["output"].(map[string]any)["x"])
+	require.NoError(t, s.remove("every"))
+
+	// runs now, but not while the previous run is going
+	_, err = s.add("block", "@yearly", "test/schedule", rc.Params{"block": true})
+	require.NoError(t, err)
+	jobID, err := s.runNow("block")
+	require.NoError(t, err)
+	_, err = s.runNow("block")
+	assert.ErrorContains(t, err, "still running")
+	entries, err := s.copyEntries()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.True(t, entries[0].Running)
+	assert.Equal(t, 1, entries[0].Skipped)
+
+	call(t, "job/stop", rc.Params{"jobid": jobID})
+	e = waitForEntry(t, s, "block")
+	assert.Contains(t, e.LastError, "context canceled")
+	jobID, err = s.runNow("block")
+	require.NoError(t, err)
+	call(t, "job/stop", rc.Params{"jobid": jobID})
+}
+
+func TestSchedulerPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), scheduleFileName)
+	s := startScheduler(t, path)
+	_, err := s.add("nightly", "0 3 * * *", "rc/noop", rc.Params{"a": "b"})
+	require.NoError(t, err)
+	s.stop()
+
+	s = startScheduler(t, path)
+	entries, err := s.copyEntries()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	e := entries[0]
+	assert.Equal(t, "nightly", e.ID)
+	assert.Equal(t, "0 3 * * *", e.Schedule)
+	assert.Equal(t, "rc/noop", e.Command)
+	assert.Equal(t, rc.Params{"a": "b"}, e.Params)
+	assert.Equal(t, 3, e.Next.Hour())
+
+	require.NoError(t, s.remove("nightly"))
+	s.stop()
+	s = startScheduler(t, path)
+	entries, err = s.copyEntries()
+	require.NoError(t, err)
+	assert.Len(t, entries, 0)
+}
+
+func TestRc(t *testing.T) {
+	old := scheduler
+	scheduler = startScheduler(t, "")
+	defer func() {
+		scheduler = old
+	}()
+
+	out := call(t, "schedule/add", rc.Params{
+		"schedule": "@daily",
+		"command":  "rc/noop",
+		"params":   rc.Params{"a": "b"},
+	})
+	id, ok := out["id"].(string)
+	require.True(t, ok)
+
+	out = call(t, "schedule/list", nil)
+	entries := out["schedules"].([]Entry)
+	require.Len(t, entries, 1)
+	assert.Equal(t, rc.Params{"a": "b"}, entries[0].Params)
+
+	out = call(t, "schedule/run-now", rc.Params{"id": id})
+	assert.NotNil(t, out["jobid"])
+	waitForEntry(t, scheduler, id)
+
+	call(t, "schedule/remove", rc.Params{"id": id})
+	_, err := rc.Calls.Get("schedule/remove").Fn(context.Background(), rc.Params{"id": id})
+	assert.Error(t, err)
+}
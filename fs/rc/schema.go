@@ -0,0 +1,217 @@
+// Typed parameter schemas for the calls
+
+package rc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParamType is the type of a Param
+type ParamType string
+
+// The types a Param can have
+const (
+	ParamString  ParamType = "string"
+	ParamInteger ParamType = "integer"
+	ParamNumber  ParamType = "number"
+	ParamBoolean ParamType = "boolean"
+	ParamObject  ParamType = "object"
+	ParamArray   ParamType = "array"
+	ParamFs      ParamType = "fs"  // a remote name string or an object with its config
+	ParamAny     ParamType = "any" // not checked
+)
+
+// Param describes one of the parameters or results of a Call
+type Param struct {
+	Name     string    // name of the parameter
+	Type     ParamType // type of the parameter
+	Required bool      // set if the parameter must be supplied
+	Help     string    // one line of help
+}
+
+// check the value is of the type, returning an ErrParamInvalid if
+// not.
+//
+// Values which arrive as strings, for example from URL parameters,
+// are accepted if they parse as the type.
+func (p *Param) check(in Params) (err error) {
+	value := in[p.Name]
+	switch p.Type {
+	case ParamString:
+		_, err = in.GetString(p.Name)
+	case ParamInteger:
+		_, err = in.GetInt64(p.Name)
+	case ParamNumber:
+		_, err = in.GetFloat64(p.Name)
+	case ParamBoolean:
+		_, err = in.GetBool(p.Name)
+	case ParamObject:
+		var out map[string]any
+		err = in.GetStruct(p.Name, &out)
+	case ParamArray:
+		switch value.(type) {
+		case []any, []string, []int64, string:
+		default:
+			err = ErrParamInvalid{fmt.Errorf("expecting array value for key %q (was %T)", p.Name, value)}
+		}
+	case ParamFs:
+		switch value.(type) {
+		case string, map[string]any, Params:
+		default:
+			err = ErrParamInvalid{fmt.Errorf("expecting remote name string or object for key %q (was %T)", p.Name, value)}
+		}
+	}
+	return err
+}
+
+// ValidateParams checks the parameters in against the Input of the
+// call.
+//
+// It returns an ErrParamNotFound if a required parameter is missing
+// and an ErrParamInvalid if a parameter has the wrong type.
+// Parameters not in Input are allowed, as are all parameters if the
+// call has no Input.
+func (call *Call) ValidateParams(in Params) error {
+	for i := range call.Input {
+		p := &call.Input[i]
+		if _, found := in[p.Name]; !found {
+			if p.Required {
+				return ErrParamNotFound(p.Name)
+			}
+			continue
+		}
+		if err := p.check(in); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// schema returns the JSON schema of the param
+func (p *Param) schema() Params {
+	var schema Params
+	switch p.Type {
+	case ParamFs:
+		schema = Params{"oneOf": []Params{{"type": "string"}, {"type": "object"}}}
+	case ParamArray:
+		schema = Params{"type": "array", "items": Params{}}
+	case ParamAny, "":
+		schema = Params{}
+	default:
+		schema = Params{"type": string(p.Type)}
+	}
+	if p.Help != "" {
+		schema["description"] = p.Help
+	}
+	return schema
+}
+
+// paramsSchema returns the JSON schema of an object with params.
+//
+// If there are no params then any object is allowed.
+func paramsSchema(params []Param) Params {
+	schema := Params{
+		"type":                 "object",
+		"additionalProperties": true,
+	}
+	if len(params) == 0 {
+		return schema
+	}
+	properties := Params{}
+	var required []string
+	for i := range params {
+		p := &params[i]
+		properties[p.Name] = p.schema()
+		if p.Required {
+			required = append(required, p.Name)
+		}
+	}
+	schema["properties"] = properties
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// OpenAPI returns an OpenAPI 3 document describing the calls in the
+// registry. version is the version of the API to put in it.
+func (r *Registry) OpenAPI(version string) Params {
+	jsonContent := func(schema Params) Params {
+		return Params{"application/json": Params{"schema": schema}}
+	}
+	errorResponse := Params{
+		"description": "Error",
+		"content":     jsonContent(Params{"$ref": "#/components/schemas/Error"}),
+	}
+	paths := Params{}
+	for _, call := range r.List() {
+		operation := Params{
+			"operationId": call.Path,
+			"summary":     call.Title,
+			"description": call.Help,
+			"tags":        []string{pathTag(call.Path)},
+			"requestBody": Params{
+				"required": hasRequired(call.Input),
+				"content":  jsonContent(paramsSchema(call.Input)),
+			},
+			"responses": Params{
+				"200": Params{
+					"description": "Success",
+					"content":     jsonContent(paramsSchema(call.Output)),
+				},
+				"default": errorResponse,
+			},
+		}
+		if call.AuthRequired {
+			operation["security"] = []Params{
+				{"basicAuth": []string{}},
+				{"bearerAuth": []string{}},
+			}
+		}
+		paths["/"+call.Path] = Params{"post": operation}
+	}
+	return Params{
+		"openapi": "3.0.3",
+		"info": Params{
+			"title":       "rclone remote control API",
+			"description": "The rc calls of rclone. See https://rclone.org/rc/ for more information.",
+			"version":     version,
+		},
+		"paths": paths,
+		"components": Params{
+			"schemas": Params{
+				"Error": Params{
+					"type": "object",
+					"properties": Params{
+						"error":  Params{"type": "string", "description": "the error message"},
+						"input":  Params{"type": "object", "description": "the parameters of the call"},
+						"path":   Params{"type": "string", "description": "the rc call"},
+						"status": Params{"type": "integer", "description": "the HTTP status code"},
+					},
+				},
+			},
+			"securitySchemes": Params{
+				"basicAuth":  Params{"type": "http", "scheme": "basic"},
+				"bearerAuth": Params{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+}
+
+// pathTag returns the group of calls the path is in, e.g. "operations"
+// for "operations/list"
+func pathTag(path string) string {
+	tag, _, _ := strings.Cut(path, "/")
+	return tag
+}
+
+// hasRequired returns true if any of the params are required
+func hasRequired(params []Param) bool {
+	for i := range params {
+		if params[i].Required {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package rc
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testSchemaCall = Call{
+	Path:         "test/schema",
+	AuthRequired: true,
+	Title:        "Test schema",
+	Input: []Param{
+		{Name: "fs", Type: ParamFs, Required: true, Help: "the remote"},
+		{Name: "name", Type: ParamString},
+		{Name: "count", Type: ParamInteger},
+		{Name: "ratio", Type: ParamNumber},
+		{Name: "on", Type: ParamBoolean},
+		{Name: "opt", Type: ParamObject},
+		{Name: "list", Type: ParamArray},
+		{Name: "anything", Type: ParamAny},
+	},
+	Output: []Param{
+		{Name: "result", Type: ParamString},
+	},
+}
+
+func TestValidateParams(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		in      Params
+		wantErr string
+		invalid bool
+	}{
+		{name: "minimal", in: Params{"fs": "remote:"}},
+		{name: "fs object", in: Params{"fs": map[string]any{"type": "local"}}},
+		{name: "all", in: Params{
+			"fs":       "remote:",
+			"name":     "potato",
+			"count":    int64(3),
+			"ratio":    1.5,
+			"on":       true,
+			"opt":      map[string]any{"a": 1},
+			"list":     []any{1, 2},
+			"anything": 42,
+			"_async":   true,
+			"unknown":  "ok",
+		}},
+		{name: "strings parsed", in: Params{
+			"fs":    "remote:",
+			"count": "3",
+			"ratio": "1.5",
+			"on":    "true",
+			"opt":   `{"a":1}`,
+			"list":  "1,2",
+		}},
+		{name: "missing", in: Params{}, wantErr: `Didn't find key "fs" in input`},
+		{name: "bad fs", in: Params{"fs": 1}, wantErr: `expecting remote name string or object for key "fs" (was int)`, invalid: true},
+		{name: "bad string", in: Params{"fs": "remote:", "name": 1}, wantErr: `expecting string value for key "name" (was int)`, invalid: true},
+		{name: "bad integer", in: Params{"fs": "remote:", "count": "three"}, wantErr: `couldn't parse key "count"`, invalid: true},
+		{name: "bad number", in: Params{"fs": "remote:", "ratio": true}, wantErr: `expecting float64 value for key "ratio"`, invalid: true},
+		{name: "bad boolean", in: Params{"fs": "remote:", "on": "maybe"}, wantErr: `couldn't parse key "on"`, invalid: true},
+		{name: "bad object", in: Params{"fs": "remote:", "opt": "potato"}, wantErr: `key "opt"`, invalid: true},
+		{name: "bad array", in: Params{"fs": "remote:", "list": 1}, wantErr: `expecting array value for key "list" (was int)`, invalid: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			err := testSchemaCall.ValidateParams(test.in)
+			if test.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.wantErr)
+			assert.Equal(t, test.invalid, IsErrParamInvalid(err))
+			assert.Equal(t, !test.invalid, IsErrParamNotFound(err))
+		})
+	}
+
+	// calls without Input aren't checked
+	assert.NoError(t, (&Call{}).ValidateParams(Params{"anything": 1}))
+}
+
+func TestOpenAPI(t *testing.T) {
+	r := NewRegistry()
+	r.Add(testSchemaCall)
+	r.Add(Call{Path: "test/noschema", Title: "No schema"})
+	doc := r.OpenAPI("v1.2.3")
+
+	// check it round trips through JSON as it will be served
+	data, err := json.Marshal(doc)
+	require.NoError(t, err)
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(data, &got))
+
+	assert.Equal(t, "3.0.3", got["openapi"])
+	assert.Equal(t, "v1.2.3", got["info"].(map[string]any)["version"])
+	paths := got["paths"].(map[string]any)
+	require.Len(t, paths, 2)
+
+	post := paths["/test/schema"].(map[string]any)["post"].(map[string]any)
+	assert.Equal(t, "test/schema", post["operationId"])
+	assert.Equal(t, "Test schema", post["summary"])
+	assert.Equal(t, []any{"test"}, post["tags"])
+	assert.NotNil(t, post["security"])
+	body := post["requestBody"].(map[string]any)
+	assert.Equal(t, true, body["required"])
+	schema := body["content"].(map[string]any)["application/json"].(map[string]any)["schema"].(map[string]any)
+	assert.Equal(t, []any{"fs"}, schema["required"])
+	properties := schema["properties"].(map[string]any)
+	assert.Equal(t, map[string]any{"type": "integer"}, properties["count"])
+	assert.Equal(t, map[string]any{
+		"oneOf":       []any{map[string]any{"type": "string"}, map[string]any{"type": "object"}},
+		"description": "the remote",
+	}, properties["fs"])
+	assert.Equal(t, map[string]any{}, properties["anything"])
+	responses := post["responses"].(map[string]any)
+	output := responses["200"].(map[string]any)["content"].(map[string]any)["application/json"].(map[string]any)["schema"].(map[string]any)
+	assert.Equal(t, map[string]any{"type": "string"}, output["properties"].(map[string]any)["result"])
+	assert.NotNil(t, responses["default"])
+
+	post = paths["/test/noschema"].(map[string]any)["post"].(map[string]any)
+	assert.Nil(t, post["security"])
+	body = post["requestBody"].(map[string]any)
+	assert.Equal(t, false, body["required"])
+	schema = body["content"].(map[string]any)["application/json"].(map[string]any)["schema"].(map[string]any)
+	assert.Equal(t, map[string]any{"type": "object", "additionalProperties": true}, schema)
+}
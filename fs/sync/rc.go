@@ -10,12 +10,19 @@ func init() {
 	for _, name := range []string{"sync", "copy", "move"} {
 		name := name
 		moveHelp := ""
+		input := []rc.Param{
+			{Name: "srcFs", Type: rc.ParamFs, Required: true, Help: "the source remote"},
+			{Name: "dstFs", Type: rc.ParamFs, Required: true, Help: "the destination remote"},
+			{Name: "createEmptySrcDirs", Type: rc.ParamBoolean, Help: "create empty src directories on destination if set"},
+		}
 		if name == "move" {
 			moveHelp = "- deleteEmptySrcDirs - delete empty src directories if set\n"
+			input = append(input, rc.Param{Name: "deleteEmptySrcDirs", Type: rc.ParamBoolean, Help: "delete empty src directories if set"})
 		}
 		rc.Add(rc.Call{
 			Path:         "sync/" + name,
 			AuthRequired: true,
+			Input:        input,
 			Fn: func(ctx context.Context, in rc.Params) (rc.Params, error) {
 				return rcSyncCopyMove(ctx, in, name)
 			},
@@ -104,6 +104,7 @@ type AuthConfig struct {
 	Salt           string       `config:"salt"`             // password hashing salt
 	UserFromHeader string       `config:"user_from_header"` // retrieve user name from a defined HTTP header
 	CustomAuthFn   CustomAuthFn `json:"-" config:"-"`       // custom Auth (not set by command line flags)
+	BearerTokens   bool         `json:"-" config:"-"`       // pass bearer tokens to CustomAuthFn as pass with an empty user
 }
 
 // AddFlagsPrefix adds flags to the flag set for AuthConfig
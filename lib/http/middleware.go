@@ -34,6 +34,13 @@ func parseAuthorization(r *http.Request) (user, pass string, ok bool) {
 	return
 }
 
+// parseBearer parses a bearer token from the Authorization header
+// it returns a boolean as to whether the parse was successful
+func parseBearer(r *http.Request) (token string, ok bool) {
+	token, ok = strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return token, ok && token != ""
+}
+
 // LoggedBasicAuth simply wraps the goauth.BasicAuth struct
 type LoggedBasicAuth struct {
 	goauth.BasicAuth
@@ -116,7 +123,10 @@ func MiddlewareAuthBasic(user, pass, realm, salt string) Middleware {
 }
 
 // MiddlewareAuthCustom instantiates middleware that authenticates using a custom function
-func MiddlewareAuthCustom(fn CustomAuthFn, realm string, userFromContext bool) Middleware {
+//
+// If bearer is set a bearer token is passed to fn as pass with an
+// empty user.
+func MiddlewareAuthCustom(fn CustomAuthFn, realm string, userFromContext bool, bearer bool) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// skip auth for CORS preflight
@@ -126,6 +136,9 @@ func MiddlewareAuthCustom(fn CustomAuthFn, realm string, userFromContext bool) M
 			}
 
 			user, pass, ok := parseAuthorization(r)
+			if !ok && bearer {
+				pass, ok = parseBearer(r)
+			}
 			if !ok && userFromContext {
 				user, ok = CtxGetUser(r.Context())
 			}
@@ -208,6 +208,47 @@ func TestMiddlewareAuth(t *testing.T) {
 	}
 }
 
+func TestMiddlewareAuthBearer(t *testing.T) {
+	for _, bearer := range []bool{false, true} {
+		t.Run(fmt.Sprint(bearer), func(t *testing.T) {
+			var gotUser, gotPass string
+			called := false
+			auth := AuthConfig{
+				Realm: "test",
+				CustomAuthFn: func(user, pass string) (value any, err error) {
+					called = true
+					gotUser, gotPass = user, pass
+					return nil, nil
+				},
+				BearerTokens: bearer,
+			}
+			s, err := NewServer(context.Background(), WithConfig(Config{ListenAddr: []string{"127.0.0.1:0"}}), WithAuth(auth))
+			require.NoError(t, err)
+			defer func() {
+				require.NoError(t, s.Shutdown())
+			}()
+			s.Router().Mount("/", testEchoHandler([]byte("secret-page")))
+			s.Serve()
+
+			req, err := http.NewRequest("GET", testGetServerURL(t, s), nil)
+			require.NoError(t, err)
+			req.Header.Set("Authorization", "Bearer token")
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			_ = resp.Body.Close()
+
+			if bearer {
+				require.Equal(t, http.StatusOK, resp.StatusCode)
+				require.Equal(t, "", gotUser)
+				require.Equal(t, "token", gotPass)
+			} else {
+				require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+				require.False(t, called, "bearer token passed to CustomAuthFn")
+			}
+		})
+	}
+}
+
 func TestMiddlewareAuthCertificateUser(t *testing.T) {
 	serverCertBytes := testReadTestdataFile(t, "local.crt")
 	serverKeyBytes := testReadTestdataFile(t, "local.key")
@@ -38,6 +38,8 @@ type Directory struct {
 	Breadcrumb   []Crumb
 	Sort         string
 	Order        string
+	ReadWrite    bool // set if files can be uploaded, deleted and renamed
+	Archive      bool // set if the listing can be downloaded as an archive with ?download
 }
 
 // Crumb is a breadcrumb entry
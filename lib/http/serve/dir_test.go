@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
 	"time"
 
@@ -124,3 +125,20 @@ func TestServe(t *testing.T) {
 </html>
 `, string(body))
 }
+
+func TestServeArchive(t *testing.T) {
+	htmlTemplate, err := libhttp.GetTemplate("")
+	require.NoError(t, err)
+	for _, archive := range []bool{false, true} {
+		d := NewDirectory("aDirectory", htmlTemplate)
+		d.Archive = archive
+		d.AddEntry("file", false)
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "http://example.com/aDirectory/", nil)
+		d.Serve(w, r)
+		body := w.Body.String()
+		assert.Equal(t, archive, strings.Contains(body, `id="download"`), "download form")
+		assert.Equal(t, archive, strings.Contains(body, `form="download"`), "checkboxes")
+	}
+}
@@ -41,6 +41,7 @@ to be used within the template to server pages:
 |-- .IsDir    | Boolean for if an entry is a directory or not. |
 |-- .Size     | Size in Bytes of the entry. |
 |-- .ModTime  | The UTC timestamp of an entry. |
+| .ReadWrite  | Boolean for if files can be uploaded, deleted and renamed. |
 
 The server also makes the following functions available so that they can be used within the
 template. These functions help extend the options for dynamic rendering of HTML. They can
@@ -2,6 +2,9 @@
 package gomobile
 
 import (
+	"errors"
+	"io"
+
 	"github.com/rclone/rclone/librclone/librclone"
 
 	_ "github.com/rclone/rclone/backend/all" // import all backends
@@ -40,3 +43,118 @@ func RcloneRPC(method string, input string) (result *RcloneRPCResult) { //nolint
 		Status: status,
 	}
 }
+
+// RcloneOpenResult is returned from RcloneOpenRead and RcloneOpenWrite
+//
+//	Handle is used to read, write and close the object
+//	Output will be returned as a serialized JSON object
+//	Status is a HTTP status return (200=OK anything else fail)
+type RcloneOpenResult struct {
+	Handle int64
+	Output string
+	Status int
+}
+
+// RcloneOpenRead opens an object for reading - see
+// librclone.OpenRead for the input. The handle must be closed with
+// RcloneClose.
+func RcloneOpenRead(input string) (result *RcloneOpenResult) { //nolint:deadcode
+	handle, output, status := librclone.OpenRead(input)
+	return &RcloneOpenResult{
+		Handle: handle,
+		Output: output,
+		Status: status,
+	}
+}
+
+// RcloneOpenWrite opens an object for writing - see
+// librclone.OpenWrite for the input. The handle must be closed with
+// RcloneClose which finishes the upload, or RcloneAbort which
+// abandons it.
+func RcloneOpenWrite(input string) (result *RcloneOpenResult) { //nolint:deadcode
+	handle, output, status := librclone.OpenWrite(input)
+	return &RcloneOpenResult{
+		Handle: handle,
+		Output: output,
+		Status: status,
+	}
+}
+
+// RcloneRead reads up to size bytes from the handle. It returns no
+// data at the end of the object.
+func RcloneRead(handle int64, size int) ([]byte, error) { //nolint:deadcode
+	buf := make([]byte, size)
+	n, err := librclone.Read(handle, buf)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// RcloneWrite writes data to the handle returning the number of bytes
+// written.
+func RcloneWrite(handle int64, data []byte) (int, error) { //nolint:deadcode
+	return librclone.Write(handle, data)
+}
+
+// RcloneClose closes the handle. For a handle from RcloneOpenWrite
+// the Output is a serialized JSON object describing the object
+// uploaded.
+func RcloneClose(handle int64) (result *RcloneRPCResult) { //nolint:deadcode
+	output, status := librclone.Close(handle)
+	return &RcloneRPCResult{
+		Output: output,
+		Status: status,
+	}
+}
+
+// RcloneAbort closes the handle like RcloneClose. For a handle from
+// RcloneOpenWrite the upload is abandoned so the object isn't made.
+func RcloneAbort(handle int64) (result *RcloneRPCResult) { //nolint:deadcode
+	output, status := librclone.Abort(handle)
+	return &RcloneRPCResult{
+		Output: output,
+		Status: status,
+	}
+}
+
+// RcloneCallback is implemented by the caller to receive events from
+// RcloneAddCallback
+type RcloneCallback interface {
+	// OnEvent is called with a serialized JSON object describing
+	// the event
+	OnEvent(event string)
+}
+
+// RcloneCallbackResult is returned from RcloneAddCallback
+//
+//	Handle is used to remove the callback
+//	Output will be returned as a serialized JSON object
+//	Status is a HTTP status return (200=OK anything else fail)
+type RcloneCallbackResult struct {
+	Handle int64
+	Output string
+	Status int
+}
+
+// RcloneAddCallback registers cb to be called with stats, job and
+// log events - see librclone.AddCallback for the input. The callback
+// is removed with RcloneRemoveCallback.
+func RcloneAddCallback(cb RcloneCallback, input string) (result *RcloneCallbackResult) { //nolint:deadcode
+	handle, output, status := librclone.AddCallback(cb.OnEvent, input)
+	return &RcloneCallbackResult{
+		Handle: handle,
+		Output: output,
+		Status: status,
+	}
+}
+
+// RcloneRemoveCallback removes the callback with handle. It mustn't
+// be called from within the callback.
+func RcloneRemoveCallback(handle int64) (result *RcloneRPCResult) { //nolint:deadcode
+	output, status := librclone.RemoveCallback(handle)
+	return &RcloneRPCResult{
+		Output: output,
+		Status: status,
+	}
+}
@@ -26,10 +26,35 @@ struct RcloneRPCResult {
 	char*	Output;
 	int	Status;
 };
+
+struct RcloneOpenResult {
+	long long	Handle;
+	char*	Output;
+	int	Status;
+};
+
+struct RcloneIOResult {
+	int	N;
+	char*	Error;
+};
+
+struct RcloneCallbackResult {
+	long long	Handle;
+	char*	Output;
+	int	Status;
+};
+
+typedef void (*RcloneCallback)(char* event, void* userdata);
+
+static inline void callRcloneCallback(RcloneCallback fn, char* event, void* userdata) {
+	fn(event, userdata);
+}
 */
 import "C"
 
 import (
+	"errors"
+	"io"
 	"unsafe"
 
 	"github.com/rclone/rclone/librclone/librclone"
@@ -38,6 +63,7 @@ import (
 	_ "github.com/rclone/rclone/cmd/cmount"    // import cmount
 	_ "github.com/rclone/rclone/cmd/mount"     // import mount
 	_ "github.com/rclone/rclone/cmd/mount2"    // import mount2
+	_ "github.com/rclone/rclone/fs/notify"     // import notify/* rc commands
 	_ "github.com/rclone/rclone/fs/operations" // import operations/* rc commands
 	_ "github.com/rclone/rclone/fs/sync"       // import sync/*
 	_ "github.com/rclone/rclone/lib/plugin"    // import plugins
@@ -50,7 +76,7 @@ func RcloneInitialize() {
 	librclone.Initialize()
 }
 
-// RcloneFinalize finalizes the library
+// RcloneFinalize finalizes the library, removing any callbacks
 //
 //export RcloneFinalize
 func RcloneFinalize() {
@@ -100,5 +126,201 @@ func RcloneFreeString(str *C.char) {
 	C.free(unsafe.Pointer(str))
 }
 
+// RcloneOpenResult is returned from RcloneOpenRead and RcloneOpenWrite
+//
+//	Handle is used to read, write and close the object
+//	Output will be returned as a serialized JSON object
+//	Status is a HTTP status return (200=OK anything else fail)
+type RcloneOpenResult struct { //nolint:deadcode
+	Handle C.longlong
+	Output *C.char
+	Status C.int
+}
+
+// RcloneIOResult is returned from RcloneRead and RcloneWrite
+//
+//	N is the number of bytes read or written
+//	Error is NULL or a string describing the error
+type RcloneIOResult struct { //nolint:deadcode
+	N     C.int
+	Error *C.char
+}
+
+// openResult makes a C.struct_RcloneOpenResult
+func openResult(handle int64, output string, status int) (result C.struct_RcloneOpenResult) {
+	result.Handle = C.longlong(handle)
+	result.Output = C.CString(output)
+	result.Status = C.int(status)
+	return result
+}
+
+// RcloneOpenRead opens an object for reading. The input should be a
+// string with a serialized JSON object with
+//
+//	fs - a remote name string, eg "drive:"
+//	remote - the path of the object within that remote
+//	offset - start reading at this offset, negative for from the end (optional)
+//	count - read at most this many bytes (optional)
+//
+// If result.Status is 200 then result.Handle may be used with
+// RcloneRead and must be closed with RcloneClose, and result.Output
+// is a serialized JSON object with the remote, size and modTime of
+// the object. Otherwise result.Output is an error.
+//
+// Caller is responsible for freeing the memory for result.Output
+// (see RcloneFreeString), result itself is passed on the stack.
+//
+//export RcloneOpenRead
+func RcloneOpenRead(input *C.char) (result C.struct_RcloneOpenResult) {
+	return openResult(librclone.OpenRead(C.GoString(input)))
+}
+
+// RcloneOpenWrite opens an object for writing, like rclone rcat. The
+// input should be a string with a serialized JSON object with
+//
+//	fs - a remote name string, eg "drive:"
+//	remote - the path of the object within that remote
+//	modTime - the modification time as an RFC3339 string (optional)
+//
+// If result.Status is 200 then result.Handle may be used with
+// RcloneWrite and must be closed with RcloneClose which finishes the
+// upload, or RcloneAbort which abandons it. Otherwise result.Output is
+// an error.
+//
+// Caller is responsible for freeing the memory for result.Output
+// (see RcloneFreeString), result itself is passed on the stack.
+//
+//export RcloneOpenWrite
+func RcloneOpenWrite(input *C.char) (result C.struct_RcloneOpenResult) {
+	return openResult(librclone.OpenWrite(C.GoString(input)))
+}
+
+// ioResult makes a C.struct_RcloneIOResult
+func ioResult(n int, err error) (result C.struct_RcloneIOResult) {
+	result.N = C.int(n)
+	if err != nil && !errors.Is(err, io.EOF) {
+		result.Error = C.CString(err.Error())
+	}
+	return result
+}
+
+// RcloneRead reads up to size bytes into buf from the handle.
+//
+// result.N is the number of bytes read which is 0 at the end of the
+// object. If there was an error result.Error is set and the caller
+// is responsible for freeing it (see RcloneFreeString).
+//
+//export RcloneRead
+func RcloneRead(handle C.longlong, buf *C.char, size C.int) (result C.struct_RcloneIOResult) {
+	p := unsafe.Slice((*byte)(unsafe.Pointer(buf)), int(size))
+	return ioResult(librclone.Read(int64(handle), p))
+}
+
+// RcloneWrite writes size bytes from buf to the handle.
+//
+// result.N is the number of bytes written. If there was an error
+// result.Error is set and the caller is responsible for freeing it
+// (see RcloneFreeString).
+//
+//export RcloneWrite
+func RcloneWrite(handle C.longlong, buf *C.char, size C.int) (result C.struct_RcloneIOResult) {
+	p := unsafe.Slice((*byte)(unsafe.Pointer(buf)), int(size))
+	return ioResult(librclone.Write(int64(handle), p))
+}
+
+// RcloneClose closes the handle. For a handle from RcloneOpenWrite
+// this waits for the upload to finish and result.Output is a
+// serialized JSON object with the remote, size and modTime of the
+// object.
+//
+// The handle can't be used afterwards even if result.Status isn't 200.
+//
+// Caller is responsible for freeing the memory for result.Output
+// (see RcloneFreeString), result itself is passed on the stack.
+//
+//export RcloneClose
+func RcloneClose(handle C.longlong) (result C.struct_RcloneRPCResult) {
+	output, status := librclone.Close(int64(handle))
+	result.Output = C.CString(output)
+	result.Status = C.int(status)
+	return result
+}
+
+// RcloneAbort closes the handle like RcloneClose. For a handle from
+// RcloneOpenWrite the upload is abandoned so the object isn't made,
+// for example if the data couldn't all be written.
+//
+// The handle can't be used afterwards even if result.Status isn't 200.
+//
+// Caller is responsible for freeing the memory for result.Output
+// (see RcloneFreeString), result itself is passed on the stack.
+//
+//export RcloneAbort
+func RcloneAbort(handle C.longlong) (result C.struct_RcloneRPCResult) {
+	output, status := librclone.Abort(int64(handle))
+	result.Output = C.CString(output)
+	result.Status = C.int(status)
+	return result
+}
+
+// RcloneCallbackResult is returned from RcloneAddCallback
+//
+//	Handle is used to remove the callback
+//	Output will be returned as a serialized JSON object
+//	Status is a HTTP status return (200=OK anything else fail)
+type RcloneCallbackResult struct { //nolint:deadcode
+	Handle C.longlong
+	Output *C.char
+	Status C.int
+}
+
+// RcloneAddCallback registers fn to be called with stats, job and
+// log events. The input should be a string with a serialized JSON
+// object with
+//
+//	types - comma separated event types: "stats", "job" and "log" (optional, default all)
+//	group - only send stats and job events for this stats group (optional)
+//	level - minimum level of log records to send (optional, default INFO)
+//	interval - how often to send stats, eg "500ms" (optional, default 1s)
+//
+// fn is called with a serialized JSON object describing the event
+// and the userdata passed in. The event is only valid for the
+// duration of the call. fn is called from a thread belonging to
+// rclone and calls for the same callback don't overlap.
+//
+// If result.Status is 200 then result.Handle may be passed to
+// RcloneRemoveCallback, otherwise result.Output is an error.
+//
+// Caller is responsible for freeing the memory for result.Output
+// (see RcloneFreeString), result itself is passed on the stack.
+//
+//export RcloneAddCallback
+func RcloneAddCallback(fn C.RcloneCallback, userdata unsafe.Pointer, input *C.char) (result C.struct_RcloneCallbackResult) {
+	handle, output, status := librclone.AddCallback(func(event string) {
+		cEvent := C.CString(event)
+		defer C.free(unsafe.Pointer(cEvent))
+		C.callRcloneCallback(fn, cEvent, userdata)
+	}, C.GoString(input))
+	result.Handle = C.longlong(handle)
+	result.Output = C.CString(output)
+	result.Status = C.int(status)
+	return result
+}
+
+// RcloneRemoveCallback removes the callback with the handle returned
+// by RcloneAddCallback. When it returns the callback won't be called
+// again, so it mustn't be called from within the callback.
+//
+// Caller is responsible for freeing the memory for result.Output
+// (see RcloneFreeString), result itself is passed on the stack.
+//
+//export RcloneRemoveCallback
+func RcloneRemoveCallback(handle C.longlong) (result C.struct_RcloneRPCResult) {
+	output, status := librclone.RemoveCallback(int64(handle))
+	result.Output = C.CString(output)
+	result.Status = C.int(status)
+	return result
+}
+
 // do nothing here - necessary for building into a C library
 func main() {}
@@ -0,0 +1,128 @@
+package librclone
+
+// Calls back into the caller with stats, job and log events so it
+// doesn't need to poll core/stats
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/fs/rc/events"
+)
+
+// callback is a function registered with AddCallback
+type callback struct {
+	fn          func(event string)
+	sub         *events.Subscriber
+	unsubscribe func()
+	cancel      context.CancelFunc
+	done        chan struct{} // closed when run has returned
+}
+
+var (
+	callbacksMu    sync.Mutex
+	callbacks      = map[int64]*callback{}
+	lastCallbackID int64
+)
+
+// run calls the callback with the events until ctx is cancelled
+func (c *callback) run(ctx context.Context) {
+	defer close(c.done)
+	err := c.sub.Stream(ctx, func(ev events.Event) error {
+		data, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		c.fn(string(data))
+		return nil
+	}, nil)
+	if err != nil {
+		fs.Errorf(nil, "librclone: callback stopped: %v", err)
+	}
+}
+
+// AddCallback registers fn to be called with events. The input is a
+// JSON object with
+//
+//   - types - comma separated event types to send: "stats", "job" and "log" (optional, default all)
+//   - group - only send stats and job events for this stats group (optional)
+//   - level - minimum level of log records to send (optional, default INFO)
+//   - interval - how often to send stats, e.g. "500ms" (optional, default 1s)
+//
+// fn is called with a JSON object with type, time, group and data
+// keys. For "stats" events data is the output of core/stats, for
+// "job" events it is the job status with an "event" key of "queued",
+// "started" or "finished", and for "log" events it is the log record
+// as written by --use-json-log.
+//
+// fn is called from a single goroutine for each callback so calls
+// don't overlap. If fn doesn't keep up events are dropped and a
+// "dropped" event with their count is sent.
+//
+// It returns a handle to pass to RemoveCallback. If the status isn't
+// 200 then the output is an error and the handle isn't valid.
+func AddCallback(fn func(event string), input string) (handle int64, output string, status int) {
+	const method = "AddCallback"
+	in, err := readInput(input)
+	if err != nil {
+		output, status = writeError(method, in, err, http.StatusBadRequest)
+		return 0, output, status
+	}
+	opt, err := events.ParseOptions(in)
+	if err != nil {
+		output, status = writeError(method, in, err, http.StatusBadRequest)
+		return 0, output, status
+	}
+	c := &callback{
+		fn:   fn,
+		done: make(chan struct{}),
+	}
+	c.sub, c.unsubscribe = events.Subscribe(opt)
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	go c.run(ctx)
+	callbacksMu.Lock()
+	lastCallbackID++
+	handle = lastCallbackID
+	callbacks[handle] = c
+	callbacksMu.Unlock()
+	output, status = writeOutput(method, in, rc.Params{})
+	return handle, output, status
+}
+
+// RemoveCallback removes the callback with handle. When it returns
+// the callback won't be called again, so it mustn't be called from
+// within the callback.
+func RemoveCallback(handle int64) (output string, status int) {
+	const method = "RemoveCallback"
+	in := rc.Params{"handle": handle}
+	callbacksMu.Lock()
+	c, found := callbacks[handle]
+	delete(callbacks, handle)
+	callbacksMu.Unlock()
+	if !found {
+		return writeError(method, in, fmt.Errorf("handle %d not found", handle), http.StatusNotFound)
+	}
+	c.unsubscribe()
+	c.cancel()
+	<-c.done
+	return writeOutput(method, in, rc.Params{})
+}
+
+// removeCallbacks removes all the callbacks
+func removeCallbacks() {
+	callbacksMu.Lock()
+	handles := make([]int64, 0, len(callbacks))
+	for handle := range callbacks {
+		handles = append(handles, handle)
+	}
+	callbacksMu.Unlock()
+	for _, handle := range handles {
+		_, _ = RemoveCallback(handle)
+	}
+}
@@ -46,6 +46,7 @@ func Initialize() {
 func Finalize() {
 	// TODO: how to clean up? what happens when rcserver terminates?
 	// what about unfinished async jobs?
+	removeCallbacks()
 	runtime.GC()
 }
 
@@ -114,7 +115,7 @@ func RPC(method string, input string) (output string, status int) {
 
 	fs.Debugf(nil, "rc: %q: with parameters %+v", method, in)
 
-	_, out, err := jobs.NewJob(context.Background(), call.Fn, in)
+	_, out, err := jobs.NewJob(jobs.WithPath(context.Background(), method), call.Fn, in)
 	if err != nil {
 		return writeError(method, in, err, http.StatusInternalServerError)
 	}
@@ -0,0 +1,412 @@
+package librclone
+
+// Streams the contents of objects to and from the caller through
+// handles so they don't need temporary files
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/rc"
+)
+
+// stream is an object open for reading or writing
+type stream interface {
+	io.ReadWriter
+	// close the stream returning the info about the object
+	close() (rc.Params, error)
+	// abort the stream so an upload isn't completed
+	abort() error
+}
+
+var (
+	streamsMu    sync.Mutex
+	streams      = map[int64]stream{}
+	lastStreamID int64
+)
+
+// addStream returns a new handle for s
+func addStream(s stream) int64 {
+	streamsMu.Lock()
+	defer streamsMu.Unlock()
+	lastStreamID++
+	streams[lastStreamID] = s
+	return lastStreamID
+}
+
+// getStream returns the stream for handle
+func getStream(handle int64) (stream, error) {
+	streamsMu.Lock()
+	defer streamsMu.Unlock()
+	s, found := streams[handle]
+	if !found {
+		return nil, fmt.Errorf("handle %d not found", handle)
+	}
+	return s, nil
+}
+
+// removeStream removes the handle returning its stream
+func removeStream(handle int64) (stream, error) {
+	streamsMu.Lock()
+	defer streamsMu.Unlock()
+	s, found := streams[handle]
+	if !found {
+		return nil, fmt.Errorf("handle %d not found", handle)
+	}
+	delete(streams, handle)
+	return s, nil
+}
+
+// objectInfo returns the info about o returned to the caller
+func objectInfo(ctx context.Context, o fs.Object) rc.Params {
+	return rc.Params{
+		"remote":  o.Remote(),
+		"size":    o.Size(),
+		"modTime": o.ModTime(ctx),
+	}
+}
+
+// writeOutput returns out as a JSON string
+func writeOutput(method string, in rc.Params, out rc.Params) (string, int) {
+	var w strings.Builder
+	err := rc.WriteJSON(&w, out)
+	if err != nil {
+		return writeError(method, in, err, http.StatusInternalServerError)
+	}
+	return w.String(), http.StatusOK
+}
+
+// readInput decodes the JSON input
+func readInput(input string) (in rc.Params, err error) {
+	in = make(rc.Params)
+	if input != "" {
+		err = json.NewDecoder(strings.NewReader(input)).Decode(&in)
+		if err != nil {
+			return in, rc.NewErrParamInvalid(fmt.Errorf("failed to read input JSON: %w", err))
+		}
+	}
+	return in, nil
+}
+
+// readStream is an object open for reading
+type readStream struct {
+	mu  sync.Mutex
+	ctx context.Context
+	in  io.ReadCloser
+	tr  *accounting.Transfer
+	err error // the first error reading
+}
+
+// Read from the object
+func (s *readStream) Read(p []byte) (n int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, err = s.in.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) && s.err == nil {
+		s.err = err
+	}
+	return n, err
+}
+
+// Write returns an error as the stream is for reading
+func (s *readStream) Write(p []byte) (n int, err error) {
+	return 0, errors.New("handle is open for reading")
+}
+
+// close the stream finishing the transfer
+func (s *readStream) close() (rc.Params, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.in.Close()
+	if s.err != nil {
+		err = s.err
+	}
+	s.tr.Done(s.ctx, err)
+	return rc.Params{}, err
+}
+
+// abort closes the stream as there is nothing to undo when reading
+func (s *readStream) abort() error {
+	_, err := s.close()
+	return err
+}
+
+// limitedReadCloser limits the reads from a ReadCloser
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// readRange returns the range to read count bytes from offset of an
+// object of size, or nil to read all of it.
+//
+// A negative offset is from the end and reads from the start if it
+// is further back than size, like tail. A negative count reads to
+// the end.
+func readRange(offset, count, size int64) *fs.RangeOption {
+	opt := fs.RangeOption{Start: offset, End: -1}
+	if opt.Start < 0 {
+		opt.Start = max(opt.Start+size, 0)
+	}
+	if count >= 0 {
+		opt.End = opt.Start + count - 1
+	}
+	if opt.Start == 0 && opt.End < 0 {
+		return nil
+	}
+	return &opt
+}
+
+// openRead opens the object for reading with the parameters in
+func openRead(ctx context.Context, in rc.Params) (s *readStream, out rc.Params, err error) {
+	f, remote, err := rc.GetFsAndRemote(ctx, in)
+	if err != nil {
+		return nil, nil, err
+	}
+	offset, err := in.GetInt64("offset")
+	if rc.NotErrParamNotFound(err) {
+		return nil, nil, err
+	}
+	count, err := in.GetInt64("count")
+	if rc.IsErrParamNotFound(err) {
+		count = -1
+	} else if err != nil {
+		return nil, nil, err
+	}
+	o, err := f.NewObject(ctx, remote)
+	if err != nil {
+		return nil, nil, err
+	}
+	var options []fs.OpenOption
+	if opt := readRange(offset, count, o.Size()); opt != nil {
+		options = append(options, opt)
+	}
+	for _, option := range fs.GetConfig(ctx).DownloadHeaders {
+		options = append(options, option)
+	}
+	tr := accounting.Stats(ctx).NewTransfer(o, nil)
+	var rd io.ReadCloser
+	rd, err = operations.Open(ctx, o, options...)
+	if err != nil {
+		tr.Done(ctx, err)
+		return nil, nil, err
+	}
+	if count >= 0 {
+		rd = limitedReadCloser{Reader: io.LimitReader(rd, count), Closer: rd}
+	}
+	s = &readStream{
+		ctx: ctx,
+		in:  tr.Account(ctx, rd),
+		tr:  tr,
+	}
+	return s, objectInfo(ctx, o), nil
+}
+
+// OpenRead opens an object for reading
+//
+// The input is a JSON object with
+//
+//   - fs - a remote name string e.g. "drive:"
+//   - remote - the path of the object within that remote
+//   - offset - start reading at this offset, negative for from the end (optional)
+//     or from the start if it is larger than the object
+//   - count - read at most this many bytes (optional)
+//
+// It returns a handle to Read from and Close, and the output is a
+// JSON object with the remote, size and modTime of the object. If
+// the status isn't 200 then the output is an error and the handle
+// isn't valid.
+func OpenRead(input string) (handle int64, output string, status int) {
+	const method = "OpenRead"
+	in, err := readInput(input)
+	if err != nil {
+		output, status = writeError(method, in, err, http.StatusBadRequest)
+		return 0, output, status
+	}
+	s, out, err := openRead(context.Background(), in)
+	if err != nil {
+		output, status = writeError(method, in, err, http.StatusInternalServerError)
+		return 0, output, status
+	}
+	output, status = writeOutput(method, in, out)
+	return addStream(s), output, status
+}
+
+// writeStream is an object open for writing
+type writeStream struct {
+	mu   sync.Mutex
+	pw   *io.PipeWriter
+	done chan struct{} // closed when the upload has finished
+	out  rc.Params     // info about the object uploaded
+	err  error         // error from the upload
+}
+
+// Read returns an error as the stream is for writing
+func (s *writeStream) Read(p []byte) (n int, err error) {
+	return 0, errors.New("handle is open for writing")
+}
+
+// Write to the object
+func (s *writeStream) Write(p []byte) (n int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pw.Write(p)
+}
+
+// close the stream waiting for the upload to finish
+func (s *writeStream) close() (rc.Params, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_ = s.pw.Close()
+	<-s.done
+	return s.out, s.err
+}
+
+// errAborted is the error the upload of an aborted stream fails with
+var errAborted = errors.New("upload aborted")
+
+// abort the upload so the object isn't made, waiting for it to finish
+func (s *writeStream) abort() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_ = s.pw.CloseWithError(errAborted)
+	<-s.done
+	if s.err == nil {
+		return errors.New("upload completed before it was aborted")
+	}
+	return nil
+}
+
+// openWrite opens the object for writing with the parameters in
+func openWrite(ctx context.Context, in rc.Params) (s *writeStream, err error) {
+	f, remote, err := rc.GetFsAndRemote(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	modTime := time.Now()
+	value, err := in.GetString("modTime")
+	if err == nil {
+		modTime, err = time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return nil, rc.NewErrParamInvalid(fmt.Errorf("bad modTime: %w", err))
+		}
+	} else if rc.NotErrParamNotFound(err) {
+		return nil, err
+	}
+	pr, pw := io.Pipe()
+	s = &writeStream{
+		pw:   pw,
+		done: make(chan struct{}),
+	}
+	go func() {
+		defer close(s.done)
+		dst, err := operations.Rcat(ctx, f, remote, pr, modTime, nil)
+		if err != nil {
+			s.err = err
+		} else if dst != nil {
+			s.out = objectInfo(ctx, dst)
+		} else {
+			s.out = rc.Params{}
+		}
+		// stop any more writes if the upload finished early
+		if err == nil {
+			err = errors.New("upload finished")
+		}
+		_ = pr.CloseWithError(err)
+	}()
+	return s, nil
+}
+
+// OpenWrite opens an object for writing, like rclone rcat
+//
+// The input is a JSON object with
+//
+//   - fs - a remote name string e.g. "drive:"
+//   - remote - the path of the object within that remote
+//   - modTime - the modification time as an RFC3339 string (optional, default now)
+//
+// It returns a handle to Write to and Close, or Abort to abandon the
+// upload. The object isn't complete until Close has returned
+// successfully. If the status
+// isn't 200 then the output is an error and the handle isn't valid.
+func OpenWrite(input string) (handle int64, output string, status int) {
+	const method = "OpenWrite"
+	in, err := readInput(input)
+	if err != nil {
+		output, status = writeError(method, in, err, http.StatusBadRequest)
+		return 0, output, status
+	}
+	s, err := openWrite(context.Background(), in)
+	if err != nil {
+		output, status = writeError(method, in, err, http.StatusInternalServerError)
+		return 0, output, status
+	}
+	output, status = writeOutput(method, in, rc.Params{})
+	return addStream(s), output, status
+}
+
+// Read reads up to len(p) bytes from the handle into p returning the
+// number of bytes read. At the end of the object it returns io.EOF.
+func Read(handle int64, p []byte) (n int, err error) {
+	s, err := getStream(handle)
+	if err != nil {
+		return 0, err
+	}
+	return s.Read(p)
+}
+
+// Write writes p to the handle
+func Write(handle int64, p []byte) (n int, err error) {
+	s, err := getStream(handle)
+	if err != nil {
+		return 0, err
+	}
+	return s.Write(p)
+}
+
+// Close closes the handle. For a handle opened with OpenWrite this
+// waits for the upload to finish and the output is a JSON object with
+// the remote, size and modTime of the object uploaded.
+//
+// The handle is invalid afterwards even if an error is returned.
+func Close(handle int64) (output string, status int) {
+	const method = "Close"
+	in := rc.Params{"handle": handle}
+	s, err := removeStream(handle)
+	if err != nil {
+		return writeError(method, in, err, http.StatusNotFound)
+	}
+	out, err := s.close()
+	if err != nil {
+		return writeError(method, in, err, http.StatusInternalServerError)
+	}
+	return writeOutput(method, in, out)
+}
+
+// Abort closes the handle like Close but for a handle opened with
+// OpenWrite the upload is abandoned so the object isn't made. Use
+// this if the data couldn't all be written.
+//
+// The handle is invalid afterwards even if an error is returned.
+func Abort(handle int64) (output string, status int) {
+	const method = "Abort"
+	in := rc.Params{"handle": handle}
+	s, err := removeStream(handle)
+	if err != nil {
+		return writeError(method, in, err, http.StatusNotFound)
+	}
+	if err := s.abort(); err != nil {
+		return writeError(method, in, err, http.StatusInternalServerError)
+	}
+	return writeOutput(method, in, rc.Params{})
+}
@@ -0,0 +1,120 @@
+package librclone
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	_ "github.com/rclone/rclone/backend/memory"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readAll reads the handle until EOF
+func readAll(t *testing.T, handle int64) string {
+	var out []byte
+	buf := make([]byte, 3)
+	for {
+		n, err := Read(handle, buf)
+		out = append(out, buf[:n]...)
+		if err == io.EOF {
+			return string(out)
+		}
+		require.NoError(t, err)
+	}
+}
+
+func TestReadRange(t *testing.T) {
+	for _, test := range []struct {
+		offset, count int64
+		want          *fs.RangeOption
+	}{
+		{0, -1, nil},
+		{2, -1, &fs.RangeOption{Start: 2, End: -1}},
+		{2, 3, &fs.RangeOption{Start: 2, End: 4}},
+		{0, 0, nil}, // the count is limited by the reader
+		{-3, -1, &fs.RangeOption{Start: 7, End: -1}},
+		{-10, -1, nil},
+		{-20, -1, nil},
+		{-20, 2, &fs.RangeOption{Start: 0, End: 1}},
+	} {
+		got := readRange(test.offset, test.count, 10)
+		assert.Equal(t, test.want, got, "offset=%d count=%d", test.offset, test.count)
+	}
+}
+
+func TestStream(t *testing.T) {
+	const contents = "0123456789"
+
+	handle, output, status := OpenWrite(`{"fs": ":memory:", "remote": "bucket/file.txt"}`)
+	require.Equal(t, http.StatusOK, status, output)
+	n, err := Write(handle, []byte(contents))
+	require.NoError(t, err)
+	assert.Equal(t, len(contents), n)
+	_, err = Read(handle, make([]byte, 1))
+	assert.Error(t, err)
+	output, status = Close(handle)
+	require.Equal(t, http.StatusOK, status, output)
+	var out rc.Params
+	require.NoError(t, json.Unmarshal([]byte(output), &out))
+	assert.Equal(t, "bucket/file.txt", out["remote"])
+	assert.Equal(t, float64(len(contents)), out["size"])
+
+	for _, test := range []struct {
+		params string
+		want   string
+	}{
+		{``, contents},
+		{`, "offset": 2`, "23456789"},
+		{`, "offset": 2, "count": 3`, "234"},
+		{`, "count": 0`, ""},
+		{`, "offset": -3`, "789"},
+		{`, "offset": -10`, contents},
+		{`, "offset": -20`, contents},
+		{`, "offset": -20, "count": 2`, "01"},
+	} {
+		handle, output, status := OpenRead(`{"fs": ":memory:", "remote": "bucket/file.txt"` + test.params + `}`)
+		require.Equal(t, http.StatusOK, status, output)
+		assert.Equal(t, test.want, readAll(t, handle), test.params)
+		_, err := Write(handle, []byte("x"))
+		assert.Error(t, err)
+		output, status = Close(handle)
+		assert.Equal(t, http.StatusOK, status, output)
+	}
+
+	// Errors
+	_, output, status = OpenRead(`{"fs": ":memory:", "remote": "bucket/notfound.txt"}`)
+	assert.Equal(t, http.StatusNotFound, status, output)
+	_, output, status = OpenRead(`not json`)
+	assert.Equal(t, http.StatusBadRequest, status, output)
+	output, status = Close(handle)
+	assert.Equal(t, http.StatusNotFound, status, output)
+	_, err = Read(handle, make([]byte, 1))
+	assert.Error(t, err)
+}
+
+func TestStreamAbort(t *testing.T) {
+	handle, output, status := OpenWrite(`{"fs": ":memory:", "remote": "bucket/aborted.txt"}`)
+	require.Equal(t, http.StatusOK, status, output)
+	_, err := Write(handle, []byte("truncated"))
+	require.NoError(t, err)
+	output, status = Abort(handle)
+	require.Equal(t, http.StatusOK, status, output)
+	_, output, status = OpenRead(`{"fs": ":memory:", "remote": "bucket/aborted.txt"}`)
+	assert.Equal(t, http.StatusNotFound, status, output)
+	output, status = Abort(handle)
+	assert.Equal(t, http.StatusNotFound, status, output)
+
+	// Aborting a read just closes it
+	handle, output, status = OpenWrite(`{"fs": ":memory:", "remote": "bucket/file.txt"}`)
+	require.Equal(t, http.StatusOK, status, output)
+	output, status = Close(handle)
+	require.Equal(t, http.StatusOK, status, output)
+	handle, output, status = OpenRead(`{"fs": ":memory:", "remote": "bucket/file.txt"}`)
+	require.Equal(t, http.StatusOK, status, output)
+	output, status = Abort(handle)
+	assert.Equal(t, http.StatusOK, status, output)
+}
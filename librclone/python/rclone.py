@@ -9,13 +9,27 @@ Then call rpc calls on it
 
     rclone.rpc("rc/noop", a=42, b="string", c=[1234])
 
+Open objects to read or write them as Python file objects
+
+    with rclone.open("remote:", "path/to/file", "rb") as f:
+        data = f.read()
+
+If the with block writing an object raises an exception the upload
+is abandoned rather than storing a truncated object.
+
+Receive stats, job and log events with a callback
+
+    handle = rclone.add_callback(print, types="job,log")
+    rclone.remove_callback(handle)
+
 When finished, close it
 
     rclone.close()
 """
 
-__all__ = ('Rclone', 'RcloneException')
+__all__ = ('Rclone', 'RcloneException', 'RcloneFile', 'RcloneBufferedWriter')
 
+import io
 import os
 import json
 import subprocess
@@ -39,6 +53,34 @@ class RcloneRPCResult(Structure):
     _fields_ = [("Output", RcloneRPCString),
                 ("Status", c_int)]
 
+class RcloneOpenResult(Structure):
+    """
+    This is returned from the C API when calling RcloneOpenRead or
+    RcloneOpenWrite
+    """
+    _fields_ = [("Handle", c_longlong),
+                ("Output", RcloneRPCString),
+                ("Status", c_int)]
+
+class RcloneIOResult(Structure):
+    """
+    This is returned from the C API when calling RcloneRead or
+    RcloneWrite
+    """
+    _fields_ = [("N", c_int),
+                ("Error", RcloneRPCString)]
+
+class RcloneCallbackResult(Structure):
+    """
+    This is returned from the C API when calling RcloneAddCallback
+    """
+    _fields_ = [("Handle", c_longlong),
+                ("Output", RcloneRPCString),
+                ("Status", c_int)]
+
+# The type of the callback passed to RcloneAddCallback
+RcloneCallback = CFUNCTYPE(None, c_char_p, c_void_p)
+
 class RcloneException(Exception):
     """
     Exception raised from rclone
@@ -54,6 +96,100 @@ class RcloneException(Exception):
         message = self.output.get('error', 'Unknown rclone error')
         super().__init__(message)
 
+class RcloneFile(io.RawIOBase):
+    """
+    An object in a remote open for reading or writing
+
+    Make these with Rclone.open rather than directly.
+
+    After closing, output is the dictionary returned by rclone which
+    for a file open for writing describes the object uploaded.
+    """
+    def __init__(self, rclone, handle, mode):
+        super().__init__()
+        self._rclone = rclone
+        self._handle = handle
+        self._mode = mode
+        self.output = None
+    def readable(self):
+        return "r" in self._mode
+    def writable(self):
+        return "w" in self._mode
+    def _check(self, resp):
+        """
+        Returns the number of bytes from resp raising OSError on error
+        """
+        if resp.Error.value is not None:
+            message = resp.Error.value.decode("utf-8")
+            self._rclone.RcloneFreeString(resp.Error)
+            raise OSError(message)
+        return resp.N
+    def readinto(self, b):
+        self._checkClosed()
+        self._checkReadable()
+        buf = (c_char * len(b)).from_buffer(b)
+        return self._check(self._rclone.RcloneRead(self._handle, buf, len(b)))
+    def write(self, b):
+        self._checkClosed()
+        self._checkWritable()
+        data = bytes(b)
+        return self._check(self._rclone.RcloneWrite(self._handle, data, len(data)))
+    def _finish(self, closer):
+        """
+        Close the handle with closer setting output
+
+        If rclone returns an error it will be raised as an
+        RcloneException.
+        """
+        if self.closed:
+            return
+        super().close()
+        resp = closer(self._handle)
+        output = json.loads(resp.Output.value.decode("utf-8"))
+        self._rclone.RcloneFreeString(resp.Output)
+        if resp.Status != 200:
+            raise RcloneException(output, resp.Status)
+        self.output = output
+    def close(self):
+        """
+        Close the file, finishing the upload if open for writing
+
+        If rclone returns an error it will be raised as an
+        RcloneException.
+        """
+        self._finish(self._rclone.RcloneClose)
+    def abort(self):
+        """
+        Close the file, abandoning the upload if open for writing so
+        the object isn't stored
+
+        If rclone returns an error it will be raised as an
+        RcloneException.
+        """
+        self._finish(self._rclone.RcloneAbort)
+    def __exit__(self, exc_type, exc_value, traceback):
+        if exc_type is not None:
+            self.abort()
+        else:
+            self.close()
+
+class RcloneBufferedWriter(io.BufferedWriter):
+    """
+    A buffered RcloneFile open for writing
+
+    This abandons the upload if the with block raises an exception.
+    """
+    def abort(self):
+        """
+        Close the file, abandoning the upload and any buffered data
+        """
+        self.raw.abort()
+    def __exit__(self, exc_type, exc_value, traceback):
+        if exc_type is not None:
+            self.abort()
+        else:
+            self.close()
+
 class Rclone():
     """
     Interface to Rclone via librclone.so
@@ -70,7 +206,33 @@ class Rclone():
         self.rclone.RcloneInitialize.argtypes = ()
         self.rclone.RcloneFinalize.restype = None
         self.rclone.RcloneFinalize.argtypes = ()
+        self.rclone.RcloneOpenRead.restype = RcloneOpenResult
+        self.rclone.RcloneOpenRead.argtypes = (c_char_p,)
+        self.rclone.RcloneOpenWrite.restype = RcloneOpenResult
+        self.rclone.RcloneOpenWrite.argtypes = (c_char_p,)
+        self.rclone.RcloneRead.restype = RcloneIOResult
+        self.rclone.RcloneRead.argtypes = (c_longlong, c_char_p, c_int)
+        self.rclone.RcloneWrite.restype = RcloneIOResult
+        self.rclone.RcloneWrite.argtypes = (c_longlong, c_char_p, c_int)
+        self.rclone.RcloneClose.restype = RcloneRPCResult
+        self.rclone.RcloneClose.argtypes = (c_longlong,)
+        self.rclone.RcloneAbort.restype = RcloneRPCResult
+        self.rclone.RcloneAbort.argtypes = (c_longlong,)
+        self.rclone.RcloneAddCallback.restype = RcloneCallbackResult
+        self.rclone.RcloneAddCallback.argtypes = (RcloneCallback, c_void_p, c_char_p)
+        self.rclone.RcloneRemoveCallback.restype = RcloneRPCResult
+        self.rclone.RcloneRemoveCallback.argtypes = (c_longlong,)
+        self.callbacks = {}
         self.rclone.RcloneInitialize()
+    def _output(self, resp):
+        """
+        Decode and free the output of resp raising RcloneException on error
+        """
+        output = json.loads(resp.Output.value.decode("utf-8"))
+        self.rclone.RcloneFreeString(resp.Output)
+        if resp.Status != 200:
+            raise RcloneException(output, resp.Status)
+        return output
     def rpc(self, method, **kwargs):
         """
         Call an rclone RC API call with the kwargs given.
@@ -83,17 +245,88 @@ class Rclone():
         method = method.encode("utf-8")
         parameters = json.dumps(kwargs).encode("utf-8")
         resp = self.rclone.RcloneRPC(method, parameters)
-        output = json.loads(resp.Output.value.decode("utf-8"))
-        self.rclone.RcloneFreeString(resp.Output)
-        status = resp.Status
-        if status != 200:
-            raise RcloneException(output, status)
-        return output
+        return self._output(resp)
+    def open(self, fs, remote, mode="rb", offset=0, count=-1, mod_time=None, buffering=io.DEFAULT_BUFFER_SIZE):
+        """
+        Open the object remote in fs for reading or writing.
+
+        mode should be "rb" to read or "wb" to write. When reading,
+        offset is where to start (negative counts from the end) and
+        count limits the bytes read. When writing, mod_time may be an
+        RFC3339 string to set the modification time.
+
+        This returns a buffered binary file object, or an RcloneFile
+        if buffering is 0. The upload isn't complete until the file
+        has been closed. Call abort on the file, or raise an exception
+        in its with block, to abandon the upload instead.
+
+        If an exception is raised from rclone it will of type
+        RcloneException.
+        """
+        kwargs = dict(fs=fs, remote=remote)
+        if mode == "rb":
+            if offset:
+                kwargs["offset"] = offset
+            if count >= 0:
+                kwargs["count"] = count
+            opener = self.rclone.RcloneOpenRead
+        elif mode == "wb":
+            if mod_time is not None:
+                kwargs["modTime"] = mod_time
+            opener = self.rclone.RcloneOpenWrite
+        else:
+            raise ValueError(f"invalid mode {mode!r}: must be 'rb' or 'wb'")
+        resp = opener(json.dumps(kwargs).encode("utf-8"))
+        self._output(resp)
+        f = RcloneFile(self.rclone, resp.Handle, mode)
+        if buffering == 0:
+            return f
+        if mode == "rb":
+            return io.BufferedReader(f, buffering)
+        return RcloneBufferedWriter(f, buffering)
+    def add_callback(self, fn, types=None, group=None, level=None, interval=None):
+        """
+        Call fn with each stats, job and log event.
+
+        fn is called with a dictionary with type, time, group and data
+        keys from a thread belonging to rclone.
+
+        types is a comma separated list of "stats", "job" and "log" to
+        choose the events (default all), group only sends stats and
+        job events for that stats group, level is the minimum log
+        level (default "INFO") and interval is how often to send stats
+        (default "1s").
+
+        Returns a handle to pass to remove_callback.
+
+        If an exception is raised from rclone it will of type
+        RcloneException.
+        """
+        kwargs = dict(types=types, group=group, level=level, interval=interval)
+        kwargs = {k: v for k, v in kwargs.items() if v is not None}
+        def callback(event, userdata):
+            fn(json.loads(event.decode("utf-8")))
+        c_callback = RcloneCallback(callback)
+        resp = self.rclone.RcloneAddCallback(c_callback, None, json.dumps(kwargs).encode("utf-8"))
+        self._output(resp)
+        # keep a reference so the callback isn't garbage collected
+        self.callbacks[resp.Handle] = c_callback
+        return resp.Handle
+    def remove_callback(self, handle):
+        """
+        Stop calling the callback added with add_callback.
+
+        This mustn't be called from within the callback.
+        """
+        resp = self.rclone.RcloneRemoveCallback(handle)
+        self._output(resp)
+        del self.callbacks[handle]
     def close(self):
         """
         Call to finish with the rclone connection
         """
         self.rclone.RcloneFinalize()
+        self.callbacks = {}
         self.rclone = None
     @classmethod
     def build(cls, shared_object):
@@ -3,8 +3,12 @@
 Test program for librclone
 """
 
+import io
 import os
+import shutil
 import subprocess
+import tempfile
+import threading
 import unittest
 from rclone import *
 
@@ -38,5 +42,80 @@ class TestRclone(unittest.TestCase):
         else:
             raise ValueError("Expecting exception")
 
+    def test_open(self):
+        tmp = tempfile.mkdtemp()
+        try:
+            data = b"hello, world\n" * 1000
+            with self.rclone.open(tmp, "file.txt", "wb", mod_time="2001-02-03T04:05:06Z") as f:
+                f.write(data[:100])
+                f.write(data[100:])
+            with open(os.path.join(tmp, "file.txt"), "rb") as f:
+                self.assertEqual(data, f.read())
+            with self.rclone.open(tmp, "file.txt", "rb") as f:
+                self.assertEqual(data, f.read())
+            with self.rclone.open(tmp, "file.txt", "rb", offset=7, count=5) as f:
+                self.assertEqual(b"world", f.read())
+            with self.rclone.open(tmp, "file.txt", "rb", offset=-6) as f:
+                self.assertEqual(b"world\n", f.read())
+            f = self.rclone.open(tmp, "file.txt", "wb", buffering=0)
+            f.write(b"potato")
+            f.close()
+            self.assertEqual(f.output["size"], 6)
+            self.assertEqual(f.output["remote"], "file.txt")
+        finally:
+            shutil.rmtree(tmp)
+
+    def test_open_abort(self):
+        tmp = tempfile.mkdtemp()
+        try:
+            for buffering in (0, io.DEFAULT_BUFFER_SIZE):
+                with self.assertRaises(ValueError):
+                    with self.rclone.open(tmp, "file.txt", "wb", buffering=buffering) as f:
+                        f.write(b"truncated")
+                        raise ValueError("boom")
+                self.assertTrue(f.closed)
+                self.assertFalse(os.path.exists(os.path.join(tmp, "file.txt")))
+            f = self.rclone.open(tmp, "file.txt", "wb")
+            f.write(b"truncated")
+            f.abort()
+            self.assertTrue(f.closed)
+            self.assertFalse(os.path.exists(os.path.join(tmp, "file.txt")))
+        finally:
+            shutil.rmtree(tmp)
+
+    def test_open_error(self):
+        with self.assertRaises(RcloneException) as cm:
+            self.rclone.open("/nonexistent-dir", "potato", "rb")
+        self.assertEqual(cm.exception.output["path"], "OpenRead")
+        with self.assertRaises(ValueError):
+            self.rclone.open("/", "potato", "r+")
+
+    def test_callback(self):
+        events = []
+        got_log = threading.Event()
+        def callback(event):
+            events.append(event)
+            if event["type"] == "log":
+                got_log.set()
+        handle = self.rclone.add_callback(callback, types="job,log")
+        try:
+            with self.assertRaises(RcloneException):
+                self.rclone.rpc("rc/error")
+            self.assertTrue(got_log.wait(10))
+        finally:
+            self.rclone.remove_callback(handle)
+        types = {event["type"] for event in events}
+        self.assertIn("job", types)
+        self.assertIn("log", types)
+        self.assertNotIn("stats", types)
+        with self.assertRaises(RcloneException) as cm:
+            self.rclone.remove_callback(handle)
+        self.assertEqual(cm.exception.status, 404)
+
+    def test_callback_error(self):
+        with self.assertRaises(RcloneException) as cm:
+            self.rclone.add_callback(print, types="potato")
+        self.assertEqual(cm.exception.status, 400)
+
 if __name__ == '__main__':
     unittest.main()
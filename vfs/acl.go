@@ -0,0 +1,119 @@
+package vfs
+
+// Per path access control set with --vfs-acl
+//
+// The rules aren't enforced by the VFS itself but by the servers
+// which use it, as they know which operations their clients are
+// doing. The other commands refuse to run if they are set.
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/vfs/vfscommon"
+)
+
+// acl holds the parsed rules of --vfs-acl
+type acl struct {
+	rules           []vfscommon.ACLRule // longest path first
+	caseInsensitive bool                // match paths case insensitively
+}
+
+// newACL parses the ACL for the VFS or returns nil if there isn't one
+//
+// If the ACL can't be parsed then everything is denied.
+func newACL(vfs *VFS) *acl {
+	if vfs.Opt.ACL == "" {
+		return nil
+	}
+	a := &acl{caseInsensitive: vfs.Opt.CaseInsensitive}
+	rules, err := vfscommon.ParseACL(string(vfs.Opt.ACL))
+	if err != nil {
+		fs.Errorf(vfs.f, "Denying all access: %v", err)
+		return a
+	}
+	for _, rule := range rules {
+		rule.Path = a.fold(rule.Path)
+		a.rules = append(a.rules, rule)
+	}
+	sort.SliceStable(a.rules, func(i, j int) bool {
+		return len(a.rules[i].Path) > len(a.rules[j].Path)
+	})
+	return a
+}
+
+// fold the case of name if matching case insensitively
+func (a *acl) fold(name string) string {
+	if a.caseInsensitive {
+		return strings.ToLower(name)
+	}
+	return name
+}
+
+// isBelow returns true if name is dir or inside it
+func isBelow(name, dir string) bool {
+	return dir == "" || name == dir || strings.HasPrefix(name, dir+"/")
+}
+
+// perm returns the permissions of the longest rule matching name
+func (a *acl) perm(name string) vfscommon.Perm {
+	for _, rule := range a.rules {
+		if isBelow(name, rule.Path) {
+			return rule.Perm
+		}
+	}
+	return 0
+}
+
+// leadsTo returns true if there is a rule granting something strictly
+// inside the directory name
+func (a *acl) leadsTo(name string) bool {
+	for _, rule := range a.rules {
+		if rule.Perm != 0 && rule.Path != name && isBelow(rule.Path, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// check returns nil if perm is allowed on name
+func (a *acl) check(name string, perm vfscommon.Perm) error {
+	name = a.fold(vfscommon.CleanACLPath(name))
+	have := a.perm(name)
+	if have == 0 && name != "" && !a.leadsTo(name) {
+		return ENOENT
+	}
+	// Directories with no rules of their own leading to allowed
+	// paths can be listed
+	if perm == vfscommon.PermList && have == 0 && a.leadsTo(name) {
+		return nil
+	}
+	if have&perm != perm {
+		return EPERM
+	}
+	return nil
+}
+
+// CheckAccess returns nil if the --vfs-acl rules allow perm on name,
+// which is a path relative to the root of the VFS.
+//
+// Use a perm of 0 to check name may be looked up. Directories which
+// lead to paths with permissions may always be looked up and listed,
+// though they only show the items which may be looked up (see
+// Visible).
+//
+// It returns ENOENT if name should be hidden completely or EPERM if
+// the access is denied.
+func (vfs *VFS) CheckAccess(name string, perm vfscommon.Perm) error {
+	if vfs.acl == nil {
+		return nil
+	}
+	return vfs.acl.check(name, perm)
+}
+
+// Visible returns true if name may be looked up and so should be
+// shown in directory listings.
+func (vfs *VFS) Visible(name string) bool {
+	return vfs.CheckAccess(name, 0) == nil
+}
@@ -0,0 +1,85 @@
+package vfs
+
+import (
+	"testing"
+
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestACLNone(t *testing.T) {
+	_, vfs := newTestVFS(t)
+	assert.Nil(t, vfs.acl)
+	assert.NoError(t, vfs.CheckAccess("anything", vfscommon.PermAll))
+	assert.True(t, vfs.Visible("anything"))
+}
+
+func TestACL(t *testing.T) {
+	opt := vfscommon.Opt
+	opt.ACL = "/public=rl,/public/secret=-,/incoming=w,/home/me=rwld"
+	_, vfs := newTestVFSOpt(t, &opt)
+
+	const (
+		r = vfscommon.PermRead
+		w = vfscommon.PermWrite
+		l = vfscommon.PermList
+		d = vfscommon.PermDelete
+	)
+	for _, test := range []struct {
+		name string
+		perm vfscommon.Perm
+		want error
+	}{
+		// the root and directories leading to rules can be listed
+		{"", 0, nil},
+		{"/", l, nil},
+		{"", r, EPERM},
+		{"", w, EPERM},
+		{"home", l, nil},
+		{"home", d, EPERM},
+		{"home/other", 0, ENOENT},
+		// read only
+		{"public", l, nil},
+		{"/public/file.txt", r, nil},
+		{"public/dir/file.txt", r | l, nil},
+		{"public/file.txt", w, EPERM},
+		{"public/file.txt", d, EPERM},
+		{"public/secret", 0, ENOENT},
+		{"public/secret/file.txt", r, ENOENT},
+		{"public/secretive", r, nil},
+		// upload only
+		{"incoming", 0, nil},
+		{"incoming", l, EPERM},
+		{"incoming/file.txt", w, nil},
+		{"incoming/file.txt", r, EPERM},
+		// full access
+		{"home/me/file.txt", r | w | l | d, nil},
+		// path tricks
+		{"public/../private", 0, ENOENT},
+		{"public/../home/me/file.txt", w, nil},
+		{"HOME/me", l, ENOENT},
+		{"private", 0, ENOENT},
+	} {
+		assert.Equal(t, test.want, vfs.CheckAccess(test.name, test.perm), "%q %v", test.name, test.perm)
+		assert.Equal(t, test.want != ENOENT, vfs.Visible(test.name), "%q", test.name)
+	}
+}
+
+func TestACLCaseInsensitive(t *testing.T) {
+	opt := vfscommon.Opt
+	opt.ACL = "/Public=rl"
+	opt.CaseInsensitive = true
+	_, vfs := newTestVFSOpt(t, &opt)
+	assert.NoError(t, vfs.CheckAccess("public/file.txt", vfscommon.PermRead))
+	assert.NoError(t, vfs.CheckAccess("PUBLIC/file.txt", vfscommon.PermRead))
+	assert.Equal(t, ENOENT, vfs.CheckAccess("private", 0))
+}
+
+func TestACLBad(t *testing.T) {
+	opt := vfscommon.Opt
+	opt.ACL = "/public=potato"
+	_, vfs := newTestVFSOpt(t, &opt)
+	assert.NoError(t, vfs.CheckAccess("", 0))
+	assert.Equal(t, ENOENT, vfs.CheckAccess("public", vfscommon.PermList))
+	assert.Equal(t, EPERM, vfs.CheckAccess("", vfscommon.PermList))
+}
@@ -784,6 +784,9 @@ func (d *Dir) _readDirFromEntries(entries fs.DirEntries, dirTree dirtree.DirTree
 		d.items[name] = node
 	}
 	mv.end(d)
+	if d.parent == nil && d.vfs.snapshots != nil {
+		d._addSnapshotsDir()
+	}
 	return nil
 }
 
@@ -879,6 +882,13 @@ func (d *Dir) stat(leaf string) (Node, error) {
 	item, ok := d.items[leaf]
 	d.mu.Unlock()
 
+	// Look for a snapshot which isn't listed
+	if !ok && d.isSnapshotsRoot() {
+		if node := d.statSnapshot(leaf); node != nil {
+			return node, nil
+		}
+	}
+
 	// Look for a metadata file
 	if !ok {
 		if baseLeaf, found := d.vfs.isMetadataFile(leaf); found {
@@ -945,7 +955,7 @@ func (d *Dir) Size() int64 {
 
 // SetModTime sets the modTime for this dir
 func (d *Dir) SetModTime(modTime time.Time) error {
-	if d.vfs.Opt.ReadOnly {
+	if d.readOnly() {
 		return EROFS
 	}
 	d.modTimeMu.Lock()
@@ -1052,9 +1062,12 @@ func (d *Dir) Create(name string, flags int) (*File, error) {
 		return nil, err
 	}
 	// node doesn't exist so create it
-	if d.vfs.Opt.ReadOnly {
+	if d.readOnly() {
 		return nil, EROFS
 	}
+	if err = d.vfs.quota.use(0, 1); err != nil {
+		return nil, err
+	}
 	if err = d.SetModTime(time.Now()); err != nil {
 		fs.Errorf(d, "Dir.Create failed to set modtime on parent dir: %v", err)
 		return nil, err
@@ -1065,7 +1078,7 @@ func (d *Dir) Create(name string, flags int) (*File, error) {
 
 // Mkdir creates a new directory
 func (d *Dir) Mkdir(name string) (*Dir, error) {
-	if d.vfs.Opt.ReadOnly {
+	if d.readOnly() {
 		return nil, EROFS
 	}
 	path := path.Join(d.path, name)
@@ -1103,7 +1116,7 @@ func (d *Dir) Mkdir(name string) (*Dir, error) {
 
 // Remove the directory
 func (d *Dir) Remove() error {
-	if d.vfs.Opt.ReadOnly {
+	if d.readOnly() {
 		return EROFS
 	}
 	// Check directory is empty first
@@ -1131,7 +1144,7 @@ func (d *Dir) Remove() error {
 
 // RemoveAll removes the directory and any contents recursively
 func (d *Dir) RemoveAll() error {
-	if d.vfs.Opt.ReadOnly {
+	if d.readOnly() {
 		return EROFS
 	}
 	// Remove contents of the directory
@@ -1159,7 +1172,7 @@ func (d *Dir) DirEntry() (entry fs.DirEntry) {
 // which must be a directory.  The entry to be removed may correspond
 // to a file (unlink) or to a directory (rmdir).
 func (d *Dir) RemoveName(name string) error {
-	if d.vfs.Opt.ReadOnly {
+	if d.readOnly() {
 		return EROFS
 	}
 	// fs.Debugf(path, "Dir.Remove")
@@ -1178,7 +1191,7 @@ func (d *Dir) RemoveName(name string) error {
 // Rename the file
 func (d *Dir) Rename(oldName, newName string, destDir *Dir) error {
 	// fs.Debugf(d, "BEFORE\n%s", d.dump())
-	if d.vfs.Opt.ReadOnly {
+	if d.readOnly() || destDir.readOnly() {
 		return EROFS
 	}
 	oldPath := path.Join(d.path, oldName)
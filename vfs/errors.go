@@ -21,6 +21,10 @@ const (
 	EROFS
 	ENOSYS
 	ELOOP
+	ENOATTR
+	ENOTSUP
+	ENOSPC
+	EAGAIN
 )
 
 // Errors which have exact counterparts in os
@@ -40,6 +44,10 @@ var errorNames = []string{
 	EROFS:     "Read only file system",
 	ENOSYS:    "Function not implemented",
 	ELOOP:     "Too many symbolic links",
+	ENOATTR:   "No such attribute",
+	ENOTSUP:   "Operation not supported",
+	ENOSPC:    "No space left on device",
+	EAGAIN:    "Resource temporarily unavailable",
 }
 
 // Error renders the error as a string
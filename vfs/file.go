@@ -53,6 +53,7 @@ type File struct {
 	writers          []Handle                        // writers for this file
 	virtualModTime   *time.Time                      // modtime for backends with Precision == fs.ModTimeNotSupported
 	pendingModTime   time.Time                       // will be applied once o becomes available, i.e. after file was written
+	pendingMetadata  fs.Metadata                     // user metadata to be applied once o becomes available
 	pendingRenameFun func(ctx context.Context) error // will be run/renamed after all writers close
 	sys              atomic.Value                    // user defined info to be attached here
 	nwriters         atomic.Int32                    // len(writers)
@@ -459,7 +460,7 @@ func (f *File) SetModTime(modTime time.Time) error {
 	if f.d.vfs.Opt.NoModTime {
 		return nil
 	}
-	if f.d.vfs.Opt.ReadOnly {
+	if f.d.readOnly() {
 		return EROFS
 	}
 
@@ -544,6 +545,7 @@ func (f *File) setObject(o fs.Object) {
 	f.o = o
 	f._setIsLink()
 	_ = f._applyPendingModTime()
+	_ = f._applyPendingMetadata()
 	d := f.d
 	f.mu.Unlock()
 
@@ -620,7 +622,7 @@ func (f *File) openWrite(flags int) (fh *WriteFileHandle, err error) {
 	d := f.d
 	f.mu.RUnlock()
 
-	if d.vfs.Opt.ReadOnly {
+	if d.readOnly() {
 		return nil, EROFS
 	}
 	// fs.Debugf(f.Path(), "File.openWrite")
@@ -642,7 +644,7 @@ func (f *File) openRW(flags int) (fh *RWFileHandle, err error) {
 	f.mu.RUnlock()
 
 	// FIXME chunked
-	if flags&accessModeMask != os.O_RDONLY && d.vfs.Opt.ReadOnly {
+	if flags&accessModeMask != os.O_RDONLY && d.readOnly() {
 		return nil, EROFS
 	}
 	// fs.Debugf(f.Path(), "File.openRW")
@@ -669,7 +671,7 @@ func (f *File) Remove() (err error) {
 	d := f.d
 	f.mu.RUnlock()
 
-	if d.vfs.Opt.ReadOnly {
+	if d.readOnly() {
 		return EROFS
 	}
 
@@ -700,6 +702,7 @@ func (f *File) Remove() (err error) {
 	// called with File.mu released when there is no error removing the underlying file
 	if err == nil {
 		d.delObject(f.Name())
+		_ = d.vfs.quota.use(-f.Size(), -1)
 	}
 	return err
 }
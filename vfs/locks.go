@@ -0,0 +1,451 @@
+package vfs
+
+// Lock manager
+//
+// This keeps track of advisory locks on paths in the VFS. The locks
+// are kept in memory unless --vfs-lock-file is set in which case they
+// are stored in a JSON object on the remote so they are shared by all
+// the rclone instances using the same lock file.
+//
+// The object stores don't have an atomic compare and swap, so the lock
+// file is read back after each change to check the change wasn't
+// overwritten by another instance.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/lib/random"
+)
+
+// lockCacheTime is how long a read of the lock file is used for
+// checking locks before it is read again.
+const lockCacheTime = time.Second
+
+// Lock describes a lock held on a path in the VFS
+type Lock struct {
+	Token     string    `json:"token"`            // unique identifier for the lock
+	Path      string    `json:"path"`             // path in the VFS which is locked
+	Owner     string    `json:"owner,omitempty"`  // description of the owner of the lock
+	Host      string    `json:"host,omitempty"`   // host name of the rclone which made the lock
+	Exclusive bool      `json:"exclusive"`        // if not set this is a shared lock
+	Recursive bool      `json:"recursive"`        // if set the lock covers everything under Path
+	Expires   time.Time `json:"expires,omitzero"` // when the lock expires - zero for never
+	held      bool      // set if this rclone keeps the lock refreshed until unlocked
+}
+
+// expired returns true if the lock has expired at now
+func (l *Lock) expired(now time.Time) bool {
+	return !l.Expires.IsZero() && now.After(l.Expires)
+}
+
+// isUnder returns true if p is dir or is inside dir
+func isUnder(p, dir string) bool {
+	return dir == "" || p == dir || strings.HasPrefix(p, dir+"/")
+}
+
+// covers returns true if the lock applies to p
+func (l *Lock) covers(p string) bool {
+	return l.Path == p || (l.Recursive && isUnder(p, l.Path))
+}
+
+// conflicts returns true if l conflicts with a new lock on p
+func (l *Lock) conflicts(p string, exclusive, recursive bool) bool {
+	if !l.Exclusive && !exclusive {
+		return false
+	}
+	return l.covers(p) || (recursive && isUnder(l.Path, p))
+}
+
+// LockManager keeps track of the locks for a VFS
+type LockManager struct {
+	ttl      time.Duration // lifetime of locks made with a zero ttl - 0 or less for never
+	host     string        // host name to put in the locks
+	f        fs.Fs         // Fs the lock file is in or nil if locks are in memory
+	leaf     string        // name of the lock file in f
+	mu       sync.Mutex    // protects the below
+	locks    []*Lock       // all the locks known about
+	readTime time.Time     // when locks was read from the lock file
+	refresh  *time.Ticker  // refreshes held locks if running
+	done     chan struct{} // closed to stop the refresher
+}
+
+// newLockManager makes a lock manager for the VFS, opening the lock
+// file if --vfs-lock-file is set.
+//
+// If the lock file can't be opened it returns an error along with a
+// lock manager which keeps the locks in memory.
+func newLockManager(ctx context.Context, vfs *VFS) (m *LockManager, err error) {
+	m = &LockManager{
+		ttl: time.Duration(vfs.Opt.LockTTL),
+	}
+	m.host, _ = os.Hostname()
+	if vfs.Opt.LockFile == "" {
+		return m, nil
+	}
+	parent, leaf, err := fspath.Split(vfs.Opt.LockFile)
+	if err != nil {
+		return m, fmt.Errorf("failed to parse --vfs-lock-file: %w", err)
+	}
+	if leaf == "" {
+		return m, fmt.Errorf("--vfs-lock-file %q must be a file", vfs.Opt.LockFile)
+	}
+	f, err := cache.Get(ctx, parent)
+	if err != nil && !errors.Is(err, fs.ErrorIsFile) {
+		return m, fmt.Errorf("failed to open --vfs-lock-file: %w", err)
+	}
+	m.f, m.leaf = f, leaf
+	return m, nil
+}
+
+// Locks returns the lock manager for the VFS
+func (vfs *VFS) Locks() *LockManager {
+	return vfs.locks
+}
+
+// _read reads the locks from the lock file, removing any which have
+// expired.
+//
+// If fresh is false it may use a recent read.
+//
+// Call with the lock held.
+func (m *LockManager) _read(ctx context.Context, fresh bool) error {
+	if m.f == nil || (!fresh && time.Since(m.readTime) < lockCacheTime) {
+		m._expire()
+		return nil
+	}
+	var locks []*Lock
+	o, err := m.f.NewObject(ctx, m.leaf)
+	if err == nil {
+		var in io.ReadCloser
+		in, err = operations.Open(ctx, o)
+		if err != nil {
+			return fmt.Errorf("failed to open lock file: %w", err)
+		}
+		err = json.NewDecoder(in).Decode(&locks)
+		_ = in.Close()
+		if err != nil {
+			return fmt.Errorf("failed to decode lock file: %w", err)
+		}
+	} else if !errors.Is(err, fs.ErrorObjectNotFound) {
+		return fmt.Errorf("failed to find lock file: %w", err)
+	}
+	// Keep our idea of which locks are held by us
+	for _, l := range locks {
+		if old := m._find(l.Token); old != nil {
+			l.held = old.held
+		}
+	}
+	m.locks = locks
+	m.readTime = time.Now()
+	m._expire()
+	return nil
+}
+
+// _expire removes any expired locks
+//
+// Call with the lock held.
+func (m *LockManager) _expire() {
+	now := time.Now()
+	m.locks = slices.DeleteFunc(m.locks, func(l *Lock) bool {
+		return l.expired(now)
+	})
+}
+
+// _write writes the locks to the lock file and reads them back,
+// returning EAGAIN if the lock with token has been lost (or still
+// exists if deleted is set).
+//
+// Call with the lock held.
+func (m *LockManager) _write(ctx context.Context, token string, deleted bool) error {
+	if m.f == nil {
+		return nil
+	}
+	data, err := json.MarshalIndent(m.locks, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = operations.RcatSize(ctx, m.f, m.leaf, io.NopCloser(bytes.NewReader(data)), int64(len(data)), time.Now(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to write lock file: %w", err)
+	}
+	err = m._read(ctx, true)
+	if err != nil {
+		return err
+	}
+	if (m._find(token) == nil) != deleted {
+		fs.Debugf(m.leaf, "Lost race updating lock %q", token)
+		return EAGAIN
+	}
+	return nil
+}
+
+// _find the lock with token or return nil
+//
+// Call with the lock held.
+func (m *LockManager) _find(token string) *Lock {
+	for _, l := range m.locks {
+		if l.Token == token {
+			return l
+		}
+	}
+	return nil
+}
+
+// expires works out the expiry time for a lock with ttl
+//
+// A ttl of 0 means use the default and a negative ttl means never
+// expire. If the default is 0 the locks never expire either.
+func (m *LockManager) expires(ttl time.Duration) time.Time {
+	if ttl == 0 {
+		ttl = m.ttl
+	}
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
+// Lock locks name for owner, returning EAGAIN if a conflicting lock is
+// held.
+//
+// If exclusive isn't set then the lock is shared with other shared
+// locks. If recursive is set the lock applies to everything under
+// name too.
+//
+// If ttl is 0 the lock is held until Unlock is called and is
+// refreshed in the background. Otherwise it expires after ttl unless
+// refreshed with Refresh. A negative ttl means the lock never
+// expires.
+func (m *LockManager) Lock(name, owner string, exclusive, recursive bool, ttl time.Duration) (lock Lock, err error) {
+	name = strings.Trim(name, "/")
+	ctx := context.TODO()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m._read(ctx, true); err != nil {
+		return lock, err
+	}
+	for _, l := range m.locks {
+		if l.conflicts(name, exclusive, recursive) {
+			return lock, EAGAIN
+		}
+	}
+	l := &Lock{
+		Token:     random.String(24),
+		Path:      name,
+		Owner:     owner,
+		Host:      m.host,
+		Exclusive: exclusive,
+		Recursive: recursive,
+		Expires:   m.expires(ttl),
+		held:      ttl == 0,
+	}
+	if l.held && m.f == nil {
+		// in memory locks go away with rclone so don't need refreshing
+		l.Expires = time.Time{}
+	}
+	m.locks = append(m.locks, l)
+	if err := m._write(ctx, l.Token, false); err != nil {
+		m.locks = slices.DeleteFunc(m.locks, func(old *Lock) bool { return old == l })
+		return lock, err
+	}
+	if l.held {
+		m._startRefresh()
+	}
+	return *l, nil
+}
+
+// Refresh extends the lifetime of the lock with token by ttl
+//
+// It returns ENOENT if the lock isn't found.
+func (m *LockManager) Refresh(token string, ttl time.Duration) (lock Lock, err error) {
+	ctx := context.TODO()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m._read(ctx, true); err != nil {
+		return lock, err
+	}
+	l := m._find(token)
+	if l == nil {
+		return lock, ENOENT
+	}
+	l.Expires = m.expires(ttl)
+	if err := m._write(ctx, token, false); err != nil {
+		return lock, err
+	}
+	return *l, nil
+}
+
+// Unlock removes the lock with token
+//
+// It returns ENOENT if the lock isn't found.
+func (m *LockManager) Unlock(token string) error {
+	ctx := context.TODO()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m._read(ctx, true); err != nil {
+		return err
+	}
+	if m._find(token) == nil {
+		return ENOENT
+	}
+	m.locks = slices.DeleteFunc(m.locks, func(l *Lock) bool { return l.Token == token })
+	return m._write(ctx, token, true)
+}
+
+// Get returns the lock with token
+//
+// It returns ENOENT if the lock isn't found.
+func (m *LockManager) Get(token string) (lock Lock, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m._read(context.TODO(), false); err != nil {
+		return lock, err
+	}
+	l := m._find(token)
+	if l == nil {
+		return lock, ENOENT
+	}
+	return *l, nil
+}
+
+// Find returns the locks which apply to name
+func (m *LockManager) Find(name string) (locks []Lock, err error) {
+	name = strings.Trim(name, "/")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m._read(context.TODO(), false); err != nil {
+		return nil, err
+	}
+	for _, l := range m.locks {
+		if l.covers(name) {
+			locks = append(locks, *l)
+		}
+	}
+	return locks, nil
+}
+
+// CheckWrite returns EAGAIN if name is exclusively locked
+//
+// This is for protocols which can't take part in locking so that they
+// don't overwrite locked files.
+func (m *LockManager) CheckWrite(name string) error {
+	locks, err := m.Find(name)
+	if err != nil {
+		return err
+	}
+	for _, l := range locks {
+		if l.Exclusive {
+			return EAGAIN
+		}
+	}
+	return nil
+}
+
+// _startRefresh starts the background refresh of held locks if it
+// isn't running
+//
+// Call with the lock held.
+func (m *LockManager) _startRefresh() {
+	if m.f == nil || m.refresh != nil || m.ttl <= 0 {
+		return
+	}
+	m.refresh = time.NewTicker(m.ttl / 2)
+	m.done = make(chan struct{})
+	go m.refresher(m.refresh, m.done)
+}
+
+// _stopRefresh stops the background refresh if running
+//
+// Call with the lock held.
+func (m *LockManager) _stopRefresh() {
+	if m.refresh == nil {
+		return
+	}
+	m.refresh.Stop()
+	close(m.done)
+	m.refresh = nil
+}
+
+// refresher refreshes the held locks in the lock file until done is
+// closed or there are no held locks.
+func (m *LockManager) refresher(ticker *time.Ticker, done chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		if !m.refreshHeld() {
+			return
+		}
+	}
+}
+
+// refreshHeld refreshes all the held locks, returning false if there
+// are none left.
+func (m *LockManager) refreshHeld() bool {
+	ctx := context.TODO()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m._read(ctx, true); err != nil {
+		fs.Errorf(m.leaf, "Failed to refresh locks: %v", err)
+		return true
+	}
+	held := ""
+	for _, l := range m.locks {
+		if l.held {
+			l.Expires = m.expires(0)
+			held = l.Token
+		}
+	}
+	if held == "" {
+		m._stopRefresh()
+		return false
+	}
+	if err := m._write(ctx, held, false); err != nil {
+		fs.Errorf(m.leaf, "Failed to refresh locks: %v", err)
+	}
+	return true
+}
+
+// shutdown releases any held locks and stops the refresher
+func (m *LockManager) shutdown() {
+	ctx := context.TODO()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m._stopRefresh()
+	if m.f == nil {
+		return
+	}
+	if err := m._read(ctx, true); err != nil {
+		fs.Errorf(m.leaf, "Failed to release locks: %v", err)
+		return
+	}
+	var released string
+	m.locks = slices.DeleteFunc(m.locks, func(l *Lock) bool {
+		if l.held {
+			released = l.Token
+		}
+		return l.held
+	})
+	if released == "" {
+		return
+	}
+	if err := m._write(ctx, released, true); err != nil {
+		fs.Errorf(m.leaf, "Failed to release locks: %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+package vfs
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockConflicts(t *testing.T) {
+	for _, test := range []struct {
+		lock      Lock
+		path      string
+		exclusive bool
+		recursive bool
+		want      bool
+	}{
+		{Lock{Path: "a", Exclusive: true}, "a", false, false, true},
+		{Lock{Path: "a", Exclusive: false}, "a", false, false, false},
+		{Lock{Path: "a", Exclusive: false}, "a", true, false, true},
+		{Lock{Path: "a", Exclusive: true}, "b", true, false, false},
+		{Lock{Path: "a", Exclusive: true}, "a/b", true, false, false},
+		{Lock{Path: "a", Exclusive: true, Recursive: true}, "a/b", true, false, true},
+		{Lock{Path: "a", Exclusive: true, Recursive: true}, "ab", true, false, false},
+		{Lock{Path: "", Exclusive: true, Recursive: true}, "a/b", true, false, true},
+		{Lock{Path: "a/b", Exclusive: true}, "a", true, false, false},
+		{Lock{Path: "a/b", Exclusive: true}, "a", true, true, true},
+	} {
+		got := test.lock.conflicts(test.path, test.exclusive, test.recursive)
+		assert.Equal(t, test.want, got, "%+v %q exclusive=%v recursive=%v", test.lock, test.path, test.exclusive, test.recursive)
+	}
+}
+
+func TestLocksMemory(t *testing.T) {
+	_, vfs := newTestVFS(t)
+	m := vfs.Locks()
+	require.NotNil(t, m)
+
+	lock1, err := m.Lock("/dir/file", "me", true, false, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "dir/file", lock1.Path)
+	assert.True(t, lock1.Expires.IsZero())
+
+	// Conflicting locks
+	_, err = m.Lock("dir/file", "you", true, false, 0)
+	assert.Equal(t, EAGAIN, err)
+	_, err = m.Lock("dir/file", "you", false, false, 0)
+	assert.Equal(t, EAGAIN, err)
+	_, err = m.Lock("dir", "you", true, true, 0)
+	assert.Equal(t, EAGAIN, err)
+	assert.Equal(t, EAGAIN, m.CheckWrite("dir/file"))
+	assert.NoError(t, m.CheckWrite("dir/file2"))
+
+	// Non conflicting
+	lock2, err := m.Lock("dir", "you", true, false, time.Minute)
+	require.NoError(t, err)
+	assert.False(t, lock2.Expires.IsZero())
+
+	locks, err := m.Find("dir/file")
+	require.NoError(t, err)
+	assert.Equal(t, []Lock{lock1}, locks)
+
+	got, err := m.Get(lock2.Token)
+	require.NoError(t, err)
+	assert.Equal(t, lock2, got)
+
+	// Unlock
+	require.NoError(t, m.Unlock(lock1.Token))
+	assert.Equal(t, ENOENT, m.Unlock(lock1.Token))
+	_, err = m.Refresh(lock1.Token, time.Minute)
+	assert.Equal(t, ENOENT, err)
+	assert.NoError(t, m.CheckWrite("dir/file"))
+
+	// Shared locks
+	_, err = m.Lock("dir/file", "me", false, false, 0)
+	require.NoError(t, err)
+	_, err = m.Lock("dir/file", "you", false, false, 0)
+	require.NoError(t, err)
+	assert.NoError(t, m.CheckWrite("dir/file"))
+
+	// Expiry and refresh
+	lock3, err := m.Lock("expiring", "me", true, false, time.Millisecond)
+	require.NoError(t, err)
+	lock3, err = m.Refresh(lock3.Token, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, EAGAIN, m.CheckWrite("expiring"))
+	_, err = m.Refresh(lock3.Token, time.Millisecond)
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+	assert.NoError(t, m.CheckWrite("expiring"))
+	_, err = m.Get(lock3.Token)
+	assert.Equal(t, ENOENT, err)
+}
+
+func TestLocksFile(t *testing.T) {
+	opt := vfscommon.Opt
+	opt.LockFile = filepath.Join(t.TempDir(), "locks.json")
+	opt.LockTTL = fs.Duration(time.Minute)
+	_, vfs := newTestVFSOpt(t, &opt)
+	m1 := vfs.Locks()
+	require.NotNil(t, m1.f)
+
+	// Make a second lock manager as if it were another rclone
+	m2, err := newLockManager(t.Context(), vfs)
+	require.NoError(t, err)
+
+	lock1, err := m1.Lock("file", "me", true, false, 0)
+	require.NoError(t, err)
+	assert.False(t, lock1.Expires.IsZero())
+
+	// The other rclone sees the lock
+	_, err = m2.Lock("file", "you", true, false, 0)
+	assert.Equal(t, EAGAIN, err)
+	got, err := m2.Get(lock1.Token)
+	require.NoError(t, err)
+	assert.Equal(t, "me", got.Owner)
+
+	// Held locks are refreshed
+	m1.refreshHeld()
+	got, err = m2.Get(lock1.Token)
+	require.NoError(t, err)
+	assert.False(t, got.Expires.Before(lock1.Expires))
+
+	// Unlocking is seen by the other rclone
+	require.NoError(t, m1.Unlock(lock1.Token))
+	time.Sleep(lockCacheTime)
+	assert.NoError(t, m2.CheckWrite("file"))
+
+	// Held locks are released on shutdown
+	lock2, err := m2.Lock("file", "you", true, false, 0)
+	require.NoError(t, err)
+	assert.Equal(t, EAGAIN, m1.CheckWrite("file"))
+	m2.shutdown()
+	_, err = m1.Refresh(lock2.Token, time.Minute)
+	assert.Equal(t, ENOENT, err)
+}
+
+func TestLocksFileNoTTL(t *testing.T) {
+	opt := vfscommon.Opt
+	opt.LockFile = filepath.Join(t.TempDir(), "locks.json")
+	opt.LockTTL = 0
+	_, vfs := newTestVFSOpt(t, &opt)
+	m := vfs.Locks()
+	require.NotNil(t, m.f)
+
+	// Locks never expire so don't need refreshing
+	lock, err := m.Lock("file", "me", true, false, 0)
+	require.NoError(t, err)
+	assert.True(t, lock.Expires.IsZero())
+	assert.Nil(t, m.refresh)
+	time.Sleep(lockCacheTime)
+	assert.Equal(t, EAGAIN, m.CheckWrite("file"))
+	require.NoError(t, m.Unlock(lock.Token))
+	assert.NoError(t, m.CheckWrite("file"))
+}
+
+func TestLocksFileBad(t *testing.T) {
+	opt := vfscommon.Opt
+	opt.LockFile = t.TempDir() + "/"
+	_, vfs := newTestVFSOpt(t, &opt)
+
+	// Falls back to in memory locks
+	m := vfs.Locks()
+	require.NotNil(t, m)
+	assert.Nil(t, m.f)
+}
@@ -0,0 +1,170 @@
+package vfs
+
+// Quotas on the bytes and files stored in the VFS
+//
+// The usage is read from the remote when first needed and then in the
+// background every --dir-cache-time. In between it is updated as files
+// are written, truncated and removed through the VFS.
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/fs/walk"
+)
+
+// quota keeps track of the usage of the VFS and enforces the limits
+type quota struct {
+	vfs      *VFS
+	maxBytes int64 // -1 for no limit
+	maxFiles int64 // -1 for no limit
+
+	mu         sync.Mutex    // protects the below
+	scanned    time.Time     // when the usage was last read from the remote
+	scanning   chan struct{} // closed when the running scan finishes - nil if not scanning
+	scanErr    error         // error from the last scan
+	bytes      int64         // bytes in use
+	files      int64         // files in use
+	deltaBytes int64         // bytes used since the running scan started
+	deltaFiles int64         // files used since the running scan started
+}
+
+// newQuota makes a new quota for the VFS or returns nil if no limits
+// are set
+func newQuota(vfs *VFS) *quota {
+	if vfs.Opt.QuotaBytes < 0 && vfs.Opt.QuotaFiles < 0 {
+		return nil
+	}
+	return &quota{
+		vfs:      vfs,
+		maxBytes: int64(vfs.Opt.QuotaBytes),
+		maxFiles: vfs.Opt.QuotaFiles,
+	}
+}
+
+// _scan starts reading the usage from the remote if it is out of
+// date.
+//
+// The remote is read without the lock held. The old usage is used
+// until the scan finishes so this only waits for it if the usage
+// hasn't been read yet.
+//
+// call with the lock held
+func (q *quota) _scan() error {
+	if !q.scanned.IsZero() && time.Since(q.scanned) < time.Duration(q.vfs.Opt.DirCacheTime) {
+		return nil
+	}
+	if q.scanning == nil {
+		q.scanning = make(chan struct{})
+		q.deltaBytes, q.deltaFiles = 0, 0
+		go q.scan(q.scanning)
+	}
+	if !q.scanned.IsZero() {
+		return nil
+	}
+	scanning := q.scanning
+	q.mu.Unlock()
+	<-scanning
+	q.mu.Lock()
+	if q.scanned.IsZero() {
+		return q.scanErr
+	}
+	return nil
+}
+
+// scan reads the usage from the remote and closes done when finished.
+//
+// Changes made while the remote is being read are added on as the
+// listing may not have seen them.
+func (q *quota) scan(done chan struct{}) {
+	defer close(done)
+	var bytes, files int64
+	err := walk.ListR(context.TODO(), q.vfs.f, "", true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		entries.ForObject(func(o fs.Object) {
+			bytes += o.Size()
+			files++
+		})
+		return nil
+	})
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.scanning = nil
+	q.scanErr = err
+	if err != nil {
+		fs.Errorf(q.vfs.f, "Failed to read quota usage: %v", err)
+		return
+	}
+	q.bytes, q.files, q.scanned = bytes+q.deltaBytes, files+q.deltaFiles, time.Now()
+}
+
+// use checks that there is space for another deltaBytes and
+// deltaFiles and accounts for them if so.
+//
+// It returns ENOSPC if the usage would go over the quota. Negative
+// deltas always succeed and give back space used earlier.
+//
+// It is safe to call on a nil quota.
+func (q *quota) use(deltaBytes, deltaFiles int64) error {
+	if q == nil || (deltaBytes == 0 && deltaFiles == 0) {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q._scan(); err != nil {
+		return err
+	}
+	if deltaBytes > 0 && q.maxBytes >= 0 && q.bytes+deltaBytes > q.maxBytes {
+		return ENOSPC
+	}
+	if deltaFiles > 0 && q.maxFiles >= 0 && q.files+deltaFiles > q.maxFiles {
+		return ENOSPC
+	}
+	q.bytes += deltaBytes
+	q.files += deltaFiles
+	if q.scanning != nil {
+		q.deltaBytes += deltaBytes
+		q.deltaFiles += deltaFiles
+	}
+	return nil
+}
+
+// usage returns the bytes and files in use
+func (q *quota) usage() (bytes, files int64, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	err = q._scan()
+	return max(q.bytes, 0), max(q.files, 0), err
+}
+
+// statfs overrides the total, used and free from the backend with
+// the quota if a byte limit is set.
+//
+// Free is never more than the backend reports as free.
+func (q *quota) statfs(total, used, free int64) (int64, int64, int64) {
+	if q == nil || q.maxBytes < 0 {
+		return total, used, free
+	}
+	bytes, _, err := q.usage()
+	if err != nil {
+		return total, used, free
+	}
+	quotaFree := max(q.maxBytes-bytes, 0)
+	if free < 0 || quotaFree < free {
+		free = quotaFree
+	}
+	return q.maxBytes, bytes, free
+}
+
+// stats returns the usage and limits for the vfs/stats rc call
+func (q *quota) stats() rc.Params {
+	bytes, files, _ := q.usage()
+	return rc.Params{
+		"bytes":    bytes,
+		"files":    files,
+		"maxBytes": q.maxBytes,
+		"maxFiles": q.maxFiles,
+	}
+}
@@ -0,0 +1,136 @@
+package vfs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuotaNone(t *testing.T) {
+	_, vfs := newTestVFS(t)
+	assert.Nil(t, vfs.quota)
+	assert.NoError(t, vfs.quota.use(1<<60, 1<<60))
+	_, found := vfs.Stats()["quota"]
+	assert.False(t, found)
+}
+
+func testQuota(t *testing.T, cacheMode vfscommon.CacheMode) {
+	opt := vfscommon.Opt
+	opt.CacheMode = cacheMode
+	opt.QuotaBytes = 100
+	opt.QuotaFiles = 3
+	r, vfs := newTestVFSOpt(t, &opt)
+	require.NotNil(t, vfs.quota)
+
+	// Existing files count towards the quota
+	file1 := r.WriteObject(context.Background(), "file1", "0123456789", t1)
+	r.CheckRemoteItems(t, file1)
+
+	total, used, free := vfs.Statfs()
+	assert.Equal(t, int64(100), total)
+	assert.Equal(t, int64(10), used)
+	assert.Equal(t, int64(90), free)
+
+	// Write up to the quota
+	require.NoError(t, vfs.WriteFile("file2", make([]byte, 90), 0666))
+	_, _, free = vfs.Statfs()
+	assert.Equal(t, int64(0), free)
+
+	// Writing more fails
+	err := vfs.WriteFile("file3", []byte("x"), 0666)
+	assert.Equal(t, ENOSPC, err)
+
+	// Overwriting releases the old size
+	require.NoError(t, vfs.WriteFile("file2", make([]byte, 80), 0666))
+	_, used, _ = vfs.Statfs()
+	assert.Equal(t, int64(90), used)
+
+	// Hitting the file count limit
+	require.NoError(t, vfs.WriteFile("file3", []byte("x"), 0666))
+	_, err = vfs.OpenFile("file4", os.O_WRONLY|os.O_CREATE, 0666)
+	assert.Equal(t, ENOSPC, err)
+
+	// Removing files frees up space
+	require.NoError(t, vfs.Remove("file2"))
+	require.NoError(t, vfs.WriteFile("file4", make([]byte, 50), 0666))
+
+	stats := vfs.Stats()["quota"].(rc.Params)
+	assert.Equal(t, int64(61), stats["bytes"])
+	assert.Equal(t, int64(3), stats["files"])
+	assert.Equal(t, int64(100), stats["maxBytes"])
+	assert.Equal(t, int64(3), stats["maxFiles"])
+
+}
+
+func TestQuotaRescan(t *testing.T) {
+	opt := vfscommon.Opt
+	opt.QuotaBytes = 100
+	r, vfs := newTestVFSOpt(t, &opt)
+	require.NoError(t, r.Fremote.Mkdir(context.Background(), ""))
+	q := vfs.quota
+	require.NoError(t, vfs.WriteFile("file1", make([]byte, 10), 0666))
+
+	// Out of date usage is used while it is read again
+	r.WriteObject(context.Background(), "file2", "01234", t1)
+	q.mu.Lock()
+	q.scanned = time.Now().Add(-time.Hour)
+	q.mu.Unlock()
+	bytes, files, err := q.usage()
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), bytes)
+	assert.Equal(t, int64(1), files)
+	q.mu.Lock()
+	scanning := q.scanning
+	q.mu.Unlock()
+	require.NotNil(t, scanning)
+	<-scanning
+	bytes, files, err = q.usage()
+	require.NoError(t, err)
+	assert.Equal(t, int64(15), bytes)
+	assert.Equal(t, int64(2), files)
+}
+
+func TestQuotaWriteError(t *testing.T) {
+	opt := vfscommon.Opt
+	opt.QuotaBytes = 100
+	r, vfs := newTestVFSOpt(t, &opt)
+	require.NoError(t, r.Fremote.Mkdir(context.Background(), ""))
+
+	fd, err := vfs.OpenFile("file", os.O_WRONLY|os.O_CREATE, 0666)
+	require.NoError(t, err)
+	fh, ok := fd.(*WriteFileHandle)
+	require.True(t, ok)
+	_, err = fh.Write(make([]byte, 10))
+	require.NoError(t, err)
+
+	// A failed write gives back its space
+	fh.pipeWriter.CloseWithError(errors.New("potato"))
+	_, err = fh.Write(make([]byte, 50))
+	assert.Error(t, err)
+	bytes, files, err := vfs.quota.usage()
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), bytes)
+	assert.Equal(t, int64(1), files)
+
+	// As does the failed upload
+	assert.Error(t, fh.Close())
+	bytes, files, err = vfs.quota.usage()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), bytes)
+	assert.Equal(t, int64(0), files)
+}
+
+func TestQuota(t *testing.T) {
+	for _, cacheMode := range []vfscommon.CacheMode{vfscommon.CacheModeOff, vfscommon.CacheModeWrites} {
+		t.Run(cacheMode.String(), func(t *testing.T) {
+			testQuota(t, cacheMode)
+		})
+	}
+}
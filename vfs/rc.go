@@ -20,6 +20,9 @@ supplied and if there is only one VFS in use then that VFS will be
 used. If there is more than one VFS in use then the "fs" parameter
 must be supplied.`
 
+// The "fs" parameter described in getVFSHelp
+var vfsParam = rc.Param{Name: "fs", Type: rc.ParamString, Help: "the VFS to use, optional if only one is active"}
+
 // GetVFS gets a VFS with config name "fs" from the cache or returns an error.
 //
 // If "fs" is not set and there is one and only one VFS in the active
@@ -55,8 +58,16 @@ func getVFS(in rc.Params) (vfs *VFS, err error) {
 
 func init() {
 	rc.Add(rc.Call{
-		Path:  "vfs/refresh",
-		Fn:    rcRefresh,
+		Path: "vfs/refresh",
+		Fn:   rcRefresh,
+		Input: []rc.Param{
+			vfsParam,
+			{Name: "dir", Type: rc.ParamString, Help: "a directory to refresh, any parameter starting with dir may be used"},
+			{Name: "recursive", Type: rc.ParamString, Help: `set to "true" to refresh the whole directory tree`},
+		},
+		Output: []rc.Param{
+			{Name: "result", Type: rc.ParamObject, Help: "the status of each directory refreshed"},
+		},
 		Title: "Refresh the directory cache.",
 		Help: `
 This reads the directories for the specified paths and freshens the
@@ -170,8 +181,16 @@ func rcRefresh(ctx context.Context, in rc.Params) (out rc.Params, err error) {
 // Add remote control for the VFS
 func init() {
 	rc.Add(rc.Call{
-		Path:  "vfs/forget",
-		Fn:    rcForget,
+		Path: "vfs/forget",
+		Fn:   rcForget,
+		Input: []rc.Param{
+			vfsParam,
+			{Name: "file", Type: rc.ParamString, Help: "a file to forget, any parameter starting with file may be used"},
+			{Name: "dir", Type: rc.ParamString, Help: "a directory to forget, any parameter starting with dir may be used"},
+		},
+		Output: []rc.Param{
+			{Name: "forgotten", Type: rc.ParamArray, Help: "the paths forgotten"},
+		},
 		Title: "Forget files or directories in the directory cache.",
 		Help: `
 This forgets the paths in the directory cache causing them to be
@@ -288,8 +307,19 @@ func getStatus(vfs *VFS, in rc.Params) (out rc.Params, err error) {
 
 func init() {
 	rc.Add(rc.Call{
-		Path:  "vfs/poll-interval",
-		Fn:    rcPollInterval,
+		Path: "vfs/poll-interval",
+		Fn:   rcPollInterval,
+		Input: []rc.Param{
+			vfsParam,
+			{Name: "interval", Type: rc.ParamString, Help: "the new poll-interval duration, 0 to disable"},
+			{Name: "timeout", Type: rc.ParamString, Help: "how long to wait for the new value to apply"},
+		},
+		Output: []rc.Param{
+			{Name: "enabled", Type: rc.ParamBoolean, Help: "whether polling is enabled"},
+			{Name: "supported", Type: rc.ParamBoolean, Help: "whether the remote supports polling"},
+			{Name: "interval", Type: rc.ParamObject, Help: "the poll-interval as raw, seconds and string"},
+			{Name: "timeout", Type: rc.ParamBoolean, Help: "set if the timeout was reached"},
+		},
 		Title: "Get the status or update the value of the poll-interval option.",
 		Help: `
 Without any parameter given this returns the current status of the
@@ -370,6 +400,9 @@ It returns a list under the key "vfses" where the values are the VFS
 names that could be passed to the other VFS commands in the "fs"
 parameter.`,
 		Fn: rcList,
+		Output: []rc.Param{
+			{Name: "vfses", Type: rc.ParamArray, Help: "the names of the active VFSes"},
+		},
 	})
 }
 
@@ -399,6 +432,14 @@ func init() {
 This returns stats for the selected VFS.
 
     {
+        // Decisions made by adaptive reading - only present if --vfs-adaptive-read
+        "adaptiveRead": {
+            "random": 0,
+            "reopens": 0,
+            "retunes": 0,
+            "sequential": 0,
+            "strided": 0
+        },
         // Status of the disk cache - only present if --vfs-cache-mode > off
         "diskCache": {
             "bytesUsed": 0,
@@ -427,7 +468,8 @@ This returns stats for the selected VFS.
     }
 
 ` + getVFSHelp,
-		Fn: rcStats,
+		Fn:    rcStats,
+		Input: []rc.Param{vfsParam},
 	})
 }
 
@@ -472,7 +514,11 @@ may be files with negative expiry times for which |uploading| is
 |false|.
 
 `, "|", "`") + getVFSHelp,
-		Fn: rcQueue,
+		Fn:    rcQueue,
+		Input: []rc.Param{vfsParam},
+		Output: []rc.Param{
+			{Name: "queued", Type: rc.ParamArray, Help: "the files queued for upload"},
+		},
 	})
 }
 
@@ -520,6 +566,12 @@ This returns an empty result on success, or an error.
 
 `, "|", "`") + getVFSHelp,
 		Fn: rcQueueSetExpiry,
+		Input: []rc.Param{
+			vfsParam,
+			{Name: "id", Type: rc.ParamInteger, Required: true, Help: "the ID of the item as returned from vfs/queue"},
+			{Name: "expiry", Type: rc.ParamNumber, Required: true, Help: "a new expiry time as floating point seconds"},
+			{Name: "relative", Type: rc.ParamBoolean, Help: "if set, expiry is relative to the current expiry"},
+		},
 	})
 }
 
@@ -34,6 +34,8 @@ type ReadFileHandle struct {
 	noSeek      bool
 	sizeUnknown bool // set if size of source is not known
 	opened      bool
+	tracker     readTracker // access pattern for --vfs-adaptive-read
+	streams     int         // number of streams the reader was opened with
 }
 
 // Check interfaces
@@ -75,8 +77,7 @@ func (fh *ReadFileHandle) openPending() (err error) {
 		return nil
 	}
 	o := fh.file.getObject()
-	opt := &fh.file.VFS().Opt
-	r, err := chunkedreader.New(context.TODO(), o, int64(opt.ChunkSize), int64(opt.ChunkSizeLimit), opt.ChunkStreams).Open()
+	r, err := fh.newChunkedReader(o).Open()
 	if err != nil {
 		return err
 	}
@@ -88,6 +89,54 @@ func (fh *ReadFileHandle) openPending() (err error) {
 	return nil
 }
 
+// newChunkedReader makes a chunked reader for o using the parameters
+// for the current access pattern
+//
+// Must be called with fh.mu held
+func (fh *ReadFileHandle) newChunkedReader(o fs.Object) chunkedreader.ChunkedReader {
+	t := fh.tuning()
+	fh.streams = t.streams
+	return chunkedreader.New(context.TODO(), o, t.chunkSize, t.chunkSizeLimit, t.streams)
+}
+
+// tuning returns the reading parameters to use
+//
+// Must be called with fh.mu held
+func (fh *ReadFileHandle) tuning() readTuning {
+	opt := &fh.file.VFS().Opt
+	pattern := patternUnknown
+	if opt.AdaptiveRead {
+		pattern = fh.tracker.pattern
+	}
+	return tuneRead(opt, pattern, fh.tracker.lastSize)
+}
+
+// adapt records a read of size bytes at off and retunes the reader if
+// the access pattern has changed.
+//
+// It returns true if the reader needs reopening to change the number
+// of streams.
+//
+// Must be called with fh.mu held
+func (fh *ReadFileHandle) adapt(off, size int64) (reopen bool) {
+	vfs := fh.file.VFS()
+	if !vfs.Opt.AdaptiveRead || !fh.tracker.observe(off, size) {
+		return false
+	}
+	t := fh.tuning()
+	logTuning(fh.remote, fh.tracker.pattern, t)
+	vfs.readStats.changed(fh.tracker.pattern)
+	if cs, ok := fh.r.GetReader().(chunkedreader.ChunkSizer); ok {
+		cs.SetChunkSize(t.chunkSize, t.chunkSizeLimit)
+	}
+	oldParallel := readTuning{streams: fh.streams}.parallel()
+	if t.parallel() != oldParallel || (oldParallel && t.streams != fh.streams) {
+		vfs.readStats.reopens.Add(1)
+		return true
+	}
+	return false
+}
+
 // String converts it to printable
 func (fh *ReadFileHandle) String() string {
 	if fh == nil {
@@ -117,7 +166,9 @@ func (fh *ReadFileHandle) seek(offset int64, reopen bool) (err error) {
 	if fh.noSeek {
 		return ESPIPE
 	}
-	fh.hash = nil
+	if offset != fh.offset {
+		fh.hash = nil
+	}
 	if !reopen {
 		ar := fh.r.GetAsyncReader()
 		// try to fulfill the seek with buffer discard
@@ -149,8 +200,7 @@ func (fh *ReadFileHandle) seek(offset int64, reopen bool) (err error) {
 		}
 		// re-open with a seek
 		o := fh.file.getObject()
-		opt := &fh.file.VFS().Opt
-		r = chunkedreader.New(context.TODO(), o, int64(opt.ChunkSize), int64(opt.ChunkSizeLimit), opt.ChunkStreams)
+		r = fh.newChunkedReader(o)
 		_, err := r.Seek(offset, 0)
 		if err != nil {
 			fs.Debugf(fh.remote, "ReadFileHandle.Read seek failed: %v", err)
@@ -277,6 +327,10 @@ func (fh *ReadFileHandle) readAt(p []byte, off int64) (n int, err error) {
 	retries := 0
 	reqSize := len(p)
 	doReopen := false
+	if fh.adapt(off, int64(reqSize)) && !fh.noSeek {
+		doSeek = true
+		doReopen = true
+	}
 	lowLevelRetries := fs.GetConfig(context.TODO()).LowLevelRetries
 	for {
 		if doSeek {
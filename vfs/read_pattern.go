@@ -0,0 +1,192 @@
+package vfs
+
+// Adaptive reading
+//
+// When --vfs-adaptive-read is set each open file handle keeps track
+// of the offsets it is read at and classifies the access pattern as
+// sequential, strided or random. The chunk size, chunk growth, number
+// of parallel streams and cache read ahead used for the file are then
+// chosen to suit the pattern.
+
+import (
+	"sync/atomic"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/vfs/vfscommon"
+)
+
+const (
+	// number of consecutive reads with the same pattern needed to
+	// change the pattern decided on
+	patternThreshold = 3
+	// smallest chunk size used for strided and random reads
+	minAdaptiveChunkSize = 64 * 1024
+	// number of streams used for sequential reads if
+	// --vfs-read-chunk-streams isn't set
+	adaptiveStreams = 4
+	// largest chunk size used for the streams if
+	// --vfs-read-chunk-streams isn't set
+	adaptiveStreamChunkSize = 8 * 1024 * 1024
+	// smallest cache read ahead used for sequential reads
+	adaptiveReadAhead = 16 * 1024 * 1024
+)
+
+// readPattern describes the access pattern seen on a file handle
+type readPattern byte
+
+// Access patterns
+const (
+	patternUnknown    readPattern = iota // not enough reads to decide
+	patternSequential                    // each read starts where the last ended
+	patternStrided                       // reads skip the same distance each time
+	patternRandom                        // anything else
+)
+
+var readPatternNames = []string{
+	patternUnknown:    "unknown",
+	patternSequential: "sequential",
+	patternStrided:    "strided",
+	patternRandom:     "random",
+}
+
+// String turns a readPattern into a string
+func (p readPattern) String() string {
+	if int(p) >= len(readPatternNames) {
+		return "unknown"
+	}
+	return readPatternNames[p]
+}
+
+// readTracker classifies the access pattern of the reads on a file
+// handle.
+//
+// It is not safe for concurrent use - the handle's lock protects it.
+type readTracker struct {
+	started   bool        // set once the first read has been seen
+	lastEnd   int64       // offset just past the end of the last read
+	lastGap   int64       // gap between the last two reads
+	lastSize  int64       // size of the last read
+	candidate readPattern // pattern of the most recent reads
+	count     int         // number of consecutive reads matching candidate
+	pattern   readPattern // pattern decided on
+}
+
+// observe records a read of size bytes at off.
+//
+// It returns true if the pattern decided on has changed.
+func (t *readTracker) observe(off, size int64) (changed bool) {
+	var seen readPattern
+	gap := off - t.lastEnd
+	switch {
+	case !t.started && off == 0:
+		seen = patternSequential
+	case !t.started:
+		seen = patternRandom
+	case gap == 0:
+		seen = patternSequential
+	case gap == t.lastGap && size == t.lastSize:
+		seen = patternStrided
+	default:
+		seen = patternRandom
+	}
+	t.started = true
+	t.lastEnd = off + size
+	t.lastGap = gap
+	t.lastSize = size
+	if seen == t.candidate {
+		t.count++
+	} else {
+		t.candidate = seen
+		t.count = 1
+	}
+	if t.count >= patternThreshold && t.pattern != seen {
+		t.pattern = seen
+		return true
+	}
+	return false
+}
+
+// readTuning is the reading parameters chosen for an access pattern
+type readTuning struct {
+	chunkSize      int64 // initial chunk size, <= 0 for no chunking
+	chunkSizeLimit int64 // max chunk size, -1 for unlimited
+	streams        int   // number of parallel streams
+	readAhead      int64 // cache read ahead, -1 for --vfs-read-ahead
+}
+
+// tuneRead returns the reading parameters for pattern where the reads
+// are readSize long.
+//
+// patternUnknown returns the parameters from the options.
+func tuneRead(opt *vfscommon.Options, pattern readPattern, readSize int64) readTuning {
+	t := readTuning{
+		chunkSize:      int64(opt.ChunkSize),
+		chunkSizeLimit: int64(opt.ChunkSizeLimit),
+		streams:        opt.ChunkStreams,
+		readAhead:      -1,
+	}
+	switch pattern {
+	case patternSequential:
+		// Read in parallel and let the chunks grow without limit
+		t.chunkSizeLimit = -1
+		if t.streams <= 1 {
+			t.streams = adaptiveStreams
+			if t.chunkSize <= 0 || t.chunkSize > adaptiveStreamChunkSize {
+				t.chunkSize = adaptiveStreamChunkSize
+			}
+		}
+		t.readAhead = max(int64(opt.ReadAhead), adaptiveReadAhead)
+	case patternStrided, patternRandom:
+		// Only fetch what is going to be read
+		t.chunkSize = max(readSize, minAdaptiveChunkSize)
+		t.chunkSizeLimit = t.chunkSize
+		t.streams = 0
+		t.readAhead = 0
+	}
+	return t
+}
+
+// parallel returns true if the streams setting means parallel reads
+func (t readTuning) parallel() bool {
+	return t.streams > 1
+}
+
+// readStats counts the decisions made by adaptive reading
+type readStats struct {
+	sequential atomic.Int64 // number of times handles were detected as sequential
+	strided    atomic.Int64 // number of times handles were detected as strided
+	random     atomic.Int64 // number of times handles were detected as random
+	retunes    atomic.Int64 // number of times the reading parameters were changed
+	reopens    atomic.Int64 // number of times a reader was reopened to change the streams
+}
+
+// changed records that a handle's pattern changed to pattern
+func (s *readStats) changed(pattern readPattern) {
+	switch pattern {
+	case patternSequential:
+		s.sequential.Add(1)
+	case patternStrided:
+		s.strided.Add(1)
+	case patternRandom:
+		s.random.Add(1)
+	}
+	s.retunes.Add(1)
+}
+
+// stats returns the counters for vfs/stats
+func (s *readStats) stats() rc.Params {
+	return rc.Params{
+		"sequential": s.sequential.Load(),
+		"strided":    s.strided.Load(),
+		"random":     s.random.Load(),
+		"retunes":    s.retunes.Load(),
+		"reopens":    s.reopens.Load(),
+	}
+}
+
+// logTuning logs the parameters chosen for a new pattern
+func logTuning(remote string, pattern readPattern, t readTuning) {
+	fs.Debugf(remote, "vfs adaptive read: access pattern now %v: chunk size %d, chunk size limit %d, streams %d, read ahead %d",
+		pattern, t.chunkSize, t.chunkSizeLimit, t.streams, t.readAhead)
+}
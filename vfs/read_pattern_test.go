@@ -0,0 +1,168 @@
+package vfs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadPatternString(t *testing.T) {
+	assert.Equal(t, "unknown", patternUnknown.String())
+	assert.Equal(t, "sequential", patternSequential.String())
+	assert.Equal(t, "strided", patternStrided.String())
+	assert.Equal(t, "random", patternRandom.String())
+	assert.Equal(t, "unknown", readPattern(99).String())
+}
+
+func TestReadTrackerObserve(t *testing.T) {
+	type read struct {
+		off, size int64
+	}
+	for _, test := range []struct {
+		name  string
+		reads []read
+		want  readPattern
+	}{{
+		name:  "Empty",
+		reads: nil,
+		want:  patternUnknown,
+	}, {
+		name:  "TooFew",
+		reads: []read{{0, 10}, {10, 10}},
+		want:  patternUnknown,
+	}, {
+		name:  "Sequential",
+		reads: []read{{0, 10}, {10, 10}, {20, 10}},
+		want:  patternSequential,
+	}, {
+		name:  "Strided",
+		reads: []read{{0, 10}, {100, 10}, {200, 10}, {300, 10}, {400, 10}},
+		want:  patternStrided,
+	}, {
+		name:  "Backwards",
+		reads: []read{{1000, 10}, {900, 10}, {800, 10}, {700, 10}, {600, 10}},
+		want:  patternStrided,
+	}, {
+		name:  "Random",
+		reads: []read{{500, 10}, {20, 10}, {3000, 10}},
+		want:  patternRandom,
+	}, {
+		name:  "RandomThenSequential",
+		reads: []read{{500, 10}, {20, 10}, {3000, 10}, {3010, 10}, {3020, 10}, {3030, 10}},
+		want:  patternSequential,
+	}} {
+		t.Run(test.name, func(t *testing.T) {
+			var tr readTracker
+			for _, r := range test.reads {
+				tr.observe(r.off, r.size)
+			}
+			assert.Equal(t, test.want, tr.pattern)
+		})
+	}
+}
+
+func TestReadTrackerChanged(t *testing.T) {
+	var tr readTracker
+	assert.False(t, tr.observe(0, 10))
+	assert.False(t, tr.observe(10, 10))
+	assert.True(t, tr.observe(20, 10))
+	assert.False(t, tr.observe(30, 10))
+}
+
+func TestTuneRead(t *testing.T) {
+	opt := vfscommon.Opt
+	opt.ChunkSize = 128 * fs.Mebi
+	opt.ChunkSizeLimit = 512 * fs.Mebi
+	opt.ChunkStreams = 0
+	opt.ReadAhead = 0
+
+	got := tuneRead(&opt, patternUnknown, 4096)
+	assert.Equal(t, readTuning{
+		chunkSize:      int64(128 * fs.Mebi),
+		chunkSizeLimit: int64(512 * fs.Mebi),
+		streams:        0,
+		readAhead:      -1,
+	}, got)
+
+	got = tuneRead(&opt, patternSequential, 4096)
+	assert.Equal(t, readTuning{
+		chunkSize:      adaptiveStreamChunkSize,
+		chunkSizeLimit: -1,
+		streams:        adaptiveStreams,
+		readAhead:      adaptiveReadAhead,
+	}, got)
+	assert.True(t, got.parallel())
+
+	opt.ChunkStreams = 16
+	opt.ChunkSize = 4 * fs.Mebi
+	got = tuneRead(&opt, patternSequential, 4096)
+	assert.Equal(t, 16, got.streams)
+	assert.Equal(t, int64(4*fs.Mebi), got.chunkSize)
+
+	got = tuneRead(&opt, patternRandom, 4096)
+	assert.Equal(t, readTuning{
+		chunkSize:      minAdaptiveChunkSize,
+		chunkSizeLimit: minAdaptiveChunkSize,
+		streams:        0,
+		readAhead:      0,
+	}, got)
+	assert.False(t, got.parallel())
+
+	got = tuneRead(&opt, patternStrided, 1024*1024)
+	assert.Equal(t, int64(1024*1024), got.chunkSize)
+	assert.Equal(t, int64(1024*1024), got.chunkSizeLimit)
+}
+
+func TestReadFileHandleAdaptive(t *testing.T) {
+	opt := vfscommon.Opt
+	opt.AdaptiveRead = true
+	r, vfs := newTestVFSOpt(t, &opt)
+
+	contents := strings.Repeat("0123456789abcdef", 1024)
+	file1 := r.WriteObject(context.Background(), "file1", contents, t1)
+	r.CheckRemoteItems(t, file1)
+
+	h, err := vfs.OpenFile("file1", os.O_RDONLY, 0777)
+	require.NoError(t, err)
+	fh, ok := h.(*ReadFileHandle)
+	require.True(t, ok)
+
+	// Read randomly
+	buf := make([]byte, 16)
+	for _, off := range []int64{4096, 64, 8192, 1024} {
+		n, err := fh.ReadAt(buf, off)
+		require.NoError(t, err)
+		assert.Equal(t, contents[off:off+16], string(buf[:n]), fmt.Sprint(off))
+	}
+	assert.Equal(t, patternRandom, fh.tracker.pattern)
+
+	// Then sequentially which reopens the reader with streams
+	for off := int64(2048); off < 2048+4*16; off += 16 {
+		n, err := fh.ReadAt(buf, off)
+		require.NoError(t, err)
+		assert.Equal(t, contents[off:off+16], string(buf[:n]), fmt.Sprint(off))
+	}
+	assert.Equal(t, patternSequential, fh.tracker.pattern)
+	assert.Equal(t, adaptiveStreams, fh.streams)
+
+	// Read the rest
+	rest, err := io.ReadAll(io.NewSectionReader(fh, 2048+4*16, int64(len(contents))))
+	require.NoError(t, err)
+	assert.Equal(t, contents[2048+4*16:], string(rest))
+	require.NoError(t, fh.Close())
+
+	stats := vfs.Stats()["adaptiveRead"].(rc.Params)
+	assert.Equal(t, int64(1), stats["random"])
+	assert.Equal(t, int64(1), stats["sequential"])
+	assert.Equal(t, int64(2), stats["retunes"])
+	assert.Equal(t, int64(1), stats["reopens"])
+}
@@ -27,7 +27,8 @@ type RWFileHandle struct {
 	offset      int64 // file pointer offset
 	closed      bool  // set if handle has been closed
 	opened      bool
-	writeCalled bool // if any Write() methods have been called
+	writeCalled bool        // if any Write() methods have been called
+	tracker     readTracker // access pattern for --vfs-adaptive-read
 }
 
 // Lock performs Unix locking, not supported
@@ -165,6 +166,10 @@ func (fh *RWFileHandle) close() (err error) {
 	fh.closed = true
 	fh.updateSize()
 	if fh.opened {
+		if fh.tracker.pattern != patternUnknown {
+			// put the read ahead back to the default
+			fh.item.SetReadAhead(-1)
+		}
 		err = fh.item.Close(fh.file.setObject)
 		fh.opened = false
 	} else {
@@ -268,6 +273,7 @@ func (fh *RWFileHandle) _readAt(b []byte, off int64, release bool) (n int, err e
 	if err = fh.openPending(); err != nil {
 		return n, err
 	}
+	fh.adapt(off, int64(len(b)))
 	if release {
 		// Do the writing with fh.mu unlocked
 		fh.mu.Unlock()
@@ -281,6 +287,21 @@ func (fh *RWFileHandle) _readAt(b []byte, off int64, release bool) (n int, err e
 	return n, err
 }
 
+// adapt records a read of size bytes at off and sets the cache read
+// ahead if the access pattern has changed.
+//
+// call with lock held
+func (fh *RWFileHandle) adapt(off, size int64) {
+	vfs := fh.d.vfs
+	if !vfs.Opt.AdaptiveRead || !fh.tracker.observe(off, size) {
+		return
+	}
+	t := tuneRead(&vfs.Opt, fh.tracker.pattern, size)
+	logTuning(fh.logPrefix(), fh.tracker.pattern, t)
+	vfs.readStats.changed(fh.tracker.pattern)
+	fh.item.SetReadAhead(t.readAhead)
+}
+
 // ReadAt bytes from the file at off
 func (fh *RWFileHandle) ReadAt(b []byte, off int64) (n int, err error) {
 	fh.mu.Lock()
@@ -344,6 +365,12 @@ func (fh *RWFileHandle) _writeAt(b []byte, off int64, release bool) (n int, err
 		fh.offset = size
 		off = fh.offset
 	}
+	q := fh.file.VFS().quota
+	oldSize := fh._size()
+	growth := max(off+int64(len(b))-oldSize, 0)
+	if err = q.use(growth, 0); err != nil {
+		return n, err
+	}
 	fh.writeCalled = true
 	if release {
 		// Do the writing with fh.mu unlocked
@@ -354,6 +381,8 @@ func (fh *RWFileHandle) _writeAt(b []byte, off int64, release bool) (n int, err
 		fh.mu.Lock()
 	}
 	if err != nil {
+		// give back the growth which wasn't written
+		_ = q.use(max(off+int64(n)-oldSize, 0)-growth, 0)
 		return n, err
 	}
 
@@ -390,9 +419,13 @@ func (fh *RWFileHandle) WriteString(s string) (n int, err error) {
 //
 // Call with mutex held
 func (fh *RWFileHandle) _truncate(size int64) (err error) {
-	if size == fh._size() {
+	oldSize := fh._size()
+	if size == oldSize {
 		return nil
 	}
+	if err = fh.file.VFS().quota.use(size-oldSize, 0); err != nil {
+		return err
+	}
 	fh.file.setSize(size)
 	return fh.item.Truncate(size)
 }
@@ -0,0 +1,410 @@
+package vfs
+
+// Snapshots
+//
+// When --vfs-snapshots is set the root of the VFS has a read only
+// virtual directory called .snapshots. Each directory in it shows the
+// remote as it was at a given time, either by re-opening the remote
+// with version_at set on backends which support it (eg s3 and b2) or
+// by showing the subdirectories of --vfs-snapshot-dir which is
+// expected to be made with --backup-dir.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/fspath"
+)
+
+const (
+	// name of the snapshots directory in the root
+	snapshotsDirName = ".snapshots"
+	// format of the names of the snapshots
+	snapshotFormat = "2006-01-02-150405"
+	// number of hourly snapshots to list for version based snapshots
+	snapshotHours = 24
+	// number of daily snapshots to list for version based snapshots
+	snapshotDays = 30
+)
+
+// errSnapshotReadOnly is returned when trying to modify a snapshot
+var errSnapshotReadOnly = errors.New("snapshots are read only")
+
+// snapshotsFs is a read only fs.Fs with the snapshots in.
+//
+// The remotes in it are of the form ".snapshots/<name>/path/to/file"
+// where <name> is the snapshot.
+type snapshotsFs struct {
+	fs.Fs                      // the remote the VFS is showing
+	features  *fs.Features     // optional features
+	backupDir fs.Fs            // if set the snapshots are the directories in here
+	mu        sync.Mutex       // protects the following
+	snapshots map[string]fs.Fs // snapshots opened so far by name
+}
+
+// newSnapshotsFs makes the snapshots for f according to opt
+func newSnapshotsFs(ctx context.Context, f fs.Fs, snapshotDir string) (sf *snapshotsFs, err error) {
+	sf = &snapshotsFs{
+		Fs:        f,
+		snapshots: make(map[string]fs.Fs),
+	}
+	if snapshotDir != "" {
+		sf.backupDir, err = cache.Get(ctx, snapshotDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open --vfs-snapshot-dir: %w", err)
+		}
+	} else if !hasVersionAt(f) {
+		return nil, fmt.Errorf("%s backend doesn't support version_at so can't be used for snapshots without --vfs-snapshot-dir", fs.Type(f))
+	}
+	sf.features = (&fs.Features{
+		CanHaveEmptyDirectories: true,
+		ReadMimeType:            f.Features().ReadMimeType,
+		ReadMetadata:            f.Features().ReadMetadata,
+		ReadDirMetadata:         f.Features().ReadDirMetadata,
+	}).Fill(ctx, sf)
+	return sf, nil
+}
+
+// hasVersionAt returns true if the backend of f has a version_at option
+func hasVersionAt(f fs.Fs) bool {
+	ri := fs.FindFromFs(f)
+	return ri != nil && ri.Options.Get("version_at") != nil
+}
+
+// withVersionAt returns the config string fsString with version_at set to t
+func withVersionAt(fsString string, t time.Time) (string, error) {
+	parsed, err := fspath.Parse(fsString)
+	if err != nil {
+		return "", err
+	}
+	if parsed.ConfigString == "" {
+		return "", fmt.Errorf("can't set version_at on local path %q", fsString)
+	}
+	versionAt := fmt.Sprintf("version_at=%q", fs.Time(t).String())
+	return parsed.ConfigString + "," + versionAt + ":" + parsed.Path, nil
+}
+
+// parseSnapshotName parses the name of a version based snapshot
+func parseSnapshotName(name string) (t time.Time, err error) {
+	t, err = time.ParseInLocation(snapshotFormat, name, time.UTC)
+	if err != nil {
+		return t, fmt.Errorf("invalid snapshot name %q - must be in the format %q", name, snapshotFormat)
+	}
+	return t, nil
+}
+
+// versionSnapshotTimes returns the times of the snapshots listed for
+// version based snapshots: hourly for the last day and daily before
+// that.
+func versionSnapshotTimes(now time.Time) (times []time.Time) {
+	hour := now.UTC().Truncate(time.Hour)
+	for i := range snapshotHours {
+		times = append(times, hour.Add(-time.Duration(i)*time.Hour))
+	}
+	day := time.Date(hour.Year(), hour.Month(), hour.Day(), 0, 0, 0, 0, time.UTC)
+	for i := range snapshotDays {
+		t := day.AddDate(0, 0, -i)
+		if t.Before(times[len(times)-1]) {
+			times = append(times, t)
+		}
+	}
+	return times
+}
+
+// String returns a description of the Fs
+func (sf *snapshotsFs) String() string {
+	return fmt.Sprintf("snapshots of %s", sf.Fs.String())
+}
+
+// Features returns the optional features of this Fs
+func (sf *snapshotsFs) Features() *fs.Features {
+	return sf.features
+}
+
+// split remote into the snapshot name and the path within it
+func splitSnapshot(remote string) (name, rel string, ok bool) {
+	rest, ok := strings.CutPrefix(remote, snapshotsDirName+"/")
+	if !ok {
+		return "", "", false
+	}
+	name, rel, _ = strings.Cut(rest, "/")
+	return name, rel, name != ""
+}
+
+// snapshot returns the Fs for the snapshot called name, opening it
+// if necessary.
+func (sf *snapshotsFs) snapshot(ctx context.Context, name string) (f fs.Fs, err error) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	if f, ok := sf.snapshots[name]; ok {
+		return f, nil
+	}
+	var fsString string
+	if sf.backupDir != nil {
+		fsString = fspath.JoinRootPath(fs.ConfigStringFull(sf.backupDir), name)
+	} else {
+		t, err := parseSnapshotName(name)
+		if err != nil {
+			return nil, fs.ErrorDirNotFound
+		}
+		fsString, err = withVersionAt(fs.ConfigStringFull(sf.Fs), t)
+		if err != nil {
+			return nil, err
+		}
+	}
+	fs.Debugf(sf, "Opening snapshot %q as %q", name, fsString)
+	f, err = cache.Get(ctx, fsString)
+	if err == fs.ErrorIsFile {
+		return nil, fs.ErrorDirNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open snapshot %q: %w", name, err)
+	}
+	sf.snapshots[name] = f
+	return f, nil
+}
+
+// addSnapshot makes sure the snapshot called name will be listed if it
+// is valid. This is used to reach version based snapshots which aren't
+// in the default listing.
+//
+// It returns true if the snapshot was added.
+func (sf *snapshotsFs) addSnapshot(ctx context.Context, name string) bool {
+	if sf.backupDir != nil {
+		return false
+	}
+	if _, err := parseSnapshotName(name); err != nil {
+		return false
+	}
+	_, err := sf.snapshot(ctx, name)
+	if err != nil {
+		fs.Errorf(sf, "Failed to add snapshot: %v", err)
+		return false
+	}
+	return true
+}
+
+// listSnapshots lists the snapshots as directories
+func (sf *snapshotsFs) listSnapshots(ctx context.Context) (entries fs.DirEntries, err error) {
+	if sf.backupDir != nil {
+		dirs, err := sf.backupDir.List(ctx, "")
+		if err == fs.ErrorDirNotFound {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		for _, entry := range dirs {
+			if dir, ok := entry.(fs.Directory); ok {
+				remote := path.Join(snapshotsDirName, dir.Remote())
+				entries = append(entries, fs.NewDirCopy(ctx, dir).SetRemote(remote))
+			}
+		}
+		return entries, nil
+	}
+	names := make(map[string]time.Time)
+	for _, t := range versionSnapshotTimes(time.Now()) {
+		names[t.Format(snapshotFormat)] = t
+	}
+	sf.mu.Lock()
+	for name := range sf.snapshots {
+		if t, err := parseSnapshotName(name); err == nil {
+			names[name] = t
+		}
+	}
+	sf.mu.Unlock()
+	for name, t := range names {
+		entries = append(entries, fs.NewDir(path.Join(snapshotsDirName, name), t))
+	}
+	sort.Sort(entries)
+	return entries, nil
+}
+
+// List the objects and directories in dir into entries.
+func (sf *snapshotsFs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	if dir == snapshotsDirName {
+		return sf.listSnapshots(ctx)
+	}
+	name, rel, ok := splitSnapshot(dir)
+	if !ok {
+		return nil, fs.ErrorDirNotFound
+	}
+	f, err := sf.snapshot(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	fEntries, err := f.List(ctx, rel)
+	if err != nil {
+		return nil, err
+	}
+	prefix := path.Join(snapshotsDirName, name)
+	for _, entry := range fEntries {
+		remote := path.Join(prefix, entry.Remote())
+		switch x := entry.(type) {
+		case fs.Object:
+			entries = append(entries, &snapshotObject{Object: x, f: sf, remote: remote})
+		case fs.Directory:
+			entries = append(entries, fs.NewDirCopy(ctx, x).SetRemote(remote))
+		}
+	}
+	return entries, nil
+}
+
+// NewObject finds the Object at remote.
+func (sf *snapshotsFs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	name, rel, ok := splitSnapshot(remote)
+	if !ok || rel == "" {
+		return nil, fs.ErrorObjectNotFound
+	}
+	f, err := sf.snapshot(ctx, name)
+	if err == fs.ErrorDirNotFound {
+		return nil, fs.ErrorObjectNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	o, err := f.NewObject(ctx, rel)
+	if err != nil {
+		return nil, err
+	}
+	return &snapshotObject{Object: o, f: sf, remote: remote}, nil
+}
+
+// Put is not supported as snapshots are read only
+func (sf *snapshotsFs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return nil, errSnapshotReadOnly
+}
+
+// Mkdir is not supported as snapshots are read only
+func (sf *snapshotsFs) Mkdir(ctx context.Context, dir string) error {
+	return errSnapshotReadOnly
+}
+
+// Rmdir is not supported as snapshots are read only
+func (sf *snapshotsFs) Rmdir(ctx context.Context, dir string) error {
+	return errSnapshotReadOnly
+}
+
+// snapshotObject is an object in a snapshot
+type snapshotObject struct {
+	fs.Object              // object in the snapshot
+	f         *snapshotsFs // parent
+	remote    string       // remote including the snapshot prefix
+}
+
+// Fs returns the parent Fs
+func (o *snapshotObject) Fs() fs.Info {
+	return o.f
+}
+
+// Remote returns the remote path
+func (o *snapshotObject) Remote() string {
+	return o.remote
+}
+
+// String returns a description of the Object
+func (o *snapshotObject) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.remote
+}
+
+// SetModTime is not supported as snapshots are read only
+func (o *snapshotObject) SetModTime(ctx context.Context, t time.Time) error {
+	return errSnapshotReadOnly
+}
+
+// Update is not supported as snapshots are read only
+func (o *snapshotObject) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	return errSnapshotReadOnly
+}
+
+// Remove is not supported as snapshots are read only
+func (o *snapshotObject) Remove(ctx context.Context) error {
+	return errSnapshotReadOnly
+}
+
+// UnWrap returns the object in the snapshot
+func (o *snapshotObject) UnWrap() fs.Object {
+	return o.Object
+}
+
+// Metadata returns metadata for the object if the backend supports it
+func (o *snapshotObject) Metadata(ctx context.Context) (fs.Metadata, error) {
+	do, ok := o.Object.(fs.Metadataer)
+	if !ok {
+		return nil, nil
+	}
+	return do.Metadata(ctx)
+}
+
+// MimeType returns the content type of the object if known
+func (o *snapshotObject) MimeType(ctx context.Context) string {
+	if do, ok := o.Object.(fs.MimeTyper); ok {
+		return do.MimeType(ctx)
+	}
+	return ""
+}
+
+// isSnapshotsRoot returns true if d is the .snapshots directory
+func (d *Dir) isSnapshotsRoot() bool {
+	_, ok := d.f.(*snapshotsFs)
+	return ok && d.path == snapshotsDirName
+}
+
+// readOnly returns true if the directory can't be modified
+func (d *Dir) readOnly() bool {
+	if d.vfs.Opt.ReadOnly {
+		return true
+	}
+	_, isSnapshot := d.f.(*snapshotsFs)
+	return isSnapshot
+}
+
+// statSnapshot looks for a snapshot called leaf which isn't in the
+// listing of the .snapshots directory.
+//
+// It returns nil if not found.
+func (d *Dir) statSnapshot(leaf string) Node {
+	sf := d.f.(*snapshotsFs)
+	if !sf.addSnapshot(context.TODO(), leaf) {
+		return nil
+	}
+	if err := d.readDir(); err != nil {
+		fs.Errorf(d, "Failed to re-read snapshots: %v", err)
+		return nil
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.items[leaf]
+}
+
+// _addSnapshotsDir adds the .snapshots directory to the root
+//
+// must be called with the Dir lock held
+func (d *Dir) _addSnapshotsDir() {
+	vfs := d.vfs
+	if _, found := d.items[snapshotsDirName]; found && vfs.snapshotsDir == nil {
+		fs.Logf(d.f, "%q is hidden by --vfs-snapshots", snapshotsDirName)
+	}
+	if vfs.snapshotsDir == nil {
+		vfs.snapshotsDir = newDir(vfs, vfs.snapshots, d, fs.NewDir(snapshotsDirName, time.Now()))
+	}
+	d.items[snapshotsDirName] = vfs.snapshotsDir
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs              = (*snapshotsFs)(nil)
+	_ fs.Object          = (*snapshotObject)(nil)
+	_ fs.ObjectUnWrapper = (*snapshotObject)(nil)
+	_ fs.Metadataer      = (*snapshotObject)(nil)
+	_ fs.MimeTyper       = (*snapshotObject)(nil)
+)
@@ -0,0 +1,153 @@
+package vfs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotsParseName(t *testing.T) {
+	got, err := parseSnapshotName("2024-01-02-030405")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), got)
+
+	_, err = parseSnapshotName("potato")
+	assert.Error(t, err)
+}
+
+func TestSnapshotsWithVersionAt(t *testing.T) {
+	when := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	got, err := withVersionAt("s3:bucket/path", when)
+	require.NoError(t, err)
+	assert.Equal(t, `s3,version_at="2024-01-02T03:04:05Z":bucket/path`, got)
+
+	got, err = withVersionAt("s3,versions=true:bucket", when)
+	require.NoError(t, err)
+	assert.Equal(t, `s3,versions=true,version_at="2024-01-02T03:04:05Z":bucket`, got)
+
+	_, err = withVersionAt("/local/path", when)
+	assert.Error(t, err)
+}
+
+func TestSnapshotsVersionTimes(t *testing.T) {
+	now := time.Date(2024, 1, 31, 12, 34, 56, 0, time.UTC)
+	times := versionSnapshotTimes(now)
+	assert.Equal(t, time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC), times[0])
+	assert.Equal(t, time.Date(2024, 1, 30, 13, 0, 0, 0, time.UTC), times[snapshotHours-1])
+	assert.Equal(t, time.Date(2024, 1, 30, 0, 0, 0, 0, time.UTC), times[snapshotHours])
+	assert.Equal(t, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), times[len(times)-1])
+	for i := 1; i < len(times); i++ {
+		assert.True(t, times[i].Before(times[i-1]))
+	}
+}
+
+func TestSnapshotsSplit(t *testing.T) {
+	for _, test := range []struct {
+		in       string
+		wantName string
+		wantRel  string
+		wantOK   bool
+	}{
+		{".snapshots", "", "", false},
+		{".snapshots/", "", "", false},
+		{".snapshots/snap", "snap", "", true},
+		{".snapshots/snap/dir/file", "snap", "dir/file", true},
+		{"dir/file", "", "", false},
+	} {
+		name, rel, ok := splitSnapshot(test.in)
+		assert.Equal(t, test.wantName, name, test.in)
+		assert.Equal(t, test.wantRel, rel, test.in)
+		assert.Equal(t, test.wantOK, ok, test.in)
+	}
+}
+
+func TestSnapshotsNotSupported(t *testing.T) {
+	opt := vfscommon.Opt
+	opt.Snapshots = true
+	_, vfs := newTestVFSOpt(t, &opt)
+
+	assert.Nil(t, vfs.snapshots)
+	_, err := vfs.Stat(snapshotsDirName)
+	assert.Equal(t, ENOENT, err)
+}
+
+func TestSnapshotsBackupDir(t *testing.T) {
+	ctx := context.Background()
+	snapshotDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(snapshotDir, "2024-01-01", "dir"), 0777))
+	require.NoError(t, os.WriteFile(filepath.Join(snapshotDir, "2024-01-01", "dir", "file1"), []byte("old contents"), 0666))
+	require.NoError(t, os.MkdirAll(filepath.Join(snapshotDir, "2024-02-01"), 0777))
+
+	opt := vfscommon.Opt
+	opt.Snapshots = true
+	opt.SnapshotDir = snapshotDir
+	r, vfs := newTestVFSOpt(t, &opt)
+	require.NotNil(t, vfs.snapshots)
+
+	file1 := r.WriteObject(ctx, "dir/file1", "new contents", t1)
+	r.CheckRemoteItems(t, file1)
+
+	// The snapshots directory is in the root
+	fis, err := vfs.ReadDir("")
+	require.NoError(t, err)
+	var names []string
+	for _, fi := range fis {
+		names = append(names, fi.Name())
+	}
+	assert.Equal(t, []string{snapshotsDirName, "dir"}, names)
+
+	// It lists the snapshots
+	fis, err = vfs.ReadDir(snapshotsDirName)
+	require.NoError(t, err)
+	names = nil
+	for _, fi := range fis {
+		names = append(names, fi.Name())
+		assert.True(t, fi.IsDir())
+	}
+	assert.Equal(t, []string{"2024-01-01", "2024-02-01"}, names)
+
+	// Files can be read from the snapshot
+	b, err := vfs.ReadFile(".snapshots/2024-01-01/dir/file1")
+	require.NoError(t, err)
+	assert.Equal(t, "old contents", string(b))
+
+	// And the current version is unchanged
+	b, err = vfs.ReadFile("dir/file1")
+	require.NoError(t, err)
+	assert.Equal(t, "new contents", string(b))
+
+	// Unknown snapshots aren't found
+	_, err = vfs.Stat(".snapshots/2024-03-01")
+	assert.Equal(t, ENOENT, err)
+
+	// The snapshots are read only
+	err = vfs.WriteFile(".snapshots/2024-01-01/dir/file2", []byte("hello"), 0666)
+	assert.Equal(t, EROFS, err)
+	err = vfs.Mkdir(".snapshots/2024-01-01/newdir", 0777)
+	assert.Equal(t, EROFS, err)
+	err = vfs.Remove(".snapshots/2024-01-01/dir/file1")
+	assert.Equal(t, EROFS, err)
+	_, err = vfs.OpenFile(".snapshots/2024-01-01/dir/file1", os.O_WRONLY|os.O_TRUNC, 0666)
+	assert.Equal(t, EROFS, err)
+
+	// Files and directories can't be renamed into or out of a snapshot
+	err = vfs.Rename("dir/file1", ".snapshots/2024-01-01/dir/file3")
+	assert.Equal(t, EROFS, err)
+	err = vfs.Rename("dir", ".snapshots/2024-01-01/dir2")
+	assert.Equal(t, EROFS, err)
+	err = vfs.Rename("dir/file1", ".snapshots/file3")
+	assert.Equal(t, EROFS, err)
+	err = vfs.Rename(".snapshots/2024-01-01/dir/file1", "dir/file3")
+	assert.Equal(t, EROFS, err)
+	r.CheckRemoteItems(t, file1)
+
+	// The original is untouched
+	_, err = os.Stat(filepath.Join(snapshotDir, "2024-01-01", "dir", "file1"))
+	require.NoError(t, err)
+}
@@ -175,16 +175,22 @@ var (
 
 // VFS represents the top level filing system
 type VFS struct {
-	f           fs.Fs
-	root        *Dir
-	Opt         vfscommon.Options
-	cache       *vfscache.Cache
-	cancelCache context.CancelFunc
-	usageMu     sync.Mutex
-	usageTime   time.Time
-	usage       *fs.Usage
-	pollChan    chan time.Duration
-	inUse       atomic.Int32 // count of number of opens
+	f            fs.Fs
+	root         *Dir
+	Opt          vfscommon.Options
+	cache        *vfscache.Cache
+	cancelCache  context.CancelFunc
+	usageMu      sync.Mutex
+	usageTime    time.Time
+	usage        *fs.Usage
+	pollChan     chan time.Duration
+	inUse        atomic.Int32 // count of number of opens
+	readStats    readStats    // decisions made by --vfs-adaptive-read
+	snapshots    *snapshotsFs // the snapshots if --vfs-snapshots is set
+	snapshotsDir *Dir         // the .snapshots directory if --vfs-snapshots is set
+	quota        *quota       // the quota if --vfs-quota-bytes or --vfs-quota-files is set
+	locks        *LockManager // the locks held on the VFS
+	acl          *acl         // the rules if --vfs-acl is set
 }
 
 // Keep track of active VFS keyed on fs.ConfigString(f)
@@ -229,6 +235,29 @@ func New(f fs.Fs, opt *vfscommon.Options) *VFS {
 	// Create root directory
 	vfs.root = newDir(vfs, f, nil, fsDir)
 
+	// Enforce quotas if required
+	vfs.quota = newQuota(vfs)
+
+	// Parse the access control rules if required
+	vfs.acl = newACL(vfs)
+
+	// Make the lock manager
+	locks, err := newLockManager(context.TODO(), vfs)
+	if err != nil {
+		fs.Errorf(f, "Using in memory locks: %v", err)
+	}
+	vfs.locks = locks
+
+	// Make the snapshots if required
+	if vfs.Opt.Snapshots {
+		snapshots, err := newSnapshotsFs(context.TODO(), f, vfs.Opt.SnapshotDir)
+		if err != nil {
+			fs.Errorf(f, "Disabling --vfs-snapshots: %v", err)
+		} else {
+			vfs.snapshots = snapshots
+		}
+	}
+
 	// Start polling function
 	features := vfs.f.Features()
 	if do := features.ChangeNotify; do != nil {
@@ -297,6 +326,14 @@ func (vfs *VFS) Stats() (out rc.Params) {
 	if vfs.cache != nil {
 		out["diskCache"] = vfs.cache.Stats()
 	}
+
+	if vfs.Opt.AdaptiveRead {
+		out["adaptiveRead"] = vfs.readStats.stats()
+	}
+
+	if vfs.quota != nil {
+		out["quota"] = vfs.quota.stats()
+	}
 	return out
 }
 
@@ -368,6 +405,8 @@ func (vfs *VFS) Shutdown() {
 
 	vfs.shutdownCache()
 
+	vfs.locks.shutdown()
+
 	if vfs.pollChan != nil {
 		close(vfs.pollChan)
 		vfs.pollChan = nil
@@ -666,6 +705,8 @@ func (vfs *VFS) Statfs() (total, used, free int64) {
 		total = int64(vfs.Opt.DiskSpaceTotalSize)
 	}
 
+	total, used, free = vfs.quota.statfs(total, used, free)
+
 	total, used, free = fillInMissingSizes(total, used, free, unknownFreeBytes)
 	return
 }
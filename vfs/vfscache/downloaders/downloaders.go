@@ -72,6 +72,7 @@ type Downloaders struct {
 	waiters    []waiter
 	errorCount int   // number of consecutive errors
 	lastErr    error // last error received
+	readAhead  int64 // number of bytes to read ahead of the requested range
 }
 
 // waiter is a range we are waiting for and a channel to signal when
@@ -108,12 +109,13 @@ func New(item Item, opt *vfscommon.Options, remote string, src fs.Object) (dls *
 	}
 	ctx, cancel := context.WithCancel(context.Background())
 	dls = &Downloaders{
-		ctx:    ctx,
-		cancel: cancel,
-		item:   item,
-		opt:    opt,
-		src:    src,
-		remote: remote,
+		ctx:       ctx,
+		cancel:    cancel,
+		item:      item,
+		opt:       opt,
+		src:       src,
+		remote:    remote,
+		readAhead: int64(opt.ReadAhead),
 	}
 	dls.wg.Add(1)
 	go func() {
@@ -134,6 +136,14 @@ func New(item Item, opt *vfscommon.Options, remote string, src fs.Object) (dls *
 	return dls
 }
 
+// SetReadAhead sets the number of bytes to read ahead of the
+// requested ranges for downloaders started from now on.
+func (dls *Downloaders) SetReadAhead(readAhead int64) {
+	dls.mu.Lock()
+	defer dls.mu.Unlock()
+	dls.readAhead = max(readAhead, 0)
+}
+
 // Accumulate errors for this downloader
 //
 // It should be called with
@@ -291,8 +301,8 @@ func (dls *Downloaders) _ensureDownloader(r ranges.Range) (err error) {
 	window := int64(fs.GetConfig(context.TODO()).BufferSize)
 
 	// Increase the read range by the read ahead if set
-	if dls.opt.ReadAhead > 0 {
-		r.Size += int64(dls.opt.ReadAhead)
+	if dls.readAhead > 0 {
+		r.Size += dls.readAhead
 	}
 
 	// We may be reopening a downloader after a failure here or
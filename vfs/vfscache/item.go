@@ -68,6 +68,7 @@ type Item struct {
 	pendingAccesses int                      // number of threads - cache reset not allowed if not zero
 	modified        bool                     // set if the file has been modified since the last Open
 	beingReset      bool                     // cache cleaner is resetting the cache file, access not allowed
+	readAhead       int64                    // read ahead for the downloaders, -1 to use --vfs-read-ahead
 }
 
 // Info is persisted to backing store
@@ -131,8 +132,9 @@ type StoreFn func(fs.Object)
 func newItem(c *Cache, name string) (item *Item) {
 	now := time.Now()
 	item = &Item{
-		c:    c,
-		name: name,
+		c:         c,
+		name:      name,
+		readAhead: -1,
 		info: Info{
 			ModTime: now,
 			ATime:   now,
@@ -567,7 +569,7 @@ func (item *Item) open(o fs.Object) (err error) {
 
 	// Create the downloaders
 	if item.o != nil {
-		item.downloaders = downloaders.New(item, item.c.opt, item.name, item.o)
+		item._newDownloaders()
 	}
 
 	return err
@@ -1058,7 +1060,7 @@ func (item *Item) Reset() (rr ResetResult, spaceFreed int64, err error) {
 
 	// Create the downloaders
 	if item.o != nil {
-		item.downloaders = downloaders.New(item, item.c.opt, item.name, item.o)
+		item._newDownloaders()
 	}
 
 	/* The item will stay in the beingReset state if we get an error that prevents us from
@@ -1170,11 +1172,40 @@ func (item *Item) _ensure(offset, size int64) (err error) {
 			}
 			item.o = o
 		}
-		item.downloaders = downloaders.New(item, item.c.opt, item.name, item.o)
+		item._newDownloaders()
 	}
 	return item.downloaders.Download(r)
 }
 
+// _newDownloaders makes the downloaders for the item
+//
+// call with lock held
+func (item *Item) _newDownloaders() {
+	item.downloaders = downloaders.New(item, item.c.opt, item.name, item.o)
+	if item.readAhead >= 0 {
+		// OK to call with item.mu held as nothing else can be
+		// using the new downloaders yet
+		item.downloaders.SetReadAhead(item.readAhead)
+	}
+}
+
+// SetReadAhead sets the number of bytes the downloaders read ahead of
+// the data requested. Set it to -1 to use --vfs-read-ahead.
+func (item *Item) SetReadAhead(readAhead int64) {
+	item.mu.Lock()
+	item.readAhead = readAhead
+	downloaders := item.downloaders
+	item.mu.Unlock()
+	if downloaders == nil {
+		return
+	}
+	if readAhead < 0 {
+		readAhead = int64(item.c.opt.ReadAhead)
+	}
+	// Call without item.mu held as the downloaders lock it
+	downloaders.SetReadAhead(readAhead)
+}
+
 // _written marks the (offset, size) as present in the backing file
 //
 // This is called by the downloader downloading file segments and the
@@ -0,0 +1,142 @@
+package vfscommon
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Perm is a set of permissions granted by an ACL rule
+type Perm uint8
+
+// Permissions which can be granted by an ACL rule
+const (
+	PermRead   Perm = 1 << iota // read the contents of files
+	PermWrite                   // create and write files and make directories
+	PermList                    // list the contents of directories
+	PermDelete                  // delete and rename files and directories
+
+	PermAll = PermRead | PermWrite | PermList | PermDelete
+)
+
+// letters for each permission in the order of the bits
+const permLetters = "rwld"
+
+// String turns Perm into letters, e.g. "rl"
+func (p Perm) String() string {
+	if p == 0 {
+		return "-"
+	}
+	var out []byte
+	for i := range permLetters {
+		if p&(1<<i) != 0 {
+			out = append(out, permLetters[i])
+		}
+	}
+	return string(out)
+}
+
+// parsePerm parses letters like "rwld" or "-" for no permissions
+func parsePerm(s string) (p Perm, err error) {
+	if s == "-" {
+		return 0, nil
+	}
+	for _, c := range s {
+		i := strings.IndexRune(permLetters, c)
+		if i < 0 {
+			return 0, fmt.Errorf("unknown permission %q in %q - use %q or %q", c, s, permLetters, "-")
+		}
+		p |= 1 << i
+	}
+	return p, nil
+}
+
+// ACLRule grants Perm to Path and everything below it
+type ACLRule struct {
+	Path string // path relative to the root of the VFS with no leading or trailing /
+	Perm Perm
+}
+
+// ACL is a comma separated list of path=perms rules limiting what
+// can be done in the VFS, for example "/=l,/public=rl,/incoming=w".
+//
+// It is a string so it can be compared and used as a flag.
+type ACL string
+
+// String returns the ACL as a string
+func (x ACL) String() string {
+	return string(x)
+}
+
+// Set the ACL checking it parses
+func (x *ACL) Set(s string) error {
+	if _, err := ParseACL(s); err != nil {
+		return err
+	}
+	*x = ACL(s)
+	return nil
+}
+
+// Type of the value
+func (x ACL) Type() string {
+	return "ACL"
+}
+
+// ParseACL parses a comma separated list of path=perms rules.
+//
+// perms is made of the letters r (read), w (write), l (list) and d
+// (delete), or "-" for no permissions. Rules may be quoted as CSV if
+// the path contains a comma.
+//
+// It returns nil if s is empty.
+func ParseACL(s string) (rules []ACLRule, err error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	r := csv.NewReader(strings.NewReader(s))
+	r.TrimLeadingSpace = true
+	items, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("bad ACL %q: %w", s, err)
+	}
+	seen := map[string]bool{}
+	for _, item := range items {
+		i := strings.LastIndexByte(item, '=')
+		if i < 0 {
+			return nil, fmt.Errorf("bad ACL rule %q - must be path=perms", item)
+		}
+		perm, err := parsePerm(strings.TrimSpace(item[i+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("bad ACL rule %q: %w", item, err)
+		}
+		rulePath := CleanACLPath(item[:i])
+		if seen[rulePath] {
+			return nil, fmt.Errorf("bad ACL rule %q - duplicate path", item)
+		}
+		seen[rulePath] = true
+		rules = append(rules, ACLRule{Path: rulePath, Perm: perm})
+	}
+	return rules, nil
+}
+
+// CleanACLPath cleans name so it can be matched against the rules,
+// resolving any ".." and removing the leading and trailing "/".
+func CleanACLPath(name string) string {
+	return strings.Trim(path.Clean("/"+name), "/")
+}
+
+// ErrACLNotEnforced is returned by RefuseACL
+var ErrACLNotEnforced = errors.New("--vfs-acl is only enforced by serve sftp and serve ftp")
+
+// RefuseACL returns ErrACLNotEnforced if --vfs-acl is set in opt.
+//
+// The commands which don't enforce the rules call this so they refuse
+// to run rather than giving access to everything.
+func RefuseACL(opt *Options) error {
+	if opt.ACL != "" {
+		return ErrACLNotEnforced
+	}
+	return nil
+}
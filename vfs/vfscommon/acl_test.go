@@ -0,0 +1,56 @@
+package vfscommon
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPermString(t *testing.T) {
+	assert.Equal(t, "-", Perm(0).String())
+	assert.Equal(t, "rl", (PermRead | PermList).String())
+	assert.Equal(t, "rwld", PermAll.String())
+}
+
+func TestParseACL(t *testing.T) {
+	rules, err := ParseACL("")
+	require.NoError(t, err)
+	assert.Nil(t, rules)
+
+	rules, err = ParseACL(`/=l, /public/=rl,incoming=w,"/a,b=c=d",/x/../private=-`)
+	require.NoError(t, err)
+	assert.Equal(t, []ACLRule{
+		{Path: "", Perm: PermList},
+		{Path: "public", Perm: PermRead | PermList},
+		{Path: "incoming", Perm: PermWrite},
+		{Path: "a,b=c", Perm: PermDelete},
+		{Path: "private", Perm: 0},
+	}, rules)
+
+	for _, bad := range []string{
+		"/public",
+		"/public=rx",
+		"/public=r,/public/=l",
+		`"/public=r`,
+	} {
+		_, err = ParseACL(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestACLSet(t *testing.T) {
+	var acl ACL
+	assert.Equal(t, "ACL", acl.Type())
+	require.NoError(t, acl.Set("/=rl"))
+	assert.Equal(t, "/=rl", acl.String())
+	assert.Error(t, acl.Set("/=potato"))
+	assert.Equal(t, ACL("/=rl"), acl)
+}
+
+func TestRefuseACL(t *testing.T) {
+	opt := Opt
+	assert.NoError(t, RefuseACL(&opt))
+	opt.ACL = "/=rl"
+	assert.Equal(t, ErrACLNotEnforced, RefuseACL(&opt))
+}
@@ -90,6 +90,46 @@ var OptionsInfo = fs.Options{{
 	Default: 0,
 	Help:    "The number of parallel streams to read at once",
 	Groups:  "VFS",
+}, {
+	Name:    "vfs_adaptive_read",
+	Default: false,
+	Help:    "Tune chunk size, streams and read ahead to the access pattern of each open file",
+	Groups:  "VFS",
+}, {
+	Name:    "vfs_snapshots",
+	Default: false,
+	Help:    "Show the remote at earlier times in a read only .snapshots directory",
+	Groups:  "VFS",
+}, {
+	Name:    "vfs_snapshot_dir",
+	Default: "",
+	Help:    "Remote directory of --backup-dir trees to show in .snapshots instead of versions",
+	Groups:  "VFS",
+}, {
+	Name:    "vfs_quota_bytes",
+	Default: fs.SizeSuffix(-1),
+	Help:    "Max total size of the files in the VFS",
+	Groups:  "VFS",
+}, {
+	Name:    "vfs_quota_files",
+	Default: int64(-1),
+	Help:    "Max number of files in the VFS (-1 for no limit)",
+	Groups:  "VFS",
+}, {
+	Name:    "vfs_lock_file",
+	Default: "",
+	Help:    "Remote file to store locks in so they are shared between rclone instances",
+	Groups:  "VFS",
+}, {
+	Name:    "vfs_lock_ttl",
+	Default: fs.Duration(5 * time.Minute),
+	Help:    "Time a lock lasts after rclone stops refreshing it (0 for never)",
+	Groups:  "VFS",
+}, {
+	Name:    "vfs_acl",
+	Default: ACL(""),
+	Help:    "Comma separated path=perms rules limiting access to the VFS, e.g. \"/=l,/incoming=w\"",
+	Groups:  "VFS",
 }, {
 	Name:    "dir_perms",
 	Default: FileMode(0777),
@@ -195,6 +235,7 @@ type Options struct {
 	ChunkSize          fs.SizeSuffix `config:"vfs_read_chunk_size"`       // if > 0 read files in chunks
 	ChunkSizeLimit     fs.SizeSuffix `config:"vfs_read_chunk_size_limit"` // if > ChunkSize double the chunk size after each chunk until reached
 	ChunkStreams       int           `config:"vfs_read_chunk_streams"`    // Number of download streams to use
+	AdaptiveRead       bool          `config:"vfs_adaptive_read"`         // if set tune reading to the access pattern
 	CacheMode          CacheMode     `config:"vfs_cache_mode"`
 	CacheMaxAge        fs.Duration   `config:"vfs_cache_max_age"`
 	CacheMaxSize       fs.SizeSuffix `config:"vfs_cache_max_size"`
@@ -210,6 +251,13 @@ type Options struct {
 	FastFingerprint    bool          `config:"vfs_fast_fingerprint"` // if set use fast fingerprints
 	DiskSpaceTotalSize fs.SizeSuffix `config:"vfs_disk_space_total_size"`
 	MetadataExtension  string        `config:"vfs_metadata_extension"` // if set respond to files with this extension with metadata
+	Snapshots          bool          `config:"vfs_snapshots"`          // if set show a .snapshots directory
+	SnapshotDir        string        `config:"vfs_snapshot_dir"`       // if set the snapshots are the directories in here
+	QuotaBytes         fs.SizeSuffix `config:"vfs_quota_bytes"`        // max bytes stored, -1 for unlimited
+	QuotaFiles         int64         `config:"vfs_quota_files"`        // max files stored, -1 for unlimited
+	LockFile           string        `config:"vfs_lock_file"`          // if set store the locks in this remote file
+	LockTTL            fs.Duration   `config:"vfs_lock_ttl"`           // lifetime of locks which aren't refreshed
+	ACL                ACL           `config:"vfs_acl"`                // if set only allow access to the paths in the rules
 }
 
 // Opt is the default options modified by the environment variables and command line flags
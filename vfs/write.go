@@ -80,6 +80,7 @@ func (fh *WriteFileHandle) openPending() (err error) {
 		fh.o = o
 		fh.result <- err
 	}()
+	_ = fh.file.VFS().quota.use(-fh.file.Size(), 0) // the old contents are being replaced
 	fh.file.setSize(0)
 	fh.truncated = true
 	fh.file.Dir().addObject(fh.file) // make sure the directory has this object in it now
@@ -142,11 +143,16 @@ func (fh *WriteFileHandle) writeAt(p []byte, off int64) (n int, err error) {
 	if err = fh.openPending(); err != nil {
 		return 0, err
 	}
+	q := fh.file.VFS().quota
+	if err = q.use(int64(len(p)), 0); err != nil {
+		return 0, err
+	}
 	fh.writeCalled = true
 	n, err = fh.pipeWriter.Write(p)
 	fh.offset += int64(n)
 	fh.file.setSize(fh.offset)
 	if err != nil {
+		_ = q.use(int64(n-len(p)), 0) // give back what wasn't written
 		fs.Errorf(fh.remote, "WriteFileHandle.Write error: %v", err)
 		return 0, err
 	}
@@ -206,9 +212,12 @@ func (fh *WriteFileHandle) close() (err error) {
 	if err == nil {
 		fh.file.setObject(fh.o)
 		err = writeCloseErr
-	} else if fh.file.getObject() == nil {
+	} else if o := fh.file.getObject(); o == nil {
 		// Remove vfs file entry when no object is present
 		_ = fh.file.Remove()
+	} else {
+		// The old object is still there so swap its size back in
+		_ = fh.file.VFS().quota.use(o.Size()-fh.offset, 0)
 	}
 	return err
 }
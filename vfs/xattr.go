@@ -0,0 +1,234 @@
+package vfs
+
+// Extended attributes
+//
+// The extended attributes in the "user." namespace are mapped onto
+// the user metadata of the objects, so "user.key" is the metadata
+// item "key". The system metadata of the backend isn't exposed.
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// XattrUserPrefix is the namespace of the extended attributes which
+// are mapped onto metadata
+const XattrUserPrefix = "user."
+
+// Flags for SetXattr - these have the same values as in Linux
+const (
+	XattrCreate  = 1 // fail with EEXIST if the attribute exists
+	XattrReplace = 2 // fail with ENOATTR if the attribute doesn't exist
+)
+
+// xattrKey returns the metadata key for the extended attribute name
+//
+// It returns ENOATTR if the name isn't in the user namespace or is a
+// system metadata key.
+func (f *File) xattrKey(name string) (key string, err error) {
+	key, ok := strings.CutPrefix(name, XattrUserPrefix)
+	if !ok || key == "" {
+		return "", ENOATTR
+	}
+	if _, isSystem := systemMetadata(f.Fs())[key]; isSystem {
+		return "", ENOATTR
+	}
+	return key, nil
+}
+
+// systemMetadata returns the system metadata keys of f's backend
+func systemMetadata(f fs.Fs) map[string]fs.MetadataHelp {
+	ri := fs.FindFromFs(f)
+	if ri == nil || ri.MetadataInfo == nil {
+		return nil
+	}
+	return ri.MetadataInfo.System
+}
+
+// userMetadata returns the user metadata of the file including any
+// which is waiting to be written.
+func (f *File) userMetadata() (metadata fs.Metadata, err error) {
+	f.mu.RLock()
+	o := f.o
+	for k, v := range f.pendingMetadata {
+		metadata.Set(k, v)
+	}
+	f.mu.RUnlock()
+	if o == nil {
+		return metadata, nil
+	}
+	objectMetadata, err := fs.GetMetadata(context.TODO(), o)
+	if err != nil {
+		return nil, err
+	}
+	system := systemMetadata(f.Fs())
+	for k, v := range objectMetadata {
+		if _, isSystem := system[k]; isSystem {
+			continue
+		}
+		if _, isPending := metadata[k]; !isPending {
+			metadata.Set(k, v)
+		}
+	}
+	return metadata, nil
+}
+
+// ListXattr returns the names of the extended attributes of the file
+func (f *File) ListXattr() (names []string, err error) {
+	metadata, err := f.userMetadata()
+	if err != nil {
+		return nil, err
+	}
+	for k := range metadata {
+		names = append(names, XattrUserPrefix+k)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// GetXattr returns the value of the extended attribute name
+//
+// It returns ENOATTR if it isn't found.
+func (f *File) GetXattr(name string) (value []byte, err error) {
+	key, err := f.xattrKey(name)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := f.userMetadata()
+	if err != nil {
+		return nil, err
+	}
+	v, ok := metadata[key]
+	if !ok {
+		return nil, ENOATTR
+	}
+	return []byte(v), nil
+}
+
+// SetXattr sets the extended attribute name to value
+//
+// flags may be XattrCreate or XattrReplace to require that the
+// attribute doesn't exist or does exist already.
+//
+// If the file is being written the attribute is set once it has been
+// uploaded.
+func (f *File) SetXattr(name string, value []byte, flags int) error {
+	key, ok := strings.CutPrefix(name, XattrUserPrefix)
+	if !ok || key == "" {
+		return ENOTSUP
+	}
+	if _, isSystem := systemMetadata(f.Fs())[key]; isSystem {
+		return EPERM
+	}
+	if f.d.readOnly() {
+		return EROFS
+	}
+	if flags&(XattrCreate|XattrReplace) != 0 {
+		metadata, err := f.userMetadata()
+		if err != nil {
+			return err
+		}
+		_, exists := metadata[key]
+		if flags&XattrCreate != 0 && exists {
+			return EEXIST
+		}
+		if flags&XattrReplace != 0 && !exists {
+			return ENOATTR
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pendingMetadata.Set(key, string(value))
+
+	// Only update the metadata when there are no writers, setObject will do it
+	if !f._writingInProgress() {
+		return f._applyPendingMetadata()
+	}
+
+	// queue up for later, hoping f.o becomes available
+	return nil
+}
+
+// RemoveXattr removes the extended attribute name
+//
+// Backends can't remove metadata so this only works for attributes
+// which haven't been written yet.
+func (f *File) RemoveXattr(name string) error {
+	key, err := f.xattrKey(name)
+	if err != nil {
+		return err
+	}
+	if f.d.readOnly() {
+		return EROFS
+	}
+	f.mu.Lock()
+	_, pending := f.pendingMetadata[key]
+	delete(f.pendingMetadata, key)
+	f.mu.Unlock()
+	if pending {
+		return nil
+	}
+	metadata, err := f.userMetadata()
+	if err != nil {
+		return err
+	}
+	if _, exists := metadata[key]; !exists {
+		return ENOATTR
+	}
+	return ENOTSUP
+}
+
+// Apply any pending metadata
+//
+// Call with the mutex held
+func (f *File) _applyPendingMetadata() error {
+	if len(f.pendingMetadata) == 0 {
+		return nil
+	}
+	defer func() { f.pendingMetadata = nil }()
+
+	if f.o == nil {
+		return errors.New("cannot apply metadata, file object is not available")
+	}
+
+	o, err := setObjectMetadata(context.TODO(), f.d.f, f.o, f.pendingMetadata)
+	if err != nil {
+		fs.Errorf(f.o, "Failed to apply pending metadata: %v", err)
+		return err
+	}
+	fs.Debugf(f.o, "Applied pending metadata OK")
+	f.o = o
+	return nil
+}
+
+// setObjectMetadata sets the user metadata on o in f, returning the
+// possibly new object.
+//
+// Objects which can't have their metadata set directly are copied
+// onto themselves with the new metadata on bucket based backends which
+// can do this server side.
+func setObjectMetadata(ctx context.Context, f fs.Fs, o fs.Object, metadata fs.Metadata) (fs.Object, error) {
+	if do, ok := o.(fs.SetMetadataer); ok {
+		err := do.SetMetadata(ctx, metadata)
+		if errors.Is(err, fs.ErrorNotImplemented) {
+			return o, ENOTSUP
+		}
+		return o, err
+	}
+	features := f.Features()
+	if features.Copy == nil || !features.BucketBased || !features.WriteMetadata {
+		return o, ENOTSUP
+	}
+	ctx, ci := fs.AddConfig(ctx)
+	ci.Metadata = true
+	newMetadata := make(fs.Metadata, len(ci.MetadataSet)+len(metadata))
+	newMetadata.Merge(ci.MetadataSet)
+	newMetadata.Merge(metadata)
+	ci.MetadataSet = newMetadata
+	return features.Copy(ctx, o, o.Remote())
+}
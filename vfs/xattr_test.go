@@ -0,0 +1,121 @@
+package vfs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileXattr(t *testing.T) {
+	ctx := context.Background()
+	r, vfs := newTestVFS(t)
+	file1 := r.WriteObject(ctx, "file1", "contents", t1)
+	r.CheckRemoteItems(t, file1)
+
+	node, err := vfs.Stat("file1")
+	require.NoError(t, err)
+	file := node.(*File)
+
+	names, err := file.ListXattr()
+	require.NoError(t, err)
+	assert.Empty(t, names)
+
+	err = file.SetXattr("user.colour", []byte("blue"), 0)
+	if errors.Is(err, ENOTSUP) || errors.Is(err, fs.ErrorNotImplemented) {
+		t.Skip("backend can't set metadata")
+	}
+	if err != nil && os.IsPermission(err) {
+		t.Skipf("file system doesn't support xattrs: %v", err)
+	}
+	require.NoError(t, err)
+
+	value, err := file.GetXattr("user.colour")
+	require.NoError(t, err)
+	assert.Equal(t, "blue", string(value))
+
+	names, err = file.ListXattr()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user.colour"}, names)
+
+	// Check it was stored as metadata
+	o, err := r.Fremote.NewObject(ctx, "file1")
+	require.NoError(t, err)
+	metadata, err := fs.GetMetadata(ctx, o)
+	require.NoError(t, err)
+	assert.Equal(t, "blue", metadata["colour"])
+
+	// Flags
+	assert.Equal(t, EEXIST, file.SetXattr("user.colour", []byte("red"), XattrCreate))
+	assert.Equal(t, ENOATTR, file.SetXattr("user.size", []byte("big"), XattrReplace))
+	require.NoError(t, file.SetXattr("user.colour", []byte("red"), XattrReplace))
+	value, err = file.GetXattr("user.colour")
+	require.NoError(t, err)
+	assert.Equal(t, "red", string(value))
+
+	// Other namespaces and system metadata aren't visible
+	_, err = file.GetXattr("user.mtime")
+	assert.Equal(t, ENOATTR, err)
+	_, err = file.GetXattr("security.capability")
+	assert.Equal(t, ENOATTR, err)
+	_, err = file.GetXattr("user.missing")
+	assert.Equal(t, ENOATTR, err)
+	assert.Equal(t, ENOTSUP, file.SetXattr("system.posix_acl_access", []byte("x"), 0))
+	assert.Equal(t, EPERM, file.SetXattr("user.mtime", []byte("x"), 0))
+
+	// Stored attributes can't be removed
+	assert.Equal(t, ENOTSUP, file.RemoveXattr("user.colour"))
+	assert.Equal(t, ENOATTR, file.RemoveXattr("user.missing"))
+}
+
+func TestFileXattrPending(t *testing.T) {
+	r, vfs := newTestVFS(t)
+
+	fh, err := vfs.OpenFile("file1", os.O_WRONLY|os.O_CREATE, 0777)
+	require.NoError(t, err)
+	node, err := vfs.Stat("file1")
+	require.NoError(t, err)
+	file := node.(*File)
+
+	// Set and remove while the file is being written
+	require.NoError(t, file.SetXattr("user.colour", []byte("blue"), 0))
+	require.NoError(t, file.SetXattr("user.size", []byte("big"), 0))
+	require.NoError(t, file.RemoveXattr("user.size"))
+	names, err := file.ListXattr()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user.colour"}, names)
+
+	_, err = fh.Write([]byte("hello"))
+	require.NoError(t, err)
+	err = fh.Close()
+	if errors.Is(err, ENOTSUP) || os.IsPermission(err) {
+		t.Skipf("can't set metadata: %v", err)
+	}
+	require.NoError(t, err)
+
+	o, err := r.Fremote.NewObject(context.Background(), "file1")
+	require.NoError(t, err)
+	metadata, err := fs.GetMetadata(context.Background(), o)
+	require.NoError(t, err)
+	assert.Equal(t, "blue", metadata["colour"])
+	_, found := metadata["size"]
+	assert.False(t, found)
+}
+
+func TestFileXattrReadOnly(t *testing.T) {
+	opt := vfscommon.Opt
+	opt.ReadOnly = true
+	r, vfs := newTestVFSOpt(t, &opt)
+	file1 := r.WriteObject(context.Background(), "file1", "contents", t1)
+	r.CheckRemoteItems(t, file1)
+
+	node, err := vfs.Stat("file1")
+	require.NoError(t, err)
+	file := node.(*File)
+	assert.Equal(t, EROFS, file.SetXattr("user.colour", []byte("blue"), 0))
+}